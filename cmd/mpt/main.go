@@ -2,25 +2,61 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
+	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/go-pkgz/lgr"
 	"github.com/jessevdk/go-flags"
+	"gopkg.in/yaml.v3"
 
+	"github.com/umputun/mpt/pkg/apply"
+	"github.com/umputun/mpt/pkg/auth"
+	"github.com/umputun/mpt/pkg/batchapi"
+	"github.com/umputun/mpt/pkg/compare"
 	"github.com/umputun/mpt/pkg/config"
+	"github.com/umputun/mpt/pkg/constraint"
+	"github.com/umputun/mpt/pkg/environ"
+	"github.com/umputun/mpt/pkg/files"
+	"github.com/umputun/mpt/pkg/history"
+	"github.com/umputun/mpt/pkg/keyring"
+	"github.com/umputun/mpt/pkg/lint"
 	"github.com/umputun/mpt/pkg/mcp"
 	"github.com/umputun/mpt/pkg/mix"
+	"github.com/umputun/mpt/pkg/normalize"
+	"github.com/umputun/mpt/pkg/notify"
+	"github.com/umputun/mpt/pkg/pricing"
+	"github.com/umputun/mpt/pkg/progress"
 	"github.com/umputun/mpt/pkg/prompt"
+	"github.com/umputun/mpt/pkg/provenance"
 	"github.com/umputun/mpt/pkg/provider"
+	"github.com/umputun/mpt/pkg/provider/alias"
+	"github.com/umputun/mpt/pkg/quota"
+	"github.com/umputun/mpt/pkg/render"
+	"github.com/umputun/mpt/pkg/repair"
+	"github.com/umputun/mpt/pkg/review"
 	"github.com/umputun/mpt/pkg/runner"
+	"github.com/umputun/mpt/pkg/secrets"
+	"github.com/umputun/mpt/pkg/server"
+	"github.com/umputun/mpt/pkg/tokens"
+	"github.com/umputun/mpt/pkg/validate"
 )
 
 // options with all CLI options
@@ -28,6 +64,7 @@ type options struct {
 	OpenAI    openAIOpts    `group:"openai" namespace:"openai" env-namespace:"OPENAI"`
 	Anthropic anthropicOpts `group:"anthropic" namespace:"anthropic" env-namespace:"ANTHROPIC"`
 	Google    googleOpts    `group:"google" namespace:"google" env-namespace:"GOOGLE"`
+	DeepSeek  deepSeekOpts  `group:"deepseek" namespace:"deepseek" env-namespace:"DEEPSEEK"`
 
 	Custom customOpenAIProvider `group:"custom" namespace:"custom" env-namespace:"CUSTOM"`
 
@@ -35,80 +72,356 @@ type options struct {
 	Customs map[string]customSpec `long:"customs" description:"Add custom OpenAI-compatible provider as 'id:key=value[,key=value,...]' (e.g., openrouter:url=https://openrouter.ai/api/v1,model=claude-3.5)" key-value-delimiter:":" value-name:"ID:SPEC"`
 
 	MCP   mcpOpts   `group:"mcp" namespace:"mcp" env-namespace:"MCP"`
+	HTTP  httpOpts  `group:"http" namespace:"http" env-namespace:"HTTP"`
+	Serve serveOpts `group:"serve" namespace:"serve" env-namespace:"SERVE"`
 	Git   gitOpts   `group:"git" namespace:"git" env-namespace:"GIT"`
+	Ctx   ctxOpts   `group:"context" namespace:"context" env-namespace:"CONTEXT"`
 	Retry retryOpts `group:"retry" namespace:"retry" env-namespace:"RETRY"`
+	Quota quotaOpts `group:"quota" namespace:"quota" env-namespace:"QUOTA"`
 
-	Prompt      string        `short:"p" long:"prompt" description:"prompt text (if not provided, will be read from stdin)"`
-	Files       []string      `short:"f" long:"file" description:"files or glob patterns to include in the prompt context"`
-	Excludes    []string      `short:"x" long:"exclude" description:"patterns to exclude from file matching (e.g., 'vendor/**', '**/mocks/*')"`
-	Timeout     time.Duration `short:"t" long:"timeout" default:"60s" description:"timeout duration"`
-	MaxFileSize SizeValue     `long:"max-file-size" env:"MAX_FILE_SIZE" default:"65536" description:"maximum size of individual files to process in bytes (default: 64KB, supports k/kb/m/mb/g/gb suffixes)"`
-	Force       bool          `long:"force" description:"force loading files by skipping all exclusion patterns (including .gitignore and common patterns)"`
+	Tokens tokensOpts `group:"tokens" namespace:"tokens" env-namespace:"TOKENS"`
+	Budget budgetOpts `group:"budget" namespace:"budget" env-namespace:"BUDGET"`
+
+	// failure injection for testing of integrations, hidden from help
+	Fault faultOpts `group:"fault" namespace:"fault" env-namespace:"FAULT" hidden:"true"`
+
+	History historyOpts `group:"history" namespace:"history" env-namespace:"HISTORY"`
+
+	Apply applyOpts `group:"apply" namespace:"apply" env-namespace:"APPLY"`
+
+	Batch batchOpts `group:"batch" namespace:"batch" env-namespace:"BATCH"`
+
+	Prompt      string            `short:"p" long:"prompt" description:"prompt text (if not provided, will be read from stdin)"`
+	PromptFile  string            `long:"prompt-file" description:"read prompt from file, with options set in the optional YAML front-matter"`
+	PromptArgs  map[string]string `long:"prompt-arg" key-value-delimiter:"=" value-name:"NAME=VALUE" description:"argument of the prompt template, referenced as {{.name}}, can be repeated"`
+	Edit        bool              `long:"edit" description:"compose the prompt in $EDITOR, pre-filled with the prompt if given"`
+	Template    bool              `long:"template" description:"expand file, glob and gitdiff template functions in the prompt"`
+	Files       []string          `short:"f" long:"file" description:"files or glob patterns to include in the prompt context, @file reads patterns from the file"`
+	Excludes    []string          `short:"x" long:"exclude" description:"patterns to exclude from file matching (e.g., 'vendor/**', '**/mocks/*')"`
+	Timeout     time.Duration     `short:"t" long:"timeout" description:"deprecated alias of --timeout.generation"`
+	MaxFileSize SizeValue         `long:"max-file-size" env:"MAX_FILE_SIZE" default:"65536" description:"maximum size of individual files to process in bytes (default: 64KB, supports k/kb/m/mb/g/gb suffixes)"`
+	Force       bool              `long:"force" description:"force loading files by skipping all exclusion patterns (including .gitignore and common patterns)"`
+	Ecosystem   []string          `long:"ecosystem" env:"ECOSYSTEM" env-delim:"," default:"auto" description:"project ecosystems adding default excludes and file summaries: auto, none, go, node, python, rust, terraform"`
+	EnvContext  bool              `long:"env-context" env:"ENV_CONTEXT" description:"include snapshot of the runtime environment in the prompt: OS, versions of project tools, git branch and commit, with secrets redacted"`
+
+	TimeoutConnect    time.Duration `long:"timeout.connect" env:"TIMEOUT_CONNECT" default:"10s" description:"max time to connect to provider API, including TLS handshake"`
+	TimeoutGeneration time.Duration `long:"timeout.generation" env:"TIMEOUT_GENERATION" default:"60s" description:"max time of a single generation request"`
+	TimeoutTotal      time.Duration `long:"timeout.total" env:"TIMEOUT_TOTAL" default:"10m" description:"max time of the whole run, including retries, continuations and mix, 0 for no limit"`
+	TimeoutAuto       bool          `long:"timeout.auto" env:"TIMEOUT_AUTO" description:"scale generation timeout by estimated prompt tokens and max output tokens, instead of --timeout.generation"`
+	TimeoutAutoBase   time.Duration `long:"timeout.auto-base" env:"TIMEOUT_AUTO_BASE" default:"15s" description:"base of the generation timeout scaled with --timeout.auto"`
+	TimeoutAutoPer1K  time.Duration `long:"timeout.auto-per-1k" env:"TIMEOUT_AUTO_PER_1K" default:"2s" description:"increment of the generation timeout per 1k tokens of prompt and max output with --timeout.auto"`
+
+	ShutdownGrace time.Duration `long:"shutdown.grace" env:"SHUTDOWN_GRACE" default:"30s" description:"how long running requests of server modes may complete on shutdown before they are canceled"`
+
+	FollowSymlinks    bool `long:"follow-symlinks" env:"FOLLOW_SYMLINKS" description:"follow symlinked directories when matching file patterns"`
+	IncludeSubmodules bool `long:"include-submodules" env:"INCLUDE_SUBMODULES" description:"include files from git submodules, skipped by default"`
+
+	// file relevance options
+	FilesRelevant bool    `long:"files.relevant" env:"FILES_RELEVANT" description:"include only file chunks relevant to the prompt, selected with embeddings"`
+	FilesTopK     int     `long:"files.top-k" env:"FILES_TOP_K" default:"20" description:"max number of relevant file chunks to include"`
+	FilesMinScore float64 `long:"files.min-score" env:"FILES_MIN_SCORE" default:"0.2" description:"min relevance score (cosine similarity) of included file chunks"`
+	FilesWorkers  int     `long:"files.workers" env:"FILES_WORKERS" default:"8" description:"number of workers reading files concurrently"`
+
+	FilesReport bool `long:"files.report" env:"FILES_REPORT" description:"print a table of files included in the prompt with size, estimated tokens and percent of the context, largest first"`
+
+	FilesChangedSince string `long:"files.changed-since" env:"FILES_CHANGED_SINCE" description:"include only matched files changed since the git ref, e.g. origin/main, with full content"`
+
+	First bool `long:"first" env:"FIRST" description:"return the first successful response and cancel the rest of providers"`
+
+	ExecOnComplete string `long:"exec-on-complete" env:"EXEC_ON_COMPLETE" description:"shell command to run on completion with the JSON result on stdin"`
+
+	Notify bool `long:"notify" env:"NOTIFY" description:"send a desktop notification when the run finishes"`
+
+	// run metadata, recorded to history and output
+	Name string            `long:"name" env:"RUN_NAME" description:"name of the run, e.g. pr-1234-security-review"`
+	Tags map[string]string `long:"tag" env:"RUN_TAGS" env-delim:"," key-value-delimiter:"=" value-name:"KEY=VALUE" description:"tag of the run as key=value, can be repeated"`
+
+	NoInstructions bool `long:"no-instructions" env:"NO_INSTRUCTIONS" description:"don't put per-provider instructions before prompts, for ad-hoc queries"`
+
+	Auto   bool `long:"auto" env:"AUTO" description:"enable standard providers with API keys set, like OPENAI_API_KEY"`
+	NoAuto bool `long:"no-auto" env:"NO_AUTO" description:"disable --auto, e.g. set by config files"`
+
+	ModelAliases string        `long:"model-aliases" env:"MODEL_ALIASES" description:"JSON file with model aliases per provider, merged over built-in aliases"`
+	ModelsTTL    time.Duration `long:"models-ttl" env:"MODELS_TTL" default:"24h" description:"time to use models discovered from custom providers with discover=true before refreshing them"`
+
+	NoProgress bool `long:"no-progress" env:"NO_PROGRESS" description:"disable progress display of provider requests, shown on terminal by default"`
+	Quiet      bool `short:"q" long:"quiet" env:"QUIET" description:"print only the final answer, without provider headers and progress"`
+	StatusLine bool `long:"status-line" env:"STATUS_LINE" description:"print a summary line of the run to stderr, with providers ok and failed, duration and prompt tokens"`
+
+	// provider selection and ordering
+	Only  []string `long:"only" description:"use only providers with given names, comma-separated (e.g., openai,google)"`
+	Skip  []string `long:"skip" description:"skip providers with given names, comma-separated (e.g., anthropic)"`
+	Order string   `long:"order" env:"ORDER" choice:"configured" choice:"name" choice:"latency" default:"configured" description:"order of provider results"`
+
+	// generation options applied to all providers
+	MaxOutputTokens SizeValue `long:"max-output-tokens" env:"MAX_OUTPUT_TOKENS" description:"max tokens to generate by all providers, overrides per-provider max tokens (supports k/m suffixes)"`
+	MaxTokens       SizeValue `long:"max-tokens" env:"MAX_TOKENS" description:"short alias of --max-output-tokens"`
+	Temperature     *float32  `long:"temperature" env:"TEMPERATURE" description:"temperature of all providers supporting it, overrides per-provider temperature"`
+	Stop            []string  `long:"stop" description:"sequence stopping generation, can be repeated"`
+
+	// answer constraints, turned into output instructions for each provider
+	Format   string `long:"format" env:"FORMAT" description:"format of answers, like \"markdown with sections: Summary, Issues, Suggestions\""`
+	MaxWords int    `long:"max-words" env:"MAX_WORDS" description:"max words of answers"`
+
+	// answer validation options
+	Validate         string `long:"validate" env:"VALIDATE" description:"check answers with a regex or a JSON schema (inline or .json file), re-asking providers on failure"`
+	ValidateAttempts int    `long:"validate.attempts" env:"VALIDATE_ATTEMPTS" default:"3" description:"max requests per provider to get a valid answer"`
+
+	// prompt lint options
+	Lint     bool `long:"lint" env:"LINT" description:"check the prompt for contradictory instructions, missing question, oversized pasted logs, likely secrets and mixed languages before sending it"`
+	LintFail bool `long:"lint.fail" env:"LINT_FAIL" description:"fail if the prompt lint finds problems, for CI, implies --lint"`
+
+	// answer normalization options
+	Normalize      bool   `long:"normalize" env:"NORMALIZE" description:"remove boilerplate like \"Sure! Here's...\" and sign-offs from answers and normalize markdown headers"`
+	NormalizeRules string `long:"normalize.rules" env:"NORMALIZE_RULES" description:"YAML file with normalization rules, extending or disabling built-in rules"`
+
+	// answer repair options
+	RepairMarkdown bool `long:"repair.markdown" env:"REPAIR_MARKDOWN" description:"repair broken markdown of answers, like unclosed code blocks and tables without the delimiter row, before they are mixed and printed"`
+
+	// fixtures options
+	Record string `long:"record" env:"RECORD" description:"record provider responses to fixtures in the given directory"`
+	Replay string `long:"replay" env:"REPLAY" description:"replay provider responses recorded in the given directory, without calling APIs"`
+
+	AutoContinue bool         `long:"auto-continue" env:"AUTO_CONTINUE" description:"continue responses truncated by the max tokens limit"`
+	Continue     continueOpts `group:"continue" namespace:"continue" env-namespace:"CONTINUE"`
 
 	// mix options
-	MixEnabled  bool   `long:"mix" env:"MIX" description:"enable mix (merge) results from all providers"`
-	MixProvider string `long:"mix.provider" env:"MIX_PROVIDER" default:"openai" description:"provider used to mix results"`
-	MixPrompt   string `long:"mix.prompt" env:"MIX_PROMPT" default:"merge results from all providers" description:"prompt used to mix results"`
+	MixEnabled        bool      `long:"mix" env:"MIX" description:"enable mix (merge) results from all providers"`
+	MixProvider       string    `long:"mix.provider" env:"MIX_PROVIDER" default:"openai" description:"provider used to mix results, or comma-separated chain of providers refining the merged result, capability:<cap> selects provider by capability"`
+	MixPrompt         string    `long:"mix.prompt" env:"MIX_PROMPT" default:"merge results from all providers" description:"prompt used to mix results"`
+	MixPreset         string    `long:"mix.preset" env:"MIX_PRESET" description:"named mix prompt replacing --mix.prompt: summarize, reconcile, rank, table-compare, or <name>.md in mix directory of the prompt library"`
+	MixRefinePrompt   string    `long:"mix.refine-prompt" env:"MIX_REFINE_PROMPT" description:"prompt used by refinement stages of the mix provider chain"`
+	MixShowIndividual bool      `long:"mix.show-individual" env:"MIX_SHOW_INDIVIDUAL" description:"print individual provider results before the mixed result"`
+	MixMaxTokens      SizeValue `long:"mix.max-tokens" env:"MIX_MAX_TOKENS" description:"max tokens of the mixed result, limits requests of the mix provider chain (supports k/m suffixes)"`
+	MixStyle          string    `long:"mix.style" env:"MIX_STYLE" choice:"bullet" choice:"narrative" choice:"table" description:"style of the mixed result: bullet, narrative or table, free-form if not set"`
+	MixQuorum         int       `long:"mix.quorum" env:"MIX_QUORUM" description:"start mixing streamed runs of HTTP server once this many providers answered, updating the result with late answers"`
+
+	// capabilities of providers, used to select mix and consensus providers with capability:<cap> specs
+	Capabilities map[string]string `long:"capability" env:"CAPABILITIES" env-delim:";" key-value-delimiter:"=" value-name:"PROVIDER=CAPS" description:"comma-separated capabilities of provider, overriding built-in capabilities of its model, can be repeated"`
+
+	// prompt variants options
+	PromptVariants      string `long:"prompt-variants" env:"PROMPT_VARIANTS" description:"YAML file with prompt variants, each variant is sent to all providers and answers are compared in a matrix"`
+	PromptVariantsJudge string `long:"prompt-variants.judge" env:"PROMPT_VARIANTS_JUDGE" description:"provider scoring answers to prompt variants, capability:<cap> selects provider by capability"`
+
+	// review options
+	Review      bool   `long:"review" env:"REVIEW" description:"code review mode, providers return findings aggregated by file and line"`
+	ReviewSARIF string `long:"review.sarif" env:"REVIEW_SARIF" description:"write review findings to the given SARIF file"`
 
 	// consensus options - works with mix mode
 	ConsensusEnabled  bool `long:"consensus" env:"CONSENSUS" description:"enable consensus checking when using mix"`
 	ConsensusAttempts int  `long:"consensus.attempts" env:"CONSENSUS_ATTEMPTS" default:"1" description:"max consensus attempts (1-5)"`
 
 	// common options
-	Debug   bool `long:"dbg" env:"DEBUG" description:"debug mode"`
-	Verbose bool `short:"v" long:"verbose" description:"verbose output, shows prompt sent to models"`
-	Version bool `short:"V" long:"version" description:"show version info"`
-	JSON    bool `long:"json" description:"output in JSON format for scripting and automation"`
+	Debug     bool   `long:"dbg" env:"DEBUG" description:"debug mode, same as -vv"`
+	Verbose   []bool `short:"v" long:"verbose" description:"verbosity level: -v shows prompt sent to models, -vv adds debug logs, -vvv adds full provider requests and responses"`
+	LogFormat string `long:"log.format" env:"LOG_FORMAT" choice:"text" choice:"json" default:"text" description:"format of debug logs, json writes structured lines"`
+	Version   bool   `short:"V" long:"version" description:"show version info"`
+	JSON      bool   `long:"json" description:"output in JSON format for scripting and automation"`
+	JSONRaw   bool   `long:"json.raw" env:"JSON_RAW" description:"include sanitized raw API responses of providers in JSON and YAML output"`
+
+	ShowReasoning bool `long:"show-reasoning" env:"SHOW_REASONING" description:"include reasoning traces (Anthropic extended thinking, DeepSeek reasoner, OpenAI reasoning summaries) in the output"`
+
+	OutputFormat string `long:"output.format" env:"OUTPUT_FORMAT" choice:"text" choice:"yaml" choice:"tsv" choice:"csv" choice:"sarif" choice:"rdjson" default:"text" description:"output format: text, yaml, tsv or csv with a row per provider, sarif or rdjson for review findings"`
+	Render       bool   `long:"render" env:"RENDER" description:"render markdown of answers with colors, highlighted code blocks and wrapped paragraphs, plain text if colors are off"`
+	Color        string `long:"color" env:"COLOR" choice:"auto" choice:"always" choice:"never" default:"auto" description:"colors of provider headers and rendered text: auto on terminal unless NO_COLOR is set, always or never"`
+	Theme        string `long:"theme" env:"THEME" choice:"dark" choice:"light" choice:"mono" default:"dark" description:"color theme of text output: dark or light for the terminal background, mono without colors"`
+
+	// provenance options
+	Sign       bool   `long:"sign" env:"SIGN" description:"embed provenance into JSON output: tool version, providers and models, prompt hash and timestamps"`
+	SignKey    string `long:"sign.key" env:"SIGN_KEY" description:"minisign secret key without password (minisign -G -W) signing the JSON output"`
+	SignOutput string `long:"sign.output" env:"SIGN_OUTPUT" description:"file to write the minisign signature of the JSON output to, required with --sign.key"`
+
+	aliases     *alias.Resolver         // model aliases, set by loadModelAliases
+	validator   *validate.Validator     // answer validator, set by loadValidator if validation requested
+	normalizer  *normalize.Normalizer   // answer normalizer, set by loadNormalizer if normalization requested
+	constraints constraint.Constraints  // answer format and length, set by loadConstraints
+	quota       *quota.Tracker          // rate limits of providers, set by loadQuota
+	limiter     *runner.ProviderLimiter // in-flight request limits of providers, set by loadLimiter if any limit is set
+	caps        provider.Capabilities   // capabilities of providers, set by loadCapabilities
+	models      *provider.ModelCache    // models discovered from custom providers, nil to skip discovery
+	signKey     *provenance.Key         // minisign key signing JSON output, set by loadSignKey if --sign.key is set
+	variants    promptVariants          // prompts with context wrappers overridden per provider, set by buildFullPrompt
+	input       string                  // piped input kept apart from a template prompt, appended to it as is
+	tokens      []tokens.Count          // prompt tokens per provider, set by countPromptTokens if requested
+	trims       []prompt.Trim           // context sources trimmed to fit budgets, set by buildPrompt
+	sizes       []prompt.FileSize       // sizes of files included in the prompt, set by buildPrompt with --files.report
+	args        []string                // command line arguments, recorded to history if set
+	defaults    []string                // arguments from system and user config files, put before command line arguments
+	dir         string                  // directory of file patterns and git commands, current directory if empty
+}
+
+// maxOutputTokens returns max tokens to generate by all providers, set with --max-output-tokens or its
+// --max-tokens alias, 0 if not set
+func (o *options) maxOutputTokens() int {
+	return int(max(o.MaxOutputTokens, o.MaxTokens))
+}
+
+// httpServer checks if HTTP server mode is requested, serving jobs API, OpenAI-compatible API or both
+func (o *options) httpServer() bool {
+	return o.HTTP.Listen != "" || o.Serve.OpenAI != ""
+}
+
+// serverMode checks if MCP or HTTP server mode is requested
+func (o *options) serverMode() bool {
+	return o.MCP.Server || o.httpServer()
 }
 
 // openAIOpts defines options for OpenAI provider
 type openAIOpts struct {
 	Enabled         bool      `long:"enabled" env:"ENABLED" description:"enable OpenAI provider"`
+	Required        bool      `long:"required" env:"REQUIRED" description:"fail the run if OpenAI fails, failures of optional providers are only logged"`
+	Parallel        int       `long:"parallel" env:"PARALLEL" description:"max in-flight requests to OpenAI shared by concurrent runs, 0 for unlimited"`
 	APIKey          string    `long:"api-key" env:"API_KEY" description:"OpenAI API key"`
 	Model           string    `long:"model" env:"MODEL" description:"OpenAI model" default:"gpt-5"`
 	MaxTokens       SizeValue `long:"max-tokens" env:"MAX_TOKENS" description:"maximum number of tokens to generate (default: 16384, supports k/kb/m/mb/g/gb suffixes)" default:"16384"`
 	Temperature     float32   `long:"temperature" env:"TEMPERATURE" description:"controls randomness (0-2, higher is more random)" default:"0.1"`
 	ReasoningEffort string    `long:"reasoning-effort" env:"REASONING_EFFORT" description:"reasoning effort level for GPT-5 models" choice:"low" choice:"medium" choice:"high" default:"medium"`
+	Instructions    string    `long:"instructions" env:"INSTRUCTIONS" description:"instructions put before every prompt sent to OpenAI"`
+	timeoutOpts
 }
 
 // anthropicOpts defines options for Anthropic provider
 type anthropicOpts struct {
-	Enabled   bool      `long:"enabled" env:"ENABLED" description:"enable Anthropic provider"`
-	APIKey    string    `long:"api-key" env:"API_KEY" description:"Anthropic API key"`
-	Model     string    `long:"model" env:"MODEL" description:"Anthropic model" default:"claude-sonnet-4-5"`
-	MaxTokens SizeValue `long:"max-tokens" env:"MAX_TOKENS" description:"maximum number of tokens to generate (default: 16384, supports k/m suffixes)" default:"16384"`
+	Enabled      bool      `long:"enabled" env:"ENABLED" description:"enable Anthropic provider"`
+	Required     bool      `long:"required" env:"REQUIRED" description:"fail the run if Anthropic fails, failures of optional providers are only logged"`
+	Parallel     int       `long:"parallel" env:"PARALLEL" description:"max in-flight requests to Anthropic shared by concurrent runs, 0 for unlimited"`
+	APIKey       string    `long:"api-key" env:"API_KEY" description:"Anthropic API key"`
+	Model        string    `long:"model" env:"MODEL" description:"Anthropic model" default:"claude-sonnet-4-5"`
+	MaxTokens    SizeValue `long:"max-tokens" env:"MAX_TOKENS" description:"maximum number of tokens to generate (default: 16384, supports k/m suffixes)" default:"16384"`
+	Instructions string    `long:"instructions" env:"INSTRUCTIONS" description:"instructions put before every prompt sent to Anthropic"`
+	Backend      string    `long:"backend" env:"BACKEND" choice:"direct" choice:"vertex" choice:"bedrock" default:"direct" description:"API serving Anthropic models: direct Anthropic API, Vertex AI or AWS Bedrock"`
+	Project      string    `long:"project" env:"PROJECT" description:"google cloud project of Vertex AI (default: project of credentials)"`
+	Location     string    `long:"location" env:"LOCATION" description:"location of Vertex AI, like us-east5 (default: global)"`
+	Region       string    `long:"region" env:"REGION" description:"AWS region of Bedrock (default: AWS_REGION)"`
+	timeoutOpts
 }
 
 // googleOpts defines options for Google provider
 type googleOpts struct {
-	Enabled   bool      `long:"enabled" env:"ENABLED" description:"enable Google provider"`
-	APIKey    string    `long:"api-key" env:"API_KEY" description:"Google API key"`
-	Model     string    `long:"model" env:"MODEL" description:"Google model" default:"gemini-2.5-pro-preview-06-05"`
-	MaxTokens SizeValue `long:"max-tokens" env:"MAX_TOKENS" description:"maximum number of tokens to generate (default: 16384, supports k/m suffixes)" default:"16384"`
+	Enabled      bool      `long:"enabled" env:"ENABLED" description:"enable Google provider"`
+	Required     bool      `long:"required" env:"REQUIRED" description:"fail the run if Google fails, failures of optional providers are only logged"`
+	Parallel     int       `long:"parallel" env:"PARALLEL" description:"max in-flight requests to Google shared by concurrent runs, 0 for unlimited"`
+	APIKey       string    `long:"api-key" env:"API_KEY" description:"Google API key"`
+	Model        string    `long:"model" env:"MODEL" description:"Google model" default:"gemini-2.5-pro-preview-06-05"`
+	MaxTokens    SizeValue `long:"max-tokens" env:"MAX_TOKENS" description:"maximum number of tokens to generate (default: 16384, supports k/m suffixes)" default:"16384"`
+	Instructions string    `long:"instructions" env:"INSTRUCTIONS" description:"instructions put before every prompt sent to Google"`
+	Vertex       bool      `long:"vertex" env:"VERTEX" description:"use Vertex AI with google cloud application default credentials instead of the API key"`
+	Project      string    `long:"project" env:"PROJECT" description:"google cloud project of Vertex AI (default: project of credentials)"`
+	Location     string    `long:"location" env:"LOCATION" description:"location of Vertex AI, like us-central1 (default: global)"`
+	timeoutOpts
+}
+
+// deepSeekOpts defines options for DeepSeek provider
+type deepSeekOpts struct {
+	Enabled      bool      `long:"enabled" env:"ENABLED" description:"enable DeepSeek provider"`
+	Required     bool      `long:"required" env:"REQUIRED" description:"fail the run if DeepSeek fails, failures of optional providers are only logged"`
+	Parallel     int       `long:"parallel" env:"PARALLEL" description:"max in-flight requests to DeepSeek shared by concurrent runs, 0 for unlimited"`
+	APIKey       string    `long:"api-key" env:"API_KEY" description:"DeepSeek API key"`
+	Model        string    `long:"model" env:"MODEL" description:"DeepSeek model" default:"deepseek-chat"`
+	MaxTokens    SizeValue `long:"max-tokens" env:"MAX_TOKENS" description:"maximum number of tokens to generate (default: 8192, supports k/m suffixes)" default:"8192"`
+	Temperature  float32   `long:"temperature" env:"TEMPERATURE" description:"controls randomness (0-2, higher is more random), ignored by deepseek-reasoner" default:"1"`
+	Instructions string    `long:"instructions" env:"INSTRUCTIONS" description:"instructions put before every prompt sent to DeepSeek"`
+	timeoutOpts
 }
 
 // mcpOpts defines options for MCP server mode
 type mcpOpts struct {
 	Server     bool   `long:"server" env:"SERVER" description:"run in MCP server mode"`
 	ServerName string `long:"server-name" env:"SERVER_NAME" description:"MCP server name" default:"MPT MCP Server"`
+
+	Preflight       bool          `long:"preflight" env:"PREFLIGHT" description:"check providers with a minimal request on start and skip unhealthy ones until they recover"`
+	RecheckInterval time.Duration `long:"recheck-interval" env:"RECHECK_INTERVAL" default:"30s" description:"delay of the first re-check of a failed provider, doubled after each failure"`
+	RecheckMax      time.Duration `long:"recheck-max" env:"RECHECK_MAX" default:"10m" description:"max delay between re-checks of a failed provider"`
+
+	Resources []string `long:"resources" env:"RESOURCES" env-delim:"," description:"file patterns exposed as MCP resources, with exclusions applied as for --file, can be repeated"`
+	Prompts   string   `long:"prompts" env:"PROMPTS" description:"directory of prompt files exposed as MCP prompts (default: ~/.mpt/prompts)"`
+}
+
+// httpOpts defines options for HTTP server mode
+type httpOpts struct {
+	Listen       string        `long:"listen" env:"LISTEN" description:"run in HTTP server mode listening on the address, like :8080"`
+	JobRetention time.Duration `long:"job-retention" env:"JOB_RETENTION" default:"1h" description:"how long finished jobs are kept for polling"`
+	Auth         string        `long:"auth" env:"AUTH" description:"YAML file with API keys of clients, requests without a valid key are rejected if set"`
+}
+
+// serveOpts defines options of APIs compatible with other tools, served in HTTP server mode
+type serveOpts struct {
+	OpenAI string `long:"openai" env:"OPENAI" description:"serve OpenAI-compatible chat completions API on the address, like :8081, model mpt-mix mixes answers of all providers"`
+}
+
+// historyOpts defines options for history of invocations used by rerun command
+type historyOpts struct {
+	File     string `long:"file" env:"FILE" description:"history file (default: ~/.mpt/history.jsonl)"`
+	Max      int    `long:"max" env:"MAX" default:"100" description:"max number of invocations kept in history"`
+	Disable  bool   `long:"disable" env:"DISABLE" description:"don't record invocations to history"`
+	MaxInput int    `long:"max-input" env:"MAX_INPUT" default:"65536" description:"max bytes of the prompt and of piped input kept in history, longer ones are truncated"`
 }
 
 // customOpenAIProvider defines options for a custom OpenAI-compatible provider
 type customOpenAIProvider struct {
 	Enabled      bool      `long:"enabled" env:"ENABLED" description:"enable custom provider"`
+	Required     bool      `long:"required" env:"REQUIRED" description:"fail the run if the custom provider fails, failures of optional providers are only logged"`
+	Parallel     int       `long:"parallel" env:"PARALLEL" description:"max in-flight requests to the custom provider shared by concurrent runs, 0 for unlimited"`
 	Name         string    `long:"name" env:"NAME" description:"custom provider name" default:"custom"`
 	URL          string    `long:"url" env:"URL" description:"Base URL for the custom provider API"`
 	APIKey       string    `long:"api-key" env:"API_KEY" description:"API key for the custom provider (if needed)"`
 	Model        string    `long:"model" env:"MODEL" description:"Model to use for the custom provider"`
 	MaxTokens    SizeValue `long:"max-tokens" env:"MAX_TOKENS" description:"Maximum number of tokens to generate (default: 16384, supports k/kb/m/mb/g/gb suffixes)" default:"16384"`
 	Temperature  float32   `long:"temperature" env:"TEMPERATURE" description:"controls randomness (0-2, higher is more random)" default:"0.7"`
-	EndpointType string    `long:"endpoint-type" env:"ENDPOINT_TYPE" description:"API endpoint type" choice:"auto" choice:"responses" choice:"chat_completions" default:"chat_completions"`
+	EndpointType string    `long:"endpoint-type" env:"ENDPOINT_TYPE" description:"API endpoint type" choice:"auto" choice:"responses" choice:"chat_completions" choice:"embeddings" default:"chat_completions"`
+	Instructions string    `long:"instructions" env:"INSTRUCTIONS" description:"instructions put before every prompt sent to the custom provider"`
+	Discover     bool      `long:"discover" env:"DISCOVER" description:"discover models served by the custom provider with GET /models, to check the model"`
+	timeoutOpts
+}
+
+// timeoutOpts defines per-provider timeouts, unset values fall back to global --timeout.* options
+type timeoutOpts struct {
+	TimeoutConnect    time.Duration `long:"timeout.connect" env:"TIMEOUT_CONNECT" description:"connect timeout, overrides --timeout.connect"`
+	TimeoutGeneration time.Duration `long:"timeout.generation" env:"TIMEOUT_GENERATION" description:"generation timeout, overrides --timeout.generation"`
+}
+
+// timeouts returns provider timeouts with unset values taken from global options
+func (t timeoutOpts) timeouts(opts *options) provider.Timeouts {
+	return provider.Timeouts{Connect: t.TimeoutConnect, Generation: t.TimeoutGeneration}.WithDefaults(defaultTimeouts(opts))
+}
+
+// autoTimeout returns the generation timeout set with --timeout.auto for the max output tokens of the provider:
+// the base increased per 1k tokens of the prompt and the max output. Prompt tokens are estimated, and the prompt
+// is empty in server modes, where the timeout is scaled by max output tokens only.
+func autoTimeout(opts *options, maxTokens int) time.Duration {
+	n := tokens.Estimate(opts.Prompt) + max(maxTokens, 0)
+	return opts.TimeoutAutoBase + time.Duration(float64(opts.TimeoutAutoPer1K)*float64(n)/1000).Round(time.Second)
+}
+
+// defaultTimeouts returns global provider timeouts, deprecated -t overrides the generation timeout
+func defaultTimeouts(opts *options) provider.Timeouts {
+	res := provider.Timeouts{Connect: opts.TimeoutConnect, Generation: opts.TimeoutGeneration}
+	if opts.Timeout > 0 {
+		res.Generation = opts.Timeout
+	}
+	return res
 }
 
 // gitOpts defines options for Git integration
 type gitOpts struct {
 	Diff   bool   `long:"diff" env:"DIFF" description:"include git diff as context (uncommitted changes)"`
 	Branch string `long:"branch" env:"BRANCH" description:"include git diff between given branch and master/main (for PR review)"`
+	Blame  string `long:"blame" env:"BLAME" description:"include annotated git blame output of the given file as context"`
+	Log    int    `long:"log" env:"LOG" description:"include messages of the last N commits as context"`
+	Repo   string `long:"repo" env:"REPO" description:"repository git commands run against, current directory if not set"`
+}
+
+// ctxOpts defines options of placing file and git context in the prompt
+type ctxOpts struct {
+	Position         string            `long:"position" env:"POSITION" default:"after" description:"where context is placed relative to the prompt: before, after or replace:<marker>"`
+	Wrapper          string            `long:"wrapper" env:"WRAPPER" default:"plain" description:"how file contents are wrapped: plain (comment headers), xml or markdown"`
+	ProviderWrappers map[string]string `long:"provider-wrapper" env:"PROVIDER_WRAPPER" env-delim:";" key-value-delimiter:"=" value-name:"PROVIDER=WRAPPER" description:"wrapper of file contents for the provider, overriding --context.wrapper, can be repeated"`
+}
+
+// promptVariants holds prompts built with context wrappers overridden per provider
+type promptVariants struct {
+	base      string            // prompt built with the default wrapper
+	providers map[string]string // prompt of the provider, keyed by lowercase provider name
 }
 
 // retryOpts defines options for retry behavior
@@ -119,19 +432,196 @@ type retryOpts struct {
 	Factor   float64       `long:"factor" env:"FACTOR" default:"2" description:"backoff multiplier"`
 }
 
+// quotaOpts defines options for scheduling of providers with exhausted rate limits
+type quotaOpts struct {
+	MaxWait time.Duration `long:"max-wait" env:"MAX_WAIT" default:"30s" description:"max time to wait for exhausted provider quota to reset, providers with longer waits are skipped"`
+	State   string        `long:"state" env:"STATE" description:"file to keep provider quota between runs"`
+}
+
+// tokensOpts defines options of prompt token counting
+type tokensOpts struct {
+	Count bool      `long:"count" env:"COUNT" description:"count prompt tokens per provider and report them"`
+	Max   SizeValue `long:"max" env:"MAX" description:"max prompt tokens, the run fails before sending a larger prompt (supports k/m suffixes)"`
+}
+
+// budgetOpts defines token budgets of context sources, applied if the prompt is larger than --tokens.max
+type budgetOpts struct {
+	Files BudgetValue `long:"files" env:"FILES" description:"max tokens of file contents if the prompt exceeds --tokens.max, percent of it like 60% or tokens like 40k"`
+	Git   BudgetValue `long:"git" env:"GIT" description:"max tokens of git diff, blame and log if the prompt exceeds --tokens.max, percent of it or tokens"`
+	Stdin BudgetValue `long:"stdin" env:"STDIN" description:"max tokens of piped input if the prompt exceeds --tokens.max, percent of it or tokens"`
+}
+
+// any checks if any budget is set
+func (o budgetOpts) any() bool {
+	return o.Files.set() || o.Git.set() || o.Stdin.set()
+}
+
+// faultOpts defines options of failure injection into provider requests
+type faultOpts struct {
+	Providers map[string]string `long:"provider" env:"PROVIDER" env-delim:";" key-value-delimiter:"=" value-name:"PROVIDER=FAULTS" description:"comma-separated faults injected into provider requests, like openai=timeout:30%,ratelimit:10%"`
+	Seed      uint64            `long:"seed" env:"SEED" description:"seed making the sequence of injected faults reproducible, random if 0"`
+	Delay     time.Duration     `long:"delay" env:"DELAY" description:"max wait of injected timeouts before they fail, --timeout.generation if 0"`
+}
+
+// continueOpts defines options for auto-continue of truncated responses
+type continueOpts struct {
+	Max int `long:"max" env:"MAX" default:"3" description:"max continuation requests per provider"`
+}
+
+// applyOpts defines options of writing files from code blocks of the final answer
+type applyOpts struct {
+	Dir    string `long:"dir" env:"DIR" description:"write code blocks of the final answer annotated with file paths to files under the directory"`
+	Patch  bool   `long:"patch" env:"PATCH" description:"apply the final answer as a unified diff to the working tree, with git apply"`
+	DryRun bool   `long:"dry-run" env:"DRY_RUN" description:"show files which would be written by --apply.dir or patched by --apply.patch, without changing them"`
+}
+
+// batchOpts defines options of sending prompts through batch APIs of providers
+type batchOpts struct {
+	API  bool          `long:"api" env:"API" description:"submit the prompt to batch APIs of OpenAI and Anthropic at half the price, answered within 24h"`
+	Job  string        `long:"job" env:"JOB" description:"ID of the submitted batch job to check and print results of"`
+	Wait bool          `long:"wait" env:"WAIT" description:"wait for results of the batch job instead of returning while it is in progress"`
+	Poll time.Duration `long:"poll" env:"POLL" default:"30s" description:"interval of checking the batch job status with --batch.wait"`
+	Dir  string        `long:"dir" env:"DIR" description:"directory of batch jobs state (default: ~/.mpt/batch)"`
+}
+
+// verbosity levels set with repeated -v flag
+const (
+	verbosePrompt   = 1 // show prompt sent to models
+	verboseDebug    = 2 // debug logs, including retry decisions and file matching
+	verboseRequests = 3 // trace logs with full provider requests and responses
+)
+
+// maxStopSequences is the max number of stop sequences, the lowest limit across provider APIs
+const maxStopSequences = 4
+
+// notifyTimeout bounds sending of the desktop notification, independent of the run context
+const notifyTimeout = 10 * time.Second
+
+// defaultMixPrompt is the default of --mix.prompt, other values are set by the user
+const defaultMixPrompt = "merge results from all providers"
+
+// execOnCompleteTimeout bounds the exec-on-complete command, independent of the run context
+const execOnCompleteTimeout = time.Minute
+
 var revision = "unknown"
 
 func main() {
 	opts := &options{}
-	p := flags.NewParser(opts, flags.PrintErrors|flags.PassDoubleDash|flags.HelpFlag)
+	args := os.Args[1:]
+
+	// shell completion scripts run mpt with the completion env to complete the arguments
+	if os.Getenv(completionEnv) != "" {
+		providers := func() []string {
+			_ = os.Unsetenv(completionEnv) // go-flags would complete options of config files instead of parsing them
+			return completionProviders(systemConfigPath(), userConfigPath())
+		}
+		models := func(id string) []string {
+			_ = os.Unsetenv(completionEnv)
+			return completionModels(id, systemConfigPath(), userConfigPath())
+		}
+		if items, ok := completeArgs(args, providers, models); ok {
+			fmt.Println(strings.Join(items, "\n"))
+			os.Exit(0)
+		}
+		// go-flags completes option names and values on parsing, before config files parsed with it as well
+		_, _ = flags.NewParser(&options{}, flags.PassDoubleDash).ParseArgs(args)
+		os.Exit(0)
+	}
+
+	// completion command prints the shell completion script
+	if len(args) > 0 && args[0] == "completion" {
+		if err := runCompletion(args[1:], os.Stdout); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// auth command stores API keys in the OS keyring
+	if len(args) > 0 && args[0] == "auth" {
+		if err := runAuth(args[1:], os.Stdin, os.Stdout, keyring.Set); err != nil {
+			var ferr *flags.Error
+			if !errors.As(err, &ferr) {
+				fmt.Printf("%v\n", err)
+			}
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// pricing command lists and updates prices of models
+	if len(args) > 0 && args[0] == "pricing" {
+		client := &http.Client{Timeout: 30 * time.Second}
+		if err := runPricing(context.Background(), args[1:], os.Stdout, client); err != nil {
+			var ferr *flags.Error
+			if !errors.As(err, &ferr) {
+				fmt.Printf("%v\n", err)
+			}
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// providers dump command prints the resolved configuration of providers instead of running them
+	dump := false
+	if len(args) > 0 && args[0] == "providers" {
+		if len(args) < 2 || args[1] != "dump" {
+			fmt.Println("usage: mpt providers dump [--json] [options], e.g. mpt providers dump --json --auto")
+			os.Exit(1)
+		}
+		dump, args = true, args[2:]
+	}
+
+	// rerun command replaces arguments with arguments of the invocation from history
+	var rerun *history.Entry
+	if len(args) > 0 && args[0] == "rerun" {
+		entry, rerunArgs, err := prepareRerun(args[1:], os.Stdout)
+		if err != nil {
+			var ferr *flags.Error
+			if !errors.As(err, &ferr) {
+				fmt.Printf("%v\n", err)
+			}
+			os.Exit(1)
+		}
+		if entry == nil {
+			os.Exit(0) // history listed
+		}
+		rerun, args = entry, rerunArgs
+	}
 
-	if _, err := p.Parse(); err != nil {
+	p := flags.NewParser(opts, flags.PrintErrors|flags.PassDoubleDash|flags.HelpFlag)
+	defaults, err := loadConfigFiles(p, systemConfigPath(), userConfigPath())
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if _, err := p.ParseArgs(append(slices.Clone(defaults), args...)); err != nil {
 		if !errors.Is(err.(*flags.Error).Type, flags.ErrHelp) {
 			fmt.Printf("%v", err)
 		}
 		os.Exit(1)
 	}
-	setupLog(opts.Debug, collectSecrets(opts)...)
+	opts.args, opts.defaults = args, defaults
+	if opts.PromptFile != "" {
+		if err := applyPromptFile(opts, args); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+	}
+	if rerun != nil {
+		opts.dir = rerun.Dir
+		if opts.Prompt == "" {
+			if rerun.Truncated {
+				fmt.Printf("prompt of history entry %d was truncated when recorded, set it with --with -p\n", rerun.ID)
+				os.Exit(1)
+			}
+			opts.Prompt, opts.input = rerun.Prompt, rerun.Input
+		}
+	}
+	if opts.Files, err = files.ExpandLists(opts.Files, opts.dir); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
 
 	// if version flag is set, print version and exit
 	if opts.Version {
@@ -139,6 +629,28 @@ func main() {
 		os.Exit(0)
 	}
 
+	auto := autoEnableProviders(opts, os.Getenv)
+	opts.models = provider.NewModelCache("", opts.ModelsTTL)
+	if dump {
+		setupLog(verbosity(opts), opts.LogFormat, collectSecrets(opts)...)
+		if err := dumpProviders(os.Stdout, opts); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if err := resolveAPIKeys(opts, secrets.NewResolver().Resolve); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	setupLog(verbosity(opts), opts.LogFormat, collectSecrets(opts)...)
+	if len(auto) > 0 {
+		lgr.Printf("[INFO] auto-enabled providers with API keys: %s", strings.Join(auto, ", "))
+		if !opts.Quiet {
+			fmt.Fprintf(os.Stderr, "auto-enabled providers with API keys: %s\n", strings.Join(auto, ", "))
+		}
+	}
+
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
@@ -148,6 +660,7 @@ func main() {
 
 		os.Exit(1) //nolint:gocritic
 	}
+	opts.models.Wait() // let background refreshes of discovered models complete for the next runs
 }
 
 // validateOptions validates the command-line options
@@ -162,477 +675,3628 @@ func validateOptions(opts *options) error {
 			return fmt.Errorf("consensus mode requires mix mode to be enabled (use --mix)")
 		}
 	}
-	return nil
-}
 
-// run executes the main program logic and returns an error if it fails
-func run(ctx context.Context, opts *options) error {
-	// validate options first
-	if err := validateOptions(opts); err != nil {
-		return err
+	if opts.MixMaxTokens < 0 {
+		return fmt.Errorf("mix max tokens can't be negative, got %d", opts.MixMaxTokens)
 	}
-	// check if running in MCP server mode
-	if opts.MCP.Server {
-		return runMCPServer(ctx, opts)
+	if opts.MixQuorum < 0 || opts.MixQuorum == 1 {
+		return fmt.Errorf("mix quorum must be at least 2 answers, got %d", opts.MixQuorum)
 	}
-
-	// standard MPT mode
-
-	// process the prompt (from CLI args or stdin)
-	if err := processPrompt(opts); err != nil {
-		return err
+	if opts.MixQuorum > 0 && opts.HTTP.Listen == "" {
+		return fmt.Errorf("mix quorum applies to streamed runs of HTTP server, requires --http.listen")
 	}
 
-	// initialize providers and handle errors
-	providers, err := initializeProviders(opts)
-	if err != nil {
-		return err
+	// validate review options
+	if opts.Review && opts.MixEnabled {
+		return fmt.Errorf("review mode can't be combined with mix mode, findings are aggregated from all providers")
 	}
-
-	result, err := executePrompt(ctx, opts, providers)
-	if err != nil {
-		return err
+	if opts.ReviewSARIF != "" && !opts.Review {
+		return fmt.Errorf("review sarif output requires review mode to be enabled (use --review)")
 	}
-
-	// output results
-	if opts.JSON {
-		return outputJSON(result)
+	if opts.OutputFormat != "" && opts.OutputFormat != "text" {
+		if !opts.Review && (opts.OutputFormat == "sarif" || opts.OutputFormat == "rdjson") {
+			return fmt.Errorf("output format %s requires review mode to be enabled (use --review)", opts.OutputFormat)
+		}
+		if opts.JSON {
+			return fmt.Errorf("output format %s can't be combined with --json", opts.OutputFormat)
+		}
 	}
-	fmt.Println(strings.TrimSpace(result.Text))
-	return nil
-}
 
-// runMCPServer starts MPT in MCP server mode
-func runMCPServer(_ context.Context, opts *options) error {
-	// setup logging with API keys as secrets
-	secrets := collectSecrets(opts)
-	setupLog(opts.Debug, secrets...)
-
-	// initialize all providers and handle errors
-	providers, err := initializeProviders(opts)
-	if err != nil {
-		return fmt.Errorf("failed to initialize providers for MCP server mode: %w", err)
+	if opts.Quiet && (structuredOutput(opts) || opts.OutputFormat != "" && opts.OutputFormat != "text") {
+		return fmt.Errorf("quiet mode prints the answer as text, can't be combined with --json or --output.format")
+	}
+	if opts.Render && (structuredOutput(opts) || opts.OutputFormat != "" && opts.OutputFormat != "text") {
+		return fmt.Errorf("rendering applies to text output, --render can't be combined with --json or --output.format")
+	}
+	if opts.Quiet && (opts.MixShowIndividual || opts.ShowReasoning) {
+		return fmt.Errorf("quiet mode prints only the final answer, can't be combined with --mix.show-individual or --show-reasoning")
 	}
 
-	// create runner with all providers
-	r := runner.New(providers...)
-
-	// create MCP server using our runner
-	mcpServer := mcp.NewServer(r, mcp.ServerOptions{
-		Name:    opts.MCP.ServerName,
-		Version: revision,
-	})
-
-	lgr.Printf("[INFO] MCP server initialized with %d providers", len(providers))
-	lgr.Printf("[INFO] server name: %s, version: %s", opts.MCP.ServerName, revision)
-
-	// print enabled providers
-	for _, p := range providers {
-		lgr.Printf("[INFO] enabled provider: %s", p.Name())
+	if (opts.Format != "" || opts.MaxWords != 0) && (opts.Review || opts.ConsensusEnabled || opts.PromptVariantsJudge != "") {
+		return fmt.Errorf("answer format and max words can't be combined with review, consensus or prompt variants judge, " +
+			"they expect answers in their own format")
+	}
+	if opts.NormalizeRules != "" && !opts.Normalize {
+		return fmt.Errorf("normalize rules require answer normalization to be enabled (use --normalize)")
 	}
 
-	// start the MCP server
-	lgr.Printf("[INFO] starting MPT in MCP server mode with stdio transport")
-	return mcpServer.Start()
-}
+	// validate fixtures options
+	if opts.Record != "" && opts.Replay != "" {
+		return fmt.Errorf("record and replay modes can't be combined")
+	}
 
-// collectSecrets extracts all API keys for secure logging
-func collectSecrets(opts *options) []string {
-	secretsMap := make(map[string]bool) // use map to avoid duplicates
+	// validate auto-continue options
+	if opts.AutoContinue && opts.Continue.Max < 1 {
+		return fmt.Errorf("continue max must be at least 1, got %d", opts.Continue.Max)
+	}
 
-	// add API keys from built-in providers
-	if opts.OpenAI.APIKey != "" {
-		secretsMap[opts.OpenAI.APIKey] = true
+	// validate generation options
+	if opts.MaxOutputTokens < 0 || opts.MaxTokens < 0 {
+		return fmt.Errorf("max output tokens can't be negative, got %d", min(opts.MaxOutputTokens, opts.MaxTokens))
 	}
-	if opts.Anthropic.APIKey != "" {
-		secretsMap[opts.Anthropic.APIKey] = true
+	if opts.MaxOutputTokens > 0 && opts.MaxTokens > 0 && opts.MaxOutputTokens != opts.MaxTokens {
+		return fmt.Errorf("--max-tokens is an alias of --max-output-tokens, they can't be set to different values")
 	}
-	if opts.Google.APIKey != "" {
-		secretsMap[opts.Google.APIKey] = true
+	if opts.Temperature != nil && (*opts.Temperature < 0 || *opts.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2, got %v", *opts.Temperature)
 	}
-
-	// add API keys from custom providers
-	customSecrets := createCustomManager(opts).CollectSecrets()
-	for _, secret := range customSecrets {
-		if secret != "" {
-			secretsMap[secret] = true
-		}
+	if len(opts.Stop) > maxStopSequences {
+		return fmt.Errorf("at most %d stop sequences are supported, got %d", maxStopSequences, len(opts.Stop))
 	}
-
-	// convert map to slice
-	secrets := make([]string, 0, len(secretsMap))
-	for secret := range secretsMap {
-		secrets = append(secrets, secret)
+	for _, s := range opts.Stop {
+		if s == "" {
+			return fmt.Errorf("stop sequence can't be empty")
+		}
 	}
 
-	return secrets
-}
-
-// processPrompt gets the prompt from stdin or command line and optionally adds file content
-func processPrompt(opts *options) error {
-	// get prompt from stdin (piped data or interactive input) or command line
-	if err := getPrompt(opts); err != nil {
-		return fmt.Errorf("failed to get prompt: %w", err)
+	// validate first mode, it returns a single response and can't be combined with modes using all responses
+	if opts.First && (opts.MixEnabled || opts.Review) {
+		return fmt.Errorf("first mode can't be combined with mix or review modes, they use responses from all providers")
 	}
-
-	// check if we have a prompt after all attempts
-	if opts.Prompt == "" {
-		return fmt.Errorf("no prompt provided")
+	if opts.First && len(requiredProviders(opts)) > 0 {
+		return fmt.Errorf("first mode returns a single response, can't be combined with required providers")
 	}
 
-	// append file content to prompt if requested
-	if err := buildFullPrompt(opts); err != nil {
+	if err := validatePromptVariants(opts); err != nil {
 		return err
 	}
+	if opts.Apply.DryRun && opts.Apply.Dir == "" && !opts.Apply.Patch {
+		return fmt.Errorf("apply dry-run requires apply directory or patch mode, set --apply.dir or --apply.patch")
+	}
+	if opts.Apply.Dir != "" && opts.Apply.Patch {
+		return fmt.Errorf("apply directory and patch mode can't be combined")
+	}
+	if (opts.Apply.Dir != "" || opts.Apply.Patch) && (opts.Review || opts.PromptVariants != "" || opts.serverMode()) {
+		return fmt.Errorf("applying files requires a single final answer, can't be combined with review, prompt variants or server modes")
+	}
 
-	return nil
-}
+	// validate batch options
+	if opts.Batch.API && opts.Batch.Job != "" {
+		return fmt.Errorf("batch api mode submits a new job, can't be combined with --batch.job")
+	}
+	if (opts.Batch.API || opts.Batch.Job != "") && (opts.MixEnabled || opts.PromptVariants != "" || opts.serverMode()) {
+		return fmt.Errorf("batch jobs can't be combined with mix, prompt variants or server modes")
+	}
+	if opts.Batch.Wait && !opts.Batch.API && opts.Batch.Job == "" {
+		return fmt.Errorf("batch wait requires batch api mode or a batch job, set --batch.api or --batch.job")
+	}
+	if opts.Batch.Wait && opts.Batch.Poll <= 0 {
+		return fmt.Errorf("batch poll interval must be positive, got %v", opts.Batch.Poll)
+	}
 
-// buildFullPrompt loads content from specified files and builds the complete prompt
-func buildFullPrompt(opts *options) error {
-	// only create git diff processor if git features are requested
-	var gitDiffer prompt.GitDiffProcessor
-	if opts.Git.Diff || opts.Git.Branch != "" {
-		gitDiffer = prompt.NewGitDiffer()
+	if opts.JSONRaw && !opts.JSON && opts.OutputFormat != "yaml" {
+		return fmt.Errorf("raw responses are included in JSON and YAML output, --json.raw requires --json or --output.format=yaml")
 	}
 
-	// use the prompt builder to handle file loading and prompt construction
-	builder := prompt.New(opts.Prompt, gitDiffer).
-		WithFiles(opts.Files).
-		WithExcludes(opts.Excludes).
-		WithMaxFileSize(int64(opts.MaxFileSize)).
-		WithForce(opts.Force)
+	// validate provenance options
+	if opts.Sign && !opts.JSON {
+		return fmt.Errorf("provenance is embedded into JSON output, --sign requires --json")
+	}
+	if opts.Sign && (opts.PromptVariants != "" || opts.serverMode()) {
+		return fmt.Errorf("provenance is recorded for a single run, --sign can't be combined with prompt variants or server modes")
+	}
+	if (opts.SignKey != "" || opts.SignOutput != "") && !opts.Sign {
+		return fmt.Errorf("signing the output requires provenance, set --sign")
+	}
+	if (opts.SignKey == "") != (opts.SignOutput == "") {
+		return fmt.Errorf("signing the output requires both the key and the signature file, set --sign.key and --sign.output")
+	}
 
-	// add git diff if requested
-	var err error
-	if opts.Git.Diff {
-		builder, err = builder.WithGitDiff()
-		if err != nil {
-			return fmt.Errorf("failed to process git diff: %w", err)
+	// validate file relevance options
+	if opts.FilesRelevant && opts.FilesTopK < 1 {
+		return fmt.Errorf("files top-k must be at least 1, got %d", opts.FilesTopK)
+	}
+	if opts.FilesWorkers < 0 {
+		return fmt.Errorf("files workers can't be negative, got %d", opts.FilesWorkers)
+	}
+	if opts.FilesChangedSince != "" && len(opts.Files) == 0 {
+		return fmt.Errorf("files changed since %s requested, but no file patterns set with --file", opts.FilesChangedSince)
+	}
+	for k := range opts.Tags {
+		if strings.TrimSpace(k) == "" {
+			return fmt.Errorf("tag key can't be empty")
 		}
 	}
-
-	// add git branch diff if requested
-	if opts.Git.Branch != "" {
-		builder, err = builder.WithGitBranchDiff(opts.Git.Branch)
-		if err != nil {
-			return fmt.Errorf("failed to process git branch diff: %w", err)
+	if !opts.Google.Vertex && (opts.Google.Project != "" || opts.Google.Location != "") {
+		return fmt.Errorf("google project and location are used with vertex AI only, set --google.vertex")
+	}
+	if opts.Anthropic.Backend != "vertex" && (opts.Anthropic.Project != "" || opts.Anthropic.Location != "") {
+		return fmt.Errorf("anthropic project and location are used with vertex AI only, set --anthropic.backend=vertex")
+	}
+	if opts.Anthropic.Backend != "bedrock" && opts.Anthropic.Region != "" {
+		return fmt.Errorf("anthropic region is used with bedrock only, set --anthropic.backend=bedrock")
+	}
+	for _, spec := range strings.Split(opts.MixProvider, ",") {
+		if err := provider.ValidateSpec(strings.TrimSpace(spec)); err != nil {
+			return fmt.Errorf("invalid mix provider %q: %w", opts.MixProvider, err)
 		}
 	}
-
-	// build the prompt
-	fullPrompt, err := builder.Build()
-	if err != nil {
-		return fmt.Errorf("failed to build prompt: %w", err)
+	if opts.MCP.Preflight && (opts.MCP.RecheckInterval <= 0 || opts.MCP.RecheckMax < opts.MCP.RecheckInterval) {
+		return fmt.Errorf("mcp re-check interval must be positive and not above re-check max, got %v and %v",
+			opts.MCP.RecheckInterval, opts.MCP.RecheckMax)
 	}
-
+	if opts.MCP.Server && opts.httpServer() {
+		return fmt.Errorf("MCP and HTTP server modes can't be combined")
+	}
+	if opts.httpServer() && opts.HTTP.JobRetention <= 0 {
+		return fmt.Errorf("http job retention must be positive, got %v", opts.HTTP.JobRetention)
+	}
+	if opts.HTTP.Auth != "" && !opts.httpServer() {
+		return fmt.Errorf("http auth requires HTTP server mode, set --http.listen or --serve.openai")
+	}
+	if err := prompt.ValidatePosition(opts.Ctx.Position); err != nil {
+		return err
+	}
+	if _, err := files.ParseWrapper(opts.Ctx.Wrapper); err != nil {
+		return err
+	}
+	for name, w := range opts.Ctx.ProviderWrappers {
+		if _, err := files.ParseWrapper(w); err != nil {
+			return fmt.Errorf("invalid context wrapper of %s: %w", name, err)
+		}
+	}
+	if opts.Tokens.Max < 0 {
+		return fmt.Errorf("max prompt tokens can't be negative, got %d", opts.Tokens.Max)
+	}
+	if (opts.Tokens.Count || opts.Tokens.Max > 0) && (opts.serverMode()) {
+		return fmt.Errorf("prompt token counting is not supported in server modes")
+	}
+	if opts.Budget.any() {
+		if opts.Tokens.Max == 0 {
+			return fmt.Errorf("context budgets require max prompt tokens set with --tokens.max")
+		}
+		if b := contextBudget(opts); b.Files+b.Git+b.Input > b.Limit {
+			return fmt.Errorf("context budgets of %d tokens exceed max prompt tokens %d", b.Files+b.Git+b.Input, b.Limit)
+		}
+	}
+	for name, spec := range opts.Fault.Providers {
+		if _, err := provider.ParseFaults(spec); err != nil {
+			return fmt.Errorf("invalid faults of %s: %w", name, err)
+		}
+	}
+	if len(opts.Fault.Providers) > 0 {
+		configured := configuredProviderNames(opts)
+		for name := range opts.Fault.Providers {
+			if !configured[strings.ToLower(name)] {
+				return fmt.Errorf("faults set for provider %s, which is not enabled", name)
+			}
+		}
+	}
+	if opts.Fault.Delay < 0 {
+		return fmt.Errorf("fault delay can't be negative, got %v", opts.Fault.Delay)
+	}
+	if opts.Quota.MaxWait < 0 {
+		return fmt.Errorf("quota max wait can't be negative, got %v", opts.Quota.MaxWait)
+	}
+	for _, cfg := range getStandardProviderConfigs(opts) {
+		if cfg.parallel < 0 {
+			return fmt.Errorf("%s parallel requests can't be negative, got %d", cfg.name, cfg.parallel)
+		}
+	}
+	if opts.Custom.Parallel < 0 {
+		return fmt.Errorf("custom parallel requests can't be negative, got %d", opts.Custom.Parallel)
+	}
+	if opts.Git.Log < 0 {
+		return fmt.Errorf("git log commits can't be negative, got %d", opts.Git.Log)
+	}
+	if _, err := files.ResolveEcosystems(opts.Ecosystem, opts.dir); err != nil {
+		return err
+	}
+	if opts.TimeoutAuto && (opts.TimeoutAutoBase <= 0 || opts.TimeoutAutoPer1K < 0) {
+		return fmt.Errorf("auto timeout requires positive base and non-negative increment, got %v and %v",
+			opts.TimeoutAutoBase, opts.TimeoutAutoPer1K)
+	}
+	if opts.Git.Repo != "" {
+		if fi, err := os.Stat(opts.Git.Repo); err != nil || !fi.IsDir() {
+			return fmt.Errorf("git repo %s is not a directory", opts.Git.Repo)
+		}
+	}
+	return nil
+}
+
+// loadValidator makes answer validator from --validate spec, does nothing if validation is not requested
+func loadValidator(opts *options) error {
+	if opts.Validate == "" {
+		return nil
+	}
+	v, err := validate.New(opts.Validate)
+	if err != nil {
+		return fmt.Errorf("failed to set up answer validation: %w", err)
+	}
+	opts.validator = v
+	return nil
+}
+
+// loadSignKey loads the minisign key set with --sign.key, so a broken key fails the run before requests are sent
+func loadSignKey(opts *options) error {
+	if opts.SignKey == "" {
+		return nil
+	}
+	k, err := provenance.LoadKey(opts.SignKey)
+	if err != nil {
+		return err
+	}
+	opts.signKey = k
+	return nil
+}
+
+// loadNormalizer makes answer normalizer with rules from --normalize.rules file, does nothing if normalization
+// is not requested
+func loadNormalizer(opts *options) error {
+	if !opts.Normalize {
+		return nil
+	}
+	n, err := normalize.Load(opts.NormalizeRules)
+	if err != nil {
+		return fmt.Errorf("failed to set up answer normalization: %w", err)
+	}
+	opts.normalizer = n
+	return nil
+}
+
+// loadConstraints makes answer constraints of --format and --max-words
+func loadConstraints(opts *options) error {
+	c, err := constraint.New(opts.Format, opts.MaxWords)
+	if err != nil {
+		return fmt.Errorf("invalid answer constraints: %w", err)
+	}
+	opts.constraints = c
+	return nil
+}
+
+// loadMixPreset replaces the mix prompt with the prompt of --mix.preset, looked up in the mix directory
+// of the prompt library first, then in built-in presets
+func loadMixPreset(opts *options) error {
+	if opts.MixPreset == "" {
+		return nil
+	}
+	if opts.MixPrompt != defaultMixPrompt {
+		return fmt.Errorf("mix preset and mix prompt can't be combined")
+	}
+	dir, err := promptLibraryPath(opts.MCP.Prompts)
+	if err != nil {
+		return err
+	}
+	if opts.MixPrompt, err = mix.LoadPreset(opts.MixPreset, filepath.Join(dir, "mix")); err != nil {
+		return err
+	}
+	lgr.Printf("[DEBUG] mix prompt set by preset %q", opts.MixPreset)
+	return nil
+}
+
+// loadQuota makes the tracker of provider rate limits, with state loaded from --quota.state file if set
+func loadQuota(opts *options) error {
+	t, err := quota.New(opts.Quota.MaxWait, opts.Quota.State)
+	if err != nil {
+		return err
+	}
+	opts.quota = t
+	return nil
+}
+
+// loadLimiter makes the limiter of in-flight provider requests from --<provider>.parallel and parallel=N
+// of custom provider specs. The limiter is not set if no provider is limited.
+func loadLimiter(opts *options) {
+	limits := createCustomManager(opts).Parallel()
+	for _, cfg := range getStandardProviderConfigs(opts) {
+		if cfg.enabled && cfg.parallel > 0 {
+			limits[cfg.name] = cfg.parallel
+		}
+	}
+	if len(limits) == 0 {
+		return
+	}
+	opts.limiter = runner.NewProviderLimiter(limits)
+}
+
+// requiredProviders returns names of enabled providers marked as required with --<provider>.required or
+// required=true of custom provider specs, except providers filtered out with --only and --skip
+func requiredProviders(opts *options) []string {
+	names := []string{}
+	for _, cfg := range getStandardProviderConfigs(opts) {
+		if cfg.enabled && cfg.required {
+			names = append(names, cfg.name)
+		}
+	}
+	names = append(names, createCustomManager(opts).Required()...)
+
+	onlyNames, skipNames := splitNames(opts.Only), splitNames(opts.Skip)
+	return slices.DeleteFunc(names, func(name string) bool {
+		name = strings.ToLower(name)
+		return (len(onlyNames) > 0 && !onlyNames[name]) || skipNames[name]
+	})
+}
+
+// withQuota sets the quota tracker and the limiter of in-flight requests of the runner, if loaded
+func withQuota(r *runner.Runner, opts *options) *runner.Runner {
+	if opts.limiter != nil {
+		r.WithLimiter(opts.limiter)
+	}
+	if opts.quota == nil {
+		return r
+	}
+	return r.WithQuota(opts.quota)
+}
+
+// loadCapabilities makes the registry of provider capabilities, built-in capabilities of configured models
+// overridden by --capability
+func loadCapabilities(opts *options) error {
+	opts.caps = provider.Capabilities{}
+	for _, cfg := range getStandardProviderConfigs(opts) {
+		if cfg.enabled {
+			opts.caps.Set(cfg.name, provider.ModelCapabilities(cfg.model)...)
+		}
+	}
+	for name, model := range createCustomManager(opts).Models() {
+		opts.caps.Set(name, provider.ModelCapabilities(model)...)
+	}
+	for name, spec := range opts.Capabilities {
+		caps, err := provider.ParseCapabilities(spec)
+		if err != nil {
+			return fmt.Errorf("invalid capabilities of %s: %w", name, err)
+		}
+		opts.caps.Set(name, caps...)
+	}
+	for name, caps := range opts.caps {
+		lgr.Printf("[DEBUG] capabilities of %s: %v", name, caps)
+	}
+	return nil
+}
+
+// loadModelAliases makes model aliases resolver with built-in aliases and aliases from the optional file
+func loadModelAliases(opts *options) error {
+	opts.aliases = alias.New()
+	if opts.ModelAliases == "" {
+		return nil
+	}
+	if err := opts.aliases.Load(opts.ModelAliases); err != nil {
+		return err
+	}
+	lgr.Printf("[DEBUG] loaded model aliases from %s", opts.ModelAliases)
+	return nil
+}
+
+// run executes the main program logic and returns an error if it fails
+func run(ctx context.Context, opts *options) error {
+	// validate options first
+	if err := validateOptions(opts); err != nil {
+		return err
+	}
+	if err := loadModelAliases(opts); err != nil {
+		return err
+	}
+	if err := loadValidator(opts); err != nil {
+		return err
+	}
+	if err := loadNormalizer(opts); err != nil {
+		return err
+	}
+	if err := loadConstraints(opts); err != nil {
+		return err
+	}
+	if err := loadMixPreset(opts); err != nil {
+		return err
+	}
+	if err := loadQuota(opts); err != nil {
+		return err
+	}
+	loadLimiter(opts)
+	if err := loadCapabilities(opts); err != nil {
+		return err
+	}
+	if err := loadSignKey(opts); err != nil {
+		return err
+	}
+	// check if running in MCP server mode
+	if opts.MCP.Server {
+		return runMCPServer(ctx, opts)
+	}
+	if opts.httpServer() {
+		return runHTTPServer(ctx, opts)
+	}
+	if opts.PromptVariants != "" {
+		return runPromptVariants(ctx, opts)
+	}
+	if opts.Batch.API || opts.Batch.Job != "" {
+		return runBatch(ctx, opts)
+	}
+
+	// standard MPT mode
+
+	// process the prompt (from CLI args or stdin)
+	if err := processPrompt(ctx, opts); err != nil {
+		return err
+	}
+
+	// initialize providers and handle errors
+	providers, err := initializeProviders(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	st := time.Now()
+	result, err := executePrompt(ctx, opts, providers)
+	if err != nil {
+		res := failedResult(opts, err)
+		setProvenance(opts, res, st)
+		// in json and structured output formats report provider errors for scripts before failing
+		if structuredOutput(opts) && len(res.Results) > 0 {
+			if serr := writeOutput(os.Stdout, opts, res); serr != nil {
+				lgr.Printf("[WARN] failed to write %s output: %v", opts.OutputFormat, serr)
+			}
+		}
+		onComplete(ctx, opts, res, time.Since(st))
+		return err
+	}
+
+	setProvenance(opts, result, st)
+	if err := outputResult(opts, result); err != nil {
+		return err
+	}
+	if opts.Apply.Dir != "" || opts.Apply.Patch {
+		if err := applyAnswer(os.Stderr, opts, result); err != nil {
+			return err
+		}
+	}
+	onComplete(ctx, opts, result, time.Since(st))
+	return nil
+}
+
+// applyAnswer writes files from the final answer with --apply.dir or applies it as a patch with --apply.patch.
+// The final answer is the mixed result, or the answer of the only successful provider.
+func applyAnswer(w io.Writer, opts *options, result *ExecutionResult) error {
+	text := result.MixedText
+	if !result.MixUsed {
+		var answers []string
+		for _, r := range result.Results {
+			if r.Error == nil {
+				answers = append(answers, r.Text)
+			}
+		}
+		if len(answers) != 1 {
+			return fmt.Errorf("can't apply answer, got %d answers instead of a single final answer, use --mix or --first", len(answers))
+		}
+		text = answers[0]
+	}
+	if opts.Apply.Patch {
+		return applyPatch(w, opts, text)
+	}
+	return applyFiles(w, opts, text)
+}
+
+// applyPatch applies the unified diff of the answer to the working tree of git commands, or only checks it
+// applies cleanly in dry-run mode, and reports patched files with their hunks
+func applyPatch(w io.Writer, opts *options, text string) error {
+	diff, err := apply.ExtractDiff(text)
+	if err != nil {
+		return fmt.Errorf("can't apply patch: %w", err)
+	}
+	dir := opts.dir
+	if opts.Git.Repo != "" {
+		dir = opts.Git.Repo
+	}
+	patcher := apply.NewPatcher(prompt.NewGitExecutor(), dir)
+	verb := "patched"
+	if opts.Apply.DryRun {
+		verb = "would patch"
+		err = patcher.Check(diff)
+	} else {
+		err = patcher.Apply(diff)
+	}
+	if err != nil {
+		return err
+	}
+
+	files, hunks := apply.DiffFiles(diff), 0
+	for _, f := range files {
+		hunks += f.Hunks
+		fmt.Fprintf(w, "%s %s, %d hunks\n", verb, f.Path, f.Hunks)
+	}
+	fmt.Fprintf(w, "%s %d files, %d hunks\n", verb, len(files), hunks)
+	return nil
+}
+
+// applyFiles writes files from code blocks of the answer annotated with file paths under the apply
+// directory, or only reports them in dry-run mode
+func applyFiles(w io.Writer, opts *options, text string) error {
+	writes, err := apply.Plan(opts.Apply.Dir, apply.Extract(text))
+	if err != nil {
+		return fmt.Errorf("can't apply files: %w", err)
+	}
+	if len(writes) == 0 {
+		lgr.Printf("[WARN] no code blocks annotated with file paths in the final answer, nothing to apply")
+		return nil
+	}
+	if !opts.Apply.DryRun {
+		if err := apply.Apply(opts.Apply.Dir, writes); err != nil {
+			return fmt.Errorf("can't apply files: %w", err)
+		}
+	}
+
+	verb := "wrote"
+	if opts.Apply.DryRun {
+		verb = "would write"
+	}
+	for _, wr := range writes {
+		state := "new"
+		if wr.Exists {
+			state = "overwritten"
+		}
+		fmt.Fprintf(w, "%s %s, %d bytes, %s\n", verb, filepath.Join(opts.Apply.Dir, filepath.FromSlash(wr.Path)), len(wr.Content), state)
+	}
+	return nil
+}
+
+// onComplete runs the exec-on-complete command and sends the desktop notification once the run is completed.
+// Failures are only logged, so they don't change the exit status of the run.
+func onComplete(ctx context.Context, opts *options, result *ExecutionResult, elapsed time.Duration) {
+	if opts.StatusLine {
+		writeStatusLine(os.Stderr, result, elapsed)
+	}
+	if err := execOnComplete(ctx, opts.ExecOnComplete, result); err != nil {
+		lgr.Printf("[WARN] %v", err)
+	}
+	if opts.Notify {
+		sendNotification(result, elapsed)
+	}
+}
+
+// outputResult writes the execution result to stdout in the requested format
+func outputResult(opts *options, result *ExecutionResult) error {
+	// write review findings as SARIF if requested
+	if result.Review != nil && opts.ReviewSARIF != "" {
+		if err := writeSARIFFile(opts.ReviewSARIF, result.Review); err != nil {
+			return err
+		}
+	}
+
+	// output results
+	if structuredOutput(opts) {
+		return writeOutput(os.Stdout, opts, result)
+	}
+	if result.Review != nil {
+		switch opts.OutputFormat {
+		case "sarif":
+			return result.Review.WriteSARIF(os.Stdout, revision)
+		case "rdjson":
+			return result.Review.WriteRDJSON(os.Stdout)
+		}
+	}
+	if opts.Quiet {
+		fmt.Println(renderText(opts, strings.TrimSpace(quietText(result)), stdoutTerminal()))
+		return nil
+	}
+	text := strings.TrimSpace(result.Text)
+	if result.Individual != "" {
+		text = strings.TrimSpace(result.Individual) + "\n\n" + text
+	}
+	fmt.Println(renderText(opts, text, stdoutTerminal()))
+	return nil
+}
+
+// renderText styles the text output with colors of the theme: provider headers get distinct colors and separators,
+// and the whole markdown is rendered with --render. The text is returned as is if colors are off, see colorOutput.
+// Text is wrapped to the width of COLUMNS, 80 if not set.
+func renderText(opts *options, text string, terminal bool) string {
+	if !colorOutput(opts, terminal) {
+		return text
+	}
+	width, _ := strconv.Atoi(os.Getenv("COLUMNS"))
+	r := render.New(width)
+	if theme, ok := render.Themes[opts.Theme]; ok {
+		r = r.WithTheme(theme)
+	}
+	if opts.Render {
+		return r.Render(text)
+	}
+	return r.Headers(text)
+}
+
+// colorOutput checks if the text output is colored, always or never as set with --color, or in auto mode
+// if output is a terminal and NO_COLOR is not set
+func colorOutput(opts *options, terminal bool) bool {
+	switch opts.Color {
+	case "always":
+		return true
+	case "never":
+		return false
+	default:
+		return terminal && os.Getenv("NO_COLOR") == ""
+	}
+}
+
+// quietText returns the final answer without provider headers: the mixed result, review findings, or
+// answers of all successful providers separated by blank lines, identical answers only once
+func quietText(result *ExecutionResult) string {
+	switch {
+	case result.MixUsed:
+		return result.MixedText
+	case result.Review != nil:
+		return result.Text
+	}
+	parts := make([]string, 0, len(result.Results))
+	dups := provider.Duplicates(result.Results)
+	for i, r := range result.Results {
+		if r.Error == nil && dups[i] < 0 {
+			parts = append(parts, strings.TrimSpace(r.Text))
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// writeStatusLine writes a single line summary of the run in key=value format, like
+// "status=partial providers=3 ok=2 failed=1 failed_providers=Google duration_ms=5230 prompt_tokens=1800".
+// Status is ok if all providers succeeded, partial if some failed and failed if the run failed.
+// Prompt tokens, the sum of prompt tokens sent to all providers, are the counted ones or, if not counted,
+// reported by providers. Output tokens are reported only if providers report them, and the cost in USD only if
+// models of providers with reported usage are priced.
+func writeStatusLine(w io.Writer, result *ExecutionResult, elapsed time.Duration) {
+	var ok int
+	var failed []string
+	for _, r := range result.Results {
+		if r.Error != nil {
+			failed = append(failed, strings.ReplaceAll(r.Provider, " ", "_"))
+			continue
+		}
+		ok++
+	}
+	status := "ok"
+	switch {
+	case result.Err != nil:
+		status = "failed"
+	case len(failed) > 0:
+		status = "partial"
+	}
+	line := fmt.Sprintf("status=%s providers=%d ok=%d failed=%d", status, len(result.Results), ok, len(failed))
+	if len(failed) > 0 {
+		line += " failed_providers=" + strings.Join(failed, ",")
+	}
+	line += fmt.Sprintf(" duration_ms=%d", elapsed.Milliseconds())
+	var input, output int
+	var total float64
+	var priced bool
+	for _, r := range result.Results {
+		if n, ok := promptTokens(result, r); ok {
+			input += n
+		}
+		output += r.Usage.OutputTokens
+		if c, ok := cost(result, r); ok {
+			total, priced = total+c, true
+		}
+	}
+	if input > 0 || len(result.Tokens) > 0 {
+		line += fmt.Sprintf(" prompt_tokens=%d", input)
+	}
+	if output > 0 {
+		line += fmt.Sprintf(" output_tokens=%d", output)
+	}
+	if priced {
+		line += fmt.Sprintf(" cost_usd=%.4f", total)
+	}
+	fmt.Fprintln(w, line)
+}
+
+// promptTokens returns tokens of the prompt sent to the provider of the result, counted before the run
+// or, if not counted, reported by the provider. It returns false if neither is known.
+func promptTokens(result *ExecutionResult, r provider.Result) (int, bool) {
+	for _, c := range result.Tokens {
+		if c.Provider == r.Provider {
+			return c.Tokens, true
+		}
+	}
+	if r.Usage.InputTokens > 0 {
+		return r.Usage.InputTokens, true
+	}
+	return 0, false
+}
+
+// runBatch submits the prompt as a job to batch APIs of providers with --batch.api, or checks the job given
+// with --batch.job. Results are printed once batches of all providers are done, the same as answers of regular
+// requests, and the status of batches is printed otherwise. With --batch.wait it waits for results.
+func runBatch(ctx context.Context, opts *options) error {
+	dir, err := batchDir(opts.Batch.Dir)
+	if err != nil {
+		return err
+	}
+	store := batchapi.NewStore(dir)
+	backends := batchBackends(opts)
+
+	var job batchapi.Job
+	if opts.Batch.Job != "" {
+		if job, err = store.Load(opts.Batch.Job); err != nil {
+			return err
+		}
+		opts.Prompt = job.Prompt
+	} else {
+		if err := processPrompt(ctx, opts); err != nil {
+			return err
+		}
+		if job, err = submitBatch(ctx, opts, backends); err != nil {
+			return err
+		}
+		if err := store.Save(job); err != nil {
+			return fmt.Errorf("batch job %s submitted, but not saved: %w", job.ID, err)
+		}
+		lgr.Printf("[INFO] submitted batch job %s to %d providers", job.ID, len(job.Batches))
+		if !opts.Batch.Wait {
+			return writeBatchStatus(os.Stdout, opts, job)
+		}
+	}
+
+	save := func(j *batchapi.Job) {
+		if err := store.Save(*j); err != nil {
+			lgr.Printf("[WARN] failed to save batch job %s: %v", j.ID, err)
+		}
+	}
+	if opts.Batch.Wait {
+		err = batchapi.Wait(ctx, &job, backends, opts.Batch.Poll, func(j *batchapi.Job) {
+			save(j)
+			lgr.Printf("[INFO] batch job %s: %s", j.ID, batchStates(*j))
+		})
+	} else {
+		err = batchapi.Collect(ctx, &job, backends)
+		save(&job)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check batch job %s: %w", job.ID, err)
+	}
+	if !job.Done() {
+		return writeBatchStatus(os.Stdout, opts, job)
+	}
+
+	// results of batches are answers of providers, run the same way as regular requests
+	providers := make([]provider.Provider, 0, len(job.Batches))
+	for _, b := range job.Batches {
+		providers = append(providers, b.AsProvider())
+	}
+	result, err := executePrompt(ctx, opts, providers)
+	if err != nil {
+		return err
+	}
+	setProvenance(opts, result, job.Created)
+	if err := outputResult(opts, result); err != nil {
+		return err
+	}
+	if opts.Apply.Dir != "" || opts.Apply.Patch {
+		if err := applyAnswer(os.Stderr, opts, result); err != nil {
+			return err
+		}
+	}
+	onComplete(ctx, opts, result, time.Since(job.Created))
+	return nil
+}
+
+// submitBatch submits the prompt to batch APIs of enabled providers supporting them. Prompts are sent with
+// context wrappers and instructions of providers, the same as prompts of regular requests.
+func submitBatch(ctx context.Context, opts *options, backends map[string]batchapi.Backend) (batchapi.Job, error) {
+	job := batchapi.Job{ID: batchapi.NewJobID(), Created: time.Now(), Prompt: opts.Prompt}
+	instructions := providerInstructions(opts)
+	for _, cfg := range getStandardProviderConfigs(opts) {
+		if !cfg.enabled {
+			continue
+		}
+		backend, ok := backends[cfg.name]
+		if !ok {
+			lgr.Printf("[WARN] %s has no batch API, skipped", cfg.name)
+			continue
+		}
+		prompt := opts.Prompt
+		if variant, ok := opts.variants.providers[strings.ToLower(cfg.name)]; ok && opts.variants.base != "" {
+			prompt = strings.Replace(prompt, opts.variants.base, variant, 1)
+		}
+		if text := strings.TrimSpace(instructions[strings.ToLower(cfg.name)]); text != "" && !opts.NoInstructions {
+			prompt = text + "\n\n" + prompt
+		}
+		batchID, err := backend.Submit(ctx, []batchapi.Request{{ID: "prompt", Prompt: prompt}})
+		if err != nil {
+			return batchapi.Job{}, fmt.Errorf("failed to submit batch to %s: %w", cfg.name, err)
+		}
+		job.Batches = append(job.Batches, batchapi.Batch{Provider: cfg.name, Model: backend.Model(), BatchID: batchID,
+			State: batchapi.StateInProgress})
+	}
+	if createCustomManager(opts).AnyEnabled() {
+		lgr.Printf("[WARN] custom providers have no batch API, skipped")
+	}
+	if len(job.Batches) == 0 {
+		return batchapi.Job{}, fmt.Errorf("batch api mode requires OpenAI or Anthropic provider enabled with API key")
+	}
+	return job, nil
+}
+
+// batchBackends returns batch backends of standard providers supporting batch APIs and having API keys,
+// keyed by provider name. Backends are made for disabled providers too, to check jobs submitted earlier.
+func batchBackends(opts *options) map[string]batchapi.Backend {
+	res := map[string]batchapi.Backend{}
+	for _, cfg := range getStandardProviderConfigs(opts) {
+		if cfg.apiKey == "" || cfg.vertex.Enabled || cfg.bedrock.Enabled {
+			continue // batch APIs of cloud platforms are not supported
+		}
+		bo := batchapi.Options{APIKey: cfg.apiKey, Model: cfg.model, MaxTokens: cfg.maxTokens, Temperature: cfg.temp,
+			ReasoningEffort: cfg.reasoningEffort, Stop: opts.Stop}
+		switch cfg.provType {
+		case provider.ProviderTypeOpenAI:
+			res[cfg.name] = batchapi.NewOpenAI(bo)
+		case provider.ProviderTypeAnthropic:
+			bo.Temperature = -1 // anthropic doesn't use temperature parameter
+			res[cfg.name] = batchapi.NewAnthropic(bo)
+		}
+	}
+	return res
+}
+
+// batchDir returns the directory of batch jobs, ~/.mpt/batch if not set
+func batchDir(dir string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find batch jobs directory: %w", err)
+	}
+	return filepath.Join(home, ".mpt", "batch"), nil
+}
+
+// batchStates returns states of batches of the job, e.g. "OpenAI ended, Anthropic in_progress"
+func batchStates(job batchapi.Job) string {
+	states := make([]string, 0, len(job.Batches))
+	for _, b := range job.Batches {
+		states = append(states, b.Provider+" "+string(b.State))
+	}
+	return strings.Join(states, ", ")
+}
+
+// writeBatchStatus writes the status of the batch job in progress, as JSON with --json
+func writeBatchStatus(w io.Writer, opts *options, job batchapi.Job) error {
+	if opts.JSON {
+		type batchStatus struct {
+			Provider string         `json:"provider"`
+			Model    string         `json:"model"`
+			BatchID  string         `json:"batch_id"`
+			State    batchapi.State `json:"state"`
+		}
+		status := struct {
+			Job     string        `json:"job"`
+			Created time.Time     `json:"created"`
+			Done    bool          `json:"done"`
+			Batches []batchStatus `json:"batches"`
+		}{Job: job.ID, Created: job.Created, Done: job.Done(), Batches: make([]batchStatus, 0, len(job.Batches))}
+		for _, b := range job.Batches {
+			status.Batches = append(status.Batches, batchStatus{Provider: b.Provider, Model: b.Model, BatchID: b.BatchID, State: b.State})
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	}
+	if opts.Quiet {
+		_, err := fmt.Fprintln(w, job.ID)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "batch job %s: %s\ncheck results with: mpt --batch.job=%s\n", job.ID, batchStates(job), job.ID)
+	return err
+}
+
+// runMCPServer starts MPT in MCP server mode, logging with API keys as secrets is already set up by main
+func runMCPServer(ctx context.Context, opts *options) error {
+	// initialize all providers and handle errors
+	rawProviders, err := createProviders(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to initialize providers for MCP server mode: %w", err)
+	}
+	providers := wrapProviders(opts, slices.Clone(rawProviders))
+
+	// create runner with all providers
+	r := withQuota(runner.New(providers...), opts)
+
+	// create MCP server using our runner
+	serverOpts := mcp.ServerOptions{
+		Name:            opts.MCP.ServerName,
+		Version:         revision,
+		Providers:       providers,
+		ProviderFactory: newProviderFactory(opts),
+		MixProvider:     opts.MixProvider,
+		MixPrompt:       opts.MixPrompt,
+		MixRefinePrompt: opts.MixRefinePrompt,
+		MixMaxTokens:    int(opts.MixMaxTokens),
+		MixStyle:        opts.MixStyle,
+		Capabilities:    opts.caps,
+		ShutdownGrace:   opts.ShutdownGrace,
+	}
+	if opts.quota != nil {
+		serverOpts.Quota = opts.quota
+	}
+	if opts.limiter != nil {
+		serverOpts.Limiter = opts.limiter
+	}
+	if serverOpts.Prompts, err = promptTemplates(opts); err != nil {
+		return err
+	}
+	if len(opts.MCP.Resources) > 0 {
+		ecosystems, err := files.ResolveEcosystems(opts.Ecosystem, opts.dir)
+		if err != nil {
+			return err
+		}
+		serverOpts.Resources = &files.LoadRequest{Patterns: opts.MCP.Resources, ExcludePatterns: opts.Excludes,
+			MaxFileSize: int64(opts.MaxFileSize), Force: opts.Force, FollowSymlinks: opts.FollowSymlinks,
+			IncludeSubmodules: opts.IncludeSubmodules, Dir: opts.dir, Ecosystems: ecosystems}
+	}
+	if opts.MCP.Preflight {
+		// check raw providers, so probes are not validated, retried, recorded or injected with faults
+		serverOpts.Health = mcp.NewHealth(rawProviders, mcp.HealthOptions{Interval: opts.MCP.RecheckInterval,
+			MaxInterval: opts.MCP.RecheckMax, Timeout: opts.TimeoutGeneration})
+		lgr.Printf("[INFO] provider preflight enabled, re-check interval %v, max %v", opts.MCP.RecheckInterval,
+			opts.MCP.RecheckMax)
+	}
+	mcpServer := mcp.NewServer(r, serverOpts)
+
+	lgr.Printf("[INFO] MCP server initialized with %d providers", len(providers))
+	lgr.Printf("[INFO] server name: %s, version: %s", opts.MCP.ServerName, revision)
+
+	// print enabled providers
+	for _, p := range providers {
+		lgr.Printf("[INFO] enabled provider: %s", p.Name())
+	}
+
+	// start the MCP server
+	lgr.Printf("[INFO] starting MPT in MCP server mode with stdio transport")
+	return mcpServer.Start(ctx)
+}
+
+// runHTTPServer runs HTTP server mode, prompts are submitted as jobs and their results are polled by clients,
+// or sent to the OpenAI-compatible API
+func runHTTPServer(ctx context.Context, opts *options) error {
+	providers, err := initializeProviders(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to initialize providers for HTTP server mode: %w", err)
+	}
+
+	serverOpts := server.Options{
+		Address:         opts.HTTP.Listen,
+		OpenAIAddress:   opts.Serve.OpenAI,
+		Version:         revision,
+		Providers:       providers,
+		MixProvider:     opts.MixProvider,
+		MixPrompt:       opts.MixPrompt,
+		MixRefinePrompt: opts.MixRefinePrompt,
+		MixMaxTokens:    int(opts.MixMaxTokens),
+		MixStyle:        opts.MixStyle,
+		MixQuorum:       opts.MixQuorum,
+		Capabilities:    opts.caps,
+		JobRetention:    opts.HTTP.JobRetention,
+		JobTimeout:      opts.TimeoutTotal,
+		ShutdownGrace:   opts.ShutdownGrace,
+	}
+	if opts.quota != nil {
+		serverOpts.Quota = opts.quota
+	}
+	if opts.limiter != nil {
+		serverOpts.Limiter = opts.limiter
+	}
+	if opts.HTTP.Auth != "" {
+		if serverOpts.Auth, err = auth.Load(opts.HTTP.Auth); err != nil {
+			return err
+		}
+		lgr.Printf("[INFO] clients are authenticated with API keys from %s", opts.HTTP.Auth)
+	}
+
+	for _, p := range providers {
+		lgr.Printf("[INFO] enabled provider: %s", p.Name())
+	}
+	return server.New(serverOpts).Start(ctx)
+}
+
+// collectSecrets extracts all API keys for secure logging
+func collectSecrets(opts *options) []string {
+	secretsMap := make(map[string]bool) // use map to avoid duplicates
+
+	// add API keys from built-in providers
+	if opts.OpenAI.APIKey != "" {
+		secretsMap[opts.OpenAI.APIKey] = true
+	}
+	if opts.Anthropic.APIKey != "" {
+		secretsMap[opts.Anthropic.APIKey] = true
+	}
+	if opts.Google.APIKey != "" {
+		secretsMap[opts.Google.APIKey] = true
+	}
+	if opts.DeepSeek.APIKey != "" {
+		secretsMap[opts.DeepSeek.APIKey] = true
+	}
+
+	// add API keys from custom providers
+	customSecrets := createCustomManager(opts).CollectSecrets()
+	for _, secret := range customSecrets {
+		if secret != "" {
+			secretsMap[secret] = true
+		}
+	}
+
+	// convert map to slice
+	secrets := make([]string, 0, len(secretsMap))
+	for secret := range secretsMap {
+		secrets = append(secrets, secret)
+	}
+
+	return secrets
+}
+
+// autoEnableProviders enables standard providers with API keys set, like OPENAI_API_KEY or --openai.api-key,
+// if --auto is set and not disabled with --no-auto. With --auto, the key of Google is taken from GEMINI_API_KEY
+// if not set otherwise. Returns names of providers enabled by it, options are not changed without --auto.
+func autoEnableProviders(opts *options, getenv func(string) string) []string {
+	if !opts.Auto || opts.NoAuto {
+		return nil
+	}
+	if opts.Google.APIKey == "" {
+		opts.Google.APIKey = getenv("GEMINI_API_KEY")
+	}
+	standard := []struct {
+		name    string
+		enabled *bool
+		key     string
+	}{
+		{"OpenAI", &opts.OpenAI.Enabled, opts.OpenAI.APIKey}, {"Anthropic", &opts.Anthropic.Enabled, opts.Anthropic.APIKey},
+		{"Google", &opts.Google.Enabled, opts.Google.APIKey}, {"DeepSeek", &opts.DeepSeek.Enabled, opts.DeepSeek.APIKey},
+	}
+	var res []string
+	for _, p := range standard {
+		if *p.enabled || strings.TrimSpace(p.key) == "" {
+			continue
+		}
+		*p.enabled = true
+		res = append(res, p.name)
+	}
+	return res
+}
+
+// resolveAPIKeys replaces API keys referencing secret stores, like "keyring:openai" or "vault:secret/data/mpt#openai",
+// with the stored secrets. Keys of disabled providers are left as is, so their secret stores are not accessed.
+func resolveAPIKeys(opts *options, resolve func(string) (string, error)) error {
+	keys := []struct {
+		name    string
+		enabled bool
+		key     *string
+	}{
+		{"openai", opts.OpenAI.Enabled, &opts.OpenAI.APIKey}, {"anthropic", opts.Anthropic.Enabled, &opts.Anthropic.APIKey},
+		{"google", opts.Google.Enabled, &opts.Google.APIKey}, {"deepseek", opts.DeepSeek.Enabled, &opts.DeepSeek.APIKey},
+		{"custom", opts.Custom.Enabled, &opts.Custom.APIKey},
+	}
+	for _, k := range keys {
+		if !k.enabled {
+			continue
+		}
+		v, err := resolve(*k.key)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s api key: %w", k.name, err)
+		}
+		*k.key = v
+	}
+	for id, spec := range opts.Customs {
+		if !spec.Enabled {
+			continue
+		}
+		v, err := resolve(spec.APIKey)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s api key: %w", id, err)
+		}
+		spec.APIKey = v
+		opts.Customs[id] = spec
+	}
+	return nil
+}
+
+// runAuth handles "auth set <name>" command, storing the API key read from input in the OS keyring.
+// The key is referenced in options as "keyring:<name>".
+func runAuth(args []string, in io.Reader, out io.Writer, set func(name, secret string) error) error {
+	p := flags.NewParser(&struct{}{}, flags.PrintErrors|flags.PassDoubleDash|flags.HelpFlag)
+	p.Usage = "auth set <name>"
+	rest, err := p.ParseArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 2 || rest[0] != "set" {
+		return fmt.Errorf("usage: mpt auth set <name>, e.g. mpt auth set openai")
+	}
+	name := rest[1]
+
+	if f, ok := in.(*os.File); ok {
+		if stat, err := f.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+			fmt.Fprintf(out, "enter API key for %s: ", name)
+		}
+	}
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read API key: %w", err)
+	}
+	secret := strings.TrimSpace(line)
+	if secret == "" {
+		return fmt.Errorf("no API key provided for %s", name)
+	}
+	if err := set(name, secret); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "API key for %s stored in keyring, use it as keyring:%s\n", name, name)
+	return nil
+}
+
+// pricingOptions are options of "pricing" command
+type pricingOptions struct {
+	URL  string `long:"url" env:"MPT_PRICING_URL" description:"URL of the published pricing JSON fetched by update"`
+	File string `long:"file" env:"MPT_PRICING_FILE" description:"pricing table file, default ~/.mpt/pricing.json"`
+	JSON bool   `long:"json" description:"print the pricing table as JSON"`
+}
+
+// runPricing handles "pricing show [model]" and "pricing update" commands. Update fetches the published pricing
+// JSON and saves it to the pricing file, show lists prices from the file, or from the table bundled with mpt
+// if the file was never updated, so a failed update leaves the previous prices in use.
+func runPricing(ctx context.Context, args []string, out io.Writer, client *http.Client) error {
+	popts := pricingOptions{URL: pricing.DefaultURL}
+	p := flags.NewParser(&popts, flags.PrintErrors|flags.PassDoubleDash|flags.HelpFlag)
+	p.Usage = "pricing show [model] | pricing update [--url=URL]"
+	rest, err := p.ParseArgs(args)
+	if err != nil {
+		return err
+	}
+	if popts.File == "" {
+		if popts.File, err = pricingFile(); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case len(rest) == 1 && rest[0] == "update":
+		table, err := pricing.Fetch(ctx, client, popts.URL)
+		if err != nil {
+			return fmt.Errorf("%w, previous prices are kept", err)
+		}
+		if err := pricing.Save(popts.File, table); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "pricing table of %d models saved to %s\n", len(table.Models), popts.File)
+		return nil
+	case len(rest) >= 1 && len(rest) <= 2 && rest[0] == "show":
+		table, err := pricing.Load(popts.File)
+		if err != nil {
+			return err
+		}
+		if len(rest) == 2 {
+			filter := strings.ToLower(rest[1])
+			maps.DeleteFunc(table.Models, func(name string, _ pricing.Price) bool { return !strings.Contains(name, filter) })
+		}
+		return showPricing(out, table, popts.JSON)
+	}
+	return fmt.Errorf("usage: mpt pricing show [model] | mpt pricing update [--url=URL], e.g. mpt pricing show gpt-5")
+}
+
+// pricingFile returns the default pricing table file, ~/.mpt/pricing.json
+func pricingFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find pricing table file: %w", err)
+	}
+	return filepath.Join(home, ".mpt", "pricing.json"), nil
+}
+
+// loadPrices returns the pricing table used to estimate costs of the run, saved by "pricing update" to the file
+// set with MPT_PRICING_FILE or the default one. The bundled table is used if the file can't be loaded.
+func loadPrices() pricing.Table {
+	path := os.Getenv("MPT_PRICING_FILE")
+	if path == "" {
+		var err error
+		if path, err = pricingFile(); err != nil {
+			return pricing.Bundled()
+		}
+	}
+	table, err := pricing.Load(path)
+	if err != nil {
+		lgr.Printf("[WARN] %v, bundled prices are used", err)
+		return pricing.Bundled()
+	}
+	return table
+}
+
+// cost returns the estimated cost in USD of the provider request, from token usage reported by the provider
+// and the price of its model. It returns false if the usage is not reported or the model is not priced.
+func cost(result *ExecutionResult, r provider.Result) (float64, bool) {
+	if r.Usage.InputTokens == 0 && r.Usage.OutputTokens == 0 {
+		return 0, false
+	}
+	price, ok := result.Prices.Price(r.Model)
+	if !ok {
+		return 0, false
+	}
+	return price.Cost(r.Usage.InputTokens, r.Usage.OutputTokens), true
+}
+
+// showPricing prints prices of the table per million tokens
+func showPricing(w io.Writer, table pricing.Table, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(table)
+	}
+	fmt.Fprintf(w, "prices in USD per 1M tokens, source: %s, updated: %s\n\n", table.Source, table.Updated)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tPROVIDER\tINPUT\tOUTPUT")
+	for _, name := range table.Names() {
+		price := table.Models[name]
+		fmt.Fprintf(tw, "%s\t%s\t%.3f\t%.3f\n", name, price.Provider, price.Input, price.Output)
+	}
+	return tw.Flush()
+}
+
+// providersDump is the resolved configuration of providers printed by "providers dump"
+type providersDump struct {
+	Providers    []providerDump `json:"providers"`
+	Retry        retryDump      `json:"retry"`
+	TimeoutTotal string         `json:"timeout_total"`
+	Stop         []string       `json:"stop,omitempty"`
+}
+
+// providerDump is the resolved configuration of a provider without secrets. API keys are reported as "set",
+// references to secret stores, like keyring:openai, are reported as is.
+type providerDump struct {
+	Name              string                `json:"name"`
+	Type              string                `json:"type"`
+	Enabled           bool                  `json:"enabled"`
+	Model             string                `json:"model,omitempty"`
+	URL               string                `json:"url,omitempty"`
+	APIKey            string                `json:"api_key,omitempty"`
+	MaxTokens         int                   `json:"max_tokens,omitempty"`
+	Temperature       *float32              `json:"temperature,omitempty"` // nil if not sent, provider default is used
+	ReasoningEffort   string                `json:"reasoning_effort,omitempty"`
+	EndpointType      string                `json:"endpoint_type,omitempty"`
+	TimeoutConnect    string                `json:"timeout_connect"`
+	TimeoutGeneration string                `json:"timeout_generation"`
+	Capabilities      []provider.Capability `json:"capabilities,omitempty"`
+	Required          bool                  `json:"required,omitempty"` // the run fails if the provider fails
+	Parallel          int                   `json:"parallel,omitempty"` // max in-flight requests, 0 for unlimited
+	Backend           string                `json:"backend,omitempty"`  // cloud platform routing requests, Vertex AI or Bedrock
+}
+
+// retryDump is the retry configuration shared by all providers
+type retryDump struct {
+	Attempts int     `json:"attempts"`
+	Delay    string  `json:"delay"`
+	MaxDelay string  `json:"max_delay"`
+	Factor   float64 `json:"factor"`
+}
+
+// dumpProviders prints the configuration of providers resolved from config files, environment and CLI options,
+// as JSON if --json is set. It is called before API keys are resolved, so secret stores are not accessed.
+func dumpProviders(out io.Writer, opts *options) error {
+	if err := loadModelAliases(opts); err != nil {
+		return err
+	}
+	if err := loadCapabilities(opts); err != nil {
+		return err
+	}
+
+	res := providersDump{
+		Retry: retryDump{Attempts: opts.Retry.Attempts, Delay: opts.Retry.Delay.String(),
+			MaxDelay: opts.Retry.MaxDelay.String(), Factor: opts.Retry.Factor},
+		TimeoutTotal: opts.TimeoutTotal.String(),
+		Stop:         opts.Stop,
+	}
+	for _, cfg := range getStandardProviderConfigs(opts) {
+		d := providerDump{Name: cfg.name, Type: cfg.provType.String(), Enabled: cfg.enabled, Model: cfg.model,
+			APIKey: dumpAPIKey(cfg.apiKey), MaxTokens: cfg.maxTokens, ReasoningEffort: cfg.reasoningEffort,
+			TimeoutConnect: cfg.timeouts.Connect.String(), TimeoutGeneration: cfg.timeouts.Generation.String(),
+			Required: cfg.required, Parallel: cfg.parallel}
+		switch cfg.provType {
+		case provider.ProviderTypeOpenAI:
+			d.Temperature, d.EndpointType = &cfg.temp, string(provider.EndpointTypeAuto)
+		case provider.ProviderTypeDeepSeek:
+			d.Temperature, d.EndpointType = &cfg.temp, string(provider.EndpointTypeChatCompletions)
+		}
+		if cfg.enabled {
+			d.Capabilities = opts.caps[strings.ToLower(cfg.name)]
+		}
+		if cfg.vertex.Enabled {
+			d.Backend = dumpVertex(cfg.vertex)
+		}
+		if cfg.bedrock.Enabled {
+			d.Backend = "bedrock"
+			if cfg.bedrock.Region != "" {
+				d.Backend += ", region " + cfg.bedrock.Region
+			}
+		}
+		res.Providers = append(res.Providers, d)
+	}
+	for _, spec := range createCustomManager(opts).Specs() {
+		d := providerDump{Name: spec.Name, Type: "custom", Enabled: spec.Enabled, Model: spec.Model, URL: spec.URL,
+			APIKey: dumpAPIKey(spec.APIKey), MaxTokens: spec.MaxTokens, EndpointType: spec.EndpointType,
+			TimeoutConnect: spec.Timeouts.Connect.String(), TimeoutGeneration: spec.Timeouts.Generation.String(),
+			Capabilities: opts.caps[strings.ToLower(spec.Name)], Required: spec.Required,
+			Parallel: spec.Parallel}
+		if spec.Temperature >= 0 {
+			d.Temperature = &spec.Temperature
+		}
+		if d.EndpointType == "" {
+			d.EndpointType = string(provider.EndpointTypeChatCompletions)
+		}
+		res.Providers = append(res.Providers, d)
+	}
+
+	if opts.JSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+
+	for _, d := range res.Providers {
+		fmt.Fprintf(out, "%s (%s)\n", d.Name, d.Type)
+		fields := [][2]string{{"enabled", strconv.FormatBool(d.Enabled)}, {"model", d.Model}, {"url", d.URL},
+			{"api key", d.APIKey}, {"max tokens", ""}, {"temperature", ""}, {"reasoning effort", d.ReasoningEffort},
+			{"endpoint type", d.EndpointType}, {"timeout connect", d.TimeoutConnect},
+			{"timeout generation", d.TimeoutGeneration}, {"capabilities", ""}, {"required", ""},
+			{"parallel", ""}, {"backend", d.Backend}}
+		if d.MaxTokens > 0 {
+			fields[4][1] = strconv.Itoa(d.MaxTokens)
+		}
+		if d.Temperature != nil {
+			fields[5][1] = strconv.FormatFloat(float64(*d.Temperature), 'f', -1, 32)
+		}
+		if len(d.Capabilities) > 0 {
+			caps := make([]string, len(d.Capabilities))
+			for i, c := range d.Capabilities {
+				caps[i] = string(c)
+			}
+			fields[10][1] = strings.Join(caps, ", ")
+		}
+		if d.Required {
+			fields[11][1] = "true"
+		}
+		if d.Parallel > 0 {
+			fields[12][1] = strconv.Itoa(d.Parallel)
+		}
+		for _, f := range fields {
+			if f[1] != "" {
+				fmt.Fprintf(out, "  %-19s %s\n", f[0]+":", f[1])
+			}
+		}
+	}
+	fmt.Fprintf(out, "retry: attempts %d, delay %s, max delay %s, factor %g\n",
+		res.Retry.Attempts, res.Retry.Delay, res.Retry.MaxDelay, res.Retry.Factor)
+	fmt.Fprintf(out, "timeout total: %s\n", res.TimeoutTotal)
+	if len(res.Stop) > 0 {
+		fmt.Fprintf(out, "stop: %q\n", res.Stop)
+	}
+	return nil
+}
+
+// dumpVertex returns Vertex AI routing as reported by "providers dump", with project and location if set
+func dumpVertex(v provider.Vertex) string {
+	res := "vertex"
+	if v.Project != "" {
+		res += ", project " + v.Project
+	}
+	if v.Location != "" {
+		res += ", location " + v.Location
+	}
+	return res
+}
+
+// dumpAPIKey returns the API key as reported by "providers dump", "set" for keys and references to secret
+// stores as is
+func dumpAPIKey(key string) string {
+	switch {
+	case key == "":
+		return ""
+	case secrets.IsReference(key):
+		return key
+	default:
+		return "set"
+	}
+}
+
+// completionEnv is set by shell completion scripts, arguments are completed instead of running mpt.
+// Options and their values not completed by completeArgs are completed by go-flags. Parsing with go-flags
+// completes arguments while the env is set, so it is done only once.
+const completionEnv = "GO_FLAGS_COMPLETION"
+
+// subcommands are completed as the first argument
+var subcommands = []string{"auth", "completion", "pricing", "providers", "rerun"}
+
+// completionShells are shells supported by completion command
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// providerOptions are options taking provider names, comma-separated names of --mix.provider chain included
+var providerOptions = []string{"only", "skip", "mix.provider", "prompt-variants.judge"}
+
+//go:generate sh -c "go run . completion bash > ../../completions/mpt.bash"
+//go:generate sh -c "go run . completion zsh > ../../completions/mpt.zsh"
+//go:generate sh -c "go run . completion fish > ../../completions/mpt.fish"
+
+// completionScripts are completion scripts per shell, each script runs mpt with the completion env set
+var completionScripts = map[string]string{
+	"bash": bashCompletion + "complete -o default -F _mpt mpt\n",
+	"zsh":  "#compdef mpt\nautoload -U +X bashcompinit && bashcompinit\n" + bashCompletion + "complete -o default -F _mpt mpt\n",
+	"fish": `function __mpt_complete
+    set -l args (commandline -opc)[2..-1] (commandline -ct)
+    env GO_FLAGS_COMPLETION=1 mpt $args
+end
+complete -c mpt -f -a '(__mpt_complete)'
+`,
+	"powershell": `Register-ArgumentCompleter -Native -CommandName mpt -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -eq '') { $words += '""' }
+    $env:GO_FLAGS_COMPLETION = '1'
+    try { $items = & mpt @words } finally { Remove-Item Env:GO_FLAGS_COMPLETION }
+    $items | ForEach-Object { [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_) }
+}
+`,
+}
+
+// bashCompletion is the completion function of bash, used by zsh with bashcompinit as well. The line is split
+// by mpt rules, and the part of the word before the last "=" or ":", split by bash, is stripped from items.
+const bashCompletion = `_mpt() {
+    local line="${COMP_LINE:0:$COMP_POINT}"
+    local -a args
+    read -ra args <<< "$line"
+    [[ "$line" == *" " ]] && args+=("")
+    local word="${args[${#args[@]}-1]}" cur="${COMP_WORDS[COMP_CWORD]}"
+    [[ "$cur" == "=" || "$cur" == ":" ]] && cur=""
+    local strip="${word%"$cur"}"
+    local IFS=$'\n'
+    local -a items
+    items=($(GO_FLAGS_COMPLETION=1 "${args[0]}" "${args[@]:1}"))
+    COMPREPLY=("${items[@]#"$strip"}")
+}
+`
+
+// runCompletion handles "completion <shell>" command, printing the completion script of the shell
+func runCompletion(args []string, out io.Writer) error {
+	if len(args) != 1 || completionScripts[args[0]] == "" {
+		return fmt.Errorf("usage: mpt completion %s", strings.Join(completionShells, "|"))
+	}
+	_, err := io.WriteString(out, completionScripts[args[0]])
+	return err
+}
+
+// completeArgs completes the last argument with subcommands, shell names of completion command, provider names
+// returned by providers for options taking them, models of custom providers returned by models for their ID,
+// empty for the --custom.* provider, and choices of options. It returns false for arguments completed by
+// go-flags, like option names.
+func completeArgs(args []string, providers func() []string, models func(id string) []string) ([]string, bool) {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	last := args[len(args)-1]
+	if len(args) == 1 && !strings.HasPrefix(last, "-") {
+		return completeMatching(subcommands, "", last), true
+	}
+	switch args[0] {
+	case "completion":
+		if len(args) == 2 {
+			return completeMatching(completionShells, "", last), true
+		}
+		return nil, true
+	case "providers":
+		if len(args) == 2 {
+			return completeMatching([]string{"dump"}, "", last), true
+		}
+	case "pricing":
+		if len(args) == 2 {
+			return completeMatching([]string{"show", "update"}, "", last), true
+		}
+		return nil, true
+	case "auth", "rerun":
+		return nil, true
+	}
+
+	// value of the option given as --name=value or as the argument following --name
+	var name, prefix string
+	value := last
+	if n, v, ok := strings.Cut(last, "="); ok && strings.HasPrefix(n, "--") {
+		name, prefix, value = strings.TrimPrefix(n, "--"), n+"=", v
+	} else if len(args) > 1 && strings.HasPrefix(args[len(args)-2], "--") && !strings.Contains(args[len(args)-2], "=") {
+		name = strings.TrimPrefix(args[len(args)-2], "--")
+	}
+	if name == "" {
+		return nil, false
+	}
+	if slices.Contains(providerOptions, name) {
+		if i := strings.LastIndex(value, ","); i >= 0 {
+			prefix, value = prefix+value[:i+1], value[i+1:]
+		}
+		return completeMatching(providers(), prefix, value), true
+	}
+	if name == "custom.model" {
+		return completeMatching(models(""), prefix, value), true
+	}
+	if id, spec, ok := strings.Cut(value, ":"); ok && name == "customs" {
+		// model of the spec like id:url=...,model=
+		keys, last := "", spec
+		if i := strings.LastIndex(spec, ","); i >= 0 {
+			keys, last = spec[:i+1], spec[i+1:]
+		}
+		if model, ok := strings.CutPrefix(last, "model="); ok {
+			return completeMatching(models(id), prefix+id+":"+keys+"model=", model), true
+		}
+		return nil, true
+	}
+	opt := flags.NewParser(&options{}, flags.None).FindOptionByLongName(name)
+	if opt == nil || len(opt.Choices) == 0 {
+		return nil, false
+	}
+	return completeMatching(opt.Choices, prefix, value), true
+}
+
+// completeMatching returns the values starting with the match, each with the prefix
+func completeMatching(values []string, prefix, match string) []string {
+	var res []string
+	for _, v := range values {
+		if strings.HasPrefix(v, match) {
+			res = append(res, prefix+v)
+		}
+	}
+	return res
+}
+
+// completionProviders returns sorted names of standard providers and providers enabled in config files and
+// environment, lowercase
+func completionProviders(paths ...string) []string {
+	names := map[string]bool{"openai": true, "anthropic": true, "google": true, "deepseek": true}
+	opts := &options{}
+	p := flags.NewParser(opts, flags.IgnoreUnknown)
+	if defaults, err := loadConfigFiles(p, paths...); err == nil {
+		if _, err := p.ParseArgs(defaults); err == nil {
+			maps.Copy(names, configuredProviderNames(opts))
+		}
+	}
+	return slices.Sorted(maps.Keys(names))
+}
+
+// completionModels returns models discovered for the custom provider with the ID enabled in config files and
+// environment, or for the --custom.* provider if the ID is empty. Cached models are returned regardless of
+// their age, and missing ones are discovered with a short timeout, so completion doesn't hang.
+func completionModels(id string, paths ...string) []string {
+	opts := &options{}
+	p := flags.NewParser(opts, flags.IgnoreUnknown)
+	defaults, err := loadConfigFiles(p, paths...)
+	if err != nil {
+		return nil
+	}
+	if _, err := p.ParseArgs(defaults); err != nil {
+		return nil
+	}
+	if id == "" {
+		id = opts.Custom.Name
+	}
+	opts.models = provider.NewModelCache("", opts.ModelsTTL)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return createCustomManager(opts).DiscoveredModels(ctx, id)
+}
+
+// processPrompt gets the prompt from stdin or command line and optionally adds file content
+func processPrompt(ctx context.Context, opts *options) error {
+	// get prompt from stdin (piped data or interactive input) or command line
+	question := opts.Prompt
+	if err := getPrompt(opts); err != nil {
+		return fmt.Errorf("failed to get prompt: %w", err)
+	}
+	if question == "" || opts.Edit {
+		question = opts.Prompt // prompt read from stdin or composed in the editor
+	}
+
+	// check if we have a prompt after all attempts
+	if opts.Prompt == "" && opts.input == "" {
+		return fmt.Errorf("no prompt provided")
+	}
+	recordHistory(opts)
+
+	// append file content to prompt if requested
+	if err := buildFullPrompt(ctx, opts); err != nil {
+		return err
+	}
+
+	// instruct providers to return structured findings in review mode
+	if opts.Review {
+		opts.Prompt += "\n\n" + review.Instructions
+	}
+
+	if opts.Lint || opts.LintFail {
+		return lintPrompt(os.Stderr, opts, question)
+	}
+	return nil
+}
+
+// lintPrompt checks the assembled prompt and writes warnings, failing on them with --lint.fail. Warnings are
+// written in quiet mode as well, as the lint is requested explicitly.
+func lintPrompt(w io.Writer, opts *options, question string) error {
+	warnings := lint.Check(lint.Prompt{Instruction: question, Full: opts.Prompt}, lint.Options{Secrets: collectSecrets(opts)})
+	for _, warn := range warnings {
+		lgr.Printf("[DEBUG] prompt lint, %s", warn)
+		fmt.Fprintf(w, "lint: %s\n", warn)
+	}
+	if opts.LintFail && len(warnings) > 0 {
+		return fmt.Errorf("prompt lint failed with %d warning(s)", len(warnings))
+	}
+	return nil
+}
+
+// buildFullPrompt loads content from specified files and builds the complete prompt. Prompts of providers
+// with overridden context wrapper are built as well, each distinct wrapper once.
+func buildFullPrompt(ctx context.Context, opts *options) error {
+	wrapper, err := files.ParseWrapper(opts.Ctx.Wrapper)
+	if err != nil {
+		return err
+	}
+	fullPrompt, err := buildPrompt(ctx, opts, wrapper)
+	if err != nil {
+		return err
+	}
+	reportTrims(opts)
+	if opts.FilesReport {
+		reportFileSizes(os.Stderr, opts.sizes)
+	}
+
+	opts.variants = promptVariants{}
+	if len(opts.Ctx.ProviderWrappers) > 0 {
+		opts.variants = promptVariants{base: fullPrompt, providers: map[string]string{}}
+		built := map[files.Wrapper]string{wrapper: fullPrompt}
+		for name, spec := range opts.Ctx.ProviderWrappers {
+			w, err := files.ParseWrapper(spec)
+			if err != nil {
+				return fmt.Errorf("invalid context wrapper of %s: %w", name, err)
+			}
+			if _, ok := built[w]; !ok {
+				lgr.Printf("[DEBUG] building prompt with %s context wrapper", w)
+				if built[w], err = buildPrompt(ctx, opts, w); err != nil {
+					return err
+				}
+			}
+			opts.variants.providers[strings.ToLower(name)] = built[w]
+		}
+	}
+
 	opts.Prompt = fullPrompt
 	return nil
 }
 
-// providerConfig holds configuration for a provider
-type providerConfig struct {
-	enabled         bool
-	provType        provider.ProviderType
-	name            string
-	apiKey          string
-	model           string
-	maxTokens       int
-	temp            float32
-	reasoningEffort string
+// buildPrompt builds the prompt with content of files and git context wrapped by the wrapper
+func buildPrompt(ctx context.Context, opts *options, wrapper files.Wrapper) (string, error) {
+	// only create git diff processor if git features are requested
+	var gitDiffer prompt.GitDiffProcessor
+	if opts.Git.Diff || opts.Git.Branch != "" || opts.Git.Blame != "" || opts.Git.Log > 0 || opts.Template ||
+		opts.FilesChangedSince != "" {
+		repo := opts.dir
+		if opts.Git.Repo != "" {
+			repo = opts.Git.Repo
+		}
+		gitDiffer = prompt.NewGitDifferIn(repo)
+	}
+
+	ecosystems, err := files.ResolveEcosystems(opts.Ecosystem, opts.dir)
+	if err != nil {
+		return "", err
+	}
+
+	// use the prompt builder to handle file loading and prompt construction
+	builder := prompt.New(opts.Prompt, gitDiffer).
+		WithFiles(opts.Files).
+		WithExcludes(opts.Excludes).
+		WithMaxFileSize(int64(opts.MaxFileSize)).
+		WithForce(opts.Force).
+		WithFollowSymlinks(opts.FollowSymlinks).
+		WithIncludeSubmodules(opts.IncludeSubmodules).
+		WithFileWorkers(opts.FilesWorkers).
+		WithEcosystems(ecosystems).
+		WithDir(opts.dir).
+		WithTemplate(opts.Template).
+		WithArgs(opts.PromptArgs).
+		WithInput(opts.input).
+		WithContextPosition(opts.Ctx.Position).
+		WithContextWrapper(wrapper).
+		WithBudget(contextBudget(opts)).
+		WithFileSizes(opts.FilesReport)
+
+	// include snapshot of the runtime environment if requested, with tools of the project ecosystems
+	if opts.EnvContext {
+		builder = builder.WithEnvironment(environ.New(opts.dir, ecosystems, collectSecrets(opts)).Capture(ctx))
+	}
+
+	// limit matched files to files changed since the ref if requested
+	if opts.FilesChangedSince != "" {
+		builder, err = builder.WithChangedSince(opts.FilesChangedSince)
+		if err != nil {
+			return "", fmt.Errorf("failed to list files changed since %s: %w", opts.FilesChangedSince, err)
+		}
+	}
+
+	// select only relevant file chunks if requested
+	if opts.FilesRelevant && len(opts.Files) > 0 {
+		embedder, err := findEmbedder(opts)
+		if err != nil {
+			return "", err
+		}
+		builder = builder.WithRelevance(embedder, opts.FilesTopK, opts.FilesMinScore)
+	}
+
+	// add git diff if requested
+	if opts.Git.Diff {
+		builder, err = builder.WithGitDiff()
+		if err != nil {
+			return "", fmt.Errorf("failed to process git diff: %w", err)
+		}
+	}
+
+	// add git branch diff if requested
+	if opts.Git.Branch != "" {
+		builder, err = builder.WithGitBranchDiff(opts.Git.Branch)
+		if err != nil {
+			return "", fmt.Errorf("failed to process git branch diff: %w", err)
+		}
+	}
+
+	// add git blame of the file if requested
+	if opts.Git.Blame != "" {
+		builder, err = builder.WithGitBlame(opts.Git.Blame)
+		if err != nil {
+			return "", fmt.Errorf("failed to process git blame: %w", err)
+		}
+	}
+
+	// add recent commit messages if requested
+	if opts.Git.Log > 0 {
+		builder, err = builder.WithGitLog(opts.Git.Log)
+		if err != nil {
+			return "", fmt.Errorf("failed to process git log: %w", err)
+		}
+	}
+
+	// build the prompt
+	fullPrompt, err := builder.BuildContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to build prompt: %w", err)
+	}
+	opts.trims, opts.sizes = builder.Trims(), builder.FileSizes()
+	return fullPrompt, nil
+}
+
+// contextBudget returns token budgets of context sources, zero budget if not set
+func contextBudget(opts *options) prompt.Budget {
+	if !opts.Budget.any() {
+		return prompt.Budget{}
+	}
+	limit := int(opts.Tokens.Max)
+	return prompt.Budget{Limit: limit, Files: opts.Budget.Files.tokens(limit), Git: opts.Budget.Git.tokens(limit),
+		Input: opts.Budget.Stdin.tokens(limit)}
+}
+
+// reportTrims reports context sources trimmed to fit their budgets
+func reportTrims(opts *options) {
+	if len(opts.trims) == 0 {
+		return
+	}
+	trims := make([]string, len(opts.trims))
+	for i, t := range opts.trims {
+		trims[i] = t.String()
+	}
+	msg := fmt.Sprintf("context trimmed to fit %d prompt tokens: %s", opts.Tokens.Max, strings.Join(trims, "; "))
+	lgr.Printf("[INFO] %s", msg)
+	if !opts.Quiet {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+}
+
+// reportFileSizes writes the table of files included in the prompt with their size, estimated tokens and
+// percent of tokens of all included files, largest first
+func reportFileSizes(w io.Writer, sizes []prompt.FileSize) {
+	if len(sizes) == 0 {
+		fmt.Fprintln(w, "no files included in the prompt")
+		return
+	}
+	totalBytes, totalTokens := 0, 0
+	for _, s := range sizes {
+		totalBytes += s.Bytes
+		totalTokens += s.Tokens
+	}
+	percent := func(n int) float64 {
+		if totalTokens == 0 {
+			return 0
+		}
+		return float64(n) * 100 / float64(totalTokens)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "bytes\ttokens\tcontext\t  file")
+	for _, s := range sizes {
+		fmt.Fprintf(tw, "%d\t~%d\t%.1f%%\t  %s\n", s.Bytes, s.Tokens, percent(s.Tokens), s.Name)
+	}
+	fmt.Fprintf(tw, "%d\t~%d\t%.1f%%\t  total of %d\n", totalBytes, totalTokens, percent(totalTokens), len(sizes))
+	tw.Flush()
+}
+
+// findEmbedder returns the custom provider serving embeddings if configured, or the first enabled
+// standard provider supporting embeddings API
+func findEmbedder(opts *options) (provider.Embedder, error) {
+	if embedder := createCustomManager(opts).Embedder(); embedder != nil {
+		lgr.Printf("[DEBUG] using custom embeddings provider")
+		return embedder, nil
+	}
+	for _, cfg := range getStandardProviderConfigs(opts) {
+		if !cfg.enabled {
+			continue
+		}
+		p, err := provider.CreateProvider(cfg.provType, provider.Options{APIKey: cfg.apiKey, Model: cfg.model, Enabled: true,
+			Timeouts: cfg.timeouts, Vertex: cfg.vertex, Bedrock: cfg.bedrock})
+		if err != nil {
+			continue
+		}
+		if embedder, ok := p.(provider.Embedder); ok {
+			lgr.Printf("[DEBUG] using %s provider for embeddings", cfg.name)
+			return embedder, nil
+		}
+	}
+	return nil, fmt.Errorf("files relevance requires an enabled provider with embeddings support (OpenAI, Google or custom provider with embeddings endpoint type)")
+}
+
+// providerConfig holds configuration for a provider
+type providerConfig struct {
+	enabled         bool
+	provType        provider.ProviderType
+	name            string
+	apiKey          string
+	model           string
+	maxTokens       int
+	temp            float32
+	reasoningEffort string
+	timeouts        provider.Timeouts
+	required        bool             // the run fails if the provider fails
+	parallel        int              // max in-flight requests to the provider, 0 for unlimited
+	vertex          provider.Vertex  // route requests through Vertex AI
+	bedrock         provider.Bedrock // route requests through AWS Bedrock
+}
+
+// initializeProviders creates provider instances from the options
+func initializeProviders(ctx context.Context, opts *options) ([]provider.Provider, error) {
+	providers, err := createProviders(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	providers = wrapProviders(opts, providers)
+
+	// if mix mode is enabled, validate the configuration
+	if opts.MixEnabled && len(providers) < 2 {
+		lgr.Printf("[WARN] mix mode enabled but only one provider is active, mix feature will not be used")
+	}
+
+	return providers, nil
+}
+
+// createProviders creates enabled providers, filtered by the per-invocation filters and not wrapped yet
+func createProviders(ctx context.Context, opts *options) ([]provider.Provider, error) {
+	// check if any providers are enabled
+	if !anyProvidersEnabled(opts) {
+		return nil, fmt.Errorf("no providers enabled. Use --<provider>.enabled flag to enable at least one provider (e.g., --openai.enabled), " +
+			"or --auto to enable providers with API keys set")
+	}
+
+	providers := make([]provider.Provider, 0, 4) // pre-allocate for 4 providers (3 standard + 1 custom)
+	providerErrors := make([]string, 0)
+
+	// initialize standard providers
+	standardProviders := getStandardProviderConfigs(opts)
+	for _, config := range standardProviders {
+		if !config.enabled {
+			continue
+		}
+
+		apiKey := config.apiKey
+		if apiKey == "" && opts.Replay != "" {
+			apiKey = "replay" // replayed providers don't call APIs, no real key needed
+		}
+		p, err := provider.CreateProvider(config.provType, provider.Options{
+			APIKey:           apiKey,
+			Model:            config.model,
+			Enabled:          true,
+			MaxTokens:        config.maxTokens,
+			Stop:             opts.Stop,
+			Temperature:      config.temp,
+			ReasoningEffort:  config.reasoningEffort,
+			IncludeReasoning: opts.ShowReasoning,
+			Timeouts:         config.timeouts,
+			Vertex:           config.vertex,
+			Bedrock:          config.bedrock,
+		})
+		if err != nil {
+			lgr.Printf("[WARN] %s provider failed to initialize: %v", config.name, err)
+			providerErrors = append(providerErrors, fmt.Sprintf("%s: %v", config.name, err))
+			continue
+		}
+
+		providers = append(providers, p)
+		lgr.Printf("[DEBUG] added %s provider, model: %s", config.name, config.model)
+	}
+
+	// initialize multiple custom providers (handles legacy custom too)
+	customProviders, customErrors := createCustomManager(opts).InitializeProviders()
+	providers = append(providers, customProviders...)
+	providerErrors = append(providerErrors, customErrors...)
+
+	// check if any providers were successfully initialized
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("all enabled providers failed to initialize:\n%s", strings.Join(providerErrors, "\n"))
+	}
+
+	// apply per-invocation provider filters
+	providers, err := filterProviders(providers, opts.Only, opts.Skip)
+	if err != nil {
+		return nil, err
+	}
+
+	// count tokens before wrapping, wrappers don't expose token counting of providers
+	if opts.Tokens.Count || opts.Tokens.Max > 0 {
+		if err := countPromptTokens(ctx, opts, providers); err != nil {
+			return nil, err
+		}
+	}
+	return providers, nil
+}
+
+// countPromptTokens counts tokens of the prompt each provider gets, reports them if requested and fails if
+// the prompt is larger than the max prompt tokens for any provider
+func countPromptTokens(ctx context.Context, opts *options, providers []provider.Provider) error {
+	opts.tokens = tokens.CountAll(ctx, providers, func(p provider.Provider) string {
+		if variant, ok := opts.variants.providers[strings.ToLower(p.Name())]; ok {
+			return strings.Replace(opts.Prompt, opts.variants.base, variant, 1)
+		}
+		return opts.Prompt
+	})
+	if opts.Tokens.Count && !opts.Quiet {
+		fmt.Fprintf(os.Stderr, "prompt tokens: %s\n", tokens.Format(opts.tokens))
+	}
+	if largest := tokens.Max(opts.tokens); opts.Tokens.Max > 0 && largest.Tokens > int(opts.Tokens.Max) {
+		return fmt.Errorf("prompt of %d tokens for %s exceeds max prompt tokens %d", largest.Tokens, largest.Provider,
+			opts.Tokens.Max)
+	}
+	return nil
+}
+
+// filterProviders keeps only providers listed in only (if set) and drops providers listed in skip.
+// Names are matched case-insensitively and may be passed as comma-separated lists.
+func filterProviders(providers []provider.Provider, only, skip []string) ([]provider.Provider, error) {
+	onlyNames, skipNames := splitNames(only), splitNames(skip)
+	if len(onlyNames) == 0 && len(skipNames) == 0 {
+		return providers, nil
+	}
+
+	known := make(map[string]bool, len(providers))
+	res := make([]provider.Provider, 0, len(providers))
+	for _, p := range providers {
+		name := strings.ToLower(p.Name())
+		known[name] = true
+		if (len(onlyNames) > 0 && !onlyNames[name]) || skipNames[name] {
+			lgr.Printf("[DEBUG] provider %s filtered out", p.Name())
+			continue
+		}
+		res = append(res, p)
+	}
+
+	for name := range onlyNames {
+		if !known[name] {
+			lgr.Printf("[WARN] provider %q requested with --only is not enabled", name)
+		}
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no providers left after applying --only and --skip filters")
+	}
+	return res, nil
+}
+
+// splitNames splits comma-separated names into a set of lowercase names
+func splitNames(values []string) map[string]bool {
+	res := make(map[string]bool)
+	for _, v := range values {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				res[strings.ToLower(name)] = true
+			}
+		}
+	}
+	return res
+}
+
+// wrapProviders wraps providers with fixtures, retry, auto-continue, validation and prompt variants if configured
+func wrapProviders(opts *options, providers []provider.Provider) []provider.Provider {
+	// wrap providers with fixtures first, so each request to the provider API is recorded or replayed
+	switch {
+	case opts.Record != "":
+		providers = provider.WrapProvidersWithRecording(providers, opts.Record)
+		lgr.Printf("[INFO] recording %d providers responses to %s", len(providers), opts.Record)
+	case opts.Replay != "":
+		providers = provider.WrapProvidersWithReplay(providers, opts.Replay)
+		lgr.Printf("[INFO] replaying %d providers responses from %s", len(providers), opts.Replay)
+	}
+
+	// inject faults under retries, so retry and fallback handling can be tested
+	if len(opts.Fault.Providers) > 0 {
+		faults := map[string][]provider.Fault{}
+		for name, spec := range opts.Fault.Providers {
+			f, err := provider.ParseFaults(spec)
+			if err != nil {
+				lgr.Printf("[WARN] invalid faults of %s: %v", name, err) // checked by validateOptions
+				continue
+			}
+			faults[strings.ToLower(name)] = f
+			lgr.Printf("[WARN] injecting faults %s into %s requests", spec, name)
+		}
+		delay := opts.Fault.Delay
+		if delay == 0 {
+			delay = opts.TimeoutGeneration
+		}
+		providers = provider.WrapProvidersWithFaults(providers, faults, opts.Fault.Seed, delay)
+	}
+
+	// wrap providers with retry logic if configured
+	if opts.Retry.Attempts > 1 {
+		retryOpts := provider.RetryOptions{
+			Attempts: opts.Retry.Attempts,
+			Delay:    opts.Retry.Delay,
+			MaxDelay: opts.Retry.MaxDelay,
+			Factor:   opts.Retry.Factor,
+		}
+		providers = provider.WrapProvidersWithRetry(providers, retryOpts)
+		lgr.Printf("[INFO] wrapped %d providers with retry logic (attempts=%d)", len(providers), opts.Retry.Attempts)
+	}
+
+	// wrap providers with auto-continue logic if requested
+	if opts.AutoContinue {
+		providers = provider.WrapProvidersWithContinue(providers, opts.Continue.Max)
+		lgr.Printf("[INFO] wrapped %d providers with auto-continue (max=%d)", len(providers), opts.Continue.Max)
+	}
+
+	// repair markdown of complete answers, before they are normalized, as normalization skips code blocks
+	if opts.RepairMarkdown {
+		providers = provider.WrapProvidersWithNormalizer(providers, repair.Markdown)
+		lgr.Printf("[DEBUG] wrapped %d providers with markdown repair", len(providers))
+	}
+
+	// normalize complete answers, before they are validated
+	if opts.normalizer != nil {
+		providers = provider.WrapProvidersWithNormalizer(providers, opts.normalizer.Apply)
+		lgr.Printf("[DEBUG] wrapped %d providers with answer normalization", len(providers))
+	}
+
+	// wrap providers with answer validation, complete answers are validated
+	if opts.validator != nil {
+		providers = provider.WrapProvidersWithValidation(providers, opts.validator.Check, opts.ValidateAttempts)
+		lgr.Printf("[INFO] wrapped %d providers with answer validation %q (attempts=%d)", len(providers),
+			opts.validator, opts.ValidateAttempts)
+	}
+
+	// send prompts with context wrapped for the provider, outermost so retries and continuations get them too
+	for i, p := range providers {
+		if variant, ok := opts.variants.providers[strings.ToLower(p.Name())]; ok {
+			providers[i] = provider.NewVariantProvider(p, opts.variants.base, variant)
+			lgr.Printf("[DEBUG] %s gets prompt with overridden context wrapper", p.Name())
+		}
+	}
+
+	// put standing instructions of providers before their prompts, unless disabled for the run
+	if !opts.NoInstructions {
+		instructions := providerInstructions(opts)
+		for i, p := range providers {
+			if text, ok := instructions[strings.ToLower(p.Name())]; ok {
+				providers[i] = provider.NewInstructionsProvider(p, text)
+				lgr.Printf("[DEBUG] %s gets prompt with instructions", p.Name())
+			}
+		}
+	}
+
+	// append output instructions of answer constraints, set for the run, so they are kept with --no-instructions
+	if !opts.constraints.Empty() {
+		claude := claudeProviders(opts)
+		for i, p := range providers {
+			style := constraint.StyleMarkdown
+			if claude[strings.ToLower(p.Name())] {
+				style = constraint.StyleXML
+			}
+			providers[i] = provider.NewTrailingInstructionsProvider(p, opts.constraints.Instructions(style))
+		}
+		lgr.Printf("[DEBUG] wrapped %d providers with output instructions", len(providers))
+	}
+	return providers
+}
+
+// claudeProviders returns lowercase names of providers serving Claude models, Anthropic and custom providers
+// with Claude models, which follow instructions in XML tags best
+func claudeProviders(opts *options) map[string]bool {
+	res := map[string]bool{"anthropic": true}
+	for name, model := range createCustomManager(opts).Models() {
+		if strings.Contains(strings.ToLower(model), "claude") {
+			res[strings.ToLower(name)] = true
+		}
+	}
+	return res
+}
+
+// providerInstructions returns non-empty instructions of providers, keyed by lowercase provider name,
+// including the custom providers
+func providerInstructions(opts *options) map[string]string {
+	res := map[string]string{}
+	for name, text := range map[string]string{
+		"openai":    opts.OpenAI.Instructions,
+		"anthropic": opts.Anthropic.Instructions,
+		"google":    opts.Google.Instructions,
+		"deepseek":  opts.DeepSeek.Instructions,
+	} {
+		if strings.TrimSpace(text) != "" {
+			res[name] = text
+		}
+	}
+	maps.Copy(res, createCustomManager(opts).Instructions())
+	if opts.Custom.Name != "" && strings.TrimSpace(opts.Custom.Instructions) != "" {
+		res[strings.ToLower(opts.Custom.Name)] = opts.Custom.Instructions
+	}
+	return res
+}
+
+// newProviderFactory returns a factory creating a configured provider by name with the given model.
+// It is used by MCP server mode for per-call model overrides.
+func newProviderFactory(opts *options) mcp.ProviderFactory {
+	return func(name, model string) (provider.Provider, error) {
+		for _, cfg := range getStandardProviderConfigs(opts) {
+			if !cfg.enabled || !strings.EqualFold(cfg.name, name) {
+				continue
+			}
+			p, err := provider.CreateProvider(cfg.provType, provider.Options{
+				APIKey:           cfg.apiKey,
+				Model:            opts.aliases.Resolve(cfg.name, model),
+				Enabled:          true,
+				MaxTokens:        cfg.maxTokens,
+				Stop:             opts.Stop,
+				Temperature:      cfg.temp,
+				ReasoningEffort:  cfg.reasoningEffort,
+				IncludeReasoning: opts.ShowReasoning,
+				Timeouts:         cfg.timeouts,
+				Vertex:           cfg.vertex,
+				Bedrock:          cfg.bedrock,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return wrapProviders(opts, []provider.Provider{p})[0], nil
+		}
+
+		p, err := createCustomManager(opts).CreateProvider(name, model)
+		if err != nil {
+			return nil, err
+		}
+		return wrapProviders(opts, []provider.Provider{p})[0], nil
+	}
+}
+
+// getStandardProviderConfigs returns configurations for all standard providers.
+// Max tokens are overridden by --max-output-tokens and temperature by --temperature if set.
+func getStandardProviderConfigs(opts *options) []providerConfig {
+	configs := []providerConfig{
+		{
+			enabled:         opts.OpenAI.Enabled,
+			required:        opts.OpenAI.Required,
+			parallel:        opts.OpenAI.Parallel,
+			provType:        provider.ProviderTypeOpenAI,
+			name:            "OpenAI",
+			apiKey:          opts.OpenAI.APIKey,
+			model:           opts.aliases.Resolve("OpenAI", opts.OpenAI.Model),
+			maxTokens:       int(opts.OpenAI.MaxTokens),
+			temp:            opts.OpenAI.Temperature,
+			reasoningEffort: opts.OpenAI.ReasoningEffort,
+			timeouts:        opts.OpenAI.timeouts(opts),
+		},
+		{
+			enabled:   opts.Anthropic.Enabled,
+			required:  opts.Anthropic.Required,
+			parallel:  opts.Anthropic.Parallel,
+			provType:  provider.ProviderTypeAnthropic,
+			name:      "Anthropic",
+			apiKey:    opts.Anthropic.APIKey,
+			model:     opts.aliases.Resolve("Anthropic", opts.Anthropic.Model),
+			maxTokens: int(opts.Anthropic.MaxTokens),
+			timeouts:  opts.Anthropic.timeouts(opts),
+			temp:      0, // anthropic doesn't use temperature parameter
+			vertex: provider.Vertex{Enabled: opts.Anthropic.Backend == "vertex", Project: opts.Anthropic.Project,
+				Location: opts.Anthropic.Location},
+			bedrock: provider.Bedrock{Enabled: opts.Anthropic.Backend == "bedrock", Region: opts.Anthropic.Region},
+		},
+		{
+			enabled:   opts.Google.Enabled,
+			required:  opts.Google.Required,
+			parallel:  opts.Google.Parallel,
+			provType:  provider.ProviderTypeGoogle,
+			name:      "Google",
+			apiKey:    opts.Google.APIKey,
+			model:     opts.aliases.Resolve("Google", opts.Google.Model),
+			maxTokens: int(opts.Google.MaxTokens),
+			timeouts:  opts.Google.timeouts(opts),
+			temp:      0, // google doesn't use temperature parameter
+			vertex: provider.Vertex{Enabled: opts.Google.Vertex, Project: opts.Google.Project,
+				Location: opts.Google.Location},
+		},
+		{
+			enabled:   opts.DeepSeek.Enabled,
+			required:  opts.DeepSeek.Required,
+			parallel:  opts.DeepSeek.Parallel,
+			provType:  provider.ProviderTypeDeepSeek,
+			name:      "DeepSeek",
+			apiKey:    opts.DeepSeek.APIKey,
+			model:     opts.aliases.Resolve("DeepSeek", opts.DeepSeek.Model),
+			maxTokens: int(opts.DeepSeek.MaxTokens),
+			timeouts:  opts.DeepSeek.timeouts(opts),
+			temp:      opts.DeepSeek.Temperature,
+		},
+	}
+	if maxTokens := opts.maxOutputTokens(); maxTokens > 0 {
+		for i := range configs {
+			configs[i].maxTokens = maxTokens
+		}
+	}
+	if opts.TimeoutAuto {
+		own := []time.Duration{opts.OpenAI.TimeoutGeneration, opts.Anthropic.TimeoutGeneration,
+			opts.Google.TimeoutGeneration, opts.DeepSeek.TimeoutGeneration}
+		for i := range configs {
+			if own[i] <= 0 {
+				configs[i].timeouts.Generation = autoTimeout(opts, configs[i].maxTokens)
+			}
+		}
+	}
+	if opts.Temperature != nil {
+		for i := range configs {
+			// anthropic and google providers don't use temperature parameter
+			if configs[i].provType == provider.ProviderTypeOpenAI || configs[i].provType == provider.ProviderTypeDeepSeek {
+				configs[i].temp = *opts.Temperature
+			}
+		}
+	}
+	return configs
+}
+
+// configuredProviderNames returns lowercase names of enabled standard and custom providers
+func configuredProviderNames(opts *options) map[string]bool {
+	res := map[string]bool{}
+	for _, cfg := range getStandardProviderConfigs(opts) {
+		if cfg.enabled {
+			res[strings.ToLower(cfg.name)] = true
+		}
+	}
+	for name := range createCustomManager(opts).Models() {
+		res[strings.ToLower(name)] = true
+	}
+	return res
+}
+
+// anyProvidersEnabled checks if at least one provider is enabled in the options
+func anyProvidersEnabled(opts *options) bool {
+	// check standard providers
+	if opts.OpenAI.Enabled || opts.Anthropic.Enabled || opts.Google.Enabled || opts.DeepSeek.Enabled {
+		return true
+	}
+
+	// check if any custom providers are enabled
+	return createCustomManager(opts).AnyEnabled()
+}
+
+// ExecutionResult holds the structured result of executing a prompt
+type ExecutionResult struct {
+	Text        string                 // final text output (with headers for CLI display)
+	MixedText   string                 // raw mixed text without headers (for JSON)
+	Individual  string                 // individual provider results printed before mixed text, set with mix.show-individual
+	MixUsed     bool                   // whether mix mode was used
+	MixProvider string                 // provider that performed the mixing (if any)
+	MixStages   []mix.Stage            // stages of the mix provider chain, merge followed by refinements
+	Results     []provider.Result      // individual provider results
+	Review      *review.Report         // aggregated findings in review mode
+	Reasoning   bool                   // include reasoning traces of results in the output
+	Name        string                 // name of the run, set with --name
+	Tags        map[string]string      // tags of the run, set with --tag
+	Tokens      []tokens.Count         // prompt tokens per provider, set if counted
+	Prices      pricing.Table          // prices of models to estimate costs from token usage of providers
+	Provenance  *provenance.Provenance // provenance of the run, set with --sign
+	Err         error                  // error of the whole execution, set only if all providers failed
+	// consensus fields
+	ConsensusAttempted   bool   // whether consensus was attempted
+	ConsensusAchieved    bool   // whether consensus was achieved
+	ConsensusAttempts    int    // number of consensus attempts made
+	ConsensusExplanation string // judge's reasoning of the last consensus check
+}
+
+// executePrompt runs the prompt against the configured providers
+func executePrompt(ctx context.Context, opts *options, providers []provider.Provider) (*ExecutionResult, error) {
+	// create runner with all providers
+	r := withQuota(runner.New(providers...).WithOrder(runner.Order(opts.Order)), opts).WithRequired(requiredProviders(opts)...).
+		WithRawResponses(opts.JSONRaw)
+
+	// bound the whole run, each request is bounded by its own generation timeout as well
+	if opts.TimeoutTotal > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.TimeoutTotal)
+		defer cancel()
+	}
+
+	// show prompt in verbose mode
+	if verbosity(opts) >= verbosePrompt {
+		showVerbosePrompt(os.Stdout, *opts)
+	}
+
+	// show progress of provider requests on terminal, it is stopped before any output
+	var pd *progress.Display
+	if showProgress(opts) {
+		names := make([]string, 0, len(providers))
+		for _, p := range providers {
+			names = append(names, p.Name())
+		}
+		pd = progress.New(os.Stderr, names)
+		r.WithHooks(pd)
+		pd.Start()
+	}
+
+	// run the prompt, in first mode only the first successful response is used
+	run := r.Execute
+	if opts.First {
+		run = r.ExecuteFirst
+	}
+	res, err := run(ctx, opts.Prompt)
+	if pd != nil {
+		pd.Stop()
+	}
+	if err != nil {
+		return nil, timeoutError(ctx, opts, err)
+	}
+
+	// include reasoning traces in text output if requested
+	result := res.Text
+	if opts.ShowReasoning {
+		if text := formatWithReasoning(res.Results); text != "" {
+			result = text
+		}
+	}
+
+	// prepare execution result
+	execResult := &ExecutionResult{
+		Text:      result,
+		Results:   res.Results,
+		Reasoning: opts.ShowReasoning,
+		Name:      opts.Name,
+		Tags:      opts.Tags,
+		Tokens:    opts.tokens,
+		Prices:    loadPrices(),
+	}
+
+	// aggregate findings from all providers in review mode
+	if opts.Review {
+		report := review.Aggregate(execResult.Results)
+		report.Name, report.Tags = opts.Name, opts.Tags
+		for name, err := range report.Errors {
+			lgr.Printf("[WARN] failed to parse review findings from %s: %v", name, err)
+		}
+		execResult.Review = &report
+		execResult.Text = report.Format()
+	}
+
+	// handle mix mode if enabled
+	if opts.MixEnabled && len(providers) > 1 {
+		mixRequest := mix.Request{
+			Prompt:            opts.Prompt,
+			MixPrompt:         opts.MixPrompt,
+			MixProvider:       opts.MixProvider,
+			RefinePrompt:      opts.MixRefinePrompt,
+			MaxTokens:         int(opts.MixMaxTokens),
+			Style:             opts.MixStyle,
+			Capabilities:      opts.caps,
+			ConsensusEnabled:  opts.ConsensusEnabled,
+			ConsensusAttempts: opts.ConsensusAttempts,
+			Providers:         providers,
+			Results:           res.Results,
+		}
+
+		mixResult, err := processMixMode(ctx, mixRequest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mix results: %w", timeoutError(ctx, opts, err))
+		}
+		if mixResult.TextWithHeader != "" {
+			execResult.Text = mixResult.TextWithHeader
+			if opts.MixShowIndividual {
+				execResult.Individual = result
+			}
+			execResult.MixedText = mixResult.RawText
+			execResult.MixUsed = true
+			execResult.MixProvider = mixResult.MixProvider
+			execResult.MixStages = mixResult.Stages
+		}
+		// set consensus metadata
+		if opts.ConsensusEnabled {
+			execResult.ConsensusAttempted = true
+			execResult.ConsensusAchieved = mixResult.ConsensusAchieved
+			execResult.ConsensusAttempts = mixResult.ConsensusAttempts
+			execResult.ConsensusExplanation = mixResult.ConsensusExplanation
+		}
+	}
+
+	return execResult, nil
+}
+
+// failedResult makes the result of a failed run with errors of providers found in the error, reported in
+// structured output formats
+func failedResult(opts *options, err error) *ExecutionResult {
+	res := &ExecutionResult{Err: err, Tokens: opts.tokens}
+	for _, perr := range provider.Errors(err) {
+		res.Results = append(res.Results, provider.Result{Provider: perr.Provider, Error: perr})
+	}
+	return res
+}
+
+// timeoutError wraps errors caused by an exceeded deadline with a hint about the timeout to increase,
+// the whole run deadline if it is exceeded or the generation deadline of requests otherwise
+func timeoutError(ctx context.Context, opts *options, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("operation timed out after %s, try increasing the timeout with --timeout.total flag: %w",
+			opts.TimeoutTotal, err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		if opts.TimeoutAuto {
+			return fmt.Errorf("operation timed out, try increasing the timeout with --timeout.auto-per-1k flag: %w", err)
+		}
+		return fmt.Errorf("operation timed out, try increasing the timeout with --timeout.generation flag: %w", err)
+	}
+	return err
+}
+
+// formatWithReasoning formats successful results with reasoning traces in a separate section before the answer.
+// Returns empty string if none of the results has a reasoning trace.
+func formatWithReasoning(results []provider.Result) string {
+	hasReasoning := false
+	for _, r := range results {
+		if r.Error == nil && r.Reasoning != "" {
+			hasReasoning = true
+			break
+		}
+	}
+	if !hasReasoning {
+		return ""
+	}
+
+	successful := make([]provider.Result, 0, len(results))
+	for _, r := range results {
+		if r.Error != nil {
+			continue
+		}
+		if r.Reasoning != "" {
+			r.Text = "--- reasoning ---\n" + strings.TrimSpace(r.Reasoning) + "\n--- answer ---\n" + r.Text
+		}
+		successful = append(successful, r)
+	}
+	// single successful result is printed without provider header, failed results are not counted
+	if len(successful) == 1 {
+		return successful[0].Text
+	}
+	parts := make([]string, 0, len(successful))
+	for _, r := range successful {
+		parts = append(parts, r.Format())
+	}
+	return strings.Join(parts, "\n")
+}
+
+// processMixMode handles mixing results from multiple providers
+func processMixMode(ctx context.Context, req mix.Request) (*mix.Response, error) {
+	// create mix manager
+	mixer := mix.New(lgr.Default())
+
+	// process the mix request
+	return mixer.Process(ctx, req)
+}
+
+// validatePromptVariants checks prompt variants options, the matrix of answers can't be mixed, aggregated
+// or served, and each variant gets the same prompt for all providers
+func validatePromptVariants(opts *options) error {
+	if opts.PromptVariants == "" {
+		if opts.PromptVariantsJudge != "" {
+			return fmt.Errorf("prompt variants judge requires prompt variants file, set --prompt-variants")
+		}
+		return nil
+	}
+	switch {
+	case opts.MixEnabled || opts.Review || opts.First:
+		return fmt.Errorf("prompt variants can't be combined with mix, review or first modes")
+	case opts.serverMode():
+		return fmt.Errorf("prompt variants are not supported in server modes")
+	case opts.OutputFormat != "" && opts.OutputFormat != "text":
+		return fmt.Errorf("prompt variants support only text and json output, got %s", opts.OutputFormat)
+	case len(opts.Ctx.ProviderWrappers) > 0:
+		return fmt.Errorf("prompt variants can't be combined with per-provider context wrappers")
+	case opts.Tokens.Count || opts.Tokens.Max > 0:
+		return fmt.Errorf("prompt token counting is not supported with prompt variants")
+	}
+	if err := provider.ValidateSpec(opts.PromptVariantsJudge); err != nil {
+		return fmt.Errorf("invalid prompt variants judge %q: %w", opts.PromptVariantsJudge, err)
+	}
+	return nil
+}
+
+// runPromptVariants sends each prompt variant to all providers and outputs the matrix of answers, scored by
+// the judge provider if set. The prompt and piped input are optional, they are added to each variant, as well
+// as files and git context.
+func runPromptVariants(ctx context.Context, opts *options) error {
+	spec, err := compare.Load(opts.PromptVariants)
+	if err != nil {
+		return err
+	}
+	if opts.Prompt != "" || opts.Edit || stdinPiped() {
+		if err := getPrompt(opts); err != nil {
+			return fmt.Errorf("failed to get prompt: %w", err)
+		}
+	}
+	recordHistory(opts)
+	wrapper, err := files.ParseWrapper(opts.Ctx.Wrapper)
+	if err != nil {
+		return err
+	}
+
+	providers, err := initializeProviders(ctx, opts)
+	if err != nil {
+		return err
+	}
+	var judge provider.Provider
+	if opts.PromptVariantsJudge != "" {
+		if judge = provider.FindProvider(opts.PromptVariantsJudge, providers, opts.caps); judge == nil {
+			return fmt.Errorf("no enabled provider matches prompt variants judge %s", opts.PromptVariantsJudge)
+		}
+	}
+
+	if opts.TimeoutTotal > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.TimeoutTotal)
+		defer cancel()
+	}
+	st := time.Now()
+	r := withQuota(runner.New(providers...).WithOrder(runner.Order(opts.Order)), opts)
+	m, err := compare.Run(ctx, r, spec.Variants, func(ctx context.Context, v compare.Variant) (string, error) {
+		vopts := *opts
+		vopts.Prompt = v.Prompt
+		if opts.Prompt != "" {
+			vopts.Prompt = prompt.CombineWithInput(v.Prompt, opts.Prompt)
+		}
+		lgr.Printf("[DEBUG] running prompt variant %s", v.Name)
+		return buildPrompt(ctx, &vopts, wrapper)
+	})
+	if err != nil {
+		return timeoutError(ctx, opts, err)
+	}
+	if judge != nil {
+		if err := compare.Judge(ctx, judge, spec.Criteria, m); err != nil {
+			lgr.Printf("[WARN] failed to score answers to prompt variants: %v", err)
+		}
+	}
+
+	result := &ExecutionResult{Text: m.Format(), Name: opts.Name, Tags: opts.Tags}
+	for _, row := range m.Rows {
+		for _, res := range row.Results {
+			res.Provider = fmt.Sprintf("%s [%s]", res.Provider, row.Variant.Name)
+			result.Results = append(result.Results, res)
+		}
+	}
+	switch {
+	case opts.JSON:
+		err = writeVariantsJSON(os.Stdout, m, result)
+	case opts.Quiet:
+		fmt.Print(m.Table())
+	default:
+		fmt.Print(result.Text)
+	}
+	if err != nil {
+		return err
+	}
+	onComplete(ctx, opts, result, time.Since(st))
+	return nil
 }
 
-// initializeProviders creates provider instances from the options
-func initializeProviders(opts *options) ([]provider.Provider, error) {
-	// check if any providers are enabled
-	if !anyProvidersEnabled(opts) {
-		return nil, fmt.Errorf("no providers enabled. Use --<provider>.enabled flag to enable at least one provider (e.g., --openai.enabled)")
+// writeVariantsJSON writes the matrix of answers to prompt variants as JSON
+func writeVariantsJSON(w io.Writer, m *compare.Matrix, result *ExecutionResult) error {
+	type Answer struct {
+		Provider  string  `json:"provider"`
+		Text      string  `json:"text,omitempty"`
+		Error     string  `json:"error,omitempty"`
+		Score     float64 `json:"score,omitempty"` // judge's score from 1 to 10, set if judged
+		Model     string  `json:"model,omitempty"`
+		LatencyMS int64   `json:"latency_ms,omitempty"`
+	}
+	type Variant struct {
+		Name      string   `json:"name"`
+		Prompt    string   `json:"prompt"`
+		Responses []Answer `json:"responses"`
+	}
+	type JSONOutput struct {
+		Name      string            `json:"name,omitempty"`
+		Tags      map[string]string `json:"tags,omitempty"`
+		Providers []string          `json:"providers"`
+		Variants  []Variant         `json:"variants"`
+		Judged    bool              `json:"judged"`
+		Timestamp string            `json:"timestamp"`
 	}
 
-	providers := make([]provider.Provider, 0, 4) // pre-allocate for 4 providers (3 standard + 1 custom)
-	providerErrors := make([]string, 0)
+	output := JSONOutput{Name: result.Name, Tags: result.Tags, Providers: m.Providers, Judged: m.Judged(),
+		Timestamp: time.Now().Format(time.RFC3339)}
+	for _, row := range m.Rows {
+		v := Variant{Name: row.Variant.Name, Prompt: row.Variant.Prompt, Responses: make([]Answer, 0, len(row.Results))}
+		for _, r := range row.Results {
+			a := Answer{Provider: r.Provider, Text: r.Text, Score: row.Scores[r.Provider], Model: r.Model,
+				LatencyMS: r.Latency.Milliseconds()}
+			if r.Error != nil {
+				a.Error = r.Error.Error()
+			}
+			v.Responses = append(v.Responses, a)
+		}
+		output.Variants = append(output.Variants, v)
+	}
 
-	// initialize standard providers
-	standardProviders := getStandardProviderConfigs(opts)
-	for _, config := range standardProviders {
-		if !config.enabled {
-			continue
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(output); err != nil {
+		return fmt.Errorf("error encoding JSON output: %w", err)
+	}
+	return nil
+}
+
+// showVerbosePrompt displays the prompt text that will be sent to the models
+func showVerbosePrompt(w io.Writer, opts options) {
+	fmt.Fprintln(w, "=== Prompt sent to models ===")
+	fmt.Fprintln(w, opts.Prompt)
+	fmt.Fprintln(w, "=============================")
+	fmt.Fprintln(w)
+}
+
+// showProgress checks if progress display is enabled, it is shown only on terminal and not with debug logs
+func showProgress(opts *options) bool {
+	if opts.NoProgress || opts.Quiet || verbosity(opts) >= verboseDebug {
+		return false
+	}
+	stat, err := os.Stderr.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// getPrompt handles reading the prompt from stdin (piped or interactive) or command line
+func getPrompt(opts *options) error {
+	if stdinPiped() {
+		if opts.Edit {
+			return fmt.Errorf("--edit can't be used with piped input")
+		}
+		// handle piped input
+		stdinContent, err := readFromStdin()
+		if err != nil {
+			return err
 		}
 
-		p, err := provider.CreateProvider(config.provType, provider.Options{
-			APIKey:          config.apiKey,
-			Model:           config.model,
-			Enabled:         true,
-			MaxTokens:       config.maxTokens,
-			Temperature:     config.temp,
-			ReasoningEffort: config.reasoningEffort,
-		})
+		// piped input is kept apart from a template prompt and appended after expansion, so untrusted input
+		// can't pull files into the prompt
+		if opts.Template {
+			opts.input = stdinContent
+			return nil
+		}
+
+		// combine with existing prompt or use as prompt
+		opts.Prompt = prompt.CombineWithInput(opts.Prompt, stdinContent)
+
+	} else if (opts.Prompt == "" && opts.input == "") || opts.Edit {
+		// no data piped, no prompt provided or editing requested, interactive mode
+		promptText, err := composePrompt(opts.Prompt)
 		if err != nil {
-			lgr.Printf("[WARN] %s provider failed to initialize: %v", config.name, err)
-			providerErrors = append(providerErrors, fmt.Sprintf("%s: %v", config.name, err))
+			return fmt.Errorf("error reading prompt: %w", err)
+		}
+		opts.Prompt = promptText
+	}
+	return nil
+}
+
+// stdoutTerminal checks if output is written to a terminal
+func stdoutTerminal() bool {
+	stat, err := os.Stdout.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// stdinPiped checks if input is coming from a pipe
+func stdinPiped() bool {
+	stat, err := os.Stdin.Stat()
+	if err != nil {
+		// if we can't stat stdin, assume it's not piped
+		return false
+	}
+	return (stat.Mode() & os.ModeCharDevice) == 0
+}
+
+// applyPromptFile loads the prompt from --prompt-file and re-parses the arguments with options from its
+// front-matter put after config file options and before the command line ones, so options given on the
+// command line override them. List options, like --file, are combined. The original arguments are kept for history.
+func applyPromptFile(opts *options, args []string) error {
+	if opts.Prompt != "" {
+		return fmt.Errorf("--prompt-file can't be combined with --prompt")
+	}
+	pf, err := prompt.LoadFile(opts.PromptFile)
+	if err != nil {
+		return err
+	}
+	fileOpts, err := promptFileOpts(pf, opts.PromptFile, opts.defaults, args)
+	if err != nil {
+		return err
+	}
+	fileOpts.args = opts.args
+	*opts = *fileOpts
+	return nil
+}
+
+// promptFileOpts returns options of the prompt file: options of config files, front-matter and command line
+// arguments, in order of increasing priority, with the prompt of the file. Template arguments declared in
+// the front-matter and not set with --prompt-arg are empty.
+func promptFileOpts(pf prompt.File, path string, defaults, args []string) (*options, error) {
+	for _, arg := range pf.Args {
+		name, _, _ := strings.Cut(arg, "=")
+		if !promptFileOption(strings.TrimPrefix(name, "--")) {
+			return nil, fmt.Errorf("%s can't be set in prompt file front-matter, only options of providers, files, "+
+				"mix and output are allowed", name)
+		}
+	}
+
+	res := &options{}
+	if _, err := flags.NewParser(res, flags.PassDoubleDash).ParseArgs(slices.Concat(defaults, pf.Args, args)); err != nil {
+		return nil, fmt.Errorf("invalid options in prompt file %s: %w", path, err)
+	}
+	res.defaults = defaults
+	res.Prompt = pf.Text
+	for name := range pf.Arguments {
+		if _, ok := res.PromptArgs[name]; !ok {
+			if res.PromptArgs == nil {
+				res.PromptArgs = map[string]string{}
+			}
+			res.PromptArgs[name] = ""
+		}
+	}
+	return res, nil
+}
+
+// promptTemplates returns prompt files of the library as MCP prompts. They are rendered the same way as
+// prompts of --prompt-file, with files and git context set by their front-matter and options of the server.
+func promptTemplates(opts *options) ([]mcp.PromptTemplate, error) {
+	dir, err := promptLibraryPath(opts.MCP.Prompts)
+	if err != nil {
+		return nil, err
+	}
+	lib, err := prompt.LoadLibrary(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]mcp.PromptTemplate, 0, len(lib))
+	for _, t := range lib {
+		fileOpts, err := promptFileOpts(t.File, filepath.Join(dir, t.Name+".md"), opts.defaults, opts.args)
+		if err != nil {
+			return nil, err
+		}
+		if len(t.Arguments) > 0 && !fileOpts.Template {
+			lgr.Printf("[WARN] arguments of prompt %s are not used, its front-matter doesn't set template", t.Name)
+		}
+		fileOpts.dir, fileOpts.aliases = opts.dir, opts.aliases
+		res = append(res, mcp.PromptTemplate{Name: t.Name, Description: t.Description, Arguments: t.Arguments,
+			Render: func(ctx context.Context, args map[string]string) (string, error) {
+				renderOpts := *fileOpts
+				renderOpts.PromptArgs = args
+				wrapper, err := files.ParseWrapper(renderOpts.Ctx.Wrapper)
+				if err != nil {
+					return "", err
+				}
+				return buildPrompt(ctx, &renderOpts, wrapper)
+			}})
+	}
+	return res, nil
+}
+
+// promptLibraryPath returns the directory of prompt files exposed as MCP prompts, ~/.mpt/prompts by default
+func promptLibraryPath(dir string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find prompt library: %w", err)
+	}
+	return filepath.Join(home, ".mpt", "prompts"), nil
+}
+
+// promptFileOptions are options allowed in prompt file front-matter. Prompt files are shared, so options
+// running commands, writing files, or sending prompts and keys to other endpoints are not allowed.
+var promptFileOptions = []string{
+	"file", "exclude", "max-file-size", "template", "ecosystem", "only", "skip", "first",
+	"mix", "mix.provider", "mix.prompt", "mix.preset", "mix.refine-prompt", "mix.show-individual", "mix.max-tokens", "mix.style",
+	"consensus", "consensus.attempts",
+	"max-output-tokens", "max-tokens", "temperature", "stop", "show-reasoning", "auto-continue", "timeout.generation", "timeout.total",
+	"timeout.auto", "timeout.auto-base", "timeout.auto-per-1k",
+	"json", "json.raw", "output.format", "render", "color", "theme", "quiet", "review", "name", "tag", "normalize", "format",
+	"max-words", "lint", "lint.fail",
+	"repair.markdown",
+	"git.diff", "git.branch", "context.position", "context.wrapper",
+	"files.relevant", "files.top-k", "files.min-score", "files.changed-since", "budget.files", "budget.git", "budget.stdin",
+}
+
+// promptFileProviderOptions are options of providers allowed in prompt file front-matter
+var promptFileProviderOptions = []string{"enabled", "model", "temperature", "max-tokens", "reasoning-effort", "instructions"}
+
+// promptFileOption checks if the long option name is allowed in prompt file front-matter
+func promptFileOption(name string) bool {
+	if slices.Contains(promptFileOptions, name) {
+		return true
+	}
+	prov, opt, ok := strings.Cut(name, ".")
+	if !ok {
+		return false
+	}
+	switch prov {
+	case "openai", "anthropic", "google", "deepseek":
+		return slices.Contains(promptFileProviderOptions, opt)
+	}
+	return false
+}
+
+// systemConfigPath returns the system config file, shared by all users. It is $MPT_SYSTEM_CONFIG if set,
+// %ProgramData%\mpt\config.yml on windows and /etc/mpt/config.yml elsewhere.
+func systemConfigPath() string {
+	if path := os.Getenv("MPT_SYSTEM_CONFIG"); path != "" {
+		return path
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "mpt", "config.yml")
+	}
+	return "/etc/mpt/config.yml"
+}
+
+// userConfigPath returns the user config file, $MPT_CONFIG if set or ~/.mpt/config.yml.
+// Empty path is returned if home directory is unknown.
+func userConfigPath() string {
+	if path := os.Getenv("MPT_CONFIG"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".mpt", "config.yml")
+}
+
+// loadConfigFiles loads options from config files, in order of increasing priority, and returns them as
+// command line arguments to put before the actual ones. Missing files are skipped. Options of files are
+// merged before converting them to arguments, so a later file overrides any option of an earlier one,
+// e.g. "enabled: false" of the user config turns off the provider enabled by the system config. Options set
+// with environment variables are dropped, so the environment overrides config files, same as the command line.
+func loadConfigFiles(p *flags.Parser, paths ...string) ([]string, error) {
+	merged := map[string]any{}
+	for _, path := range paths {
+		if path == "" {
 			continue
 		}
+		opts, err := config.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		args, err := config.OptionArgs(opts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		for _, arg := range args {
+			if name, _, _ := strings.Cut(arg, "="); name == "--prompt-file" || name == "--prompt" {
+				return nil, fmt.Errorf("%s can't be set in config file %s", name, path)
+			}
+		}
+		if _, err := flags.NewParser(&options{}, flags.PassDoubleDash).ParseArgs(args); err != nil {
+			return nil, fmt.Errorf("invalid options in config file %s: %w", path, err)
+		}
+		config.Merge(merged, opts)
+	}
+	res, err := config.OptionArgs(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	// drop options set in environment
+	filtered := res[:0]
+	for _, arg := range res {
+		name, _, _ := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if opt := p.FindOptionByLongName(name); opt != nil && opt.EnvKeyWithNamespace() != "" {
+			if _, ok := os.LookupEnv(opt.EnvKeyWithNamespace()); ok {
+				continue
+			}
+		}
+		filtered = append(filtered, arg)
+	}
+	return filtered, nil
+}
+
+// composePrompt gets the prompt interactively, in the editor set by $VISUAL or $EDITOR pre-filled with
+// the initial text, or with the built-in multi-line reader terminated by Ctrl-D if no editor is set.
+// The initial text is kept if nothing is entered in the built-in reader.
+func composePrompt(initial string) (string, error) {
+	editor := strings.TrimSpace(os.Getenv("VISUAL"))
+	if editor == "" {
+		editor = strings.TrimSpace(os.Getenv("EDITOR"))
+	}
+	if editor != "" {
+		return editPrompt(editor, initial)
+	}
+
+	eof := "Ctrl-D"
+	if runtime.GOOS == "windows" {
+		eof = "Ctrl-Z and Enter"
+	}
+	if initial != "" {
+		fmt.Printf("Current prompt:\n%s\n\nEnter new prompt, finish with %s (empty keeps the current one):\n", initial, eof)
+	} else {
+		fmt.Printf("Enter prompt, finish with %s:\n", eof)
+	}
+	text, err := readFromStdin()
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		return initial, nil
+	}
+	return text, nil
+}
+
+// editPrompt opens the editor with a temporary file pre-filled with the text and returns the edited text.
+// The editor command can have arguments, e.g. "code --wait".
+func editPrompt(editor, text string) (string, error) {
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		return "", errors.New("editor is not set")
+	}
+	f, err := os.CreateTemp("", "mpt-prompt-*.md")
+	if err != nil {
+		return "", fmt.Errorf("failed to create prompt file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(text); err != nil {
+		_ = f.Close()
+		return "", fmt.Errorf("failed to write prompt file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to write prompt file: %w", err)
+	}
+
+	cmd := exec.Command(args[0], append(args[1:], f.Name())...) //nolint:gosec // editor is set by the user
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor %q failed: %w", editor, err)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func setupLog(level int, format string, secs ...string) {
+	logOpts := []lgr.Option{lgr.Out(io.Discard), lgr.Err(io.Discard)} // default to discard
+	if level >= verboseDebug {
+		logOpts = []lgr.Option{lgr.Debug, lgr.Msec, lgr.LevelBraces, lgr.StackTraceOnError, lgr.Out(os.Stderr)}
+	}
+	if level >= verboseRequests {
+		logOpts = append(logOpts, lgr.Trace)
+	}
+	if level >= verboseDebug && format == "json" {
+		// slog handler bypasses secrets masking of lgr, so secrets are masked by the writer
+		handler := slog.NewJSONHandler(&secretsWriter{w: os.Stderr, secrets: secs},
+			&slog.HandlerOptions{Level: slogLevelTrace, ReplaceAttr: slogTraceLevel})
+		logOpts = append(logOpts, lgr.SlogHandler(handler))
+	}
+	if len(secs) > 0 {
+		logOpts = append(logOpts, lgr.Secret(secs...))
+	}
+	lgr.SetupStdLogger(logOpts...)
+	lgr.Setup(logOpts...)
+	provider.EnableRequestTrace(level >= verboseRequests, func(data []byte) []byte { return maskSecrets(data, secs) })
+	files.EnableTrace(level >= verboseRequests)
+}
+
+// verbosity returns the verbosity level set by repeated -v flag, --dbg sets verboseDebug level
+func verbosity(opts *options) int {
+	level := len(opts.Verbose)
+	if opts.Debug {
+		level = max(level, verboseDebug)
+	}
+	return level
+}
+
+// slogLevelTrace is the slog level of lgr TRACE messages
+const slogLevelTrace = slog.LevelDebug - 4
+
+// slogTraceLevel names slog level of lgr TRACE messages in json logs, shown as DEBUG-4 otherwise
+func slogTraceLevel(_ []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && a.Value.Any() == slogLevelTrace {
+		a.Value = slog.StringValue("TRACE")
+	}
+	return a
+}
+
+// secretsWriter masks secrets in written data
+type secretsWriter struct {
+	w       io.Writer
+	secrets []string
+}
+
+// Write replaces secrets in p and writes the result to the underlying writer
+func (s *secretsWriter) Write(p []byte) (int, error) {
+	if _, err := s.w.Write(maskSecrets(p, s.secrets)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// maskSecrets replaces all secrets in data with a mask, the same way lgr masks secrets
+func maskSecrets(data []byte, secrets []string) []byte {
+	for _, secret := range secrets {
+		if secret != "" {
+			data = bytes.ReplaceAll(data, []byte(secret), []byte("******"))
+		}
+	}
+	return data
+}
+
+// readFromStdin reads content from stdin and returns it as a trimmed string. The whole input is read as is,
+// without splitting into lines, so very long lines like minified bundles and non-text bytes are kept intact.
+func readFromStdin() (string, error) {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("error reading from stdin: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// prepareRerun handles arguments of rerun command, "rerun [--last | <history-id>] [--list] [--with <options>...]".
+// It returns the history entry to re-run with its arguments extended by options after --with. File patterns
+// are resolved against the directory of the entry by the caller, so they match the same way.
+// With --list it writes history entries to out and returns nil entry.
+func prepareRerun(args []string, out io.Writer) (*history.Entry, []string, error) {
+	var with []string
+	for i, arg := range args {
+		if arg == "--with" {
+			args, with = args[:i], args[i+1:]
+			break
+		}
+	}
 
-		providers = append(providers, p)
-		lgr.Printf("[DEBUG] added %s provider, model: %s", config.name, config.model)
+	var ropts struct {
+		Last        bool   `long:"last" description:"re-run the last invocation (default)"`
+		List        bool   `long:"list" description:"list invocations in history"`
+		HistoryFile string `long:"history.file" env:"HISTORY_FILE" description:"history file (default: ~/.mpt/history.jsonl)"`
+	}
+	p := flags.NewParser(&ropts, flags.PrintErrors|flags.PassDoubleDash|flags.HelpFlag)
+	p.Usage = "rerun [--last | <history-id>] [--list] [--with <options>...]"
+	rest, err := p.ParseArgs(args)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// initialize multiple custom providers (handles legacy custom too)
-	customProviders, customErrors := createCustomManager(opts).InitializeProviders()
-	providers = append(providers, customProviders...)
-	providerErrors = append(providerErrors, customErrors...)
+	path, err := historyPath(ropts.HistoryFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	store := history.New(path, 0)
 
-	// check if any providers were successfully initialized
-	if len(providers) == 0 {
-		return nil, fmt.Errorf("all enabled providers failed to initialize:\n%s", strings.Join(providerErrors, "\n"))
+	if ropts.List {
+		entries, err := store.List()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, e := range entries {
+			summary := historySummary(e.Prompt)
+			if e.Name != "" {
+				summary = "[" + e.Name + "] " + summary
+			}
+			fmt.Fprintf(out, "%d\t%s\t%s\t%s\n", e.ID, e.Time.Format("2006-01-02 15:04"), summary, strings.Join(e.Args, " "))
+		}
+		return nil, nil, nil
 	}
 
-	// wrap providers with retry logic if configured
-	if opts.Retry.Attempts > 1 {
-		retryOpts := provider.RetryOptions{
-			Attempts: opts.Retry.Attempts,
-			Delay:    opts.Retry.Delay,
-			MaxDelay: opts.Retry.MaxDelay,
-			Factor:   opts.Retry.Factor,
+	var entry history.Entry
+	switch {
+	case len(rest) > 1:
+		return nil, nil, fmt.Errorf("rerun accepts a single history id, got %q", rest)
+	case len(rest) == 1 && ropts.Last:
+		return nil, nil, fmt.Errorf("--last can't be combined with history id")
+	case len(rest) == 1:
+		id, err := strconv.Atoi(rest[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid history id %q", rest[0])
+		}
+		if entry, err = store.Get(id); err != nil {
+			return nil, nil, err
+		}
+	default:
+		if entry, err = store.Last(); err != nil {
+			return nil, nil, err
 		}
-		providers = provider.WrapProvidersWithRetry(providers, retryOpts)
-		lgr.Printf("[INFO] wrapped %d providers with retry logic (attempts=%d)", len(providers), opts.Retry.Attempts)
 	}
 
-	// if mix mode is enabled, validate the configuration
-	if opts.MixEnabled && len(providers) < 2 {
-		lgr.Printf("[WARN] mix mode enabled but only one provider is active, mix feature will not be used")
+	if entry.Dir != "" {
+		if info, err := os.Stat(entry.Dir); err != nil || !info.IsDir() {
+			return nil, nil, fmt.Errorf("directory %s of history entry %d is not accessible", entry.Dir, entry.ID)
+		}
 	}
+	return &entry, append(slices.Clone(entry.Args), with...), nil
+}
 
-	return providers, nil
+// recordHistory records the invocation to history, so it can be re-run with rerun command. Secrets in the
+// prompt and piped input are redacted, and both are truncated to --history.max-input bytes.
+// Failures are only logged, as history is not essential for the run.
+func recordHistory(opts *options) {
+	if opts.History.Disable || opts.args == nil {
+		return
+	}
+	path, err := historyPath(opts.History.File)
+	if err != nil {
+		lgr.Printf("[WARN] %v", err)
+		return
+	}
+	dir := opts.dir
+	if dir == "" {
+		if dir, err = os.Getwd(); err != nil {
+			lgr.Printf("[WARN] failed to get working directory for history: %v", err)
+			return
+		}
+	}
+	known := collectSecrets(opts)
+	prompt, promptCut := historyText(secrets.Redact(opts.Prompt, known...), opts.History.MaxInput)
+	input, inputCut := historyText(secrets.Redact(opts.input, known...), opts.History.MaxInput)
+	entry, err := history.New(path, opts.History.Max).Add(history.Entry{Dir: dir, Args: historyArgs(opts.args), Prompt: prompt,
+		Input: input, Truncated: promptCut || inputCut, Name: opts.Name, Tags: opts.Tags})
+	if err != nil {
+		lgr.Printf("[WARN] failed to record history: %v", err)
+		return
+	}
+	lgr.Printf("[DEBUG] recorded history entry %d", entry.ID)
 }
 
-// getStandardProviderConfigs returns configurations for all standard providers
-func getStandardProviderConfigs(opts *options) []providerConfig {
-	return []providerConfig{
-		{
-			enabled:         opts.OpenAI.Enabled,
-			provType:        provider.ProviderTypeOpenAI,
-			name:            "OpenAI",
-			apiKey:          opts.OpenAI.APIKey,
-			model:           opts.OpenAI.Model,
-			maxTokens:       int(opts.OpenAI.MaxTokens),
-			temp:            opts.OpenAI.Temperature,
-			reasoningEffort: opts.OpenAI.ReasoningEffort,
-		},
-		{
-			enabled:   opts.Anthropic.Enabled,
-			provType:  provider.ProviderTypeAnthropic,
-			name:      "Anthropic",
-			apiKey:    opts.Anthropic.APIKey,
-			model:     opts.Anthropic.Model,
-			maxTokens: int(opts.Anthropic.MaxTokens),
-			temp:      0, // anthropic doesn't use temperature parameter
-		},
-		{
-			enabled:   opts.Google.Enabled,
-			provType:  provider.ProviderTypeGoogle,
-			name:      "Google",
-			apiKey:    opts.Google.APIKey,
-			model:     opts.Google.Model,
-			maxTokens: int(opts.Google.MaxTokens),
-			temp:      0, // google doesn't use temperature parameter
-		},
+// historyText returns the text cut to max bytes, on a rune boundary, and whether it was cut.
+// Not positive max keeps the text as is.
+func historyText(text string, maxBytes int) (string, bool) {
+	if maxBytes <= 0 || len(text) <= maxBytes {
+		return text, false
 	}
+	return strings.ToValidUTF8(text[:maxBytes], ""), true
 }
 
-// anyProvidersEnabled checks if at least one provider is enabled in the options
-func anyProvidersEnabled(opts *options) bool {
-	// check standard providers
-	if opts.OpenAI.Enabled || opts.Anthropic.Enabled || opts.Google.Enabled {
-		return true
+// historyPath returns the history file, ~/.mpt/history.jsonl if not set
+func historyPath(file string) (string, error) {
+	if file != "" {
+		return file, nil
 	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find history file: %w", err)
+	}
+	return filepath.Join(home, ".mpt", "history.jsonl"), nil
+}
 
-	// check if any custom providers are enabled
-	return createCustomManager(opts).AnyEnabled()
+// historyArgs returns command line arguments recorded to history. The prompt is recorded separately,
+// and API keys are dropped to keep them out of the history file, re-run uses keys from environment.
+// References to keys in secret stores, like "keyring:openai", are kept. The --edit flag is dropped too, as the recorded prompt is already edited.
+func historyArgs(args []string) []string {
+	res := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			res = append(res, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		isKey := strings.HasPrefix(name, "--") && strings.HasSuffix(name, "api-key")
+		switch {
+		case isKey && hasValue && secrets.IsReference(value):
+			res = append(res, arg)
+		case isKey && !hasValue && i+1 < len(args) && secrets.IsReference(args[i+1]):
+			res = append(res, arg, args[i+1])
+			i++
+		case name == "--prompt" || (strings.HasPrefix(name, "--") && strings.HasSuffix(name, "api-key")):
+			if !hasValue {
+				i++ // value is the next argument
+			}
+		case arg == "-p":
+			i++
+		case arg == "--edit":
+		case strings.HasPrefix(arg, "-p"): // short prompt flag with attached value
+		case strings.HasPrefix(name, "--") && hasValue:
+			res = append(res, name+"="+dropAPIKey(value))
+		default:
+			res = append(res, dropAPIKey(arg))
+		}
+	}
+	return res
 }
 
-// ExecutionResult holds the structured result of executing a prompt
-type ExecutionResult struct {
-	Text        string            // final text output (with headers for CLI display)
-	MixedText   string            // raw mixed text without headers (for JSON)
-	MixUsed     bool              // whether mix mode was used
-	MixProvider string            // provider that performed the mixing (if any)
-	Results     []provider.Result // individual provider results
-	// consensus fields
-	ConsensusAttempted bool // whether consensus was attempted
-	ConsensusAchieved  bool // whether consensus was achieved
-	ConsensusAttempts  int  // number of consensus attempts made
+// dropAPIKey removes api-key pair from custom provider spec, like "id:url=...,api-key=xxx", unless it is a secret store reference
+func dropAPIKey(spec string) string {
+	if !strings.Contains(spec, "api-key=") {
+		return spec
+	}
+	id, pairs, hasID := "", spec, false
+	if i := strings.Index(spec, ":"); i >= 0 && !strings.Contains(spec[:i], "=") {
+		id, pairs, hasID = spec[:i+1], spec[i+1:], true
+	}
+	kept := make([]string, 0, strings.Count(pairs, ",")+1)
+	for _, pair := range strings.Split(pairs, ",") {
+		if p := strings.TrimSpace(pair); !strings.HasPrefix(p, "api-key=") || secrets.IsReference(strings.TrimPrefix(p, "api-key=")) {
+			kept = append(kept, pair)
+		}
+	}
+	if hasID {
+		return id + strings.Join(kept, ",")
+	}
+	return strings.Join(kept, ",")
 }
 
-// executePrompt runs the prompt against the configured providers
-func executePrompt(ctx context.Context, opts *options, providers []provider.Provider) (*ExecutionResult, error) {
-	// create runner with all providers
-	r := runner.New(providers...)
+// historySummary returns the first line of the prompt, cut to 60 characters
+func historySummary(prompt string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(prompt), "\n")
+	if r := []rune(line); len(r) > 60 {
+		return string(r[:60]) + "..."
+	}
+	return line
+}
 
-	// create timeout context as a child of the passed ctx (which handles interrupts)
-	timeoutCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+// execOnComplete runs the shell command with the JSON result on stdin, does nothing if the command is empty.
+// Output of the command goes to stderr, so it is not mixed with the results. The command is not canceled
+// with the run context, so it runs even if the run was interrupted or timed out, limited by its own timeout.
+func execOnComplete(ctx context.Context, command string, result *ExecutionResult) error {
+	if command == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), execOnCompleteTimeout)
 	defer cancel()
-
-	// show prompt in verbose mode
-	if opts.Verbose {
-		showVerbosePrompt(os.Stdout, *opts)
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, result); err != nil {
+		return err
 	}
 
-	// run the prompt
-	result, err := r.Run(timeoutCtx, opts.Prompt)
-	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			return nil, fmt.Errorf("operation timed out after %s, try increasing the timeout with -t flag", opts.Timeout)
-		}
-		return nil, err
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
 	}
-
-	// prepare execution result
-	execResult := &ExecutionResult{
-		Text:    result,
-		Results: r.GetResults(),
+	cmd := exec.CommandContext(ctx, shell, flag, command) //nolint:gosec // command is provided by the user
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = &buf, os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("exec-on-complete command failed: %w", err)
 	}
+	return nil
+}
 
-	// handle mix mode if enabled
-	if opts.MixEnabled && len(providers) > 1 {
-		mixRequest := mix.Request{
-			Prompt:            opts.Prompt,
-			MixPrompt:         opts.MixPrompt,
-			MixProvider:       opts.MixProvider,
-			ConsensusEnabled:  opts.ConsensusEnabled,
-			ConsensusAttempts: opts.ConsensusAttempts,
-			Providers:         providers,
-			Results:           r.GetResults(),
-		}
+// sendNotification sends a desktop notification with elapsed time and summary of provider results.
+// It doesn't use the run context, so the notification is sent even if the run was interrupted or timed out.
+// Failures are only logged, as the notification is not essential.
+func sendNotification(result *ExecutionResult, elapsed time.Duration) {
+	title := "MPT completed"
+	if result.Err != nil {
+		title = "MPT failed"
+	}
+	if result.Name != "" {
+		title += ": " + result.Name
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	if err := notify.Send(ctx, title, notificationMessage(result, elapsed)); err != nil {
+		lgr.Printf("[WARN] %v", err)
+	}
+}
 
-		mixResult, err := processMixMode(timeoutCtx, mixRequest)
-		if err != nil {
-			return nil, fmt.Errorf("failed to mix results: %w", err)
-		}
-		if mixResult.TextWithHeader != "" {
-			execResult.Text = mixResult.TextWithHeader
-			execResult.MixedText = mixResult.RawText
-			execResult.MixUsed = true
-			execResult.MixProvider = mixResult.MixProvider
-		}
-		// set consensus metadata
-		if opts.ConsensusEnabled {
-			execResult.ConsensusAttempted = true
-			execResult.ConsensusAchieved = mixResult.ConsensusAchieved
-			execResult.ConsensusAttempts = mixResult.ConsensusAttempts
+// notificationMessage makes a summary of the run with elapsed time and success or failure of each provider
+func notificationMessage(result *ExecutionResult, elapsed time.Duration) string {
+	parts := make([]string, 0, len(result.Results))
+	for _, r := range result.Results {
+		if r.Error != nil {
+			parts = append(parts, r.Provider+" failed")
+			continue
 		}
+		parts = append(parts, r.Provider+" ok")
+	}
+	msg := "finished in " + elapsed.Round(time.Second).String()
+	if len(parts) > 0 {
+		msg += ": " + strings.Join(parts, ", ")
 	}
+	if result.Err != nil && len(parts) == 0 {
+		msg += ": " + result.Err.Error()
+	}
+	return msg
+}
 
-	return execResult, nil
+// rawJSON returns the raw API response as is if it's a JSON document, and as a JSON string otherwise,
+// like streamed event responses or responses cut to the size limit
+func rawJSON(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return body
+	}
+	data, _ := json.Marshal(string(body))
+	return data
 }
 
-// processMixMode handles mixing results from multiple providers
-func processMixMode(ctx context.Context, req mix.Request) (*mix.Response, error) {
-	// create mix manager
-	mixer := mix.New(lgr.Default())
+// outputJSON writes the execution result to stdout in JSON format
+func outputJSON(result *ExecutionResult) error {
+	return writeJSON(os.Stdout, result)
+}
 
-	// process the mix request
-	return mixer.Process(ctx, req)
+// structuredOutput checks if the result is written in JSON or a structured output format for scripts
+func structuredOutput(opts *options) bool {
+	switch {
+	case opts.JSON:
+		return true
+	case opts.OutputFormat == "yaml" || opts.OutputFormat == "tsv" || opts.OutputFormat == "csv":
+		return true
+	default:
+		return false
+	}
 }
 
-// showVerbosePrompt displays the prompt text that will be sent to the models
-func showVerbosePrompt(w io.Writer, opts options) {
-	fmt.Fprintln(w, "=== Prompt sent to models ===")
-	fmt.Fprintln(w, opts.Prompt)
-	fmt.Fprintln(w, "=============================")
-	fmt.Fprintln(w)
+// writeStructured writes the result in JSON or the requested structured output format
+func writeStructured(w io.Writer, opts *options, result *ExecutionResult) error {
+	switch opts.OutputFormat {
+	case "yaml":
+		return writeYAML(w, result)
+	case "tsv":
+		return writeTable(w, result, '\t')
+	case "csv":
+		return writeTable(w, result, ',')
+	default:
+		return writeJSON(w, result)
+	}
 }
 
-// getPrompt handles reading the prompt from stdin (piped or interactive) or command line
-func getPrompt(opts *options) error {
-	// check if input is coming from a pipe
-	stat, err := os.Stdin.Stat()
-	if err != nil {
-		// if we can't stat stdin, assume it's not piped
-		stat = nil
+// writeOutput writes the result in the structured output format, and the minisign signature of the written
+// output to the --sign.output file if the output is signed
+func writeOutput(w io.Writer, opts *options, result *ExecutionResult) error {
+	if opts.signKey == nil {
+		return writeStructured(w, opts, result)
+	}
+	var buf bytes.Buffer
+	if err := writeStructured(&buf, opts, result); err != nil {
+		return err
+	}
+	comment := fmt.Sprintf("timestamp:%d\ttool:mpt %s", time.Now().Unix(), revision)
+	if result.Provenance != nil {
+		comment += "\tprompt_sha256:" + result.Provenance.PromptSHA256
 	}
-	isPiped := stat != nil && (stat.Mode()&os.ModeCharDevice) == 0
+	if err := os.WriteFile(opts.SignOutput, opts.signKey.Sign(buf.Bytes(), comment), 0o644); err != nil { //nolint:gosec // signature is public
+		return fmt.Errorf("failed to write signature: %w", err)
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
 
-	if isPiped {
-		// handle piped input
-		stdinContent, err := readFromStdin()
-		if err != nil {
-			return err
+// setProvenance sets provenance of the run started at the given time if requested with --sign: version of mpt,
+// hash of the prompt, and providers with models which produced successful answers and the mixed result
+func setProvenance(opts *options, result *ExecutionResult, started time.Time) {
+	if !opts.Sign {
+		return
+	}
+	p := &provenance.Provenance{Tool: "mpt", Version: revision, PromptSHA256: provenance.HashPrompt(opts.Prompt),
+		Models: []provenance.Model{}, Started: started.UTC(), Finished: time.Now().UTC()}
+	for _, r := range result.Results {
+		if r.Error == nil {
+			p.Models = append(p.Models, provenance.Model{Provider: r.Provider, Model: r.Model, Role: provenance.RoleAnswer})
 		}
-
-		// combine with existing prompt or use as prompt
-		opts.Prompt = prompt.CombineWithInput(opts.Prompt, stdinContent)
-
-	} else if opts.Prompt == "" {
-		// no data piped, no prompt provided, interactive mode
-		fmt.Print("Enter prompt: ")
-		reader := bufio.NewReader(os.Stdin)
-		promptText, err := reader.ReadString('\n')
-		if err != nil {
-			return fmt.Errorf("error reading prompt: %w", err)
+	}
+	if result.MixUsed {
+		mixers := []string{result.MixProvider}
+		if len(result.MixStages) > 0 {
+			mixers = mixers[:0]
+			for _, st := range result.MixStages {
+				if st.Error == nil {
+					mixers = append(mixers, st.Provider)
+				}
+			}
+		}
+		for _, name := range mixers {
+			p.Models = append(p.Models, provenance.Model{Provider: name, Role: provenance.RoleMix})
 		}
-		opts.Prompt = strings.TrimSpace(promptText)
 	}
-	return nil
+	if opts.signKey != nil {
+		p.KeyID = opts.signKey.ID()
+	}
+	result.Provenance = p
 }
 
-func setupLog(dbg bool, secs ...string) {
-	logOpts := []lgr.Option{lgr.Out(io.Discard), lgr.Err(io.Discard)} // default to discard
-	if dbg {
-		logOpts = []lgr.Option{lgr.Debug, lgr.Msec, lgr.LevelBraces, lgr.StackTraceOnError, lgr.Out(os.Stderr)}
+// writeYAML writes the execution result in YAML format, with the same fields as JSON output
+func writeYAML(w io.Writer, result *ExecutionResult) error {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, result); err != nil {
+		return err
 	}
-	if len(secs) > 0 {
-		logOpts = append(logOpts, lgr.Secret(secs...))
+	// JSON is valid YAML, decoding it into a node keeps the order of fields
+	var node yaml.Node
+	if err := yaml.Unmarshal(buf.Bytes(), &node); err != nil {
+		return fmt.Errorf("error converting output to YAML: %w", err)
 	}
-	lgr.SetupStdLogger(logOpts...)
-	lgr.Setup(logOpts...)
+	resetYAMLStyle(&node)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return fmt.Errorf("error encoding YAML output: %w", err)
+	}
+	return enc.Close()
 }
 
-// readFromStdin reads content from stdin and returns it as a trimmed string
-func readFromStdin() (string, error) {
-	scanner := bufio.NewScanner(os.Stdin)
-	var sb strings.Builder
-	for scanner.Scan() {
-		sb.WriteString(scanner.Text())
-		sb.WriteString("\n")
+// resetYAMLStyle clears flow and quoted styles of nodes decoded from JSON, so they are written in block style
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, n := range node.Content {
+		resetYAMLStyle(n)
 	}
-	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("error reading from stdin: %w", err)
+}
+
+// writeTable writes a row per provider response with a header row, as TSV or CSV depending on the separator.
+// The mixed result, if any, is the last row.
+func writeTable(w io.Writer, result *ExecutionResult, separator rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = separator
+	rows := [][]string{{"provider", "model", "latency_ms", "prompt_tokens", "status", "text"}}
+	for _, r := range result.Results {
+		status, text := "ok", r.Text
+		switch {
+		case r.Error != nil:
+			status, text = "error", r.Error.Error()
+		case r.Truncated:
+			status = "truncated"
+		}
+		tokensCell := ""
+		if n, ok := promptTokens(result, r); ok {
+			tokensCell = strconv.Itoa(n)
+		}
+		latency := strconv.FormatInt(r.Latency.Milliseconds(), 10)
+		rows = append(rows, []string{r.Provider, r.Model, latency, tokensCell, status, text})
 	}
-	return strings.TrimSpace(sb.String()), nil
+	if result.MixUsed {
+		rows = append(rows, []string{"mix (" + result.MixProvider + ")", "", "", "", "ok", result.MixedText})
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return fmt.Errorf("error writing table output: %w", err)
+	}
+	return nil
 }
 
-func outputJSON(result *ExecutionResult) error {
+// writeJSON writes the execution result in JSON format
+func writeJSON(w io.Writer, result *ExecutionResult) error {
 	// create json output structure
+	type ErrorDetails struct {
+		Status    int    `json:"status,omitempty"` // HTTP status code
+		Code      string `json:"code,omitempty"`   // vendor error code
+		Retryable bool   `json:"retryable"`        // whether the request may succeed if retried
+		Body      string `json:"body,omitempty"`   // excerpt of the raw response body
+	}
+
+	type Attempt struct {
+		Attempt    int    `json:"attempt"`               // number of the attempt of the request, from 1
+		ErrorClass string `json:"error_class,omitempty"` // class of the error, like rate_limit or timeout, empty on success
+		Error      string `json:"error,omitempty"`       // error of the failed attempt
+		DelayMS    int64  `json:"delay_ms"`              // delay waited before the attempt
+		DurationMS int64  `json:"duration_ms"`           // time spent on the attempt request
+	}
+
 	type ProviderResponse struct {
-		Provider string `json:"provider"`
-		Text     string `json:"text,omitempty"`
-		Error    string `json:"error,omitempty"`
+		Provider     string        `json:"provider"`
+		Text         string        `json:"text,omitempty"`
+		Error        string        `json:"error,omitempty"`
+		ErrorDetails *ErrorDetails `json:"error_details,omitempty"`
+		Reasoning    string        `json:"reasoning,omitempty"`
+		Truncated    bool          `json:"truncated,omitempty"`
+		Model        string        `json:"model,omitempty"`         // model which served the request
+		FinishReason string        `json:"finish_reason,omitempty"` // reason the generation stopped
+		LatencyMS    int64         `json:"latency_ms,omitempty"`    // time spent to get the response
+		RequestID    string        `json:"request_id,omitempty"`    // id of the response assigned by the provider
+		DuplicateOf  string        `json:"duplicate_of,omitempty"`  // earlier provider returned the identical answer
+
+		ValidationAttempts int       `json:"validation_attempts,omitempty"` // requests made to get a valid answer
+		Attempts           []Attempt `json:"attempts,omitempty"`            // attempts of retried requests, with --retry.attempts
+
+		PromptTokens    int     `json:"prompt_tokens,omitempty"`           // tokens of the prompt, counted or reported by the provider
+		TokensEstimated bool    `json:"prompt_tokens_estimated,omitempty"` // prompt tokens are estimated, not counted by the provider
+		OutputTokens    int     `json:"output_tokens,omitempty"`           // tokens of the answer, reported by the provider
+		CostUSD         float64 `json:"cost_usd,omitempty"`                // estimated cost of the request by reported usage
+
+		Raw []json.RawMessage `json:"raw,omitempty"` // sanitized raw API responses of the request, with --json.raw
+	}
+
+	type MixStage struct {
+		Provider string `json:"provider"`        // provider of the stage
+		Text     string `json:"text,omitempty"`  // answer of the stage
+		Error    string `json:"error,omitempty"` // error of the failed stage, the chain stops at it
 	}
 
 	type JSONOutput struct {
-		Final              string             `json:"final"`                         // final text shown in cli mode
-		Responses          []ProviderResponse `json:"responses"`                     // individual provider responses
-		Mixed              string             `json:"mixed,omitempty"`               // raw mixed result without headers
-		MixUsed            bool               `json:"mix_used"`                      // explicit flag for mix mode usage
-		MixProvider        string             `json:"mix_provider,omitempty"`        // provider that performed mixing
-		ConsensusAttempted bool               `json:"consensus_attempted,omitempty"` // whether consensus was attempted
-		ConsensusAchieved  bool               `json:"consensus_achieved,omitempty"`  // whether consensus was achieved
-		ConsensusAttempts  int                `json:"consensus_attempts,omitempty"`  // number of consensus attempts made
-		Timestamp          string             `json:"timestamp"`
+		Name                 string                 `json:"name,omitempty"`                  // name of the run
+		Tags                 map[string]string      `json:"tags,omitempty"`                  // tags of the run
+		Final                string                 `json:"final"`                           // final text shown in cli mode
+		Responses            []ProviderResponse     `json:"responses"`                       // individual provider responses
+		Mixed                string                 `json:"mixed,omitempty"`                 // raw mixed result without headers
+		MixUsed              bool                   `json:"mix_used"`                        // explicit flag for mix mode usage
+		MixProvider          string                 `json:"mix_provider,omitempty"`          // provider that performed mixing
+		MixStages            []MixStage             `json:"mix_stages,omitempty"`            // merge and refinement stages of the mix chain
+		ConsensusAttempted   bool                   `json:"consensus_attempted,omitempty"`   // whether consensus was attempted
+		ConsensusAchieved    bool                   `json:"consensus_achieved,omitempty"`    // whether consensus was achieved
+		ConsensusAttempts    int                    `json:"consensus_attempts,omitempty"`    // number of consensus attempts made
+		ConsensusExplanation string                 `json:"consensus_explanation,omitempty"` // judge's reasoning of the last consensus check
+		Findings             []review.Finding       `json:"findings,omitempty"`              // aggregated findings in review mode
+		Error                string                 `json:"error,omitempty"`                 // error if all providers failed
+		CostUSD              float64                `json:"cost_usd,omitempty"`              // estimated cost of all requests by reported usage
+		Timestamp            string                 `json:"timestamp"`
+		Provenance           *provenance.Provenance `json:"provenance,omitempty"` // tool, models and prompt of the run, set with --sign
 	}
 
 	// build responses array
 	responses := make([]ProviderResponse, 0, len(result.Results))
-	for _, r := range result.Results {
+	dups := provider.Duplicates(result.Results)
+	var totalCost float64
+	for i, r := range result.Results {
 		resp := ProviderResponse{
-			Provider: r.Provider,
-			Text:     r.Text,
+			Provider:     r.Provider,
+			Text:         r.Text,
+			Truncated:    r.Truncated,
+			Model:        r.Model,
+			FinishReason: r.FinishReason,
+			LatencyMS:    r.Latency.Milliseconds(),
+			RequestID:    r.RequestID,
+
+			ValidationAttempts: r.ValidationAttempts,
+		}
+		for _, a := range r.Attempts {
+			resp.Attempts = append(resp.Attempts, Attempt{Attempt: a.Number, ErrorClass: a.ErrorClass, Error: a.Error,
+				DelayMS: a.Delay.Milliseconds(), DurationMS: a.Duration.Milliseconds()})
+		}
+		if result.Reasoning {
+			resp.Reasoning = r.Reasoning
+		}
+		if dups[i] >= 0 {
+			resp.DuplicateOf = result.Results[dups[i]].Provider
+		}
+		for _, c := range result.Tokens {
+			if c.Provider == r.Provider {
+				resp.PromptTokens, resp.TokensEstimated = c.Tokens, c.Estimated
+			}
+		}
+		if resp.PromptTokens == 0 {
+			resp.PromptTokens = r.Usage.InputTokens
+		}
+		resp.OutputTokens = r.Usage.OutputTokens
+		if c, ok := cost(result, r); ok {
+			resp.CostUSD = c
+			totalCost += c
+		}
+		for _, body := range r.Raw {
+			resp.Raw = append(resp.Raw, rawJSON(body))
 		}
 
 		if r.Error != nil {
 			resp.Error = r.Error.Error()
+			var perr *provider.Error
+			if errors.As(r.Error, &perr) {
+				resp.ErrorDetails = &ErrorDetails{Status: perr.Status, Code: perr.Code, Retryable: perr.Retryable, Body: perr.Body}
+			}
 		}
 
 		responses = append(responses, resp)
@@ -640,23 +4304,44 @@ func outputJSON(result *ExecutionResult) error {
 
 	// create the output structure
 	output := JSONOutput{
-		Final:              result.Text,
-		Responses:          responses,
-		MixUsed:            result.MixUsed,
-		ConsensusAttempted: result.ConsensusAttempted,
-		ConsensusAchieved:  result.ConsensusAchieved,
-		ConsensusAttempts:  result.ConsensusAttempts,
-		Timestamp:          time.Now().Format(time.RFC3339),
+		Name:                 result.Name,
+		Tags:                 result.Tags,
+		Final:                result.Text,
+		Responses:            responses,
+		MixUsed:              result.MixUsed,
+		ConsensusAttempted:   result.ConsensusAttempted,
+		ConsensusAchieved:    result.ConsensusAchieved,
+		ConsensusAttempts:    result.ConsensusAttempts,
+		ConsensusExplanation: result.ConsensusExplanation,
+		CostUSD:              totalCost,
+		Timestamp:            time.Now().Format(time.RFC3339),
+		Provenance:           result.Provenance,
+	}
+
+	// add review findings if review mode was used
+	if result.Review != nil {
+		output.Findings = result.Review.Findings
+	}
+
+	if result.Err != nil {
+		output.Error = result.Err.Error()
 	}
 
 	// add mixed result info if mixing was used
 	if result.MixUsed {
 		output.Mixed = result.MixedText // use raw text without headers
 		output.MixProvider = result.MixProvider
+		for _, st := range result.MixStages {
+			stage := MixStage{Provider: st.Provider, Text: st.Text}
+			if st.Error != nil {
+				stage.Error = st.Error.Error()
+			}
+			output.MixStages = append(output.MixStages, stage)
+		}
 	}
 
 	// encode to JSON
-	encoder := json.NewEncoder(os.Stdout)
+	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "  ")
 	if err := encoder.Encode(output); err != nil {
 		return fmt.Errorf("error encoding JSON output: %w", err)
@@ -665,6 +4350,22 @@ func outputJSON(result *ExecutionResult) error {
 	return nil
 }
 
+// writeSARIFFile writes review findings to the file in SARIF format
+func writeSARIFFile(path string, report *review.Report) error {
+	fh, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create sarif file: %w", err)
+	}
+	if err := report.WriteSARIF(fh, revision); err != nil {
+		_ = fh.Close()
+		return err
+	}
+	if err := fh.Close(); err != nil {
+		return fmt.Errorf("failed to close sarif file: %w", err)
+	}
+	return nil
+}
+
 // SizeValue is a custom type that supports human-readable size values with k/kb/m/mb/g/gb suffixes
 type SizeValue int64
 
@@ -678,6 +4379,46 @@ func (v *SizeValue) UnmarshalFlag(value string) error {
 	return nil
 }
 
+// BudgetValue is a token budget given as percent of max prompt tokens, like "60%", or as tokens, like "40k"
+type BudgetValue struct {
+	Percent float64 // percent of max prompt tokens, 0 if given as tokens
+	Tokens  int64   // tokens, 0 if given as percent
+}
+
+// UnmarshalFlag implements the flags.Unmarshaler interface for percents and human-readable token numbers
+func (v *BudgetValue) UnmarshalFlag(value string) error {
+	if pct, ok := strings.CutSuffix(strings.TrimSpace(value), "%"); ok {
+		n, err := strconv.ParseFloat(pct, 64)
+		if err != nil || n <= 0 || n > 100 {
+			return fmt.Errorf("invalid budget value %q, percent must be between 0 and 100", value)
+		}
+		*v = BudgetValue{Percent: n}
+		return nil
+	}
+	n, err := config.ParseSize(value)
+	if err != nil {
+		return fmt.Errorf("invalid budget value %q: %w", value, err)
+	}
+	if n <= 0 {
+		return fmt.Errorf("invalid budget value %q, tokens must be positive", value)
+	}
+	*v = BudgetValue{Tokens: n}
+	return nil
+}
+
+// set checks if the budget is set
+func (v BudgetValue) set() bool {
+	return v.Percent > 0 || v.Tokens > 0
+}
+
+// tokens returns the budget in tokens for the max prompt tokens
+func (v BudgetValue) tokens(limit int) int {
+	if v.Percent > 0 {
+		return int(float64(limit) * v.Percent / 100)
+	}
+	return int(v.Tokens)
+}
+
 // customSpec is a CLI wrapper around config.CustomSpec that implements UnmarshalFlag for go-flags
 type customSpec struct {
 	config.CustomSpec
@@ -713,8 +4454,18 @@ func createCustomManager(opts *options) *config.CustomProviderManager {
 			Temperature:  opts.Custom.Temperature,
 			EndpointType: opts.Custom.EndpointType,
 			Enabled:      opts.Custom.Enabled,
+			Timeouts:     provider.Timeouts{Connect: opts.Custom.TimeoutConnect, Generation: opts.Custom.TimeoutGeneration},
+			Discover:     opts.Custom.Discover,
+			Required:     opts.Custom.Required,
+			Parallel:     opts.Custom.Parallel,
+			Instructions: opts.Custom.Instructions,
 		}
 	}
 
-	return config.NewCustomProviderManager(configCustoms, legacyCustom)
+	manager := config.NewCustomProviderManager(configCustoms, legacyCustom).WithTimeouts(defaultTimeouts(opts)).WithAliases(opts.aliases).
+		WithOutputLimits(opts.maxOutputTokens(), opts.Stop).WithTemperature(opts.Temperature).WithModelCache(opts.models)
+	if opts.TimeoutAuto {
+		manager = manager.WithAutoTimeout(func(maxTokens int) time.Duration { return autoTimeout(opts, maxTokens) })
+	}
+	return manager
 }
@@ -269,7 +269,7 @@ func TestCustomProviderIntegration(t *testing.T) {
 	_, err := p.Parse()
 	require.NoError(t, err)
 
-	setupLog(opts.Debug, collectSecrets(opts)...)
+	setupLog(verbosity(opts), opts.LogFormat, collectSecrets(opts)...)
 
 	// verify options parsed correctly
 	require.True(t, opts.Custom.Enabled)
@@ -385,7 +385,7 @@ func TestCustomProviderWithFileAndVerbose(t *testing.T) {
 	require.True(t, opts.Custom.Enabled)
 	require.Equal(t, ts.URL, opts.Custom.URL)
 	require.Equal(t, "test-model", opts.Custom.Model)
-	require.True(t, opts.Verbose, "Verbose flag should be enabled")
+	require.Equal(t, verbosePrompt, verbosity(opts), "Verbose flag should be enabled")
 	require.Contains(t, opts.Files, testFilePath, "Files should contain our test file path")
 
 	// since we'll be making an actual HTTP request to our test server,
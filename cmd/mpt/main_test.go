@@ -1,35 +1,110 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
+	"github.com/go-pkgz/lgr"
 	"github.com/jessevdk/go-flags"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 
+	"github.com/umputun/mpt/pkg/batchapi"
 	"github.com/umputun/mpt/pkg/config"
+	"github.com/umputun/mpt/pkg/history"
 	"github.com/umputun/mpt/pkg/mix"
+	"github.com/umputun/mpt/pkg/pricing"
+	"github.com/umputun/mpt/pkg/prompt"
+	"github.com/umputun/mpt/pkg/provenance"
 	"github.com/umputun/mpt/pkg/provider"
+	"github.com/umputun/mpt/pkg/review"
 	"github.com/umputun/mpt/pkg/runner"
 	"github.com/umputun/mpt/pkg/runner/mocks"
+	"github.com/umputun/mpt/pkg/tokens"
 )
 
 func TestSetupLog(t *testing.T) {
 	// test different logging configurations
-	setupLog(true)
-	setupLog(false)
-	setupLog(true, "secret1", "secret2")
+	setupLog(verboseDebug, "text")
+	setupLog(0, "text")
+	setupLog(verboseDebug, "text", "secret1", "secret2")
+	setupLog(verboseRequests, "json", "secret1")
+	setupLog(0, "text") // restore discarding logs and disable request trace
+}
+
+func TestVerbosity(t *testing.T) {
+	tests := []struct {
+		name string
+		opts options
+		want int
+	}{
+		{name: "default", opts: options{}, want: 0},
+		{name: "-v", opts: options{Verbose: []bool{true}}, want: verbosePrompt},
+		{name: "-vv", opts: options{Verbose: []bool{true, true}}, want: verboseDebug},
+		{name: "-vvv", opts: options{Verbose: []bool{true, true, true}}, want: verboseRequests},
+		{name: "--dbg", opts: options{Debug: true}, want: verboseDebug},
+		{name: "--dbg with -vvv", opts: options{Debug: true, Verbose: []bool{true, true, true}}, want: verboseRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, verbosity(&tt.opts))
+		})
+	}
+}
+
+func TestSecretsWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := &secretsWriter{w: &buf, secrets: []string{"sk-123", ""}}
+	n, err := w.Write([]byte(`{"msg":"key sk-123 used"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 25, n, "length of the original data")
+	assert.JSONEq(t, `{"msg":"key ****** used"}`, buf.String())
+}
+
+func TestMaskSecrets(t *testing.T) {
+	got := maskSecrets([]byte("POST /v1?key=AIza-1 body sk-123"), []string{"AIza-1", "sk-123", ""})
+	assert.Equal(t, "POST /v1?key=****** body ******", string(got))
+}
+
+func TestJSONLogs(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&secretsWriter{w: &buf, secrets: []string{"sk-123"}},
+		&slog.HandlerOptions{Level: slogLevelTrace, ReplaceAttr: slogTraceLevel})
+	l := lgr.New(lgr.Trace, lgr.SlogHandler(handler))
+	l.Logf("[TRACE] request with sk-123")
+	l.Logf("[DEBUG] file excluded")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	var rec struct {
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &rec))
+	assert.Equal(t, "TRACE", rec.Level)
+	assert.Equal(t, "request with ******", rec.Msg)
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &rec))
+	assert.Equal(t, "DEBUG", rec.Level)
 }
 
 func TestValidateOptions(t *testing.T) {
@@ -78,6 +153,449 @@ func TestValidateOptions(t *testing.T) {
 			wantError: true,
 			errorMsg:  "consensus mode requires mix mode to be enabled",
 		},
+		{
+			name:      "auto-continue with valid max",
+			opts:      &options{AutoContinue: true, Continue: continueOpts{Max: 3}},
+			wantError: false,
+		},
+		{
+			name:      "auto-continue with zero max",
+			opts:      &options{AutoContinue: true, Continue: continueOpts{Max: 0}},
+			wantError: true,
+			errorMsg:  "continue max must be at least 1, got 0",
+		},
+		{
+			name:      "negative mix max tokens",
+			opts:      &options{MixEnabled: true, MixMaxTokens: -1},
+			wantError: true,
+			errorMsg:  "mix max tokens can't be negative, got -1",
+		},
+		{
+			name:      "mix quorum of single answer",
+			opts:      &options{MixQuorum: 1, HTTP: httpOpts{Listen: ":8080"}},
+			wantError: true,
+			errorMsg:  "mix quorum must be at least 2 answers, got 1",
+		},
+		{
+			name:      "mix quorum without http server",
+			opts:      &options{MixQuorum: 2},
+			wantError: true,
+			errorMsg:  "mix quorum applies to streamed runs of HTTP server, requires --http.listen",
+		},
+		{
+			name:      "mix quorum with http server",
+			opts:      &options{MixQuorum: 2, HTTP: httpOpts{Listen: ":8080", JobRetention: time.Hour}},
+			wantError: false,
+		},
+		{
+			name:      "negative max output tokens",
+			opts:      &options{MaxOutputTokens: -1},
+			wantError: true,
+			errorMsg:  "max output tokens can't be negative, got -1",
+		},
+		{
+			name:      "too many stop sequences",
+			opts:      &options{Stop: []string{"a", "b", "c", "d", "e"}},
+			wantError: true,
+			errorMsg:  "at most 4 stop sequences are supported, got 5",
+		},
+		{
+			name:      "empty stop sequence",
+			opts:      &options{Stop: []string{""}},
+			wantError: true,
+			errorMsg:  "stop sequence can't be empty",
+		},
+		{
+			name: "valid stop sequences",
+			opts: &options{Stop: []string{"END", "###"}, MaxOutputTokens: 100},
+		},
+		{
+			name:      "record with replay",
+			opts:      &options{Record: "fixtures", Replay: "fixtures"},
+			wantError: true,
+			errorMsg:  "record and replay modes can't be combined",
+		},
+		{
+			name:      "google project without vertex",
+			opts:      &options{Google: googleOpts{Enabled: true, Project: "my-project"}},
+			wantError: true,
+			errorMsg:  "google project and location are used with vertex AI only, set --google.vertex",
+		},
+		{
+			name:      "anthropic location without vertex",
+			opts:      &options{Anthropic: anthropicOpts{Backend: "bedrock", Location: "us-east5"}},
+			wantError: true,
+			errorMsg:  "anthropic project and location are used with vertex AI only, set --anthropic.backend=vertex",
+		},
+		{
+			name:      "anthropic region without bedrock",
+			opts:      &options{Anthropic: anthropicOpts{Backend: "direct", Region: "us-east-1"}},
+			wantError: true,
+			errorMsg:  "anthropic region is used with bedrock only, set --anthropic.backend=bedrock",
+		},
+		{
+			name: "anthropic bedrock",
+			opts: &options{Anthropic: anthropicOpts{Enabled: true, Backend: "bedrock", Region: "us-east-1"}},
+		},
+		{
+			name: "google vertex",
+			opts: &options{Google: googleOpts{Enabled: true, Vertex: true, Project: "my-project", Location: "us-central1"}},
+		},
+		{
+			name:      "first with mix",
+			opts:      &options{First: true, MixEnabled: true},
+			wantError: true,
+			errorMsg:  "first mode can't be combined with mix or review modes, they use responses from all providers",
+		},
+		{
+			name:      "first with required provider",
+			opts:      &options{First: true, OpenAI: openAIOpts{Enabled: true, Required: true}},
+			wantError: true,
+			errorMsg:  "first mode returns a single response, can't be combined with required providers",
+		},
+		{
+			name:      "normalize rules without normalize",
+			opts:      &options{NormalizeRules: "rules.yml"},
+			wantError: true,
+			errorMsg:  "normalize rules require answer normalization to be enabled (use --normalize)",
+		},
+		{
+			name:      "first with review",
+			opts:      &options{First: true, Review: true},
+			wantError: true,
+			errorMsg:  "first mode can't be combined with mix or review modes, they use responses from all providers",
+		},
+		{
+			name:      "files relevant with zero top-k",
+			opts:      &options{FilesRelevant: true, FilesTopK: 0},
+			wantError: true,
+			errorMsg:  "files top-k must be at least 1, got 0",
+		},
+		{
+			name:      "negative files workers",
+			opts:      &options{FilesWorkers: -1},
+			wantError: true,
+			errorMsg:  "files workers can't be negative, got -1",
+		},
+		{
+			name:      "batch api with batch job",
+			opts:      &options{Batch: batchOpts{API: true, Job: "job"}},
+			wantError: true,
+			errorMsg:  "batch api mode submits a new job, can't be combined with --batch.job",
+		},
+		{
+			name:      "batch api with mix",
+			opts:      &options{Batch: batchOpts{API: true}, MixEnabled: true},
+			wantError: true,
+			errorMsg:  "batch jobs can't be combined with mix, prompt variants or server modes",
+		},
+		{
+			name:      "batch wait without job",
+			opts:      &options{Batch: batchOpts{Wait: true, Poll: time.Second}},
+			wantError: true,
+			errorMsg:  "batch wait requires batch api mode or a batch job, set --batch.api or --batch.job",
+		},
+		{
+			name:      "batch wait without poll interval",
+			opts:      &options{Batch: batchOpts{API: true, Wait: true}},
+			wantError: true,
+			errorMsg:  "batch poll interval must be positive, got 0s",
+		},
+		{
+			name:      "json raw without json",
+			opts:      &options{JSONRaw: true},
+			wantError: true,
+			errorMsg:  "raw responses are included in JSON and YAML output, --json.raw requires --json or --output.format=yaml",
+		},
+		{
+			name: "json raw with yaml",
+			opts: &options{JSONRaw: true, OutputFormat: "yaml"},
+		},
+		{
+			name:      "sign without json",
+			opts:      &options{Sign: true},
+			wantError: true,
+			errorMsg:  "provenance is embedded into JSON output, --sign requires --json",
+		},
+		{
+			name:      "sign in server mode",
+			opts:      &options{Sign: true, JSON: true, HTTP: httpOpts{Listen: ":8080"}},
+			wantError: true,
+			errorMsg:  "provenance is recorded for a single run, --sign can't be combined with prompt variants or server modes",
+		},
+		{
+			name:      "sign key without sign",
+			opts:      &options{JSON: true, SignKey: "mpt.key", SignOutput: "out.minisig"},
+			wantError: true,
+			errorMsg:  "signing the output requires provenance, set --sign",
+		},
+		{
+			name:      "sign key without signature file",
+			opts:      &options{Sign: true, JSON: true, SignKey: "mpt.key"},
+			wantError: true,
+			errorMsg:  "signing the output requires both the key and the signature file, set --sign.key and --sign.output",
+		},
+		{
+			name:      "files changed since without file patterns",
+			opts:      &options{FilesChangedSince: "origin/main"},
+			wantError: true,
+			errorMsg:  "files changed since origin/main requested, but no file patterns set with --file",
+		},
+		{
+			name:      "unknown mix provider capability",
+			opts:      &options{MixProvider: "google,capability:fast"},
+			wantError: true,
+			errorMsg:  `invalid mix provider "google,capability:fast": unknown capability "fast", supported: supports-json, supports-vision, long-context, cheap`,
+		},
+		{
+			name:      "mix provider capability",
+			opts:      &options{MixProvider: "capability:cheap+long-context, openai"},
+			wantError: false,
+		},
+		{
+			name:      "mcp and http server modes",
+			opts:      &options{MCP: mcpOpts{Server: true}, HTTP: httpOpts{Listen: ":8080", JobRetention: time.Hour}},
+			wantError: true,
+			errorMsg:  "MCP and HTTP server modes can't be combined",
+		},
+		{
+			name:      "zero http job retention",
+			opts:      &options{HTTP: httpOpts{Listen: ":8080"}},
+			wantError: true,
+			errorMsg:  "http job retention must be positive, got 0s",
+		},
+		{
+			name:      "negative max prompt tokens",
+			opts:      &options{Tokens: tokensOpts{Max: -1}},
+			wantError: true,
+			errorMsg:  "max prompt tokens can't be negative, got -1",
+		},
+		{
+			name:      "token counting in server mode",
+			opts:      &options{Tokens: tokensOpts{Count: true}, MCP: mcpOpts{Server: true}},
+			wantError: true,
+			errorMsg:  "prompt token counting is not supported in server modes",
+		},
+		{
+			name:      "budget without max prompt tokens",
+			opts:      &options{Budget: budgetOpts{Files: BudgetValue{Percent: 60}}},
+			wantError: true,
+			errorMsg:  "context budgets require max prompt tokens set with --tokens.max",
+		},
+		{
+			name: "budgets exceeding max prompt tokens",
+			opts: &options{Tokens: tokensOpts{Max: 1000}, Budget: budgetOpts{Files: BudgetValue{Percent: 80},
+				Stdin: BudgetValue{Tokens: 300}}},
+			wantError: true,
+			errorMsg:  "context budgets of 1100 tokens exceed max prompt tokens 1000",
+		},
+		{
+			name:      "prompt variants with mix",
+			opts:      &options{PromptVariants: "variants.yml", MixEnabled: true},
+			wantError: true,
+			errorMsg:  "prompt variants can't be combined with mix, review or first modes",
+		},
+		{
+			name:      "prompt variants with csv output",
+			opts:      &options{PromptVariants: "variants.yml", OutputFormat: "csv"},
+			wantError: true,
+			errorMsg:  "prompt variants support only text and json output, got csv",
+		},
+		{
+			name:      "prompt variants judge without variants",
+			opts:      &options{PromptVariantsJudge: "openai"},
+			wantError: true,
+			errorMsg:  "prompt variants judge requires prompt variants file, set --prompt-variants",
+		},
+		{
+			name:      "invalid prompt variants judge",
+			opts:      &options{PromptVariants: "variants.yml", PromptVariantsJudge: "capability:magic"},
+			wantError: true,
+			errorMsg:  `invalid prompt variants judge "capability:magic": unknown capability "magic"`,
+		},
+		{
+			name:      "apply dry-run without directory",
+			opts:      &options{Apply: applyOpts{DryRun: true}},
+			wantError: true,
+			errorMsg:  "apply dry-run requires apply directory or patch mode, set --apply.dir or --apply.patch",
+		},
+		{
+			name:      "apply with review",
+			opts:      &options{Apply: applyOpts{Dir: "out"}, Review: true},
+			wantError: true,
+			errorMsg:  "applying files requires a single final answer",
+		},
+		{
+			name:      "max tokens alias with different value",
+			opts:      &options{MaxOutputTokens: 100, MaxTokens: 200},
+			wantError: true,
+			errorMsg:  "--max-tokens is an alias of --max-output-tokens, they can't be set to different values",
+		},
+		{
+			name:      "temperature out of range",
+			opts:      &options{Temperature: func() *float32 { v := float32(2.5); return &v }()},
+			wantError: true,
+			errorMsg:  "temperature must be between 0 and 2, got 2.5",
+		},
+		{
+			name:      "invalid faults",
+			opts:      &options{Fault: faultOpts{Providers: map[string]string{"openai": "crash:10%"}}},
+			wantError: true,
+			errorMsg:  `invalid faults of openai: unknown fault "crash", supported: timeout, error, ratelimit, empty, auth`,
+		},
+		{
+			name: "faults of provider not enabled",
+			opts: &options{OpenAI: openAIOpts{Enabled: true},
+				Fault: faultOpts{Providers: map[string]string{"OpenAI": "auth", "anthropic": "timeout"}}},
+			wantError: true,
+			errorMsg:  "faults set for provider anthropic, which is not enabled",
+		},
+		{
+			name:      "negative fault delay",
+			opts:      &options{Fault: faultOpts{Delay: -time.Second}},
+			wantError: true,
+			errorMsg:  "fault delay can't be negative, got -1s",
+		},
+		{
+			name:      "invalid context position",
+			opts:      &options{Ctx: ctxOpts{Position: "middle"}},
+			wantError: true,
+			errorMsg:  `invalid context position "middle", expected before, after or replace:<marker>`,
+		},
+		{
+			name:      "invalid context wrapper",
+			opts:      &options{Ctx: ctxOpts{Wrapper: "json"}},
+			wantError: true,
+			errorMsg:  `unknown context wrapper "json", supported: plain, xml, markdown`,
+		},
+		{
+			name:      "invalid provider context wrapper",
+			opts:      &options{Ctx: ctxOpts{ProviderWrappers: map[string]string{"anthropic": "html"}}},
+			wantError: true,
+			errorMsg:  `invalid context wrapper of anthropic: unknown context wrapper "html", supported: plain, xml, markdown`,
+		},
+		{
+			name:      "http auth without http server mode",
+			opts:      &options{HTTP: httpOpts{Auth: "auth.yml", JobRetention: time.Hour}},
+			wantError: true,
+			errorMsg:  "http auth requires HTTP server mode, set --http.listen or --serve.openai",
+		},
+		{
+			name:      "http auth with openai-compatible api",
+			opts:      &options{HTTP: httpOpts{Auth: "auth.yml", JobRetention: time.Hour}, Serve: serveOpts{OpenAI: ":8081"}},
+			wantError: false,
+		},
+		{
+			name:      "mcp server mode and openai-compatible api",
+			opts:      &options{MCP: mcpOpts{Server: true}, HTTP: httpOpts{JobRetention: time.Hour}, Serve: serveOpts{OpenAI: ":8081"}},
+			wantError: true,
+			errorMsg:  "MCP and HTTP server modes can't be combined",
+		},
+		{
+			name:      "tokens counting with openai-compatible api",
+			opts:      &options{Tokens: tokensOpts{Count: true}, HTTP: httpOpts{JobRetention: time.Hour}, Serve: serveOpts{OpenAI: ":8081"}},
+			wantError: true,
+			errorMsg:  "prompt token counting is not supported in server modes",
+		},
+		{
+			name:      "negative quota max wait",
+			opts:      &options{Quota: quotaOpts{MaxWait: -time.Second}},
+			wantError: true,
+			errorMsg:  "quota max wait can't be negative, got -1s",
+		},
+		{
+			name:      "auto timeout without base",
+			opts:      &options{TimeoutAuto: true, TimeoutAutoPer1K: time.Second},
+			wantError: true,
+			errorMsg:  "auto timeout requires positive base and non-negative increment, got 0s and 1s",
+		},
+		{
+			name:      "unknown ecosystem",
+			opts:      &options{Ecosystem: []string{"auto", "cobol"}},
+			wantError: true,
+			errorMsg:  `unknown ecosystem "cobol", supported: auto, none, go, node, python, rust, terraform`,
+		},
+		{
+			name:      "negative git log commits",
+			opts:      &options{Git: gitOpts{Log: -2}},
+			wantError: true,
+			errorMsg:  "git log commits can't be negative, got -2",
+		},
+		{
+			name:      "missing git repo",
+			opts:      &options{Git: gitOpts{Repo: "/nonexistent/repo"}},
+			wantError: true,
+			errorMsg:  "git repo /nonexistent/repo is not a directory",
+		},
+		{
+			name:      "files relevant with valid top-k",
+			opts:      &options{FilesRelevant: true, FilesTopK: 10},
+			wantError: false,
+		},
+		{
+			name:      "review with mix",
+			opts:      &options{Review: true, MixEnabled: true},
+			wantError: true,
+			errorMsg:  "review mode can't be combined with mix mode",
+		},
+		{
+			name:      "review sarif without review",
+			opts:      &options{ReviewSARIF: "out.sarif"},
+			wantError: true,
+			errorMsg:  "review sarif output requires review mode",
+		},
+		{
+			name:      "sarif output format without review",
+			opts:      &options{OutputFormat: "sarif"},
+			wantError: true,
+			errorMsg:  "output format sarif requires review mode",
+		},
+		{
+			name:      "rdjson output format with json",
+			opts:      &options{Review: true, OutputFormat: "rdjson", JSON: true},
+			wantError: true,
+			errorMsg:  "output format rdjson can't be combined with --json",
+		},
+		{
+			name:      "yaml output format without review",
+			opts:      &options{OutputFormat: "yaml"},
+			wantError: false,
+		},
+		{
+			name:      "csv output format with json",
+			opts:      &options{OutputFormat: "csv", JSON: true},
+			wantError: true,
+			errorMsg:  "output format csv can't be combined with --json",
+		},
+		{
+			name:      "mcp preflight with invalid re-check interval",
+			opts:      &options{MCP: mcpOpts{Server: true, Preflight: true, RecheckInterval: time.Minute, RecheckMax: time.Second}},
+			wantError: true,
+			errorMsg:  "mcp re-check interval must be positive and not above re-check max, got 1m0s and 1s",
+		},
+		{
+			name:      "quiet with json",
+			opts:      &options{Quiet: true, JSON: true},
+			wantError: true,
+			errorMsg:  "quiet mode prints the answer as text, can't be combined with --json or --output.format",
+		},
+		{
+			name:      "render with yaml",
+			opts:      &options{Render: true, OutputFormat: "yaml"},
+			wantError: true,
+			errorMsg:  "rendering applies to text output, --render can't be combined with --json or --output.format",
+		},
+		{
+			name:      "quiet with show individual",
+			opts:      &options{Quiet: true, MixEnabled: true, MixShowIndividual: true},
+			wantError: true,
+			errorMsg:  "quiet mode prints only the final answer",
+		},
+		{
+			name:      "rdjson output format with review",
+			opts:      &options{Review: true, OutputFormat: "rdjson"},
+			wantError: false,
+		},
 		{
 			name: "no consensus enabled",
 			opts: &options{
@@ -102,6 +620,44 @@ func TestValidateOptions(t *testing.T) {
 	}
 }
 
+func TestBudgetValue_UnmarshalFlag(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    BudgetValue
+		wantErr string
+	}{
+		{input: "60%", want: BudgetValue{Percent: 60}},
+		{input: " 12.5% ", want: BudgetValue{Percent: 12.5}},
+		{input: "40k", want: BudgetValue{Tokens: 40960}},
+		{input: "5000", want: BudgetValue{Tokens: 5000}},
+		{input: "120%", wantErr: `invalid budget value "120%", percent must be between 0 and 100`},
+		{input: "0%", wantErr: `invalid budget value "0%", percent must be between 0 and 100`},
+		{input: "x%", wantErr: `invalid budget value "x%", percent must be between 0 and 100`},
+		{input: "0", wantErr: `invalid budget value "0", tokens must be positive`},
+		{input: "lots", wantErr: `invalid budget value "lots"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var v BudgetValue
+			err := v.UnmarshalFlag(tt.input)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, v)
+		})
+	}
+}
+
+func TestContextBudget(t *testing.T) {
+	opts := &options{Tokens: tokensOpts{Max: 10000}}
+	assert.Equal(t, prompt.Budget{}, contextBudget(opts))
+
+	opts.Budget = budgetOpts{Files: BudgetValue{Percent: 60}, Stdin: BudgetValue{Tokens: 1500}}
+	assert.Equal(t, prompt.Budget{Limit: 10000, Files: 6000, Input: 1500}, contextBudget(opts))
+}
+
 func TestSizeValue_UnmarshalFlag(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -193,7 +749,7 @@ func TestVerboseOutput(t *testing.T) {
 	// create test options with verbose flag
 	opts := options{
 		Prompt:  "test prompt",
-		Verbose: true,
+		Verbose: []bool{true},
 	}
 
 	// test that verbose output prints the prompt
@@ -492,20 +1048,84 @@ func TestGetPrompt(t *testing.T) {
 	}
 }
 
+func TestEditPrompt(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh script as editor")
+	}
+	editor := filepath.Join(t.TempDir(), "editor.sh")
+	require.NoError(t, os.WriteFile(editor, []byte("#!/bin/sh\nprintf '\\nsecond line\\n' >> \"$2\"\n"), 0o700)) //nolint:gosec // test script
+
+	got, err := editPrompt(editor+" --wait", "first line")
+	require.NoError(t, err)
+	assert.Equal(t, "first line\nsecond line", got, "pre-filled text edited, editor arguments passed")
+
+	_, err = editPrompt("false", "text")
+	require.ErrorContains(t, err, `editor "false" failed`)
+	_, err = editPrompt(" \t", "text")
+	require.EqualError(t, err, "editor is not set")
+}
+
+func TestComposePrompt(t *testing.T) {
+	oldStdin := os.Stdin
+	defer func() { os.Stdin = oldStdin }()
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+
+	setStdin := func(content string) {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = r.Close() })
+		_, err = w.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		os.Stdin = r
+	}
+
+	setStdin("line one\nline two\n")
+	got, err := composePrompt("")
+	require.NoError(t, err)
+	assert.Equal(t, "line one\nline two", got, "multi-line input read until EOF")
+
+	setStdin("")
+	got, err = composePrompt("initial prompt")
+	require.NoError(t, err)
+	assert.Equal(t, "initial prompt", got, "empty input keeps the initial prompt")
+
+	t.Setenv("VISUAL", "  ")
+	t.Setenv("EDITOR", " ")
+	setStdin("typed prompt\n")
+	got, err = composePrompt("")
+	require.NoError(t, err)
+	assert.Equal(t, "typed prompt", got, "blank editor falls back to the built-in reader")
+}
+
+func TestReadFromStdin_LongLine(t *testing.T) {
+	oldStdin := os.Stdin
+	defer func() { os.Stdin = oldStdin }()
+
+	line := strings.Repeat("var a=1;", 40*1024) // 320KB single line, over the default scanner limit
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	go func() {
+		_, _ = w.WriteString(line + "\x00\xff\n")
+		_ = w.Close()
+	}()
+	os.Stdin = r
+
+	got, err := readFromStdin()
+	require.NoError(t, err)
+	assert.Equal(t, line+"\x00\xff", got, "long line and non-text bytes kept")
+}
+
 // getPromptForTest is a testable version of getPrompt that takes an explicit isPiped parameter
 func getPromptForTest(opts *options, isPiped bool) error {
 	if isPiped {
 		// read from stdin as if it were piped
-		scanner := bufio.NewScanner(os.Stdin)
-		var sb strings.Builder
-		for scanner.Scan() {
-			sb.WriteString(scanner.Text())
-			sb.WriteString("\n")
-		}
-		if err := scanner.Err(); err != nil {
+		stdinContent, err := readFromStdin()
+		if err != nil {
 			return err
 		}
-		stdinContent := strings.TrimSpace(sb.String())
 
 		// append stdin to existing prompt if present, or use stdin as prompt
 		if opts.Prompt != "" {
@@ -819,7 +1439,7 @@ func TestProcessPrompt_WithFile(t *testing.T) {
 	}
 
 	// process prompt
-	err = processPrompt(opts)
+	err = processPrompt(context.Background(), opts)
 	require.NoError(t, err, "processPrompt should not error")
 
 	// verify content
@@ -857,7 +1477,7 @@ func TestProcessPrompt_Simple(t *testing.T) {
 			}
 
 			// call processPrompt
-			err := processPrompt(opts)
+			err := processPrompt(context.Background(), opts)
 
 			if tt.expectError {
 				assert.Error(t, err, "Expected an error")
@@ -897,7 +1517,7 @@ func TestExecutePrompt_Verbose(t *testing.T) {
 	opts := &options{
 		Prompt:  "test prompt",
 		Timeout: 5 * time.Second,
-		Verbose: true, // enable verbose output
+		Verbose: []bool{true}, // enable verbose output
 	}
 
 	// execute the function
@@ -1118,7 +1738,7 @@ func TestBuildFullPrompt(t *testing.T) {
 			Files:  []string{},
 		}
 
-		err := buildFullPrompt(opts)
+		err := buildFullPrompt(context.Background(), opts)
 		require.NoError(t, err, "buildFullPrompt should not error")
 		assert.Equal(t, "initial", opts.Prompt, "Prompt should be unchanged with no files")
 	})
@@ -1136,7 +1756,7 @@ func TestBuildFullPrompt(t *testing.T) {
 			Files:       []string{testFilePath},
 		}
 
-		err = buildFullPrompt(opts)
+		err = buildFullPrompt(context.Background(), opts)
 		require.NoError(t, err, "buildFullPrompt should not error")
 
 		// check that the prompt contains both initial prompt and file content
@@ -1168,7 +1788,7 @@ func TestBuildFullPrompt(t *testing.T) {
 			MaxFileSize: 1024 * 1024,
 		}
 
-		err = buildFullPrompt(opts)
+		err = buildFullPrompt(context.Background(), opts)
 		require.NoError(t, err, "buildFullPrompt should not error")
 
 		// verify content
@@ -1183,7 +1803,7 @@ func TestBuildFullPrompt(t *testing.T) {
 			Files:  []string{"/nonexistent/file.txt"},
 		}
 
-		err := buildFullPrompt(opts)
+		err := buildFullPrompt(context.Background(), opts)
 		assert.Error(t, err, "Expected an error for non-existent file")
 	})
 }
@@ -1237,6 +1857,19 @@ func TestInitializeProviders(t *testing.T) {
 			expectedTypes:   []string{"openai"},
 			expectedMissing: []string{"anthropic", "google", "custom"},
 		},
+		{
+			name: "only deepseek enabled",
+			opts: &options{
+				DeepSeek: deepSeekOpts{
+					Enabled: true,
+					APIKey:  "test-key",
+					Model:   "deepseek-reasoner",
+				},
+			},
+			expectedCount:   1,
+			expectedTypes:   []string{"deepseek"},
+			expectedMissing: []string{"openai", "anthropic", "google"},
+		},
 		{
 			name: "custom provider without URL",
 			opts: &options{
@@ -1303,7 +1936,7 @@ func TestInitializeProviders(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			providers, err := initializeProviders(tt.opts)
+			providers, err := initializeProviders(context.Background(), tt.opts)
 
 			switch tt.name {
 			case "no providers enabled":
@@ -1410,6 +2043,128 @@ func TestOutputJSON(t *testing.T) {
 				`"timestamp": "`,
 			},
 		},
+		{
+			name: "truncated result",
+			execResult: &ExecutionResult{
+				Text:    "partial response",
+				Results: []provider.Result{{Provider: "TestProvider", Text: "partial response", Truncated: true}},
+			},
+			checkFields: []string{
+				`"provider": "TestProvider"`,
+				`"truncated": true`,
+			},
+		},
+		{
+			name: "response metadata",
+			execResult: &ExecutionResult{
+				Text: "answer",
+				Results: []provider.Result{{Provider: "Custom", Text: "answer", Model: "llama-3.1-70b", FinishReason: "stop",
+					Latency: 1500 * time.Millisecond, RequestID: "chatcmpl-42"}},
+			},
+			checkFields: []string{
+				`"model": "llama-3.1-70b"`,
+				`"finish_reason": "stop"`,
+				`"latency_ms": 1500`,
+				`"request_id": "chatcmpl-42"`,
+			},
+		},
+		{
+			name: "validated result",
+			execResult: &ExecutionResult{
+				Text:    "42",
+				Results: []provider.Result{{Provider: "TestProvider", Text: "42", ValidationAttempts: 2}},
+			},
+			checkFields: []string{
+				`"provider": "TestProvider"`,
+				`"validation_attempts": 2`,
+			},
+		},
+		{
+			name: "retried result",
+			execResult: &ExecutionResult{
+				Text: "answer",
+				Results: []provider.Result{{Provider: "OpenAI", Text: "answer", Attempts: []provider.Attempt{
+					{Number: 1, ErrorClass: provider.ErrorClassRateLimit, Error: "429 too many requests", Duration: 120 * time.Millisecond},
+					{Number: 2, Delay: 2 * time.Second, Duration: 900 * time.Millisecond}}}},
+			},
+			checkFields: []string{
+				`"attempts": [`,
+				`"attempt": 1`,
+				`"error_class": "rate_limit"`,
+				`"error": "429 too many requests"`,
+				`"duration_ms": 120`,
+				`"attempt": 2`,
+				`"delay_ms": 2000`,
+			},
+		},
+		{
+			name: "prompt tokens",
+			execResult: &ExecutionResult{
+				Text:    "answer",
+				Results: []provider.Result{{Provider: "OpenAI", Text: "answer"}},
+				Tokens:  []tokens.Count{{Provider: "OpenAI", Tokens: 1234, Estimated: true}},
+			},
+			checkFields: []string{
+				`"prompt_tokens": 1234`,
+				`"prompt_tokens_estimated": true`,
+			},
+		},
+		{
+			name: "token usage reported by provider",
+			execResult: &ExecutionResult{
+				Text:    "answer",
+				Results: []provider.Result{{Provider: "OpenAI", Text: "answer", Usage: provider.Usage{InputTokens: 120, OutputTokens: 35}}},
+			},
+			checkFields: []string{
+				`"prompt_tokens": 120`,
+				`"output_tokens": 35`,
+			},
+		},
+		{
+			name: "cost by token usage",
+			execResult: &ExecutionResult{
+				Text: "answer",
+				Results: []provider.Result{
+					{Provider: "OpenAI", Model: "gpt-5", Text: "answer", Usage: provider.Usage{InputTokens: 1000, OutputTokens: 200}},
+					{Provider: "Anthropic", Model: "claude-sonnet-4-5", Text: "answer", Usage: provider.Usage{InputTokens: 1000}},
+				},
+				Prices: pricing.Table{Models: map[string]pricing.Price{"gpt-5": {Provider: "openai", Input: 1.25, Output: 10},
+					"claude-sonnet-4-5": {Provider: "anthropic", Input: 3, Output: 15}}},
+			},
+			checkFields: []string{
+				`"cost_usd": 0.00325`,
+				`"cost_usd": 0.003`,
+				`"cost_usd": 0.00625`,
+			},
+		},
+		{
+			name: "all providers failed with structured error",
+			execResult: &ExecutionResult{
+				Results: []provider.Result{{Provider: "OpenAI", Error: &provider.Error{Provider: "OpenAI", Status: 429,
+					Code: "rate_limit_exceeded", Message: "rate limit", Retryable: true, Body: `{"error":{}}`}}},
+				Err: errors.New("all providers failed: OpenAI: rate limit"),
+			},
+			checkFields: []string{
+				`"error": "rate limit"`,
+				`"status": 429`,
+				`"code": "rate_limit_exceeded"`,
+				`"retryable": true`,
+				`"body": "{\"error\":{}}"`,
+				`"error": "all providers failed: OpenAI: rate limit"`,
+			},
+		},
+		{
+			name: "result with reasoning",
+			execResult: &ExecutionResult{
+				Text:      "42",
+				Results:   []provider.Result{{Provider: "DeepSeek", Text: "42", Reasoning: "thinking hard"}},
+				Reasoning: true,
+			},
+			checkFields: []string{
+				`"provider": "DeepSeek"`,
+				`"reasoning": "thinking hard"`,
+			},
+		},
 		{
 			name: "mixed results",
 			execResult: &ExecutionResult{
@@ -1439,6 +2194,59 @@ func TestOutputJSON(t *testing.T) {
 				`"timestamp": "`,
 			},
 		},
+		{
+			name: "mix provider chain",
+			execResult: &ExecutionResult{
+				Text:      "== mixed results by Google, refined by OpenAI ==\nRefined",
+				MixedText: "Refined",
+				Results:   []provider.Result{{Provider: "Google", Text: "Text 1"}, {Provider: "OpenAI", Text: "Text 2"}},
+				MixUsed:   true, MixProvider: "OpenAI",
+				MixStages: []mix.Stage{{Provider: "Google", Text: "Merged"}, {Provider: "OpenAI", Text: "Refined"},
+					{Provider: "Anthropic", Error: errors.New("rate limit")}},
+			},
+			checkFields: []string{
+				`"mix_provider": "OpenAI"`,
+				`"mix_stages": [`,
+				`"provider": "Google",
+      "text": "Merged"`,
+				`"provider": "OpenAI",
+      "text": "Refined"`,
+				`"provider": "Anthropic",
+      "error": "rate limit"`,
+			},
+		},
+		{
+			name: "consensus not achieved with explanation",
+			execResult: &ExecutionResult{
+				Text:      "== mixed results by OpenAI ==\nMixed\n\n== points of disagreement ==\n- A vs B",
+				MixedText: "Mixed",
+				Results:   []provider.Result{{Provider: "OpenAI", Text: "A"}, {Provider: "Google", Text: "B"}},
+				MixUsed:   true, MixProvider: "OpenAI",
+				ConsensusAttempted: true, ConsensusAttempts: 1, ConsensusExplanation: "- A vs B",
+			},
+			checkFields: []string{
+				`"consensus_attempted": true`,
+				`"consensus_attempts": 1`,
+				`"consensus_explanation": "- A vs B"`,
+				`points of disagreement`,
+			},
+		},
+		{
+			name: "identical answers",
+			execResult: &ExecutionResult{
+				Text: "== identical answer from OpenAI, Google ==\nParis\n",
+				Results: []provider.Result{{Provider: "OpenAI", Text: "Paris"}, {Provider: "Anthropic", Text: "Lyon"},
+					{Provider: "Google", Text: "Paris  "}},
+			},
+			checkFields: []string{
+				`"provider": "Google",
+      "text": "Paris  ",
+      "duplicate_of": "OpenAI"`,
+				`"provider": "Anthropic",
+      "text": "Lyon"
+    }`,
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -1495,6 +2303,28 @@ func TestOutputJSON(t *testing.T) {
 	}
 }
 
+func TestWriteJSON_Raw(t *testing.T) {
+	result := &ExecutionResult{Text: "ok", Results: []provider.Result{
+		{Provider: "OpenAI", Text: "ok", Raw: [][]byte{[]byte(`{"id": "resp-1", "output": []}`),
+			[]byte("event: done\ndata: {}\n")}},
+		{Provider: "Google", Text: "ok"},
+	}}
+	var buf bytes.Buffer
+	require.NoError(t, writeJSON(&buf, result))
+	var out struct {
+		Responses []struct {
+			Provider string `json:"provider"`
+			Raw      []any  `json:"raw"`
+		} `json:"responses"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+	require.Len(t, out.Responses, 2)
+	assert.Equal(t, []any{map[string]any{"id": "resp-1", "output": []any{}}, "event: done\ndata: {}\n"},
+		out.Responses[0].Raw, "json responses embedded as is, others as strings")
+	assert.Nil(t, out.Responses[1].Raw)
+	assert.Equal(t, 1, strings.Count(buf.String(), `"raw"`), "raw omitted if not captured")
+}
+
 // TestExecutePrompt_JSON tests that executePrompt returns the correct ExecutionResult for JSON output
 func TestExecutePrompt_JSON(t *testing.T) {
 	// setup mock provider
@@ -1888,6 +2718,96 @@ func TestExecutePrompt_WithMixJSON(t *testing.T) {
 	require.Len(t, responses, 2, "Should have two responses")
 }
 
+func TestExecutePrompt_WithMixShowIndividual(t *testing.T) {
+	mockProvider1 := &mocks.ProviderMock{
+		GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+			if strings.Contains(prompt, "merge results") {
+				return "Mixed result combining all inputs", nil
+			}
+			return "Result from Provider1", nil
+		},
+		NameFunc:    func() string { return "Provider1" },
+		EnabledFunc: func() bool { return true },
+	}
+	mockProvider2 := &mocks.ProviderMock{
+		GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+			return "Result from Provider2", nil
+		},
+		NameFunc:    func() string { return "Provider2" },
+		EnabledFunc: func() bool { return true },
+	}
+	providers := []provider.Provider{mockProvider1, mockProvider2}
+
+	t.Run("individual results shown before mixed", func(t *testing.T) {
+		opts := &options{
+			Prompt:            "test prompt",
+			Timeout:           5 * time.Second,
+			MixEnabled:        true,
+			MixProvider:       "provider1",
+			MixPrompt:         "merge results from all providers",
+			MixShowIndividual: true,
+		}
+		result, err := executePrompt(context.Background(), opts, providers)
+		require.NoError(t, err)
+		assert.True(t, result.MixUsed)
+		assert.Equal(t, "Mixed result combining all inputs", result.MixedText)
+		assert.Equal(t, "== mixed results by Provider1 ==\nMixed result combining all inputs", result.Text,
+			"individual results kept out of final text")
+
+		// plain text output joins individual results and the mixed result
+		oldStdout := os.Stdout
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		os.Stdout = w
+		err = outputResult(opts, result)
+		w.Close()
+		os.Stdout = oldStdout
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		_, _ = io.Copy(&buf, r)
+		output := buf.String()
+
+		p1Idx := strings.Index(output, "== generated by Provider1 ==\nResult from Provider1")
+		p2Idx := strings.Index(output, "== generated by Provider2 ==\nResult from Provider2")
+		mixIdx := strings.Index(output, "== mixed results by Provider1 ==\nMixed result combining all inputs")
+		require.NotEqual(t, -1, p1Idx, "text should contain Provider1 result")
+		require.NotEqual(t, -1, p2Idx, "text should contain Provider2 result")
+		require.NotEqual(t, -1, mixIdx, "text should contain mixed result")
+		assert.Less(t, p1Idx, p2Idx)
+		assert.Less(t, p2Idx, mixIdx)
+
+		// json output keeps individual responses and the mixed result in separate fields
+		buf.Reset()
+		require.NoError(t, writeJSON(&buf, result))
+		var out struct {
+			Final     string `json:"final"`
+			Mixed     string `json:"mixed"`
+			Responses []struct {
+				Provider string `json:"provider"`
+				Text     string `json:"text"`
+			} `json:"responses"`
+		}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+		assert.Equal(t, result.Text, out.Final)
+		assert.Equal(t, "Mixed result combining all inputs", out.Mixed)
+		require.Len(t, out.Responses, 2)
+		assert.Equal(t, "Result from Provider1", out.Responses[0].Text)
+	})
+
+	t.Run("mixed result only by default", func(t *testing.T) {
+		opts := &options{
+			Prompt:      "test prompt",
+			Timeout:     5 * time.Second,
+			MixEnabled:  true,
+			MixProvider: "provider1",
+			MixPrompt:   "merge results from all providers",
+		}
+		result, err := executePrompt(context.Background(), opts, providers)
+		require.NoError(t, err)
+		assert.Equal(t, "== mixed results by Provider1 ==\nMixed result combining all inputs", result.Text)
+	})
+}
+
 // TestIsConsensusReached tests the consensus detection logic
 
 // TestProcessMixModeWithConsensus tests the mix mode with consensus enabled
@@ -2030,3 +2950,2121 @@ func TestCustomSpec_UnmarshalFlag(t *testing.T) {
 		})
 	}
 }
+
+func TestNewProviderFactory(t *testing.T) {
+	opts := &options{
+		OpenAI: openAIOpts{Enabled: true, APIKey: "key", Model: "gpt-5", MaxTokens: 1024},
+		Customs: map[string]customSpec{
+			"local": {CustomSpec: config.CustomSpec{Name: "Local", URL: "http://localhost:1234", Model: "llama", Enabled: true}},
+		},
+		Retry: retryOpts{Attempts: 1},
+	}
+	factory := newProviderFactory(opts)
+
+	t.Run("standard provider", func(t *testing.T) {
+		p, err := factory("openai", "gpt-5-mini")
+		require.NoError(t, err)
+		assert.Equal(t, "OpenAI", p.Name())
+		assert.True(t, p.Enabled())
+	})
+
+	t.Run("custom provider", func(t *testing.T) {
+		p, err := factory("local", "llama-2")
+		require.NoError(t, err)
+		assert.Equal(t, "Local", p.Name())
+	})
+
+	t.Run("disabled standard provider", func(t *testing.T) {
+		_, err := factory("anthropic", "claude")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `custom provider "anthropic" not found`)
+	})
+}
+
+func TestExecutePrompt_Review(t *testing.T) {
+	newProvider := func(name, text string) *mocks.ProviderMock {
+		return &mocks.ProviderMock{
+			NameFunc:     func() string { return name },
+			EnabledFunc:  func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return text, nil },
+		}
+	}
+	providers := []provider.Provider{
+		newProvider("Provider1", "```json\n"+`[{"file": "main.go", "start_line": 5, "severity": "error", "message": "bug"}]`+"\n```"),
+		newProvider("Provider2", `[{"file": "main.go", "start_line": 5, "severity": "warning", "message": "possible bug"},
+			{"file": "util.go", "start_line": 1, "severity": "note", "message": "rename"}]`),
+	}
+
+	opts := &options{Prompt: "review this", Timeout: 5 * time.Second, Review: true}
+	result, err := executePrompt(context.Background(), opts, providers)
+	require.NoError(t, err)
+	require.NotNil(t, result.Review)
+	require.Len(t, result.Review.Findings, 2)
+	assert.Equal(t, []string{"Provider1", "Provider2"}, result.Review.Findings[0].Providers)
+	assert.Contains(t, result.Text, "== main.go ==\n[error] line 5: bug (Provider1, Provider2)")
+	assert.Contains(t, result.Text, "== util.go ==\n[note] line 1: rename (Provider2)")
+
+	t.Run("sarif file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "review.sarif")
+		require.NoError(t, writeSARIFFile(path, result.Review))
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"version": "2.1.0"`)
+		assert.Contains(t, string(data), `"uri": "util.go"`)
+
+		err = writeSARIFFile(filepath.Join(t.TempDir(), "missing", "review.sarif"), result.Review)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to create sarif file")
+	})
+
+	t.Run("json output includes findings", func(t *testing.T) {
+		oldStdout := os.Stdout
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		os.Stdout = w
+		err = outputJSON(result)
+		w.Close()
+		os.Stdout = oldStdout
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		_, _ = io.Copy(&buf, r)
+		var out struct {
+			Findings []map[string]any `json:"findings"`
+		}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+		require.Len(t, out.Findings, 2)
+		assert.Equal(t, "main.go", out.Findings[0]["file"])
+	})
+}
+
+func TestProcessPrompt_Review(t *testing.T) {
+	opts := &options{Prompt: "review this code", Review: true}
+	require.NoError(t, processPrompt(context.Background(), opts))
+	assert.True(t, strings.HasPrefix(opts.Prompt, "review this code\n\n"))
+	assert.True(t, strings.HasSuffix(opts.Prompt, review.Instructions))
+}
+
+func TestFindEmbedder(t *testing.T) {
+	t.Run("anthropic only", func(t *testing.T) {
+		opts := &options{Anthropic: anthropicOpts{Enabled: true, APIKey: "key", Model: "claude"}}
+		_, err := findEmbedder(opts)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "requires an enabled provider with embeddings support")
+	})
+
+	t.Run("openai enabled", func(t *testing.T) {
+		opts := &options{
+			Anthropic: anthropicOpts{Enabled: true, APIKey: "key", Model: "claude"},
+			OpenAI:    openAIOpts{Enabled: true, APIKey: "key", Model: "gpt-4o"},
+		}
+		embedder, err := findEmbedder(opts)
+		require.NoError(t, err)
+		assert.IsType(t, &provider.OpenAI{}, embedder)
+	})
+
+	t.Run("custom embeddings provider preferred", func(t *testing.T) {
+		opts := &options{
+			OpenAI: openAIOpts{Enabled: true, APIKey: "key", Model: "gpt-4o"},
+			Customs: map[string]customSpec{"embed": {CustomSpec: config.CustomSpec{Name: "Ollama", URL: "http://localhost:11434",
+				Model: "nomic-embed-text", EndpointType: "embeddings", Enabled: true}}},
+		}
+		embedder, err := findEmbedder(opts)
+		require.NoError(t, err)
+		require.IsType(t, &provider.CustomOpenAI{}, embedder)
+		assert.Equal(t, "Ollama", embedder.(*provider.CustomOpenAI).Name())
+	})
+
+	t.Run("build prompt fails without embedder", func(t *testing.T) {
+		opts := &options{Prompt: "question", Files: []string{"main.go"}, FilesRelevant: true, FilesTopK: 5,
+			Anthropic: anthropicOpts{Enabled: true, APIKey: "key", Model: "claude"}}
+		err := buildFullPrompt(context.Background(), opts)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "embeddings support")
+	})
+}
+
+func TestExecutePrompt_ShowReasoning(t *testing.T) {
+	reasoner := &reasoningProvider{name: "DeepSeek", text: "42", reasoning: "thinking hard"}
+	plain := &mocks.ProviderMock{
+		NameFunc:     func() string { return "OpenAI" },
+		EnabledFunc:  func() bool { return true },
+		GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return "forty two", nil },
+	}
+
+	t.Run("single provider", func(t *testing.T) {
+		opts := &options{Prompt: "question", Timeout: 5 * time.Second, ShowReasoning: true}
+		result, err := executePrompt(context.Background(), opts, []provider.Provider{reasoner})
+		require.NoError(t, err)
+		assert.Equal(t, "--- reasoning ---\nthinking hard\n--- answer ---\n42", result.Text)
+		assert.Equal(t, "thinking hard", result.Results[0].Reasoning)
+	})
+
+	t.Run("multiple providers", func(t *testing.T) {
+		opts := &options{Prompt: "question", Timeout: 5 * time.Second, ShowReasoning: true}
+		result, err := executePrompt(context.Background(), opts, []provider.Provider{reasoner, plain})
+		require.NoError(t, err)
+		assert.Equal(t, "== generated by DeepSeek ==\n--- reasoning ---\nthinking hard\n--- answer ---\n42\n"+
+			"\n== generated by OpenAI ==\nforty two\n", result.Text)
+	})
+
+	t.Run("reasoning hidden by default", func(t *testing.T) {
+		opts := &options{Prompt: "question", Timeout: 5 * time.Second}
+		result, err := executePrompt(context.Background(), opts, []provider.Provider{reasoner})
+		require.NoError(t, err)
+		assert.Equal(t, "42", result.Text)
+		assert.Equal(t, "thinking hard", result.Results[0].Reasoning, "results are not modified")
+
+		var buf bytes.Buffer
+		require.NoError(t, writeJSON(&buf, result))
+		assert.NotContains(t, buf.String(), "reasoning", "reasoning dropped from json output")
+	})
+
+	t.Run("single successful provider with failures", func(t *testing.T) {
+		failing := &mocks.ProviderMock{
+			NameFunc:     func() string { return "Google" },
+			EnabledFunc:  func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return "", errors.New("quota exceeded") },
+		}
+		opts := &options{Prompt: "question", Timeout: 5 * time.Second, ShowReasoning: true}
+		result, err := executePrompt(context.Background(), opts, []provider.Provider{reasoner, failing})
+		require.NoError(t, err)
+		assert.Equal(t, "--- reasoning ---\nthinking hard\n--- answer ---\n42", result.Text)
+	})
+
+	t.Run("no reasoning available", func(t *testing.T) {
+		opts := &options{Prompt: "question", Timeout: 5 * time.Second, ShowReasoning: true}
+		result, err := executePrompt(context.Background(), opts, []provider.Provider{plain})
+		require.NoError(t, err)
+		assert.Equal(t, "forty two", result.Text)
+	})
+}
+
+// reasoningProvider returns a response with reasoning trace
+type reasoningProvider struct {
+	name, text, reasoning string
+}
+
+func (p *reasoningProvider) Name() string  { return p.name }
+func (p *reasoningProvider) Enabled() bool { return true }
+func (p *reasoningProvider) Generate(context.Context, string) (string, error) {
+	return p.text, nil
+}
+
+func (p *reasoningProvider) GenerateResponse(context.Context, string) (provider.Response, error) {
+	return provider.Response{Text: p.text, Reasoning: p.reasoning}, nil
+}
+
+func TestExecutePrompt_First(t *testing.T) {
+	fast := &mocks.ProviderMock{
+		NameFunc:     func() string { return "Fast" },
+		EnabledFunc:  func() bool { return true },
+		GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return "fast answer", nil },
+	}
+	slow := &mocks.ProviderMock{
+		NameFunc:    func() string { return "Slow" },
+		EnabledFunc: func() bool { return true },
+		GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		},
+	}
+
+	opts := &options{Prompt: "question", Timeout: 5 * time.Second, First: true}
+	result, err := executePrompt(context.Background(), opts, []provider.Provider{slow, fast})
+	require.NoError(t, err)
+	assert.Equal(t, "fast answer", result.Text)
+	require.Len(t, result.Results, 1)
+	assert.Equal(t, "Fast", result.Results[0].Provider)
+}
+
+func TestWriteStructured(t *testing.T) {
+	result := &ExecutionResult{
+		Text: "final",
+		Results: []provider.Result{
+			{Provider: "OpenAI", Model: "gpt-4o", Latency: 1200 * time.Millisecond, Text: "first line\nsecond\tline"},
+			{Provider: "Google", Error: errors.New("rate limit")},
+			{Provider: "Anthropic", Model: "claude", Text: "cut", Truncated: true, Usage: provider.Usage{InputTokens: 30, OutputTokens: 5}},
+		},
+		Tokens:      []tokens.Count{{Provider: "OpenAI", Tokens: 42, Estimated: true}},
+		MixUsed:     true,
+		MixProvider: "OpenAI",
+		MixedText:   "merged, answer",
+	}
+
+	t.Run("yaml", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeStructured(&buf, &options{OutputFormat: "yaml"}, result))
+		out := buf.String()
+		assert.True(t, strings.HasPrefix(out, "final: final\nresponses:\n  - provider: OpenAI\n"), out)
+		assert.Contains(t, out, "    text: |-\n      first line\n      second\tline\n", "multiline text as literal block")
+		assert.Contains(t, out, "    latency_ms: 1200\n")
+		assert.Contains(t, out, "    prompt_tokens: 42\n")
+		assert.Contains(t, out, "  - provider: Google\n    error: rate limit\n")
+		assert.Contains(t, out, "mixed: merged, answer\n")
+
+		var parsed struct {
+			Responses []struct {
+				Provider string `yaml:"provider"`
+				Text     string `yaml:"text"`
+			} `yaml:"responses"`
+		}
+		require.NoError(t, yaml.Unmarshal(buf.Bytes(), &parsed))
+		require.Len(t, parsed.Responses, 3)
+		assert.Equal(t, "first line\nsecond\tline", parsed.Responses[0].Text)
+	})
+
+	t.Run("tsv", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeStructured(&buf, &options{OutputFormat: "tsv"}, result))
+		assert.Equal(t, "provider\tmodel\tlatency_ms\tprompt_tokens\tstatus\ttext\n"+
+			"OpenAI\tgpt-4o\t1200\t42\tok\t\"first line\nsecond\tline\"\n"+
+			"Google\t\t0\t\terror\trate limit\n"+
+			"Anthropic\tclaude\t0\t30\ttruncated\tcut\n"+
+			"mix (OpenAI)\t\t\t\tok\tmerged, answer\n", buf.String())
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeStructured(&buf, &options{OutputFormat: "csv"}, result))
+		rows, err := csv.NewReader(&buf).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, rows, 5)
+		assert.Equal(t, []string{"OpenAI", "gpt-4o", "1200", "42", "ok", "first line\nsecond\tline"}, rows[1])
+		assert.Equal(t, []string{"mix (OpenAI)", "", "", "", "ok", "merged, answer"}, rows[4])
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeStructured(&buf, &options{JSON: true}, result))
+		assert.Contains(t, buf.String(), `"final": "final"`)
+	})
+}
+
+// counterProvider is a provider counting tokens with its own tokenizer
+type counterProvider struct {
+	*mocks.ProviderMock
+	tokens int
+}
+
+func (p counterProvider) CountTokens(context.Context, string) (int, error) { return p.tokens, nil }
+
+func TestCountPromptTokens(t *testing.T) {
+	openai := &mocks.ProviderMock{NameFunc: func() string { return "OpenAI" }}
+	anthropic := counterProvider{ProviderMock: &mocks.ProviderMock{NameFunc: func() string { return "Anthropic" }}, tokens: 7}
+	providers := []provider.Provider{openai, anthropic}
+
+	t.Run("count", func(t *testing.T) {
+		opts := &options{Prompt: "Hello, world! This is a test.", Tokens: tokensOpts{Count: true}}
+		require.NoError(t, countPromptTokens(context.Background(), opts, providers))
+		assert.Equal(t, []tokens.Count{{Provider: "OpenAI", Tokens: 9, Estimated: true}, {Provider: "Anthropic", Tokens: 7}},
+			opts.tokens)
+	})
+
+	t.Run("prompt variant", func(t *testing.T) {
+		opts := &options{Prompt: "short", variants: promptVariants{base: "short",
+			providers: map[string]string{"openai": "much longer prompt variant"}}}
+		require.NoError(t, countPromptTokens(context.Background(), opts, providers))
+		assert.Equal(t, 5, opts.tokens[0].Tokens)
+	})
+
+	t.Run("max exceeded", func(t *testing.T) {
+		opts := &options{Prompt: "Hello, world! This is a test.", Tokens: tokensOpts{Max: 8}}
+		err := countPromptTokens(context.Background(), opts, providers)
+		require.EqualError(t, err, "prompt of 9 tokens for OpenAI exceeds max prompt tokens 8")
+
+		opts.Tokens.Max = 9
+		require.NoError(t, countPromptTokens(context.Background(), opts, providers))
+	})
+}
+
+func TestRequiredProviders(t *testing.T) {
+	opts := &options{OpenAI: openAIOpts{Enabled: true, Required: true}, Google: googleOpts{Enabled: true},
+		Anthropic: anthropicOpts{Required: true}, Custom: customOpenAIProvider{Enabled: true, Name: "Local",
+			URL: "http://localhost:1", Model: "llama", Required: true}}
+	assert.Equal(t, []string{"OpenAI", "Local"}, requiredProviders(opts), "disabled providers are not required")
+
+	opts.Skip = []string{"local"}
+	assert.Equal(t, []string{"OpenAI"}, requiredProviders(opts), "skipped providers are not required")
+	opts.Skip, opts.Only = nil, []string{"google,local"}
+	assert.Equal(t, []string{"Local"}, requiredProviders(opts))
+
+	t.Run("run fails with failed required provider", func(t *testing.T) {
+		newProvider := func(name string, err error) provider.Provider {
+			return &mocks.ProviderMock{NameFunc: func() string { return name }, EnabledFunc: func() bool { return true },
+				GenerateFunc: func(context.Context, string) (string, error) { return "answer of " + name, err }}
+		}
+		opts := &options{Prompt: "test", OpenAI: openAIOpts{Enabled: true, Required: true}, Google: googleOpts{Enabled: true}}
+		res, err := executePrompt(context.Background(), opts, []provider.Provider{newProvider("OpenAI", nil),
+			newProvider("Google", errors.New("overloaded"))})
+		require.NoError(t, err, "optional provider failure is not fatal")
+		assert.Contains(t, res.Text, "answer of OpenAI")
+
+		_, err = executePrompt(context.Background(), opts, []provider.Provider{newProvider("OpenAI", errors.New("overloaded")),
+			newProvider("Google", nil)})
+		require.EqualError(t, err, "required provider OpenAI failed: overloaded")
+	})
+}
+
+func TestLoadLimiter(t *testing.T) {
+	opts := &options{OpenAI: openAIOpts{Enabled: true}, Anthropic: anthropicOpts{Parallel: 1}}
+	loadLimiter(opts)
+	assert.Nil(t, opts.limiter, "no limiter without limits of enabled providers")
+
+	opts = &options{OpenAI: openAIOpts{Enabled: true, Parallel: 4}, Custom: customOpenAIProvider{Enabled: true,
+		Name: "Local", URL: "http://localhost:1", Model: "llama", Parallel: 1}}
+	loadLimiter(opts)
+	require.NotNil(t, opts.limiter)
+	release, err := opts.limiter.Acquire(context.Background(), "local")
+	require.NoError(t, err)
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = opts.limiter.Acquire(ctx, "Local")
+	require.ErrorIs(t, err, context.DeadlineExceeded, "custom provider limited to a single request")
+
+	opts.OpenAI.Parallel = -1
+	require.EqualError(t, validateOptions(opts), "OpenAI parallel requests can't be negative, got -1")
+}
+
+func TestFilterProviders(t *testing.T) {
+	newProvider := func(name string) provider.Provider {
+		return &mocks.ProviderMock{NameFunc: func() string { return name }, EnabledFunc: func() bool { return true }}
+	}
+	providers := []provider.Provider{newProvider("OpenAI"), newProvider("Anthropic"), newProvider("Google")}
+
+	tests := []struct {
+		name    string
+		only    []string
+		skip    []string
+		want    []string
+		wantErr string
+	}{
+		{name: "no filters", want: []string{"OpenAI", "Anthropic", "Google"}},
+		{name: "only comma-separated", only: []string{"openai,google"}, want: []string{"OpenAI", "Google"}},
+		{name: "only repeated flag", only: []string{"google", " Anthropic "}, want: []string{"Anthropic", "Google"}},
+		{name: "skip", skip: []string{"anthropic"}, want: []string{"OpenAI", "Google"}},
+		{name: "only and skip", only: []string{"openai,google"}, skip: []string{"GOOGLE"}, want: []string{"OpenAI"}},
+		{name: "only unknown provider", only: []string{"deepseek"},
+			wantErr: "no providers left after applying --only and --skip filters"},
+		{name: "skip all", skip: []string{"openai,anthropic,google"},
+			wantErr: "no providers left after applying --only and --skip filters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := filterProviders(providers, tt.only, tt.skip)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			names := make([]string, 0, len(res))
+			for _, p := range res {
+				names = append(names, p.Name())
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
+
+func TestProviderTimeouts(t *testing.T) {
+	tests := []struct {
+		name string
+		opts options
+		want map[string]provider.Timeouts
+	}{
+		{
+			name: "global timeouts",
+			opts: options{TimeoutConnect: 10 * time.Second, TimeoutGeneration: time.Minute},
+			want: map[string]provider.Timeouts{
+				"OpenAI": {Connect: 10 * time.Second, Generation: time.Minute},
+				"Google": {Connect: 10 * time.Second, Generation: time.Minute},
+			},
+		},
+		{
+			name: "deprecated timeout overrides generation timeout",
+			opts: options{Timeout: 2 * time.Minute, TimeoutConnect: 10 * time.Second, TimeoutGeneration: time.Minute},
+			want: map[string]provider.Timeouts{
+				"OpenAI": {Connect: 10 * time.Second, Generation: 2 * time.Minute},
+			},
+		},
+		{
+			name: "per-provider overrides",
+			opts: options{TimeoutConnect: 10 * time.Second, TimeoutGeneration: time.Minute,
+				OpenAI:   openAIOpts{timeoutOpts: timeoutOpts{TimeoutConnect: time.Second}},
+				DeepSeek: deepSeekOpts{timeoutOpts: timeoutOpts{TimeoutGeneration: 10 * time.Minute}}},
+			want: map[string]provider.Timeouts{
+				"OpenAI":    {Connect: time.Second, Generation: time.Minute},
+				"Anthropic": {Connect: 10 * time.Second, Generation: time.Minute},
+				"DeepSeek":  {Connect: 10 * time.Second, Generation: 10 * time.Minute},
+			},
+		},
+		{
+			name: "auto timeout scaled by max output tokens",
+			opts: options{TimeoutConnect: 10 * time.Second, TimeoutGeneration: time.Minute, TimeoutAuto: true,
+				TimeoutAutoBase: 15 * time.Second, TimeoutAutoPer1K: 2 * time.Second, MaxOutputTokens: 4000,
+				DeepSeek: deepSeekOpts{timeoutOpts: timeoutOpts{TimeoutGeneration: 10 * time.Minute}}},
+			want: map[string]provider.Timeouts{
+				"OpenAI":   {Connect: 10 * time.Second, Generation: 23 * time.Second},
+				"DeepSeek": {Connect: 10 * time.Second, Generation: 10 * time.Minute},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, cfg := range getStandardProviderConfigs(&tt.opts) {
+				if want, ok := tt.want[cfg.name]; ok {
+					assert.Equal(t, want, cfg.timeouts, cfg.name)
+				}
+			}
+		})
+	}
+}
+
+func TestAutoTimeout(t *testing.T) {
+	opts := &options{TimeoutAutoBase: 10 * time.Second, TimeoutAutoPer1K: 3 * time.Second}
+	assert.Equal(t, 10*time.Second, autoTimeout(opts, 0))
+	assert.Equal(t, 16*time.Second, autoTimeout(opts, 2000))
+	assert.Equal(t, 10*time.Second, autoTimeout(opts, -1), "model maximum")
+
+	opts.Prompt = strings.Repeat("word ", 10000)
+	want := 10*time.Second + (3 * time.Second * time.Duration(tokens.Estimate(opts.Prompt)+2000) / 1000).Round(time.Second)
+	assert.Equal(t, want, autoTimeout(opts, 2000))
+	assert.Greater(t, want, 16*time.Second)
+
+	t.Run("custom providers", func(t *testing.T) {
+		opts := &options{TimeoutConnect: 10 * time.Second, TimeoutGeneration: time.Minute, TimeoutAuto: true,
+			TimeoutAutoBase: 10 * time.Second, TimeoutAutoPer1K: 3 * time.Second}
+		opts.Customs = map[string]customSpec{
+			"local": {CustomSpec: config.CustomSpec{URL: "http://localhost:1234/v1", Model: "m", MaxTokens: 4000, Enabled: true}},
+			"slow": {CustomSpec: config.CustomSpec{URL: "http://localhost:1234/v1", Model: "m", MaxTokens: 4000, Enabled: true,
+				Timeouts: provider.Timeouts{Generation: 10 * time.Minute}}},
+		}
+		specs := createCustomManager(opts).Specs()
+		require.Len(t, specs, 2)
+		assert.Equal(t, 22*time.Second, specs[0].Timeouts.Generation)
+		assert.Equal(t, 10*time.Minute, specs[1].Timeouts.Generation, "own timeout kept")
+	})
+}
+
+func TestModelAliases(t *testing.T) {
+	t.Run("built-in aliases", func(t *testing.T) {
+		opts := &options{
+			OpenAI:    openAIOpts{Model: "gpt-latest"},
+			Anthropic: anthropicOpts{Model: "sonnet"},
+			Google:    googleOpts{Model: "gemini-2.5-pro"},
+		}
+		require.NoError(t, loadModelAliases(opts))
+		models := map[string]string{}
+		for _, cfg := range getStandardProviderConfigs(opts) {
+			models[cfg.name] = cfg.model
+		}
+		assert.Equal(t, "gpt-5", models["OpenAI"])
+		assert.Equal(t, "claude-sonnet-4-5", models["Anthropic"])
+		assert.Equal(t, "gemini-2.5-pro", models["Google"], "concrete model unchanged")
+	})
+
+	t.Run("aliases file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "aliases.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"anthropic": {"sonnet": "claude-sonnet-5"}}`), 0o600))
+		opts := &options{Anthropic: anthropicOpts{Model: "sonnet"}, ModelAliases: path}
+		require.NoError(t, loadModelAliases(opts))
+		assert.Equal(t, "claude-sonnet-5", getStandardProviderConfigs(opts)[1].model)
+	})
+
+	t.Run("missing aliases file", func(t *testing.T) {
+		opts := &options{ModelAliases: filepath.Join(t.TempDir(), "missing.json")}
+		require.ErrorContains(t, loadModelAliases(opts), "failed to read model aliases file")
+	})
+}
+
+func TestShowProgress(t *testing.T) {
+	assert.False(t, showProgress(&options{NoProgress: true}))
+	assert.False(t, showProgress(&options{Quiet: true}))
+	assert.False(t, showProgress(&options{Debug: true}))
+	assert.False(t, showProgress(&options{}), "stderr of tests is not a terminal")
+}
+
+func TestExecOnComplete(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh commands")
+	}
+	result := &ExecutionResult{
+		Text:    "answer",
+		Results: []provider.Result{{Provider: "OpenAI", Text: "answer"}},
+	}
+
+	t.Run("result passed on stdin", func(t *testing.T) {
+		outFile := filepath.Join(t.TempDir(), "result.json")
+		require.NoError(t, execOnComplete(context.Background(), "cat > "+outFile, result))
+
+		data, err := os.ReadFile(outFile) //nolint:gosec // test file
+		require.NoError(t, err)
+		var got struct {
+			Responses []struct {
+				Provider string `json:"provider"`
+				Text     string `json:"text"`
+			} `json:"responses"`
+		}
+		require.NoError(t, json.Unmarshal(data, &got))
+		require.Len(t, got.Responses, 1)
+		assert.Equal(t, "OpenAI", got.Responses[0].Provider)
+		assert.Equal(t, "answer", got.Responses[0].Text)
+	})
+
+	t.Run("failed command", func(t *testing.T) {
+		err := execOnComplete(context.Background(), "exit 3", result)
+		require.ErrorContains(t, err, "exec-on-complete command failed: exit status 3")
+	})
+
+	t.Run("no command", func(t *testing.T) {
+		require.NoError(t, execOnComplete(context.Background(), "", result))
+	})
+
+	t.Run("runs with canceled run context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		outFile := filepath.Join(t.TempDir(), "result.json")
+		require.NoError(t, execOnComplete(ctx, "cat > "+outFile, result))
+		assert.FileExists(t, outFile)
+	})
+}
+
+func TestLoadValidator(t *testing.T) {
+	opts := &options{}
+	require.NoError(t, loadValidator(opts))
+	assert.Nil(t, opts.validator, "no validation requested")
+
+	opts = &options{Validate: `^\d+$`, ValidateAttempts: 2}
+	require.NoError(t, loadValidator(opts))
+	require.NotNil(t, opts.validator)
+	p := &mocks.ProviderMock{NameFunc: func() string { return "test" }}
+	wrapped := wrapProviders(opts, []provider.Provider{p})
+	_, ok := wrapped[0].(*provider.ValidatingProvider)
+	assert.True(t, ok, "providers wrapped with validation")
+
+	err := loadValidator(&options{Validate: "(bad"})
+	require.ErrorContains(t, err, "failed to set up answer validation")
+}
+
+func TestLoadNormalizer(t *testing.T) {
+	opts := &options{}
+	require.NoError(t, loadNormalizer(opts))
+	assert.Nil(t, opts.normalizer, "no normalization requested")
+
+	opts = &options{Normalize: true, Validate: `^\d+$`}
+	require.NoError(t, loadNormalizer(opts))
+	require.NoError(t, loadValidator(opts))
+	require.NotNil(t, opts.normalizer)
+	p := &mocks.ProviderMock{NameFunc: func() string { return "test" },
+		GenerateFunc: func(context.Context, string) (string, error) { return "Sure! Here is the number:\n\n42", nil }}
+	wrapped := wrapProviders(opts, []provider.Provider{p})
+	text, err := wrapped[0].Generate(context.Background(), "prompt")
+	require.NoError(t, err)
+	assert.Equal(t, "42", text, "answer normalized before validation")
+
+	rules := filepath.Join(t.TempDir(), "rules.yml")
+	require.NoError(t, os.WriteFile(rules, []byte("disable: [unknown]"), 0o600))
+	err = loadNormalizer(&options{Normalize: true, NormalizeRules: rules})
+	require.ErrorContains(t, err, "failed to set up answer normalization")
+}
+
+func TestWrapProviders_Faults(t *testing.T) {
+	newMock := func(name string) *mocks.ProviderMock {
+		return &mocks.ProviderMock{
+			NameFunc:     func() string { return name },
+			EnabledFunc:  func() bool { return true },
+			GenerateFunc: func(context.Context, string) (string, error) { return "answer of " + name, nil },
+		}
+	}
+	openai, anthropic := newMock("OpenAI"), newMock("Anthropic")
+	opts := &options{Fault: faultOpts{Providers: map[string]string{"OpenAI": "auth"}}, Retry: retryOpts{Attempts: 3}}
+	wrapped := wrapProviders(opts, []provider.Provider{openai, anthropic})
+
+	_, err := wrapped[0].Generate(context.Background(), "prompt")
+	require.ErrorContains(t, err, "injected auth failure")
+	assert.Empty(t, openai.GenerateCalls(), "request failed before reaching the provider")
+
+	res, err := wrapped[1].Generate(context.Background(), "prompt")
+	require.NoError(t, err)
+	assert.Equal(t, "answer of Anthropic", res)
+}
+
+func TestApplyAnswer(t *testing.T) {
+	answer := "```go title=main.go\npackage main\n```\n"
+	dir := filepath.Join(t.TempDir(), "out")
+
+	t.Run("dry run", func(t *testing.T) {
+		var buf bytes.Buffer
+		opts := &options{Apply: applyOpts{Dir: dir, DryRun: true}}
+		err := applyAnswer(&buf, opts, &ExecutionResult{Results: []provider.Result{{Provider: "OpenAI", Text: answer},
+			{Provider: "Google", Error: errors.New("failed")}}})
+		require.NoError(t, err)
+		assert.Equal(t, "would write "+filepath.Join(dir, "main.go")+", 13 bytes, new\n", buf.String())
+		assert.NoDirExists(t, dir)
+	})
+
+	t.Run("mixed answer", func(t *testing.T) {
+		var buf bytes.Buffer
+		opts := &options{Apply: applyOpts{Dir: dir}}
+		err := applyAnswer(&buf, opts, &ExecutionResult{MixUsed: true, MixedText: answer,
+			Results: []provider.Result{{Provider: "OpenAI", Text: "a"}, {Provider: "Google", Text: "b"}}})
+		require.NoError(t, err)
+		assert.Equal(t, "wrote "+filepath.Join(dir, "main.go")+", 13 bytes, new\n", buf.String())
+		data, err := os.ReadFile(filepath.Join(dir, "main.go"))
+		require.NoError(t, err)
+		assert.Equal(t, "package main\n", string(data))
+	})
+
+	t.Run("patch", func(t *testing.T) {
+		repo := t.TempDir()
+		require.NoError(t, exec.Command("git", "-C", repo, "init", "-q").Run())
+		require.NoError(t, os.WriteFile(filepath.Join(repo, "a.txt"), []byte("one\ntwo\n"), 0o600))
+		diff := "```diff\n--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+three\n```"
+		res := &ExecutionResult{Results: []provider.Result{{Provider: "OpenAI", Text: diff}}}
+
+		var buf bytes.Buffer
+		opts := &options{Apply: applyOpts{Patch: true, DryRun: true}, dir: repo}
+		require.NoError(t, applyAnswer(&buf, opts, res))
+		assert.Equal(t, "would patch a.txt, 1 hunks\nwould patch 1 files, 1 hunks\n", buf.String())
+
+		buf.Reset()
+		opts.Apply.DryRun = false
+		require.NoError(t, applyAnswer(&buf, opts, res))
+		assert.Equal(t, "patched a.txt, 1 hunks\npatched 1 files, 1 hunks\n", buf.String())
+		data, err := os.ReadFile(filepath.Join(repo, "a.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "one\nthree\n", string(data))
+
+		err = applyAnswer(io.Discard, opts, res)
+		require.ErrorContains(t, err, "patch doesn't apply")
+	})
+
+	t.Run("several answers", func(t *testing.T) {
+		opts := &options{Apply: applyOpts{Dir: dir}}
+		err := applyAnswer(io.Discard, opts, &ExecutionResult{Results: []provider.Result{{Provider: "OpenAI", Text: answer},
+			{Provider: "Google", Text: answer}}})
+		require.EqualError(t, err, "can't apply answer, got 2 answers instead of a single final answer, use --mix or --first")
+	})
+}
+
+func TestWrapProviders_RepairMarkdown(t *testing.T) {
+	opts := &options{RepairMarkdown: true, Normalize: true}
+	require.NoError(t, loadNormalizer(opts))
+	p := &mocks.ProviderMock{NameFunc: func() string { return "test" },
+		GenerateFunc: func(context.Context, string) (string, error) {
+			return "Here is the fix:\n\n```go\n# not a header\nfunc f() {}\n", nil
+		}}
+	wrapped := wrapProviders(opts, []provider.Provider{p})
+	text, err := wrapped[0].Generate(context.Background(), "prompt")
+	require.NoError(t, err)
+	assert.Equal(t, "```go\n# not a header\nfunc f() {}\n```", text, "answer repaired and normalized")
+}
+
+func TestWrapProviders_Instructions(t *testing.T) {
+	newMock := func(name string) *mocks.ProviderMock {
+		return &mocks.ProviderMock{
+			NameFunc:     func() string { return name },
+			EnabledFunc:  func() bool { return true },
+			GenerateFunc: func(_ context.Context, prompt string) (string, error) { return prompt, nil },
+		}
+	}
+	opts := &options{}
+	_, err := flags.NewParser(opts, flags.PassDoubleDash).ParseArgs([]string{"--openai.instructions=follow the style guide",
+		"--custom.name=Local", "--custom.instructions=answer briefly",
+		"--customs=router:url=http://router/v1,model=m,name=Router,enabled=true,instructions=answer in German, with examples"})
+	require.NoError(t, err)
+
+	t.Run("prefixed per provider", func(t *testing.T) {
+		wrapped := wrapProviders(opts, []provider.Provider{newMock("OpenAI"), newMock("Anthropic"), newMock("Local"),
+			newMock("Router")})
+		res, err := wrapped[0].Generate(context.Background(), "prompt")
+		require.NoError(t, err)
+		assert.Equal(t, "follow the style guide\n\nprompt", res)
+		res, err = wrapped[1].Generate(context.Background(), "prompt")
+		require.NoError(t, err)
+		assert.Equal(t, "prompt", res, "no instructions set for anthropic")
+		res, err = wrapped[2].Generate(context.Background(), "prompt")
+		require.NoError(t, err)
+		assert.Equal(t, "answer briefly\n\nprompt", res)
+		res, err = wrapped[3].Generate(context.Background(), "prompt")
+		require.NoError(t, err)
+		assert.Equal(t, "answer in German, with examples\n\nprompt", res, "instructions of --customs provider")
+	})
+
+	t.Run("disabled for the run", func(t *testing.T) {
+		noInstr := *opts
+		noInstr.NoInstructions = true
+		wrapped := wrapProviders(&noInstr, []provider.Provider{newMock("OpenAI")})
+		res, err := wrapped[0].Generate(context.Background(), "prompt")
+		require.NoError(t, err)
+		assert.Equal(t, "prompt", res)
+	})
+}
+
+func TestWrapProviders_Constraints(t *testing.T) {
+	newMock := func(name string) *mocks.ProviderMock {
+		return &mocks.ProviderMock{
+			NameFunc:     func() string { return name },
+			EnabledFunc:  func() bool { return true },
+			GenerateFunc: func(_ context.Context, prompt string) (string, error) { return prompt, nil },
+		}
+	}
+	opts := &options{Format: "markdown", MaxWords: 100, NoInstructions: true, OpenAI: openAIOpts{Instructions: "be brief"},
+		Customs: map[string]customSpec{"router": {CustomSpec: config.CustomSpec{URL: "http://localhost:1",
+			Model: "anthropic/claude-sonnet-4.5", Enabled: true}}}}
+	require.NoError(t, loadConstraints(opts))
+	wrapped := wrapProviders(opts, []provider.Provider{newMock("OpenAI"), newMock("Anthropic"), newMock("router")})
+
+	res, err := wrapped[0].Generate(context.Background(), "prompt")
+	require.NoError(t, err)
+	assert.Equal(t, "prompt\n\n## Output requirements\n\n- Format the answer as markdown.\n- Keep the whole answer under 100 words.\n"+
+		"- Don't add a preamble or closing remarks outside of this format.", res, "kept without instructions")
+	for _, p := range wrapped[1:] {
+		res, err = p.Generate(context.Background(), "prompt")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(res, "prompt\n\n<output_requirements>\n- Format the answer as markdown.\n"), p.Name())
+	}
+
+	require.ErrorContains(t, loadConstraints(&options{MaxWords: -1}), "invalid answer constraints: max words can't be negative")
+	err = validateOptions(&options{Format: "json", ConsensusEnabled: true, ConsensusAttempts: 1, MixEnabled: true})
+	require.ErrorContains(t, err, "answer format and max words can't be combined with review, consensus or prompt variants judge")
+}
+
+func TestCreateProviders_NotWrapped(t *testing.T) {
+	opts := &options{OpenAI: openAIOpts{Enabled: true, APIKey: "key", Model: "gpt-4o"}, Retry: retryOpts{Attempts: 3},
+		Fault: faultOpts{Providers: map[string]string{"openai": "auth"}}}
+	raw, err := createProviders(context.Background(), opts)
+	require.NoError(t, err)
+	require.Len(t, raw, 1)
+	assert.IsType(t, &provider.OpenAI{}, raw[0], "raw provider used for health checks is not wrapped")
+
+	wrapped, err := initializeProviders(context.Background(), opts)
+	require.NoError(t, err)
+	require.Len(t, wrapped, 1)
+	assert.IsType(t, &provider.RetryableProvider{}, wrapped[0])
+}
+
+func TestLoadQuota(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.json")
+	reset := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	require.NoError(t, os.WriteFile(path, []byte(`{"OpenAI":{"remaining_requests":0,"remaining_tokens":-1,`+
+		`"reset_requests":"`+reset+`"}}`), 0o600))
+
+	opts := &options{Quota: quotaOpts{MaxWait: time.Second, State: path}}
+	require.NoError(t, loadQuota(opts))
+	require.NotNil(t, opts.quota)
+
+	calls := 0
+	p := &mocks.ProviderMock{
+		NameFunc:     func() string { return "OpenAI" },
+		EnabledFunc:  func() bool { return true },
+		GenerateFunc: func(context.Context, string) (string, error) { calls++; return "answer", nil },
+	}
+	_, err := withQuota(runner.New(p), opts).Run(context.Background(), "prompt")
+	require.ErrorContains(t, err, "quota exhausted until "+reset)
+	assert.Equal(t, 0, calls, "exhausted provider skipped")
+
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0o600))
+	require.ErrorContains(t, loadQuota(&options{Quota: quotaOpts{State: path}}), "invalid quota state")
+}
+
+func TestLoadMixPreset(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "mix"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mix", "review.md"), []byte("merge review findings\n"), 0o600))
+
+	opts := &options{MixPrompt: defaultMixPrompt}
+	opts.MCP.Prompts = dir
+	require.NoError(t, loadMixPreset(opts))
+	assert.Equal(t, defaultMixPrompt, opts.MixPrompt, "no preset")
+
+	opts.MixPreset = "reconcile"
+	require.NoError(t, loadMixPreset(opts))
+	assert.Equal(t, mix.Presets["reconcile"], opts.MixPrompt)
+
+	opts.MixPreset, opts.MixPrompt = "review", defaultMixPrompt
+	require.NoError(t, loadMixPreset(opts))
+	assert.Equal(t, "merge review findings", opts.MixPrompt, "user preset from the prompt library")
+
+	opts.MixPrompt = "merge them"
+	require.EqualError(t, loadMixPreset(opts), "mix preset and mix prompt can't be combined")
+
+	opts.MixPreset, opts.MixPrompt = "poem", defaultMixPrompt
+	require.EqualError(t, loadMixPreset(opts),
+		`unknown mix preset "poem", known presets: rank, reconcile, review, summarize, table-compare`)
+}
+
+func TestLoadCapabilities(t *testing.T) {
+	opts := &options{MixProvider: "capability:cheap"}
+	opts.OpenAI.Enabled, opts.OpenAI.Model = true, "gpt-4o-mini"
+	opts.Google.Enabled, opts.Google.Model = true, "gemini-2.5-pro"
+	opts.Anthropic.Model = "claude-3-5-haiku" // disabled
+	opts.Customs = map[string]customSpec{"local": {config.CustomSpec{Name: "Local", URL: "http://localhost", Model: "llama",
+		Enabled: true}}}
+	opts.Capabilities = map[string]string{"google": "cheap,long-context", "Local": "supports-json"}
+	require.NoError(t, loadCapabilities(opts))
+
+	assert.True(t, opts.caps.Has("OpenAI", provider.CapabilityCheap, provider.CapabilityVision), "built-in capabilities")
+	assert.True(t, opts.caps.Has("Google", provider.CapabilityCheap, provider.CapabilityLongContext))
+	assert.False(t, opts.caps.Has("Google", provider.CapabilityVision), "overridden capabilities")
+	assert.True(t, opts.caps.Has("Local", provider.CapabilityJSON))
+	assert.False(t, opts.caps.Has("Anthropic", provider.CapabilityCheap), "disabled provider")
+
+	opts.Capabilities = map[string]string{"google": "fast"}
+	require.EqualError(t, loadCapabilities(opts),
+		`invalid capabilities of google: unknown capability "fast", supported: supports-json, supports-vision, long-context, cheap`)
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	p := &mocks.ProviderMock{
+		NameFunc:     func() string { return "OpenAI" },
+		GenerateFunc: func(context.Context, string) (string, error) { return "live answer", nil },
+	}
+	recorded := wrapProviders(&options{Record: dir}, []provider.Provider{p})
+	text, err := recorded[0].Generate(context.Background(), "prompt")
+	require.NoError(t, err)
+	assert.Equal(t, "live answer", text)
+
+	p.GenerateFunc = func(context.Context, string) (string, error) {
+		t.Fatal("provider called in replay mode")
+		return "", nil
+	}
+	replayed := wrapProviders(&options{Replay: dir}, []provider.Provider{p})
+	text, err = replayed[0].Generate(context.Background(), "prompt")
+	require.NoError(t, err)
+	assert.Equal(t, "live answer", text)
+
+	t.Run("replay without api key", func(t *testing.T) {
+		providers, err := initializeProviders(context.Background(), &options{Replay: dir, OpenAI: openAIOpts{Enabled: true, Model: "gpt-4o"}})
+		require.NoError(t, err)
+		require.Len(t, providers, 1)
+		text, err := providers[0].Generate(context.Background(), "prompt")
+		require.NoError(t, err)
+		assert.Equal(t, "live answer", text)
+	})
+}
+
+func TestApplyPromptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "task.md")
+	content := "---\nopenai:\n  enabled: true\n  temperature: 0.3\nfile: [\"*.go\"]\nmix: true\n---\nreview the code\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	args := []string{"--prompt-file", path, "--openai.temperature=0.5", "-f", "*.md"}
+	opts := &options{PromptFile: path, args: args}
+	require.NoError(t, applyPromptFile(opts, args))
+	assert.Equal(t, "review the code", opts.Prompt)
+	assert.True(t, opts.OpenAI.Enabled)
+	assert.True(t, opts.MixEnabled)
+	assert.InDelta(t, 0.5, opts.OpenAI.Temperature, 0.001, "command line overrides front-matter")
+	assert.Equal(t, []string{"*.go", "*.md"}, opts.Files, "list options combined")
+	assert.Equal(t, "openai", opts.MixProvider, "defaults applied")
+	assert.Equal(t, args, opts.args, "original arguments kept")
+
+	t.Run("with prompt", func(t *testing.T) {
+		err := applyPromptFile(&options{PromptFile: path, Prompt: "text"}, nil)
+		require.EqualError(t, err, "--prompt-file can't be combined with --prompt")
+	})
+
+	t.Run("invalid option value", func(t *testing.T) {
+		bad := filepath.Join(t.TempDir(), "bad.md")
+		require.NoError(t, os.WriteFile(bad, []byte("---\nopenai.temperature: hot\n---\nprompt"), 0o600))
+		err := applyPromptFile(&options{PromptFile: bad}, []string{"--prompt-file", bad})
+		require.ErrorContains(t, err, "invalid options in prompt file "+bad)
+	})
+
+	t.Run("options not allowed in front-matter", func(t *testing.T) {
+		for _, opt := range []string{"prompt: text", "no-such-option: 1", "exec-on-complete: rm -rf /", "record: /tmp/x",
+			"history.file: /tmp/h", "review.sarif: /tmp/s", "openai.api-key: key", "custom.url: https://evil", "force: true"} {
+			bad := filepath.Join(t.TempDir(), "bad.md")
+			require.NoError(t, os.WriteFile(bad, []byte("---\n"+opt+"\n---\nprompt"), 0o600))
+			err := applyPromptFile(&options{PromptFile: bad}, nil)
+			name, _, _ := strings.Cut(opt, ":")
+			require.ErrorContains(t, err, "--"+name+" can't be set in prompt file front-matter", opt)
+		}
+	})
+
+	t.Run("template arguments", func(t *testing.T) {
+		tmpl := filepath.Join(t.TempDir(), "changelog.md")
+		require.NoError(t, os.WriteFile(tmpl, []byte("---\ntemplate: true\narguments:\n  since: git ref\n  audience: readers\n"+
+			"---\nchangelog since {{.since}} for {{.audience}}"), 0o600))
+		args := []string{"--prompt-file", tmpl, "--prompt-arg", "since=v1.2.0"}
+		opts := &options{PromptFile: tmpl}
+		require.NoError(t, applyPromptFile(opts, args))
+		assert.True(t, opts.Template)
+		assert.Equal(t, map[string]string{"since": "v1.2.0", "audience": ""}, opts.PromptArgs, "declared arguments empty")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		err := applyPromptFile(&options{PromptFile: "/no/such/task.md"}, nil)
+		require.ErrorContains(t, err, "failed to read prompt file")
+	})
+}
+
+func TestPromptTemplates(t *testing.T) {
+	dir, lib := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(lib, "review.md"), []byte("---\ndescription: review the code\n"+
+		"template: true\nfile: [\"*.go\"]\narguments:\n  focus: what to focus on\n---\nreview with focus on {{.focus}}"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(lib, "summary.md"), []byte("summarize"), 0o600))
+
+	opts := &options{dir: dir}
+	opts.MCP.Prompts = lib
+	templates, err := promptTemplates(opts)
+	require.NoError(t, err)
+	require.Len(t, templates, 2)
+	assert.Equal(t, "review", templates[0].Name)
+	assert.Equal(t, "review the code", templates[0].Description)
+	assert.Equal(t, map[string]string{"focus": "what to focus on"}, templates[0].Arguments)
+	assert.Equal(t, "summary", templates[1].Name)
+
+	res, err := templates[0].Render(context.Background(), map[string]string{"focus": "errors"})
+	require.NoError(t, err)
+	assert.Contains(t, res, "review with focus on errors")
+	assert.Contains(t, res, "// file: main.go\npackage main")
+
+	res, err = templates[1].Render(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "summarize", res)
+
+	t.Run("invalid front-matter", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(lib, "bad.md"), []byte("---\nrecord: /tmp/x\n---\nprompt"), 0o600))
+		_, err := promptTemplates(opts)
+		require.ErrorContains(t, err, "--record can't be set in prompt file front-matter")
+	})
+
+	t.Run("missing library", func(t *testing.T) {
+		templates, err := promptTemplates(&options{MCP: mcpOpts{Prompts: "/no/such/dir"}})
+		require.NoError(t, err)
+		assert.Empty(t, templates)
+	})
+}
+
+func TestLoadConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	system, user := filepath.Join(dir, "system.yml"), filepath.Join(dir, "user.yml")
+	require.NoError(t, os.WriteFile(system, []byte("custom:\n  url: https://gateway.internal/v1\n  model: gw-large\n"+
+		"  temperature: 0.2\nexclude: [\"secrets/**\"]\ntimeout.total: 2m\nopenai:\n  enabled: true\ngoogle.enabled: true\n"), 0o600))
+	require.NoError(t, os.WriteFile(user, []byte("custom:\n  temperature: 0.7\nexclude: [\"*.log\"]\nopenai.enabled: false\n"), 0o600))
+
+	parse := func(t *testing.T, args ...string) *options {
+		t.Helper()
+		opts := &options{}
+		p := flags.NewParser(opts, flags.PassDoubleDash)
+		defaults, err := loadConfigFiles(p, system, user, filepath.Join(dir, "missing.yml"))
+		require.NoError(t, err)
+		_, err = p.ParseArgs(append(slices.Clone(defaults), args...))
+		require.NoError(t, err)
+		return opts
+	}
+
+	t.Run("merged", func(t *testing.T) {
+		opts := parse(t, "--custom.model=my-model", "-x", "*.tmp")
+		assert.Equal(t, "https://gateway.internal/v1", opts.Custom.URL, "set by system config")
+		assert.InDelta(t, 0.7, opts.Custom.Temperature, 0.001, "user config overrides system one")
+		assert.Equal(t, "my-model", opts.Custom.Model, "command line overrides config")
+		assert.Equal(t, []string{"secrets/**", "*.log", "*.tmp"}, opts.Excludes, "list options combined")
+		assert.Equal(t, 2*time.Minute, opts.TimeoutTotal)
+		assert.False(t, opts.OpenAI.Enabled, "enabled by system config, disabled by user config")
+		assert.True(t, opts.Google.Enabled, "enabled by system config")
+	})
+
+	t.Run("environment overrides config", func(t *testing.T) {
+		t.Setenv("CUSTOM_URL", "https://other.internal/v1")
+		opts := parse(t)
+		assert.Equal(t, "https://other.internal/v1", opts.Custom.URL)
+		assert.Equal(t, "gw-large", opts.Custom.Model)
+	})
+
+	t.Run("invalid option", func(t *testing.T) {
+		bad := filepath.Join(dir, "bad.yml")
+		require.NoError(t, os.WriteFile(bad, []byte("no-such-option: 1\n"), 0o600))
+		_, err := loadConfigFiles(flags.NewParser(&options{}, flags.PassDoubleDash), bad)
+		require.ErrorContains(t, err, "invalid options in config file "+bad)
+	})
+
+	t.Run("prompt in config", func(t *testing.T) {
+		bad := filepath.Join(dir, "prompt.yml")
+		require.NoError(t, os.WriteFile(bad, []byte("prompt: text\n"), 0o600))
+		_, err := loadConfigFiles(flags.NewParser(&options{}, flags.PassDoubleDash), bad)
+		require.EqualError(t, err, "--prompt can't be set in config file "+bad)
+	})
+}
+
+func TestConfigPaths(t *testing.T) {
+	t.Setenv("MPT_SYSTEM_CONFIG", "/opt/mpt/system.yml")
+	t.Setenv("MPT_CONFIG", "/tmp/user.yml")
+	assert.Equal(t, "/opt/mpt/system.yml", systemConfigPath())
+	assert.Equal(t, "/tmp/user.yml", userConfigPath())
+
+	t.Setenv("MPT_SYSTEM_CONFIG", "")
+	t.Setenv("MPT_CONFIG", "")
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, "/etc/mpt/config.yml", systemConfigPath())
+	}
+	home, err := os.UserHomeDir()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(home, ".mpt", "config.yml"), userConfigPath())
+}
+
+func TestOnComplete(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh commands")
+	}
+	var logs bytes.Buffer
+	lgr.Setup(lgr.Out(&logs))
+	defer lgr.Setup() // restore default logger
+
+	onComplete(context.Background(), &options{ExecOnComplete: "exit 3"}, &ExecutionResult{Text: "answer"}, time.Second)
+	assert.Contains(t, logs.String(), "WARN  exec-on-complete command failed: exit status 3")
+}
+
+func TestQuietText(t *testing.T) {
+	results := []provider.Result{
+		{Provider: "OpenAI", Text: "first answer\n"},
+		{Provider: "Google", Error: errors.New("rate limit")},
+		{Provider: "Anthropic", Text: "second answer"},
+		{Provider: "DeepSeek", Text: "first answer  \n"},
+	}
+	tests := []struct {
+		name   string
+		result *ExecutionResult
+		want   string
+	}{
+		{"single provider", &ExecutionResult{Text: "answer", Results: results[:1]}, "first answer"},
+		{"multiple providers without headers, identical answers once", &ExecutionResult{Text: "== generated by OpenAI ==",
+			Results: results}, "first answer\n\nsecond answer"},
+		{"mixed", &ExecutionResult{Text: "== mixed results by OpenAI ==\nmerged", MixedText: "merged", MixUsed: true,
+			Results: results}, "merged"},
+		{"review", &ExecutionResult{Text: "findings", Review: &review.Report{}, Results: results}, "findings"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, quietText(tt.result))
+		})
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	text := "== generated by OpenAI ==\n**answer**"
+	headers := "\x1b[1m\x1b[96m== generated by OpenAI ==\x1b[0m\n**answer**"
+	rendered := "\x1b[1m\x1b[96m== generated by OpenAI ==\x1b[0m\n\x1b[1manswer\x1b[0m"
+	t.Setenv("COLUMNS", "")
+	t.Setenv("NO_COLOR", "")
+
+	tests := []struct {
+		name     string
+		opts     *options
+		terminal bool
+		want     string
+	}{
+		{name: "headers colored on terminal", opts: &options{Color: "auto"}, terminal: true, want: headers},
+		{name: "plain text if piped", opts: &options{Color: "auto", Render: true}, want: text},
+		{name: "rendered", opts: &options{Color: "auto", Render: true}, terminal: true, want: rendered},
+		{name: "colors always", opts: &options{Color: "always", Render: true}, want: rendered},
+		{name: "colors never", opts: &options{Color: "never", Render: true}, terminal: true, want: text},
+		{name: "mono theme", opts: &options{Color: "always", Theme: "mono"}, want: "\x1b[1m== generated by OpenAI ==\x1b[0m\n**answer**"},
+		{name: "light theme", opts: &options{Color: "always", Theme: "light"}, want: "\x1b[1m\x1b[34m== generated by OpenAI ==\x1b[0m\n**answer**"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, renderText(tt.opts, text, tt.terminal))
+		})
+	}
+
+	t.Run("no color", func(t *testing.T) {
+		t.Setenv("NO_COLOR", "1")
+		assert.Equal(t, text, renderText(&options{Color: "auto", Render: true}, text, true))
+		assert.Equal(t, rendered, renderText(&options{Color: "always", Render: true}, text, true), "overridden by --color=always")
+	})
+
+	t.Run("wrapped to terminal width", func(t *testing.T) {
+		t.Setenv("COLUMNS", "30")
+		assert.Equal(t, "one two three four five six\nseven",
+			renderText(&options{Color: "always", Render: true}, "one two three four five six seven", false))
+	})
+}
+
+func TestWriteStatusLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *ExecutionResult
+		want   string
+	}{
+		{
+			name:   "all succeeded",
+			result: &ExecutionResult{Results: []provider.Result{{Provider: "OpenAI"}, {Provider: "Google"}}},
+			want:   "status=ok providers=2 ok=2 failed=0 duration_ms=5230\n",
+		},
+		{
+			name: "partial failure with tokens",
+			result: &ExecutionResult{
+				Results: []provider.Result{{Provider: "OpenAI"}, {Provider: "Local LLM", Error: errors.New("timeout")}},
+				Tokens:  []tokens.Count{{Provider: "OpenAI", Tokens: 1000}, {Provider: "Local LLM", Tokens: 800, Estimated: true}},
+			},
+			want: "status=partial providers=2 ok=1 failed=1 failed_providers=Local_LLM duration_ms=5230 prompt_tokens=1800\n",
+		},
+		{
+			name: "token usage reported by providers",
+			result: &ExecutionResult{Results: []provider.Result{
+				{Provider: "OpenAI", Usage: provider.Usage{InputTokens: 1000, OutputTokens: 200}},
+				{Provider: "Google", Usage: provider.Usage{InputTokens: 900, OutputTokens: 150}},
+			}},
+			want: "status=ok providers=2 ok=2 failed=0 duration_ms=5230 prompt_tokens=1900 output_tokens=350\n",
+		},
+		{
+			name: "cost of priced models",
+			result: &ExecutionResult{
+				Results: []provider.Result{
+					{Provider: "OpenAI", Model: "gpt-5", Usage: provider.Usage{InputTokens: 2000, OutputTokens: 200}},
+					{Provider: "Local", Model: "llama3", Usage: provider.Usage{InputTokens: 500, OutputTokens: 100}},
+				},
+				Prices: pricing.Table{Models: map[string]pricing.Price{"gpt-5": {Provider: "openai", Input: 1.25, Output: 10}}},
+			},
+			want: "status=ok providers=2 ok=2 failed=0 duration_ms=5230 prompt_tokens=2500 output_tokens=300 cost_usd=0.0045\n",
+		},
+		{
+			name:   "run failed",
+			result: &ExecutionResult{Err: errors.New("all failed"), Results: []provider.Result{{Provider: "OpenAI", Error: errors.New("x")}}},
+			want:   "status=failed providers=1 ok=0 failed=1 failed_providers=OpenAI duration_ms=5230\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeStatusLine(&buf, tt.result, 5230*time.Millisecond)
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestNotificationMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  *ExecutionResult
+		elapsed time.Duration
+		want    string
+	}{
+		{
+			name: "all succeeded",
+			result: &ExecutionResult{Results: []provider.Result{
+				{Provider: "OpenAI", Text: "a"}, {Provider: "Google", Text: "b"},
+			}},
+			elapsed: 135400 * time.Millisecond,
+			want:    "finished in 2m15s: OpenAI ok, Google ok",
+		},
+		{
+			name: "partial failure",
+			result: &ExecutionResult{Results: []provider.Result{
+				{Provider: "OpenAI", Text: "a"}, {Provider: "Google", Error: errors.New("rate limit")},
+			}},
+			elapsed: 5 * time.Second,
+			want:    "finished in 5s: OpenAI ok, Google failed",
+		},
+		{
+			name:    "failed without provider results",
+			result:  &ExecutionResult{Err: errors.New("no enabled providers")},
+			elapsed: 300 * time.Millisecond,
+			want:    "finished in 0s: no enabled providers",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, notificationMessage(tt.result, tt.elapsed))
+		})
+	}
+}
+
+func TestHistoryArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "prompt flags dropped",
+			args: []string{"--openai.enabled", "-p", "question", "--prompt=other", "-pthird", "--prompt", "fourth", "-f", "*.go"},
+			want: []string{"--openai.enabled", "-f", "*.go"},
+		},
+		{
+			name: "edit flag dropped",
+			args: []string{"--edit", "--openai.enabled", "-p", "question"},
+			want: []string{"--openai.enabled"},
+		},
+		{
+			name: "api keys dropped",
+			args: []string{"--openai.api-key", "sk-1", "--google.api-key=g-1", "--anthropic.enabled"},
+			want: []string{"--anthropic.enabled"},
+		},
+		{
+			name: "api key dropped from custom spec",
+			args: []string{"--customs", "local:url=http://localhost,api-key=secret,model=llama", "--customs=or:api-key=k,url=http://or"},
+			want: []string{"--customs", "local:url=http://localhost,model=llama", "--customs=or:url=http://or"},
+		},
+		{
+			name: "secret references kept",
+			args: []string{"--openai.api-key", "keyring:openai", "--google.api-key=vault:secret/data/mpt#google",
+				"--customs=or:url=http://or,api-key=aws-sm:prod/or"},
+			want: []string{"--openai.api-key", "keyring:openai", "--google.api-key=vault:secret/data/mpt#google",
+				"--customs=or:url=http://or,api-key=aws-sm:prod/or"},
+		},
+		{
+			name: "arguments after double dash kept",
+			args: []string{"--openai.enabled", "--", "-p"},
+			want: []string{"--openai.enabled", "--", "-p"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, historyArgs(tt.args))
+		})
+	}
+}
+
+func TestBuildFullPrompt_Dir(t *testing.T) {
+	srcDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "pkg"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "pkg", "main.go"), []byte("package main"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "pkg", "main_test.go"), []byte("package main_test"), 0o600))
+	t.Chdir(t.TempDir())
+
+	opts := &options{Prompt: "review", Files: []string{"pkg/*.go"}, Excludes: []string{"*_test.go"},
+		MaxFileSize: 1024, dir: srcDir}
+	require.NoError(t, buildFullPrompt(context.Background(), opts))
+	assert.Contains(t, opts.Prompt, "// file: "+filepath.Join("pkg", "main.go"), "header relative to dir")
+	assert.Contains(t, opts.Prompt, "package main")
+	assert.NotContains(t, opts.Prompt, "main_test.go")
+}
+
+func TestBuildFullPrompt_ContextWrappers(t *testing.T) {
+	srcDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "main.go"), []byte("package main"), 0o600))
+
+	opts := &options{Prompt: "review", Files: []string{"main.go"}, MaxFileSize: 1024, dir: srcDir,
+		Ctx: ctxOpts{Position: "before", Wrapper: "markdown", ProviderWrappers: map[string]string{"Anthropic": "xml", "google": "markdown"}}}
+	require.NoError(t, buildFullPrompt(context.Background(), opts))
+	assert.Equal(t, "### main.go\n```go\npackage main\n```\n\nreview", opts.Prompt)
+	assert.Equal(t, opts.Prompt, opts.variants.base)
+	assert.Equal(t, map[string]string{
+		"anthropic": "<file path=\"main.go\">\npackage main\n</file>\n\nreview",
+		"google":    opts.Prompt,
+	}, opts.variants.providers)
+
+	var prompts []string
+	newMock := func(name string) *mocks.ProviderMock {
+		return &mocks.ProviderMock{NameFunc: func() string { return name }, EnabledFunc: func() bool { return true },
+			GenerateFunc: func(_ context.Context, prompt string) (string, error) {
+				prompts = append(prompts, name+": "+prompt)
+				return "ok", nil
+			}}
+	}
+	opts.Prompt += "\n\nextra instructions"
+	for _, p := range wrapProviders(opts, []provider.Provider{newMock("Anthropic"), newMock("OpenAI")}) {
+		_, err := p.Generate(context.Background(), opts.Prompt)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{
+		"Anthropic: <file path=\"main.go\">\npackage main\n</file>\n\nreview\n\nextra instructions",
+		"OpenAI: ### main.go\n```go\npackage main\n```\n\nreview\n\nextra instructions",
+	}, prompts)
+}
+
+func TestBuildFullPrompt_Template(t *testing.T) {
+	srcDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "main.go"), []byte("package main"), 0o600))
+
+	opts := &options{Prompt: "review\n{{file \"main.go\"}}\nfor races", MaxFileSize: 1024, Template: true, dir: srcDir}
+	require.NoError(t, buildFullPrompt(context.Background(), opts))
+	assert.Equal(t, "review\n// file: main.go\npackage main\nfor races", opts.Prompt)
+
+	opts = &options{Prompt: "review {{file \"missing.go\"}}", MaxFileSize: 1024, Template: true, dir: srcDir}
+	require.ErrorContains(t, buildFullPrompt(context.Background(), opts), "failed to load missing.go")
+
+	opts = &options{Prompt: "review {{file \"main.go\"}}", MaxFileSize: 1024, Template: true, dir: srcDir,
+		input: "piped {{file \"/etc/passwd\"}}"}
+	require.NoError(t, buildFullPrompt(context.Background(), opts))
+	assert.Equal(t, "review // file: main.go\npackage main\npiped {{file \"/etc/passwd\"}}", opts.Prompt,
+		"piped input appended as is")
+}
+
+func TestRerun(t *testing.T) {
+	t.Chdir(t.TempDir()) // invocations are recorded from another directory, restored after the test
+	srcDir := t.TempDir()
+	historyFile := filepath.Join(t.TempDir(), "history.jsonl")
+
+	// record two invocations
+	for _, p := range []string{"first question", "second question"} {
+		opts := &options{Prompt: p, args: []string{"--openai.enabled", "--openai.api-key=sk-1", "-p", p, "-f", "*.go"},
+			History: historyOpts{File: historyFile, Max: 10}}
+		t.Chdir(srcDir)
+		recordHistory(opts)
+	}
+	runDir := t.TempDir()
+	t.Chdir(runDir)
+
+	t.Run("last", func(t *testing.T) {
+		entry, args, err := prepareRerun([]string{"--history.file", historyFile}, io.Discard)
+		require.NoError(t, err)
+		assert.Equal(t, 2, entry.ID)
+		assert.Equal(t, "second question", entry.Prompt)
+		assert.Equal(t, []string{"--openai.enabled", "-f", "*.go"}, args)
+		assert.Equal(t, evalPath(t, srcDir), evalPath(t, entry.Dir), "working directory of the invocation")
+		wd, err := os.Getwd()
+		require.NoError(t, err)
+		assert.Equal(t, evalPath(t, runDir), evalPath(t, wd), "working directory not changed")
+	})
+
+	t.Run("by id with modifications", func(t *testing.T) {
+		entry, args, err := prepareRerun([]string{"1", "--history.file=" + historyFile, "--with", "--google.enabled", "-x", "*_test.go"}, io.Discard)
+		require.NoError(t, err)
+		assert.Equal(t, "first question", entry.Prompt)
+		assert.Equal(t, []string{"--openai.enabled", "-f", "*.go", "--google.enabled", "-x", "*_test.go"}, args)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		var buf bytes.Buffer
+		entry, _, err := prepareRerun([]string{"--list", "--history.file", historyFile}, &buf)
+		require.NoError(t, err)
+		assert.Nil(t, entry)
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 2)
+		assert.True(t, strings.HasPrefix(lines[0], "1\t"))
+		assert.True(t, strings.HasSuffix(lines[1], "\tsecond question\t--openai.enabled -f *.go"))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, _, err := prepareRerun([]string{"5", "--history.file", historyFile}, io.Discard)
+		require.EqualError(t, err, "history entry 5 not found")
+		_, _, err = prepareRerun([]string{"abc", "--history.file", historyFile}, io.Discard)
+		require.EqualError(t, err, `invalid history id "abc"`)
+		_, _, err = prepareRerun([]string{"1", "--last", "--history.file", historyFile}, io.Discard)
+		require.EqualError(t, err, "--last can't be combined with history id")
+		_, _, err = prepareRerun([]string{"--history.file", filepath.Join(t.TempDir(), "empty.jsonl")}, io.Discard)
+		require.EqualError(t, err, "history is empty")
+	})
+
+	t.Run("redacted and truncated", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "history.jsonl")
+		input := "log line with password=hunter2hunter and key sk-live-0123456789abcdefgh\n" + strings.Repeat("ж", 100)
+		recordHistory(&options{Prompt: "check with key-in-use-123", input: input, args: []string{"-p", "check"},
+			OpenAI: openAIOpts{APIKey: "key-in-use-123"}, History: historyOpts{File: file, MaxInput: 100}})
+		entries, err := history.New(file, 10).List()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "check with ******", entries[0].Prompt)
+		assert.True(t, strings.HasPrefix(entries[0].Input, "log line with password=****** and key ******\nж"), entries[0].Input)
+		assert.Len(t, entries[0].Input, 99, "partial rune dropped")
+		assert.True(t, utf8.ValidString(entries[0].Input), "cut on a rune boundary")
+		assert.True(t, entries[0].Truncated)
+
+		recordHistory(&options{Prompt: "short", args: []string{"-p", "short"}, History: historyOpts{File: file, MaxInput: 100}})
+		entries, err = history.New(file, 10).List()
+		require.NoError(t, err)
+		assert.False(t, entries[1].Truncated)
+	})
+
+	t.Run("disabled history", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "history.jsonl")
+		recordHistory(&options{Prompt: "q", args: []string{"-p", "q"}, History: historyOpts{File: file, Disable: true}})
+		_, err := os.Stat(file)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+// evalPath resolves symlinks of the path, temp dirs may be symlinked, e.g. on macOS
+func evalPath(t *testing.T, path string) string {
+	t.Helper()
+	res, err := filepath.EvalSymlinks(path)
+	require.NoError(t, err)
+	return res
+}
+
+func TestDeepSeekTemperature(t *testing.T) {
+	opts := &options{}
+	_, err := flags.NewParser(opts, flags.Default).ParseArgs([]string{"--deepseek.enabled"})
+	require.NoError(t, err)
+	cfg := getStandardProviderConfigs(opts)[3]
+	require.Equal(t, "DeepSeek", cfg.name)
+	assert.InDelta(t, 1.0, cfg.temp, 1e-6, "api default temperature, not forced to zero")
+
+	_, err = flags.NewParser(opts, flags.Default).ParseArgs([]string{"--deepseek.enabled", "--deepseek.temperature=0"})
+	require.NoError(t, err)
+	assert.Zero(t, getStandardProviderConfigs(opts)[3].temp)
+}
+
+func TestMaxOutputTokens(t *testing.T) {
+	opts := &options{}
+	_, err := flags.NewParser(opts, flags.Default).ParseArgs([]string{"--openai.max-tokens=100", "--google.max-tokens=200"})
+	require.NoError(t, err)
+	cfgs := getStandardProviderConfigs(opts)
+	assert.Equal(t, 100, cfgs[0].maxTokens)
+	assert.Equal(t, 200, cfgs[2].maxTokens)
+
+	opts.MaxOutputTokens = 500
+	for _, cfg := range getStandardProviderConfigs(opts) {
+		assert.Equal(t, 500, cfg.maxTokens, cfg.name)
+	}
+
+	opts = &options{}
+	_, err = flags.NewParser(opts, flags.Default).ParseArgs([]string{"--openai.max-tokens=100", "--max-tokens=2k"})
+	require.NoError(t, err)
+	for _, cfg := range getStandardProviderConfigs(opts) {
+		assert.Equal(t, 2048, cfg.maxTokens, cfg.name)
+	}
+}
+
+func TestTemperatureOverride(t *testing.T) {
+	opts := &options{}
+	_, err := flags.NewParser(opts, flags.Default).ParseArgs([]string{"--openai.temperature=0.5"})
+	require.NoError(t, err)
+	assert.Nil(t, opts.Temperature)
+	cfgs := getStandardProviderConfigs(opts)
+	assert.InDelta(t, 0.5, cfgs[0].temp, 0.001)
+	assert.InDelta(t, 1, cfgs[3].temp, 0.001)
+
+	_, err = flags.NewParser(opts, flags.Default).ParseArgs([]string{"--openai.temperature=0.5", "--temperature=0"})
+	require.NoError(t, err)
+	require.NotNil(t, opts.Temperature)
+	for _, cfg := range getStandardProviderConfigs(opts) {
+		assert.Zero(t, cfg.temp, cfg.name)
+	}
+}
+
+func TestExecutePrompt_TotalTimeout(t *testing.T) {
+	blocking := &mocks.ProviderMock{
+		NameFunc:    func() string { return "Slow" },
+		EnabledFunc: func() bool { return true },
+		GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		},
+	}
+	timedOut := &mocks.ProviderMock{
+		NameFunc:    func() string { return "Local" },
+		EnabledFunc: func() bool { return true },
+		GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+			return "", fmt.Errorf("request failed: %w", context.DeadlineExceeded)
+		},
+	}
+
+	t.Run("whole run bounded", func(t *testing.T) {
+		opts := &options{Prompt: "test", TimeoutTotal: 50 * time.Millisecond}
+		st := time.Now()
+		_, err := executePrompt(context.Background(), opts, []provider.Provider{blocking})
+		require.Error(t, err)
+		assert.Less(t, time.Since(st), 5*time.Second)
+		assert.Contains(t, err.Error(), "operation timed out after 50ms, try increasing the timeout with --timeout.total flag")
+	})
+
+	t.Run("provider errors reported in json", func(t *testing.T) {
+		broken := &mocks.ProviderMock{
+			NameFunc:    func() string { return "Broken" },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				return "", &provider.Error{Provider: "Broken", Status: 500, Code: "server_error", Message: "overloaded"}
+			},
+		}
+		opts := &options{Prompt: "test", TimeoutTotal: 50 * time.Millisecond, JSON: true}
+		_, err := executePrompt(context.Background(), opts, []provider.Provider{blocking, broken})
+		require.ErrorContains(t, err, "operation timed out after 50ms, try increasing the timeout with --timeout.total flag")
+
+		var buf bytes.Buffer
+		require.NoError(t, writeOutput(&buf, opts, failedResult(opts, err)))
+		var out struct {
+			Responses []struct {
+				Provider     string `json:"provider"`
+				Error        string `json:"error"`
+				ErrorDetails *struct {
+					Status int    `json:"status"`
+					Code   string `json:"code"`
+				} `json:"error_details"`
+			} `json:"responses"`
+		}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+		require.Len(t, out.Responses, 2)
+		assert.Equal(t, "Slow", out.Responses[0].Provider)
+		assert.Contains(t, out.Responses[0].Error, "deadline exceeded")
+		assert.Equal(t, "Broken", out.Responses[1].Provider)
+		require.NotNil(t, out.Responses[1].ErrorDetails)
+		assert.Equal(t, 500, out.Responses[1].ErrorDetails.Status)
+		assert.Equal(t, "server_error", out.Responses[1].ErrorDetails.Code)
+	})
+
+	t.Run("generation deadline", func(t *testing.T) {
+		opts := &options{Prompt: "test", TimeoutTotal: time.Minute}
+		_, err := executePrompt(context.Background(), opts, []provider.Provider{timedOut})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "--timeout.generation flag")
+	})
+}
+
+func TestRunMetadata(t *testing.T) {
+	var opts options
+	_, err := flags.NewParser(&opts, flags.Default).ParseArgs([]string{"--name", "pr-1234-security-review",
+		"--tag", "ticket=SEC-42", "--tag=pipeline=nightly"})
+	require.NoError(t, err)
+	assert.Equal(t, "pr-1234-security-review", opts.Name)
+	assert.Equal(t, map[string]string{"ticket": "SEC-42", "pipeline": "nightly"}, opts.Tags)
+
+	t.Run("tags from env", func(t *testing.T) {
+		t.Setenv("RUN_TAGS", "ticket=SEC-1,team=core")
+		var envOpts options
+		_, err := flags.NewParser(&envOpts, flags.Default).ParseArgs(nil)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"ticket": "SEC-1", "team": "core"}, envOpts.Tags)
+	})
+
+	t.Run("empty tag key", func(t *testing.T) {
+		err := validateOptions(&options{Tags: map[string]string{" ": "x"}})
+		require.EqualError(t, err, "tag key can't be empty")
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeJSON(&buf, &ExecutionResult{Text: "ok", Name: opts.Name, Tags: opts.Tags}))
+		var out map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+		assert.Equal(t, "pr-1234-security-review", out["name"])
+		assert.Equal(t, map[string]any{"ticket": "SEC-42", "pipeline": "nightly"}, out["tags"])
+
+		buf.Reset()
+		require.NoError(t, writeJSON(&buf, &ExecutionResult{Text: "ok"}))
+		assert.NotContains(t, buf.String(), `"name"`)
+		assert.NotContains(t, buf.String(), `"tags"`)
+	})
+
+	t.Run("history", func(t *testing.T) {
+		historyFile := filepath.Join(t.TempDir(), "history.jsonl")
+		recordHistory(&options{Prompt: "check it", Name: opts.Name, Tags: opts.Tags, dir: t.TempDir(),
+			args: []string{"--openai.enabled", "--name", opts.Name}, History: historyOpts{File: historyFile, Max: 10}})
+
+		entry, err := history.New(historyFile, 0).Last()
+		require.NoError(t, err)
+		assert.Equal(t, "pr-1234-security-review", entry.Name)
+		assert.Equal(t, map[string]string{"ticket": "SEC-42", "pipeline": "nightly"}, entry.Tags)
+
+		var buf bytes.Buffer
+		_, _, err = prepareRerun([]string{"--list", "--history.file", historyFile}, &buf)
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "\t[pr-1234-security-review] check it\t")
+	})
+}
+
+func TestResolveAPIKeys(t *testing.T) {
+	secrets := map[string]string{"openai": "sk-openai", "or": "sk-or"}
+	resolve := func(v string) (string, error) {
+		name, ok := strings.CutPrefix(v, "keyring:")
+		if !ok {
+			return v, nil
+		}
+		if secret, found := secrets[name]; found {
+			return secret, nil
+		}
+		return "", errors.New("secret not found in keyring")
+	}
+
+	opts := &options{}
+	opts.OpenAI.Enabled, opts.OpenAI.APIKey = true, "keyring:openai"
+	opts.Anthropic.Enabled, opts.Anthropic.APIKey = true, "sk-plain"
+	opts.Google.APIKey = "keyring:google" // disabled, not resolved
+	opts.Customs = map[string]customSpec{
+		"or":  {config.CustomSpec{URL: "http://or", APIKey: "keyring:or", Enabled: true}},
+		"off": {config.CustomSpec{URL: "http://off", APIKey: "keyring:off"}},
+	}
+	require.NoError(t, resolveAPIKeys(opts, resolve))
+	assert.Equal(t, "sk-openai", opts.OpenAI.APIKey)
+	assert.Equal(t, "sk-plain", opts.Anthropic.APIKey)
+	assert.Equal(t, "keyring:google", opts.Google.APIKey)
+	assert.Empty(t, opts.DeepSeek.APIKey)
+	assert.Equal(t, "sk-or", opts.Customs["or"].APIKey)
+	assert.Equal(t, "http://or", opts.Customs["or"].URL)
+	assert.Equal(t, "keyring:off", opts.Customs["off"].APIKey)
+
+	opts = &options{}
+	opts.Google.Enabled, opts.Google.APIKey = true, "keyring:google"
+	require.EqualError(t, resolveAPIKeys(opts, resolve), "failed to resolve google api key: secret not found in keyring")
+}
+
+func TestRunAuth(t *testing.T) {
+	stored := map[string]string{}
+	set := func(name, secret string) error {
+		stored[name] = secret
+		return nil
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, runAuth([]string{"set", "openai"}, strings.NewReader("  sk-123\n"), &out, set))
+	assert.Equal(t, "sk-123", stored["openai"])
+	assert.Equal(t, "API key for openai stored in keyring, use it as keyring:openai\n", out.String())
+
+	err := runAuth([]string{"set", "openai"}, strings.NewReader("\n"), &out, set)
+	require.EqualError(t, err, "no API key provided for openai")
+
+	err = runAuth([]string{"get", "openai"}, strings.NewReader("x"), &out, set)
+	require.EqualError(t, err, "usage: mpt auth set <name>, e.g. mpt auth set openai")
+
+	err = runAuth([]string{"set", "openai"}, strings.NewReader("x"), &out, func(string, string) error { return errors.New("locked") })
+	require.EqualError(t, err, "locked")
+}
+
+func TestRunPricing(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/prices.json" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"gpt-5": {"litellm_provider": "openai", "mode": "chat", "input_cost_per_token": 1e-06, ` +
+			`"output_cost_per_token": 8e-06}, "gpt-5-mini": {"litellm_provider": "openai", "mode": "chat", ` +
+			`"input_cost_per_token": 2e-07, "output_cost_per_token": 1.6e-06}}`))
+	}))
+	defer ts.Close()
+	file := filepath.Join(t.TempDir(), "pricing.json")
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := runPricing(context.Background(), append(args, "--file="+file), &out, ts.Client())
+		return out.String(), err
+	}
+
+	t.Run("bundled", func(t *testing.T) {
+		out, err := run("show", "claude-sonnet")
+		require.NoError(t, err)
+		assert.Contains(t, out, "source: bundled")
+		assert.Regexp(t, `claude-sonnet-4-5\s+anthropic\s+3\.000\s+15\.000`, out)
+		assert.NotContains(t, out, "gpt-5")
+	})
+
+	t.Run("failed update keeps bundled", func(t *testing.T) {
+		_, err := run("update", "--url="+ts.URL+"/down.json")
+		require.ErrorContains(t, err, "status 503, previous prices are kept")
+		out, err := run("show")
+		require.NoError(t, err)
+		assert.Contains(t, out, "source: bundled")
+	})
+
+	t.Run("update", func(t *testing.T) {
+		out, err := run("update", "--url="+ts.URL+"/prices.json")
+		require.NoError(t, err)
+		assert.Equal(t, "pricing table of 2 models saved to "+file+"\n", out)
+
+		out, err = run("show")
+		require.NoError(t, err)
+		assert.Contains(t, out, "source: "+ts.URL+"/prices.json")
+		assert.Regexp(t, `gpt-5\s+openai\s+1\.000\s+8\.000\n`, out)
+		assert.NotContains(t, out, "claude")
+
+		out, err = run("show", "mini", "--json")
+		require.NoError(t, err)
+		var table pricing.Table
+		require.NoError(t, json.Unmarshal([]byte(out), &table))
+		assert.Equal(t, map[string]pricing.Price{"gpt-5-mini": {Provider: "openai", Input: 0.2, Output: 1.6}}, table.Models)
+	})
+
+	t.Run("prices of runs", func(t *testing.T) {
+		t.Setenv("MPT_PRICING_FILE", file)
+		assert.Len(t, loadPrices().Models, 2, "updated table used to estimate costs")
+		t.Setenv("MPT_PRICING_FILE", filepath.Join(t.TempDir(), "missing.json"))
+		assert.Equal(t, pricing.Bundled(), loadPrices())
+	})
+
+	_, err := run("list")
+	require.EqualError(t, err, "usage: mpt pricing show [model] | mpt pricing update [--url=URL], e.g. mpt pricing show gpt-5")
+}
+
+func TestDumpProviders(t *testing.T) {
+	opts := &options{}
+	_, err := flags.NewParser(opts, flags.PassDoubleDash).ParseArgs([]string{"--openai.enabled", "--openai.api-key=sk-secret",
+		"--openai.model=gpt-4o", "--anthropic.api-key=keyring:anthropic", "--retry.attempts=3", "--max-output-tokens=2k",
+		"--google.vertex", "--google.location=europe-west4", "--anthropic.backend=bedrock", "--anthropic.region=us-east-1",
+		"--customs=or:url=http://or,api-key=sk-or,model=m1,endpoint-type=responses,timeout-connect=3s,enabled=true"})
+	require.NoError(t, err)
+
+	t.Run("json", func(t *testing.T) {
+		opts.JSON = true
+		var out bytes.Buffer
+		require.NoError(t, dumpProviders(&out, opts))
+		assert.NotContains(t, out.String(), "sk-")
+
+		var res providersDump
+		require.NoError(t, json.Unmarshal(out.Bytes(), &res))
+		require.Len(t, res.Providers, 5)
+		openai := res.Providers[0]
+		assert.Equal(t, "OpenAI", openai.Name)
+		assert.True(t, openai.Enabled)
+		assert.Equal(t, "gpt-4o", openai.Model)
+		assert.Equal(t, "set", openai.APIKey)
+		assert.Equal(t, 2048, openai.MaxTokens)
+		assert.Equal(t, "auto", openai.EndpointType)
+		assert.Equal(t, "10s", openai.TimeoutConnect)
+		assert.NotEmpty(t, openai.Capabilities)
+		assert.Equal(t, "keyring:anthropic", res.Providers[1].APIKey)
+		assert.False(t, res.Providers[1].Enabled)
+		assert.Nil(t, res.Providers[1].Temperature)
+		assert.Equal(t, "bedrock, region us-east-1", res.Providers[1].Backend)
+		assert.Empty(t, res.Providers[0].Backend)
+		assert.Equal(t, "vertex, location europe-west4", res.Providers[2].Backend)
+
+		custom := res.Providers[4]
+		assert.Equal(t, providerDump{Name: "or", Type: "custom", Enabled: true, Model: "m1", URL: "http://or", APIKey: "set",
+			MaxTokens: 2048, Temperature: custom.Temperature, EndpointType: "responses", TimeoutConnect: "3s",
+			TimeoutGeneration: "1m0s"}, custom)
+		assert.Equal(t, retryDump{Attempts: 3, Delay: "1s", MaxDelay: "30s", Factor: 2}, res.Retry)
+		assert.Equal(t, "10m0s", res.TimeoutTotal)
+	})
+
+	t.Run("text", func(t *testing.T) {
+		opts.JSON = false
+		var out bytes.Buffer
+		require.NoError(t, dumpProviders(&out, opts))
+		assert.NotContains(t, out.String(), "sk-")
+		assert.Contains(t, out.String(), "OpenAI (openai)\n  enabled:            true\n  model:              gpt-4o\n")
+		assert.Contains(t, out.String(), "  api key:            keyring:anthropic\n")
+		assert.Contains(t, out.String(), "  backend:            vertex, location europe-west4\n")
+		assert.Contains(t, out.String(), "or (custom)\n")
+		assert.Contains(t, out.String(), "retry: attempts 3, delay 1s, max delay 30s, factor 2\ntimeout total: 10m0s\n")
+	})
+}
+
+func TestCompleteArgs(t *testing.T) {
+	providers := func() []string { return []string{"anthropic", "deepseek", "gateway", "google", "openai"} }
+	models := func(id string) []string {
+		return map[string][]string{"": {"llama-3", "qwen-2"}, "local": {"mistral", "qwen-2", "qwen-3"}}[id]
+	}
+	tests := []struct {
+		name string
+		args []string
+		want []string
+		ok   bool
+	}{
+		{name: "subcommands", args: []string{""}, want: subcommands, ok: true},
+		{name: "subcommand prefix", args: []string{"co"}, want: []string{"completion"}, ok: true},
+		{name: "no args", args: nil, want: subcommands, ok: true},
+		{name: "shells", args: []string{"completion", "f"}, want: []string{"fish"}, ok: true},
+		{name: "after shell", args: []string{"completion", "bash", ""}, want: nil, ok: true},
+		{name: "auth args", args: []string{"auth", "s"}, want: nil, ok: true},
+		{name: "providers args", args: []string{"providers", "d"}, want: []string{"dump"}, ok: true},
+		{name: "pricing args", args: []string{"pricing", ""}, want: []string{"show", "update"}, ok: true},
+		{name: "pricing model", args: []string{"pricing", "show", "gp"}, want: nil, ok: true},
+		{name: "provider after equal sign", args: []string{"--only=op"}, want: []string{"--only=openai"}, ok: true},
+		{name: "provider as next arg", args: []string{"-v", "--skip", "g"}, want: []string{"gateway", "google"}, ok: true},
+		{name: "provider chain", args: []string{"--mix.provider=openai,an"}, want: []string{"--mix.provider=openai,anthropic"},
+			ok: true},
+		{name: "choices", args: []string{"--output.format", "t"}, want: []string{"text", "tsv"}, ok: true},
+		{name: "choices after equal sign", args: []string{"--order=la"}, want: []string{"--order=latency"}, ok: true},
+		{name: "custom model", args: []string{"--custom.model", "l"}, want: []string{"llama-3"}, ok: true},
+		{name: "customs model", args: []string{"--customs=local:url=http://localhost:8080/v1,model=qwen"},
+			want: []string{"--customs=local:url=http://localhost:8080/v1,model=qwen-2",
+				"--customs=local:url=http://localhost:8080/v1,model=qwen-3"}, ok: true},
+		{name: "customs model first", args: []string{"--customs", "local:model=m"}, want: []string{"local:model=mistral"},
+			ok: true},
+		{name: "customs other key", args: []string{"--customs", "local:url=http"}, want: nil, ok: true},
+		{name: "option name", args: []string{"--ver"}, want: nil, ok: false},
+		{name: "option without choices", args: []string{"--timeout", "1"}, want: nil, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := completeArgs(tt.args, providers, models)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRunCompletion(t *testing.T) {
+	for _, shell := range completionShells {
+		var out bytes.Buffer
+		require.NoError(t, runCompletion([]string{shell}, &out), shell)
+		assert.Contains(t, out.String(), completionEnv, shell)
+	}
+
+	var out bytes.Buffer
+	err := runCompletion([]string{"tcsh"}, &out)
+	require.EqualError(t, err, "usage: mpt completion bash|zsh|fish|powershell")
+	require.Error(t, runCompletion(nil, &out))
+	assert.Empty(t, out.String())
+}
+
+func TestCompletionFiles(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		data, err := os.ReadFile(filepath.Join("..", "..", "completions", "mpt."+shell))
+		require.NoError(t, err)
+		assert.Equal(t, completionScripts[shell], string(data), "completions/mpt.%s is outdated, run go generate ./cmd/mpt", shell)
+	}
+}
+
+func TestCompletionProviders(t *testing.T) {
+	assert.Equal(t, []string{"anthropic", "deepseek", "google", "openai"}, completionProviders())
+
+	cfg := filepath.Join(t.TempDir(), "config.yml")
+	data := "custom:\n  enabled: true\n  name: Gateway\n  url: http://localhost:1234\n  model: m1\n"
+	require.NoError(t, os.WriteFile(cfg, []byte(data), 0o600))
+	assert.Equal(t, []string{"anthropic", "deepseek", "gateway", "google", "openai"},
+		completionProviders(cfg, filepath.Join(t.TempDir(), "missing.yml")))
+}
+
+func TestCompletionModels(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/models", r.URL.Path)
+		_, _ = w.Write([]byte(`{"data":[{"id":"qwen-3"},{"id":"llama-3"}]}`))
+	}))
+	defer ts.Close()
+
+	cfg := filepath.Join(t.TempDir(), "config.yml")
+	data := "custom:\n  enabled: true\n  name: Gateway\n  url: " + ts.URL + "/v1\n  model: m1\n  discover: true\n" +
+		"customs: [\"local:url=" + ts.URL + "/v1,model=m2,enabled=true\"]\n"
+	require.NoError(t, os.WriteFile(cfg, []byte(data), 0o600))
+	assert.Equal(t, []string{"llama-3", "qwen-3"}, completionModels("", cfg))
+	assert.Equal(t, []string{"llama-3", "qwen-3"}, completionModels("gateway", cfg))
+	assert.Empty(t, completionModels("local", cfg), "discovery not enabled")
+	assert.Empty(t, completionModels("unknown", cfg))
+}
+
+func TestAutoEnableProviders(t *testing.T) {
+	env := map[string]string{"GEMINI_API_KEY": "gemini-key"}
+	getenv := func(k string) string { return env[k] }
+
+	t.Run("enables providers with keys", func(t *testing.T) {
+		opts := &options{Auto: true}
+		opts.OpenAI.APIKey = "sk-1"
+		opts.Anthropic.APIKey, opts.Anthropic.Enabled = "sk-2", true
+		opts.DeepSeek.APIKey = " "
+		assert.Equal(t, []string{"OpenAI", "Google"}, autoEnableProviders(opts, getenv))
+		assert.True(t, opts.OpenAI.Enabled)
+		assert.True(t, opts.Anthropic.Enabled)
+		assert.True(t, opts.Google.Enabled)
+		assert.Equal(t, "gemini-key", opts.Google.APIKey)
+		assert.False(t, opts.DeepSeek.Enabled, "blank key")
+	})
+
+	t.Run("google key kept", func(t *testing.T) {
+		opts := &options{Auto: true}
+		opts.Google.APIKey = "google-key"
+		assert.Equal(t, []string{"Google"}, autoEnableProviders(opts, getenv))
+		assert.Equal(t, "google-key", opts.Google.APIKey)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		for _, opts := range []*options{{}, {Auto: true, NoAuto: true}} {
+			opts.OpenAI.APIKey = "sk-1"
+			before := *opts
+			assert.Empty(t, autoEnableProviders(opts, getenv))
+			assert.Equal(t, before, *opts, "options unchanged without --auto")
+			assert.Empty(t, opts.Google.APIKey, "gemini key not used without --auto")
+		}
+	})
+}
+
+func TestRunBatch(t *testing.T) {
+	dir := t.TempDir()
+	store := batchapi.NewStore(dir)
+	created := time.Now().Add(-time.Hour)
+	require.NoError(t, store.Save(batchapi.Job{ID: "done", Created: created, Prompt: "hello", Batches: []batchapi.Batch{
+		{Provider: "OpenAI", Model: "gpt-5", BatchID: "b1", State: batchapi.StateEnded,
+			Results: []batchapi.Result{{ID: "prompt", Text: "openai answer", Model: "gpt-5"}}},
+		{Provider: "Anthropic", Model: "claude-sonnet-4-5", BatchID: "b2", State: batchapi.StateEnded,
+			Results: []batchapi.Result{{ID: "prompt", Text: "anthropic answer"}}},
+	}}))
+	require.NoError(t, store.Save(batchapi.Job{ID: "pending", Created: created, Prompt: "hello", Batches: []batchapi.Batch{
+		{Provider: "OpenAI", Model: "gpt-5", BatchID: "b1", State: batchapi.StateInProgress}}}))
+
+	run := func(opts *options) (string, error) {
+		oldStdout := os.Stdout
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		os.Stdout = w
+		err = runBatch(context.Background(), opts)
+		w.Close()
+		os.Stdout = oldStdout
+		var buf bytes.Buffer
+		_, _ = io.Copy(&buf, r)
+		return buf.String(), err
+	}
+
+	t.Run("done job", func(t *testing.T) {
+		out, err := run(&options{Batch: batchOpts{Job: "done", Dir: dir}, NoProgress: true})
+		require.NoError(t, err)
+		assert.Contains(t, out, "== generated by OpenAI ==\nopenai answer")
+		assert.Contains(t, out, "== generated by Anthropic ==\nanthropic answer")
+	})
+
+	t.Run("done job json", func(t *testing.T) {
+		out, err := run(&options{Batch: batchOpts{Job: "done", Dir: dir}, JSON: true, NoProgress: true})
+		require.NoError(t, err)
+		assert.Contains(t, out, `"text": "openai answer"`)
+		assert.Contains(t, out, `"model": "gpt-5"`)
+	})
+
+	t.Run("job in progress without api key", func(t *testing.T) {
+		_, err := run(&options{Batch: batchOpts{Job: "pending", Dir: dir}})
+		require.EqualError(t, err, "failed to check batch job pending: no batch backend for provider OpenAI")
+	})
+
+	t.Run("unknown job", func(t *testing.T) {
+		_, err := run(&options{Batch: batchOpts{Job: "missing", Dir: dir}})
+		require.ErrorContains(t, err, "batch job missing not found")
+	})
+
+	t.Run("no batch providers", func(t *testing.T) {
+		_, err := run(&options{Batch: batchOpts{API: true, Dir: dir}, Prompt: "hello",
+			Google: googleOpts{Enabled: true, APIKey: "key", Model: "gemini"}})
+		require.EqualError(t, err, "batch api mode requires OpenAI or Anthropic provider enabled with API key")
+	})
+}
+
+func TestBatchBackends(t *testing.T) {
+	opts := &options{OpenAI: openAIOpts{APIKey: "key", Model: "gpt-5"}, Google: googleOpts{Enabled: true, APIKey: "key"}}
+	backends := batchBackends(opts)
+	require.Len(t, backends, 1, "only providers with batch APIs and API keys")
+	assert.Equal(t, "gpt-5", backends["OpenAI"].Model())
+
+	opts.Anthropic = anthropicOpts{APIKey: "key", Model: "claude-sonnet-4-5"}
+	backends = batchBackends(opts)
+	require.Len(t, backends, 2)
+	assert.Equal(t, "Anthropic", backends["Anthropic"].Name())
+
+	opts.Anthropic.Backend = "vertex"
+	assert.Len(t, batchBackends(opts), 1, "anthropic on vertex AI has no batch backend")
+}
+
+func TestWriteBatchStatus(t *testing.T) {
+	job := batchapi.Job{ID: "job-1", Created: time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC), Batches: []batchapi.Batch{
+		{Provider: "OpenAI", Model: "gpt-5", BatchID: "b1", State: batchapi.StateEnded},
+		{Provider: "Anthropic", Model: "claude-sonnet-4-5", BatchID: "b2", State: batchapi.StateInProgress}}}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeBatchStatus(&buf, &options{}, job))
+	assert.Equal(t, "batch job job-1: OpenAI ended, Anthropic in_progress\ncheck results with: mpt --batch.job=job-1\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, writeBatchStatus(&buf, &options{Quiet: true}, job))
+	assert.Equal(t, "job-1\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, writeBatchStatus(&buf, &options{JSON: true}, job))
+	assert.JSONEq(t, `{"job":"job-1","created":"2026-10-16T09:00:00Z","done":false,"batches":[
+		{"provider":"OpenAI","model":"gpt-5","batch_id":"b1","state":"ended"},
+		{"provider":"Anthropic","model":"claude-sonnet-4-5","batch_id":"b2","state":"in_progress"}]}`, buf.String())
+}
+
+func TestSetProvenance(t *testing.T) {
+	started := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	result := &ExecutionResult{MixUsed: true, MixProvider: "OpenAI", Results: []provider.Result{
+		{Provider: "OpenAI", Text: "a", Model: "gpt-5"},
+		{Provider: "Google", Error: errors.New("failed")},
+		{Provider: "Anthropic", Text: "b", Model: "claude-sonnet-4-5"}}}
+
+	setProvenance(&options{Prompt: "hello"}, result, started)
+	assert.Nil(t, result.Provenance, "provenance is set only with --sign")
+
+	setProvenance(&options{Sign: true, Prompt: "hello"}, result, started)
+	p := result.Provenance
+	require.NotNil(t, p)
+	assert.Equal(t, "mpt", p.Tool)
+	assert.Equal(t, revision, p.Version)
+	assert.Equal(t, provenance.HashPrompt("hello"), p.PromptSHA256)
+	assert.Equal(t, started, p.Started)
+	assert.False(t, p.Finished.Before(started))
+	assert.Empty(t, p.KeyID)
+	assert.Equal(t, []provenance.Model{
+		{Provider: "OpenAI", Model: "gpt-5", Role: provenance.RoleAnswer},
+		{Provider: "Anthropic", Model: "claude-sonnet-4-5", Role: provenance.RoleAnswer},
+		{Provider: "OpenAI", Role: provenance.RoleMix},
+	}, p.Models)
+
+	result.MixStages = []mix.Stage{{Provider: "OpenAI"}, {Provider: "Anthropic", Error: errors.New("failed")}}
+	setProvenance(&options{Sign: true, Prompt: "hello"}, result, started)
+	assert.Equal(t, provenance.Model{Provider: "OpenAI", Role: provenance.RoleMix}, result.Provenance.Models[2])
+	assert.Len(t, result.Provenance.Models, 3, "failed mix stages are not recorded")
+}
+
+func TestWriteOutput_Signed(t *testing.T) {
+	dir := t.TempDir()
+	seed := bytes.Repeat([]byte{7}, ed25519.SeedSize)
+	raw := append([]byte("Ed\x00\x00B2"), make([]byte, 32+8+8)...)
+	raw = append(raw, 1, 2, 3, 4, 5, 6, 7, 8)
+	raw = append(raw, ed25519.NewKeyFromSeed(seed)...)
+	raw = append(raw, make([]byte, 32)...)
+	keyFile := filepath.Join(dir, "mpt.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("untrusted comment: minisign secret key\n"+
+		base64.StdEncoding.EncodeToString(raw)+"\n"), 0o600))
+
+	opts := &options{JSON: true, Sign: true, SignKey: keyFile, SignOutput: filepath.Join(dir, "out.minisig"), Prompt: "hello"}
+	require.NoError(t, loadSignKey(opts))
+	result := &ExecutionResult{Text: "answer", Results: []provider.Result{{Provider: "OpenAI", Text: "answer", Model: "gpt-5"}}}
+	setProvenance(opts, result, time.Now())
+
+	var buf bytes.Buffer
+	require.NoError(t, writeOutput(&buf, opts, result))
+	var out struct {
+		Provenance provenance.Provenance `json:"provenance"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+	assert.Equal(t, "0807060504030201", out.Provenance.KeyID)
+	assert.Equal(t, []provenance.Model{{Provider: "OpenAI", Model: "gpt-5", Role: provenance.RoleAnswer}}, out.Provenance.Models)
+
+	sigFile, err := os.ReadFile(opts.SignOutput)
+	require.NoError(t, err)
+	lines := strings.Split(string(sigFile), "\n")
+	require.GreaterOrEqual(t, len(lines), 4)
+	assert.Contains(t, lines[2], "prompt_sha256:"+provenance.HashPrompt("hello"))
+	body, err := base64.StdEncoding.DecodeString(lines[1])
+	require.NoError(t, err)
+	pub := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	assert.True(t, ed25519.Verify(pub, buf.Bytes(), body[10:]), "signature covers the written output")
+
+	t.Run("broken key", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(keyFile, []byte("untrusted comment: key\nbroken\n"), 0o600))
+		require.ErrorContains(t, loadSignKey(opts), "failed to parse sign key")
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeOutput(&buf, &options{JSON: true}, &ExecutionResult{Text: "answer"}))
+		assert.NotContains(t, buf.String(), "provenance")
+	})
+}
+
+func TestLintPrompt(t *testing.T) {
+	t.Run("warnings", func(t *testing.T) {
+		opts := &options{Lint: true, OpenAI: openAIOpts{APIKey: "openai-secret-key"},
+			Prompt: "why does it fail?\n\nconfig:\napi: openai-secret-key"}
+		var buf bytes.Buffer
+		require.NoError(t, lintPrompt(&buf, opts, "why does it fail?"))
+		assert.Equal(t, "lint: secret at line 4: likely API key of a configured provider; remove it or replace it "+
+			"with a placeholder, the prompt is sent to providers as is\n", buf.String())
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		opts := &options{LintFail: true, Prompt: "main.go\n\npackage main"}
+		var buf bytes.Buffer
+		require.EqualError(t, lintPrompt(&buf, opts, "main.go"), "prompt lint failed with 1 warning(s)")
+		assert.Contains(t, buf.String(), "lint: question: prompt doesn't ask a question")
+	})
+
+	t.Run("clean", func(t *testing.T) {
+		opts := &options{LintFail: true, Prompt: "explain this code\n\npackage main"}
+		var buf bytes.Buffer
+		require.NoError(t, lintPrompt(&buf, opts, "explain this code"))
+		assert.Empty(t, buf.String())
+	})
+}
+
+func TestReportFileSizes(t *testing.T) {
+	var buf bytes.Buffer
+	reportFileSizes(&buf, []prompt.FileSize{{Name: "pkg/store/db.go", Bytes: 30000, Tokens: 7500},
+		{Name: "git diff", Bytes: 9000, Tokens: 2000}, {Name: "main.go", Bytes: 1800, Tokens: 500}})
+	assert.Equal(t, ""+
+		"  bytes  tokens  context  file\n"+
+		"  30000   ~7500    75.0%  pkg/store/db.go\n"+
+		"   9000   ~2000    20.0%  git diff\n"+
+		"   1800    ~500     5.0%  main.go\n"+
+		"  40800  ~10000   100.0%  total of 3\n", buf.String())
+
+	buf.Reset()
+	reportFileSizes(&buf, nil)
+	assert.Equal(t, "no files included in the prompt\n", buf.String())
+}
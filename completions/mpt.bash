@@ -1,7 +1,14 @@
-# bash completion for mpt (generated via go-flags)
 _mpt() {
-    local args=("${COMP_WORDS[@]:1:$COMP_CWORD}")
-    mapfile -t COMPREPLY < <(GO_FLAGS_COMPLETION=1 "${COMP_WORDS[0]}" "${args[@]}" 2>/dev/null)
-    return 0
+    local line="${COMP_LINE:0:$COMP_POINT}"
+    local -a args
+    read -ra args <<< "$line"
+    [[ "$line" == *" " ]] && args+=("")
+    local word="${args[${#args[@]}-1]}" cur="${COMP_WORDS[COMP_CWORD]}"
+    [[ "$cur" == "=" || "$cur" == ":" ]] && cur=""
+    local strip="${word%"$cur"}"
+    local IFS=$'\n'
+    local -a items
+    items=($(GO_FLAGS_COMPLETION=1 "${args[0]}" "${args[@]:1}"))
+    COMPREPLY=("${items[@]#"$strip"}")
 }
 complete -o default -F _mpt mpt
@@ -1,2 +1,5 @@
-# fish completion for mpt (generated via go-flags)
-complete -c mpt -a '(GO_FLAGS_COMPLETION=verbose mpt (commandline -cop) 2>/dev/null | string replace -r "\\s+# " "\t")'
+function __mpt_complete
+    set -l args (commandline -opc)[2..-1] (commandline -ct)
+    env GO_FLAGS_COMPLETION=1 mpt $args
+end
+complete -c mpt -f -a '(__mpt_complete)'
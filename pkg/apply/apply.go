@@ -0,0 +1,148 @@
+// Package apply extracts files from fenced code blocks of an answer annotated with file paths, like
+// "```go title=main.go" or a "// file: main.go" header line, and writes them under a directory, closing the
+// loop of prompts generating files.
+package apply
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// File is a file extracted from a code block of the answer
+type File struct {
+	Path    string // path relative to the output directory, with forward slashes
+	Content string
+}
+
+// Write is a planned or done write of a file
+type Write struct {
+	File
+	Exists bool // file existed before and is overwritten
+}
+
+// attrRe matches the path attribute of the fence info string, like title=main.go or file="cmd/main.go"
+var attrRe = regexp.MustCompile(`(?:^|\s)(?:title|file|path|filename)=(?:"([^"]+)"|'([^']+)'|(\S+))`)
+
+// headerRe matches the file header on the first line of a code block, like "// file: main.go",
+// "# file: run.sh" or "<!-- file: index.html -->"
+var headerRe = regexp.MustCompile(`^\s*(?://|#|--|;|<!--|/\*)\s*file(?:name)?:\s*(\S+?)\s*(?:-->|\*/)?\s*$`)
+
+// Extract returns files of fenced code blocks annotated with file paths, in the order of the answer. The path is
+// taken from the fence info string or from the header on the first line of the block, which is not included
+// in the content. Blocks without a path are skipped, and a file defined more than once gets the last content.
+func Extract(text string) []File {
+	var res []File
+	index := map[string]int{}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		fence, info, ok := openingFence(lines[i])
+		if !ok {
+			continue
+		}
+		end := i + 1
+		for end < len(lines) && !closingFence(lines[end], fence) {
+			end++
+		}
+		body := lines[i+1 : end]
+		i = end
+
+		path := infoPath(info)
+		if path == "" && len(body) > 0 {
+			if m := headerRe.FindStringSubmatch(body[0]); m != nil {
+				path, body = m[1], body[1:]
+			}
+		}
+		if path = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "./"); path == "" || path == "." {
+			continue
+		}
+		f := File{Path: path, Content: strings.Join(body, "\n") + "\n"}
+		if n, ok := index[path]; ok {
+			res[n] = f
+			continue
+		}
+		index[path] = len(res)
+		res = append(res, f)
+	}
+	return res
+}
+
+// openingFence returns the fence and the info string of the line opening a code block
+func openingFence(line string) (fence, info string, ok bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return "", "", false
+	}
+	for _, ch := range []string{"`", "~"} {
+		n := len(trimmed) - len(strings.TrimLeft(trimmed, ch))
+		if n >= 3 {
+			fence, info = trimmed[:n], strings.TrimSpace(trimmed[n:])
+			if ch == "`" && strings.Contains(info, "`") {
+				return "", "", false
+			}
+			return fence, info, true
+		}
+	}
+	return "", "", false
+}
+
+// closingFence checks if the line closes the code block opened with the fence
+func closingFence(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// infoPath returns the path set in the fence info string, empty if not set
+func infoPath(info string) string {
+	m := attrRe.FindStringSubmatch(info)
+	if m == nil {
+		return ""
+	}
+	return m[1] + m[2] + m[3]
+}
+
+// Plan checks paths of files are local to the directory and returns writes of the files. Absolute paths and
+// paths escaping the directory are rejected.
+func Plan(dir string, files []File) ([]Write, error) {
+	res := make([]Write, 0, len(files))
+	for _, f := range files {
+		if !filepath.IsLocal(filepath.FromSlash(f.Path)) {
+			return nil, fmt.Errorf("path %q is outside of the output directory", f.Path)
+		}
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to check %s: %w", f.Path, err)
+		}
+		res = append(res, Write{File: f, Exists: err == nil})
+	}
+	return res, nil
+}
+
+// Apply writes the files under the directory, creating it and parent directories of files as needed.
+// Writes can't escape the directory, even with symlinks inside it.
+func Apply(dir string, writes []Write) error {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open output directory: %w", err)
+	}
+	defer root.Close()
+	for _, w := range writes {
+		name := filepath.FromSlash(w.Path)
+		if d := filepath.Dir(name); d != "." {
+			if err := root.MkdirAll(d, 0o750); err != nil {
+				return fmt.Errorf("failed to create directory of %s: %w", w.Path, err)
+			}
+		}
+		if err := root.WriteFile(name, []byte(w.Content), 0o644); err != nil { //nolint:gosec // generated files are regular project files
+			return fmt.Errorf("failed to write %s: %w", w.Path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package apply
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	text := "Here are the files.\n\n" +
+		"```go title=cmd/main.go\npackage main\n\nfunc main() {}\n```\n\n" +
+		"```yaml\n# file: config.yml\nname: app\n```\n\n" +
+		"```python\nprint('no path')\n```\n\n" +
+		"````markdown file=\"docs/README.md\"\n# Docs\n```sh\nmake\n```\n````\n\n" +
+		"~~~html\n<!-- file: ./web/index.html -->\n<p>hi</p>\n~~~\n\n" +
+		"```go\n// file: cmd/main.go\npackage main // updated\n```\n"
+
+	assert.Equal(t, []File{
+		{Path: "cmd/main.go", Content: "package main // updated\n"},
+		{Path: "config.yml", Content: "name: app\n"},
+		{Path: "docs/README.md", Content: "# Docs\n```sh\nmake\n```\n"},
+		{Path: "web/index.html", Content: "<p>hi</p>\n"},
+	}, Extract(text))
+
+	assert.Empty(t, Extract("no code blocks"))
+	assert.Equal(t, []File{{Path: "a.txt", Content: "unclosed\n"}}, Extract("```text path='a.txt'\nunclosed"))
+}
+
+func TestPlanAndApply(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "cmd"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cmd", "main.go"), []byte("old"), 0o600))
+
+	files := []File{{Path: "cmd/main.go", Content: "package main\n"}, {Path: "pkg/app/app.go", Content: "package app\n"}}
+	writes, err := Plan(dir, files)
+	require.NoError(t, err)
+	assert.Equal(t, []Write{{File: files[0], Exists: true}, {File: files[1]}}, writes)
+
+	require.NoError(t, Apply(dir, writes))
+	data, err := os.ReadFile(filepath.Join(dir, "cmd", "main.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n", string(data))
+	data, err = os.ReadFile(filepath.Join(dir, "pkg", "app", "app.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "package app\n", string(data))
+
+	t.Run("outside of directory", func(t *testing.T) {
+		for _, path := range []string{"../escape.go", "/etc/passwd"} {
+			_, err := Plan(dir, []File{{Path: path, Content: "x"}})
+			require.ErrorContains(t, err, "is outside of the output directory", path)
+		}
+	})
+
+	t.Run("symlink escaping directory", func(t *testing.T) {
+		outside := t.TempDir()
+		require.NoError(t, os.Symlink(outside, filepath.Join(dir, "link")))
+		err := Apply(dir, []Write{{File: File{Path: "link/evil.go", Content: "x"}}})
+		require.Error(t, err)
+		_, statErr := os.Stat(filepath.Join(outside, "evil.go"))
+		assert.True(t, os.IsNotExist(statErr), "nothing written outside of the directory")
+	})
+}
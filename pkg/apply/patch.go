@@ -0,0 +1,150 @@
+package apply
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// PatchedFile is a file changed by the patch
+type PatchedFile struct {
+	Path  string
+	Hunks int
+}
+
+// ExtractDiff returns the unified diff of the answer, the content of the first diff or patch code block if any,
+// or the text starting at the first diff header otherwise
+func ExtractDiff(text string) (string, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		fence, info, ok := openingFence(lines[i])
+		if !ok {
+			continue
+		}
+		end := i + 1
+		for end < len(lines) && !closingFence(lines[end], fence) {
+			end++
+		}
+		if lang, _, _ := strings.Cut(info, " "); lang == "diff" || lang == "patch" {
+			return checkDiff(strings.Join(lines[i+1:end], "\n") + "\n")
+		}
+		i = end
+	}
+	for i, line := range lines {
+		if strings.HasPrefix(line, "diff --git ") || strings.HasPrefix(line, "--- ") && i+1 < len(lines) &&
+			strings.HasPrefix(lines[i+1], "+++ ") {
+			return checkDiff(strings.Join(lines[i:], "\n"))
+		}
+	}
+	return "", errors.New("no unified diff in the answer")
+}
+
+// checkDiff checks the diff has hunks of at least one file
+func checkDiff(diff string) (string, error) {
+	if len(DiffFiles(diff)) == 0 {
+		return "", errors.New("no unified diff in the answer")
+	}
+	if !strings.HasSuffix(diff, "\n") {
+		diff += "\n"
+	}
+	return diff, nil
+}
+
+// DiffFiles returns files changed by the unified diff with the number of hunks of each file. File headers are
+// "--- " lines followed by "+++ " lines, so removed lines starting with "--" are not taken for them.
+func DiffFiles(diff string) []PatchedFile {
+	var res []PatchedFile
+	lines := strings.Split(diff, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			path := diffPath(lines[i+1][4:])
+			if path == "/dev/null" {
+				path = diffPath(line[4:]) // deleted file
+			}
+			res = append(res, PatchedFile{Path: path})
+		case strings.HasPrefix(line, "@@ ") && len(res) > 0:
+			res[len(res)-1].Hunks++
+		}
+	}
+	return res
+}
+
+// diffPath returns the path of the file header without the a/ or b/ prefix and the timestamp
+func diffPath(header string) string {
+	path, _, _ := strings.Cut(header, "\t")
+	path = strings.TrimSpace(path)
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		return path[2:]
+	}
+	return path
+}
+
+// GitRunner runs git commands, e.g. the git executor of the prompt package
+type GitRunner interface {
+	LookPath(file string) (string, error)
+	Command(name string, args ...string) *exec.Cmd
+	CommandOutput(cmd *exec.Cmd) ([]byte, error)
+}
+
+// Patcher applies unified diffs to the working tree with git apply
+type Patcher struct {
+	git GitRunner
+	dir string // working tree, current directory if empty
+}
+
+// NewPatcher makes a patcher applying diffs to the working tree in the directory
+func NewPatcher(git GitRunner, dir string) *Patcher {
+	return &Patcher{git: git, dir: dir}
+}
+
+// Check checks the diff applies cleanly, without changing the working tree.
+// It returns an error with conflicts reported by git if it doesn't.
+func (p *Patcher) Check(diff string) error {
+	_, err := p.check(diff)
+	return err
+}
+
+// Apply checks the diff applies cleanly and applies it to the working tree. Nothing is changed on conflicts.
+func (p *Patcher) Apply(diff string) error {
+	flags, err := p.check(diff)
+	if err != nil {
+		return err
+	}
+	return p.run(diff, flags...)
+}
+
+// check checks the diff applies cleanly as is, or with line counts of hunks recounted, as models often get them
+// wrong, and returns flags of git apply the diff applies with. Counts are not always recounted, as recounting
+// takes file headers without "diff --git" line for removed lines of the previous hunk.
+func (p *Patcher) check(diff string) ([]string, error) {
+	err := p.run(diff, "--check")
+	if err == nil {
+		return nil, nil
+	}
+	if p.run(diff, "--check", "--recount") == nil {
+		return []string{"--recount"}, nil
+	}
+	return nil, err
+}
+
+// run runs git apply with the diff on stdin
+func (p *Patcher) run(diff string, args ...string) error {
+	if _, err := p.git.LookPath("git"); err != nil {
+		return errors.New("git is not installed or not in PATH")
+	}
+	cmd := p.git.Command("git", append(append([]string{"apply"}, args...), "-")...)
+	cmd.Dir = p.dir
+	cmd.Stdin = strings.NewReader(diff)
+	if _, err := p.git.CommandOutput(cmd); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(bytes.TrimSpace(exitErr.Stderr)) > 0 {
+			return fmt.Errorf("patch doesn't apply: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return fmt.Errorf("failed to apply patch: %w", err)
+	}
+	return nil
+}
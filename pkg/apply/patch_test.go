@@ -0,0 +1,97 @@
+package apply
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDiff = `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,3 @@
+ package main
+ 
+-func main() {}
++func main() { run() }
+--- /dev/null
++++ b/run.go
+@@ -0,0 +1,3 @@
++package main
++
++func run() {}
+`
+
+func TestExtractDiff(t *testing.T) {
+	diff, err := ExtractDiff("Here is the fix:\n\n```diff\n" + testDiff + "```\n\nIt calls run.")
+	require.NoError(t, err)
+	assert.Equal(t, testDiff, diff)
+
+	diff, err = ExtractDiff("The fix:\n" + testDiff)
+	require.NoError(t, err)
+	assert.Equal(t, testDiff, diff)
+
+	_, err = ExtractDiff("```go\npackage main\n```")
+	require.EqualError(t, err, "no unified diff in the answer")
+}
+
+func TestDiffFiles(t *testing.T) {
+	assert.Equal(t, []PatchedFile{{Path: "main.go", Hunks: 1}, {Path: "run.go", Hunks: 1}}, DiffFiles(testDiff))
+	deleted := "--- a/old.go\t2024-01-01\n+++ /dev/null\n@@ -1 +0,0 @@\n-package old\n"
+	assert.Equal(t, []PatchedFile{{Path: "old.go", Hunks: 1}}, DiffFiles(deleted))
+}
+
+func TestPatcher(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	require.NoError(t, exec.Command("git", "-C", dir, "init", "-q").Run())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o600))
+	p := NewPatcher(execGit{}, dir)
+
+	require.NoError(t, p.Check(testDiff))
+	_, err := os.Stat(filepath.Join(dir, "run.go"))
+	assert.True(t, os.IsNotExist(err), "check doesn't change the working tree")
+
+	require.NoError(t, p.Apply(testDiff))
+	data, err := os.ReadFile(filepath.Join(dir, "main.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n\nfunc main() { run() }\n", string(data))
+	data, err = os.ReadFile(filepath.Join(dir, "run.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n\nfunc run() {}\n", string(data))
+
+	err = p.Apply(testDiff)
+	require.ErrorContains(t, err, "patch doesn't apply")
+	require.ErrorContains(t, err, "main.go")
+
+	t.Run("miscounted hunk", func(t *testing.T) {
+		diff := "--- a/run.go\n+++ b/run.go\n@@ -1,2 +1,2 @@\n package main\n \n-func run() {}\n+func run() { println() }\n"
+		require.NoError(t, p.Apply(diff))
+		data, err := os.ReadFile(filepath.Join(dir, "run.go"))
+		require.NoError(t, err)
+		assert.Equal(t, "package main\n\nfunc run() { println() }\n", string(data))
+	})
+}
+
+func TestPatcher_NoGit(t *testing.T) {
+	p := NewPatcher(noGit{}, t.TempDir())
+	require.EqualError(t, p.Check(testDiff), "git is not installed or not in PATH")
+}
+
+// noGit is a git runner without git installed
+type noGit struct{ execGit }
+
+func (noGit) LookPath(string) (string, error) { return "", exec.ErrNotFound }
+
+// execGit runs git commands with os/exec
+type execGit struct{}
+
+func (execGit) LookPath(file string) (string, error)          { return exec.LookPath(file) }
+func (execGit) Command(name string, args ...string) *exec.Cmd { return exec.Command(name, args...) }
+func (execGit) CommandOutput(cmd *exec.Cmd) ([]byte, error)   { return cmd.Output() }
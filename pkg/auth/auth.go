@@ -0,0 +1,224 @@
+// Package auth authenticates clients of HTTP server mode by API keys defined in a YAML file. Each client may be
+// limited to some providers and to a number of requests per minute, and its usage is accounted, so a single
+// server can be shared by several teams.
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+// rateWindow is the window of client rate limits
+const rateWindow = time.Minute
+
+// ErrUnauthorized is returned for missing or unknown API keys
+var ErrUnauthorized = errors.New("invalid or missing API key")
+
+// RateLimitError is returned when the client exceeded its rate limit
+type RateLimitError struct {
+	Limit      int           // requests per minute
+	RetryAfter time.Duration // time until the limit resets
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit of %d requests per minute exceeded, retry after %v", e.Limit, e.RetryAfter)
+}
+
+// Client is a client of the server with its API key
+type Client struct {
+	Name      string   `yaml:"name"`
+	Key       string   `yaml:"key"`
+	Providers []string `yaml:"providers"`  // names of providers the client may use, all providers if empty
+	RateLimit int      `yaml:"rate_limit"` // max requests per minute, 0 for no limit
+}
+
+// AllowsProvider checks if the client may use the provider, names are matched case-insensitively
+func (c Client) AllowsProvider(name string) bool {
+	if len(c.Providers) == 0 {
+		return true
+	}
+	for _, p := range c.Providers {
+		if strings.EqualFold(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Usage is accounted usage of a client
+type Usage struct {
+	Requests    int64                    `json:"requests"`     // accepted requests
+	RateLimited int64                    `json:"rate_limited"` // requests rejected by the rate limit
+	PromptBytes int64                    `json:"prompt_bytes"` // size of prompts sent, counted once per request
+	Providers   map[string]ProviderUsage `json:"providers,omitempty"`
+	LastUsed    time.Time                `json:"last_used,omitzero"`
+}
+
+// ProviderUsage is accounted usage of a provider by a client
+type ProviderUsage struct {
+	Requests      int64 `json:"requests"`
+	Errors        int64 `json:"errors"`
+	ResponseBytes int64 `json:"response_bytes"`
+}
+
+// Authenticator checks API keys of clients, enforces their rate limits and accounts their usage.
+// It is safe for concurrent use.
+type Authenticator struct {
+	clients []client
+	now     func() time.Time
+
+	mu    sync.Mutex
+	usage map[string]*Usage  // client name -> usage
+	rates map[string]*window // client name -> requests in the current window
+}
+
+// client is a configured client with the hash of its key
+type client struct {
+	Client
+	hash [sha256.Size]byte
+}
+
+// window counts requests of a client since its start
+type window struct {
+	start time.Time
+	count int
+}
+
+// Load reads clients from the YAML file, with a list of clients under "clients" key
+func Load(path string) (*Authenticator, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // auth file location is set by the admin
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auth file: %w", err)
+	}
+	var file struct {
+		Clients []Client `yaml:"clients"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid auth file %s: %w", path, err)
+	}
+	a, err := New(file.Clients)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth file %s: %w", path, err)
+	}
+	return a, nil
+}
+
+// New makes an authenticator of the clients. Names and keys of clients should be unique.
+func New(clients []Client) (*Authenticator, error) {
+	if len(clients) == 0 {
+		return nil, errors.New("no clients defined")
+	}
+	a := &Authenticator{now: time.Now, usage: map[string]*Usage{}, rates: map[string]*window{}}
+	names, keys := map[string]bool{}, map[string]bool{}
+	for i, c := range clients {
+		switch {
+		case strings.TrimSpace(c.Name) == "":
+			return nil, fmt.Errorf("client #%d has no name", i+1)
+		case c.Key == "":
+			return nil, fmt.Errorf("client %q has no key", c.Name)
+		case c.RateLimit < 0:
+			return nil, fmt.Errorf("client %q has negative rate limit %d", c.Name, c.RateLimit)
+		case names[c.Name]:
+			return nil, fmt.Errorf("duplicate client %q", c.Name)
+		case keys[c.Key]:
+			return nil, fmt.Errorf("client %q has the same key as another client", c.Name)
+		}
+		names[c.Name], keys[c.Key] = true, true
+		a.clients = append(a.clients, client{Client: c, hash: sha256.Sum256([]byte(c.Key))})
+	}
+	return a, nil
+}
+
+// Authenticate returns the client with the API key. All keys are compared in constant time.
+func (a *Authenticator) Authenticate(key string) (Client, error) {
+	if key == "" {
+		return Client{}, ErrUnauthorized
+	}
+	hash := sha256.Sum256([]byte(key))
+	var res *client
+	for i := range a.clients {
+		if subtle.ConstantTimeCompare(hash[:], a.clients[i].hash[:]) == 1 {
+			res = &a.clients[i]
+		}
+	}
+	if res == nil {
+		return Client{}, ErrUnauthorized
+	}
+	return res.Client, nil
+}
+
+// Allow counts a request of the client against its rate limit, returning RateLimitError if it's exceeded
+func (a *Authenticator) Allow(c Client) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	u := a.clientUsage(c.Name)
+	if c.RateLimit > 0 {
+		w := a.rates[c.Name]
+		if w == nil || now.Sub(w.start) >= rateWindow {
+			w = &window{start: now}
+			a.rates[c.Name] = w
+		}
+		if w.count >= c.RateLimit {
+			u.RateLimited++
+			return &RateLimitError{Limit: c.RateLimit, RetryAfter: w.start.Add(rateWindow).Sub(now)}
+		}
+		w.count++
+	}
+	u.Requests++
+	u.LastUsed = now
+	return nil
+}
+
+// Record accounts the prompt and provider results of the client request
+func (a *Authenticator) Record(c Client, prompt string, results []provider.Result) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	u := a.clientUsage(c.Name)
+	u.PromptBytes += int64(len(prompt))
+	for _, r := range results {
+		pu := u.Providers[r.Provider]
+		pu.Requests++
+		if r.Error != nil {
+			pu.Errors++
+		}
+		pu.ResponseBytes += int64(len(r.Text))
+		u.Providers[r.Provider] = pu
+	}
+}
+
+// Usage returns the accounted usage of the client
+func (a *Authenticator) Usage(name string) Usage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	u, ok := a.usage[name]
+	if !ok {
+		return Usage{}
+	}
+	res := *u
+	res.Providers = make(map[string]ProviderUsage, len(u.Providers))
+	for k, v := range u.Providers {
+		res.Providers[k] = v
+	}
+	return res
+}
+
+// clientUsage returns usage of the client, creating it if missing, must be called with the lock held
+func (a *Authenticator) clientUsage(name string) *Usage {
+	u, ok := a.usage[name]
+	if !ok {
+		u = &Usage{Providers: map[string]ProviderUsage{}}
+		a.usage[name] = u
+	}
+	return u
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.yml")
+	data := `clients:
+  - name: backend
+    key: key-backend
+    providers: [openai, google]
+    rate_limit: 10
+  - name: docs
+    key: key-docs
+`
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+
+	a, err := Load(path)
+	require.NoError(t, err)
+	c, err := a.Authenticate("key-backend")
+	require.NoError(t, err)
+	assert.Equal(t, Client{Name: "backend", Key: "key-backend", Providers: []string{"openai", "google"}, RateLimit: 10}, c)
+	c, err = a.Authenticate("key-docs")
+	require.NoError(t, err)
+	assert.Equal(t, "docs", c.Name)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yml"))
+	require.ErrorContains(t, err, "failed to read auth file")
+
+	require.NoError(t, os.WriteFile(path, []byte("clients: {}"), 0o600))
+	_, err = Load(path)
+	require.ErrorContains(t, err, "invalid auth file")
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		clients []Client
+		err     string
+	}{
+		{"no clients", nil, "no clients defined"},
+		{"no name", []Client{{Key: "k"}}, "client #1 has no name"},
+		{"no key", []Client{{Name: "a"}}, `client "a" has no key`},
+		{"negative rate", []Client{{Name: "a", Key: "k", RateLimit: -1}}, `client "a" has negative rate limit -1`},
+		{"duplicate name", []Client{{Name: "a", Key: "k1"}, {Name: "a", Key: "k2"}}, `duplicate client "a"`},
+		{"duplicate key", []Client{{Name: "a", Key: "k"}, {Name: "b", Key: "k"}}, `client "b" has the same key as another client`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.clients)
+			require.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	a, err := New([]Client{{Name: "a", Key: "key-a"}, {Name: "b", Key: "key-b"}})
+	require.NoError(t, err)
+
+	c, err := a.Authenticate("key-b")
+	require.NoError(t, err)
+	assert.Equal(t, "b", c.Name)
+
+	for _, key := range []string{"", "key", "key-c"} {
+		_, err = a.Authenticate(key)
+		require.ErrorIs(t, err, ErrUnauthorized, key)
+	}
+}
+
+func TestClient_AllowsProvider(t *testing.T) {
+	assert.True(t, Client{}.AllowsProvider("OpenAI"), "all providers allowed by default")
+	c := Client{Providers: []string{"openai", "Google"}}
+	assert.True(t, c.AllowsProvider("OpenAI"))
+	assert.True(t, c.AllowsProvider("google"))
+	assert.False(t, c.AllowsProvider("Anthropic"))
+}
+
+func TestAuthenticator_Allow(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	limited, unlimited := Client{Name: "limited", Key: "k1", RateLimit: 2}, Client{Name: "unlimited", Key: "k2"}
+	a, err := New([]Client{limited, unlimited})
+	require.NoError(t, err)
+	a.now = func() time.Time { return now }
+
+	require.NoError(t, a.Allow(limited))
+	now = now.Add(20 * time.Second)
+	require.NoError(t, a.Allow(limited))
+	err = a.Allow(limited)
+	var rlErr *RateLimitError
+	require.True(t, errors.As(err, &rlErr))
+	assert.Equal(t, 40*time.Second, rlErr.RetryAfter)
+	assert.EqualError(t, err, "rate limit of 2 requests per minute exceeded, retry after 40s")
+
+	now = now.Add(40 * time.Second)
+	require.NoError(t, a.Allow(limited), "limit reset after the window")
+
+	for range 10 {
+		require.NoError(t, a.Allow(unlimited))
+	}
+
+	u := a.Usage("limited")
+	assert.Equal(t, int64(3), u.Requests)
+	assert.Equal(t, int64(1), u.RateLimited)
+	assert.Equal(t, now, u.LastUsed)
+	assert.Equal(t, int64(10), a.Usage("unlimited").Requests)
+}
+
+func TestAuthenticator_Record(t *testing.T) {
+	c := Client{Name: "a", Key: "k"}
+	a, err := New([]Client{c})
+	require.NoError(t, err)
+	assert.Equal(t, Usage{}, a.Usage("a"), "no usage yet")
+
+	a.Record(c, "prompt", []provider.Result{{Provider: "OpenAI", Text: "answer"}, {Provider: "Google", Error: errors.New("failed")}})
+	a.Record(c, "q", []provider.Result{{Provider: "OpenAI", Text: "ok"}})
+
+	u := a.Usage("a")
+	assert.Equal(t, int64(7), u.PromptBytes)
+	assert.Equal(t, map[string]ProviderUsage{
+		"OpenAI": {Requests: 2, ResponseBytes: 8},
+		"Google": {Requests: 1, Errors: 1},
+	}, u.Providers)
+
+	u.Providers["OpenAI"] = ProviderUsage{}
+	assert.Equal(t, int64(2), a.Usage("a").Providers["OpenAI"].Requests, "returned usage is a copy")
+}
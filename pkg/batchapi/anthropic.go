@@ -0,0 +1,105 @@
+package batchapi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+// Anthropic sends requests through Anthropic Message Batches API
+type Anthropic struct {
+	client anthropic.Client
+	opts   Options
+}
+
+// NewAnthropic makes a backend of Anthropic Message Batches API
+func NewAnthropic(opts Options) *Anthropic {
+	clientOpts := []option.RequestOption{option.WithAPIKey(opts.APIKey), option.WithHTTPClient(opts.httpClient())}
+	if opts.BaseURL != "" {
+		clientOpts = append(clientOpts, option.WithBaseURL(opts.BaseURL))
+	}
+	return &Anthropic{client: anthropic.NewClient(clientOpts...), opts: opts}
+}
+
+// Name returns the provider name
+func (a *Anthropic) Name() string { return "Anthropic" }
+
+// Model returns the model requests are sent to
+func (a *Anthropic) Model() string { return a.opts.Model }
+
+// Submit creates the message batch with requests
+func (a *Anthropic) Submit(ctx context.Context, reqs []Request) (string, error) {
+	if len(reqs) == 0 {
+		return "", fmt.Errorf("no requests to submit")
+	}
+	params := anthropic.MessageBatchNewParams{Requests: make([]anthropic.MessageBatchNewParamsRequest, 0, len(reqs))}
+	for _, r := range reqs {
+		req := anthropic.MessageBatchNewParamsRequest{CustomID: r.ID, Params: anthropic.MessageBatchNewParamsRequestParams{
+			Model:         anthropic.Model(a.opts.Model),
+			MaxTokens:     int64(a.opts.maxTokens()),
+			Messages:      []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(r.Prompt))},
+			StopSequences: a.opts.Stop,
+		}}
+		if a.opts.Temperature >= 0 {
+			req.Params.Temperature = anthropic.Float(float64(a.opts.Temperature))
+		}
+		params.Requests = append(params.Requests, req)
+	}
+	batch, err := a.client.Messages.Batches.New(ctx, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to create batch: anthropic api error: %w", err)
+	}
+	return batch.ID, nil
+}
+
+// Status returns the processing state of the batch
+func (a *Anthropic) Status(ctx context.Context, batchID string) (Status, error) {
+	batch, err := a.client.Messages.Batches.Get(ctx, batchID)
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to get batch %s: anthropic api error: %w", batchID, err)
+	}
+	c := batch.RequestCounts
+	res := Status{State: StateInProgress, Succeeded: int(c.Succeeded), Failed: int(c.Errored + c.Canceled + c.Expired),
+		Total: int(c.Succeeded + c.Errored + c.Canceled + c.Expired + c.Processing)}
+	if batch.ProcessingStatus == anthropic.MessageBatchProcessingStatusEnded {
+		res.State = StateEnded
+	}
+	return res, nil
+}
+
+// Results streams results of the ended batch
+func (a *Anthropic) Results(ctx context.Context, batchID string) ([]Result, error) {
+	stream := a.client.Messages.Batches.ResultsStreaming(ctx, batchID)
+	defer stream.Close()
+	var res []Result
+	for stream.Next() {
+		item := stream.Current()
+		r := Result{ID: item.CustomID}
+		switch item.Result.Type {
+		case "succeeded":
+			msg := item.Result.Message
+			var parts []string
+			for _, c := range msg.Content {
+				if c.Type == "text" {
+					parts = append(parts, c.Text)
+				}
+			}
+			r.Text, r.Model, r.FinishReason, r.RequestID = strings.Join(parts, ""), string(msg.Model), string(msg.StopReason), msg.ID
+			if r.Text == "" {
+				r.Error = "empty response"
+			}
+		case "errored":
+			r.Error = item.Result.Error.Error.Message
+		default:
+			r.Error = "request " + item.Result.Type // canceled or expired
+		}
+		res = append(res, r)
+	}
+	if err := stream.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get results of batch %s: anthropic api error: %w", batchID, err)
+	}
+	return res, nil
+}
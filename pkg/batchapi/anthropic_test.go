@@ -0,0 +1,74 @@
+package batchapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnthropic_Batch(t *testing.T) {
+	var created map[string]any
+	status := "in_progress"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "key", r.Header.Get("X-Api-Key"))
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/messages/batches":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+			_, _ = w.Write([]byte(`{"id":"msgbatch_1","type":"message_batch","processing_status":"in_progress"}`))
+		case r.URL.Path == "/v1/messages/batches/msgbatch_1":
+			_, _ = w.Write([]byte(`{"id":"msgbatch_1","type":"message_batch","processing_status":"` + status + `",` +
+				`"request_counts":{"processing":1,"succeeded":2,"errored":1,"canceled":0,"expired":1}}`))
+		case r.URL.Path == "/v1/messages/batches/msgbatch_1/results":
+			_, _ = w.Write([]byte(`{"custom_id":"r1","result":{"type":"succeeded","message":{"id":"msg_1","type":"message",` +
+				`"role":"assistant","model":"claude-sonnet-4-5","stop_reason":"end_turn","content":[{"type":"text","text":"answer"}]}}}
+{"custom_id":"r2","result":{"type":"errored","error":{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long"}}}}
+{"custom_id":"r3","result":{"type":"expired"}}
+`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"not_found_error","message":"not found"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	b := NewAnthropic(Options{APIKey: "key", Model: "claude-sonnet-4-5", Temperature: -1, Stop: []string{"END"}, BaseURL: srv.URL})
+	assert.Equal(t, "Anthropic", b.Name())
+	assert.Equal(t, "claude-sonnet-4-5", b.Model())
+
+	id, err := b.Submit(context.Background(), []Request{{ID: "r1", Prompt: "hello"}})
+	require.NoError(t, err)
+	assert.Equal(t, "msgbatch_1", id)
+	expected := `{"requests":[{"custom_id":"r1","params":{"max_tokens":16384,"model":"claude-sonnet-4-5",` +
+		`"stop_sequences":["END"],"messages":[{"role":"user","content":[{"type":"text","text":"hello"}]}]}}]}`
+	data, err := json.Marshal(created)
+	require.NoError(t, err)
+	assert.JSONEq(t, expected, string(data), "temperature is not set if negative")
+
+	st, err := b.Status(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, Status{State: StateInProgress, Total: 5, Succeeded: 2, Failed: 2}, st)
+
+	status = "ended"
+	st, err = b.Status(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, StateEnded, st.State)
+
+	res, err := b.Results(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, []Result{
+		{ID: "r1", Text: "answer", Model: "claude-sonnet-4-5", FinishReason: "end_turn", RequestID: "msg_1"},
+		{ID: "r2", Error: "prompt is too long"},
+		{ID: "r3", Error: "request expired"},
+	}, res)
+
+	_, err = b.Status(context.Background(), "msgbatch_2")
+	require.ErrorContains(t, err, "failed to get batch msgbatch_2: anthropic api error")
+	_, err = b.Submit(context.Background(), nil)
+	require.EqualError(t, err, "no requests to submit")
+}
@@ -0,0 +1,139 @@
+// Package batchapi sends prompts through asynchronous batch APIs of providers, OpenAI Batch and Anthropic
+// Message Batches, served within 24 hours at half the price of regular requests. Submitted jobs are persisted
+// to a Store, so results can be retrieved by later runs.
+package batchapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Backend submits requests to a batch API of the provider and retrieves their results
+type Backend interface {
+	Name() string
+	Model() string
+	Submit(ctx context.Context, reqs []Request) (batchID string, err error)
+	Status(ctx context.Context, batchID string) (Status, error)
+	Results(ctx context.Context, batchID string) ([]Result, error)
+}
+
+// Options defines options of batch backends
+type Options struct {
+	APIKey          string
+	Model           string
+	MaxTokens       int     // max tokens to generate, DefaultMaxTokens if not positive
+	Temperature     float32 // negative to use the default temperature of the model
+	ReasoningEffort string  // reasoning effort of OpenAI reasoning models
+	Stop            []string
+	BaseURL         string       // base URL of the API, the official API if empty
+	HTTPClient      *http.Client // http.DefaultClient if nil
+}
+
+// DefaultMaxTokens defines max tokens to generate if not set, batch APIs require the limit
+const DefaultMaxTokens = 16384
+
+// Request is a prompt sent in a batch, ID matches it with the result
+type Request struct {
+	ID     string `json:"id"`
+	Prompt string `json:"prompt"`
+}
+
+// Result is the answer to the request with the same ID, or the error of the request
+type Result struct {
+	ID           string `json:"id"`
+	Text         string `json:"text,omitempty"`
+	Model        string `json:"model,omitempty"`
+	FinishReason string `json:"finish_reason,omitempty"`
+	RequestID    string `json:"request_id,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// State is the processing state of a batch
+type State string
+
+// processing states of batches
+const (
+	StateInProgress State = "in_progress" // requests are processed
+	StateEnded      State = "ended"       // processing ended, results of completed requests are available
+	StateFailed     State = "failed"      // the batch failed as a whole, no results are available
+)
+
+// Status is the processing state of a batch with counts of its requests
+type Status struct {
+	State     State
+	Total     int
+	Succeeded int
+	Failed    int
+	Message   string // reason of the failed batch
+}
+
+// Done checks if the batch isn't processed anymore
+func (s Status) Done() bool {
+	return s.State != StateInProgress
+}
+
+// Collect checks the status of batches of the job in progress and retrieves results of the ended ones.
+// Backends are looked up by provider name of batches.
+func Collect(ctx context.Context, job *Job, backends map[string]Backend) error {
+	for i, b := range job.Batches {
+		if b.State != StateInProgress {
+			continue
+		}
+		backend, ok := backends[b.Provider]
+		if !ok {
+			return fmt.Errorf("no batch backend for provider %s", b.Provider)
+		}
+		st, err := backend.Status(ctx, b.BatchID)
+		if err != nil {
+			return err
+		}
+		if st.State == StateEnded {
+			if job.Batches[i].Results, err = backend.Results(ctx, b.BatchID); err != nil {
+				return err
+			}
+		}
+		job.Batches[i].State, job.Batches[i].Message = st.State, st.Message
+	}
+	return nil
+}
+
+// Wait collects results of the job every interval until all batches are done or the context is canceled.
+// The report function, if set, is called after every check, e.g. to save the job.
+func Wait(ctx context.Context, job *Job, backends map[string]Backend, interval time.Duration, report func(*Job)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := Collect(ctx, job, backends); err != nil {
+			return err
+		}
+		if report != nil {
+			report(job)
+		}
+		if job.Done() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// maxTokens returns max tokens to generate, DefaultMaxTokens if not set
+func (o Options) maxTokens() int {
+	if o.MaxTokens <= 0 {
+		return DefaultMaxTokens
+	}
+	return o.MaxTokens
+}
+
+// httpClient returns the http client of options, http.DefaultClient if not set
+func (o Options) httpClient() *http.Client {
+	if o.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return o.HTTPClient
+}
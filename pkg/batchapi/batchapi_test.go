@@ -0,0 +1,91 @@
+package batchapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+func TestWait(t *testing.T) {
+	output := `{"custom_id":"r1","response":{"status_code":200,"body":{"choices":[{"message":{"content":"answer"}}]}}}` + "\n"
+	srv, _ := openAIServer(t, "completed", output, "")
+	failed, _ := openAIServer(t, "failed", "", "")
+	backends := map[string]Backend{
+		"OpenAI": NewOpenAI(Options{APIKey: "key", BaseURL: srv.URL}),
+		"Failed": NewOpenAI(Options{APIKey: "key", BaseURL: failed.URL}),
+	}
+	job := Job{ID: "job", Batches: []Batch{
+		{Provider: "OpenAI", BatchID: "batch-1", State: StateInProgress},
+		{Provider: "Failed", BatchID: "batch-1", State: StateInProgress},
+		{Provider: "Done", BatchID: "batch-0", State: StateEnded, Results: []Result{{ID: "r1", Text: "old"}}},
+	}}
+
+	reports := 0
+	err := Wait(context.Background(), &job, backends, time.Millisecond, func(*Job) { reports++ })
+	require.NoError(t, err)
+	assert.Equal(t, 1, reports)
+	assert.True(t, job.Done())
+	assert.Equal(t, Batch{Provider: "OpenAI", BatchID: "batch-1", State: StateEnded,
+		Results: []Result{{ID: "r1", Text: "answer"}}}, job.Batches[0])
+	assert.Equal(t, Batch{Provider: "Failed", BatchID: "batch-1", State: StateFailed, Message: "invalid input"}, job.Batches[1])
+	assert.Equal(t, "old", job.Batches[2].Results[0].Text, "done batches are not checked")
+
+	t.Run("canceled", func(t *testing.T) {
+		pending, _ := openAIServer(t, "in_progress", "", "")
+		job := Job{ID: "job", Batches: []Batch{{Provider: "OpenAI", BatchID: "batch-1", State: StateInProgress}}}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := Wait(ctx, &job, map[string]Backend{"OpenAI": NewOpenAI(Options{APIKey: "key", BaseURL: pending.URL})},
+			10*time.Millisecond, nil)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.False(t, job.Done())
+	})
+
+	t.Run("no backend", func(t *testing.T) {
+		job := Job{ID: "job", Batches: []Batch{{Provider: "Google", BatchID: "b", State: StateInProgress}}}
+		require.EqualError(t, Collect(context.Background(), &job, backends), "no batch backend for provider Google")
+	})
+}
+
+func TestBatch_AsProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		batch   Batch
+		want    provider.Response
+		wantErr string
+	}{
+		{name: "answer", batch: Batch{Provider: "OpenAI", State: StateEnded, Results: []Result{{ID: "r1", Text: "answer",
+			Model: "gpt-5", FinishReason: "completed", RequestID: "req-1"}}},
+			want: provider.Response{Text: "answer", Model: "gpt-5", FinishReason: "completed", RequestID: "req-1"}},
+		{name: "request error", batch: Batch{Provider: "OpenAI", State: StateEnded, Results: []Result{{ID: "r1", Error: "bad request"}}},
+			wantErr: "bad request"},
+		{name: "no results", batch: Batch{Provider: "OpenAI", BatchID: "b1", State: StateEnded},
+			wantErr: "batch b1 ended without results"},
+		{name: "failed", batch: Batch{Provider: "OpenAI", BatchID: "b1", State: StateFailed, Message: "invalid input"},
+			wantErr: "batch b1 failed: invalid input"},
+		{name: "in progress", batch: Batch{Provider: "OpenAI", BatchID: "b1", State: StateInProgress},
+			wantErr: "batch b1 is in progress"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.batch.AsProvider()
+			assert.Equal(t, "OpenAI", p.Name())
+			assert.True(t, p.Enabled())
+			resp, err := provider.GenerateResponse(context.Background(), p, "prompt")
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, resp)
+			text, err := p.Generate(context.Background(), "prompt")
+			require.NoError(t, err)
+			assert.Equal(t, "answer", text)
+		})
+	}
+}
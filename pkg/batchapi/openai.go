@@ -0,0 +1,323 @@
+package batchapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// maxResultsSize limits the size of API responses, including files with results of all requests of the batch
+const maxResultsSize = 100 * 1024 * 1024
+
+// OpenAI sends requests through OpenAI Batch API. Requests are uploaded as a JSONL file, and results
+// are downloaded from the output and error files of the completed batch.
+type OpenAI struct {
+	opts Options
+}
+
+// NewOpenAI makes a backend of OpenAI Batch API
+func NewOpenAI(opts Options) *OpenAI {
+	if opts.BaseURL == "" {
+		opts.BaseURL = "https://api.openai.com"
+	}
+	opts.BaseURL = strings.TrimSuffix(opts.BaseURL, "/")
+	return &OpenAI{opts: opts}
+}
+
+// Name returns the provider name
+func (o *OpenAI) Name() string { return "OpenAI" }
+
+// Model returns the model requests are sent to
+func (o *OpenAI) Model() string { return o.opts.Model }
+
+// openAIBatch is the batch object of OpenAI Batch API
+type openAIBatch struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	OutputFileID  string `json:"output_file_id"`
+	ErrorFileID   string `json:"error_file_id"`
+	RequestCounts struct {
+		Total     int `json:"total"`
+		Completed int `json:"completed"`
+		Failed    int `json:"failed"`
+	} `json:"request_counts"`
+	Errors *struct {
+		Data []struct {
+			Message string `json:"message"`
+		} `json:"data"`
+	} `json:"errors"`
+}
+
+// openAIOutputLine is a line of the output or error file of the batch
+type openAIOutputLine struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		RequestID  string          `json:"request_id"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// openAIBody is the body of a response, either of responses or chat completions API
+type openAIBody struct {
+	ID     string `json:"id"`
+	Model  string `json:"model"`
+	Status string `json:"status"`
+	Output []struct {
+		Type    string `json:"type"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	} `json:"output"`
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Submit uploads requests as a batch input file and creates the batch from it
+func (o *OpenAI) Submit(ctx context.Context, reqs []Request) (string, error) {
+	if len(reqs) == 0 {
+		return "", fmt.Errorf("no requests to submit")
+	}
+	endpoint := o.endpoint()
+	var input bytes.Buffer
+	enc := json.NewEncoder(&input)
+	for _, r := range reqs {
+		line := map[string]any{"custom_id": r.ID, "method": http.MethodPost, "url": endpoint, "body": o.body(r.Prompt)}
+		if err := enc.Encode(line); err != nil {
+			return "", fmt.Errorf("failed to encode request %s: %w", r.ID, err)
+		}
+	}
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	if err := mw.WriteField("purpose", "batch"); err != nil {
+		return "", fmt.Errorf("failed to make batch input: %w", err)
+	}
+	fw, err := mw.CreateFormFile("file", "batch.jsonl")
+	if err != nil {
+		return "", fmt.Errorf("failed to make batch input: %w", err)
+	}
+	if _, err := fw.Write(input.Bytes()); err != nil {
+		return "", fmt.Errorf("failed to make batch input: %w", err)
+	}
+	if err := mw.Close(); err != nil {
+		return "", fmt.Errorf("failed to make batch input: %w", err)
+	}
+
+	var file struct {
+		ID string `json:"id"`
+	}
+	if err := o.call(ctx, http.MethodPost, "/v1/files", &form, mw.FormDataContentType(), &file); err != nil {
+		return "", fmt.Errorf("failed to upload batch input: %w", err)
+	}
+
+	create, err := json.Marshal(map[string]string{"input_file_id": file.ID, "endpoint": endpoint, "completion_window": "24h"})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode batch: %w", err)
+	}
+	var batch openAIBatch
+	if err := o.call(ctx, http.MethodPost, "/v1/batches", bytes.NewReader(create), "application/json", &batch); err != nil {
+		return "", fmt.Errorf("failed to create batch: %w", err)
+	}
+	return batch.ID, nil
+}
+
+// Status returns the processing state of the batch. Completed, expired and cancelled batches are ended,
+// with results of requests completed before the end.
+func (o *OpenAI) Status(ctx context.Context, batchID string) (Status, error) {
+	batch, err := o.batch(ctx, batchID)
+	if err != nil {
+		return Status{}, err
+	}
+	res := Status{State: StateInProgress, Total: batch.RequestCounts.Total, Succeeded: batch.RequestCounts.Completed,
+		Failed: batch.RequestCounts.Failed}
+	switch batch.Status {
+	case "completed", "expired", "cancelled":
+		res.State = StateEnded
+	case "failed":
+		res.State = StateFailed
+		if batch.Errors != nil && len(batch.Errors.Data) > 0 {
+			res.Message = batch.Errors.Data[0].Message
+		}
+	}
+	return res, nil
+}
+
+// Results downloads results of the ended batch from its output and error files
+func (o *OpenAI) Results(ctx context.Context, batchID string) ([]Result, error) {
+	batch, err := o.batch(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	var res []Result
+	for _, fileID := range []string{batch.OutputFileID, batch.ErrorFileID} {
+		if fileID == "" {
+			continue
+		}
+		data, err := o.do(ctx, http.MethodGet, "/v1/files/"+fileID+"/content", nil, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to download batch results: %w", err)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+		for scanner.Scan() {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			var line openAIOutputLine
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				return nil, fmt.Errorf("failed to parse batch results: %w", err)
+			}
+			res = append(res, o.result(line))
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read batch results: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// endpoint returns the API endpoint of requests, responses API for gpt-5 models and chat completions otherwise
+func (o *OpenAI) endpoint() string {
+	if strings.Contains(strings.ToLower(o.opts.Model), "gpt-5") {
+		return "/v1/responses"
+	}
+	return "/v1/chat/completions"
+}
+
+// body returns the request body of the prompt for the endpoint
+func (o *OpenAI) body(prompt string) map[string]any {
+	if o.endpoint() == "/v1/responses" {
+		// gpt-5 models don't support temperature and stop sequences
+		body := map[string]any{"model": o.opts.Model, "input": prompt, "max_output_tokens": o.opts.maxTokens()}
+		if o.opts.ReasoningEffort != "" {
+			body["reasoning"] = map[string]string{"effort": o.opts.ReasoningEffort}
+		}
+		return body
+	}
+	body := map[string]any{"model": o.opts.Model, "max_completion_tokens": o.opts.maxTokens(),
+		"messages": []map[string]string{{"role": "user", "content": prompt}}}
+	if o.opts.Temperature >= 0 {
+		body["temperature"] = o.opts.Temperature
+	}
+	if len(o.opts.Stop) > 0 {
+		body["stop"] = o.opts.Stop
+	}
+	return body
+}
+
+// result converts a line of the output or error file to the result of the request
+func (o *OpenAI) result(line openAIOutputLine) Result {
+	res := Result{ID: line.CustomID}
+	if line.Error != nil {
+		res.Error = line.Error.Message
+		return res
+	}
+	if line.Response == nil {
+		res.Error = "no response"
+		return res
+	}
+	res.RequestID = line.Response.RequestID
+	var body openAIBody
+	if err := json.Unmarshal(line.Response.Body, &body); err != nil {
+		res.Error = fmt.Sprintf("failed to parse response: %v", err)
+		return res
+	}
+	if body.Error != nil {
+		res.Error = body.Error.Message
+		return res
+	}
+	if line.Response.StatusCode < 200 || line.Response.StatusCode >= 300 {
+		res.Error = fmt.Sprintf("http %d", line.Response.StatusCode)
+		return res
+	}
+	res.Model, res.FinishReason = body.Model, body.Status
+	for _, out := range body.Output {
+		for _, c := range out.Content {
+			if out.Type == "message" && c.Type == "output_text" {
+				res.Text += c.Text
+			}
+		}
+	}
+	if len(body.Choices) > 0 {
+		res.Text, res.FinishReason = body.Choices[0].Message.Content, body.Choices[0].FinishReason
+	}
+	if res.Text == "" {
+		res.Error = "empty response"
+	}
+	return res
+}
+
+// batch returns the batch object
+func (o *OpenAI) batch(ctx context.Context, batchID string) (openAIBatch, error) {
+	var batch openAIBatch
+	if err := o.call(ctx, http.MethodGet, "/v1/batches/"+batchID, nil, "", &batch); err != nil {
+		return openAIBatch{}, fmt.Errorf("failed to get batch %s: %w", batchID, err)
+	}
+	return batch, nil
+}
+
+// call makes the API request and decodes the JSON response to res
+func (o *OpenAI) call(ctx context.Context, method, path string, body io.Reader, contentType string, res any) error {
+	data, err := o.do(ctx, method, path, body, contentType)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, res); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// do makes the API request and returns the response body, error for non-2xx statuses
+func (o *OpenAI) do(ctx context.Context, method, path string, body io.Reader, contentType string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, o.opts.BaseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", "Bearer "+o.opts.APIKey)
+	resp, err := o.opts.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("openai api error: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResultsSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if len(data) > maxResultsSize {
+		return nil, fmt.Errorf("response size exceeds maximum allowed size of %d bytes", maxResultsSize)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			return nil, fmt.Errorf("openai api error, http %d: %s", resp.StatusCode, apiErr.Error.Message)
+		}
+		return nil, fmt.Errorf("openai api error, http %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
@@ -0,0 +1,157 @@
+package batchapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openAIServer fakes OpenAI files and batches endpoints, the batch has the given status and output files
+func openAIServer(t *testing.T, status, output, errors string) (*httptest.Server, *[]string) {
+	t.Helper()
+	var input []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/files":
+			assert.Equal(t, "batch", r.FormValue("purpose"))
+			f, _, err := r.FormFile("file")
+			require.NoError(t, err)
+			data, err := io.ReadAll(f)
+			require.NoError(t, err)
+			input = strings.Split(strings.TrimSpace(string(data)), "\n")
+			_, _ = w.Write([]byte(`{"id":"file-in"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/batches":
+			var req map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, "file-in", req["input_file_id"])
+			assert.Equal(t, "24h", req["completion_window"])
+			_, _ = w.Write([]byte(`{"id":"batch-1","status":"validating"}`))
+		case r.URL.Path == "/v1/batches/batch-1":
+			_, _ = w.Write([]byte(`{"id":"batch-1","status":"` + status + `","output_file_id":"file-out",` +
+				`"error_file_id":"file-err","request_counts":{"total":3,"completed":2,"failed":1},` +
+				`"errors":{"data":[{"message":"invalid input"}]}}`))
+		case r.URL.Path == "/v1/files/file-out/content":
+			_, _ = w.Write([]byte(output))
+		case r.URL.Path == "/v1/files/file-err/content":
+			_, _ = w.Write([]byte(errors))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"message":"no such batch"}}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &input
+}
+
+func TestOpenAI_Submit(t *testing.T) {
+	t.Run("chat completions", func(t *testing.T) {
+		srv, input := openAIServer(t, "", "", "")
+		b := NewOpenAI(Options{APIKey: "key", Model: "gpt-4.1", Temperature: 0.2, Stop: []string{"END"}, BaseURL: srv.URL})
+		id, err := b.Submit(context.Background(), []Request{{ID: "r1", Prompt: "hello"}, {ID: "r2", Prompt: "bye"}})
+		require.NoError(t, err)
+		assert.Equal(t, "batch-1", id)
+		require.Len(t, *input, 2)
+		var line struct {
+			CustomID string         `json:"custom_id"`
+			URL      string         `json:"url"`
+			Body     map[string]any `json:"body"`
+		}
+		require.NoError(t, json.Unmarshal([]byte((*input)[0]), &line))
+		assert.Equal(t, "r1", line.CustomID)
+		assert.Equal(t, "/v1/chat/completions", line.URL)
+		assert.Equal(t, "gpt-4.1", line.Body["model"])
+		assert.InDelta(t, DefaultMaxTokens, line.Body["max_completion_tokens"], 0)
+		assert.InDelta(t, 0.2, line.Body["temperature"], 0.001)
+		assert.Equal(t, []any{"END"}, line.Body["stop"])
+		assert.Equal(t, []any{map[string]any{"role": "user", "content": "hello"}}, line.Body["messages"])
+	})
+
+	t.Run("responses", func(t *testing.T) {
+		srv, input := openAIServer(t, "", "", "")
+		b := NewOpenAI(Options{APIKey: "key", Model: "gpt-5", MaxTokens: 100, Temperature: 0.2, ReasoningEffort: "low",
+			BaseURL: srv.URL + "/"})
+		_, err := b.Submit(context.Background(), []Request{{ID: "r1", Prompt: "hello"}})
+		require.NoError(t, err)
+		require.Len(t, *input, 1)
+		assert.JSONEq(t, `{"custom_id":"r1","method":"POST","url":"/v1/responses","body":{"model":"gpt-5",`+
+			`"input":"hello","max_output_tokens":100,"reasoning":{"effort":"low"}}}`, (*input)[0])
+	})
+
+	t.Run("no requests", func(t *testing.T) {
+		_, err := NewOpenAI(Options{}).Submit(context.Background(), nil)
+		require.EqualError(t, err, "no requests to submit")
+	})
+
+	t.Run("api error", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+		}))
+		defer srv.Close()
+		_, err := NewOpenAI(Options{APIKey: "key", Model: "gpt-4.1", BaseURL: srv.URL}).Submit(context.Background(),
+			[]Request{{ID: "r1", Prompt: "hello"}})
+		require.EqualError(t, err, "failed to upload batch input: openai api error, http 401: invalid api key")
+	})
+}
+
+func TestOpenAI_Status(t *testing.T) {
+	tests := []struct {
+		status string
+		want   Status
+	}{
+		{status: "in_progress", want: Status{State: StateInProgress, Total: 3, Succeeded: 2, Failed: 1}},
+		{status: "finalizing", want: Status{State: StateInProgress, Total: 3, Succeeded: 2, Failed: 1}},
+		{status: "completed", want: Status{State: StateEnded, Total: 3, Succeeded: 2, Failed: 1}},
+		{status: "expired", want: Status{State: StateEnded, Total: 3, Succeeded: 2, Failed: 1}},
+		{status: "failed", want: Status{State: StateFailed, Total: 3, Succeeded: 2, Failed: 1, Message: "invalid input"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			srv, _ := openAIServer(t, tt.status, "", "")
+			st, err := NewOpenAI(Options{APIKey: "key", BaseURL: srv.URL}).Status(context.Background(), "batch-1")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, st)
+			assert.Equal(t, tt.status != "in_progress" && tt.status != "finalizing", st.Done())
+		})
+	}
+
+	t.Run("unknown batch", func(t *testing.T) {
+		srv, _ := openAIServer(t, "", "", "")
+		_, err := NewOpenAI(Options{APIKey: "key", BaseURL: srv.URL}).Status(context.Background(), "batch-2")
+		require.EqualError(t, err, "failed to get batch batch-2: openai api error, http 404: no such batch")
+	})
+}
+
+func TestOpenAI_Results(t *testing.T) {
+	output := `{"custom_id":"r1","response":{"status_code":200,"request_id":"req-1","body":{"model":"gpt-4.1",` +
+		`"choices":[{"message":{"content":"chat answer"},"finish_reason":"stop"}]}}}
+{"custom_id":"r2","response":{"status_code":200,"body":{"model":"gpt-5","status":"completed","output":[` +
+		`{"type":"reasoning"},{"type":"message","content":[{"type":"output_text","text":"responses answer"}]}]}}}
+{"custom_id":"r3","response":{"status_code":400,"body":{"error":{"message":"bad request"}}}}
+`
+	errs := `{"custom_id":"r4","error":{"message":"request expired"}}` + "\n"
+	srv, _ := openAIServer(t, "completed", output, errs)
+
+	res, err := NewOpenAI(Options{APIKey: "key", BaseURL: srv.URL}).Results(context.Background(), "batch-1")
+	require.NoError(t, err)
+	assert.Equal(t, []Result{
+		{ID: "r1", Text: "chat answer", Model: "gpt-4.1", FinishReason: "stop", RequestID: "req-1"},
+		{ID: "r2", Text: "responses answer", Model: "gpt-5", FinishReason: "completed"},
+		{ID: "r3", Error: "bad request"},
+		{ID: "r4", Error: "request expired"},
+	}, res)
+
+	t.Run("invalid results", func(t *testing.T) {
+		srv, _ := openAIServer(t, "completed", "not json\n", "")
+		_, err := NewOpenAI(Options{APIKey: "key", BaseURL: srv.URL}).Results(context.Background(), "batch-1")
+		require.ErrorContains(t, err, "failed to parse batch results")
+	})
+}
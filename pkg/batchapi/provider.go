@@ -0,0 +1,56 @@
+package batchapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+// resultProvider is a provider answering with the result of the done batch
+type resultProvider struct {
+	batch Batch
+}
+
+// AsProvider returns a provider answering any prompt with the result of the first request of the done batch,
+// so batch results are run, formatted and mixed the same way as answers of regular requests
+func (b Batch) AsProvider() provider.Provider {
+	return &resultProvider{batch: b}
+}
+
+// Name returns the provider name of the batch
+func (p *resultProvider) Name() string {
+	return p.batch.Provider
+}
+
+// Enabled returns true, results of batches are always available
+func (p *resultProvider) Enabled() bool {
+	return true
+}
+
+// Generate returns the text of the batch result
+func (p *resultProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := p.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// GenerateResponse returns the batch result with its metadata, or the error of the failed batch or request
+func (p *resultProvider) GenerateResponse(context.Context, string) (provider.Response, error) {
+	b := p.batch
+	switch {
+	case b.State == StateInProgress:
+		return provider.Response{}, fmt.Errorf("batch %s is in progress", b.BatchID)
+	case b.State == StateFailed:
+		return provider.Response{}, fmt.Errorf("batch %s failed: %s", b.BatchID, b.Message)
+	case len(b.Results) == 0:
+		return provider.Response{}, fmt.Errorf("batch %s ended without results", b.BatchID)
+	case b.Results[0].Error != "":
+		return provider.Response{}, errors.New(b.Results[0].Error)
+	}
+	r := b.Results[0]
+	return provider.Response{Text: r.Text, Model: r.Model, FinishReason: r.FinishReason, RequestID: r.RequestID}, nil
+}
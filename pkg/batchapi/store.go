@@ -0,0 +1,116 @@
+package batchapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// Job is a prompt submitted to batch APIs of several providers
+type Job struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Prompt  string    `json:"prompt"`
+	Batches []Batch   `json:"batches"`
+}
+
+// Batch is the batch of the job submitted to a provider, results are set once the batch is done
+type Batch struct {
+	Provider string   `json:"provider"`
+	Model    string   `json:"model"`
+	BatchID  string   `json:"batch_id"`
+	State    State    `json:"state"`
+	Message  string   `json:"message,omitempty"` // reason of the failed batch
+	Results  []Result `json:"results,omitempty"`
+}
+
+// Done checks if batches of all providers are done
+func (j Job) Done() bool {
+	for _, b := range j.Batches {
+		if b.State == StateInProgress {
+			return false
+		}
+	}
+	return true
+}
+
+// NewJobID returns a new random job ID, prefixed by the current time to sort jobs by creation
+func NewJobID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// jobIDRe matches valid job IDs, so IDs given by users can't point outside of the store directory
+var jobIDRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// Store keeps jobs as JSON files in a directory, a file per job
+type Store struct {
+	dir string
+}
+
+// NewStore makes a Store in the directory, created on the first save
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Save writes the job to its file. The job is written to a temporary file first and renamed, so a
+// concurrent run never sees a partially written job.
+func (s *Store) Save(job Job) error {
+	if !jobIDRe.MatchString(job.ID) {
+		return fmt.Errorf("invalid batch job id %q", job.ID)
+	}
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode batch job: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create batch job directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.dir, job.ID+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create batch job file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after successful rename
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write batch job: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write batch job: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(job.ID)); err != nil {
+		return fmt.Errorf("failed to write batch job: %w", err)
+	}
+	return nil
+}
+
+// Load reads the job with the given ID
+func (s *Store) Load(id string) (Job, error) {
+	if !jobIDRe.MatchString(id) {
+		return Job{}, fmt.Errorf("invalid batch job id %q", id)
+	}
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Job{}, fmt.Errorf("batch job %s not found in %s", id, s.dir)
+	}
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to read batch job: %w", err)
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return Job{}, fmt.Errorf("failed to parse batch job %s: %w", id, err)
+	}
+	return job, nil
+}
+
+// path returns the file of the job
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
@@ -0,0 +1,46 @@
+package batchapi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "batch")
+	s := NewStore(dir)
+	job := Job{ID: NewJobID(), Created: time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC), Prompt: "hello",
+		Batches: []Batch{{Provider: "OpenAI", Model: "gpt-5", BatchID: "batch-1", State: StateInProgress}}}
+	assert.Regexp(t, `^\d{8}-\d{6}-[0-9a-f]{8}$`, job.ID)
+	assert.False(t, job.Done())
+
+	require.NoError(t, s.Save(job))
+	fi, err := os.Stat(filepath.Join(dir, job.ID+".json"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	loaded, err := s.Load(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, job, loaded)
+
+	job.Batches[0].State, job.Batches[0].Results = StateEnded, []Result{{ID: "r1", Text: "answer"}}
+	require.NoError(t, s.Save(job))
+	loaded, err = s.Load(job.ID)
+	require.NoError(t, err)
+	assert.True(t, loaded.Done())
+	assert.Equal(t, []Result{{ID: "r1", Text: "answer"}}, loaded.Batches[0].Results)
+
+	_, err = s.Load("20260101-000000-00000000")
+	require.ErrorContains(t, err, "batch job 20260101-000000-00000000 not found")
+	_, err = s.Load("../secret")
+	require.EqualError(t, err, `invalid batch job id "../secret"`)
+	require.EqualError(t, s.Save(Job{ID: "a/b"}), `invalid batch job id "a/b"`)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o600))
+	_, err = s.Load("broken")
+	require.ErrorContains(t, err, "failed to parse batch job broken")
+}
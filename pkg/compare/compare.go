@@ -0,0 +1,255 @@
+// Package compare runs variants of a prompt across all providers and collects a matrix of answers, variant by
+// provider, optionally scored by a judge provider, for A/B testing of prompt phrasings.
+package compare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/umputun/mpt/pkg/provider"
+	"github.com/umputun/mpt/pkg/runner"
+)
+
+//go:generate moq -out mocks/provider.go -pkg mocks -skip-ensure -fmt goimports ../provider Provider
+
+// maxScore is the best score of an answer given by the judge, the worst one is 1
+const maxScore = 10
+
+// Variant is a phrasing of the prompt
+type Variant struct {
+	Name   string `yaml:"name"`
+	Prompt string `yaml:"prompt"`
+}
+
+// Spec is the content of a prompt variants file
+type Spec struct {
+	Criteria string    `yaml:"criteria"` // what the judge should look for in answers, optional
+	Variants []Variant `yaml:"variants"`
+}
+
+// Load reads prompt variants from the YAML file. Names of variants should be unique.
+func Load(path string) (Spec, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // variants file is set by the user
+	if err != nil {
+		return Spec{}, fmt.Errorf("failed to read prompt variants file: %w", err)
+	}
+	var spec Spec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return Spec{}, fmt.Errorf("invalid prompt variants file %s: %w", path, err)
+	}
+	if err := spec.validate(); err != nil {
+		return Spec{}, fmt.Errorf("invalid prompt variants file %s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// validate checks variants have unique names and non-empty prompts
+func (s Spec) validate() error {
+	if len(s.Variants) == 0 {
+		return errors.New("no variants defined")
+	}
+	names := map[string]bool{}
+	for i, v := range s.Variants {
+		switch {
+		case strings.TrimSpace(v.Name) == "":
+			return fmt.Errorf("variant #%d has no name", i+1)
+		case strings.TrimSpace(v.Prompt) == "":
+			return fmt.Errorf("variant %q has no prompt", v.Name)
+		case names[v.Name]:
+			return fmt.Errorf("duplicate variant %q", v.Name)
+		}
+		names[v.Name] = true
+	}
+	return nil
+}
+
+// Row is the answers of all providers to a variant
+type Row struct {
+	Variant Variant
+	Results []provider.Result
+	Scores  map[string]float64 // judge's scores keyed by provider name, nil if not judged
+}
+
+// Matrix is the answers of providers to prompt variants
+type Matrix struct {
+	Providers []string // names of providers in the order of the first answers
+	Rows      []Row
+}
+
+// BuildFunc makes the complete prompt sent to providers from the variant, e.g. with file contents added
+type BuildFunc func(ctx context.Context, v Variant) (string, error)
+
+// Run sends each variant, made complete by build, to all providers of the runner, one variant at a time.
+// Variants failed by all providers are kept in the matrix with errors of providers. It returns an error
+// only if a prompt can't be built or the context is done.
+func Run(ctx context.Context, r *runner.Runner, variants []Variant, build BuildFunc) (*Matrix, error) {
+	m := &Matrix{}
+	seen := map[string]bool{}
+	for _, v := range variants {
+		prompt, err := build(ctx, v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build prompt of variant %q: %w", v.Name, err)
+		}
+		res, err := r.Execute(ctx, prompt)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if len(res.Results) == 0 && err != nil {
+			return nil, fmt.Errorf("failed to run variant %q: %w", v.Name, err)
+		}
+		for _, res := range res.Results {
+			if !seen[res.Provider] {
+				seen[res.Provider] = true
+				m.Providers = append(m.Providers, res.Provider)
+			}
+		}
+		m.Rows = append(m.Rows, Row{Variant: v, Results: res.Results})
+	}
+	return m, nil
+}
+
+// scoreRe matches the "<answer number>: <score>" line of the judge's response
+var scoreRe = regexp.MustCompile(`(?mi)^\W*(?:answer\s*)?(\d+)\W*[:=-]\s*(\d+(?:\.\d+)?)`)
+
+// Judge asks the judge provider to score each successful answer from 1 to 10 and sets scores of the rows.
+// Answers are shown to the judge anonymized, with the variant prompt they were given for, so neither the
+// provider nor the variant name can bias the scores. Answers the judge didn't score are left without a score.
+func Judge(ctx context.Context, judge provider.Provider, criteria string, m *Matrix) error {
+	type ref struct{ row, res int }
+	var refs []ref
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Score each of the following AI answers from 1 (useless) to %d (excellent) ", maxScore))
+	sb.WriteString("by how well it fulfils the prompt it was given for.")
+	if criteria = strings.TrimSpace(criteria); criteria != "" {
+		sb.WriteString(" Criteria: " + criteria)
+	}
+	sb.WriteString("\nIMPORTANT: Answer with one line per answer in the format \"<answer number>: <score>\" and nothing else.\n\n")
+	for i, row := range m.Rows {
+		for j, res := range row.Results {
+			if res.Error != nil {
+				continue
+			}
+			refs = append(refs, ref{row: i, res: j})
+			sb.WriteString(fmt.Sprintf("--- answer %d ---\nPrompt:\n%s\n\nAnswer:\n%s\n\n", len(refs),
+				strings.TrimSpace(row.Variant.Prompt), strings.TrimSpace(res.Text)))
+		}
+	}
+	if len(refs) == 0 {
+		return errors.New("no successful answers to judge")
+	}
+
+	resp, err := judge.Generate(ctx, sb.String())
+	if err != nil {
+		return fmt.Errorf("judge %s failed: %w", judge.Name(), err)
+	}
+
+	scored := 0
+	for _, match := range scoreRe.FindAllStringSubmatch(resp, -1) {
+		n, err := strconv.Atoi(match[1])
+		if err != nil || n < 1 || n > len(refs) {
+			continue
+		}
+		score, err := strconv.ParseFloat(match[2], 64)
+		if err != nil || score < 1 || score > maxScore {
+			continue
+		}
+		r := refs[n-1]
+		row := &m.Rows[r.row]
+		if row.Scores == nil {
+			row.Scores = map[string]float64{}
+		}
+		row.Scores[row.Results[r.res].Provider] = score
+		scored++
+	}
+	if scored == 0 {
+		return fmt.Errorf("no scores in the response of judge %s", judge.Name())
+	}
+	return nil
+}
+
+// Judged checks if any answer of the matrix is scored
+func (m *Matrix) Judged() bool {
+	for _, row := range m.Rows {
+		if len(row.Scores) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Format returns answers of each variant with provider headers, followed by the summary table
+func (m *Matrix) Format() string {
+	var sb strings.Builder
+	for _, row := range m.Rows {
+		sb.WriteString(fmt.Sprintf("==== variant %s ====\n", row.Variant.Name))
+		for _, res := range row.Results {
+			sb.WriteString(res.Format())
+			sb.WriteString("\n")
+		}
+	}
+	sb.WriteString(m.Table())
+	return sb.String()
+}
+
+// Table returns the summary table with a row per variant and a column per provider. Cells have scores of
+// judged answers, "ok" for unscored answers and "failed" for errors. The average score of the variant is
+// added if answers are judged.
+func (m *Matrix) Table() string {
+	judged := m.Judged()
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	header := append([]string{"variant"}, m.Providers...)
+	if judged {
+		header = append(header, "avg")
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range m.Rows {
+		cells := []string{row.Variant.Name}
+		for _, name := range m.Providers {
+			cells = append(cells, row.cell(name))
+		}
+		if judged {
+			cells = append(cells, row.average())
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	_ = w.Flush()
+	return sb.String()
+}
+
+// cell returns the summary of the provider's answer to the variant
+func (r Row) cell(name string) string {
+	for _, res := range r.Results {
+		if res.Provider != name {
+			continue
+		}
+		if res.Error != nil {
+			return "failed"
+		}
+		if score, ok := r.Scores[name]; ok {
+			return strconv.FormatFloat(score, 'f', -1, 64)
+		}
+		return "ok"
+	}
+	return "-"
+}
+
+// average returns the average score of scored answers to the variant, "-" if none is scored
+func (r Row) average() string {
+	if len(r.Scores) == 0 {
+		return "-"
+	}
+	total := 0.0
+	for _, s := range r.Scores {
+		total += s
+	}
+	return strconv.FormatFloat(total/float64(len(r.Scores)), 'f', 1, 64)
+}
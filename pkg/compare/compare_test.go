@@ -0,0 +1,158 @@
+package compare
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/compare/mocks"
+	"github.com/umputun/mpt/pkg/provider"
+	"github.com/umputun/mpt/pkg/runner"
+)
+
+func TestLoad(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "variants.yml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		path := write(t, "criteria: correctness\nvariants:\n  - name: terse\n    prompt: explain briefly\n"+
+			"  - name: detailed\n    prompt: explain step by step\n")
+		spec, err := Load(path)
+		require.NoError(t, err)
+		assert.Equal(t, Spec{Criteria: "correctness", Variants: []Variant{
+			{Name: "terse", Prompt: "explain briefly"}, {Name: "detailed", Prompt: "explain step by step"}}}, spec)
+	})
+
+	tests := []struct {
+		name, content, err string
+	}{
+		{"no variants", "criteria: x\n", "no variants defined"},
+		{"no name", "variants:\n  - prompt: x\n", "variant #1 has no name"},
+		{"no prompt", "variants:\n  - name: a\n", `variant "a" has no prompt`},
+		{"duplicate", "variants:\n  - {name: a, prompt: x}\n  - {name: a, prompt: y}\n", `duplicate variant "a"`},
+		{"invalid yaml", "variants: [", "invalid prompt variants file"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load(write(t, tc.content))
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+
+	_, err := Load(filepath.Join(t.TempDir(), "missing.yml"))
+	require.ErrorContains(t, err, "failed to read prompt variants file")
+}
+
+func TestRun(t *testing.T) {
+	newMock := func(name string, fail bool) *mocks.ProviderMock {
+		return &mocks.ProviderMock{
+			NameFunc:    func() string { return name },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(_ context.Context, prompt string) (string, error) {
+				if fail {
+					return "", errors.New("api error")
+				}
+				return name + " answers " + prompt, nil
+			},
+		}
+	}
+	r := runner.New(newMock("OpenAI", false), newMock("Google", true))
+	variants := []Variant{{Name: "terse", Prompt: "be brief"}, {Name: "detailed", Prompt: "be detailed"}}
+	m, err := Run(context.Background(), r, variants, func(_ context.Context, v Variant) (string, error) {
+		return v.Prompt + " about go", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"OpenAI", "Google"}, m.Providers)
+	require.Len(t, m.Rows, 2)
+	assert.Equal(t, "terse", m.Rows[0].Variant.Name)
+	assert.Equal(t, "OpenAI answers be brief about go", m.Rows[0].Results[0].Text)
+	require.Error(t, m.Rows[0].Results[1].Error)
+	assert.Equal(t, "OpenAI answers be detailed about go", m.Rows[1].Results[0].Text)
+	assert.False(t, m.Judged())
+	assert.Equal(t, "variant   OpenAI  Google\nterse     ok      failed\ndetailed  ok      failed\n", m.Table())
+
+	t.Run("failed by all providers", func(t *testing.T) {
+		m, err := Run(context.Background(), runner.New(newMock("Google", true)), variants[:1],
+			func(_ context.Context, v Variant) (string, error) { return v.Prompt, nil })
+		require.NoError(t, err)
+		require.Len(t, m.Rows, 1)
+		require.Error(t, m.Rows[0].Results[0].Error)
+	})
+
+	t.Run("build failed", func(t *testing.T) {
+		_, err := Run(context.Background(), r, variants, func(context.Context, Variant) (string, error) {
+			return "", errors.New("no files")
+		})
+		require.EqualError(t, err, `failed to build prompt of variant "terse": no files`)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := Run(ctx, r, variants, func(_ context.Context, v Variant) (string, error) { return v.Prompt, nil })
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestJudge(t *testing.T) {
+	newMatrix := func() *Matrix {
+		return &Matrix{Providers: []string{"OpenAI", "Google"}, Rows: []Row{
+			{Variant: Variant{Name: "terse", Prompt: "be brief"}, Results: []provider.Result{
+				{Provider: "OpenAI", Text: "short"}, {Provider: "Google", Error: errors.New("api error")}}},
+			{Variant: Variant{Name: "detailed", Prompt: "be detailed"}, Results: []provider.Result{
+				{Provider: "OpenAI", Text: "long"}, {Provider: "Google", Text: "longer"}}},
+		}}
+	}
+
+	var judgePrompt string
+	judge := &mocks.ProviderMock{
+		NameFunc: func() string { return "Anthropic" },
+		GenerateFunc: func(_ context.Context, prompt string) (string, error) {
+			judgePrompt = prompt
+			return "1: 6\nAnswer 2: 8.5\n- 3: 9\n4: 42", nil
+		},
+	}
+	m := newMatrix()
+	require.NoError(t, Judge(context.Background(), judge, "accuracy", m))
+	assert.Contains(t, judgePrompt, "Criteria: accuracy")
+	assert.Contains(t, judgePrompt, "--- answer 1 ---\nPrompt:\nbe brief\n\nAnswer:\nshort\n\n")
+	assert.Contains(t, judgePrompt, "--- answer 3 ---\nPrompt:\nbe detailed\n\nAnswer:\nlonger\n\n")
+	assert.NotContains(t, judgePrompt, "OpenAI", "providers are anonymized")
+	assert.NotContains(t, judgePrompt, "terse", "variants are anonymized")
+
+	assert.Equal(t, map[string]float64{"OpenAI": 6}, m.Rows[0].Scores)
+	assert.Equal(t, map[string]float64{"OpenAI": 8.5, "Google": 9}, m.Rows[1].Scores)
+	assert.True(t, m.Judged())
+	assert.Equal(t, "variant   OpenAI  Google  avg\nterse     6       failed  6.0\ndetailed  8.5     9       8.8\n", m.Table())
+
+	formatted := m.Format()
+	assert.True(t, strings.HasPrefix(formatted, "==== variant terse ====\n== generated by OpenAI ==\nshort\n\n"), formatted)
+	assert.Contains(t, formatted, "==== variant detailed ====\n")
+
+	t.Run("no scores", func(t *testing.T) {
+		judge.GenerateFunc = func(context.Context, string) (string, error) { return "all answers are good", nil }
+		err := Judge(context.Background(), judge, "", newMatrix())
+		require.EqualError(t, err, "no scores in the response of judge Anthropic")
+	})
+
+	t.Run("judge failed", func(t *testing.T) {
+		judge.GenerateFunc = func(context.Context, string) (string, error) { return "", errors.New("overloaded") }
+		err := Judge(context.Background(), judge, "", newMatrix())
+		require.EqualError(t, err, "judge Anthropic failed: overloaded")
+	})
+
+	t.Run("nothing to judge", func(t *testing.T) {
+		m := &Matrix{Rows: []Row{{Results: []provider.Result{{Provider: "OpenAI", Error: errors.New("failed")}}}}}
+		require.EqualError(t, Judge(context.Background(), judge, "", m), "no successful answers to judge")
+	})
+}
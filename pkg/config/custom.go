@@ -1,16 +1,20 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-pkgz/lgr"
 
 	"github.com/umputun/mpt/pkg/provider"
+	"github.com/umputun/mpt/pkg/provider/alias"
 )
 
 const defaultCustomMaxTokens = 16384
@@ -25,12 +29,26 @@ type CustomSpec struct {
 	Temperature  float32
 	EndpointType string
 	Enabled      bool
+	Timeouts     provider.Timeouts // per-provider timeouts, zero values fall back to manager defaults
+	Dimensions   int               // dimensions of embedding vectors for embeddings endpoint, 0 for model default
+	BatchSize    int               // max texts per embeddings request, 0 for default
+	Discover     bool              // discover served models with GET /models, to validate the model
+	Required     bool              // the run fails if the provider fails, failures of optional providers are only logged
+	Parallel     int               // max in-flight requests to the provider, 0 for unlimited
+	Instructions string            // instructions put before every prompt sent to the provider
 }
 
 // CustomProviderManager manages custom provider configuration and initialization
 type CustomProviderManager struct {
 	cliCustoms   map[string]CustomSpec
 	legacyCustom *CustomSpec
+	timeouts     provider.Timeouts                 // default timeouts for providers without their own
+	aliases      *alias.Resolver                   // model aliases, optional
+	maxTokens    int                               // max output tokens overriding per-provider max tokens, 0 to keep them
+	stop         []string                          // stop sequences applied to all providers
+	temperature  *float32                          // temperature overriding per-provider temperature, nil to keep them
+	models       *provider.ModelCache              // cache of models discovered for providers with discovery, optional
+	autoTimeout  func(maxTokens int) time.Duration // generation timeout of providers without their own, optional
 }
 
 // NewCustomProviderManager creates a new custom provider manager
@@ -41,6 +59,43 @@ func NewCustomProviderManager(cliCustoms map[string]CustomSpec, legacyCustom *Cu
 	}
 }
 
+// WithTimeouts sets default timeouts used by custom providers without their own timeouts
+func (m *CustomProviderManager) WithTimeouts(timeouts provider.Timeouts) *CustomProviderManager {
+	m.timeouts = timeouts
+	return m
+}
+
+// WithAliases sets model aliases resolved by provider name for custom providers
+func (m *CustomProviderManager) WithAliases(aliases *alias.Resolver) *CustomProviderManager {
+	m.aliases = aliases
+	return m
+}
+
+// WithOutputLimits sets max output tokens overriding per-provider max tokens if positive, and stop sequences
+func (m *CustomProviderManager) WithOutputLimits(maxTokens int, stop []string) *CustomProviderManager {
+	m.maxTokens, m.stop = maxTokens, stop
+	return m
+}
+
+// WithTemperature sets temperature overriding per-provider temperature if not nil
+func (m *CustomProviderManager) WithTemperature(temperature *float32) *CustomProviderManager {
+	m.temperature = temperature
+	return m
+}
+
+// WithAutoTimeout sets the function returning the generation timeout by max output tokens, used for providers
+// without their own generation timeout instead of the default one
+func (m *CustomProviderManager) WithAutoTimeout(fn func(maxTokens int) time.Duration) *CustomProviderManager {
+	m.autoTimeout = fn
+	return m
+}
+
+// WithModelCache sets the cache of models discovered for providers with discovery enabled
+func (m *CustomProviderManager) WithModelCache(models *provider.ModelCache) *CustomProviderManager {
+	m.models = models
+	return m
+}
+
 // InitializeProviders initializes all custom providers with proper precedence.
 // It merges provider configurations from three sources (in order of precedence):
 //  1. Environment variables (CUSTOM_<ID>_<FIELD>) - lowest precedence
@@ -75,6 +130,10 @@ func (m *CustomProviderManager) InitializeProviders() (providers []provider.Prov
 			lgr.Printf("[DEBUG] skipping disabled custom provider: %s", id)
 			continue
 		}
+		if spec.isEmbeddings() {
+			lgr.Printf("[DEBUG] skipping custom provider %s serving embeddings, not used for generation", id)
+			continue
+		}
 
 		// validate required fields and always log errors
 		if spec.URL == "" {
@@ -94,20 +153,14 @@ func (m *CustomProviderManager) InitializeProviders() (providers []provider.Prov
 		if spec.Name == "" {
 			spec.Name = id
 		}
+		spec.Model = m.aliases.Resolve(spec.Name, spec.Model)
+		if err := m.checkModel(id, spec); err != nil {
+			errors = append(errors, err.Error())
+			lgr.Printf("[WARN] %v", err)
+			continue
+		}
 
-		// create provider
-		p := provider.NewCustomOpenAI(provider.CustomOptions{
-			Name:         spec.Name,
-			BaseURL:      spec.URL,
-			APIKey:       spec.APIKey,
-			Model:        spec.Model,
-			Enabled:      true,
-			MaxTokens:    spec.MaxTokens,
-			Temperature:  spec.Temperature,
-			EndpointType: provider.EndpointType(spec.EndpointType),
-		})
-
-		providers = append(providers, p)
+		providers = append(providers, m.newCustomProvider(spec))
 
 		// log with proper temperature display
 		tempDisplay := fmt.Sprintf("%.2f", spec.Temperature)
@@ -121,6 +174,231 @@ func (m *CustomProviderManager) InitializeProviders() (providers []provider.Prov
 	return providers, errors
 }
 
+// CreateProvider creates an enabled custom provider by its name (case-insensitive) with the given model.
+// Empty model keeps the model from the provider configuration.
+func (m *CustomProviderManager) CreateProvider(name, model string) (provider.Provider, error) {
+	customs, _ := m.buildEffectiveCustomsMap()
+	for id, spec := range customs {
+		if spec.Name == "" {
+			spec.Name = id
+		}
+		if !spec.Enabled || spec.isEmbeddings() || !strings.EqualFold(spec.Name, name) {
+			continue
+		}
+		if spec.URL == "" {
+			return nil, fmt.Errorf("custom[%s]: missing URL", id)
+		}
+		if model != "" {
+			spec.Model = model
+		}
+		if spec.Model == "" {
+			return nil, fmt.Errorf("custom[%s]: missing model", id)
+		}
+		spec.Model = m.aliases.Resolve(spec.Name, spec.Model)
+		return m.newCustomProvider(spec), nil
+	}
+	return nil, fmt.Errorf("custom provider %q not found", name)
+}
+
+// Models returns models of enabled custom providers used for generation, keyed by provider name
+func (m *CustomProviderManager) Models() map[string]string {
+	customs, _ := m.buildEffectiveCustomsMap()
+	res := make(map[string]string, len(customs))
+	for id, spec := range customs {
+		if !spec.Enabled || spec.isEmbeddings() || spec.Model == "" {
+			continue
+		}
+		if spec.Name == "" {
+			spec.Name = id
+		}
+		res[spec.Name] = m.aliases.Resolve(spec.Name, spec.Model)
+	}
+	return res
+}
+
+// Required returns names of enabled custom providers used for generation and marked as required, sorted
+func (m *CustomProviderManager) Required() []string {
+	customs, _ := m.buildEffectiveCustomsMap()
+	res := []string{}
+	for id, spec := range customs {
+		if !spec.Enabled || !spec.Required || spec.isEmbeddings() {
+			continue
+		}
+		if spec.Name == "" {
+			spec.Name = id
+		}
+		res = append(res, spec.Name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Parallel returns limits of in-flight requests of enabled custom providers used for generation, keyed
+// by provider names. Providers without the limit are not included.
+func (m *CustomProviderManager) Parallel() map[string]int {
+	customs, _ := m.buildEffectiveCustomsMap()
+	res := map[string]int{}
+	for id, spec := range customs {
+		if !spec.Enabled || spec.Parallel <= 0 || spec.isEmbeddings() {
+			continue
+		}
+		if spec.Name == "" {
+			spec.Name = id
+		}
+		res[spec.Name] = spec.Parallel
+	}
+	return res
+}
+
+// Instructions returns instructions of enabled custom providers used for generation, keyed by lowercase
+// provider names. Providers without instructions are not included.
+func (m *CustomProviderManager) Instructions() map[string]string {
+	customs, _ := m.buildEffectiveCustomsMap()
+	res := map[string]string{}
+	for id, spec := range customs {
+		if !spec.Enabled || strings.TrimSpace(spec.Instructions) == "" || spec.isEmbeddings() {
+			continue
+		}
+		if spec.Name == "" {
+			spec.Name = id
+		}
+		res[strings.ToLower(spec.Name)] = spec.Instructions
+	}
+	return res
+}
+
+// Specs returns effective specs of enabled custom providers in order of provider IDs, including the ones
+// serving embeddings. Names, models, max tokens, temperature and timeouts are resolved the same way as
+// for created providers.
+func (m *CustomProviderManager) Specs() []CustomSpec {
+	customs, _ := m.buildEffectiveCustomsMap()
+	ids := make([]string, 0, len(customs))
+	for id := range customs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	res := make([]CustomSpec, 0, len(ids))
+	for _, id := range ids {
+		spec := customs[id]
+		if !spec.Enabled {
+			continue
+		}
+		if spec.Name == "" {
+			spec.Name = id
+		}
+		spec.Model = m.aliases.Resolve(spec.Name, spec.Model)
+		if m.maxTokens > 0 {
+			spec.MaxTokens = m.maxTokens
+		}
+		if m.temperature != nil {
+			spec.Temperature = *m.temperature
+		}
+		spec.Timeouts = m.specTimeouts(spec)
+		res = append(res, spec)
+	}
+	return res
+}
+
+// DiscoveredModels returns models discovered for the enabled custom provider with the ID, nil if the provider
+// doesn't have discovery enabled or its models can't be discovered
+func (m *CustomProviderManager) DiscoveredModels(ctx context.Context, id string) []string {
+	if m.models == nil {
+		return nil
+	}
+	customs, _ := m.buildEffectiveCustomsMap()
+	spec, ok := customs[normalizeProviderID(id)]
+	if !ok || !spec.Enabled || !spec.Discover || spec.URL == "" {
+		return nil
+	}
+	models, err := m.models.Models(ctx, spec.URL, spec.APIKey)
+	if err != nil {
+		lgr.Printf("[DEBUG] custom[%s]: %v", id, err)
+		return nil
+	}
+	return models
+}
+
+// checkModel checks the model of the provider with discovery enabled is served by the provider. Models
+// which can't be discovered are not checked, the provider reports the error of the request with them.
+func (m *CustomProviderManager) checkModel(id string, spec CustomSpec) error {
+	if m.models == nil || !spec.Discover {
+		return nil
+	}
+	models, err := m.models.Models(context.Background(), spec.URL, spec.APIKey)
+	if err != nil {
+		lgr.Printf("[WARN] custom[%s]: model %s not checked, %v", id, spec.Model, err)
+		return nil
+	}
+	if !slices.Contains(models, spec.Model) {
+		return fmt.Errorf("custom[%s]: model %s is not served by %s, available: %s", id, spec.Model, spec.URL,
+			strings.Join(models, ", "))
+	}
+	return nil
+}
+
+// Embedder returns the first enabled custom provider with embeddings endpoint type, in order of provider IDs.
+// It returns nil if there is no such provider.
+func (m *CustomProviderManager) Embedder() provider.Embedder {
+	customs, _ := m.buildEffectiveCustomsMap()
+	ids := make([]string, 0, len(customs))
+	for id := range customs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		spec := customs[id]
+		if !spec.Enabled || !spec.isEmbeddings() {
+			continue
+		}
+		if spec.URL == "" || spec.Model == "" {
+			lgr.Printf("[WARN] custom[%s]: embeddings provider requires URL and model", id)
+			continue
+		}
+		if spec.Name == "" {
+			spec.Name = id
+		}
+		spec.Model = m.aliases.Resolve(spec.Name, spec.Model)
+		return m.newCustomProvider(spec)
+	}
+	return nil
+}
+
+// newCustomProvider creates a custom OpenAI-compatible provider from the spec
+func (m *CustomProviderManager) newCustomProvider(spec CustomSpec) *provider.CustomOpenAI {
+	if m.maxTokens > 0 {
+		spec.MaxTokens = m.maxTokens
+	}
+	if m.temperature != nil {
+		spec.Temperature = *m.temperature
+	}
+	return provider.NewCustomOpenAI(provider.CustomOptions{
+		Name:                spec.Name,
+		BaseURL:             spec.URL,
+		APIKey:              spec.APIKey,
+		Model:               spec.Model,
+		Enabled:             true,
+		MaxTokens:           spec.MaxTokens,
+		Stop:                m.stop,
+		Temperature:         spec.Temperature,
+		EndpointType:        provider.EndpointType(spec.EndpointType),
+		Timeouts:            m.specTimeouts(spec),
+		EmbeddingDimensions: spec.Dimensions,
+		EmbeddingBatchSize:  spec.BatchSize,
+	})
+}
+
+// specTimeouts returns timeouts of the provider with unset values taken from defaults, and the generation
+// timeout set by the auto timeout function if it is not set for the provider
+func (m *CustomProviderManager) specTimeouts(spec CustomSpec) provider.Timeouts {
+	res := spec.Timeouts
+	if res.Generation <= 0 && m.autoTimeout != nil {
+		res.Generation = m.autoTimeout(spec.MaxTokens)
+	}
+	return res.WithDefaults(m.timeouts)
+}
+
 // CollectSecrets collects all unique API keys from custom provider sources
 func (m *CustomProviderManager) CollectSecrets() []string {
 	secretsMap := make(map[string]bool) // use map to avoid duplicates
@@ -149,9 +427,9 @@ func (m *CustomProviderManager) AnyEnabled() bool {
 	// build the effective customs map with all precedence rules applied
 	customs, _ := m.buildEffectiveCustomsMap()
 
-	// check if any provider is actually enabled
+	// check if any provider is actually enabled, embeddings providers don't generate text and don't count
 	for _, spec := range customs {
-		if spec.Enabled {
+		if spec.Enabled && !spec.isEmbeddings() {
 			return true
 		}
 	}
@@ -207,13 +485,15 @@ func (m *CustomProviderManager) parseCustomProvidersFromEnv() (providers map[str
 
 	// legacy single custom env vars to skip
 	legacyVars := map[string]bool{
-		"CUSTOM_URL":         true,
-		"CUSTOM_API_KEY":     true,
-		"CUSTOM_MODEL":       true,
-		"CUSTOM_MAX_TOKENS":  true,
-		"CUSTOM_TEMPERATURE": true,
-		"CUSTOM_ENABLED":     true,
-		"CUSTOM_NAME":        true,
+		"CUSTOM_URL":                true,
+		"CUSTOM_API_KEY":            true,
+		"CUSTOM_MODEL":              true,
+		"CUSTOM_MAX_TOKENS":         true,
+		"CUSTOM_TEMPERATURE":        true,
+		"CUSTOM_ENABLED":            true,
+		"CUSTOM_NAME":               true,
+		"CUSTOM_TIMEOUT_CONNECT":    true,
+		"CUSTOM_TIMEOUT_GENERATION": true,
 	}
 
 	// collect all CUSTOM_* environment variables
@@ -236,8 +516,16 @@ func (m *CustomProviderManager) parseCustomProvidersFromEnv() (providers map[str
 
 		// known field suffixes (all use underscores to match env var convention)
 		knownFields := []string{
+			"_timeout_generation",
+			"_timeout_connect",
+			"_instructions",
 			"_endpoint_type",
+			"_batch_size",
+			"_dimensions",
 			"_max_tokens",
+			"_discover",
+			"_required",
+			"_parallel",
 			"_api_key",
 			"_temperature",
 			"_enabled",
@@ -269,7 +557,7 @@ func (m *CustomProviderManager) parseCustomProvidersFromEnv() (providers map[str
 		}
 
 		if !found {
-			warnings = append(warnings, fmt.Sprintf("skipping env var %s: unrecognized field name (valid fields: url, api_key, model, name, max_tokens, temperature, endpoint_type, enabled)", key))
+			warnings = append(warnings, fmt.Sprintf("skipping env var %s: unrecognized field name (valid fields: url, api_key, model, name, max_tokens, temperature, endpoint_type, enabled, timeout_connect, timeout_generation, dimensions, batch_size, discover, required, parallel, instructions)", key))
 			continue
 		}
 
@@ -357,11 +645,11 @@ func applyEnvField(spec *CustomSpec, id, field, value string) []string {
 	case "endpoint_type":
 		// validate endpoint type
 		valueLower := strings.ToLower(value)
-		if valueLower == "auto" || valueLower == "responses" || valueLower == "chat_completions" {
+		if validEndpointType(valueLower) {
 			spec.EndpointType = valueLower
 		} else {
 			warnings = append(warnings,
-				fmt.Sprintf("custom[%s]: invalid endpoint_type '%s' (valid: auto, responses, chat_completions)", id, value))
+				fmt.Sprintf("custom[%s]: invalid endpoint_type '%s' (valid: auto, responses, chat_completions, embeddings)", id, value))
 		}
 
 	case "enabled":
@@ -371,13 +659,60 @@ func applyEnvField(spec *CustomSpec, id, field, value string) []string {
 			warnings = append(warnings,
 				fmt.Sprintf("custom[%s]: invalid enabled value '%s': %v", id, value, err))
 		}
+
+	case "timeout_connect", "timeout_generation":
+		d, err := parseTimeout(value)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("custom[%s]: invalid %s '%s': %v", id, field, value, err))
+			break
+		}
+		if field == "timeout_connect" {
+			spec.Timeouts.Connect = d
+		} else {
+			spec.Timeouts.Generation = d
+		}
+
+	case "instructions":
+		spec.Instructions = value
+
+	case "discover":
+		if discover, err := strconv.ParseBool(value); err == nil {
+			spec.Discover = discover
+		} else {
+			warnings = append(warnings,
+				fmt.Sprintf("custom[%s]: invalid discover value '%s': %v", id, value, err))
+		}
+
+	case "required":
+		if required, err := strconv.ParseBool(value); err == nil {
+			spec.Required = required
+		} else {
+			warnings = append(warnings,
+				fmt.Sprintf("custom[%s]: invalid required value '%s': %v", id, value, err))
+		}
+
+	case "dimensions", "batch_size", "parallel":
+		n, err := parsePositive(value)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("custom[%s]: invalid %s '%s': %v", id, field, value, err))
+			break
+		}
+		switch field {
+		case "dimensions":
+			spec.Dimensions = n
+		case "batch_size":
+			spec.BatchSize = n
+		default:
+			spec.Parallel = n
+		}
 	}
 
 	return warnings
 }
 
 // ParseCustomSpec parses "url=https://...,model=xxx,api-key=xxx" format string into CustomSpec.
-// This is used for parsing CLI flag values.
+// This is used for parsing CLI flag values. The instructions key must be the last one, its value is the rest
+// of the string, so instructions can contain commas.
 func ParseCustomSpec(value string) (CustomSpec, error) {
 	spec := CustomSpec{
 		// set defaults (-1 means unset for temperature to allow explicit 0)
@@ -387,6 +722,15 @@ func ParseCustomSpec(value string) (CustomSpec, error) {
 		Enabled:      false,              // disabled by default, matches standard providers
 	}
 
+	// instructions take the rest of the spec
+	if i := instructionsIndex(value); i >= 0 {
+		spec.Instructions = strings.TrimSpace(value[i+len("instructions="):])
+		value = strings.TrimSuffix(strings.TrimSpace(value[:i]), ",")
+		if strings.TrimSpace(value) == "" {
+			return spec, nil
+		}
+	}
+
 	// parse comma-separated key=value pairs
 	pairs := strings.Split(value, ",")
 	for _, pair := range pairs {
@@ -435,8 +779,8 @@ func ParseCustomSpec(value string) (CustomSpec, error) {
 		case "endpoint-type":
 			// validate endpoint type
 			valLower := strings.ToLower(val)
-			if valLower != "auto" && valLower != "responses" && valLower != "chat_completions" {
-				return spec, fmt.Errorf("invalid endpoint-type '%s' (valid: auto, responses, chat_completions)", val)
+			if !validEndpointType(valLower) {
+				return spec, fmt.Errorf("invalid endpoint-type '%s' (valid: auto, responses, chat_completions, embeddings)", val)
 			}
 			spec.EndpointType = valLower
 
@@ -447,6 +791,55 @@ func ParseCustomSpec(value string) (CustomSpec, error) {
 			}
 			spec.Enabled = enabled
 
+		case "discover":
+			discover, err := strconv.ParseBool(val)
+			if err != nil {
+				return spec, fmt.Errorf("invalid discover value '%s': %w", val, err)
+			}
+			spec.Discover = discover
+
+		case "required":
+			required, err := strconv.ParseBool(val)
+			if err != nil {
+				return spec, fmt.Errorf("invalid required value '%s': %w", val, err)
+			}
+			spec.Required = required
+
+		case "timeout-connect":
+			d, err := parseTimeout(val)
+			if err != nil {
+				return spec, fmt.Errorf("invalid timeout-connect '%s': %w", val, err)
+			}
+			spec.Timeouts.Connect = d
+
+		case "timeout-generation":
+			d, err := parseTimeout(val)
+			if err != nil {
+				return spec, fmt.Errorf("invalid timeout-generation '%s': %w", val, err)
+			}
+			spec.Timeouts.Generation = d
+
+		case "dimensions":
+			n, err := parsePositive(val)
+			if err != nil {
+				return spec, fmt.Errorf("invalid dimensions '%s': %w", val, err)
+			}
+			spec.Dimensions = n
+
+		case "batch-size":
+			n, err := parsePositive(val)
+			if err != nil {
+				return spec, fmt.Errorf("invalid batch-size '%s': %w", val, err)
+			}
+			spec.BatchSize = n
+
+		case "parallel":
+			n, err := parsePositive(val)
+			if err != nil {
+				return spec, fmt.Errorf("invalid parallel '%s': %w", val, err)
+			}
+			spec.Parallel = n
+
 		default:
 			// warning instead of error for forward compatibility
 			lgr.Printf("[WARN] unknown key '%s' in custom provider spec (ignoring)", key)
@@ -456,6 +849,61 @@ func ParseCustomSpec(value string) (CustomSpec, error) {
 	return spec, nil
 }
 
+// instructionsIndex returns the index of the instructions key starting a pair of the spec, -1 if not found
+func instructionsIndex(value string) int {
+	lower := strings.ToLower(value)
+	for i := 0; i < len(lower); {
+		n := strings.Index(lower[i:], "instructions=")
+		if n < 0 {
+			return -1
+		}
+		n += i
+		if strings.TrimSpace(lower[:n]) == "" || strings.HasSuffix(strings.TrimSpace(lower[:n]), ",") {
+			return n
+		}
+		i = n + 1
+	}
+	return -1
+}
+
+// parseTimeout parses a non-negative duration like 30s or 5m
+func parseTimeout(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration")
+	}
+	return d, nil
+}
+
+// parsePositive parses a positive integer
+func parsePositive(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return n, nil
+}
+
+// validEndpointType checks if the lowercase endpoint type is supported by custom providers
+func validEndpointType(value string) bool {
+	switch provider.EndpointType(value) {
+	case provider.EndpointTypeAuto, provider.EndpointTypeResponses, provider.EndpointTypeChatCompletions, provider.EndpointTypeEmbeddings:
+		return true
+	}
+	return false
+}
+
+// isEmbeddings checks if the provider serves embeddings only
+func (s CustomSpec) isEmbeddings() bool {
+	return provider.EndpointType(s.EndpointType) == provider.EndpointTypeEmbeddings
+}
+
 // validateProviderID ensures ID contains only [a-z0-9-_]
 func validateProviderID(id string) error {
 	if id == "" {
@@ -1,12 +1,19 @@
 package config
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider"
 )
 
 func TestParseCustomSpec(t *testing.T) {
@@ -31,6 +38,75 @@ func TestParseCustomSpec(t *testing.T) {
 				Enabled:      true,
 			},
 		},
+		{
+			name:  "spec with discovery",
+			input: "url=http://localhost:8080/v1,model=local-llm,discover=true",
+			expected: CustomSpec{
+				URL:          "http://localhost:8080/v1",
+				Model:        "local-llm",
+				Temperature:  -1,
+				MaxTokens:    defaultCustomMaxTokens,
+				EndpointType: "chat_completions",
+				Discover:     true,
+			},
+		},
+		{
+			name:  "required spec",
+			input: "url=http://localhost:8080/v1,model=local-llm,required=true",
+			expected: CustomSpec{
+				URL:          "http://localhost:8080/v1",
+				Model:        "local-llm",
+				Temperature:  -1,
+				MaxTokens:    defaultCustomMaxTokens,
+				EndpointType: "chat_completions",
+				Required:     true,
+			},
+		},
+		{
+			name:  "spec with instructions",
+			input: "url=http://localhost:8080/v1,model=local-llm, Instructions=Answer briefly, in markdown, max-tokens=1k",
+			expected: CustomSpec{
+				URL:          "http://localhost:8080/v1",
+				Model:        "local-llm",
+				Temperature:  -1,
+				MaxTokens:    defaultCustomMaxTokens,
+				EndpointType: "chat_completions",
+				Instructions: "Answer briefly, in markdown, max-tokens=1k",
+			},
+		},
+		{
+			name:  "instructions only",
+			input: "instructions=be brief",
+			expected: CustomSpec{
+				Temperature:  -1,
+				MaxTokens:    defaultCustomMaxTokens,
+				EndpointType: "chat_completions",
+				Instructions: "be brief",
+			},
+		},
+		{
+			name:  "instructions word in a value",
+			input: "url=http://localhost:8080/v1,model=no-instructions=1",
+			expected: CustomSpec{
+				URL:          "http://localhost:8080/v1",
+				Model:        "no-instructions=1",
+				Temperature:  -1,
+				MaxTokens:    defaultCustomMaxTokens,
+				EndpointType: "chat_completions",
+			},
+		},
+		{
+			name:  "spec with parallel limit",
+			input: "url=http://localhost:8080/v1,model=local-llm,parallel=2",
+			expected: CustomSpec{
+				URL:          "http://localhost:8080/v1",
+				Model:        "local-llm",
+				Temperature:  -1,
+				MaxTokens:    defaultCustomMaxTokens,
+				EndpointType: "chat_completions",
+				Parallel:     2,
+			},
+		},
 		{
 			name:  "minimal spec with required fields only",
 			input: "url=http://localhost:8080,model=local-llm",
@@ -140,6 +216,12 @@ func TestParseCustomSpec(t *testing.T) {
 			wantErr: true,
 			errMsg:  "invalid enabled value 'yes'",
 		},
+		{
+			name:    "invalid required value",
+			input:   "url=test,model=test,required=always",
+			wantErr: true,
+			errMsg:  "invalid required value 'always'",
+		},
 		{
 			name:  "spec with human-readable max-tokens",
 			input: "url=test,model=test,max-tokens=32k",
@@ -200,11 +282,60 @@ func TestParseCustomSpec(t *testing.T) {
 				Enabled:      false, // default
 			},
 		},
+		{
+			name:  "spec with timeouts",
+			input: "url=http://localhost:11434,model=llama,timeout-connect=2s,timeout-generation=10m",
+			expected: CustomSpec{
+				URL:          "http://localhost:11434",
+				Model:        "llama",
+				Temperature:  -1, // unset
+				MaxTokens:    defaultCustomMaxTokens,
+				EndpointType: "chat_completions", // default
+				Timeouts:     provider.Timeouts{Connect: 2 * time.Second, Generation: 10 * time.Minute},
+			},
+		},
+		{
+			name:    "invalid timeout-generation",
+			input:   "url=http://test.com,model=test,timeout-generation=long",
+			wantErr: true,
+			errMsg:  "invalid timeout-generation 'long'",
+		},
+		{
+			name:    "negative timeout-connect",
+			input:   "url=http://test.com,model=test,timeout-connect=-1s",
+			wantErr: true,
+			errMsg:  "invalid timeout-connect '-1s': negative duration",
+		},
+		{
+			name:  "embeddings spec",
+			input: "url=http://localhost:11434,model=nomic-embed-text,endpoint-type=embeddings,dimensions=768,batch-size=16",
+			expected: CustomSpec{
+				URL:          "http://localhost:11434",
+				Model:        "nomic-embed-text",
+				Temperature:  -1, // unset
+				MaxTokens:    defaultCustomMaxTokens,
+				EndpointType: "embeddings",
+				Dimensions:   768,
+				BatchSize:    16,
+			},
+		},
+		{
+			name:    "invalid dimensions",
+			input:   "url=http://test.com,model=test,dimensions=0",
+			wantErr: true,
+			errMsg:  "invalid dimensions '0': must be positive",
+		},
+		{
+			name:    "invalid parallel",
+			input:   "url=http://test.com,model=test,parallel=-1",
+			wantErr: true,
+			errMsg:  "invalid parallel '-1': must be positive",
+		},
 		{
 			name:    "invalid endpoint-type",
 			input:   "url=http://test.com,model=test,endpoint-type=invalid",
 			wantErr: true,
-			errMsg:  "invalid endpoint-type 'invalid' (valid: auto, responses, chat_completions)",
+			errMsg:  "invalid endpoint-type 'invalid' (valid: auto, responses, chat_completions, embeddings)",
 		},
 	}
 
@@ -271,6 +402,26 @@ func TestCustomProviderManager_parseCustomProvidersFromEnv(t *testing.T) {
 		assert.InEpsilon(t, float32(0.5), local.Temperature, 0.0001)
 	})
 
+	t.Run("parse timeouts from env", func(t *testing.T) {
+		clearCustomEnv()
+		defer clearCustomEnv()
+
+		os.Setenv("CUSTOM_LOCAL_URL", "http://localhost:11434")
+		os.Setenv("CUSTOM_LOCAL_MODEL", "llama")
+		os.Setenv("CUSTOM_LOCAL_TIMEOUT_CONNECT", "3s")
+		os.Setenv("CUSTOM_LOCAL_TIMEOUT_GENERATION", "15m")
+		os.Setenv("CUSTOM_TIMEOUT_GENERATION", "1m") // legacy custom provider var, ignored
+		os.Setenv("CUSTOM_BAD_TIMEOUT_CONNECT", "soon")
+
+		manager := NewCustomProviderManager(nil, nil)
+		providers, warnings := manager.parseCustomProvidersFromEnv()
+
+		assert.Equal(t, []string{"custom[bad]: invalid timeout_connect 'soon': time: invalid duration \"soon\""}, warnings)
+		require.Contains(t, providers, "local")
+		assert.Equal(t, provider.Timeouts{Connect: 3 * time.Second, Generation: 15 * time.Minute}, providers["local"].Timeouts)
+		assert.NotContains(t, providers, "timeout")
+	})
+
 	t.Run("skip legacy env vars", func(t *testing.T) {
 		clearCustomEnv()
 		defer clearCustomEnv()
@@ -477,6 +628,26 @@ func TestCustomProviderManager_parseCustomProvidersFromEnv(t *testing.T) {
 		assert.Equal(t, "chat_completions", providers["test3"].EndpointType)
 	})
 
+	t.Run("embeddings from env", func(t *testing.T) {
+		clearCustomEnv()
+		defer clearCustomEnv()
+
+		os.Setenv("CUSTOM_EMBED_URL", "http://localhost:11434")
+		os.Setenv("CUSTOM_EMBED_MODEL", "nomic-embed-text")
+		os.Setenv("CUSTOM_EMBED_ENDPOINT_TYPE", "embeddings")
+		os.Setenv("CUSTOM_EMBED_DIMENSIONS", "768")
+		os.Setenv("CUSTOM_EMBED_BATCH_SIZE", "bad")
+
+		manager := NewCustomProviderManager(nil, nil)
+		providers, warnings := manager.parseCustomProvidersFromEnv()
+
+		require.Len(t, warnings, 1)
+		assert.Contains(t, warnings[0], "custom[embed]: invalid batch_size 'bad'")
+		assert.Equal(t, "embeddings", providers["embed"].EndpointType)
+		assert.Equal(t, 768, providers["embed"].Dimensions)
+		assert.Zero(t, providers["embed"].BatchSize)
+	})
+
 	t.Run("invalid endpoint_type from env", func(t *testing.T) {
 		clearCustomEnv()
 		defer clearCustomEnv()
@@ -700,6 +871,246 @@ func TestCustomProviderManager_CollectSecrets(t *testing.T) {
 	})
 }
 
+func TestCustomProviderManager_CreateProvider(t *testing.T) {
+	// helper to clear custom env vars
+	clearCustomEnv := func() {
+		for _, env := range os.Environ() {
+			if strings.HasPrefix(env, "CUSTOM_") {
+				key := strings.Split(env, "=")[0]
+				os.Unsetenv(key)
+			}
+		}
+	}
+	clearCustomEnv()
+	defer clearCustomEnv()
+
+	customs := map[string]CustomSpec{
+		"openrouter": {Name: "OpenRouter", URL: "http://router.com", Model: "model-a", Enabled: true},
+		"local":      {URL: "http://localhost", Model: "llama", Enabled: true},
+		"disabled":   {Name: "Disabled", URL: "http://disabled.com", Model: "model", Enabled: false},
+		"nourl":      {Name: "NoURL", Model: "model", Enabled: true},
+	}
+	manager := NewCustomProviderManager(customs, nil)
+
+	tests := []struct {
+		name     string
+		provName string
+		model    string
+		wantName string
+		wantErr  string
+	}{
+		{name: "by name with model override", provName: "openrouter", model: "model-b", wantName: "OpenRouter"},
+		{name: "by id without explicit name", provName: "local", wantName: "local"},
+		{name: "disabled provider", provName: "disabled", wantErr: `custom provider "disabled" not found`},
+		{name: "unknown provider", provName: "unknown", wantErr: `custom provider "unknown" not found`},
+		{name: "missing url", provName: "nourl", wantErr: "custom[nourl]: missing URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := manager.CreateProvider(tt.provName, tt.model)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantName, p.Name())
+			assert.True(t, p.Enabled())
+		})
+	}
+}
+
+func TestCustomProviderManager_WithOutputLimits(t *testing.T) {
+	var reqBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqBody = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&reqBody))
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"content": "answer"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	customs := map[string]CustomSpec{"local": {URL: server.URL, Model: "llama", MaxTokens: 100, Enabled: true}}
+	p, err := NewCustomProviderManager(customs, nil).WithOutputLimits(500, []string{"END"}).CreateProvider("local", "")
+	require.NoError(t, err)
+	_, err = p.Generate(context.Background(), "prompt")
+	require.NoError(t, err)
+	assert.InDelta(t, 500, reqBody["max_tokens"], 0.001, "global max tokens override per-provider one")
+	assert.Equal(t, []any{"END"}, reqBody["stop"])
+
+	p, err = NewCustomProviderManager(customs, nil).WithOutputLimits(0, nil).CreateProvider("local", "")
+	require.NoError(t, err)
+	_, err = p.Generate(context.Background(), "prompt")
+	require.NoError(t, err)
+	assert.InDelta(t, 100, reqBody["max_tokens"], 0.001, "per-provider max tokens kept")
+	assert.NotContains(t, reqBody, "stop")
+}
+
+func TestCustomProviderManager_WithTemperature(t *testing.T) {
+	var reqBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqBody = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&reqBody))
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"content": "answer"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	customs := map[string]CustomSpec{"local": {URL: server.URL, Model: "llama", Temperature: 0.9, Enabled: true}}
+	p, err := NewCustomProviderManager(customs, nil).WithTemperature(nil).CreateProvider("local", "")
+	require.NoError(t, err)
+	_, err = p.Generate(context.Background(), "prompt")
+	require.NoError(t, err)
+	assert.InDelta(t, 0.9, reqBody["temperature"], 0.001, "per-provider temperature kept")
+
+	temp := float32(0.2)
+	p, err = NewCustomProviderManager(customs, nil).WithTemperature(&temp).CreateProvider("local", "")
+	require.NoError(t, err)
+	_, err = p.Generate(context.Background(), "prompt")
+	require.NoError(t, err)
+	assert.InDelta(t, 0.2, reqBody["temperature"], 0.001, "global temperature overrides per-provider one")
+}
+
+func TestCustomProviderManager_Embedder(t *testing.T) {
+	embed := CustomSpec{Name: "Ollama", URL: "http://localhost:11434", Model: "nomic-embed-text",
+		EndpointType: "embeddings", Enabled: true}
+	chat := CustomSpec{Name: "Local", URL: "http://localhost:1234", Model: "llama", EndpointType: "chat_completions", Enabled: true}
+
+	t.Run("embeddings provider", func(t *testing.T) {
+		manager := NewCustomProviderManager(map[string]CustomSpec{"embed": embed, "local": chat}, nil)
+		embedder := manager.Embedder()
+		require.NotNil(t, embedder)
+		assert.Equal(t, "Ollama", embedder.(provider.Provider).Name())
+
+		// embeddings provider is not used for generation
+		providers, errs := manager.InitializeProviders()
+		assert.Empty(t, errs)
+		require.Len(t, providers, 1)
+		assert.Equal(t, "Local", providers[0].Name())
+		_, err := manager.CreateProvider("ollama", "")
+		require.EqualError(t, err, `custom provider "ollama" not found`)
+	})
+
+	t.Run("no embeddings provider", func(t *testing.T) {
+		manager := NewCustomProviderManager(map[string]CustomSpec{"local": chat}, nil)
+		assert.Nil(t, manager.Embedder())
+	})
+
+	t.Run("embeddings provider alone doesn't enable generation", func(t *testing.T) {
+		manager := NewCustomProviderManager(map[string]CustomSpec{"embed": embed}, nil)
+		assert.False(t, manager.AnyEnabled())
+	})
+}
+
+func TestCustomProviderManager_Models(t *testing.T) {
+	manager := NewCustomProviderManager(map[string]CustomSpec{
+		"embed":    {Name: "Ollama", URL: "http://localhost:11434", Model: "nomic-embed-text", EndpointType: "embeddings", Enabled: true},
+		"local":    {Name: "Local", URL: "http://localhost:1234", Model: "llama", Enabled: true},
+		"router":   {URL: "https://openrouter.ai/api/v1", Model: "gpt-4o-mini", Enabled: true},
+		"disabled": {Name: "Off", URL: "http://localhost:1", Model: "llama", Enabled: false},
+	}, nil)
+	assert.Equal(t, map[string]string{"Local": "llama", "router": "gpt-4o-mini"}, manager.Models())
+}
+
+func TestCustomProviderManager_Required(t *testing.T) {
+	assert.Empty(t, NewCustomProviderManager(nil, nil).Required())
+
+	t.Setenv("CUSTOM_ENVREQ_URL", "http://localhost:2")
+	t.Setenv("CUSTOM_ENVREQ_MODEL", "llama")
+	t.Setenv("CUSTOM_ENVREQ_ENABLED", "true")
+	t.Setenv("CUSTOM_ENVREQ_REQUIRED", "true")
+	manager := NewCustomProviderManager(map[string]CustomSpec{
+		"embed":    {Name: "Ollama", URL: "http://localhost:11434", Model: "nomic", EndpointType: "embeddings", Enabled: true, Required: true},
+		"local":    {Name: "Local", URL: "http://localhost:1234", Model: "llama", Enabled: true, Required: true},
+		"router":   {URL: "https://openrouter.ai/api/v1", Model: "gpt-4o-mini", Enabled: true},
+		"disabled": {Name: "Off", URL: "http://localhost:1", Model: "llama", Required: true},
+	}, nil)
+	assert.Equal(t, []string{"Local", "envreq"}, manager.Required())
+}
+
+func TestCustomProviderManager_Parallel(t *testing.T) {
+	assert.Empty(t, NewCustomProviderManager(nil, nil).Parallel())
+
+	t.Setenv("CUSTOM_ENVPAR_URL", "http://localhost:2")
+	t.Setenv("CUSTOM_ENVPAR_MODEL", "llama")
+	t.Setenv("CUSTOM_ENVPAR_ENABLED", "true")
+	t.Setenv("CUSTOM_ENVPAR_PARALLEL", "3")
+	manager := NewCustomProviderManager(map[string]CustomSpec{
+		"embed":    {Name: "Ollama", URL: "http://localhost:11434", Model: "nomic", EndpointType: "embeddings", Enabled: true, Parallel: 1},
+		"local":    {Name: "Local", URL: "http://localhost:1234", Model: "llama", Enabled: true, Parallel: 1},
+		"router":   {URL: "https://openrouter.ai/api/v1", Model: "gpt-4o-mini", Enabled: true},
+		"disabled": {Name: "Off", URL: "http://localhost:1", Model: "llama", Parallel: 2},
+	}, nil)
+	assert.Equal(t, map[string]int{"Local": 1, "envpar": 3}, manager.Parallel())
+}
+
+func TestCustomProviderManager_Instructions(t *testing.T) {
+	assert.Empty(t, NewCustomProviderManager(nil, nil).Instructions())
+
+	t.Setenv("CUSTOM_ENVINS_URL", "http://localhost:2")
+	t.Setenv("CUSTOM_ENVINS_MODEL", "llama")
+	t.Setenv("CUSTOM_ENVINS_ENABLED", "true")
+	t.Setenv("CUSTOM_ENVINS_INSTRUCTIONS", "answer in German, briefly")
+	manager := NewCustomProviderManager(map[string]CustomSpec{
+		"embed":    {Name: "Ollama", URL: "http://localhost:11434", Model: "nomic", EndpointType: "embeddings", Enabled: true, Instructions: "x"},
+		"local":    {Name: "Local", URL: "http://localhost:1234", Model: "llama", Enabled: true, Instructions: "be brief"},
+		"router":   {URL: "https://openrouter.ai/api/v1", Model: "gpt-4o-mini", Enabled: true, Instructions: "  "},
+		"disabled": {Name: "Off", URL: "http://localhost:1", Model: "llama", Instructions: "be brief"},
+	}, &CustomSpec{Name: "Legacy", URL: "http://localhost:3", Model: "m", Enabled: true, Instructions: "legacy rules"})
+	assert.Equal(t, map[string]string{"local": "be brief", "envins": "answer in German, briefly", "legacy": "legacy rules"},
+		manager.Instructions())
+}
+
+func TestCustomProviderManager_Specs(t *testing.T) {
+	temp := float32(0.3)
+	manager := NewCustomProviderManager(map[string]CustomSpec{
+		"embed":    {Name: "Ollama", URL: "http://localhost:11434", Model: "nomic-embed-text", EndpointType: "embeddings", Enabled: true},
+		"router":   {URL: "https://openrouter.ai/api/v1", APIKey: "secret", Model: "gpt-4o-mini", MaxTokens: 1000, Enabled: true},
+		"disabled": {Name: "Off", URL: "http://localhost:1", Model: "llama", Enabled: false},
+	}, nil).WithTimeouts(provider.Timeouts{Connect: 5 * time.Second, Generation: time.Minute}).
+		WithOutputLimits(500, nil).WithTemperature(&temp)
+
+	specs := manager.Specs()
+	require.Len(t, specs, 2)
+	assert.Equal(t, "Ollama", specs[0].Name)
+	assert.Equal(t, "embeddings", specs[0].EndpointType)
+	assert.Equal(t, CustomSpec{Name: "router", URL: "https://openrouter.ai/api/v1", APIKey: "secret", Model: "gpt-4o-mini",
+		MaxTokens: 500, Temperature: 0.3, Enabled: true,
+		Timeouts: provider.Timeouts{Connect: 5 * time.Second, Generation: time.Minute}}, specs[1])
+}
+
+func TestCustomProviderManager_DiscoveredModels(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":[{"id":"llama"},{"id":"qwen"}]}`))
+	}))
+	defer ts.Close()
+
+	manager := NewCustomProviderManager(map[string]CustomSpec{
+		"served":    {URL: ts.URL + "/v1", Model: "qwen", Enabled: true, Discover: true},
+		"missing":   {URL: ts.URL + "/v1", Model: "mistral", Enabled: true, Discover: true},
+		"no-list":   {URL: ts.URL + "/none", Model: "mistral", Enabled: true, Discover: true},
+		"no-check":  {URL: ts.URL + "/v1", Model: "mistral", Enabled: true},
+		"Disabled":  {URL: ts.URL + "/v1", Model: "llama", Discover: true},
+		"embedding": {URL: ts.URL + "/v1", Model: "embed", EndpointType: "embeddings", Enabled: true, Discover: true},
+	}, nil).WithModelCache(provider.NewModelCache(t.TempDir(), time.Hour))
+
+	providers, errs := manager.InitializeProviders()
+	names := make([]string, 0, len(providers))
+	for _, p := range providers {
+		names = append(names, p.Name())
+	}
+	assert.Equal(t, []string{"no-check", "no-list", "served"}, names, "model not checked if discovery fails")
+	assert.Equal(t, []string{"custom[missing]: model mistral is not served by " + ts.URL + "/v1, available: llama, qwen"}, errs)
+
+	assert.Equal(t, []string{"llama", "qwen"}, manager.DiscoveredModels(context.Background(), "Served"))
+	assert.Nil(t, manager.DiscoveredModels(context.Background(), "no-check"))
+	assert.Nil(t, manager.DiscoveredModels(context.Background(), "disabled"))
+	assert.Nil(t, manager.DiscoveredModels(context.Background(), "no-list"))
+	assert.Nil(t, NewCustomProviderManager(nil, nil).DiscoveredModels(context.Background(), "served"), "no cache")
+}
+
 func TestCustomProviderManager_AnyEnabled(t *testing.T) {
 	// helper to clear custom env vars
 	clearCustomEnv := func() {
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFile reads the YAML config file and converts its options to command line arguments, see OptionArgs
+// for the format. A missing file is not an error, it returns no arguments.
+func LoadFile(path string) ([]string, error) {
+	options, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	args, err := OptionArgs(options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return args, nil
+}
+
+// ReadFile reads options of the YAML config file, with nested maps flattened to dotted keys, so
+// "openai: {enabled: true}" is read as "openai.enabled: true". Options of several files can be merged
+// before converting them to arguments, letting a later file override any option of an earlier one,
+// including false booleans. A missing file is not an error, it returns no options.
+func ReadFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // config file location is set by the user or admin
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var options map[string]any
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&options); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	res := map[string]any{}
+	flatten("", options, res)
+	return res, nil
+}
+
+// Merge puts options of src to dst, read by ReadFile, overriding values of dst, false booleans included.
+// Lists are combined, items of src added after items of dst, same as repeated options on the command line.
+func Merge(dst, src map[string]any) {
+	for k, v := range src {
+		if items, ok := v.([]any); ok {
+			if prev, ok := dst[k].([]any); ok {
+				dst[k] = append(slices.Clone(prev), items...)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// flatten puts options to res with keys of nested maps joined with dots and leading dashes trimmed
+func flatten(prefix string, options, res map[string]any) {
+	for k, v := range options {
+		name := strings.TrimLeft(k, "-")
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if m, ok := v.(map[string]any); ok {
+			flatten(name, m, res)
+			continue
+		}
+		res[name] = v
+	}
+}
+
+// OptionArgs converts options map to command line arguments, sorted by option name. Keys are long option
+// names without dashes; nested maps are joined with dots, so "openai: {enabled: true}" is the same as
+// "openai.enabled: true". Lists are repeated options, true booleans are flags and false ones are skipped.
+func OptionArgs(options map[string]any) ([]string, error) {
+	return optionArgs("", options)
+}
+
+func optionArgs(prefix string, options map[string]any) ([]string, error) {
+	keys := make([]string, 0, len(options))
+	for k := range options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var res []string
+	for _, k := range keys {
+		name := strings.TrimLeft(k, "-")
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		switch v := options[k].(type) {
+		case map[string]any:
+			args, err := optionArgs(name, v)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, args...)
+		case []any:
+			for _, item := range v {
+				if _, ok := item.(map[string]any); ok {
+					return nil, fmt.Errorf("option %s: list items should be values", name)
+				}
+				res = append(res, fmt.Sprintf("--%s=%v", name, item))
+			}
+		case bool:
+			if v {
+				res = append(res, "--"+name)
+			}
+		case nil:
+			return nil, fmt.Errorf("option %s has no value", name)
+		default:
+			res = append(res, fmt.Sprintf("--%s=%v", name, v))
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		data    string
+		want    []string
+		wantErr string
+	}{
+		{name: "options", data: "openai:\n  enabled: true\n  model: gpt-5\nexclude: [\"a/**\", \"b/**\"]\nforce: false\ntimeout.total: 5m\n",
+			want: []string{"--exclude=a/**", "--exclude=b/**", "--openai.enabled", "--openai.model=gpt-5", "--timeout.total=5m"}},
+		{name: "empty", data: ""},
+		{name: "comments only", data: "# managed by platform team\n"},
+		{name: "no value", data: "custom.url:\n", wantErr: "option custom.url has no value"},
+		{name: "not a map", data: "- a\n- b\n", wantErr: "invalid config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "config.yml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.data), 0o600))
+			got, err := LoadFile(path)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		got, err := LoadFile(filepath.Join(dir, "missing.yml"))
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+}
+
+func TestReadFileAndMerge(t *testing.T) {
+	dir := t.TempDir()
+	system, user := filepath.Join(dir, "system.yml"), filepath.Join(dir, "user.yml")
+	require.NoError(t, os.WriteFile(system, []byte("openai:\n  enabled: true\n  model: gpt-5\nexclude: [\"a/**\"]\n"), 0o600))
+	require.NoError(t, os.WriteFile(user, []byte("openai.enabled: false\nexclude: [\"b/**\"]\n"), 0o600))
+
+	merged := map[string]any{}
+	for _, path := range []string{system, user, filepath.Join(dir, "missing.yml")} {
+		opts, err := ReadFile(path)
+		require.NoError(t, err)
+		Merge(merged, opts)
+	}
+	assert.Equal(t, map[string]any{"openai.enabled": false, "openai.model": "gpt-5", "exclude": []any{"a/**", "b/**"}}, merged)
+
+	args, err := OptionArgs(merged)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--exclude=a/**", "--exclude=b/**", "--openai.model=gpt-5"}, args, "disabled by user config")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/go-pkgz/lgr"
@@ -26,10 +27,11 @@ type Manager struct {
 
 // Options configures consensus checking behavior
 type Options struct {
-	Enabled     bool
-	Attempts    int
-	Prompt      string
-	MixProvider string
+	Enabled      bool
+	Attempts     int
+	Prompt       string
+	MixProvider  string                // name of the provider checking consensus, or "capability:<cap>" spec
+	Capabilities provider.Capabilities // capabilities of providers, used to select the provider by capability
 }
 
 // AttemptRequest holds the parameters for consensus attempt
@@ -44,6 +46,7 @@ type AttemptResponse struct {
 	FinalResults []provider.Result
 	Attempts     int
 	Achieved     bool
+	Explanation  string // judge's reasoning from the last consensus check, points of disagreement if not achieved
 }
 
 // New creates a new consensus manager with pre-compiled regex patterns
@@ -139,7 +142,14 @@ func (m *Manager) Attempt(ctx context.Context, req AttemptRequest) (*AttemptResp
 	}
 
 	// find the mix provider to use for consensus checking
-	mixProvider := m.findMixProvider(req.Options.MixProvider, req.Providers)
+	mixProvider := m.findMixProvider(req.Options.MixProvider, req.Providers, req.Options.Capabilities)
+	if mixProvider == nil && strings.HasPrefix(req.Options.MixProvider, provider.CapabilityPrefix) {
+		return &AttemptResponse{
+			FinalResults: req.Results,
+			Attempts:     0,
+			Achieved:     false,
+		}, fmt.Errorf("no enabled provider with %s for consensus checking", req.Options.MixProvider)
+	}
 	if mixProvider == nil {
 		m.logger.Logf("[WARN] no mix provider available for consensus checking, falling back to first enabled provider")
 		// fall back to first enabled provider
@@ -161,6 +171,7 @@ func (m *Manager) Attempt(ctx context.Context, req AttemptRequest) (*AttemptResp
 
 	results := req.Results
 	var lastError error
+	var explanation string
 	for attempt := 1; attempt <= req.Options.Attempts; attempt++ {
 		// check if results agree using mix model
 		checkPrompt := m.buildConsensusCheckPrompt(results)
@@ -172,6 +183,7 @@ func (m *Manager) Attempt(ctx context.Context, req AttemptRequest) (*AttemptResp
 		}
 
 		m.logger.Logf("[DEBUG] Consensus check response on attempt %d: %s", attempt, agreement)
+		explanation = m.explanation(agreement)
 
 		// check if consensus was reached
 		if m.isConsensusReached(agreement) {
@@ -180,17 +192,31 @@ func (m *Manager) Attempt(ctx context.Context, req AttemptRequest) (*AttemptResp
 				FinalResults: results,
 				Attempts:     attempt,
 				Achieved:     true,
+				Explanation:  explanation,
 			}, nil
 		}
 
-		// if no agreement and not last attempt, re-run all providers with context
+		// if no agreement and not last attempt, re-run outliers named by the judge with answers of the others,
+		// or all providers if outliers are unknown
 		if attempt < req.Options.Attempts {
-			m.logger.Logf("[INFO] no consensus on attempt %d, retrying with context", attempt)
-			rerunPrompt := m.buildConsensusRerunPrompt(req.Options.Prompt, results)
-			newResults := m.rerunProviders(ctx, req.Providers, rerunPrompt)
+			outliers := m.outliers(agreement, results)
+			if len(outliers) == 0 {
+				m.logger.Logf("[INFO] no consensus on attempt %d, retrying all providers with context", attempt)
+				rerunPrompt := m.buildConsensusRerunPrompt(req.Options.Prompt, results)
+				if newResults := m.rerunProviders(ctx, req.Providers, rerunPrompt); len(newResults) > 0 {
+					results = newResults
+				} else {
+					m.logger.Logf("[WARN] failed to get new results on attempt %d", attempt)
+				}
+				continue
+			}
 
+			m.logger.Logf("[INFO] no consensus on attempt %d, retrying outliers %s with context",
+				attempt, strings.Join(outliers, ", "))
+			rerunPrompt := m.buildConsensusRerunPrompt(req.Options.Prompt, excludeResults(results, outliers))
+			newResults := m.rerunProviders(ctx, pickProviders(req.Providers, outliers), rerunPrompt)
 			if len(newResults) > 0 {
-				results = newResults
+				results = replaceResults(results, newResults)
 			} else {
 				m.logger.Logf("[WARN] failed to get new results on attempt %d", attempt)
 			}
@@ -204,26 +230,33 @@ func (m *Manager) Attempt(ctx context.Context, req AttemptRequest) (*AttemptResp
 			FinalResults: results,
 			Attempts:     req.Options.Attempts,
 			Achieved:     false,
+			Explanation:  explanation,
 		}, fmt.Errorf("consensus checking failed: %w", lastError)
 	}
 	return &AttemptResponse{
 		FinalResults: results,
 		Attempts:     req.Options.Attempts,
 		Achieved:     false,
+		Explanation:  explanation,
 	}, nil
 }
 
-// findMixProvider finds the provider to use for mixing/consensus
-func (m *Manager) findMixProvider(mixProviderName string, providers []provider.Provider) provider.Provider {
-	return provider.FindProviderByName(mixProviderName, providers)
+// findMixProvider finds the provider to use for mixing/consensus by name or capability
+func (m *Manager) findMixProvider(mixProviderName string, providers []provider.Provider,
+	caps provider.Capabilities) provider.Provider {
+	return provider.FindProvider(mixProviderName, providers, caps)
 }
 
 // buildConsensusCheckPrompt creates a prompt to check if responses agree
 func (m *Manager) buildConsensusCheckPrompt(results []provider.Result) string {
 	var sb strings.Builder
 	sb.WriteString("Do the following AI responses fundamentally agree on the main points? ")
-	sb.WriteString("IMPORTANT: You must answer with ONLY the word YES or NO. ")
-	sb.WriteString("Answer YES if they agree on the core message. Answer NO if they significantly disagree.\n\n")
+	sb.WriteString("IMPORTANT: The first line of your answer must be ONLY the word YES or NO. ")
+	sb.WriteString("Answer YES if they agree on the core message. Answer NO if they significantly disagree.\n")
+	sb.WriteString("After the first line, explain your verdict concisely. If the answer is NO, list the points of ")
+	sb.WriteString("disagreement as short bullet points, naming the responses which disagree, and end with the line ")
+	sb.WriteString("\"OUTLIERS: <names>\" listing comma-separated names of providers whose responses disagree ")
+	sb.WriteString("with the majority.\n\n")
 
 	for i, r := range results {
 		if r.Error != nil {
@@ -262,13 +295,104 @@ func (m *Manager) buildConsensusRerunPrompt(originalPrompt string, conflictingRe
 
 // rerunProviders runs all providers again with a new prompt
 func (m *Manager) rerunProviders(ctx context.Context, providers []provider.Provider, prompt string) []provider.Result {
-	r := runner.New(providers...)
-	_, err := r.Run(ctx, prompt)
+	res, err := runner.New(providers...).Execute(ctx, prompt)
 	if err != nil {
 		m.logger.Logf("[WARN] failed to rerun providers for consensus: %v", err)
 		return nil
 	}
-	return r.GetResults()
+	return res.Results
+}
+
+// outliersPrefix starts the line of the consensus check response naming providers which disagree with the majority
+const outliersPrefix = "outliers:"
+
+// explanation returns the judge's reasoning following the YES/NO verdict on the first line of the response,
+// without the outliers line
+func (m *Manager) explanation(response string) string {
+	_, rest, found := strings.Cut(strings.TrimSpace(response), "\n")
+	if !found {
+		return ""
+	}
+	lines := strings.Split(rest, "\n")
+	res := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), outliersPrefix) {
+			continue
+		}
+		res = append(res, line)
+	}
+	return strings.TrimSpace(strings.Join(res, "\n"))
+}
+
+// outliers returns names of successful results the judge named as outliers in the response. It returns nil if
+// outliers are not named or all results are outliers, as there is no majority to re-ask them with.
+func (m *Manager) outliers(response string, results []provider.Result) []string {
+	var names []string
+	for _, line := range strings.Split(response, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(strings.ToLower(line), outliersPrefix) {
+			names = strings.Split(line[len(outliersPrefix):], ",")
+		}
+	}
+
+	var res []string
+	successful := 0
+	for _, r := range results {
+		if r.Error != nil {
+			continue
+		}
+		successful++
+		for _, name := range names {
+			if strings.EqualFold(strings.TrimSpace(name), r.Provider) {
+				res = append(res, r.Provider)
+				break
+			}
+		}
+	}
+	if len(res) == 0 || len(res) == successful {
+		return nil
+	}
+	return res
+}
+
+// excludeResults returns results of providers not in names
+func excludeResults(results []provider.Result, names []string) []provider.Result {
+	res := make([]provider.Result, 0, len(results))
+	for _, r := range results {
+		if !slices.Contains(names, r.Provider) {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// pickProviders returns providers with names in the list
+func pickProviders(providers []provider.Provider, names []string) []provider.Provider {
+	res := make([]provider.Provider, 0, len(names))
+	for _, p := range providers {
+		if slices.Contains(names, p.Name()) {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// replaceResults replaces results of the same providers with new successful results, keeping the order.
+// Failed new results are ignored, and the previous answers of their providers are kept.
+func replaceResults(results, newResults []provider.Result) []provider.Result {
+	res := slices.Clone(results)
+	for _, nr := range newResults {
+		if nr.Error != nil {
+			continue
+		}
+		for i := range res {
+			if res[i].Provider == nr.Provider {
+				res[i] = nr
+				break
+			}
+		}
+	}
+	return res
 }
 
 // isConsensusReached checks if the response indicates consensus was reached
@@ -64,6 +64,35 @@ func TestManager_Attempt(t *testing.T) {
 		assert.Equal(t, results, resp.FinalResults, "results should be unchanged when consensus reached")
 	})
 
+	t.Run("consensus not reached with explanation", func(t *testing.T) {
+		mockOpenAI := &mocks.ProviderMock{
+			NameFunc:    func() string { return "OpenAI" },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				return "NO\n- OpenAI says Paris, Anthropic says Lyon\n", nil
+			},
+		}
+		mockAnthropic := &mocks.ProviderMock{
+			NameFunc:     func() string { return "Anthropic" },
+			EnabledFunc:  func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return "Lyon", nil },
+		}
+
+		req := AttemptRequest{
+			Options:   Options{Enabled: true, Attempts: 1, Prompt: "capital of France?", MixProvider: "openai"},
+			Providers: []provider.Provider{mockOpenAI, mockAnthropic},
+			Results: []provider.Result{
+				{Provider: "OpenAI", Text: "Paris"},
+				{Provider: "Anthropic", Text: "Lyon"},
+			},
+		}
+
+		resp, err := manager.Attempt(ctx, req)
+		require.NoError(t, err)
+		assert.False(t, resp.Achieved)
+		assert.Equal(t, "- OpenAI says Paris, Anthropic says Lyon", resp.Explanation)
+	})
+
 	t.Run("consensus not reached", func(t *testing.T) {
 		mockOpenAI := &mocks.ProviderMock{
 			NameFunc:    func() string { return "OpenAI" },
@@ -228,6 +257,64 @@ func TestManager_Attempt(t *testing.T) {
 		assert.NotEqual(t, results, resp.FinalResults)
 	})
 
+	t.Run("rerun only outliers", func(t *testing.T) {
+		checks := 0
+		var googlePrompt string
+		mockOpenAI := &mocks.ProviderMock{
+			NameFunc:    func() string { return "OpenAI" },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				if strings.Contains(prompt, "Do the following AI responses fundamentally agree") {
+					checks++
+					if checks == 1 {
+						return "NO\n- Google says Lyon\nOUTLIERS: google", nil
+					}
+					return "YES", nil
+				}
+				return "Paris again", nil
+			},
+		}
+		mockAnthropic := &mocks.ProviderMock{
+			NameFunc:     func() string { return "Anthropic" },
+			EnabledFunc:  func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return "Paris again", nil },
+		}
+		mockGoogle := &mocks.ProviderMock{
+			NameFunc:    func() string { return "Google" },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				googlePrompt = prompt
+				return "Paris, I stand corrected", nil
+			},
+		}
+
+		req := AttemptRequest{
+			Options:   Options{Enabled: true, Attempts: 2, Prompt: "capital of France?", MixProvider: "openai"},
+			Providers: []provider.Provider{mockOpenAI, mockAnthropic, mockGoogle},
+			Results: []provider.Result{
+				{Provider: "OpenAI", Text: "Paris"},
+				{Provider: "Anthropic", Text: "Paris it is"},
+				{Provider: "Google", Text: "Lyon"},
+			},
+		}
+
+		resp, err := manager.Attempt(ctx, req)
+		require.NoError(t, err)
+		assert.True(t, resp.Achieved)
+		assert.Equal(t, 2, resp.Attempts)
+		assert.Equal(t, []provider.Result{
+			{Provider: "OpenAI", Text: "Paris"},
+			{Provider: "Anthropic", Text: "Paris it is"},
+			resp.FinalResults[2],
+		}, resp.FinalResults, "agreeing providers keep their answers")
+		assert.Equal(t, "Paris, I stand corrected", resp.FinalResults[2].Text)
+		assert.Len(t, mockAnthropic.GenerateCalls(), 0, "agreeing provider should not be re-asked")
+		assert.Len(t, mockGoogle.GenerateCalls(), 1)
+		assert.Contains(t, googlePrompt, "--- OpenAI's response ---\nParis")
+		assert.Contains(t, googlePrompt, "--- Anthropic's response ---\nParis it is")
+		assert.NotContains(t, googlePrompt, "Lyon")
+	})
+
 	t.Run("disabled consensus", func(t *testing.T) {
 		mockOpenAI := &mocks.ProviderMock{
 			NameFunc:    func() string { return "OpenAI" },
@@ -381,26 +468,26 @@ func TestManager_findMixProvider(t *testing.T) {
 	providers := []provider.Provider{mockOpenAI, mockAnthropic, mockGoogle}
 
 	t.Run("exact match", func(t *testing.T) {
-		p := manager.findMixProvider("Anthropic", providers)
+		p := manager.findMixProvider("Anthropic", providers, nil)
 		require.NotNil(t, p)
 		assert.Equal(t, "Anthropic", p.Name())
 	})
 
 	t.Run("partial match", func(t *testing.T) {
-		p := manager.findMixProvider("openai", providers)
+		p := manager.findMixProvider("openai", providers, nil)
 		require.NotNil(t, p)
 		assert.Equal(t, "OpenAI (gpt-4o)", p.Name())
 	})
 
 	t.Run("disabled provider not returned", func(t *testing.T) {
-		p := manager.findMixProvider("Google", providers)
+		p := manager.findMixProvider("Google", providers, nil)
 		// should return first enabled provider as fallback
 		require.NotNil(t, p)
 		assert.Equal(t, "OpenAI (gpt-4o)", p.Name())
 	})
 
 	t.Run("no match returns fallback", func(t *testing.T) {
-		p := manager.findMixProvider("Claude", providers)
+		p := manager.findMixProvider("Claude", providers, nil)
 		// should return first enabled provider as fallback
 		require.NotNil(t, p)
 		assert.Equal(t, "OpenAI (gpt-4o)", p.Name())
@@ -425,9 +512,70 @@ func TestManager_buildConsensusCheckPrompt(t *testing.T) {
 	assert.Contains(t, prompt, "Response 2 from Anthropic")
 	assert.Contains(t, prompt, "The capital is Paris")
 	assert.NotContains(t, prompt, "Google") // error result should be skipped
+	assert.Contains(t, prompt, "points of disagreement")
+	assert.Contains(t, prompt, "OUTLIERS: <names>")
 	assert.Contains(t, prompt, "Answer:")
 }
 
+func TestManager_outliers(t *testing.T) {
+	manager := New(nil)
+	results := []provider.Result{
+		{Provider: "OpenAI", Text: "A"},
+		{Provider: "Anthropic", Text: "A"},
+		{Provider: "Google", Text: "B"},
+		{Provider: "Failed", Error: errors.New("failed")},
+	}
+	tests := []struct {
+		name     string
+		response string
+		expected []string
+	}{
+		{"single outlier", "NO\n- Google differs\nOUTLIERS: Google", []string{"Google"}},
+		{"case insensitive", "NO\noutliers: google, openai", []string{"OpenAI", "Google"}},
+		{"unknown names ignored", "NO\nOUTLIERS: Mistral, Google", []string{"Google"}},
+		{"failed result ignored", "NO\nOUTLIERS: Failed", nil},
+		{"all outliers", "NO\nOUTLIERS: OpenAI, Anthropic, Google", nil},
+		{"no outliers line", "NO\n- they differ", nil},
+		{"empty outliers", "NO\nOUTLIERS:", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, manager.outliers(tt.response, results))
+		})
+	}
+}
+
+func TestReplaceResults(t *testing.T) {
+	results := []provider.Result{{Provider: "A", Text: "a"}, {Provider: "B", Text: "b"}, {Provider: "C", Text: "c"}}
+	res := replaceResults(results, []provider.Result{
+		{Provider: "C", Text: "c2"},
+		{Provider: "B", Error: errors.New("failed")},
+	})
+	assert.Equal(t, []provider.Result{{Provider: "A", Text: "a"}, {Provider: "B", Text: "b"}, {Provider: "C", Text: "c2"}}, res)
+	assert.Equal(t, "c", results[2].Text, "original results should not change")
+}
+
+func TestManager_explanation(t *testing.T) {
+	manager := New(nil)
+	tests := []struct {
+		name     string
+		response string
+		expected string
+	}{
+		{"verdict only", "YES", ""},
+		{"verdict with spaces", "  NO  \n", ""},
+		{"verdict with reasons", "NO\n- A says 1\n- B says 2\n", "- A says 1\n- B says 2"},
+		{"blank line after verdict", "YES\n\nBoth say Paris.", "Both say Paris."},
+		{"outliers line dropped", "NO\n- A says 1\nOUTLIERS: A", "- A says 1"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, manager.explanation(tt.response))
+		})
+	}
+}
+
 func TestManager_buildConsensusRerunPrompt(t *testing.T) {
 	manager := New(nil)
 
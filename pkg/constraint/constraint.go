@@ -0,0 +1,98 @@
+// Package constraint turns constraints of the answer, like its format and length, into output instructions
+// for providers, so users don't repeat formatting boilerplate in every prompt. Instructions are worded the same
+// for all providers and laid out in the style models of the vendor follow best.
+package constraint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Style is the layout of output instructions
+type Style int
+
+// instruction styles
+const (
+	StyleMarkdown Style = iota // list under a markdown header, for OpenAI and compatible models
+	StyleXML                   // list inside XML tags, for Anthropic models
+)
+
+// Constraints of the answer
+type Constraints struct {
+	Format   string   // format of the answer, like "markdown", without the list of sections
+	Sections []string // section headers of the answer, in order
+	MaxWords int      // max words of the answer, 0 for no limit
+}
+
+// sectionsRe matches the list of sections in the format, like "markdown with sections: Summary, Issues"
+var sectionsRe = regexp.MustCompile(`(?i)^(.*?)[ \t,]*(?:\bwith\s+)?\bsections\s*:\s*(.*)$`)
+
+// New makes constraints of the format and max words. The format may end with the list of sections, like
+// "markdown with sections: Summary, Issues, Suggestions".
+func New(format string, maxWords int) (Constraints, error) {
+	if maxWords < 0 {
+		return Constraints{}, fmt.Errorf("max words can't be negative, got %d", maxWords)
+	}
+	c := Constraints{Format: strings.TrimSpace(format), MaxWords: maxWords}
+	m := sectionsRe.FindStringSubmatch(c.Format)
+	if m == nil {
+		return c, nil
+	}
+	c.Format = strings.TrimSpace(m[1])
+	for s := range strings.SplitSeq(m[2], ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return Constraints{}, fmt.Errorf("invalid format %q: empty section name", format)
+		}
+		c.Sections = append(c.Sections, s)
+	}
+	return c, nil
+}
+
+// Empty checks if no constraints are set
+func (c Constraints) Empty() bool {
+	return c.Format == "" && len(c.Sections) == 0 && c.MaxWords == 0
+}
+
+// Instructions returns output instructions laid out in the style, empty if no constraints are set
+func (c Constraints) Instructions(style Style) string {
+	rules := c.rules()
+	if len(rules) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	switch style {
+	case StyleXML:
+		sb.WriteString("<output_requirements>\n")
+		for _, r := range rules {
+			sb.WriteString("- " + r + "\n")
+		}
+		sb.WriteString("</output_requirements>")
+	default:
+		sb.WriteString("## Output requirements\n\n")
+		for _, r := range rules {
+			sb.WriteString("- " + r + "\n")
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// rules returns the wording of constraints, a sentence per constraint
+func (c Constraints) rules() []string {
+	var res []string
+	if c.Format != "" {
+		res = append(res, "Format the answer as "+strings.TrimSuffix(c.Format, ".")+".")
+	}
+	if len(c.Sections) > 0 {
+		res = append(res, fmt.Sprintf("Organize the answer in exactly these sections, in this order, each starting "+
+			"with its header: %s. If a section has nothing to report, keep its header and say so.", strings.Join(c.Sections, ", ")))
+	}
+	if c.MaxWords > 0 {
+		res = append(res, fmt.Sprintf("Keep the whole answer under %d words.", c.MaxWords))
+	}
+	if len(res) > 0 && (c.Format != "" || len(c.Sections) > 0) {
+		res = append(res, "Don't add a preamble or closing remarks outside of this format.")
+	}
+	return res
+}
@@ -0,0 +1,59 @@
+package constraint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		words   int
+		want    Constraints
+		wantErr string
+	}{
+		{name: "empty", want: Constraints{}},
+		{name: "format only", format: " plain text ", want: Constraints{Format: "plain text"}},
+		{name: "format with sections", format: "markdown with sections: Summary, Issues , Suggestions", words: 300,
+			want: Constraints{Format: "markdown", Sections: []string{"Summary", "Issues", "Suggestions"}, MaxWords: 300}},
+		{name: "sections only", format: "Sections: Verdict, Details",
+			want: Constraints{Sections: []string{"Verdict", "Details"}}},
+		{name: "empty section", format: "markdown with sections: Summary,,Issues",
+			wantErr: `invalid format "markdown with sections: Summary,,Issues": empty section name`},
+		{name: "negative words", words: -1, wantErr: "max words can't be negative, got -1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.format, tt.words)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, c)
+		})
+	}
+}
+
+func TestConstraints_Instructions(t *testing.T) {
+	c, err := New("markdown with sections: Summary, Issues", 200)
+	require.NoError(t, err)
+	assert.False(t, c.Empty())
+
+	assert.Equal(t, "## Output requirements\n\n"+
+		"- Format the answer as markdown.\n"+
+		"- Organize the answer in exactly these sections, in this order, each starting with its header: Summary, Issues. "+
+		"If a section has nothing to report, keep its header and say so.\n"+
+		"- Keep the whole answer under 200 words.\n"+
+		"- Don't add a preamble or closing remarks outside of this format.", c.Instructions(StyleMarkdown))
+
+	c, err = New("", 50)
+	require.NoError(t, err)
+	assert.Equal(t, "<output_requirements>\n- Keep the whole answer under 50 words.\n</output_requirements>", c.Instructions(StyleXML))
+
+	assert.True(t, Constraints{}.Empty())
+	assert.Empty(t, Constraints{}.Instructions(StyleXML))
+}
@@ -0,0 +1,103 @@
+// Package drain tracks in-flight requests of server modes for graceful shutdown. On shutdown new requests
+// are rejected, in-flight ones get a grace period to complete, and requests still running after it are
+// canceled with ErrShutdown, so they can report partial results instead of being dropped.
+package drain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrShutdown is the cause of requests canceled by shutdown and the error of requests rejected while draining
+var ErrShutdown = errors.New("server is shutting down")
+
+// Tracker tracks in-flight requests, it is safe for concurrent use. The zero value is ready to use, and a nil
+// tracker accepts all requests without tracking them.
+type Tracker struct {
+	once   sync.Once
+	ctx    context.Context // canceled when the grace period expires
+	cancel context.CancelCauseFunc
+
+	mu       sync.Mutex
+	draining bool
+	wg       sync.WaitGroup
+}
+
+// New makes a tracker accepting requests
+func New() *Tracker {
+	return &Tracker{}
+}
+
+// init makes the context canceled when the grace period expires, once
+func (t *Tracker) init() {
+	t.once.Do(func() { t.ctx, t.cancel = context.WithCancelCause(context.Background()) })
+}
+
+// Acquire registers a request and returns its context, canceled with ErrShutdown cause if the request is
+// still running when the grace period expires. The returned func must be called when the request is done.
+// Returns ErrShutdown if the tracker is draining.
+func (t *Tracker) Acquire(ctx context.Context) (context.Context, func(), error) {
+	if t == nil {
+		return ctx, func() {}, nil
+	}
+	t.init()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return nil, nil, ErrShutdown
+	}
+	t.wg.Add(1)
+	reqCtx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(t.ctx, func() { cancel(context.Cause(t.ctx)) })
+	return reqCtx, func() {
+		stop()
+		cancel(nil)
+		t.wg.Done()
+	}, nil
+}
+
+// Draining checks if the tracker rejects new requests
+func (t *Tracker) Draining() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.draining
+}
+
+// Drain stops accepting requests and waits for in-flight ones up to the grace period. Requests running
+// after it are canceled, and Drain waits for them to complete. Returns false if any request was canceled.
+func (t *Tracker) Drain(grace time.Duration) bool {
+	if t == nil {
+		return true
+	}
+	t.init()
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+	}
+	t.cancel(ErrShutdown)
+	<-done
+	return false
+}
+
+// Canceled checks if the request of the context was canceled by shutdown
+func Canceled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrShutdown)
+}
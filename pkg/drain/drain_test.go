@@ -0,0 +1,79 @@
+package drain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracker_DrainWaitsForRequests(t *testing.T) {
+	tr := New()
+	ctx, done, err := tr.Acquire(context.Background())
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		done()
+	}()
+	st := time.Now()
+	assert.True(t, tr.Drain(time.Second))
+	assert.GreaterOrEqual(t, time.Since(st), 50*time.Millisecond)
+	assert.False(t, Canceled(ctx), "completed request is not canceled by shutdown")
+	assert.True(t, tr.Draining())
+
+	_, _, err = tr.Acquire(context.Background())
+	require.ErrorIs(t, err, ErrShutdown, "new requests are rejected while draining")
+}
+
+func TestTracker_DrainCancelsAfterGrace(t *testing.T) {
+	tr := New()
+	ctx, done, err := tr.Acquire(context.Background())
+	require.NoError(t, err)
+
+	go func() {
+		<-ctx.Done()
+		done()
+	}()
+	assert.False(t, tr.Drain(50*time.Millisecond))
+	require.Error(t, ctx.Err())
+	assert.True(t, Canceled(ctx))
+	assert.ErrorIs(t, context.Cause(ctx), ErrShutdown)
+}
+
+func TestTracker_DrainWithoutRequests(t *testing.T) {
+	tr := New()
+	assert.False(t, tr.Draining())
+	assert.True(t, tr.Drain(time.Minute))
+}
+
+func TestTracker_ParentCancel(t *testing.T) {
+	tr := New()
+	parent, cancel := context.WithCancel(context.Background())
+	ctx, done, err := tr.Acquire(parent)
+	require.NoError(t, err)
+	defer done()
+	cancel()
+	require.Error(t, ctx.Err())
+	assert.False(t, Canceled(ctx), "canceled by the parent, not by shutdown")
+}
+
+func TestTracker_NilAndZero(t *testing.T) {
+	var nilTracker *Tracker
+	ctx, done, err := nilTracker.Acquire(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, ctx.Err())
+	done()
+	assert.False(t, nilTracker.Draining())
+	assert.True(t, nilTracker.Drain(time.Millisecond))
+
+	var zero Tracker
+	_, done, err = zero.Acquire(context.Background())
+	require.NoError(t, err)
+	done()
+	assert.True(t, zero.Drain(time.Second))
+	_, _, err = zero.Acquire(context.Background())
+	require.ErrorIs(t, err, ErrShutdown)
+}
@@ -0,0 +1,127 @@
+// Package environ captures a snapshot of the runtime environment, like OS, versions of project tools and git state,
+// included in the prompt as context for "why does this fail on my machine" questions. Secrets are redacted from
+// the snapshot, see Redact.
+package environ
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+
+	"github.com/umputun/mpt/pkg/files"
+)
+
+// commandTimeout bounds each command run to capture the snapshot, so a hanging tool doesn't block the prompt
+const commandTimeout = 5 * time.Second
+
+// Capturer captures the snapshot of the environment of the project directory
+type Capturer struct {
+	dir        string
+	ecosystems []files.Ecosystem
+	secrets    []string
+	getenv     func(string) string
+	run        func(ctx context.Context, dir, name string, args ...string) (string, error)
+}
+
+// New makes a capturer of the environment of the project directory, the current directory if empty. Versions of
+// tools of the ecosystems are captured, and the secrets are redacted in addition to the secret-like values.
+func New(dir string, ecosystems []files.Ecosystem, secrets []string) *Capturer {
+	return &Capturer{dir: dir, ecosystems: ecosystems, secrets: secrets, getenv: os.Getenv, run: runCommand}
+}
+
+// Capture returns the redacted snapshot of the environment as "name: value" lines. Values which can't be
+// captured, like versions of missing tools, are reported as "not found" or skipped.
+func (c *Capturer) Capture(ctx context.Context) string {
+	var lines []string
+	add := func(name, value string) {
+		if value != "" {
+			lines = append(lines, name+": "+value)
+		}
+	}
+
+	add("os", runtime.GOOS+"/"+runtime.GOARCH)
+	if runtime.GOOS != "windows" {
+		add("kernel", c.output(ctx, "uname", "-sr"))
+	}
+	add("distribution", osRelease())
+	if shell := c.getenv("SHELL"); shell != "" {
+		add("shell", filepath.Base(shell))
+	}
+
+	for _, e := range c.ecosystems {
+		for _, tool := range e.Tools {
+			args := strings.Fields(tool)
+			version, _, _ := strings.Cut(c.output(ctx, args[0], args[1:]...), "\n") // like terraform, with update notes
+			if version == "" {
+				version = "not found"
+			}
+			add(args[0], version)
+		}
+	}
+
+	if branch := c.output(ctx, "git", "rev-parse", "--abbrev-ref", "HEAD"); branch != "" {
+		add("git branch", branch)
+		commit := c.output(ctx, "git", "rev-parse", "--short", "HEAD")
+		if status := c.output(ctx, "git", "status", "--porcelain"); status != "" {
+			commit += fmt.Sprintf(" (%d uncommitted changes)", len(strings.Split(status, "\n")))
+		}
+		add("git commit", commit)
+		add("git remote", c.output(ctx, "git", "remote", "get-url", "origin"))
+	}
+
+	return Redact(strings.Join(lines, "\n"), c.home(), c.secrets)
+}
+
+// output runs the command in the directory and returns its trimmed output, empty if it failed
+func (c *Capturer) output(ctx context.Context, name string, args ...string) string {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+	out, err := c.run(ctx, c.dir, name, args...)
+	if err != nil {
+		lgr.Printf("[DEBUG] can't capture %s %s: %v", name, strings.Join(args, " "), err)
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// home returns the home directory of the user, replaced with ~ in the snapshot
+func (c *Capturer) home() string {
+	if home := c.getenv("HOME"); home != "" {
+		return home
+	}
+	return c.getenv("USERPROFILE")
+}
+
+// osRelease returns the pretty name of Linux distribution from /etc/os-release, empty if not available
+func osRelease() string {
+	data, err := os.ReadFile("/etc/os-release")
+	if err != nil {
+		return ""
+	}
+	for line := range strings.SplitSeq(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "PRETTY_NAME="); ok {
+			return strings.Trim(v, `"'`)
+		}
+	}
+	return ""
+}
+
+// runCommand runs the command in the directory and returns its output
+func runCommand(ctx context.Context, dir, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...) //nolint:gosec // fixed version and git commands
+	cmd.Dir = dir
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
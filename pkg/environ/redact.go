@@ -0,0 +1,40 @@
+package environ
+
+import (
+	"regexp"
+	"strings"
+)
+
+// redacted replaces secrets in the snapshot
+const redacted = "[REDACTED]"
+
+// redactions are rules redacting secret-like values: credentials of URLs, values of sensitive assignments
+// and tokens of well-known formats
+var redactions = []struct {
+	re      *regexp.Regexp
+	replace string
+}{
+	{re: regexp.MustCompile(`(\b[a-zA-Z][a-zA-Z0-9+.-]*://)[^/\s@]+@`), replace: "${1}" + redacted + "@"},
+	{re: regexp.MustCompile(`(?i)\b([\w.-]*(?:key|token|secret|passw(?:or)?d|pwd|credential|auth)[\w.-]*)(\s*[=:]\s*)[^\s,;]+`),
+		replace: "${1}${2}" + redacted},
+	{re: regexp.MustCompile(`\b(?:sk-[\w-]{16,}|gh[pousr]_[A-Za-z0-9]{20,}|github_pat_\w{20,}|glpat-[\w-]{20,}|` +
+		`AKIA[0-9A-Z]{16}|AIza[\w-]{35}|xox[abprs]-[\w-]{10,}|eyJ[\w-]{10,}\.[\w-]{10,}\.[\w-]{10,})`), replace: redacted},
+}
+
+// Redact removes secrets from the text: the known secrets, credentials of URLs, values assigned to names like
+// "token" or "password", and tokens of well-known formats like OpenAI and GitHub keys. The home directory
+// is replaced with ~, as it usually has the user name.
+func Redact(text, home string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, redacted)
+		}
+	}
+	for _, r := range redactions {
+		text = r.re.ReplaceAllString(text, r.replace)
+	}
+	if home != "" && home != "/" {
+		text = strings.ReplaceAll(text, home, "~")
+	}
+	return text
+}
@@ -0,0 +1,176 @@
+package files
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// Ecosystem defines default excludes and summarized files of projects of a language ecosystem, like Go or Node.js.
+// Ecosystems are detected by marker files in the project directory, see ResolveEcosystems.
+type Ecosystem struct {
+	Name      string
+	Markers   []string                       // glob patterns of files in the project directory marking the ecosystem
+	Excludes  []string                       // patterns of generated files, caches and lock files excluded by default
+	Summaries map[string]func(string) string // base names of files with content replaced by a summary
+	Tools     []string                       // commands printing versions of tools of the ecosystem, like "go version"
+}
+
+// Ecosystems are the supported language ecosystems
+var Ecosystems = []Ecosystem{
+	{
+		Name:      "go",
+		Markers:   []string{"go.mod", "go.work"},
+		Excludes:  []string{"**/coverage.out", "**/*.coverprofile", "**/*.test", "**/*.pprof"},
+		Summaries: map[string]func(string) string{"go.sum": summarizeGoSum},
+		Tools:     []string{"go version"},
+	},
+	{
+		Name:    "node",
+		Markers: []string{"package.json"},
+		Excludes: []string{"**/.next/**", "**/.nuxt/**", "**/.turbo/**", "**/.parcel-cache/**", "**/coverage/**",
+			"**/package-lock.json", "**/yarn.lock", "**/pnpm-lock.yaml", "**/*.min.js", "**/*.min.css", "**/*.map"},
+		Tools: []string{"node --version", "npm --version"},
+	},
+	{
+		Name:    "python",
+		Markers: []string{"pyproject.toml", "setup.py", "requirements.txt"},
+		Excludes: []string{"**/.pytest_cache/**", "**/.mypy_cache/**", "**/.ruff_cache/**", "**/.tox/**",
+			"**/*.egg-info/**", "**/htmlcov/**", "**/.coverage", "**/poetry.lock", "**/uv.lock"},
+		Tools: []string{"python3 --version", "pip3 --version"},
+	},
+	{
+		Name:      "rust",
+		Markers:   []string{"Cargo.toml"},
+		Summaries: map[string]func(string) string{"Cargo.lock": summarizeCargoLock},
+		Tools:     []string{"rustc --version", "cargo --version"},
+	},
+	{
+		Name:     "terraform",
+		Markers:  []string{"*.tf"},
+		Excludes: []string{"**/.terraform/**", "**/*.tfstate", "**/*.tfstate.backup", "**/*.tfplan"},
+		Tools:    []string{"terraform version"},
+	},
+}
+
+// ResolveEcosystems returns ecosystems by names. Name "auto" detects ecosystems by marker files in dir,
+// or the current directory if dir is empty, and "none" disables them.
+func ResolveEcosystems(names []string, dir string) ([]Ecosystem, error) {
+	var res []Ecosystem
+	add := func(e Ecosystem) {
+		if !slices.ContainsFunc(res, func(r Ecosystem) bool { return r.Name == e.Name }) {
+			res = append(res, e)
+		}
+	}
+	for _, name := range names {
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case "none":
+			if len(names) > 1 {
+				return nil, fmt.Errorf("ecosystem none can't be combined with other ecosystems")
+			}
+			return nil, nil
+		case "auto":
+			for _, e := range detectEcosystems(dir) {
+				add(e)
+			}
+		default:
+			i := slices.IndexFunc(Ecosystems, func(e Ecosystem) bool { return e.Name == name })
+			if i < 0 {
+				return nil, fmt.Errorf("unknown ecosystem %q, supported: auto, none, %s", name, strings.Join(ecosystemNames(), ", "))
+			}
+			add(Ecosystems[i])
+		}
+	}
+	return res, nil
+}
+
+// detectEcosystems returns ecosystems with marker files in dir
+func detectEcosystems(dir string) []Ecosystem {
+	var res []Ecosystem
+	for _, e := range Ecosystems {
+		for _, marker := range e.Markers {
+			if matches, err := filepath.Glob(filepath.Join(dir, marker)); err == nil && len(matches) > 0 {
+				res = append(res, e)
+				break
+			}
+		}
+	}
+	if len(res) > 0 {
+		names := make([]string, 0, len(res))
+		for _, e := range res {
+			names = append(names, e.Name)
+		}
+		lgr.Printf("[DEBUG] detected project ecosystems: %s", strings.Join(names, ", "))
+	}
+	return res
+}
+
+// ecosystemNames returns names of supported ecosystems
+func ecosystemNames() []string {
+	res := make([]string, 0, len(Ecosystems))
+	for _, e := range Ecosystems {
+		res = append(res, e.Name)
+	}
+	return res
+}
+
+// ecosystemExcludes returns default excludes of the ecosystems
+func ecosystemExcludes(ecosystems []Ecosystem) []string {
+	var res []string
+	for _, e := range ecosystems {
+		res = append(res, e.Excludes...)
+	}
+	return res
+}
+
+// summarize returns the summary of the file content if the file is summarized by any of the ecosystems,
+// or the content as is
+func summarize(ecosystems []Ecosystem, file, content string) string {
+	for _, e := range ecosystems {
+		if fn, ok := e.Summaries[filepath.Base(file)]; ok {
+			return fn(content)
+		}
+	}
+	return content
+}
+
+// summarizeGoSum returns modules and versions of go.sum, without checksums and go.mod entries
+func summarizeGoSum(content string) string {
+	var sb strings.Builder
+	sb.WriteString("# summary of go.sum: module versions, checksums omitted\n")
+	for line := range strings.SplitSeq(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		sb.WriteString(fields[0] + " " + fields[1] + "\n")
+	}
+	return sb.String()
+}
+
+// summarizeCargoLock returns names and versions of packages of Cargo.lock, without sources and checksums
+func summarizeCargoLock(content string) string {
+	var sb strings.Builder
+	sb.WriteString("# summary of Cargo.lock: package versions, sources and checksums omitted\n")
+	var name string
+	for line := range strings.SplitSeq(content, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " = ")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"`)
+		switch key {
+		case "name":
+			name = value
+		case "version":
+			if name != "" {
+				sb.WriteString(name + " " + value + "\n")
+				name = ""
+			}
+		}
+	}
+	return sb.String()
+}
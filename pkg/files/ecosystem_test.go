@@ -0,0 +1,116 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveEcosystems(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte("provider \"aws\" {}\n"), 0o600))
+
+	names := func(ecosystems []Ecosystem) []string {
+		res := []string{}
+		for _, e := range ecosystems {
+			res = append(res, e.Name)
+		}
+		return res
+	}
+
+	res, err := ResolveEcosystems([]string{"auto"}, dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "terraform"}, names(res))
+
+	res, err = ResolveEcosystems([]string{"auto", "Node", "go"}, dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "terraform", "node"}, names(res), "detected combined with given, without duplicates")
+
+	res, err = ResolveEcosystems([]string{"auto"}, t.TempDir())
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	res, err = ResolveEcosystems([]string{"none"}, dir)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	res, err = ResolveEcosystems(nil, dir)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	_, err = ResolveEcosystems([]string{"none", "go"}, dir)
+	require.EqualError(t, err, "ecosystem none can't be combined with other ecosystems")
+
+	_, err = ResolveEcosystems([]string{"java"}, dir)
+	require.EqualError(t, err, `unknown ecosystem "java", supported: auto, none, go, node, python, rust, terraform`)
+}
+
+func TestEcosystem_Excludes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o750))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	write("package.json", `{"name": "app"}`)
+	write("package-lock.json", `{"lockfileVersion": 3}`)
+	write("src/app.js", "console.log(1)")
+	write("dist.min.js", "x")
+	write(".next/cache.js", "x")
+	write("coverage/lcov.info", "x")
+	write(".mptignore", "!coverage/lcov.info\n")
+
+	ecosystems, err := ResolveEcosystems([]string{"auto"}, dir)
+	require.NoError(t, err)
+	matched, err := MatchFiles(context.Background(), LoadRequest{Patterns: []string{"./..."}, Dir: dir,
+		Ecosystems: ecosystems, MaxFileSize: DefaultMaxFileSize})
+	require.NoError(t, err)
+	var rel []string
+	for _, f := range matched {
+		r, err := filepath.Rel(dir, f)
+		require.NoError(t, err)
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	assert.Equal(t, []string{".mptignore", "coverage/lcov.info", "package.json", "src/app.js"}, rel,
+		"default excludes applied, re-included by .mptignore")
+
+	matched, err = MatchFiles(context.Background(), LoadRequest{Patterns: []string{"./..."}, Dir: dir,
+		MaxFileSize: DefaultMaxFileSize})
+	require.NoError(t, err)
+	assert.Len(t, matched, 7, "nothing excluded without ecosystems")
+}
+
+func TestEcosystem_Summaries(t *testing.T) {
+	dir := t.TempDir()
+	goSum := "github.com/a/b v1.2.0 h1:abc=\ngithub.com/a/b v1.2.0/go.mod h1:def=\ngolang.org/x/sys v0.1.0 h1:ghi=\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.sum"), []byte(goSum), 0o600))
+	cargoLock := "version = 3\n\n[[package]]\nname = \"serde\"\nversion = \"1.0.1\"\nsource = \"registry\"\n" +
+		"checksum = \"abc\"\n\n[[package]]\nname = \"app\"\nversion = \"0.1.0\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Cargo.lock"), []byte(cargoLock), 0o600))
+
+	ecosystems, err := ResolveEcosystems([]string{"go", "rust"}, dir)
+	require.NoError(t, err)
+	res, err := LoadFiles(context.Background(), LoadRequest{Patterns: []string{filepath.Join(dir, "*")}, Dir: dir,
+		MaxFileSize: DefaultMaxFileSize, Ecosystems: ecosystems})
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "# summary of Cargo.lock: package versions, sources and checksums omitted\nserde 1.0.1\napp 0.1.0\n",
+		res[0].Content)
+	assert.Equal(t, "# summary of go.sum: module versions, checksums omitted\ngithub.com/a/b v1.2.0\ngolang.org/x/sys v0.1.0\n",
+		res[1].Content)
+
+	content, err := LoadContent(context.Background(), LoadRequest{Patterns: []string{filepath.Join(dir, "go.sum")}, Dir: dir,
+		MaxFileSize: DefaultMaxFileSize, Ecosystems: ecosystems})
+	require.NoError(t, err)
+	assert.Contains(t, content, "github.com/a/b v1.2.0\n")
+	assert.NotContains(t, content, "h1:")
+
+	res, err = LoadFiles(context.Background(), LoadRequest{Patterns: []string{filepath.Join(dir, "go.sum")}, Dir: dir,
+		MaxFileSize: DefaultMaxFileSize})
+	require.NoError(t, err)
+	assert.Equal(t, goSum, res[0].Content, "not summarized without ecosystems")
+}
@@ -0,0 +1,94 @@
+package files
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// encodings of text files detected by decodeText
+const (
+	encodingUTF8    = "utf-8"
+	encodingUTF16LE = "utf-16le"
+	encodingUTF16BE = "utf-16be"
+	encodingLatin1  = "latin-1"
+)
+
+// sniffSize is the size of the content prefix inspected to detect binary files
+const sniffSize = 8000
+
+// maxControlRatio is the max share of control characters in the sniffed prefix of a text file
+const maxControlRatio = 0.1
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// decodeText detects the encoding of the file content and converts it to UTF-8. UTF-8 content is returned
+// as is, without BOM, UTF-16 with BOM is transcoded, and content which is not valid UTF-8 is treated as
+// Latin-1 (ISO-8859-1). isBin is set for content which doesn't look like text, see isBinary.
+func decodeText(content []byte) (text []byte, encoding string, isBin bool) {
+	switch {
+	case bytes.HasPrefix(content, bomUTF8):
+		content = content[len(bomUTF8):]
+	case bytes.HasPrefix(content, bomUTF16LE):
+		text = decodeUTF16(content[len(bomUTF16LE):], false)
+		return text, encodingUTF16LE, isBinary(text)
+	case bytes.HasPrefix(content, bomUTF16BE):
+		text = decodeUTF16(content[len(bomUTF16BE):], true)
+		return text, encodingUTF16BE, isBinary(text)
+	}
+
+	if isBinary(content) {
+		return nil, "", true
+	}
+	if utf8.Valid(content) {
+		return content, encodingUTF8, false
+	}
+	return decodeLatin1(content), encodingLatin1, false
+}
+
+// decodeUTF16 converts UTF-16 content without BOM to UTF-8, a trailing odd byte is dropped
+func decodeUTF16(content []byte, bigEndian bool) []byte {
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		units[i] = order.Uint16(content[2*i:])
+	}
+	buf := make([]byte, 0, len(content))
+	for _, r := range utf16.Decode(units) {
+		buf = utf8.AppendRune(buf, r)
+	}
+	return buf
+}
+
+// decodeLatin1 converts Latin-1 content to UTF-8, each byte is the code point of the character
+func decodeLatin1(content []byte) []byte {
+	buf := make([]byte, 0, len(content)+len(content)/4)
+	for _, b := range content {
+		buf = utf8.AppendRune(buf, rune(b))
+	}
+	return buf
+}
+
+// isBinary checks the beginning of content for NUL bytes, the same heuristic git uses, and for a high share
+// of control characters not used in text files, like in images or archives without NUL bytes in the prefix.
+func isBinary(content []byte) bool {
+	prefix := content[:min(len(content), sniffSize)]
+	if bytes.IndexByte(prefix, 0) >= 0 {
+		return true
+	}
+	controls := 0
+	for _, b := range prefix {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' && b != '\v' && b != '\b' && b != 0x1b {
+			controls++
+		}
+	}
+	return len(prefix) > 0 && float64(controls)/float64(len(prefix)) > maxControlRatio
+}
@@ -0,0 +1,58 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      []byte
+		wantText     string
+		wantEncoding string
+		wantBinary   bool
+	}{
+		{name: "utf-8", content: []byte("привет"), wantText: "привет", wantEncoding: "utf-8"},
+		{name: "utf-8 with bom", content: []byte("\xEF\xBB\xBFhello"), wantText: "hello", wantEncoding: "utf-8"},
+		{name: "empty", content: nil, wantText: "", wantEncoding: "utf-8"},
+		{name: "utf-16le with bom", content: []byte{0xFF, 0xFE, 'h', 0, 'i', 0, 0x3F, 0x04}, wantText: "hiп", wantEncoding: "utf-16le"},
+		{name: "utf-16be with bom", content: []byte{0xFE, 0xFF, 0, 'h', 0, 'i', 0xD8, 0x3D, 0xDE, 0x00}, wantText: "hi😀", wantEncoding: "utf-16be"},
+		{name: "utf-16 odd length", content: []byte{0xFF, 0xFE, 'h', 0, 'i'}, wantText: "h", wantEncoding: "utf-16le"},
+		{name: "latin-1", content: []byte("caf\xe9 na\xefve"), wantText: "café naïve", wantEncoding: "latin-1"},
+		{name: "binary with nul", content: []byte("\x7fELF\x02\x01\x00"), wantBinary: true},
+		{name: "utf-16 without bom is binary", content: []byte{'h', 0, 'i', 0}, wantBinary: true},
+		{name: "utf-16 binary content", content: []byte{0xFF, 0xFE, 0, 0, 1, 0}, wantBinary: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, encoding, isBin := decodeText(tt.content)
+			assert.Equal(t, tt.wantBinary, isBin)
+			if tt.wantBinary {
+				return
+			}
+			assert.Equal(t, tt.wantText, string(text))
+			assert.Equal(t, tt.wantEncoding, encoding)
+		})
+	}
+}
+
+func TestLoadContent_Encodings(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "latin1.txt"), []byte("r\xe9sum\xe9"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "utf16.txt"), []byte{0xFF, 0xFE, 'o', 0, 'k', 0}, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "image.dat"), []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0o600))
+
+	content, err := LoadContent(context.Background(), LoadRequest{Patterns: []string{"**/*"}, Dir: dir, MaxFileSize: DefaultMaxFileSize})
+	require.NoError(t, err)
+	assert.Contains(t, content, "résumé")
+	assert.Contains(t, content, "utf16.txt")
+	assert.Contains(t, content, "ok")
+	assert.NotContains(t, content, "image.dat", "binary file skipped by content")
+	assert.NotContains(t, content, "PNG")
+}
@@ -2,11 +2,15 @@
 package files
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"sync/atomic"
 
 	"github.com/bmatcuk/doublestar/v4"
 	"github.com/go-pkgz/lgr"
@@ -15,12 +19,28 @@ import (
 // DefaultMaxFileSize defines the default maximum size of individual files to process (64KB)
 const DefaultMaxFileSize = 64 * 1024
 
+// traceMatching enables logging of the exclude pattern deciding each file, set with EnableTrace
+var traceMatching atomic.Bool
+
+// EnableTrace sets logging of the exclude pattern excluding or re-including each file at TRACE level.
+// It's off by default, as the log is large for big directory trees.
+func EnableTrace(enabled bool) {
+	traceMatching.Store(enabled)
+}
+
 // LoadRequest holds the parameters for loading file content
 type LoadRequest struct {
-	Patterns        []string // file patterns to include
-	ExcludePatterns []string // patterns to exclude from file matching
-	MaxFileSize     int64    // maximum size of individual files to process
-	Force           bool     // force loading files by skipping all exclusion patterns
+	Patterns          []string    // file patterns to include
+	ExcludePatterns   []string    // patterns to exclude from file matching
+	MaxFileSize       int64       // maximum size of individual files to process
+	Force             bool        // force loading files by skipping all exclusion patterns
+	FollowSymlinks    bool        // follow symlinked directories, with loop detection
+	IncludeSubmodules bool        // include files from git submodules
+	Dir               string      // directory of relative patterns, ignore files and file headers, current directory if empty
+	Workers           int         // number of workers reading files concurrently, DefaultWorkers if not set
+	Wrapper           Wrapper     // how file contents are wrapped, plain comment headers if empty
+	Ecosystems        []Ecosystem // ecosystems of the project, adding default excludes and file summaries
+	Changed           []string    // absolute paths of changed files matched files are limited to, not limited if nil
 }
 
 // ExclusionRequest holds the parameters for checking if a file should be excluded
@@ -33,21 +53,88 @@ type ExclusionRequest struct {
 
 // PatternRequest holds the parameters for pattern processing functions
 type PatternRequest struct {
-	Pattern      string              // pattern to process
-	MatchedFiles map[string]struct{} // map to store matched file paths
-	MaxFileSize  int64               // maximum size of individual files to process
+	Pattern           string              // pattern to process
+	MatchedFiles      map[string]struct{} // map to store matched file paths
+	MaxFileSize       int64               // maximum size of individual files to process
+	FollowSymlinks    bool                // follow symlinked directories
+	IncludeSubmodules bool                // include files from git submodules
+}
+
+// walkOptions returns directory traversal options for the pattern request
+func (r PatternRequest) walkOptions() walkOptions {
+	return walkOptions{followSymlinks: r.FollowSymlinks, includeSubmodules: r.IncludeSubmodules}
 }
 
 // LoadContent loads content from files matching the given patterns and returns a formatted string
-// with file names as comments and their contents. Supports recursive directory traversal.
+// with file names as comments (or other wrapper of the request) and their contents. Supports recursive directory traversal.
 // Exclude patterns can be provided to filter out unwanted files.
-// Git ignore patterns from .gitignore files are automatically respected.
+// Git ignore patterns from .gitignore and .mptignore files are automatically respected.
 // If force is true, all exclusion patterns (including .gitignore and common patterns) are skipped.
-func LoadContent(req LoadRequest) (string, error) {
+// Patterns with selectors, like "main.go:100-250" or "pkg/...:func=Name", include only selected lines,
+// with the line range in the file header. Walking directories and reading files stop once the context is done.
+func LoadContent(ctx context.Context, req LoadRequest) (string, error) {
 	if len(req.Patterns) == 0 {
 		return "", nil
 	}
 
+	plain, selections, err := splitSelectors(req.Patterns)
+	if err != nil {
+		return "", err
+	}
+
+	var content string
+	whole := make(map[string]bool)
+	if len(plain) > 0 {
+		r := req
+		r.Patterns = plain
+		sortedFiles, err := MatchFiles(ctx, r)
+		if err != nil {
+			return "", err
+		}
+		for _, f := range sortedFiles {
+			whole[f] = true
+		}
+
+		// format and combine file contents
+		if content, err = formatFileContents(ctx, sortedFiles, req.Dir, req.Workers, req.Wrapper, req.Ecosystems); err != nil {
+			return "", err
+		}
+	}
+	if len(selections) == 0 {
+		return content, nil
+	}
+
+	chunks, err := loadSelections(ctx, req, selections, whole)
+	if err != nil {
+		return "", err
+	}
+	selected, err := FormatChunks(chunks, req.Dir, req.Wrapper)
+	if err != nil {
+		return "", err
+	}
+	return content + selected, nil
+}
+
+// MatchFiles returns sorted list of files matching the given patterns, with exclusions applied
+// the same way as LoadContent does. Selectors of patterns are ignored, files are matched as a whole.
+// Returns an error if no files matched, or the error of the context if it is done while matching.
+func MatchFiles(ctx context.Context, req LoadRequest) ([]string, error) {
+	if len(req.Patterns) == 0 {
+		return nil, nil
+	}
+
+	patterns, err := stripSelectors(req.Patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	// bring patterns to the forward-slash form expected by all matchers
+	req.Patterns = normalizePatterns(patterns)
+	req.ExcludePatterns = normalizePatterns(req.ExcludePatterns)
+	if req.Dir != "" {
+		req.Patterns = resolvePatterns(req.Dir, req.Patterns)
+	}
+
 	// check if all patterns are concrete file paths (no wildcards)
 	if !req.Force && allConcretePaths(req.Patterns) {
 		lgr.Printf("[DEBUG] all patterns are concrete file paths, enabling force mode automatically")
@@ -57,7 +144,7 @@ func LoadContent(req LoadRequest) (string, error) {
 	// prepare all exclude patterns
 	var allExcludePatterns []string
 	if !req.Force {
-		allExcludePatterns = prepareExcludePatterns(req.ExcludePatterns)
+		allExcludePatterns = prepareExcludePatterns(req.ExcludePatterns, req.Dir, req.Ecosystems)
 	} else {
 		lgr.Printf("[DEBUG] force mode enabled, skipping all exclusion patterns")
 	}
@@ -69,53 +156,94 @@ func LoadContent(req LoadRequest) (string, error) {
 	for _, pattern := range req.Patterns {
 		// process different types of patterns
 		patternReq := PatternRequest{
-			Pattern:      pattern,
-			MatchedFiles: matchedFiles,
-			MaxFileSize:  req.MaxFileSize,
+			Pattern:           pattern,
+			MatchedFiles:      matchedFiles,
+			MaxFileSize:       req.MaxFileSize,
+			FollowSymlinks:    req.FollowSymlinks,
+			IncludeSubmodules: req.IncludeSubmodules,
 		}
 		switch {
 		case strings.Contains(pattern, "**"):
 			// bash-style patterns with **
-			if err := processBashStylePattern(patternReq); err != nil {
-				return "", err
+			if err := processBashStylePattern(ctx, patternReq); err != nil {
+				return nil, err
 			}
 		case strings.Contains(pattern, "/..."):
 			// go-style recursive pattern: dir/...
-			if err := processGoStylePattern(patternReq); err != nil {
-				return "", err
+			if err := processGoStylePattern(ctx, patternReq); err != nil {
+				return nil, err
 			}
 		default:
 			// standard glob pattern
-			if err := processStandardGlobPattern(patternReq); err != nil {
-				return "", err
+			if err := processStandardGlobPattern(ctx, patternReq); err != nil {
+				return nil, err
 			}
 		}
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// track original count before exclusions
 	originalCount := len(matchedFiles)
 
 	// apply exclusion patterns if any
-	matchedFiles = applyExcludePatterns(matchedFiles, allExcludePatterns)
+	matchedFiles = applyExcludePatterns(matchedFiles, allExcludePatterns, req.Dir)
 	excludedCount := originalCount - len(matchedFiles)
 
+	if req.Changed != nil {
+		matchedFiles = limitToChanged(matchedFiles, req.Changed)
+		if len(matchedFiles) == 0 && originalCount-excludedCount > 0 {
+			return nil, fmt.Errorf("none of %d matched files is among %d changed files", originalCount-excludedCount, len(req.Changed))
+		}
+	}
+
 	// get sorted list of files
 	sortedFiles := getSortedFiles(matchedFiles)
 	if len(sortedFiles) == 0 {
 		// check if we should report file size errors
 		if err := checkFileSizeErrors(req.Patterns, req.ExcludePatterns, req.MaxFileSize); err != nil {
-			return "", err
+			return nil, err
 		}
 
 		// provide helpful error message based on what happened
 		if excludedCount > 0 && !req.Force {
-			return "", fmt.Errorf("no files matched after exclusions (excluded %d files). Files may be ignored by .gitignore or common patterns (vendor/**, node_modules/**, etc). Use --force to skip exclusions", excludedCount)
+			return nil, fmt.Errorf("no files matched after exclusions (excluded %d files). Files may be ignored by .gitignore, .mptignore or common patterns (vendor/**, node_modules/**, etc). Use --force to skip exclusions", excludedCount)
 		}
-		return "", fmt.Errorf("no files matched the provided patterns. Try a different pattern such as \"./.../*.go\" or \"./**/*.go\" for recursive matching")
+		return nil, fmt.Errorf("no files matched the provided patterns. Try a different pattern such as \"./.../*.go\" or \"./**/*.go\" for recursive matching")
 	}
 
-	// format and combine file contents
-	return formatFileContents(sortedFiles)
+	return sortedFiles, nil
+}
+
+// limitToChanged returns matched files which are in the list of changed files. Paths are compared
+// in absolute form with symlinks resolved, so relative patterns match paths reported by git.
+func limitToChanged(matchedFiles map[string]struct{}, changed []string) map[string]struct{} {
+	changedSet := make(map[string]struct{}, len(changed))
+	for _, f := range changed {
+		changedSet[realPath(f)] = struct{}{}
+	}
+	res := make(map[string]struct{}, len(matchedFiles))
+	for f := range matchedFiles {
+		if _, ok := changedSet[realPath(f)]; ok {
+			res[f] = struct{}{}
+		}
+	}
+	lgr.Printf("[DEBUG] %d of %d matched files are changed", len(res), len(matchedFiles))
+	return res
+}
+
+// realPath returns the absolute path with symlinks resolved, or the path as is if it can't be resolved
+func realPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
 }
 
 // checkFileSizeErrors checks if any direct file paths were skipped due to size limits
@@ -139,40 +267,45 @@ func checkFileSizeErrors(patterns, excludePatterns []string, maxFileSize int64)
 	return nil
 }
 
-// processBashStylePattern handles patterns with ** using the doublestar library
-func processBashStylePattern(req PatternRequest) error {
-	fsys := os.DirFS(".")
-	matches, err := doublestar.Glob(fsys, req.Pattern)
-	if err != nil {
-		return fmt.Errorf("failed to glob doublestar pattern %s: %w", req.Pattern, err)
+// processBashStylePattern handles patterns with ** using the doublestar library.
+// The pattern is split into a static base directory and the glob part, so absolute patterns,
+// including drive-letter ones on Windows, are matched as well as relative ones.
+// The base directory is walked with symlink and submodule handling defined by the request.
+func processBashStylePattern(ctx context.Context, req PatternRequest) error {
+	pattern := filepath.ToSlash(filepath.Clean(req.Pattern))
+	if !doublestar.ValidatePattern(pattern) {
+		return fmt.Errorf("failed to glob doublestar pattern %s: %w", req.Pattern, doublestar.ErrBadPattern)
 	}
+	base, glob := doublestar.SplitPattern(pattern)
+	basePath := filepath.FromSlash(base)
 
-	if len(matches) == 0 {
+	if info, err := os.Stat(basePath); err != nil || !info.IsDir() {
 		lgr.Printf("[WARN] no files matched pattern: %s", req.Pattern)
 		return nil
 	}
 
 	matchCount := 0
-	for _, match := range matches {
-		// convert back to absolute path
-		absPath := filepath.Join(".", match)
-
-		// check if it's a file
-		info, err := os.Stat(absPath)
+	err := walkFiles(ctx, basePath, req.walkOptions(), func(path string, info os.FileInfo) {
+		relPath, err := filepath.Rel(basePath, path)
 		if err != nil {
-			return fmt.Errorf("failed to stat file %s: %w", absPath, err)
+			return
 		}
-
-		if !info.IsDir() {
-			// skip files that exceed the size limit
-			if info.Size() > req.MaxFileSize {
-				lgr.Printf("[WARN] file %s exceeds size limit (%d bytes), skipping", absPath, info.Size())
-				continue
-			}
-
-			req.MatchedFiles[absPath] = struct{}{}
-			matchCount++
+		if matched, _ := doublestar.Match(glob, filepath.ToSlash(relPath)); !matched {
+			return
 		}
+		// skip files that exceed the size limit
+		if info.Size() > req.MaxFileSize {
+			lgr.Printf("[WARN] file %s exceeds size limit (%d bytes), skipping", path, info.Size())
+			return
+		}
+		req.MatchedFiles[path] = struct{}{}
+		matchCount++
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		lgr.Printf("[WARN] failed to walk directory for pattern %s: %v", req.Pattern, err)
 	}
 
 	if matchCount == 0 {
@@ -184,9 +317,10 @@ func processBashStylePattern(req PatternRequest) error {
 	return nil
 }
 
-// processGoStylePattern handles patterns with /... using filepath.Walk
-func processGoStylePattern(req PatternRequest) error {
+// processGoStylePattern handles patterns with /... by walking the base directory
+func processGoStylePattern(ctx context.Context, req PatternRequest) error {
 	basePath, filter := parseRecursivePattern(req.Pattern)
+	basePath = filepath.FromSlash(basePath)
 
 	// check if base directory exists
 	info, err := os.Stat(basePath)
@@ -197,32 +331,28 @@ func processGoStylePattern(req PatternRequest) error {
 
 	// walk the directory tree filtering by the specified pattern
 	matchCount := 0
-	err = filepath.Walk(basePath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // skip files that can't be accessed
-		}
-
-		if info.IsDir() || info.Size() > req.MaxFileSize {
-			if info.Size() > req.MaxFileSize {
-				lgr.Printf("[WARN] file %s exceeds size limit (%d bytes), skipping", path, info.Size())
-			}
-			return nil
+	err = walkFiles(ctx, basePath, req.walkOptions(), func(path string, info os.FileInfo) {
+		if info.Size() > req.MaxFileSize {
+			lgr.Printf("[WARN] file %s exceeds size limit (%d bytes), skipping", path, info.Size())
+			return
 		}
 
 		if filter == "" || (strings.HasPrefix(filter, "*.") && strings.HasSuffix(path, filter[1:])) {
 			req.MatchedFiles[path] = struct{}{}
 			matchCount++
-			return nil
+			return
 		}
 
 		if matched, _ := filepath.Match(filter, filepath.Base(path)); matched {
 			req.MatchedFiles[path] = struct{}{}
 			matchCount++
 		}
-		return nil
 	})
 
 	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		lgr.Printf("[WARN] failed to walk directory for pattern %s: %v", req.Pattern, err)
 	}
 
@@ -236,7 +366,7 @@ func processGoStylePattern(req PatternRequest) error {
 }
 
 // processStandardGlobPattern handles standard glob patterns using filepath.Glob
-func processStandardGlobPattern(req PatternRequest) error {
+func processStandardGlobPattern(ctx context.Context, req PatternRequest) error {
 	matches, err := filepath.Glob(req.Pattern)
 	if err != nil {
 		return fmt.Errorf("failed to glob pattern %s: %w", req.Pattern, err)
@@ -257,19 +387,19 @@ func processStandardGlobPattern(req PatternRequest) error {
 		if info.IsDir() {
 			// handle directories by walking them recursively
 			dirMatchCount := 0
-			err := filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
-				if err != nil || info.IsDir() || info.Size() > req.MaxFileSize {
-					if err == nil && info.Size() > req.MaxFileSize {
-						lgr.Printf("[WARN] file %s exceeds size limit (%d bytes), skipping", path, info.Size())
-					}
-					return nil
+			err := walkFiles(ctx, match, req.walkOptions(), func(path string, info os.FileInfo) {
+				if info.Size() > req.MaxFileSize {
+					lgr.Printf("[WARN] file %s exceeds size limit (%d bytes), skipping", path, info.Size())
+					return
 				}
 				req.MatchedFiles[path] = struct{}{}
 				dirMatchCount++
-				return nil
 			})
 
 			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
 				lgr.Printf("[WARN] failed to walk directory %s: %v", match, err)
 			}
 			matchCount += dirMatchCount
@@ -307,20 +437,28 @@ func getSortedFiles(matchedFiles map[string]struct{}) []string {
 
 const maxTotalOutputSize = 10 * 1024 * 1024 // 10MB max total output size to prevent memory issues
 
-// formatFileContents creates a formatted string with file contents and appropriate headers
-func formatFileContents(files []string) (string, error) {
+// formatFileContents creates a formatted string with file contents and appropriate headers,
+// with file names relative to dir or the current directory if dir is empty.
+// Files are read concurrently by the given number of workers, keeping the order of files.
+func formatFileContents(ctx context.Context, files []string, dir string, workers int, wrapper Wrapper,
+	ecosystems []Ecosystem) (string, error) {
 	var sb strings.Builder
-	cwd, err := os.Getwd()
+	cwd, err := workingDir(dir)
 	if err != nil {
-		return "", fmt.Errorf("failed to get current working directory: %w", err)
+		return "", err
 	}
 
 	totalBytesWritten := 0
-	for i, file := range files {
-		content, err := os.ReadFile(file) // #nosec G304 - file paths are validated earlier
-		if err != nil {
-			return "", fmt.Errorf("failed to read file %s: %w", file, err)
+	var readErr error
+	err = readFiles(ctx, files, workers, 0, func(i int, res fileResult) bool {
+		if res.err != nil {
+			readErr = res.err
+			return false
+		}
+		if res.skip {
+			return true
 		}
+		file, content := res.file, res.content
 
 		// get relative path if possible, otherwise use absolute
 		relPath, err := filepath.Rel(cwd, file)
@@ -328,51 +466,87 @@ func formatFileContents(files []string) (string, error) {
 			relPath = file
 		}
 
-		// determine the appropriate comment style based on file extension
-		fileHeader := getFileHeader(relPath)
+		// wrap the content with the file name, comment style of plain wrapper is based on file extension
+		wrapped := wrapper.wrap(relPath, "", summarize(ecosystems, file, string(content)))
 
 		// check if adding this file would exceed the total output limit
-		fileSize := len(fileHeader) + len(content) + 2 // +2 for \n\n
+		fileSize := len(wrapped)
 		if totalBytesWritten+fileSize > maxTotalOutputSize {
 			remainingFiles := len(files) - i
 			lgr.Printf("[WARN] reached total output size limit of %d bytes, skipping remaining %d files", maxTotalOutputSize, remainingFiles)
 			sb.WriteString(fmt.Sprintf("\n// ... output truncated (reached %d MB limit, %d files remaining) ...\n", maxTotalOutputSize/1024/1024, remainingFiles))
-			break
+			return false
 		}
 
-		sb.WriteString(fileHeader)
-		sb.Write(content)
-		sb.WriteString("\n\n")
+		sb.WriteString(wrapped)
 		totalBytesWritten += fileSize
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	if readErr != nil {
+		return "", readErr
 	}
 
 	return sb.String(), nil
 }
 
-// prepareExcludePatterns combines and deduplicates all exclude patterns
-func prepareExcludePatterns(excludePatterns []string) []string {
-	// estimate capacity for the combined patterns
-	totalCapacity := len(excludePatterns) + len(commonIgnorePatterns)
-	gitIgnorePatterns := loadGitIgnorePatterns()
-	totalCapacity += len(gitIgnorePatterns)
+// readFileContent reads the file to include in the prompt converted to UTF-8, skip is set for binary files
+func readFileContent(file string) (content []byte, skip bool, err error) {
+	content, err = os.ReadFile(file) // #nosec G304 - file paths are validated earlier
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read file %s: %w", file, err)
+	}
+	text, encoding, binary := decodeText(content)
+	if binary {
+		lgr.Printf("[DEBUG] skipping binary file %s", file)
+		return nil, true, nil
+	}
+	if encoding != encodingUTF8 {
+		lgr.Printf("[DEBUG] converted file %s from %s to utf-8", file, encoding)
+	}
+	return text, false, nil
+}
+
+// prepareExcludePatterns combines and deduplicates all exclude patterns in the order of increasing precedence:
+// common patterns, default excludes of ecosystems, .gitignore, .mptignore and user-provided exclude patterns. The last matching pattern
+// decides whether a file is excluded, so negation patterns (with ! prefix) from .mptignore can re-include files
+// excluded by .gitignore or common patterns, while user-provided patterns always win.
+// Ignore files are read from dir, or the current directory if dir is empty.
+func prepareExcludePatterns(excludePatterns []string, dir string, ecosystems []Ecosystem) []string {
+	gitIgnorePatterns := loadGitIgnorePatterns(dir)
+	mptIgnorePatterns := loadMptIgnorePatterns(dir)
+	ecosystemPatterns := ecosystemExcludes(ecosystems)
 
 	// pre-allocate slice with sufficient capacity
+	totalCapacity := len(commonIgnorePatterns) + len(ecosystemPatterns) + len(gitIgnorePatterns) + len(mptIgnorePatterns) +
+		len(excludePatterns)
 	allPatterns := make([]string, 0, totalCapacity)
 
-	// user-provided exclude patterns have highest priority
-	allPatterns = append(allPatterns, excludePatterns...)
-
-	// add common ignore patterns
+	// common ignore patterns have the lowest priority, followed by default excludes of ecosystems
 	allPatterns = append(allPatterns, commonIgnorePatterns...)
+	allPatterns = append(allPatterns, ecosystemPatterns...)
 
-	// add patterns from .gitignore
+	// add patterns from .gitignore and .mptignore
 	allPatterns = append(allPatterns, gitIgnorePatterns...)
+	allPatterns = append(allPatterns, mptIgnorePatterns...)
+
+	// user-provided exclude patterns have the highest priority
+	for _, pattern := range excludePatterns {
+		if strings.HasPrefix(pattern, "!") {
+			lgr.Printf("[WARN] negation is not supported in exclude patterns, use %s instead: %s", mptignoreFile, pattern)
+			continue
+		}
+		allPatterns = append(allPatterns, pattern)
+	}
 
 	// deduplicate patterns to avoid redundant processing
 	return deduplicatePatterns(allPatterns)
 }
 
-// deduplicatePatterns removes duplicate patterns while preserving order
+// deduplicatePatterns removes duplicate patterns while preserving order.
+// The last occurrence is kept, as later patterns take precedence over earlier ones.
 func deduplicatePatterns(patterns []string) []string {
 	if len(patterns) == 0 {
 		return patterns
@@ -381,25 +555,27 @@ func deduplicatePatterns(patterns []string) []string {
 	seen := make(map[string]struct{}, len(patterns))
 	deduped := make([]string, 0, len(patterns))
 
-	for _, pattern := range patterns {
-		if _, ok := seen[pattern]; !ok {
-			seen[pattern] = struct{}{}
-			deduped = append(deduped, pattern)
+	for i := len(patterns) - 1; i >= 0; i-- {
+		if _, ok := seen[patterns[i]]; !ok {
+			seen[patterns[i]] = struct{}{}
+			deduped = append(deduped, patterns[i])
 		}
 	}
+	slices.Reverse(deduped)
 
 	return deduped
 }
 
-// applyExcludePatterns removes files that match any of the exclude patterns from the matched files
-func applyExcludePatterns(matchedFiles map[string]struct{}, excludePatterns []string) map[string]struct{} {
+// applyExcludePatterns removes files that match any of the exclude patterns from the matched files.
+// Relative patterns are matched against paths relative to dir, or the current directory if dir is empty.
+func applyExcludePatterns(matchedFiles map[string]struct{}, excludePatterns []string, dir string) map[string]struct{} {
 	if len(excludePatterns) == 0 {
 		return matchedFiles
 	}
 
-	cwd, err := os.Getwd()
+	cwd, err := workingDir(dir)
 	if err != nil {
-		lgr.Printf("[WARN] failed to get current working directory: %v", err)
+		lgr.Printf("[WARN] %v", err)
 		return matchedFiles // return original map if we can't get the working directory
 	}
 
@@ -430,7 +606,8 @@ func applyExcludePatterns(matchedFiles map[string]struct{}, excludePatterns []st
 	return filteredFiles
 }
 
-// shouldExcludeFile checks if a file should be excluded based on the exclude patterns
+// shouldExcludeFile checks if a file should be excluded based on the exclude patterns.
+// Patterns are ordered by precedence, the last matching one wins.
 func shouldExcludeFile(req ExclusionRequest) bool {
 	// get the relative path for pattern matching
 	relPath, err := filepath.Rel(req.WorkingDir, req.FilePath)
@@ -439,21 +616,52 @@ func shouldExcludeFile(req ExclusionRequest) bool {
 		relPath = req.FilePath
 	}
 
-	for _, pattern := range req.ExcludePatterns {
-		if matchesPattern(pattern, req.FilePath, relPath) {
-			req.PatternCount[pattern]++
-			return true
+	// the last matching pattern decides, negation patterns re-include the file
+	matched := ""
+	for i := len(req.ExcludePatterns) - 1; i >= 0; i-- {
+		if matchesPattern(strings.TrimPrefix(req.ExcludePatterns[i], "!"), req.FilePath, relPath) {
+			matched = req.ExcludePatterns[i]
+			break
 		}
 	}
+	if matched == "" {
+		return false
+	}
 
-	return false
+	excluded := !strings.HasPrefix(matched, "!")
+	if traceMatching.Load() {
+		action := "excluded by pattern"
+		if !excluded {
+			action = "included by negation pattern"
+		}
+		lgr.Printf("[TRACE] file %s %s %s", relPath, action, matched)
+	}
+	if excluded {
+		req.PatternCount[matched]++
+	}
+	return excluded
 }
 
 // matchesPattern checks if a file matches a specific exclude pattern
 func matchesPattern(pattern, filePath, relPath string) bool {
-	// handle bash-style patterns with **
-	if strings.Contains(pattern, "**") {
-		matched, err := doublestar.Match(pattern, relPath)
+	// handle Go-style recursive patterns, relative ones are matched against the relative path
+	if strings.Contains(pattern, "/...") {
+		if isAbsPattern(pattern) {
+			return matchesGoStylePattern(pattern, filePath)
+		}
+		return matchesGoStylePattern(pattern, relPath)
+	}
+
+	// handle bash-style patterns with ** and patterns with directories, matched against the path
+	if strings.Contains(pattern, "**") || strings.Contains(pattern, "/") {
+		// absolute patterns are matched against the absolute path, relative ones against the relative path
+		target := relPath
+		if isAbsPattern(pattern) {
+			if abs, err := filepath.Abs(filePath); err == nil {
+				target = abs
+			}
+		}
+		matched, err := doublestar.Match(pattern, filepath.ToSlash(target))
 		if err != nil {
 			lgr.Printf("[WARN] error matching exclude pattern %s: %v", pattern, err)
 			return false
@@ -461,12 +669,7 @@ func matchesPattern(pattern, filePath, relPath string) bool {
 		return matched
 	}
 
-	// handle Go-style recursive patterns
-	if strings.Contains(pattern, "/...") {
-		return matchesGoStylePattern(pattern, filePath)
-	}
-
-	// handle standard glob patterns
+	// handle standard glob patterns, matched against the file name
 	matched, err := filepath.Match(pattern, filepath.Base(filePath))
 	if err != nil {
 		lgr.Printf("[WARN] error matching exclude pattern %s: %v", pattern, err)
@@ -481,7 +684,7 @@ func matchesGoStylePattern(pattern, filePath string) bool {
 	basePath, filter := parseRecursivePattern(pattern)
 
 	// check if the file is under the base path
-	if !strings.HasPrefix(filePath, basePath) {
+	if !isUnderDir(filePath, filepath.FromSlash(basePath)) {
 		return false
 	}
 
@@ -568,36 +771,49 @@ var commonIgnorePatterns = []string{
 	// Note: We don't exclude /tmp as it's often used in tests
 }
 
-// gitignoreFile is the name of the Git ignore file
-const gitignoreFile = ".gitignore"
-
-// maxGitignoreSize is the maximum size of a .gitignore file to process (1MB)
-const maxGitignoreSize = 1 * 1024 * 1024
+const (
+	gitignoreFile     = ".gitignore"    // name of the Git ignore file
+	mptignoreFile     = ".mptignore"    // name of the project-level mpt ignore file
+	maxIgnoreFileSize = 1 * 1024 * 1024 // maximum size of an ignore file to process (1MB)
+)
 
-// loadGitIgnorePatterns reads the .gitignore file in the current directory
+// loadGitIgnorePatterns reads the .gitignore file in dir, or the current directory if dir is empty,
 // and converts its patterns to glob patterns compatible with our exclude system.
 // Note: Only top-level .gitignore is processed. Nested .gitignore files are not supported.
-// Negation patterns (patterns starting with !) are not supported.
-func loadGitIgnorePatterns() []string {
-	// check if .gitignore exists and is accessible
-	fileInfo, err := os.Stat(gitignoreFile)
+// Negation patterns (patterns starting with !) are not supported, use .mptignore for them.
+func loadGitIgnorePatterns(dir string) []string {
+	return loadIgnorePatterns(filepath.Join(dir, gitignoreFile), false)
+}
+
+// loadMptIgnorePatterns reads the .mptignore file in dir, or the current directory if dir is empty.
+// It uses .gitignore syntax, including negation patterns (!pattern) re-including files excluded
+// by earlier patterns, .gitignore or common patterns.
+func loadMptIgnorePatterns(dir string) []string {
+	return loadIgnorePatterns(filepath.Join(dir, mptignoreFile), true)
+}
+
+// loadIgnorePatterns reads an ignore file with .gitignore syntax and converts its patterns to glob patterns.
+// Negation patterns are kept with ! prefix if allowNegation is set, and skipped otherwise.
+func loadIgnorePatterns(name string, allowNegation bool) []string {
+	// check if the file exists and is accessible
+	fileInfo, err := os.Stat(name)
 	if err != nil {
 		if !os.IsNotExist(err) {
-			lgr.Printf("[DEBUG] error accessing .gitignore: %v", err)
+			lgr.Printf("[DEBUG] error accessing %s: %v", name, err)
 		}
 		return nil
 	}
 
 	// check file size limit
-	if fileInfo.Size() > maxGitignoreSize {
-		lgr.Printf("[WARN] .gitignore file exceeds maximum size limit of %d bytes, ignoring", maxGitignoreSize)
+	if fileInfo.Size() > maxIgnoreFileSize {
+		lgr.Printf("[WARN] %s file exceeds maximum size limit of %d bytes, ignoring", name, maxIgnoreFileSize)
 		return nil
 	}
 
-	// try to read .gitignore from current directory
-	data, err := os.ReadFile(gitignoreFile)
+	// try to read the file from current directory
+	data, err := os.ReadFile(name) // #nosec G304 - name is one of the known ignore files
 	if err != nil {
-		lgr.Printf("[DEBUG] error reading .gitignore: %v", err)
+		lgr.Printf("[DEBUG] error reading %s: %v", name, err)
 		return nil
 	}
 
@@ -605,33 +821,42 @@ func loadGitIgnorePatterns() []string {
 	lines := strings.Split(string(data), "\n")
 	patterns := make([]string, 0, len(lines))
 
-	// process each line from .gitignore
+	// process each line of the file
 	for i, line := range lines {
-		pattern := convertGitIgnorePattern(line, i+1)
-		if pattern != "" {
-			patterns = append(patterns, pattern)
+		pattern := convertGitIgnorePattern(line)
+		if pattern == "" {
+			continue
 		}
+		if strings.HasPrefix(pattern, "!") && !allowNegation {
+			lgr.Printf("[WARN] %s negation pattern not supported at line %d: %s", name, i+1, strings.TrimSpace(line))
+			continue
+		}
+		patterns = append(patterns, pattern)
 	}
 
 	if len(patterns) > 0 {
-		lgr.Printf("[DEBUG] loaded %d patterns from .gitignore", len(patterns))
+		lgr.Printf("[DEBUG] loaded %d patterns from %s", len(patterns), name)
 	}
 
 	return patterns
 }
 
-// convertGitIgnorePattern converts a single .gitignore pattern to a glob pattern
-// returns empty string for patterns that should be skipped
-func convertGitIgnorePattern(line string, lineNum int) string {
+// convertGitIgnorePattern converts a single .gitignore pattern to a glob pattern.
+// Negation patterns keep their ! prefix. Returns empty string for patterns that should be skipped.
+func convertGitIgnorePattern(line string) string {
 	// skip empty lines and comments
 	line = strings.TrimSpace(line)
 	if line == "" || strings.HasPrefix(line, "#") {
 		return ""
 	}
 
-	// handle negation (!) - not supported currently
-	if strings.HasPrefix(line, "!") {
-		lgr.Printf("[WARN] .gitignore negation pattern not supported at line %d: %s", lineNum, line)
+	// handle negation (!), escaped \! and \# are literal
+	negate := strings.HasPrefix(line, "!")
+	line = strings.TrimPrefix(line, "!")
+	if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if line == "" {
 		return ""
 	}
 
@@ -653,65 +878,80 @@ func convertGitIgnorePattern(line string, lineNum int) string {
 		line = "**/" + line
 	}
 
+	if negate {
+		return "!" + line
+	}
 	return line
 }
 
+// FormatFile formats the content of a file not loaded from disk, like an uploaded one, the same way as
+// LoadContent does, with a comment header based on the file extension
+func FormatFile(name, content string) string {
+	return WrapperPlain.wrap(name, "", content)
+}
+
 // getFileHeader returns an appropriate comment header for a file based on its extension
 func getFileHeader(filePath string) string {
+	return fmt.Sprintf(fileHeaderFormat(filePath), filePath)
+}
+
+// fileHeaderFormat returns format of the comment header for a file based on its extension,
+// with a single %s verb for the file name
+func fileHeaderFormat(filePath string) string {
 	ext := filepath.Ext(filePath)
 
 	// define comment styles for different file types
 	// special case for Makefile which has no extension
 	if strings.HasSuffix(filePath, "Makefile") || strings.HasSuffix(filePath, "makefile") {
-		return fmt.Sprintf("# file: %s\n", filePath)
+		return "# file: %s\n"
 	}
 
 	switch ext {
 	// hash-style comments (#)
 	case ".py", ".rb", ".pl", ".pm", ".sh", ".bash", ".zsh", ".fish", ".tcl", ".r",
 		".yaml", ".yml", ".toml", ".ini", ".conf", ".cfg", ".properties", ".mk", ".makefile":
-		return fmt.Sprintf("# file: %s\n", filePath)
+		return "# file: %s\n"
 
 	// Double-slash comments (//)
 	case ".js", ".ts", ".jsx", ".tsx", ".java", ".c", ".cc", ".cpp", ".cxx", ".h", ".hpp",
 		".hxx", ".cs", ".php", ".go", ".swift", ".kt", ".rs", ".scala", ".dart", ".groovy", ".d":
-		return fmt.Sprintf("// file: %s\n", filePath)
+		return "// file: %s\n"
 
 	// HTML/XML style comments
 	case ".html", ".xml", ".svg", ".xaml", ".jsp", ".asp", ".aspx", ".jsf", ".vue":
-		return fmt.Sprintf("<!-- file: %s -->\n", filePath)
+		return "<!-- file: %s -->\n"
 
 	// CSS style comments
 	case ".css", ".scss", ".sass", ".less":
-		return fmt.Sprintf("/* file: %s */\n", filePath)
+		return "/* file: %s */\n"
 
 	// SQL comments
 	case ".sql":
-		return fmt.Sprintf("-- file: %s\n", filePath)
+		return "-- file: %s\n"
 
 	// lisp/Clojure comments
 	case ".lisp", ".cl", ".el", ".clj", ".cljs", ".cljc":
-		return fmt.Sprintf(";; file: %s\n", filePath)
+		return ";; file: %s\n"
 
 	// haskell/VHDL comments
 	case ".hs", ".lhs", ".vhdl", ".vhd":
-		return fmt.Sprintf("-- file: %s\n", filePath)
+		return "-- file: %s\n"
 
 	// PowerShell comments
 	case ".ps1", ".psm1", ".psd1":
-		return fmt.Sprintf("# file: %s\n", filePath)
+		return "# file: %s\n"
 
 	// batch file comments
 	case ".bat", ".cmd":
-		return fmt.Sprintf(":: file: %s\n", filePath)
+		return ":: file: %s\n"
 
 	// fortran comments
 	case ".f", ".f90", ".f95", ".f03":
-		return fmt.Sprintf("! file: %s\n", filePath)
+		return "! file: %s\n"
 
 	// Default to // for unknown types
 	default:
-		return fmt.Sprintf("// file: %s\n", filePath)
+		return "// file: %s\n"
 	}
 }
 
@@ -724,6 +964,75 @@ func fileExists(path string) bool {
 	return !info.IsDir()
 }
 
+// pathSeparator is the OS path separator, a variable to allow testing of Windows behavior on other platforms
+var pathSeparator = filepath.Separator
+
+// normalizePatterns converts patterns to the forward-slash form used by all matchers.
+// Backslashes are treated as path separators on Windows only, on other platforms they escape glob meta characters.
+func normalizePatterns(patterns []string) []string {
+	if pathSeparator != '\\' || len(patterns) == 0 {
+		return patterns
+	}
+	res := make([]string, len(patterns))
+	for i, p := range patterns {
+		res[i] = strings.ReplaceAll(p, `\`, "/")
+	}
+	return res
+}
+
+// resolvePatterns makes relative patterns absolute by joining them with dir, absolute patterns are kept as is
+func resolvePatterns(dir string, patterns []string) []string {
+	base := filepath.ToSlash(dir)
+	res := make([]string, len(patterns))
+	for i, p := range patterns {
+		res[i] = p
+		if !isAbsPattern(p) {
+			res[i] = path.Join(base, p)
+		}
+	}
+	return res
+}
+
+// workingDir returns dir if set, and the current working directory otherwise
+func workingDir(dir string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current working directory: %w", err)
+	}
+	return cwd, nil
+}
+
+// isAbsPattern checks if a slash-separated pattern is absolute, including drive-letter patterns like C:/src/**
+func isAbsPattern(pattern string) bool {
+	if strings.HasPrefix(pattern, "/") {
+		return true
+	}
+	return len(pattern) >= 3 && pattern[1] == ':' && pattern[2] == '/' &&
+		((pattern[0] >= 'a' && pattern[0] <= 'z') || (pattern[0] >= 'A' && pattern[0] <= 'Z'))
+}
+
+// isUnderDir checks if the file path is located under the directory, comparing cleaned paths
+// and making both absolute if one of them is absolute
+func isUnderDir(filePath, dir string) bool {
+	filePath, dir = filepath.Clean(filePath), filepath.Clean(dir)
+	if filepath.IsAbs(filePath) != filepath.IsAbs(dir) {
+		var err error
+		if filePath, err = filepath.Abs(filePath); err != nil {
+			return false
+		}
+		if dir, err = filepath.Abs(dir); err != nil {
+			return false
+		}
+	}
+	if dir == "." {
+		return !filepath.IsAbs(filePath) && filePath != ".." && !strings.HasPrefix(filePath, ".."+string(filepath.Separator))
+	}
+	return filePath == dir || strings.HasPrefix(filePath, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
 // isFileTooLarge checks if a file's size exceeds the maximum allowed size
 // returns true if file is too large and the actual file size
 func isFileTooLarge(path string, maxFileSize int64) (tooLarge bool, fileSize int64) {
@@ -1,6 +1,8 @@
 package files
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"math"
 	"os"
@@ -8,6 +10,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/go-pkgz/lgr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -55,7 +58,7 @@ func TestGitIgnoreRespect(t *testing.T) {
 	}()
 
 	// test that .gitignore patterns are respected
-	result, err := LoadContent(LoadRequest{
+	result, err := LoadContent(context.Background(), LoadRequest{
 		Patterns:        []string{"**/*"},
 		ExcludePatterns: nil,
 		MaxFileSize:     64 * 1024,
@@ -78,7 +81,7 @@ func TestGitIgnoreRespect(t *testing.T) {
 	assert.NotContains(t, result, "important log content", "Should ignore negation patterns")
 
 	// test with explicit exclude patterns overriding .gitignore
-	result, err = LoadContent(LoadRequest{
+	result, err = LoadContent(context.Background(), LoadRequest{
 		Patterns:        []string{"**/*"},
 		ExcludePatterns: []string{"**/*.go"},
 		MaxFileSize:     64 * 1024,
@@ -94,6 +97,97 @@ func TestGitIgnoreRespect(t *testing.T) {
 	assert.NotContains(t, result, "temporary file content", "Should still respect .gitignore patterns")
 }
 
+func TestMptIgnore(t *testing.T) {
+	testFiles := map[string]string{
+		"main.go":              "package main",
+		"secret.go":            "package secret",
+		"docs/guide.md":        "guide content",
+		"docs/internal/raw.md": "raw docs",
+		"logs/keep.log":        "kept log",
+		"logs/app.log":         "app log",
+		"vendor/lib/lib.go":    "package lib",
+		"gen/model.go":         "package gen",
+		".gitignore":           "gen/\n",
+		".mptignore":           "# project excludes\nsecret.go\ndocs/\n!docs/guide.md\n!logs/keep.log\n!gen/model.go\n",
+	}
+
+	tests := []struct {
+		name     string
+		excludes []string
+		want     []string
+		notWant  []string
+	}{
+		{
+			name:    "mptignore with negation",
+			want:    []string{"package main", "guide content", "kept log", "package gen"},
+			notWant: []string{"package secret", "raw docs", "app log", "package lib"},
+		},
+		{
+			name:     "user excludes take precedence over negation",
+			excludes: []string{"**/*.md", "gen/**"},
+			want:     []string{"package main", "kept log"},
+			notWant:  []string{"guide content", "package gen", "package secret", "raw docs"},
+		},
+		{
+			name:     "negation in user excludes is ignored",
+			excludes: []string{"!secret.go"},
+			want:     []string{"package main"},
+			notWant:  []string{"package secret"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			for path, content := range testFiles {
+				fullPath := filepath.Join(tmpDir, path)
+				require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0o750))
+				require.NoError(t, os.WriteFile(fullPath, []byte(content), 0o600))
+			}
+			t.Chdir(tmpDir)
+
+			result, err := LoadContent(context.Background(), LoadRequest{Patterns: []string{"**/*"}, ExcludePatterns: tt.excludes,
+				MaxFileSize: DefaultMaxFileSize})
+			require.NoError(t, err)
+			for _, s := range tt.want {
+				assert.Contains(t, result, s)
+			}
+			for _, s := range tt.notWant {
+				assert.NotContains(t, result, s)
+			}
+		})
+	}
+}
+
+func TestConvertGitIgnorePattern(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: "", want: ""},
+		{line: "# comment", want: ""},
+		{line: "*.log", want: "**/*.log"},
+		{line: "/build/", want: "build/**"},
+		{line: "src/logs/", want: "src/logs/**"},
+		{line: "!important.log", want: "!**/important.log"},
+		{line: "!docs/guide.md", want: "!docs/guide.md"},
+		{line: "!", want: ""},
+		{line: `\!bang.txt`, want: "**/!bang.txt"},
+		{line: `\#hash.txt`, want: "**/#hash.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			assert.Equal(t, tt.want, convertGitIgnorePattern(tt.line))
+		})
+	}
+}
+
+func TestDeduplicatePatterns(t *testing.T) {
+	assert.Equal(t, []string{"!a/b", "a/**", "c"}, deduplicatePatterns([]string{"a/**", "!a/b", "a/**", "c", "c"}))
+	assert.Empty(t, deduplicatePatterns(nil))
+}
+
 func TestPatternMatching(t *testing.T) {
 	t.Run("matchesPattern", func(t *testing.T) {
 		tests := []struct {
@@ -109,6 +203,8 @@ func TestPatternMatching(t *testing.T) {
 			{"go_pattern_no_match", "src/...", "pkg/main.go", "pkg/main.go", false},
 			{"standard_pattern_match", "*.go", "main.go", "main.go", true},
 			{"standard_pattern_no_match", "*.go", "main.js", "main.js", false},
+			{"path_pattern_match", "docs/*.md", "docs/guide.md", "docs/guide.md", true},
+			{"path_pattern_no_match", "docs/*.md", "src/docs/guide.md", "src/docs/guide.md", false},
 			{"invalid_pattern", "[invalid", "file.txt", "file.txt", false},
 		}
 
@@ -189,7 +285,7 @@ func TestCommonIgnorePatterns(t *testing.T) {
 	}()
 
 	// test with common ignore patterns (without .gitignore)
-	result, err := LoadContent(LoadRequest{
+	result, err := LoadContent(context.Background(), LoadRequest{
 		Patterns:        []string{"**/*"},
 		ExcludePatterns: nil,
 		MaxFileSize:     64 * 1024,
@@ -228,7 +324,7 @@ func TestCommonIgnorePatterns(t *testing.T) {
 	err = os.WriteFile(tmpFilePath, []byte("temp file content"), 0o644)
 	require.NoError(t, err)
 
-	result, err = LoadContent(LoadRequest{
+	result, err = LoadContent(context.Background(), LoadRequest{
 		Patterns:        []string{"**/*"},
 		ExcludePatterns: []string{"**/bin/**"},
 		MaxFileSize:     64 * 1024,
@@ -247,7 +343,7 @@ func TestLoadContent(t *testing.T) {
 	defaultMaxFileSize := int64(64 * 1024)
 
 	t.Run("direct_paths", func(t *testing.T) {
-		result, err := LoadContent(LoadRequest{
+		result, err := LoadContent(context.Background(), LoadRequest{
 			Patterns: []string{
 				filepath.Join(testDataDir, "test1.go"),
 				filepath.Join(testDataDir, "test2.txt"),
@@ -264,7 +360,7 @@ func TestLoadContent(t *testing.T) {
 	})
 
 	t.Run("standard_glob", func(t *testing.T) {
-		result, err := LoadContent(LoadRequest{
+		result, err := LoadContent(context.Background(), LoadRequest{
 			Patterns: []string{
 				filepath.Join(testDataDir, "*.go"),
 			},
@@ -279,7 +375,7 @@ func TestLoadContent(t *testing.T) {
 	})
 
 	t.Run("directory_recursive", func(t *testing.T) {
-		result, err := LoadContent(LoadRequest{
+		result, err := LoadContent(context.Background(), LoadRequest{
 			Patterns: []string{
 				filepath.Join(testDataDir, "nested"),
 			},
@@ -297,7 +393,7 @@ func TestLoadContent(t *testing.T) {
 	t.Run("go_style_recursive_go_files", func(t *testing.T) {
 		// construct the path properly to avoid linter warnings about path separators
 		goStylePath := testDataDir + "/.../*.go"
-		result, err := LoadContent(LoadRequest{
+		result, err := LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{goStylePath},
 			ExcludePatterns: nil,
 			MaxFileSize:     defaultMaxFileSize,
@@ -314,7 +410,7 @@ func TestLoadContent(t *testing.T) {
 	t.Run("go_style_recursive_all", func(t *testing.T) {
 		// construct the path properly to avoid linter warnings about path separators
 		goStylePath := testDataDir + "/..."
-		result, err := LoadContent(LoadRequest{
+		result, err := LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{goStylePath},
 			ExcludePatterns: nil,
 			MaxFileSize:     defaultMaxFileSize,
@@ -338,7 +434,7 @@ func TestLoadContent(t *testing.T) {
 		err = os.Chdir(testDataDir)
 		require.NoError(t, err)
 
-		result, err := LoadContent(LoadRequest{
+		result, err := LoadContent(context.Background(), LoadRequest{
 			Patterns: []string{
 				"**/*.go", // use relative pattern
 			},
@@ -367,7 +463,7 @@ func TestLoadContent(t *testing.T) {
 		err = os.Chdir(testDataDir)
 		require.NoError(t, err)
 
-		result, err := LoadContent(LoadRequest{
+		result, err := LoadContent(context.Background(), LoadRequest{
 			Patterns: []string{
 				"nested/**/*.go", // use relative pattern
 			},
@@ -395,7 +491,7 @@ func TestLoadContent(t *testing.T) {
 		err = os.Chdir(testDataDir)
 		require.NoError(t, err)
 
-		result, err := LoadContent(LoadRequest{
+		result, err := LoadContent(context.Background(), LoadRequest{
 			Patterns: []string{
 				"**/*.go",  // use relative pattern
 				"**/*.txt", // use relative pattern
@@ -418,7 +514,7 @@ func TestLoadContent(t *testing.T) {
 	})
 
 	t.Run("empty_pattern", func(t *testing.T) {
-		result, err := LoadContent(LoadRequest{
+		result, err := LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{},
 			ExcludePatterns: nil,
 			MaxFileSize:     defaultMaxFileSize,
@@ -429,7 +525,7 @@ func TestLoadContent(t *testing.T) {
 	})
 
 	t.Run("non_existent_pattern", func(t *testing.T) {
-		_, err := LoadContent(LoadRequest{
+		_, err := LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{"non-existent-pattern-*.xyz"},
 			ExcludePatterns: nil,
 			MaxFileSize:     defaultMaxFileSize,
@@ -442,7 +538,7 @@ func TestLoadContent(t *testing.T) {
 	t.Run("invalid_directory", func(t *testing.T) {
 		// construct the path properly to avoid linter warnings about path separators
 		invalidPath := filepath.Join(testDataDir, "non-existent-dir") + "/..."
-		_, err := LoadContent(LoadRequest{
+		_, err := LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{invalidPath},
 			ExcludePatterns: nil,
 			MaxFileSize:     defaultMaxFileSize,
@@ -455,7 +551,7 @@ func TestLoadContent(t *testing.T) {
 		// construct go-style path properly
 		nestedPath := testDataDir + "/nested/..."
 
-		result, err := LoadContent(LoadRequest{
+		result, err := LoadContent(context.Background(), LoadRequest{
 			Patterns: []string{
 				filepath.Join(testDataDir, "*.go"), // standard glob
 				nestedPath,                         // go-style recursive
@@ -471,7 +567,7 @@ func TestLoadContent(t *testing.T) {
 		require.NoError(t, err)
 
 		// add content from bash-style pattern
-		txtContent, err := LoadContent(LoadRequest{
+		txtContent, err := LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{"**/*.txt"},
 			ExcludePatterns: nil,
 			MaxFileSize:     defaultMaxFileSize,
@@ -493,7 +589,7 @@ func TestLoadContent(t *testing.T) {
 
 	t.Run("exclude_patterns", func(t *testing.T) {
 		// test excluding specific files
-		result, err := LoadContent(LoadRequest{
+		result, err := LoadContent(context.Background(), LoadRequest{
 			Patterns: []string{
 				testDataDir + "/...", // all files
 			},
@@ -513,7 +609,7 @@ func TestLoadContent(t *testing.T) {
 		assert.NotContains(t, result, "This is another text file for testing")
 
 		// test excluding directories
-		result, err = LoadContent(LoadRequest{
+		result, err = LoadContent(context.Background(), LoadRequest{
 			Patterns: []string{
 				testDataDir + "/...", // all files
 			},
@@ -533,7 +629,7 @@ func TestLoadContent(t *testing.T) {
 		assert.NotContains(t, result, "This is another text file for testing")
 
 		// test multiple exclude patterns
-		result, err = LoadContent(LoadRequest{
+		result, err = LoadContent(context.Background(), LoadRequest{
 			Patterns: []string{
 				testDataDir + "/...", // all files
 			},
@@ -582,7 +678,7 @@ func TestProcessPatterns(t *testing.T) {
 		}()
 
 		matchedFiles := make(map[string]struct{})
-		err = processBashStylePattern(PatternRequest{Pattern: "**/*.go", MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
+		err = processBashStylePattern(context.Background(), PatternRequest{Pattern: "**/*.go", MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
 		require.NoError(t, err)
 
 		// we should have matched at least 3 go files: test1.go, nested/test3.go, nested/deep/test4.go
@@ -590,13 +686,13 @@ func TestProcessPatterns(t *testing.T) {
 
 		// test a non-existent pattern
 		matchedFiles = make(map[string]struct{})
-		err = processBashStylePattern(PatternRequest{Pattern: "**/nonexistent*.abc", MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
+		err = processBashStylePattern(context.Background(), PatternRequest{Pattern: "**/nonexistent*.abc", MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
 		require.NoError(t, err) // matching zero files is not an error
 		assert.Empty(t, matchedFiles)
 
 		// test with an invalid pattern
 		matchedFiles = make(map[string]struct{})
-		err = processBashStylePattern(PatternRequest{Pattern: "**/*[", MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize}) // invalid pattern
+		err = processBashStylePattern(context.Background(), PatternRequest{Pattern: "**/*[", MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize}) // invalid pattern
 		require.Error(t, err)
 	})
 
@@ -607,7 +703,7 @@ func TestProcessPatterns(t *testing.T) {
 
 		// test go-style recursive pattern with .go extension filter
 		pattern := testDataDir + "/.../*.go"
-		err := processGoStylePattern(PatternRequest{Pattern: pattern, MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
+		err := processGoStylePattern(context.Background(), PatternRequest{Pattern: pattern, MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
 		require.NoError(t, err)
 
 		// we should have matched at least 3 go files
@@ -616,7 +712,7 @@ func TestProcessPatterns(t *testing.T) {
 		// test recursive pattern without filter
 		matchedFiles = make(map[string]struct{})
 		pattern = testDataDir + "/..."
-		err = processGoStylePattern(PatternRequest{Pattern: pattern, MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
+		err = processGoStylePattern(context.Background(), PatternRequest{Pattern: pattern, MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
 		require.NoError(t, err)
 
 		// we should have matched all files, at least 5
@@ -625,7 +721,7 @@ func TestProcessPatterns(t *testing.T) {
 		// test with non-existent directory
 		matchedFiles = make(map[string]struct{})
 		pattern = filepath.Join(testDataDir, "nonexistent") + "/..."
-		err = processGoStylePattern(PatternRequest{Pattern: pattern, MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
+		err = processGoStylePattern(context.Background(), PatternRequest{Pattern: pattern, MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
 		require.NoError(t, err) // non-existent dir is handled gracefully
 		assert.Empty(t, matchedFiles)
 	})
@@ -637,7 +733,7 @@ func TestProcessPatterns(t *testing.T) {
 
 		// test standard glob with extension
 		pattern := filepath.Join(testDataDir, "*.go")
-		err := processStandardGlobPattern(PatternRequest{Pattern: pattern, MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
+		err := processStandardGlobPattern(context.Background(), PatternRequest{Pattern: pattern, MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
 		require.NoError(t, err)
 
 		// we should have matched 1 go file in the top level
@@ -646,7 +742,7 @@ func TestProcessPatterns(t *testing.T) {
 		// test with wildcard to match directory
 		matchedFiles = make(map[string]struct{})
 		pattern = filepath.Join(testDataDir, "n*") // should match "nested" directory
-		err = processStandardGlobPattern(PatternRequest{Pattern: pattern, MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
+		err = processStandardGlobPattern(context.Background(), PatternRequest{Pattern: pattern, MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
 		require.NoError(t, err)
 
 		// recursive traversal should match all files in nested, including subdirectories
@@ -655,7 +751,7 @@ func TestProcessPatterns(t *testing.T) {
 		// test with non-existent pattern
 		matchedFiles = make(map[string]struct{})
 		pattern = filepath.Join(testDataDir, "nonexistent*.xyz")
-		err = processStandardGlobPattern(PatternRequest{Pattern: pattern, MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
+		err = processStandardGlobPattern(context.Background(), PatternRequest{Pattern: pattern, MatchedFiles: matchedFiles, MaxFileSize: defaultMaxFileSize})
 		require.NoError(t, err) // non-matching pattern is not an error
 		assert.Empty(t, matchedFiles)
 	})
@@ -686,7 +782,7 @@ func TestProcessPatterns(t *testing.T) {
 			filepath.Join(testDataDir, "test2.txt"),
 		}
 
-		result, err := formatFileContents(files)
+		result, err := formatFileContents(context.Background(), files, "", 0, WrapperPlain, nil)
 		require.NoError(t, err)
 
 		// check that we have proper headers for each file
@@ -765,7 +861,7 @@ func TestProcessPatterns(t *testing.T) {
 
 		// test excluding by extension
 		excludePatterns := []string{"**/*.txt"}
-		filtered := applyExcludePatterns(matchedFiles, excludePatterns)
+		filtered := applyExcludePatterns(matchedFiles, excludePatterns, "")
 		assert.Len(t, filtered, 3, "Should have 3 files after excluding *.txt")
 		_, hasGo1 := filtered[filepath.Join(testDataDir, "test1.go")]
 		assert.True(t, hasGo1, "Should have test1.go")
@@ -774,14 +870,14 @@ func TestProcessPatterns(t *testing.T) {
 
 		// test excluding by directory
 		excludePatterns = []string{"**/nested/**"}
-		filtered = applyExcludePatterns(matchedFiles, excludePatterns)
+		filtered = applyExcludePatterns(matchedFiles, excludePatterns, "")
 		assert.Len(t, filtered, 2, "Should have 2 files after excluding nested directory")
 		_, hasNested := filtered[filepath.Join(testDataDir, "nested", "test3.go")]
 		assert.False(t, hasNested, "Should not have nested/test3.go")
 
 		// test multiple exclude patterns
 		excludePatterns = []string{"**/*.txt", "**/deep/**"}
-		filtered = applyExcludePatterns(matchedFiles, excludePatterns)
+		filtered = applyExcludePatterns(matchedFiles, excludePatterns, "")
 		assert.Len(t, filtered, 2, "Should have 2 files after excluding *.txt and deep directory")
 		_, hasDeep := filtered[filepath.Join(testDataDir, "nested", "deep", "test4.go")]
 		assert.False(t, hasDeep, "Should not have nested/deep/test4.go")
@@ -789,11 +885,11 @@ func TestProcessPatterns(t *testing.T) {
 		assert.True(t, hasNestedGo, "Should still have nested/test3.go")
 
 		// test no exclude patterns
-		filtered = applyExcludePatterns(matchedFiles, nil)
+		filtered = applyExcludePatterns(matchedFiles, nil, "")
 		assert.Equal(t, matchedFiles, filtered, "Should have all files when no exclude patterns")
 
 		// test empty exclude patterns
-		filtered = applyExcludePatterns(matchedFiles, []string{})
+		filtered = applyExcludePatterns(matchedFiles, []string{}, "")
 		assert.Equal(t, matchedFiles, filtered, "Should have all files when empty exclude patterns")
 	})
 
@@ -814,7 +910,7 @@ func TestProcessPatterns(t *testing.T) {
 
 		// set max file size to 1 byte to force exclusion of both files
 		tinySize := int64(1)
-		result, err := LoadContent(LoadRequest{
+		result, err := LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{file1, file2},
 			ExcludePatterns: nil,
 			MaxFileSize:     tinySize,
@@ -829,7 +925,7 @@ func TestProcessPatterns(t *testing.T) {
 
 		// set max file size to exclude just the larger file
 		mediumSize := int64(math.Min(float64(size1), float64(size2))) + 1
-		result, err = LoadContent(LoadRequest{
+		result, err = LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{file1, file2},
 			ExcludePatterns: nil,
 			MaxFileSize:     mediumSize,
@@ -848,7 +944,7 @@ func TestProcessPatterns(t *testing.T) {
 
 		// set max file size to include both files
 		largeSize := int64(math.Max(float64(size1), float64(size2))) + 1
-		result, err = LoadContent(LoadRequest{
+		result, err = LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{file1, file2},
 			ExcludePatterns: nil,
 			MaxFileSize:     largeSize,
@@ -894,7 +990,7 @@ func TestProcessPatterns(t *testing.T) {
 		}()
 
 		// test without force - should exclude vendor and .gitignore patterns
-		result, err := LoadContent(LoadRequest{
+		result, err := LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{"**/*"},
 			ExcludePatterns: nil,
 			MaxFileSize:     defaultMaxFileSize,
@@ -907,7 +1003,7 @@ func TestProcessPatterns(t *testing.T) {
 		assert.NotContains(t, result, "this should be ignored", "Should respect .gitignore")
 
 		// test with force - should include everything
-		result, err = LoadContent(LoadRequest{
+		result, err = LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{"**/*"},
 			ExcludePatterns: nil,
 			MaxFileSize:     defaultMaxFileSize,
@@ -944,7 +1040,7 @@ func TestProcessPatterns(t *testing.T) {
 
 		// test single concrete path - should auto-enable force
 		vendorFile := filepath.Join(tmpDir, "vendor", "lib.go")
-		result, err := LoadContent(LoadRequest{
+		result, err := LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{vendorFile},
 			ExcludePatterns: nil,
 			MaxFileSize:     defaultMaxFileSize,
@@ -956,7 +1052,7 @@ func TestProcessPatterns(t *testing.T) {
 		// test multiple concrete paths - should auto-enable force
 		nodeFile := filepath.Join(tmpDir, "node_modules", "index.js")
 		ignoredFile := filepath.Join(tmpDir, "ignored.txt")
-		result, err = LoadContent(LoadRequest{
+		result, err = LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{vendorFile, nodeFile, ignoredFile},
 			ExcludePatterns: nil,
 			MaxFileSize:     defaultMaxFileSize,
@@ -968,7 +1064,7 @@ func TestProcessPatterns(t *testing.T) {
 		assert.Contains(t, result, "ignored content", "Multiple concrete paths should bypass .gitignore")
 
 		// test mix of concrete and pattern - should NOT auto-enable force
-		result, err = LoadContent(LoadRequest{
+		result, err = LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{vendorFile, filepath.Join(tmpDir, "*.go")},
 			ExcludePatterns: nil,
 			MaxFileSize:     defaultMaxFileSize,
@@ -1009,7 +1105,7 @@ func TestProcessPatterns(t *testing.T) {
 		}()
 
 		// test with a pattern that will match files but all will be excluded
-		_, err = LoadContent(LoadRequest{
+		_, err = LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{"*.log", "vendor/**", "node_modules/**"},
 			ExcludePatterns: nil,
 			MaxFileSize:     defaultMaxFileSize,
@@ -1023,7 +1119,7 @@ func TestProcessPatterns(t *testing.T) {
 		}
 
 		// test error message for non-existent pattern
-		_, err = LoadContent(LoadRequest{
+		_, err = LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{"*.nonexistent"},
 			ExcludePatterns: nil,
 			MaxFileSize:     defaultMaxFileSize,
@@ -1188,7 +1284,7 @@ func TestProcessPatterns(t *testing.T) {
 		}
 
 		// load all files - should truncate output
-		result, err := LoadContent(LoadRequest{
+		result, err := LoadContent(context.Background(), LoadRequest{
 			Patterns:        []string{filepath.Join(tempDir, "*.txt")},
 			ExcludePatterns: nil,
 			MaxFileSize:     10 * 1024 * 1024,
@@ -1204,3 +1300,171 @@ func TestProcessPatterns(t *testing.T) {
 		assert.LessOrEqual(t, len(result), 10*1024*1024+200) // +200 for the truncation message
 	})
 }
+
+func TestNormalizePatterns(t *testing.T) {
+	patterns := []string{`pkg\files\*.go`, `C:\src\**\*.go`, `cmd\...`, "plain/*.go"}
+	assert.Equal(t, patterns, normalizePatterns(patterns), "backslashes are kept on non-windows platforms")
+
+	defer func(sep rune) { pathSeparator = sep }(pathSeparator)
+	pathSeparator = '\\'
+	assert.Equal(t, []string{"pkg/files/*.go", "C:/src/**/*.go", "cmd/...", "plain/*.go"}, normalizePatterns(patterns))
+	assert.Empty(t, normalizePatterns(nil))
+}
+
+func TestResolvePatterns(t *testing.T) {
+	got := resolvePatterns("/src/project", []string{"*.go", "./pkg/...", "cmd/**/*.go", "/abs/*.md", "C:/src/*.go"})
+	assert.Equal(t, []string{"/src/project/*.go", "/src/project/pkg/...", "/src/project/cmd/**/*.go", "/abs/*.md", "C:/src/*.go"}, got)
+}
+
+func TestIsAbsPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"/tmp/**/*.go", true},
+		{"C:/src/**/*.go", true},
+		{"d:/src/...", true},
+		{"src/**/*.go", false},
+		{"**/*.go", false},
+		{"C:relative", false},
+		{"1:/src", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			assert.Equal(t, tt.want, isAbsPattern(tt.pattern))
+		})
+	}
+}
+
+func TestIsUnderDir(t *testing.T) {
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		filePath string
+		dir      string
+		want     bool
+	}{
+		{"relative under relative", "pkg/files/glob.go", "pkg", true},
+		{"dot-prefixed dir", "pkg/files/glob.go", "./pkg", true},
+		{"sibling with same prefix", "pkgx/glob.go", "pkg", false},
+		{"current dir", "pkg/glob.go", ".", true},
+		{"parent dir", "../other/glob.go", ".", false},
+		{"relative file under absolute dir", "pkg/glob.go", filepath.Join(cwd, "pkg"), true},
+		{"absolute file under relative dir", filepath.Join(cwd, "pkg", "glob.go"), "pkg", true},
+		{"absolute file outside dir", "/somewhere/else.go", "pkg", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isUnderDir(filepath.FromSlash(tt.filePath), filepath.FromSlash(tt.dir)))
+		})
+	}
+}
+
+func TestMatchFiles_PathForms(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, f := range []string{"src/a.go", "src/sub/b.go", "src/sub/c.txt", "other/d.go"} {
+		path := filepath.Join(tmpDir, filepath.FromSlash(f))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o750))
+		require.NoError(t, os.WriteFile(path, []byte("content"), 0o600))
+	}
+	abs := func(f string) string { return filepath.Join(tmpDir, filepath.FromSlash(f)) }
+	slashDir := filepath.ToSlash(tmpDir)
+
+	tests := []struct {
+		name     string
+		patterns []string
+		excludes []string
+		want     []string
+	}{
+		{
+			name:     "absolute bash-style pattern",
+			patterns: []string{slashDir + "/src/**/*.go"},
+			want:     []string{abs("src/a.go"), abs("src/sub/b.go")},
+		},
+		{
+			name:     "absolute go-style pattern with absolute bash-style exclude",
+			patterns: []string{slashDir + "/..."},
+			excludes: []string{slashDir + "/src/sub/**"},
+			want:     []string{abs("other/d.go"), abs("src/a.go")},
+		},
+		{
+			name:     "absolute go-style exclude",
+			patterns: []string{slashDir + "/.../*.go"},
+			excludes: []string{slashDir + "/src/..."},
+			want:     []string{abs("other/d.go")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MatchFiles(context.Background(), LoadRequest{Patterns: tt.patterns, ExcludePatterns: tt.excludes,
+				MaxFileSize: DefaultMaxFileSize})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("backslash patterns on windows", func(t *testing.T) {
+		defer func(sep rune) { pathSeparator = sep }(pathSeparator)
+		pathSeparator = '\\'
+		winDir := strings.ReplaceAll(slashDir, "/", `\`)
+		got, err := MatchFiles(context.Background(), LoadRequest{Patterns: []string{winDir + `\src\**\*.go`, winDir + `\other\...`},
+			MaxFileSize: DefaultMaxFileSize, Force: true})
+		require.NoError(t, err)
+		assert.Equal(t, []string{abs("other/d.go"), abs("src/a.go"), abs("src/sub/b.go")}, got)
+	})
+}
+
+func TestFormatFile(t *testing.T) {
+	assert.Equal(t, "// file: main.go\npackage main\n\n", FormatFile("main.go", "package main"))
+	assert.Equal(t, "# file: conf.yml\nkey: value\n\n", FormatFile("conf.yml", "key: value"))
+	assert.Equal(t, "<!-- file: index.html -->\n<p>hi</p>\n\n", FormatFile("index.html", "<p>hi</p>"))
+}
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    bool
+	}{
+		{name: "text", content: []byte("package main\n"), want: false},
+		{name: "empty", content: nil, want: false},
+		{name: "utf8", content: []byte("привет, мир"), want: false},
+		{name: "nul byte", content: []byte("\x7fELF\x02\x01\x00\x00"), want: true},
+		{name: "nul byte after sniffed prefix", content: append([]byte(strings.Repeat("a", 8000)), 0), want: false},
+		{name: "control characters", content: []byte("\x89PNG\x1a\x02\x03\x04\x05\x06\x07ab"), want: true},
+		{name: "ansi escapes and tabs", content: []byte("\x1b[31mred\x1b[0m\tcol\r\n"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isBinary(tt.content))
+		})
+	}
+}
+
+func TestShouldExcludeFile_Trace(t *testing.T) {
+	var logs bytes.Buffer
+	lgr.Setup(lgr.Trace, lgr.Out(&logs))
+	defer lgr.Setup() // restore default logger
+
+	dir := t.TempDir()
+	req := ExclusionRequest{FilePath: filepath.Join(dir, "a", "b.log"), WorkingDir: dir,
+		ExcludePatterns: []string{"**/*.log", "a/**", "!a/b.log", "a/*.log"}, PatternCount: map[string]int{}}
+
+	assert.True(t, shouldExcludeFile(req))
+	assert.Empty(t, logs.String(), "not logged without trace")
+
+	EnableTrace(true)
+	defer EnableTrace(false)
+	assert.True(t, shouldExcludeFile(req))
+	assert.Equal(t, 1, strings.Count(logs.String(), "\n"), "logged once per file")
+	assert.Contains(t, logs.String(), "excluded by pattern a/*.log")
+	assert.Equal(t, 2, req.PatternCount["a/*.log"])
+
+	logs.Reset()
+	req.ExcludePatterns = req.ExcludePatterns[:3]
+	assert.False(t, shouldExcludeFile(req))
+	assert.Contains(t, logs.String(), "included by negation pattern !a/b.log")
+}
@@ -0,0 +1,66 @@
+package files
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandLists replaces patterns starting with "@" by patterns listed in the file, one pattern per line, e.g.
+// "@context.txt". Blank lines and lines starting with "#" are skipped. Paths of list files are relative to dir,
+// or the current directory if dir is empty, while patterns in them are used as given, like other patterns.
+// Lists can't include other lists.
+func ExpandLists(patterns []string, dir string) ([]string, error) {
+	res := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		name, ok := strings.CutPrefix(p, "@")
+		if !ok {
+			res = append(res, p)
+			continue
+		}
+		if name == "" {
+			return nil, fmt.Errorf("empty list file name in %q", p)
+		}
+		listed, err := readList(name, dir)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, listed...)
+	}
+	return res, nil
+}
+
+// readList returns patterns of the list file
+func readList(name, dir string) ([]string, error) {
+	path := name
+	if dir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	f, err := os.Open(path) //nolint:gosec // list file is given by the user
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file list: %w", err)
+	}
+	defer f.Close()
+
+	var res []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "@") {
+			return nil, fmt.Errorf("%s:%d: nested file list %s is not supported", name, n, line)
+		}
+		res = append(res, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file list %s: %w", name, err)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("file list %s has no patterns", name)
+	}
+	return res, nil
+}
@@ -0,0 +1,49 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandLists(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	write("context.txt", "# backend context\npkg/**/*.go\n\n  cmd/main.go:10-20  \n# docs\nREADME.md\n")
+	write("nested.txt", "main.go\n@context.txt\n")
+	write("empty.txt", "# nothing yet\n\n")
+
+	t.Run("expanded in place", func(t *testing.T) {
+		res, err := ExpandLists([]string{"go.mod", "@context.txt", "*.md"}, dir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"go.mod", "pkg/**/*.go", "cmd/main.go:10-20", "README.md", "*.md"}, res)
+	})
+
+	t.Run("absolute path", func(t *testing.T) {
+		res, err := ExpandLists([]string{"@" + filepath.Join(dir, "context.txt")}, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"pkg/**/*.go", "cmd/main.go:10-20", "README.md"}, res)
+	})
+
+	t.Run("no lists", func(t *testing.T) {
+		res, err := ExpandLists([]string{"a.go", "b/**"}, dir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a.go", "b/**"}, res)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := ExpandLists([]string{"@missing.txt"}, dir)
+		require.ErrorContains(t, err, "failed to open file list")
+		_, err = ExpandLists([]string{"@nested.txt"}, dir)
+		require.EqualError(t, err, "nested.txt:2: nested file list @context.txt is not supported")
+		_, err = ExpandLists([]string{"@empty.txt"}, dir)
+		require.EqualError(t, err, "file list empty.txt has no patterns")
+		_, err = ExpandLists([]string{"@"}, dir)
+		require.EqualError(t, err, `empty list file name in "@"`)
+	})
+}
@@ -0,0 +1,148 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// File is the content of a file included in the prompt, or of lines selected from it
+type File struct {
+	Path      string // path of the file as matched
+	Name      string // name of the file in the header, relative to the directory of the request
+	StartLine int    // first selected line, 0 if the file is included completely
+	EndLine   int    // last selected line, 0 if the file is included completely
+	Content   string
+}
+
+// LoadFiles loads files matching the patterns the same way as LoadContent, but returns the content of each
+// file separately instead of the formatted text, so callers can render or transmit files on their own.
+// Files beyond the total size limit of LoadContent are skipped.
+func LoadFiles(ctx context.Context, req LoadRequest) ([]File, error) {
+	if len(req.Patterns) == 0 {
+		return nil, nil
+	}
+
+	plain, selections, err := splitSelectors(req.Patterns)
+	if err != nil {
+		return nil, err
+	}
+	cwd, err := workingDir(req.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []File
+	whole := make(map[string]bool)
+	if len(plain) > 0 {
+		r := req
+		r.Patterns = plain
+		matched, err := MatchFiles(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range matched {
+			whole[f] = true
+		}
+
+		totalSize := 0
+		var readErr error
+		err = readFiles(ctx, matched, req.Workers, 0, func(i int, fr fileResult) bool {
+			if fr.err != nil {
+				readErr = fr.err
+				return false
+			}
+			if fr.skip {
+				return true
+			}
+			if totalSize+len(fr.content) > maxTotalOutputSize {
+				lgr.Printf("[WARN] reached total output size limit of %d bytes, skipping remaining %d files", maxTotalOutputSize, len(matched)-i)
+				return false
+			}
+			totalSize += len(fr.content)
+			res = append(res, File{Path: fr.file, Name: relativeName(cwd, fr.file),
+				Content: summarize(req.Ecosystems, fr.file, string(fr.content))})
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+	if len(selections) == 0 {
+		return res, nil
+	}
+
+	chunks, err := loadSelections(ctx, req, selections, whole)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := ChunkFiles(chunks, req.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return append(res, selected...), nil
+}
+
+// ReadFile returns the content of the file converted to UTF-8, read the same way as files of LoadContent.
+// Binary files and files larger than maxFileSize, if positive, are not read and reported as errors.
+func ReadFile(file string, maxFileSize int64) (string, error) {
+	fr := readFile(file, maxFileSize)
+	switch {
+	case fr.err != nil:
+		return "", fr.err
+	case fr.tooLarge:
+		return "", fmt.Errorf("file %s of %d bytes exceeds max file size %d", file, fr.size, maxFileSize)
+	case fr.skip:
+		return "", fmt.Errorf("file %s is binary", file)
+	}
+	return string(fr.content), nil
+}
+
+// ChunkFiles converts chunks to files with selected lines, merging adjacent chunks of the same file.
+// Names of files are relative to dir, or the current directory if dir is empty.
+func ChunkFiles(chunks []Chunk, dir string) ([]File, error) {
+	cwd, err := workingDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []File
+	for _, c := range chunks {
+		if n := len(res); n > 0 && res[n-1].Path == c.File && res[n-1].EndLine+1 == c.StartLine {
+			res[n-1].EndLine = c.EndLine
+			res[n-1].Content += "\n" + c.Content
+			continue
+		}
+		res = append(res, File{Path: c.File, Name: relativeName(cwd, c.File), StartLine: c.StartLine,
+			EndLine: c.EndLine, Content: c.Content})
+	}
+	return res, nil
+}
+
+// FormatFiles creates a formatted string with contents of the files wrapped by the wrapper, the same way
+// as LoadContent formats them
+func FormatFiles(files []File, wrapper Wrapper) string {
+	var sb strings.Builder
+	for _, f := range files {
+		lines := ""
+		if f.StartLine > 0 {
+			lines = fmt.Sprintf("%d-%d", f.StartLine, f.EndLine)
+		}
+		sb.WriteString(wrapper.wrap(f.Name, lines, f.Content))
+	}
+	return sb.String()
+}
+
+// relativeName returns the name of the file relative to the directory, or the file path if it can't be made relative
+func relativeName(dir, file string) string {
+	if rel, err := filepath.Rel(dir, file); err == nil {
+		return rel
+	}
+	return file
+}
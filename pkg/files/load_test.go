@@ -0,0 +1,75 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("line 1\nline 2\nline 3\nline 4\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bin.dat"), []byte{'a', 0, 'b'}, 0o600))
+
+	req := LoadRequest{Patterns: []string{"*.go", "*.dat", "b.txt:2-3"}, Dir: dir, MaxFileSize: DefaultMaxFileSize,
+		Wrapper: WrapperXML}
+	res, err := LoadFiles(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, []File{
+		{Path: filepath.Join(dir, "a.go"), Name: "a.go", Content: "package a\n"},
+		{Path: filepath.Join(dir, "b.txt"), Name: "b.txt", StartLine: 2, EndLine: 3, Content: "line 2\nline 3"},
+	}, res, "binary file skipped")
+
+	content, err := LoadContent(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, content, FormatFiles(res, WrapperXML), "formatted the same way as LoadContent")
+
+	t.Run("no patterns", func(t *testing.T) {
+		res, err := LoadFiles(context.Background(), LoadRequest{})
+		require.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+	t.Run("no files matched", func(t *testing.T) {
+		_, err := LoadFiles(context.Background(), LoadRequest{Patterns: []string{"*.rs"}, Dir: dir})
+		require.ErrorContains(t, err, "no files matched")
+	})
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	text, bin := filepath.Join(dir, "a.txt"), filepath.Join(dir, "bin.dat")
+	require.NoError(t, os.WriteFile(text, []byte("line 1\nline 2\n"), 0o600))
+	require.NoError(t, os.WriteFile(bin, []byte{'a', 0, 'b'}, 0o600))
+
+	res, err := ReadFile(text, DefaultMaxFileSize)
+	require.NoError(t, err)
+	assert.Equal(t, "line 1\nline 2\n", res)
+
+	_, err = ReadFile(text, 5)
+	require.EqualError(t, err, "file "+text+" of 14 bytes exceeds max file size 5")
+	_, err = ReadFile(bin, 0)
+	require.EqualError(t, err, "file "+bin+" is binary")
+	_, err = ReadFile(filepath.Join(dir, "missing.txt"), 0)
+	require.ErrorContains(t, err, "failed to read file")
+}
+
+func TestChunkFiles(t *testing.T) {
+	dir := t.TempDir()
+	chunks := []Chunk{
+		{File: filepath.Join(dir, "a.go"), StartLine: 1, EndLine: 2, Content: "l1\nl2"},
+		{File: filepath.Join(dir, "a.go"), StartLine: 3, EndLine: 3, Content: "l3"},
+		{File: filepath.Join(dir, "a.go"), StartLine: 10, EndLine: 11, Content: "l10\nl11"},
+	}
+	res, err := ChunkFiles(chunks, dir)
+	require.NoError(t, err)
+	assert.Equal(t, []File{
+		{Path: filepath.Join(dir, "a.go"), Name: "a.go", StartLine: 1, EndLine: 3, Content: "l1\nl2\nl3"},
+		{Path: filepath.Join(dir, "a.go"), Name: "a.go", StartLine: 10, EndLine: 11, Content: "l10\nl11"},
+	}, res)
+}
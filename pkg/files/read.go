@@ -0,0 +1,104 @@
+package files
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultWorkers defines the default number of workers reading files concurrently
+const DefaultWorkers = 8
+
+// fileResult is the result of reading a single file by the pool of workers
+type fileResult struct {
+	file     string
+	content  []byte
+	size     int64 // file size, set for too large files only
+	skip     bool  // binary file, content is not set
+	tooLarge bool  // file exceeds max size and is not read
+	err      error
+}
+
+// readFiles stats and reads files with a bounded pool of workers and calls fn with index and result of each
+// file in the order of files, so the result is deterministic regardless of the order reads complete in. Files larger than
+// maxFileSize, if positive, are not read and reported as too large. Reading stops if fn returns false.
+// At most 2*workers files are read ahead of fn, to keep memory bounded for large file sets.
+// Reading stops if the context is done, returning its error.
+func readFiles(ctx context.Context, files []string, workers int, maxFileSize int64, fn func(i int, res fileResult) bool) error {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	workers = min(workers, len(files))
+	if workers == 0 {
+		return nil
+	}
+
+	results := make([]chan fileResult, len(files))
+	for i := range results {
+		results[i] = make(chan fileResult, 1)
+	}
+	jobs := make(chan int)
+	done := make(chan struct{})
+	ahead := make(chan struct{}, 2*workers) // slots of files read but not consumed by fn yet
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] <- readFile(files[i], maxFileSize)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range files {
+			select {
+			case ahead <- struct{}{}:
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+
+	for i := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var res fileResult
+		select {
+		case res = <-results[i]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		<-ahead
+		if !fn(i, res) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// readFile checks size of the file and reads it, binary files are marked as skipped
+func readFile(file string, maxFileSize int64) fileResult {
+	if maxFileSize > 0 {
+		if tooLarge, size := isFileTooLarge(file, maxFileSize); tooLarge {
+			return fileResult{file: file, size: size, tooLarge: true}
+		}
+	}
+	content, skip, err := readFileContent(file)
+	return fileResult{file: file, content: content, skip: skip, err: err}
+}
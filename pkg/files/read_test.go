@@ -0,0 +1,102 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := make([]string, 0, 50)
+	for i := range 50 {
+		file := filepath.Join(dir, fmt.Sprintf("file%02d.txt", i))
+		require.NoError(t, os.WriteFile(file, []byte(fmt.Sprintf("content %d", i)), 0o600))
+		files = append(files, file)
+	}
+	large := filepath.Join(dir, "large.txt")
+	require.NoError(t, os.WriteFile(large, make([]byte, 100), 0o600))
+	binary := filepath.Join(dir, "binary.bin")
+	require.NoError(t, os.WriteFile(binary, []byte{'a', 0, 'b'}, 0o600))
+
+	for _, workers := range []int{0, 1, 3, 100} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			var got []string
+			err := readFiles(context.Background(), files, workers, 0, func(i int, res fileResult) bool {
+				require.NoError(t, res.err)
+				assert.Equal(t, files[i], res.file)
+				got = append(got, string(res.content))
+				return true
+			})
+			require.NoError(t, err)
+			require.Len(t, got, len(files))
+			for i, content := range got {
+				assert.Equal(t, fmt.Sprintf("content %d", i), content, "order of files kept")
+			}
+		})
+	}
+
+	t.Run("stop early", func(t *testing.T) {
+		calls := 0
+		err := readFiles(context.Background(), files, 4, 0, func(i int, res fileResult) bool {
+			calls++
+			return i < 4
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 5, calls)
+	})
+
+	t.Run("too large, binary and missing files", func(t *testing.T) {
+		var results []fileResult
+		err := readFiles(context.Background(), []string{large, binary, filepath.Join(dir, "missing.txt")}, 2, 50, func(_ int, res fileResult) bool {
+			results = append(results, res)
+			return true
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		assert.Equal(t, fileResult{file: large, size: 100, tooLarge: true}, results[0])
+		assert.True(t, results[1].skip)
+		assert.Empty(t, results[1].content)
+		require.ErrorContains(t, results[2].err, "failed to read file")
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		err := readFiles(ctx, files, 2, 0, func(int, fileResult) bool {
+			calls++
+			if calls == 3 {
+				cancel()
+			}
+			return true
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, calls, len(files))
+	})
+
+	t.Run("no files", func(t *testing.T) {
+		err := readFiles(context.Background(), nil, 4, 0, func(int, fileResult) bool {
+			t.Fatal("unexpected call")
+			return true
+		})
+		require.NoError(t, err)
+	})
+}
+
+func TestLoadContent_Workers(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 30 {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%02d.go", i)), []byte(fmt.Sprintf("package f%d", i)), 0o600))
+	}
+	sequential, err := LoadContent(context.Background(), LoadRequest{Patterns: []string{"*.go"}, Dir: dir, Workers: 1, MaxFileSize: DefaultMaxFileSize})
+	require.NoError(t, err)
+	parallel, err := LoadContent(context.Background(), LoadRequest{Patterns: []string{"*.go"}, Dir: dir, Workers: 16, MaxFileSize: DefaultMaxFileSize})
+	require.NoError(t, err)
+	assert.Equal(t, sequential, parallel, "same output regardless of workers")
+	assert.Contains(t, parallel, "package f29")
+}
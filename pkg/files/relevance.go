@@ -0,0 +1,180 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/go-pkgz/lgr"
+
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+// DefaultChunkLines defines the default number of lines in a file chunk used for relevance scoring
+const DefaultChunkLines = 100
+
+const maxEmbedInputSize = 8 * 1024 // max size of text sent for embedding, longer chunks are cut
+
+// RelevanceRequest holds the parameters for selecting file chunks relevant to a query
+type RelevanceRequest struct {
+	Query       string            // text to compare chunks with, usually the prompt
+	Files       []string          // candidate files
+	Embedder    provider.Embedder // embedder used for both query and chunks
+	TopK        int               // max number of chunks to select, 0 means no limit
+	MinScore    float64           // min cosine similarity of selected chunks
+	ChunkLines  int               // number of lines per chunk, DefaultChunkLines if not set
+	MaxFileSize int64             // max size of candidate files, larger files are skipped, no limit if not set
+	Workers     int               // number of workers reading files concurrently, DefaultWorkers if not set
+}
+
+// Chunk represents a range of lines from a file along with its relevance score
+type Chunk struct {
+	File      string
+	StartLine int
+	EndLine   int
+	Content   string
+	Score     float64
+}
+
+// SelectRelevant splits candidate files into chunks, scores each chunk by cosine similarity of its
+// embedding to the query embedding and returns the top-K chunks scored at least MinScore.
+// Binary and too large files are skipped the same way as for full file content.
+// Returned chunks are ordered by file and line to keep the context readable.
+func SelectRelevant(ctx context.Context, req RelevanceRequest) ([]Chunk, error) {
+	if req.Embedder == nil {
+		return nil, fmt.Errorf("embedder is not set")
+	}
+	chunkLines := req.ChunkLines
+	if chunkLines <= 0 {
+		chunkLines = DefaultChunkLines
+	}
+
+	var chunks []Chunk
+	var readErr error
+	totalSize := 0
+	err := readFiles(ctx, req.Files, req.Workers, req.MaxFileSize, func(i int, res fileResult) bool {
+		switch {
+		case res.err != nil:
+			readErr = res.err
+			return false
+		case res.tooLarge:
+			lgr.Printf("[DEBUG] skipping file %s, size %d exceeds limit %d", res.file, res.size, req.MaxFileSize)
+			return true
+		case res.skip:
+			return true
+		}
+		if totalSize+len(res.content) > maxTotalOutputSize {
+			lgr.Printf("[WARN] reached total output size limit of %d bytes, skipping remaining %d files", maxTotalOutputSize, len(req.Files)-i)
+			return false
+		}
+		totalSize += len(res.content)
+		chunks = append(chunks, splitChunks(res.file, string(res.content), chunkLines)...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+
+	queryVec, err := req.Embedder.Embed(ctx, []string{embedInput(req.Query)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	if len(queryVec) != 1 {
+		return nil, fmt.Errorf("unexpected number of query embeddings: %d", len(queryVec))
+	}
+
+	for start := 0; start < len(chunks); start += provider.DefaultEmbeddingBatchSize {
+		end := min(start+provider.DefaultEmbeddingBatchSize, len(chunks))
+		texts := make([]string, 0, end-start)
+		for _, c := range chunks[start:end] {
+			texts = append(texts, embedInput(c.File+"\n"+c.Content))
+		}
+		vectors, err := req.Embedder.Embed(ctx, texts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed file chunks: %w", err)
+		}
+		if len(vectors) != len(texts) {
+			return nil, fmt.Errorf("unexpected number of chunk embeddings: %d, expected %d", len(vectors), len(texts))
+		}
+		for i, v := range vectors {
+			chunks[start+i].Score = cosineSimilarity(queryVec[0], v)
+		}
+	}
+
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].Score > chunks[j].Score })
+	selected := make([]Chunk, 0, len(chunks))
+	for _, c := range chunks {
+		if c.Score < req.MinScore || (req.TopK > 0 && len(selected) >= req.TopK) {
+			break
+		}
+		selected = append(selected, c)
+	}
+	lgr.Printf("[DEBUG] selected %d of %d chunks from %d files by relevance", len(selected), len(chunks), len(req.Files))
+
+	sort.Slice(selected, func(i, j int) bool {
+		if selected[i].File != selected[j].File {
+			return selected[i].File < selected[j].File
+		}
+		return selected[i].StartLine < selected[j].StartLine
+	})
+	return selected, nil
+}
+
+// FormatChunks creates a formatted string with chunk contents, merging adjacent chunks of the same file.
+// Each chunk is wrapped with the file name relative to dir, or the current directory if dir is empty,
+// and the line range.
+func FormatChunks(chunks []Chunk, dir string, wrapper Wrapper) (string, error) {
+	files, err := ChunkFiles(chunks, dir)
+	if err != nil {
+		return "", err
+	}
+	return FormatFiles(files, wrapper), nil
+}
+
+// splitChunks splits file content into chunks of up to chunkLines lines, skipping blank chunks
+func splitChunks(file, content string, chunkLines int) []Chunk {
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	var res []Chunk
+	for start := 0; start < len(lines); start += chunkLines {
+		end := min(start+chunkLines, len(lines))
+		text := strings.Join(lines[start:end], "\n")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		res = append(res, Chunk{File: file, StartLine: start + 1, EndLine: end, Content: text})
+	}
+	return res
+}
+
+// embedInput cuts text to the max size accepted for embedding
+func embedInput(text string) string {
+	if len(text) <= maxEmbedInputSize {
+		return text
+	}
+	return strings.ToValidUTF8(text[:maxEmbedInputSize], "")
+}
+
+// cosineSimilarity returns cosine similarity of two vectors, 0 for empty or mismatched vectors
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,137 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keywordEmbedder creates vectors with one dimension per keyword, set if the text mentions it
+type keywordEmbedder struct {
+	keywords []string
+	calls    int
+	err      error
+}
+
+func (e *keywordEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	if e.err != nil {
+		return nil, e.err
+	}
+	res := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vec := make([]float32, len(e.keywords))
+		for i, k := range e.keywords {
+			if strings.Contains(text, k) {
+				vec[i] = 1
+			}
+		}
+		res = append(res, vec)
+	}
+	return res, nil
+}
+
+func TestSelectRelevant(t *testing.T) {
+	dir := t.TempDir()
+	apple := filepath.Join(dir, "apple.go")
+	mixed := filepath.Join(dir, "mixed.go")
+	empty := filepath.Join(dir, "empty.go")
+	require.NoError(t, os.WriteFile(apple, []byte("apple one\napple two\napple three\n"), 0o600))
+	require.NoError(t, os.WriteFile(mixed, []byte("banana\ncherry\napple\n\n\n\n"), 0o600))
+	require.NoError(t, os.WriteFile(empty, []byte("\n\n"), 0o600))
+
+	tests := []struct {
+		name     string
+		topK     int
+		minScore float64
+		want     []Chunk
+	}{
+		{
+			name: "top 2 ordered by file and line", topK: 2,
+			want: []Chunk{
+				{File: apple, StartLine: 1, EndLine: 2, Content: "apple one\napple two", Score: 1},
+				{File: apple, StartLine: 3, EndLine: 3, Content: "apple three", Score: 1},
+			},
+		},
+		{
+			name: "min score filters unrelated chunks", minScore: 0.5,
+			want: []Chunk{
+				{File: apple, StartLine: 1, EndLine: 2, Content: "apple one\napple two", Score: 1},
+				{File: apple, StartLine: 3, EndLine: 3, Content: "apple three", Score: 1},
+				{File: mixed, StartLine: 3, EndLine: 3, Content: "apple", Score: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emb := &keywordEmbedder{keywords: []string{"apple", "banana", "cherry"}}
+			got, err := SelectRelevant(context.Background(), RelevanceRequest{
+				Query:      "tell me about apple",
+				Files:      []string{apple, mixed, empty},
+				Embedder:   emb,
+				TopK:       tt.topK,
+				MinScore:   tt.minScore,
+				ChunkLines: 2,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, 2, emb.calls) // query and a single batch of chunks
+		})
+	}
+
+	t.Run("embedder error", func(t *testing.T) {
+		_, err := SelectRelevant(context.Background(), RelevanceRequest{Query: "q", Files: []string{apple},
+			Embedder: &keywordEmbedder{err: errors.New("quota exceeded")}})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "quota exceeded")
+	})
+
+	t.Run("binary and too large files skipped", func(t *testing.T) {
+		binary := filepath.Join(dir, "apple.bin")
+		large := filepath.Join(dir, "large.go")
+		require.NoError(t, os.WriteFile(binary, []byte("apple\x00\x01\x02"), 0o600))
+		require.NoError(t, os.WriteFile(large, []byte(strings.Repeat("apple\n", 100)), 0o600))
+		got, err := SelectRelevant(context.Background(), RelevanceRequest{Query: "apple", Files: []string{apple, binary, large},
+			Embedder: &keywordEmbedder{keywords: []string{"apple"}}, MaxFileSize: 100})
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, apple, got[0].File)
+	})
+
+	t.Run("no embedder", func(t *testing.T) {
+		_, err := SelectRelevant(context.Background(), RelevanceRequest{Query: "q", Files: []string{apple}})
+		require.EqualError(t, err, "embedder is not set")
+	})
+}
+
+func TestFormatChunks(t *testing.T) {
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	chunks := []Chunk{
+		{File: filepath.Join(cwd, "a.go"), StartLine: 1, EndLine: 2, Content: "l1\nl2"},
+		{File: filepath.Join(cwd, "a.go"), StartLine: 3, EndLine: 3, Content: "l3"},
+		{File: filepath.Join(cwd, "a.go"), StartLine: 10, EndLine: 11, Content: "l10\nl11"},
+		{File: filepath.Join(cwd, "b.py"), StartLine: 1, EndLine: 1, Content: "x = 1"},
+	}
+	got, err := FormatChunks(chunks, "", "")
+	require.NoError(t, err)
+	expected := "// file: a.go (lines 1-3)\nl1\nl2\nl3\n\n" +
+		"// file: a.go (lines 10-11)\nl10\nl11\n\n" +
+		"# file: b.py (lines 1-1)\nx = 1\n\n"
+	assert.Equal(t, expected, got)
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	assert.InDelta(t, 1.0, cosineSimilarity([]float32{1, 2}, []float32{2, 4}), 1e-9)
+	assert.InDelta(t, 0.0, cosineSimilarity([]float32{1, 0}, []float32{0, 1}), 1e-9)
+	assert.InDelta(t, 0.0, cosineSimilarity([]float32{1, 0}, []float32{1}), 1e-9)
+	assert.InDelta(t, 0.0, cosineSimilarity([]float32{0, 0}, []float32{1, 1}), 1e-9)
+}
@@ -0,0 +1,265 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// selector restricts content included from matched files to line ranges or to a Go function
+type selector struct {
+	ranges []lineRange // line ranges, for "main.go:100-250" selectors
+	symbol string      // function or method name, "Type.Method" for a method of the given type
+}
+
+// lineRange is an inclusive range of 1-based line numbers
+type lineRange struct {
+	start, end int
+}
+
+// selection is a file pattern with a selector
+type selection struct {
+	pattern string
+	sel     selector
+}
+
+var (
+	reRangeSelector = regexp.MustCompile(`^\d+(-\d*)?(,\d+(-\d*)?)*$`)
+	reFuncSelector  = regexp.MustCompile(`^func=([A-Za-z_]\w*\.)?[A-Za-z_]\w*$`)
+)
+
+// splitSelector splits the pattern into the file pattern and the selector, like "main.go:100-250",
+// "main.go:10,20-30", "main.go:100-" (to the end of file) or "pkg/...:func=HandleRequest".
+// A pattern without selector suffix is returned as is with nil selector.
+func splitSelector(pattern string) (string, *selector, error) {
+	idx := strings.LastIndex(pattern, ":")
+	if idx <= 0 {
+		return pattern, nil, nil
+	}
+	filePattern, spec := pattern[:idx], pattern[idx+1:]
+
+	if strings.HasPrefix(spec, "func=") {
+		if !reFuncSelector.MatchString(spec) {
+			return "", nil, fmt.Errorf("invalid function selector %q in %q", spec, pattern)
+		}
+		return filePattern, &selector{symbol: strings.TrimPrefix(spec, "func=")}, nil
+	}
+	if !reRangeSelector.MatchString(spec) {
+		return pattern, nil, nil // colon is a part of the file name
+	}
+
+	sel := &selector{}
+	for _, part := range strings.Split(spec, ",") {
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		start, _ := strconv.Atoi(startStr)
+		end := start
+		switch {
+		case isRange && endStr == "":
+			end = 0 // to the end of file
+		case isRange:
+			end, _ = strconv.Atoi(endStr)
+		}
+		if start < 1 || (end != 0 && end < start) {
+			return "", nil, fmt.Errorf("invalid line range %q in %q", part, pattern)
+		}
+		sel.ranges = append(sel.ranges, lineRange{start: start, end: end})
+	}
+	return filePattern, sel, nil
+}
+
+// splitSelectors separates patterns without selectors from patterns with selectors
+func splitSelectors(patterns []string) (plain []string, selections []selection, err error) {
+	for _, p := range patterns {
+		filePattern, sel, err := splitSelector(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		if sel == nil {
+			plain = append(plain, filePattern)
+			continue
+		}
+		selections = append(selections, selection{pattern: filePattern, sel: *sel})
+	}
+	return plain, selections, nil
+}
+
+// stripSelectors returns file patterns with selectors removed
+func stripSelectors(patterns []string) ([]string, error) {
+	res := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		filePattern, _, err := splitSelector(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, filePattern)
+	}
+	return res, nil
+}
+
+// selectRanges returns line ranges of the file content selected by the selector, clamped to the number of lines.
+// The range of a Go function includes its doc comment; files without the function have no ranges.
+func (s selector) selectRanges(file, content string, lines int) ([]lineRange, error) {
+	if s.symbol == "" {
+		res := make([]lineRange, 0, len(s.ranges))
+		for _, r := range s.ranges {
+			if r.end == 0 || r.end > lines {
+				r.end = lines
+			}
+			if r.start > r.end {
+				lgr.Printf("[WARN] line range %d-%d is beyond the end of %s with %d lines", r.start, r.end, file, lines)
+				continue
+			}
+			res = append(res, r)
+		}
+		return res, nil
+	}
+
+	if filepath.Ext(file) != ".go" {
+		return nil, nil
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, content, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	recv, name, isMethod := strings.Cut(s.symbol, ".")
+	if !isMethod {
+		name, recv = recv, ""
+	}
+	var res []lineRange
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != name || (recv != "" && receiverType(fn) != recv) {
+			continue
+		}
+		start := fn.Pos()
+		if fn.Doc != nil {
+			start = fn.Doc.Pos()
+		}
+		res = append(res, lineRange{start: fset.Position(start).Line, end: fset.Position(fn.End()).Line})
+	}
+	return res, nil
+}
+
+// receiverType returns the type name of the method receiver, empty for functions
+func receiverType(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return ""
+	}
+	expr := fn.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.IndexExpr: // generic type with a single type parameter
+		if id, ok := t.X.(*ast.Ident); ok {
+			return id.Name
+		}
+	case *ast.IndexListExpr: // generic type with multiple type parameters
+		if id, ok := t.X.(*ast.Ident); ok {
+			return id.Name
+		}
+	}
+	return ""
+}
+
+// mergeRanges sorts ranges and merges overlapping and adjacent ones
+func mergeRanges(ranges []lineRange) []lineRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+	var res []lineRange
+	for _, r := range ranges {
+		if n := len(res); n > 0 && r.start <= res[n-1].end+1 {
+			res[n-1].end = max(res[n-1].end, r.end)
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// loadSelections loads line ranges selected from files matching selection patterns as chunks, ordered by
+// file and line. Files in skip are loaded completely by other patterns and are not selected from.
+func loadSelections(ctx context.Context, req LoadRequest, selections []selection, skip map[string]bool) ([]Chunk, error) {
+	selected := make(map[string][]selector) // file -> selectors
+	var lookup []selection                  // function selections expected to be found in selected files
+	for _, s := range selections {
+		r := req
+		r.Patterns = []string{s.pattern}
+		matched, err := MatchFiles(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		included := false // some matched file is included completely and may have the function
+		for _, file := range matched {
+			if skip[file] {
+				included = true
+				continue
+			}
+			selected[file] = append(selected[file], s.sel)
+		}
+		if !included && s.sel.symbol != "" {
+			lookup = append(lookup, s)
+		}
+	}
+
+	files := make([]string, 0, len(selected))
+	for file := range selected {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var chunks []Chunk
+	var readErr error
+	found := make(map[string]bool) // function selectors found in any file
+	err := readFiles(ctx, files, req.Workers, 0, func(_ int, res fileResult) bool {
+		if res.err != nil {
+			readErr = res.err
+			return false
+		}
+		if res.skip {
+			return true
+		}
+		lines := strings.Split(strings.TrimRight(string(res.content), "\n"), "\n")
+		var ranges []lineRange
+		for _, sel := range selected[res.file] {
+			r, err := sel.selectRanges(res.file, string(res.content), len(lines))
+			if err != nil {
+				readErr = err
+				return false
+			}
+			if sel.symbol != "" && len(r) > 0 {
+				found[sel.symbol] = true
+			}
+			ranges = append(ranges, r...)
+		}
+		for _, r := range mergeRanges(ranges) {
+			chunks = append(chunks, Chunk{File: res.file, StartLine: r.start, EndLine: r.end,
+				Content: strings.Join(lines[r.start-1:r.end], "\n")})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	for _, s := range lookup {
+		if !found[s.sel.symbol] {
+			return nil, fmt.Errorf("function %s not found in files matching %s", s.sel.symbol, s.pattern)
+		}
+	}
+	return chunks, nil
+}
@@ -0,0 +1,158 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitSelector(t *testing.T) {
+	tests := []struct {
+		name        string
+		pattern     string
+		wantPattern string
+		wantSel     *selector
+		wantErr     string
+	}{
+		{name: "no selector", pattern: "main.go", wantPattern: "main.go"},
+		{name: "single line", pattern: "main.go:10", wantPattern: "main.go", wantSel: &selector{ranges: []lineRange{{10, 10}}}},
+		{name: "range", pattern: "main.go:100-250", wantPattern: "main.go", wantSel: &selector{ranges: []lineRange{{100, 250}}}},
+		{name: "open range", pattern: "main.go:100-", wantPattern: "main.go", wantSel: &selector{ranges: []lineRange{{100, 0}}}},
+		{name: "multiple ranges", pattern: "pkg/**/*.go:1,5-7", wantPattern: "pkg/**/*.go",
+			wantSel: &selector{ranges: []lineRange{{1, 1}, {5, 7}}}},
+		{name: "function", pattern: "pkg/...:func=HandleRequest", wantPattern: "pkg/...", wantSel: &selector{symbol: "HandleRequest"}},
+		{name: "method", pattern: "pkg/...:func=Server.Run", wantPattern: "pkg/...", wantSel: &selector{symbol: "Server.Run"}},
+		{name: "windows drive", pattern: `C:\project\main.go`, wantPattern: `C:\project\main.go`},
+		{name: "colon in name", pattern: "notes:draft.md", wantPattern: "notes:draft.md"},
+		{name: "reversed range", pattern: "main.go:20-10", wantErr: `invalid line range "20-10"`},
+		{name: "zero line", pattern: "main.go:0-10", wantErr: `invalid line range "0-10"`},
+		{name: "invalid function", pattern: "main.go:func=a.b.c", wantErr: `invalid function selector "func=a.b.c"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, sel, err := splitSelector(tt.pattern)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPattern, pattern)
+			assert.Equal(t, tt.wantSel, sel)
+		})
+	}
+}
+
+func TestSelector_SelectRanges(t *testing.T) {
+	src := `package p
+
+// Run starts the server
+func (s *Server) Run() error {
+	return nil
+}
+
+func Run() {}
+
+func (c Cache[K, V]) Get(k K) V {
+	var v V
+	return v
+}
+`
+	lines := strings.Count(src, "\n")
+	tests := []struct {
+		name string
+		file string
+		sel  selector
+		want []lineRange
+	}{
+		{name: "ranges clamped", file: "p.go", sel: selector{ranges: []lineRange{{2, 3}, {10, 0}, {12, 100}, {50, 60}}},
+			want: []lineRange{{2, 3}, {10, 13}, {12, 13}}},
+		{name: "function", file: "p.go", sel: selector{symbol: "Run"}, want: []lineRange{{3, 6}, {8, 8}}},
+		{name: "method", file: "p.go", sel: selector{symbol: "Server.Run"}, want: []lineRange{{3, 6}}},
+		{name: "generic method", file: "p.go", sel: selector{symbol: "Cache.Get"}, want: []lineRange{{10, 13}}},
+		{name: "not found", file: "p.go", sel: selector{symbol: "Stop"}},
+		{name: "not a go file", file: "p.txt", sel: selector{symbol: "Run"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.sel.selectRanges(tt.file, src, lines)
+			require.NoError(t, err)
+			if len(tt.want) == 0 {
+				assert.Empty(t, got)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := selector{symbol: "Run"}.selectRanges("broken.go", "package p\nfunc {", 2)
+	require.ErrorContains(t, err, "failed to parse broken.go")
+}
+
+func TestMergeRanges(t *testing.T) {
+	assert.Equal(t, []lineRange{{1, 7}, {10, 12}}, mergeRanges([]lineRange{{10, 12}, {5, 7}, {1, 4}, {2, 3}}))
+	assert.Empty(t, mergeRanges(nil))
+}
+
+func TestLoadContent_Selectors(t *testing.T) {
+	dir := t.TempDir()
+	var sb strings.Builder
+	for i := 1; i <= 20; i++ {
+		sb.WriteString("line " + strings.Repeat("x", i) + "\n")
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data.txt"), []byte(sb.String()), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "pkg"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pkg", "handler.go"),
+		[]byte("package pkg\n\n// HandleRequest handles it\nfunc HandleRequest() {\n\tprintln(1)\n}\n\nfunc other() {}\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pkg", "util.go"), []byte("package pkg\n\nfunc util() {}\n"), 0o600))
+
+	load := func(patterns ...string) (string, error) {
+		return LoadContent(context.Background(), LoadRequest{Patterns: patterns, Dir: dir, MaxFileSize: DefaultMaxFileSize})
+	}
+
+	t.Run("line ranges", func(t *testing.T) {
+		res, err := load("data.txt:2-3,19-")
+		require.NoError(t, err)
+		assert.Contains(t, res, "data.txt (lines 2-3)\nline xx\nline xxx\n")
+		assert.Contains(t, res, "data.txt (lines 19-20)\n")
+		assert.NotContains(t, res, "line x\n")
+		assert.NotContains(t, res, "line xxxx\n")
+	})
+
+	t.Run("function", func(t *testing.T) {
+		res, err := load("pkg/...:func=HandleRequest")
+		require.NoError(t, err)
+		assert.Contains(t, res, filepath.Join("pkg", "handler.go")+" (lines 3-6)\n// HandleRequest handles it\nfunc HandleRequest() {")
+		assert.NotContains(t, res, "func other")
+		assert.NotContains(t, res, "util.go")
+	})
+
+	t.Run("with plain patterns", func(t *testing.T) {
+		res, err := load("pkg/util.go", "pkg/...:func=util", "data.txt:1")
+		require.NoError(t, err)
+		assert.Contains(t, res, "func util() {}")
+		assert.Equal(t, 1, strings.Count(res, "func util()"), "file included completely is not repeated")
+		assert.Contains(t, res, "data.txt (lines 1-1)\nline x\n")
+	})
+
+	t.Run("function not found", func(t *testing.T) {
+		_, err := load("pkg/...:func=Missing")
+		require.ErrorContains(t, err, "function Missing not found in files matching pkg/...")
+	})
+
+	t.Run("invalid selector", func(t *testing.T) {
+		_, err := load("data.txt:5-1")
+		require.ErrorContains(t, err, "invalid line range")
+	})
+
+	t.Run("match files ignores selectors", func(t *testing.T) {
+		files, err := MatchFiles(context.Background(), LoadRequest{Patterns: []string{"data.txt:1-2"}, Dir: dir, MaxFileSize: DefaultMaxFileSize})
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		assert.Equal(t, "data.txt", filepath.Base(files[0]))
+	})
+}
@@ -0,0 +1,92 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// walkOptions holds parameters of directory traversal
+type walkOptions struct {
+	followSymlinks    bool // descend into symlinked directories
+	includeSubmodules bool // descend into git submodules
+}
+
+// walkFiles walks the directory tree rooted at root and calls fn for each regular file, including symlinked files.
+// Symlinked directories are followed only if followSymlinks is set. Each directory is visited once, based on its
+// resolved path, which prevents symlink loops and duplicates. Git submodules are skipped unless includeSubmodules is set.
+// The walk stops if the context is done, returning its error.
+func walkFiles(ctx context.Context, root string, opts walkOptions, fn func(path string, info os.FileInfo)) error {
+	if _, err := os.Stat(root); err != nil {
+		return fmt.Errorf("failed to stat %s: %w", root, err)
+	}
+	visited := make(map[string]struct{})
+	walkDir(ctx, root, true, opts, visited, fn)
+	return ctx.Err()
+}
+
+// walkDir walks a single directory recursively, skipping directories that can't be accessed
+func walkDir(ctx context.Context, dir string, isRoot bool, opts walkOptions, visited map[string]struct{}, fn func(path string, info os.FileInfo)) {
+	if ctx.Err() != nil {
+		return
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return
+	}
+	if realDir, err = filepath.Abs(realDir); err != nil {
+		return
+	}
+	if _, ok := visited[realDir]; ok {
+		lgr.Printf("[DEBUG] skipping already visited directory %s (symlink loop or duplicate)", dir)
+		return
+	}
+	visited[realDir] = struct{}{}
+
+	if !isRoot && !opts.includeSubmodules && isSubmodule(dir) {
+		lgr.Printf("[DEBUG] skipping git submodule %s, use --include-submodules to include it", dir)
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return // skip directories that can't be read
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		switch {
+		case entry.Type()&os.ModeSymlink != 0:
+			info, err := os.Stat(path) // stat the symlink target
+			if err != nil {
+				continue // skip broken symlinks
+			}
+			if !info.IsDir() {
+				fn(path, info)
+				continue
+			}
+			if !opts.followSymlinks {
+				lgr.Printf("[DEBUG] skipping symlinked directory %s, use --follow-symlinks to follow it", path)
+				continue
+			}
+			walkDir(ctx, path, false, opts, visited, fn)
+		case entry.IsDir():
+			walkDir(ctx, path, false, opts, visited, fn)
+		case entry.Type().IsRegular():
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			fn(path, info)
+		}
+	}
+}
+
+// isSubmodule checks if the directory is a git submodule, i.e. contains a .git file pointing to the real git dir
+func isSubmodule(dir string) bool {
+	info, err := os.Lstat(filepath.Join(dir, ".git"))
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,140 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// prepareWalkTree creates a directory tree with a symlinked directory, a symlink loop,
+// a symlinked file, a broken symlink and a git submodule
+func prepareWalkTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	files := map[string]string{
+		"main.go":            "package main",
+		"pkg/lib.go":         "package pkg",
+		"pkg/inner/inner.go": "package inner",
+		"sub/.git":           "gitdir: ../.git/modules/sub", // submodule has .git file
+		"sub/sub.go":         "package sub",
+		"nested/.git/HEAD":   "ref: refs/heads/master", // nested repo has .git directory
+		"nested/nested.go":   "package nested",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o750))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "ext.go"), []byte("package ext"), 0o600))
+
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "linked")))                          // symlinked directory
+	require.NoError(t, os.Symlink(root, filepath.Join(root, "pkg", "loop")))                        // loop back to root
+	require.NoError(t, os.Symlink(filepath.Join(root, "main.go"), filepath.Join(root, "alias.go"))) // symlinked file
+	require.NoError(t, os.Symlink(filepath.Join(root, "missing"), filepath.Join(root, "broken.go")))
+	return root
+}
+
+func TestWalkFiles(t *testing.T) {
+	root := prepareWalkTree(t)
+
+	tests := []struct {
+		name string
+		opts walkOptions
+		want []string
+	}{
+		{
+			name: "default skips symlinked dirs and submodules",
+			want: []string{"alias.go", "main.go", "nested/.git/HEAD", "nested/nested.go", "pkg/inner/inner.go", "pkg/lib.go"},
+		},
+		{
+			name: "follow symlinks with loop detection",
+			opts: walkOptions{followSymlinks: true},
+			want: []string{"alias.go", "linked/ext.go", "main.go", "nested/.git/HEAD", "nested/nested.go",
+				"pkg/inner/inner.go", "pkg/lib.go"},
+		},
+		{
+			name: "include submodules",
+			opts: walkOptions{includeSubmodules: true},
+			want: []string{"alias.go", "main.go", "nested/.git/HEAD", "nested/nested.go", "pkg/inner/inner.go",
+				"pkg/lib.go", "sub/.git", "sub/sub.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := walkFiles(context.Background(), root, tt.opts, func(path string, info os.FileInfo) {
+				assert.False(t, info.IsDir())
+				rel, err := filepath.Rel(root, path)
+				require.NoError(t, err)
+				got = append(got, filepath.ToSlash(rel))
+			})
+			require.NoError(t, err)
+			sort.Strings(got)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		calls := 0
+		err := walkFiles(ctx, root, walkOptions{}, func(string, os.FileInfo) { calls++ })
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Zero(t, calls)
+	})
+
+	t.Run("missing root", func(t *testing.T) {
+		err := walkFiles(context.Background(), filepath.Join(root, "missing"), walkOptions{}, func(string, os.FileInfo) {})
+		require.Error(t, err)
+	})
+}
+
+func TestMatchFiles_SymlinksAndSubmodules(t *testing.T) {
+	root := prepareWalkTree(t)
+
+	tests := []struct {
+		name              string
+		pattern           string
+		followSymlinks    bool
+		includeSubmodules bool
+		want              []string
+	}{
+		{name: "bash-style default", pattern: "**/*.go",
+			want: []string{"alias.go", "main.go", "nested/nested.go", "pkg/inner/inner.go", "pkg/lib.go"}},
+		{name: "bash-style follow symlinks", pattern: "**/*.go", followSymlinks: true,
+			want: []string{"alias.go", "linked/ext.go", "main.go", "nested/nested.go", "pkg/inner/inner.go", "pkg/lib.go"}},
+		{name: "go-style include submodules", pattern: "./...", includeSubmodules: true,
+			want: []string{"alias.go", "main.go", "nested/nested.go", "pkg/inner/inner.go", "pkg/lib.go", "sub/sub.go"}},
+		{name: "concrete directory with symlink loop", pattern: "pkg", followSymlinks: true, // force mode, no excludes
+			want: []string{"pkg/inner/inner.go", "pkg/lib.go", "pkg/loop/alias.go", "pkg/loop/linked/ext.go",
+				"pkg/loop/main.go", "pkg/loop/nested/.git/HEAD", "pkg/loop/nested/nested.go"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(root)
+			got, err := MatchFiles(context.Background(), LoadRequest{
+				Patterns:          []string{tt.pattern},
+				ExcludePatterns:   []string{"**/.git/**", "sub/.git"},
+				MaxFileSize:       DefaultMaxFileSize,
+				FollowSymlinks:    tt.followSymlinks,
+				IncludeSubmodules: tt.includeSubmodules,
+			})
+			require.NoError(t, err)
+			rel := make([]string, 0, len(got))
+			for _, f := range got {
+				rel = append(rel, filepath.ToSlash(f))
+			}
+			sort.Strings(rel)
+			assert.Equal(t, tt.want, rel)
+		})
+	}
+}
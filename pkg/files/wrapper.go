@@ -0,0 +1,61 @@
+package files
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"strings"
+)
+
+// Wrapper defines how file contents are wrapped in the prompt
+type Wrapper string
+
+// supported wrappers
+const (
+	WrapperPlain    Wrapper = "plain"    // comment header with the file name in the syntax of the file, default
+	WrapperXML      Wrapper = "xml"      // <file path="..."> tags
+	WrapperMarkdown Wrapper = "markdown" // heading with the file name and fenced code block
+)
+
+// ParseWrapper returns the wrapper with the name, plain for empty name
+func ParseWrapper(name string) (Wrapper, error) {
+	switch w := Wrapper(strings.ToLower(strings.TrimSpace(name))); w {
+	case "":
+		return WrapperPlain, nil
+	case WrapperPlain, WrapperXML, WrapperMarkdown:
+		return w, nil
+	default:
+		return "", fmt.Errorf("unknown context wrapper %q, supported: plain, xml, markdown", name)
+	}
+}
+
+// wrap returns the content of the file wrapped for the prompt and followed by a blank line. Lines is
+// the line range of the content, like "10-20", empty for the whole file.
+func (w Wrapper) wrap(path, lines, content string) string {
+	switch w {
+	case WrapperXML:
+		attrs := `path="` + html.EscapeString(path) + `"`
+		if lines != "" {
+			attrs += ` lines="` + lines + `"`
+		}
+		return fmt.Sprintf("<file %s>\n%s\n</file>\n\n", attrs, strings.TrimRight(content, "\n"))
+	case WrapperMarkdown:
+		title := path
+		if lines != "" {
+			title += " (lines " + lines + ")"
+		}
+		// fence is longer than any backtick run of the content, so code blocks inside the file don't end it
+		fence := "```"
+		for strings.Contains(content, fence) {
+			fence += "`"
+		}
+		lang := strings.TrimPrefix(filepath.Ext(path), ".")
+		return fmt.Sprintf("### %s\n%s%s\n%s\n%s\n\n", title, fence, lang, strings.TrimRight(content, "\n"), fence)
+	default:
+		name := path
+		if lines != "" {
+			name += " (lines " + lines + ")"
+		}
+		return fmt.Sprintf(fileHeaderFormat(path), name) + content + "\n\n"
+	}
+}
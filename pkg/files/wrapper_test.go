@@ -0,0 +1,53 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWrapper(t *testing.T) {
+	for name, want := range map[string]Wrapper{"": WrapperPlain, "plain": WrapperPlain, " XML": WrapperXML,
+		"markdown": WrapperMarkdown} {
+		w, err := ParseWrapper(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, w, name)
+	}
+	_, err := ParseWrapper("json")
+	require.EqualError(t, err, `unknown context wrapper "json", supported: plain, xml, markdown`)
+}
+
+func TestWrapper_Wrap(t *testing.T) {
+	tests := []struct {
+		wrapper       Wrapper
+		path, lines   string
+		content, want string
+	}{
+		{WrapperPlain, "main.go", "", "package main\n", "// file: main.go\npackage main\n\n\n"},
+		{"", "run.py", "3-4", "x = 1", "# file: run.py (lines 3-4)\nx = 1\n\n"},
+		{WrapperXML, "main.go", "", "package main\n", "<file path=\"main.go\">\npackage main\n</file>\n\n"},
+		{WrapperXML, `a"b.go`, "10-20", "x", "<file path=\"a&#34;b.go\" lines=\"10-20\">\nx\n</file>\n\n"},
+		{WrapperMarkdown, "main.go", "", "package main", "### main.go\n```go\npackage main\n```\n\n"},
+		{WrapperMarkdown, "README", "1-2", "```sh\nls\n```", "### README (lines 1-2)\n````\n```sh\nls\n```\n````\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.wrapper)+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.wrapper.wrap(tt.path, tt.lines, tt.content))
+		})
+	}
+}
+
+func TestLoadContent_Wrapper(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\nfunc A() {}\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("text"), 0o600))
+
+	res, err := LoadContent(context.Background(), LoadRequest{Patterns: []string{"*.go:2-2", "*.txt"}, Dir: dir, MaxFileSize: DefaultMaxFileSize,
+		Wrapper: WrapperXML})
+	require.NoError(t, err)
+	assert.Equal(t, "<file path=\"b.txt\">\ntext\n</file>\n\n<file path=\"a.go\" lines=\"2-2\">\nfunc A() {}\n</file>\n\n", res)
+}
@@ -0,0 +1,200 @@
+// Package history implements a store of previous invocations, used to re-run them. Entries are kept
+// as JSON lines in a single file, with the oldest entries dropped once the max number of entries is reached.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultMaxEntries defines the default max number of entries kept in the history
+const DefaultMaxEntries = 100
+
+const (
+	lockTimeout  = 5 * time.Second  // max time to wait for the history lock held by another run
+	lockStaleAge = 30 * time.Second // age of a lock file considered left by a crashed run
+	lockRetry    = 10 * time.Millisecond
+)
+
+// Entry is a recorded invocation
+type Entry struct {
+	ID     int       `json:"id"`
+	Time   time.Time `json:"time"`
+	Dir    string    `json:"dir"`             // working directory, file patterns are resolved relative to it
+	Args   []string  `json:"args"`            // command line arguments without the prompt and API keys
+	Prompt string    `json:"prompt"`          // prompt text, including piped input unless it's a template
+	Input  string    `json:"input,omitempty"` // piped input kept apart from a template prompt
+
+	// Truncated is set if the prompt or input was cut to the size limit of the history, so it can't be re-run as is
+	Truncated bool `json:"truncated,omitempty"`
+
+	Name string            `json:"name,omitempty"` // name of the run, set with --name
+	Tags map[string]string `json:"tags,omitempty"` // tags of the run, set with --tag
+}
+
+// Store keeps history entries in a file
+type Store struct {
+	path       string
+	maxEntries int
+}
+
+// New makes a Store with the given file and max number of entries, DefaultMaxEntries if not positive
+func New(path string, maxEntries int) *Store {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	return &Store{path: path, maxEntries: maxEntries}
+}
+
+// Add records the entry with the next ID and returns it. Time is set to the current time if not set.
+// The history file is locked while it is updated, so concurrent runs don't lose each other's entries.
+func (s *Store) Add(entry Entry) (Entry, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Entry{}, err
+	}
+	defer unlock()
+
+	entries, err := s.List()
+	if err != nil {
+		return Entry{}, err
+	}
+	entry.ID = 1
+	if len(entries) > 0 {
+		entry.ID = entries[len(entries)-1].ID + 1
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entries = append(entries, entry)
+	if len(entries) > s.maxEntries {
+		entries = entries[len(entries)-s.maxEntries:]
+	}
+	if err := s.write(entries); err != nil {
+		return Entry{}, err
+	}
+	return entry, nil
+}
+
+// List returns all entries, oldest first. Missing history file means no entries.
+func (s *Store) List() ([]Entry, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	var res []Entry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1) // a line can be as long as the whole file
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("failed to parse history %s: %w", s.path, err)
+		}
+		res = append(res, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	return res, nil
+}
+
+// Last returns the most recent entry
+func (s *Store) Last() (Entry, error) {
+	entries, err := s.List()
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(entries) == 0 {
+		return Entry{}, fmt.Errorf("history is empty")
+	}
+	return entries[len(entries)-1], nil
+}
+
+// Get returns the entry with the given ID
+func (s *Store) Get(id int) (Entry, error) {
+	entries, err := s.List()
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return Entry{}, fmt.Errorf("history entry %d not found", id)
+}
+
+// lock acquires the lock of the history file, waiting for a lock held by another run up to lockTimeout.
+// The lock is a separate file created exclusively, a lock file older than lockStaleAge is removed as left
+// by a crashed run. Returns the function releasing the lock.
+func (s *Store) lock() (unlock func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	lockPath := s.path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600) //nolint:gosec // path from options
+		if err == nil {
+			_ = f.Close()
+			return func() { _ = os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock history: %w", err)
+		}
+		if fi, serr := os.Stat(lockPath); serr == nil && time.Since(fi.ModTime()) > lockStaleAge {
+			_ = os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to lock history, %s is held by another run", lockPath)
+		}
+		time.Sleep(lockRetry)
+	}
+}
+
+// write replaces the history file with the given entries. The file is written to a temporary file first
+// and renamed, so concurrent runs never see a partially written history.
+func (s *Store) write(entries []Entry) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("failed to encode history entry: %w", err)
+		}
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create history file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after successful rename
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mpt", "history.jsonl")
+	s := New(path, 3)
+
+	entries, err := s.List()
+	require.NoError(t, err)
+	assert.Empty(t, entries, "missing file means no entries")
+	_, err = s.Last()
+	require.EqualError(t, err, "history is empty")
+
+	for i, prompt := range []string{"first", "second", "third", "fourth"} {
+		e, err := s.Add(Entry{Dir: "/src", Args: []string{"--openai.enabled"}, Prompt: prompt})
+		require.NoError(t, err)
+		assert.Equal(t, i+1, e.ID)
+		assert.WithinDuration(t, time.Now(), e.Time, time.Minute)
+	}
+
+	entries, err = s.List()
+	require.NoError(t, err)
+	require.Len(t, entries, 3, "oldest entry dropped")
+	assert.Equal(t, []int{2, 3, 4}, []int{entries[0].ID, entries[1].ID, entries[2].ID})
+
+	last, err := s.Last()
+	require.NoError(t, err)
+	assert.Equal(t, "fourth", last.Prompt)
+	assert.Equal(t, []string{"--openai.enabled"}, last.Args)
+	assert.Equal(t, "/src", last.Dir)
+
+	e, err := s.Get(3)
+	require.NoError(t, err)
+	assert.Equal(t, "third", e.Prompt)
+	_, err = s.Get(1)
+	require.EqualError(t, err, "history entry 1 not found")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "history may contain sensitive prompts")
+}
+
+func TestStore_LongPrompt(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "history.jsonl"), 0)
+	long := string(make([]byte, 200*1024))
+	_, err := s.Add(Entry{Prompt: long})
+	require.NoError(t, err)
+	last, err := s.Last()
+	require.NoError(t, err)
+	assert.Len(t, last.Prompt, len(long))
+}
+
+func TestStore_Corrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{bad json\n"), 0o600))
+	_, err := New(path, 0).List()
+	require.ErrorContains(t, err, "failed to parse history")
+}
+
+func TestStore_ConcurrentAdd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := New(path, 100).Add(Entry{Prompt: "prompt"})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	entries, err := New(path, 100).List()
+	require.NoError(t, err)
+	require.Len(t, entries, 20, "no entries lost")
+	for i, e := range entries {
+		assert.Equal(t, i+1, e.ID)
+	}
+	assert.NoFileExists(t, path+".lock", "lock released")
+}
+
+func TestStore_Lock(t *testing.T) {
+	t.Run("stale lock removed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "history.jsonl")
+		require.NoError(t, os.WriteFile(path+".lock", nil, 0o600))
+		old := time.Now().Add(-2 * lockStaleAge)
+		require.NoError(t, os.Chtimes(path+".lock", old, old))
+
+		e, err := New(path, 0).Add(Entry{Prompt: "prompt"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, e.ID)
+	})
+
+	t.Run("held lock", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("waits for lock timeout")
+		}
+		path := filepath.Join(t.TempDir(), "history.jsonl")
+		require.NoError(t, os.WriteFile(path+".lock", nil, 0o600))
+		_, err := New(path, 0).Add(Entry{Prompt: "prompt"})
+		require.ErrorContains(t, err, "held by another run")
+	})
+}
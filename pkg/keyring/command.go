@@ -0,0 +1,86 @@
+//go:build !windows
+
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// securityNotFound is the exit code of macOS security tool if the item is not in the keychain
+const securityNotFound = 44
+
+// commandBackend keeps secrets with the security tool on macOS and secret-tool (Secret Service) elsewhere
+type commandBackend struct {
+	goos string
+	run  func(stdin, name string, args ...string) (string, error)
+}
+
+func newBackend() backend {
+	return &commandBackend{goos: runtime.GOOS, run: runCommand}
+}
+
+func (b *commandBackend) get(name string) (string, error) {
+	var out string
+	var err error
+	if b.goos == "darwin" {
+		out, err = b.run("", "security", "find-generic-password", "-s", Service, "-a", name, "-w")
+	} else {
+		out, err = b.run("", "secret-tool", "lookup", "service", Service, "account", name)
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr) && b.goos == "darwin" && exitErr.ExitCode() == securityNotFound:
+		return "", ErrNotFound
+	case errors.As(err, &exitErr) && b.goos != "darwin" && exitErr.ExitCode() == 1 && out == "":
+		return "", ErrNotFound // secret-tool exits with 1 without output if nothing found
+	case err != nil:
+		return "", err
+	}
+
+	secret := strings.TrimRight(out, "\r\n")
+	if secret == "" {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+func (b *commandBackend) set(name, secret string) error {
+	if b.goos == "darwin" {
+		// the secret is passed in interactive mode to keep it out of the process list
+		cmd := fmt.Sprintf("add-generic-password -U -s %s -a %s -l %s -w %s\n",
+			quote(Service), quote(name), quote(Service+": "+name), quote(secret))
+		_, err := b.run(cmd, "security", "-i")
+		return err
+	}
+	_, err := b.run(secret, "secret-tool", "store", "--label="+Service+": "+name, "service", Service, "account", name)
+	return err
+}
+
+// runCommand runs the command with stdin and returns its output, stderr is added to the error
+func runCommand(stdin, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...) //nolint:gosec // fixed credential store tools
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", fmt.Errorf("%s not found, it is required to access the OS credential store: %w", name, err)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.String(), fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return stdout.String(), fmt.Errorf("%s: %w", name, err)
+	}
+	return stdout.String(), nil
+}
+
+// quote quotes the value for the security tool interactive mode
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,91 @@
+//go:build !windows
+
+package keyring
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandBackend(t *testing.T) {
+	exitErr := func(code string) error {
+		return exec.Command("sh", "-c", "exit "+code).Run()
+	}
+
+	type call struct{ stdin, cmd string }
+	tests := []struct {
+		name    string
+		goos    string
+		out     string
+		err     error
+		want    string
+		wantErr error
+		call    call
+	}{
+		{name: "macos", goos: "darwin", out: "sk-1\n", want: "sk-1",
+			call: call{cmd: "security find-generic-password -s mpt -a openai -w"}},
+		{name: "macos not found", goos: "darwin", err: exitErr("44"), wantErr: ErrNotFound,
+			call: call{cmd: "security find-generic-password -s mpt -a openai -w"}},
+		{name: "linux", goos: "linux", out: "sk-2", want: "sk-2",
+			call: call{cmd: "secret-tool lookup service mpt account openai"}},
+		{name: "linux not found", goos: "linux", err: exitErr("1"), wantErr: ErrNotFound,
+			call: call{cmd: "secret-tool lookup service mpt account openai"}},
+		{name: "failed", goos: "linux", err: errors.New("no dbus"), wantErr: errors.New("no dbus"),
+			call: call{cmd: "secret-tool lookup service mpt account openai"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got call
+			b := &commandBackend{goos: tt.goos, run: func(stdin, name string, args ...string) (string, error) {
+				got = call{stdin: stdin, cmd: strings.Join(append([]string{name}, args...), " ")}
+				return tt.out, tt.err
+			}}
+			secret, err := b.get("openai")
+			assert.Equal(t, tt.call, got)
+			if tt.wantErr != nil {
+				require.Error(t, err)
+				if errors.Is(tt.wantErr, ErrNotFound) {
+					require.ErrorIs(t, err, ErrNotFound)
+				} else {
+					require.EqualError(t, err, tt.wantErr.Error())
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, secret)
+		})
+	}
+
+	t.Run("set", func(t *testing.T) {
+		var stdin, cmd string
+		run := func(in, name string, args ...string) (string, error) {
+			stdin, cmd = in, strings.Join(append([]string{name}, args...), " ")
+			return "", nil
+		}
+
+		require.NoError(t, (&commandBackend{goos: "darwin", run: run}).set("openai", "sk-'1"))
+		assert.Equal(t, "security -i", cmd)
+		assert.Equal(t, `add-generic-password -U -s 'mpt' -a 'openai' -l 'mpt: openai' -w 'sk-'\''1'`+"\n", stdin)
+
+		require.NoError(t, (&commandBackend{goos: "linux", run: run}).set("openai", "sk-2"))
+		assert.Equal(t, "secret-tool store --label=mpt: openai service mpt account openai", cmd)
+		assert.Equal(t, "sk-2", stdin)
+	})
+}
+
+func TestRunCommand(t *testing.T) {
+	out, err := runCommand("input", "cat")
+	require.NoError(t, err)
+	assert.Equal(t, "input", out)
+
+	_, err = runCommand("", "sh", "-c", "echo oops >&2; exit 3")
+	require.EqualError(t, err, "sh: exit status 3: oops")
+
+	_, err = runCommand("", "mpt-no-such-tool")
+	require.ErrorContains(t, err, "mpt-no-such-tool not found, it is required to access the OS credential store")
+}
@@ -0,0 +1,72 @@
+// Package keyring reads and stores secrets, like API keys, in the OS credential store: macOS Keychain,
+// Secret Service on Linux and other unix systems, and Windows Credential Manager.
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Service is the service name secrets are stored under
+const Service = "mpt"
+
+// Prefix marks option values referencing a secret in the keyring, like "keyring:openai"
+const Prefix = "keyring:"
+
+// ErrNotFound is returned if there is no secret stored for the name
+var ErrNotFound = errors.New("secret not found in keyring")
+
+// store is the credential store of the current OS, replaced in tests
+var store backend = newBackend()
+
+// backend is a credential store
+type backend interface {
+	get(name string) (string, error)
+	set(name, secret string) error
+}
+
+var nameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Get returns the secret stored for the name
+func Get(name string) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+	secret, err := store.get(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s from keyring: %w", name, err)
+	}
+	return secret, nil
+}
+
+// Set stores the secret for the name, replacing the existing one
+func Set(name, secret string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if secret == "" {
+		return fmt.Errorf("empty secret for %s", name)
+	}
+	if err := store.set(name, secret); err != nil {
+		return fmt.Errorf("failed to store %s in keyring: %w", name, err)
+	}
+	return nil
+}
+
+// Resolve returns the secret for "keyring:<name>" reference. Other values are returned as is.
+func Resolve(value string) (string, error) {
+	name, ok := strings.CutPrefix(value, Prefix)
+	if !ok {
+		return value, nil
+	}
+	return Get(name)
+}
+
+func checkName(name string) error {
+	if !nameRe.MatchString(name) {
+		return fmt.Errorf("invalid keyring name %q, only letters, digits, dots, dashes and underscores are allowed", name)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package keyring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mapBackend map[string]string
+
+func (m mapBackend) get(name string) (string, error) {
+	if v, ok := m[name]; ok {
+		return v, nil
+	}
+	return "", ErrNotFound
+}
+
+func (m mapBackend) set(name, secret string) error {
+	m[name] = secret
+	return nil
+}
+
+func TestKeyring(t *testing.T) {
+	orig := store
+	store = mapBackend{}
+	t.Cleanup(func() { store = orig })
+
+	require.NoError(t, Set("openai", "sk-secret"))
+	got, err := Get("openai")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-secret", got)
+
+	_, err = Get("anthropic")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.EqualError(t, err, "failed to get anthropic from keyring: secret not found in keyring")
+
+	require.EqualError(t, Set("openai", ""), "empty secret for openai")
+	require.ErrorContains(t, Set("bad name", "x"), `invalid keyring name "bad name"`)
+	_, err = Get("")
+	require.ErrorContains(t, err, `invalid keyring name ""`)
+
+	tests := []struct {
+		value, want, wantErr string
+	}{
+		{value: "keyring:openai", want: "sk-secret"},
+		{value: "sk-plain", want: "sk-plain"},
+		{value: "", want: ""},
+		{value: "keyring:missing", wantErr: "secret not found in keyring"},
+		{value: "keyring:", wantErr: "invalid keyring name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := Resolve(tt.value)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
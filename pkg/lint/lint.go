@@ -0,0 +1,331 @@
+// Package lint checks the assembled prompt for common problems before it is sent to providers: contradictory
+// instructions, missing question, oversized pasted logs, likely secrets and text mixing scripts of different
+// languages. Checks are heuristics, each warning says what was found and how to fix it.
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// DefaultMaxLogLines is the max number of lines of a pasted log if Options doesn't set it
+const DefaultMaxLogLines = 200
+
+// checks of the prompt
+const (
+	CheckContradiction = "contradiction" // instructions contradicting each other, like "be brief" and "in detail"
+	CheckQuestion      = "question"      // prompt without a question or instruction
+	CheckLog           = "log"           // oversized pasted log
+	CheckSecret        = "secret"        // likely secret, like an API key or a private key
+	CheckLocale        = "locale"        // text mixing scripts, like Latin and Cyrillic
+)
+
+// Prompt is the prompt to check
+type Prompt struct {
+	Instruction string // prompt written by the user, without context of files and git
+	Full        string // assembled prompt sent to providers
+}
+
+// Options of checks
+type Options struct {
+	MaxLogLines int      // max lines of a pasted log, DefaultMaxLogLines if 0
+	Secrets     []string // known secrets, like API keys of providers
+}
+
+// Warning is a problem found in the prompt
+type Warning struct {
+	Check   string // one of Check* constants
+	Line    int    // line of the assembled prompt, 0 if the warning is about the instruction as a whole
+	Message string // what was found and how to fix it
+}
+
+// String returns the warning as "check at line N: message"
+func (w Warning) String() string {
+	if w.Line > 0 {
+		return fmt.Sprintf("%s at line %d: %s", w.Check, w.Line, w.Message)
+	}
+	return w.Check + ": " + w.Message
+}
+
+// Check runs all checks of the prompt and returns warnings in the order of checks
+func Check(p Prompt, opts Options) []Warning {
+	if opts.MaxLogLines <= 0 {
+		opts.MaxLogLines = DefaultMaxLogLines
+	}
+	var res []Warning
+	res = append(res, questionWarnings(p.Instruction)...)
+	res = append(res, contradictionWarnings(p.Instruction)...)
+	res = append(res, logWarnings(p.Full, opts.MaxLogLines)...)
+	res = append(res, secretWarnings(p.Full, opts.Secrets)...)
+	res = append(res, localeWarnings(p.Instruction)...)
+	return res
+}
+
+// requestWords start sentences asking a question or giving an instruction
+var requestWords = []string{
+	"what", "why", "how", "when", "where", "which", "who", "whom", "whose", "is", "are", "was", "were", "can", "could",
+	"should", "would", "will", "does", "do", "did", "has", "have", "please", "help", "explain", "review", "describe",
+	"summarize", "summarise", "write", "fix", "find", "check", "list", "compare", "refactor", "improve", "translate",
+	"generate", "create", "add", "remove", "suggest", "analyze", "analyse", "rewrite", "optimize", "implement",
+	"convert", "update", "document", "debug", "identify", "evaluate", "give", "show", "tell", "make", "propose",
+	"recommend", "answer", "outline", "draft", "test", "audit", "validate", "verify", "rate", "score", "classify",
+	"extract", "count", "calculate", "estimate", "rename", "simplify", "port", "design", "plan", "proofread",
+	"i", "we", "let's", "lets",
+}
+
+// sentenceRe splits the instruction into sentences
+var sentenceRe = regexp.MustCompile(`[.!;:\n]+`)
+
+// questionWarnings warns about the instruction without a question or instruction, as models guess what to do
+// with the context then
+func questionWarnings(instruction string) []Warning {
+	instruction = strings.TrimSpace(instruction)
+	if instruction == "" {
+		return []Warning{{Check: CheckQuestion,
+			Message: "prompt has only context, without a question; add what you want to know with --prompt"}}
+	}
+	if strings.Contains(instruction, "?") {
+		return nil
+	}
+	for _, sentence := range sentenceRe.Split(instruction, -1) {
+		fields := strings.Fields(strings.ToLower(sentence))
+		if len(fields) > 0 && slices.Contains(requestWords, strings.Trim(fields[0], `"'*-#>,()`)) {
+			return nil
+		}
+	}
+	return []Warning{{Check: CheckQuestion, Message: "prompt doesn't ask a question or give an instruction; " +
+		`ask a question or start with a verb like "explain" or "review"`}}
+}
+
+// contradictions are pairs of instructions which can't be followed both. Phrases inside phrases of the other
+// side are skipped, so "don't explain" doesn't match "explain".
+var contradictions = []struct{ a, b *regexp.Regexp }{
+	{a: regexp.MustCompile(`(?i)\b(?:be (?:very )?(?:brief|concise|short)|briefly|concisely|keep it (?:short|brief)|` +
+		`short answer|in (?:one|a single|a few) (?:sentence|word|line)s?|tl;?dr)\b`),
+		b: regexp.MustCompile(`(?i)\b(?:in (?:great |full |more )?detail|detailed|thorough(?:ly)?|comprehensive(?:ly)?|` +
+			`elaborate|step[- ]by[- ]step|exhaustive(?:ly)?)\b`)},
+	{a: regexp.MustCompile(`(?i)\b(?:(?:only|just) (?:the )?code|code only|no explanations?|without (?:any )?explanations?|` +
+		`(?:don't|do not) explain)\b`),
+		b: regexp.MustCompile(`(?i)\b(?:explain|explanation of|walk me through|describe why)\b`)},
+	{a: regexp.MustCompile(`(?i)\b(?:as|in|return|output|respond with|reply with) (?:valid |plain |raw )?json\b`),
+		b: regexp.MustCompile(`(?i)\b(?:(?:as|in|use) markdown|markdown (?:table|format|headers?|sections?))\b`)},
+	{a: regexp.MustCompile(`(?i)\b(?:bullet(?:ed)? (?:points?|list)|as a list)\b`),
+		b: regexp.MustCompile(`(?i)\b(?:(?:no|without) bullet(?:s| points?)?|(?:in|as) prose|as (?:a )?paragraphs?)\b`)},
+}
+
+// negationRe and affirmationRe match instructions to never and to always do something, contradicting
+// if they are about the same thing
+var (
+	negationRe    = regexp.MustCompile(`(?i)\b(?:never|don't|do not|must not|avoid)\s+(\w+(?:\s+\w+)?)`)
+	affirmationRe = regexp.MustCompile(`(?i)\b(?:always|must|make sure to|be sure to)\s+(\w+(?:\s+\w+)?)`)
+)
+
+// contradictionWarnings warns about instructions contradicting each other
+func contradictionWarnings(instruction string) []Warning {
+	var res []Warning
+	for _, c := range contradictions {
+		am, bm := c.a.FindAllStringIndex(instruction, -1), c.b.FindAllStringIndex(instruction, -1)
+		a, b := firstOutside(instruction, am, bm), firstOutside(instruction, bm, am)
+		if a != "" && b != "" {
+			res = append(res, contradiction(a, b))
+		}
+	}
+	negations := map[string]string{}
+	for _, m := range negationRe.FindAllStringSubmatch(instruction, -1) {
+		negations[strings.ToLower(m[1])] = m[0]
+	}
+	for _, m := range affirmationRe.FindAllStringSubmatch(instruction, -1) {
+		if neg, ok := negations[strings.ToLower(m[1])]; ok {
+			res = append(res, contradiction(m[0], neg))
+		}
+	}
+	return res
+}
+
+// firstOutside returns the first match not inside any of other matches, empty if there is none
+func firstOutside(text string, matches, other [][]int) string {
+	for _, m := range matches {
+		inside := slices.ContainsFunc(other, func(o []int) bool { return o[0] <= m[0] && m[1] <= o[1] })
+		if !inside {
+			return text[m[0]:m[1]]
+		}
+	}
+	return ""
+}
+
+// contradiction makes the warning about contradicting instructions
+func contradiction(a, b string) Warning {
+	return Warning{Check: CheckContradiction,
+		Message: fmt.Sprintf("instructions %q and %q contradict each other; keep one of them", a, b)}
+}
+
+// logLineRe matches lines of logs: timestamps, levels, stack frames and source locations
+var logLineRe = regexp.MustCompile(`^\s*(?:\[?\d{4}[-/]\d{2}[-/]\d{2}[T ]\d{2}:\d{2}|\[?\d{2}:\d{2}:\d{2}|` +
+	`[A-Z][a-z]{2} +\d{1,2} \d{2}:\d{2}:\d{2}|\[?(?:TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|ERR|FATAL|CRITICAL|PANIC)\]?[\s:]|` +
+	`(?:level|lvl)=\w+|\{"(?:time|ts|level|msg)"|at [\w$.<>/]+\(|goroutine \d+ \[|[\w./-]+\.go:\d+|` +
+	`Traceback \(most recent call last\)|File "[^"]+", line \d+)`)
+
+// maxLogGap is the max number of non-log lines inside a log, like lines of a multi-line message
+const maxLogGap = 2
+
+// logWarnings warns about logs longer than maxLines, as they take most of the context and bury the relevant part
+func logWarnings(text string, maxLines int) []Warning {
+	var res []Warning
+	lines := strings.Split(text, "\n")
+	start, last := -1, -1 // first and last lines of the current log
+	flush := func() {
+		if start >= 0 && last-start+1 > maxLines {
+			size := 0
+			for _, l := range lines[start : last+1] {
+				size += len(l) + 1
+			}
+			res = append(res, Warning{Check: CheckLog, Line: start + 1, Message: fmt.Sprintf("pasted log of %d lines "+
+				"(%d KB); trim it to the lines relevant to the question, e.g. with grep or tail", last-start+1, (size+1023)/1024)})
+		}
+		start, last = -1, -1
+	}
+	for i, line := range lines {
+		if !logLineRe.MatchString(line) {
+			if start >= 0 && i-last-1 > maxLogGap {
+				flush()
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		last = i
+	}
+	flush()
+	return res
+}
+
+// secretPatterns are secrets of well-known formats
+var secretPatterns = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{name: "API key", re: regexp.MustCompile(`\bsk-(?:ant-|proj-)?[\w-]{20,}`)},
+	{name: "GitHub token", re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{30,}|github_pat_\w{22,})`)},
+	{name: "GitLab token", re: regexp.MustCompile(`\bglpat-[\w-]{20,}`)},
+	{name: "AWS access key", re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{name: "Google API key", re: regexp.MustCompile(`\bAIza[\w-]{35}`)},
+	{name: "Slack token", re: regexp.MustCompile(`\bxox[abprs]-[\w-]{10,}`)},
+	{name: "private key", re: regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )?PRIVATE KEY-----`)},
+	{name: "JWT", re: regexp.MustCompile(`\beyJ[\w-]{10,}\.eyJ[\w-]{10,}\.[\w-]{10,}`)},
+	{name: "password in URL", re: regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:[^/\s@]+@`)},
+	{name: "secret assignment", re: regexp.MustCompile(`(?i)\b[\w.-]*(?:api[_-]?key|secret|passw(?:or)?d|token)[\w.-]*["']?` +
+		`\s*[=:]\s*["']?[A-Za-z0-9+/_-]{8,}(?:["'\s,;]|$)`)},
+}
+
+// secretWarnings warns about likely secrets, one warning per line
+func secretWarnings(text string, secrets []string) []Warning {
+	var res []Warning
+	for i, line := range strings.Split(text, "\n") {
+		name := ""
+		for _, secret := range secrets {
+			if secret != "" && strings.Contains(line, secret) {
+				name = "API key of a configured provider"
+				break
+			}
+		}
+		for _, p := range secretPatterns {
+			if name != "" {
+				break
+			}
+			if p.re.MatchString(line) {
+				name = p.name
+			}
+		}
+		if name != "" {
+			res = append(res, Warning{Check: CheckSecret, Line: i + 1, Message: fmt.Sprintf("likely %s; remove it or "+
+				"replace it with a placeholder, the prompt is sent to providers as is", name)})
+		}
+	}
+	return res
+}
+
+// scripts are writing systems detected in the instruction, scripts of CJK languages are grouped as they are
+// mixed in Japanese text
+var scripts = []struct {
+	name   string
+	tables []*unicode.RangeTable
+}{
+	{name: "Latin", tables: []*unicode.RangeTable{unicode.Latin}},
+	{name: "Cyrillic", tables: []*unicode.RangeTable{unicode.Cyrillic}},
+	{name: "Greek", tables: []*unicode.RangeTable{unicode.Greek}},
+	{name: "Arabic", tables: []*unicode.RangeTable{unicode.Arabic}},
+	{name: "Hebrew", tables: []*unicode.RangeTable{unicode.Hebrew}},
+	{name: "Devanagari", tables: []*unicode.RangeTable{unicode.Devanagari}},
+	{name: "Thai", tables: []*unicode.RangeTable{unicode.Thai}},
+	{name: "CJK", tables: []*unicode.RangeTable{unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul}},
+}
+
+// script returns the index of the script of the letter in scripts, -1 if unknown
+func script(r rune) int {
+	for i, s := range scripts {
+		if unicode.IsOneOf(s.tables, r) {
+			return i
+		}
+	}
+	return -1
+}
+
+// minScriptShare is the min percent of letters of the second script for the instruction to be mixed
+const minScriptShare = 20
+
+// languageRe matches instructions setting the language of the answer or asking to translate
+var languageRe = regexp.MustCompile(`(?i)\b(?:answer|respond|reply|write)\s+in\s+\w+|\btranslat`)
+
+// localeWarnings warns about words mixing letters of different scripts, like Latin and Cyrillic lookalikes
+// typed with a wrong keyboard layout, and about instructions mixing languages without setting the language
+// of the answer
+func localeWarnings(instruction string) []Warning {
+	var res []Warning
+	reported := map[string]bool{}
+	letters := make([]int, len(scripts))
+	total := 0
+	for _, word := range strings.FieldsFunc(instruction, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		used := map[int]bool{}
+		for _, r := range word {
+			if s := script(r); s >= 0 {
+				used[s] = true
+				letters[s]++
+				total++
+			}
+		}
+		if len(used) > 1 && !reported[word] {
+			reported[word] = true
+			res = append(res, Warning{Check: CheckLocale, Message: fmt.Sprintf("word %q mixes letters of %s; "+
+				"retype it, lookalike letters of another keyboard layout change its meaning", word, scriptNames(used))})
+		}
+	}
+	if total == 0 || languageRe.MatchString(instruction) {
+		return res
+	}
+	mixed := map[int]bool{}
+	for i, n := range letters {
+		if n*100 >= total*minScriptShare {
+			mixed[i] = true
+		}
+	}
+	if len(mixed) > 1 {
+		res = append(res, Warning{Check: CheckLocale, Message: fmt.Sprintf("prompt mixes %s text; "+
+			`set the language of the answer, like "answer in English"`, scriptNames(mixed))})
+	}
+	return res
+}
+
+// scriptNames returns names of scripts by their indexes, in the order of scripts
+func scriptNames(used map[int]bool) string {
+	names := make([]string, 0, len(used))
+	for i, s := range scripts {
+		if used[i] {
+			names = append(names, s.name)
+		}
+	}
+	return strings.Join(names, " and ")
+}
@@ -0,0 +1,159 @@
+package mcp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+// healthPrompt is the minimal prompt checking the provider responds
+const healthPrompt = "Reply with OK."
+
+// HealthOptions defines how provider health is checked
+type HealthOptions struct {
+	Interval    time.Duration // delay of the first re-check of a failed provider, doubled after each failure
+	MaxInterval time.Duration // max delay between re-checks of a failed provider
+	Timeout     time.Duration // max time of a single check request
+}
+
+// ProviderHealth is the health status of a provider
+type ProviderHealth struct {
+	Provider  string    `json:"provider"`
+	Healthy   bool      `json:"healthy"`
+	Checked   bool      `json:"checked"`              // false until the first check completes, providers are assumed healthy
+	Error     string    `json:"error,omitempty"`      // error of the last failed check
+	Failures  int       `json:"failures,omitempty"`   // consecutive failed checks
+	CheckedAt time.Time `json:"checked_at,omitzero"`  // time of the last check
+	NextCheck time.Time `json:"next_check,omitzero"`  // time of the next re-check of a failed provider
+	Latency   int64     `json:"latency_ms,omitempty"` // time spent on the last successful check
+}
+
+// Health checks providers with a minimal request on start and re-checks failed ones in background
+// with exponential backoff, so calls can skip providers which are down until they recover.
+// It is safe for concurrent use.
+type Health struct {
+	providers []provider.Provider
+	opts      HealthOptions
+
+	mu     sync.Mutex
+	status map[string]*ProviderHealth // provider name -> health
+}
+
+// NewHealth makes a health checker of the providers, all providers are assumed healthy until checked
+func NewHealth(providers []provider.Provider, opts HealthOptions) *Health {
+	if opts.Interval <= 0 {
+		opts.Interval = 30 * time.Second
+	}
+	if opts.MaxInterval < opts.Interval {
+		opts.MaxInterval = opts.Interval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	h := &Health{providers: providers, opts: opts, status: map[string]*ProviderHealth{}}
+	for _, p := range providers {
+		h.status[p.Name()] = &ProviderHealth{Provider: p.Name(), Healthy: true}
+	}
+	return h
+}
+
+// Run checks all providers, then re-checks failed providers when their backoff expires, until the context
+// is canceled. Healthy providers are not re-checked, so an idle server doesn't spend requests.
+func (h *Health) Run(ctx context.Context) {
+	h.checkAll(ctx, func(ProviderHealth) bool { return true })
+	ticker := time.NewTicker(h.tick())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.checkAll(ctx, func(st ProviderHealth) bool { return !st.Healthy && !now.Before(st.NextCheck) })
+		}
+	}
+}
+
+// Healthy checks if the provider is healthy, unknown providers are assumed healthy
+func (h *Health) Healthy(name string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st, ok := h.status[name]
+	return !ok || st.Healthy
+}
+
+// Status returns health of all providers, in order of providers
+func (h *Health) Status() []ProviderHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	res := make([]ProviderHealth, 0, len(h.providers))
+	for _, p := range h.providers {
+		res = append(res, *h.status[p.Name()])
+	}
+	return res
+}
+
+// checkAll checks providers matching the filter concurrently and waits for all checks
+func (h *Health) checkAll(ctx context.Context, filter func(ProviderHealth) bool) {
+	var wg sync.WaitGroup
+	for _, p := range h.providers {
+		h.mu.Lock()
+		due := filter(*h.status[p.Name()])
+		h.mu.Unlock()
+		if !due {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.check(ctx, p)
+		}()
+	}
+	wg.Wait()
+}
+
+// check sends the minimal request to the provider and updates its health
+func (h *Health) check(ctx context.Context, p provider.Provider) {
+	checkCtx, cancel := context.WithTimeout(ctx, h.opts.Timeout)
+	defer cancel()
+	st := time.Now()
+	_, err := p.Generate(checkCtx, healthPrompt)
+	if ctx.Err() != nil {
+		return // server is shutting down, keep the last known status
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	health := h.status[p.Name()]
+	health.Checked, health.CheckedAt = true, time.Now()
+	if err == nil {
+		if !health.Healthy {
+			lgr.Printf("[INFO] provider %s recovered after %d failed checks", p.Name(), health.Failures)
+		}
+		health.Healthy, health.Error, health.Failures, health.NextCheck = true, "", 0, time.Time{}
+		health.Latency = time.Since(st).Milliseconds()
+		return
+	}
+	health.Healthy, health.Error, health.Latency = false, err.Error(), 0
+	health.Failures++
+	health.NextCheck = health.CheckedAt.Add(h.backoff(health.Failures))
+	lgr.Printf("[WARN] provider %s failed health check #%d, next check at %s: %v", p.Name(), health.Failures,
+		health.NextCheck.Format(time.TimeOnly), err)
+}
+
+// backoff returns the delay of the re-check after the number of consecutive failures
+func (h *Health) backoff(failures int) time.Duration {
+	res := h.opts.Interval
+	for i := 1; i < failures && res < h.opts.MaxInterval; i++ {
+		res *= 2
+	}
+	return min(res, h.opts.MaxInterval)
+}
+
+// tick returns the period of looking for due re-checks, a fraction of the re-check interval
+func (h *Health) tick() time.Duration {
+	return max(h.opts.Interval/10, 10*time.Millisecond)
+}
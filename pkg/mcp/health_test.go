@@ -0,0 +1,116 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/mcp/mocks"
+	"github.com/umputun/mpt/pkg/provider"
+	provmocks "github.com/umputun/mpt/pkg/provider/mocks"
+)
+
+// flakyProvider returns a provider failing until up is set
+func flakyProvider(name string, up *atomic.Bool) *provmocks.ProviderMock {
+	return &provmocks.ProviderMock{
+		NameFunc:    func() string { return name },
+		EnabledFunc: func() bool { return true },
+		GenerateFunc: func(context.Context, string) (string, error) {
+			if !up.Load() {
+				return "", errors.New("service unavailable")
+			}
+			return "answer of " + name, nil
+		},
+	}
+}
+
+func TestHealth(t *testing.T) {
+	var openaiUp, googleUp atomic.Bool
+	openaiUp.Store(true)
+	openai, google := flakyProvider("OpenAI", &openaiUp), flakyProvider("Google", &googleUp)
+	h := NewHealth([]provider.Provider{openai, google}, HealthOptions{Interval: 20 * time.Millisecond,
+		MaxInterval: 40 * time.Millisecond})
+	assert.True(t, h.Healthy("Google"), "assumed healthy until checked")
+	assert.False(t, h.Status()[1].Checked)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Run(ctx)
+
+	require.Eventually(t, func() bool { return h.Status()[1].Failures >= 3 }, time.Second, 5*time.Millisecond)
+	assert.True(t, h.Healthy("OpenAI"))
+	assert.False(t, h.Healthy("Google"))
+	st := h.Status()[1]
+	assert.Equal(t, "service unavailable", st.Error)
+	assert.True(t, st.Checked)
+	assert.Len(t, openai.GenerateCalls(), 1, "healthy provider is not re-checked")
+	assert.Equal(t, healthPrompt, openai.GenerateCalls()[0].Prompt)
+
+	googleUp.Store(true)
+	require.Eventually(t, func() bool { return h.Healthy("Google") }, time.Second, 5*time.Millisecond)
+	st = h.Status()[1]
+	assert.Zero(t, st.Failures)
+	assert.Empty(t, st.Error)
+	assert.True(t, st.NextCheck.IsZero())
+}
+
+func TestHealth_Backoff(t *testing.T) {
+	h := NewHealth(nil, HealthOptions{Interval: time.Second, MaxInterval: 5 * time.Second})
+	assert.Equal(t, time.Second, h.backoff(1))
+	assert.Equal(t, 2*time.Second, h.backoff(2))
+	assert.Equal(t, 4*time.Second, h.backoff(3))
+	assert.Equal(t, 5*time.Second, h.backoff(4))
+	assert.Equal(t, 5*time.Second, h.backoff(10))
+}
+
+func TestServer_Health(t *testing.T) {
+	var openaiUp, googleUp atomic.Bool
+	openaiUp.Store(true)
+	openai, google := flakyProvider("OpenAI", &openaiUp), flakyProvider("Google", &googleUp)
+	providers := []provider.Provider{openai, google}
+	h := NewHealth(providers, HealthOptions{Interval: time.Hour})
+	runner := &mocks.RunnerMock{RunFunc: func(context.Context, string) (string, error) { return "default runner", nil }}
+	srv := NewServer(runner, ServerOptions{Providers: providers, Health: h})
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"prompt": "p"}
+	res, err := srv.handleGenerateTool(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, "default runner", res.Content[0].(mcp.TextContent).Text, "all providers assumed healthy")
+
+	h.checkAll(context.Background(), func(ProviderHealth) bool { return true })
+
+	res, err = srv.handleGenerateTool(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, "answer of OpenAI", res.Content[0].(mcp.TextContent).Text, "unhealthy provider skipped")
+	assert.Len(t, runner.RunCalls(), 1)
+
+	request.Params.Arguments = map[string]any{"prompt": "p", "providers": []any{"google"}}
+	res, err = srv.handleGenerateTool(context.Background(), request)
+	require.NoError(t, err)
+	assert.True(t, res.IsError, "explicitly selected unhealthy provider is called")
+
+	res, err = srv.handleHealthTool(context.Background(), mcp.CallToolRequest{})
+	require.NoError(t, err)
+	text := res.Content[0].(mcp.TextContent).Text
+	assert.True(t, strings.HasPrefix(text, "OpenAI: healthy, responded in "), text)
+	assert.Contains(t, text, "Google: unhealthy after 1 failed checks, next check at ")
+	assert.Contains(t, text, ": service unavailable")
+	status := res.StructuredContent.(map[string]any)["providers"].([]ProviderHealth)
+	require.Len(t, status, 2)
+	assert.False(t, status[1].Healthy)
+
+	openaiUp.Store(false)
+	h.checkAll(context.Background(), func(ProviderHealth) bool { return true })
+	request.Params.Arguments = map[string]any{"prompt": "p"}
+	_, err = srv.handleGenerateTool(context.Background(), request)
+	require.NoError(t, err)
+	assert.Len(t, runner.RunCalls(), 2, "all providers are used if none is healthy")
+}
@@ -0,0 +1,66 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// PromptTemplate is a stored prompt exposed with the MCP prompts capability
+type PromptTemplate struct {
+	Name        string
+	Description string
+	Arguments   map[string]string // descriptions of arguments by name, all arguments are optional
+	// Render returns the prompt text with the arguments, missing arguments are passed as empty strings
+	Render func(ctx context.Context, args map[string]string) (string, error)
+}
+
+// addPrompts registers prompt templates, so clients can list them and get their text as a user message
+func (s *Server) addPrompts(templates []PromptTemplate) {
+	if len(templates) == 0 {
+		return
+	}
+	prompts := make([]server.ServerPrompt, 0, len(templates))
+	for _, t := range templates {
+		opts := []mcp.PromptOption{mcp.WithPromptDescription(t.Description)}
+		names := make([]string, 0, len(t.Arguments))
+		for name := range t.Arguments {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			opts = append(opts, mcp.WithArgument(name, mcp.ArgumentDescription(t.Arguments[name])))
+		}
+		prompts = append(prompts, server.ServerPrompt{Prompt: mcp.NewPrompt(t.Name, opts...), Handler: s.getPrompt(t)})
+	}
+	s.mcpServer.AddPrompts(prompts...)
+	lgr.Printf("[INFO] exposed %d prompt templates as MCP prompts", len(prompts))
+}
+
+// getPrompt returns the handler rendering the prompt template with arguments of the request
+func (s *Server) getPrompt(t PromptTemplate) server.PromptHandlerFunc {
+	return func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		lgr.Printf("[DEBUG] MCP prompt %q requested", t.Name)
+		args := make(map[string]string, len(t.Arguments))
+		for name := range t.Arguments {
+			args[name] = ""
+		}
+		for name, value := range request.Params.Arguments {
+			if _, ok := t.Arguments[name]; !ok {
+				return nil, fmt.Errorf("unknown argument %q of prompt %s", name, t.Name)
+			}
+			args[name] = value
+		}
+		text, err := t.Render(ctx, args)
+		if err != nil {
+			lgr.Printf("[WARN] MCP prompt %q failed: %v", t.Name, err)
+			return nil, fmt.Errorf("failed to render prompt %s: %w", t.Name, err)
+		}
+		return mcp.NewGetPromptResult(t.Description,
+			[]mcp.PromptMessage{mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(text))}), nil
+	}
+}
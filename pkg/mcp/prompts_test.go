@@ -0,0 +1,54 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/mcp/mocks"
+)
+
+func TestServer_Prompts(t *testing.T) {
+	var rendered map[string]string
+	srv := NewServer(&mocks.RunnerMock{}, ServerOptions{Prompts: []PromptTemplate{
+		{Name: "review", Description: "Code review", Arguments: map[string]string{"focus": "what to focus on", "lang": "language"},
+			Render: func(_ context.Context, args map[string]string) (string, error) {
+				rendered = args
+				return "review focusing on " + args["focus"], nil
+			}},
+		{Name: "broken", Render: func(context.Context, map[string]string) (string, error) { return "", errors.New("no git") }},
+	}})
+
+	var list mcp.ListPromptsResult
+	require.NoError(t, json.Unmarshal(handleMessage(t, srv, "prompts/list", map[string]any{}), &list))
+	require.Len(t, list.Prompts, 2)
+	assert.Equal(t, "broken", list.Prompts[0].Name)
+	assert.Equal(t, mcp.NewPrompt("review", mcp.WithPromptDescription("Code review"),
+		mcp.WithArgument("focus", mcp.ArgumentDescription("what to focus on")),
+		mcp.WithArgument("lang", mcp.ArgumentDescription("language"))), list.Prompts[1])
+
+	var res struct {
+		Description string `json:"description"`
+		Messages    []struct {
+			Role    mcp.Role        `json:"role"`
+			Content mcp.TextContent `json:"content"`
+		} `json:"messages"`
+	}
+	data := handleMessage(t, srv, "prompts/get", map[string]any{"name": "review", "arguments": map[string]string{"focus": "errors"}})
+	require.NoError(t, json.Unmarshal(data, &res))
+	assert.Equal(t, "Code review", res.Description)
+	require.Len(t, res.Messages, 1)
+	assert.Equal(t, mcp.RoleUser, res.Messages[0].Role)
+	assert.Equal(t, "review focusing on errors", res.Messages[0].Content.Text)
+	assert.Equal(t, map[string]string{"focus": "errors", "lang": ""}, rendered)
+
+	data = handleMessage(t, srv, "prompts/get", map[string]any{"name": "review", "arguments": map[string]string{"style": "x"}})
+	assert.JSONEq(t, `{"error": "unknown argument \"style\" of prompt review"}`, string(data))
+	data = handleMessage(t, srv, "prompts/get", map[string]any{"name": "broken"})
+	assert.JSONEq(t, `{"error": "failed to render prompt broken: no git"}`, string(data))
+}
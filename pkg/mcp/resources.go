@@ -0,0 +1,84 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/umputun/mpt/pkg/files"
+)
+
+// loadResources registers files matching patterns of the resources request as MCP resources with file:// URIs,
+// so clients can list and read them. Files are matched with exclusions applied the same way as for prompt
+// context, and their content is read on each request, so it is current while the list is made once.
+func (s *Server) loadResources(ctx context.Context) error {
+	if s.opts.Resources == nil || len(s.opts.Resources.Patterns) == 0 {
+		return nil
+	}
+	matched, err := files.MatchFiles(ctx, *s.opts.Resources)
+	if err != nil {
+		return fmt.Errorf("failed to match resource files: %w", err)
+	}
+
+	dir := s.opts.Resources.Dir
+	if dir == "" {
+		if dir, err = os.Getwd(); err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+	}
+	resources := make([]server.ServerResource, 0, len(matched))
+	for _, file := range matched {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path of %s: %w", file, err)
+		}
+		name := path
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			name = filepath.ToSlash(rel)
+		}
+		resource := mcp.NewResource(fileURI(path), name, mcp.WithMIMEType(mimeType(path)),
+			mcp.WithResourceDescription("file "+name))
+		resources = append(resources, server.ServerResource{Resource: resource, Handler: s.readResource(path)})
+	}
+	s.mcpServer.AddResources(resources...)
+	lgr.Printf("[INFO] exposed %d files as MCP resources", len(resources))
+	return nil
+}
+
+// readResource returns the handler reading content of the file
+func (s *Server) readResource(path string) server.ResourceHandlerFunc {
+	return func(_ context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		lgr.Printf("[DEBUG] MCP resource %s read", request.Params.URI)
+		text, err := files.ReadFile(path, s.opts.Resources.MaxFileSize)
+		if err != nil {
+			return nil, err
+		}
+		return []mcp.ResourceContents{mcp.TextResourceContents{URI: request.Params.URI, MIMEType: mimeType(path),
+			Text: text}}, nil
+	}
+}
+
+// fileURI returns file:// URI of the absolute path
+func fileURI(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path // windows path with a drive letter
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// mimeType returns MIME type of the file by its extension, text/plain for unknown extensions
+func mimeType(path string) string {
+	if t := mime.TypeByExtension(filepath.Ext(path)); t != "" {
+		return t
+	}
+	return "text/plain"
+}
@@ -0,0 +1,95 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/files"
+	"github.com/umputun/mpt/pkg/mcp/mocks"
+)
+
+func TestServer_Resources(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o750))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	write("config.json", `{"a": 1}`)
+	write("pkg/notes.zzz", "some notes")
+	write("secret.key", "ignored")
+	write("vendor/lib.json", "{}")
+	write(".gitignore", "*.key\n")
+
+	srv := NewServer(&mocks.RunnerMock{}, ServerOptions{Resources: &files.LoadRequest{Patterns: []string{"./..."},
+		ExcludePatterns: []string{"vendor/**"}, Dir: dir, MaxFileSize: files.DefaultMaxFileSize}})
+	require.NoError(t, srv.loadResources(context.Background()))
+
+	call := func(method string, params any) json.RawMessage { return handleMessage(t, srv, method, params) }
+
+	var list mcp.ListResourcesResult
+	require.NoError(t, json.Unmarshal(call("resources/list", map[string]any{}), &list))
+	require.Len(t, list.Resources, 3) // sorted by name, secret.key and vendor excluded
+	assert.Equal(t, ".gitignore", list.Resources[0].Name)
+	assert.Equal(t, "config.json", list.Resources[1].Name)
+	assert.Equal(t, fileURI(filepath.Join(dir, "config.json")), list.Resources[1].URI)
+	assert.Equal(t, "application/json", list.Resources[1].MIMEType)
+	assert.Equal(t, "pkg/notes.zzz", list.Resources[2].Name)
+	assert.Equal(t, "text/plain", list.Resources[2].MIMEType)
+
+	// content is read on each request
+	write("pkg/notes.zzz", "updated notes")
+	var read struct {
+		Contents []mcp.TextResourceContents `json:"contents"`
+	}
+	require.NoError(t, json.Unmarshal(call("resources/read", map[string]any{"uri": list.Resources[2].URI}), &read))
+	require.Len(t, read.Contents, 1)
+	assert.Equal(t, "updated notes", read.Contents[0].Text)
+	assert.Equal(t, list.Resources[2].URI, read.Contents[0].URI)
+
+	// excluded files are not readable
+	res := call("resources/read", map[string]any{"uri": fileURI(filepath.Join(dir, "secret.key"))})
+	assert.Contains(t, string(res), "error")
+}
+
+func TestServer_ResourcesNotSet(t *testing.T) {
+	srv := NewServer(&mocks.RunnerMock{}, ServerOptions{})
+	require.NoError(t, srv.loadResources(context.Background()))
+
+	srv = NewServer(&mocks.RunnerMock{}, ServerOptions{Resources: &files.LoadRequest{Patterns: []string{"*.none"},
+		Dir: t.TempDir()}})
+	require.ErrorContains(t, srv.loadResources(context.Background()), "failed to match resource files")
+}
+
+func TestFileURI(t *testing.T) {
+	assert.Equal(t, "file:///home/user/a%20b.go", fileURI("/home/user/a b.go"))
+	assert.Equal(t, "file:///C:/src/main.go", fileURI("C:/src/main.go"))
+}
+
+// handleMessage sends JSON-RPC request to the server and returns the result, or {"error": message} on error
+func handleMessage(t *testing.T, srv *Server, method string, params any) json.RawMessage {
+	t.Helper()
+	msg, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	require.NoError(t, err)
+	data, err := json.Marshal(srv.mcpServer.HandleMessage(context.Background(), msg))
+	require.NoError(t, err)
+	var res struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(data, &res))
+	if res.Error != nil {
+		errData, err := json.Marshal(map[string]string{"error": res.Error.Message})
+		require.NoError(t, err)
+		return errData
+	}
+	return res.Result
+}
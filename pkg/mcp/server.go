@@ -2,11 +2,24 @@ package mcp
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/go-pkgz/lgr"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/umputun/mpt/pkg/drain"
+	"github.com/umputun/mpt/pkg/files"
+	"github.com/umputun/mpt/pkg/mix"
+	"github.com/umputun/mpt/pkg/provider"
+	"github.com/umputun/mpt/pkg/runner"
 )
 
 //go:generate moq -out mocks/runner.go -pkg mocks -skip-ensure -fmt goimports . Runner
@@ -15,6 +28,8 @@ import (
 type Server struct {
 	mcpServer *server.MCPServer
 	runner    Runner
+	opts      ServerOptions
+	requests  *drain.Tracker // in-flight tool calls
 }
 
 // Runner defines the interface for running prompts through providers
@@ -22,6 +37,9 @@ type Runner interface {
 	Run(ctx context.Context, prompt string) (string, error)
 }
 
+// ProviderFactory creates a provider by its name with the given model, used for per-call model overrides
+type ProviderFactory func(name, model string) (provider.Provider, error)
+
 // NewServer creates a new MCP server using MPT's runner
 func NewServer(r Runner, opts ServerOptions) *Server {
 	// create MCP server
@@ -30,12 +48,15 @@ func NewServer(r Runner, opts ServerOptions) *Server {
 		opts.Version,
 		server.WithResourceCapabilities(true, true),
 		server.WithToolCapabilities(true),
+		server.WithPromptCapabilities(false),
 		server.WithLogging(),
 	)
 
 	srv := &Server{
 		mcpServer: mcpServer,
 		runner:    r,
+		opts:      opts,
+		requests:  drain.New(),
 	}
 
 	// add a tool for generating text through MPT's providers
@@ -45,14 +66,67 @@ func NewServer(r Runner, opts ServerOptions) *Server {
 			mcp.Required(),
 			mcp.Description("The prompt to send to the LLM providers"),
 		),
+		mcp.WithArray("providers",
+			mcp.Description("Names of configured providers to run (default: all configured providers)"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithObject("model_overrides",
+			mcp.Description("Map of provider name to model used for this call, e.g. {\"openai\": \"gpt-5-mini\"}"),
+			mcp.AdditionalProperties(map[string]any{"type": "string"}),
+		),
+		mcp.WithString("timeout",
+			mcp.Description("Timeout for this call as a duration, e.g. 30s or 2m"),
+		),
+		mcp.WithBoolean("mix",
+			mcp.Description("Mix (merge) results from all selected providers into a single answer"),
+		),
 	)
 
 	// register the tool handler
 	mcpServer.AddTool(generateTool, srv.handleGenerateTool)
 
+	// add a tool reporting health of providers if they are checked
+	if opts.Health != nil {
+		healthTool := mcp.NewTool("mpt_health",
+			mcp.WithDescription("Report health of LLM providers, checked on start and re-checked while unavailable. "+
+				"Unhealthy providers are skipped by mpt_generate calls not selecting providers explicitly"),
+			mcp.WithTitleAnnotation("Provider health"),
+			mcp.WithReadOnlyHintAnnotation(true),
+			mcp.WithOpenWorldHintAnnotation(false),
+		)
+		mcpServer.AddTool(healthTool, srv.handleHealthTool)
+	}
+
+	srv.addPrompts(opts.Prompts)
 	return srv
 }
 
+// handleHealthTool reports health status of providers
+func (s *Server) handleHealthTool(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	status := s.opts.Health.Status()
+	lines := make([]string, 0, len(status))
+	for _, st := range status {
+		switch {
+		case !st.Checked:
+			lines = append(lines, st.Provider+": not checked yet")
+		case st.Healthy:
+			lines = append(lines, fmt.Sprintf("%s: healthy, responded in %dms", st.Provider, st.Latency))
+		default:
+			lines = append(lines, fmt.Sprintf("%s: unhealthy after %d failed checks, next check at %s: %s", st.Provider,
+				st.Failures, st.NextCheck.Format(time.RFC3339), st.Error))
+		}
+	}
+	return mcp.NewToolResultStructured(map[string]any{"providers": status}, strings.Join(lines, "\n")), nil
+}
+
+// generateParams holds optional per-call parameters of the mpt_generate tool
+type generateParams struct {
+	providers      []string
+	modelOverrides map[string]string
+	timeout        time.Duration
+	mix            bool
+}
+
 // handleGenerateTool processes text generation requests by routing them through MPT's runner
 func (s *Server) handleGenerateTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	lgr.Printf("[DEBUG] MCP tool 'mpt_generate' called")
@@ -64,11 +138,37 @@ func (s *Server) handleGenerateTool(ctx context.Context, request mcp.CallToolReq
 		return nil, fmt.Errorf("invalid prompt parameter: %w", err)
 	}
 
+	params, err := parseGenerateParams(request)
+	if err != nil {
+		lgr.Printf("[WARN] MCP tool 'mpt_generate' invalid parameters: %v", err)
+		return nil, err
+	}
+
+	ctx, release, err := s.requests.Acquire(ctx)
+	if err != nil {
+		lgr.Printf("[WARN] MCP tool 'mpt_generate' rejected: %v", err)
+		return nil, err
+	}
+	defer release()
+
+	if params.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, params.timeout)
+		defer cancel()
+	}
+
 	// run the prompt through MPT's runner
 	lgr.Printf("[DEBUG] MCP tool 'mpt_generate' running prompt through MPT")
-	result, err := s.runner.Run(ctx, prompt)
+	result, err := s.run(ctx, prompt, params)
+	if err != nil && drain.Canceled(ctx) {
+		err = fmt.Errorf("canceled by server shutdown: %w", err)
+	}
 	if err != nil {
 		lgr.Printf("[WARN] MCP tool 'mpt_generate' failed: %v", err)
+		// report provider failures as a tool error with structured details, so clients can branch on them
+		if perrs := provider.Errors(err); len(perrs) > 0 {
+			return providerErrorResult(err, perrs), nil
+		}
 		return nil, fmt.Errorf("failed to run prompt through MPT: %w", err)
 	}
 
@@ -77,13 +177,255 @@ func (s *Server) handleGenerateTool(ctx context.Context, request mcp.CallToolReq
 	return mcp.NewToolResultText(result), nil
 }
 
-// Start starts the MCP server using stdio transport (standard input/output)
-func (s *Server) Start() error {
-	return server.ServeStdio(s.mcpServer)
+// providerError represents details of a provider failure in the structured content of a tool error
+type providerError struct {
+	Provider  string `json:"provider"`
+	Message   string `json:"message"`
+	Status    int    `json:"status,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Retryable bool   `json:"retryable"`
+}
+
+// providerErrorResult creates a tool error result with details of all provider failures
+func providerErrorResult(err error, perrs []*provider.Error) *mcp.CallToolResult {
+	details := make([]providerError, 0, len(perrs))
+	for _, e := range perrs {
+		details = append(details, providerError{Provider: e.Provider, Message: e.Error(), Status: e.Status,
+			Code: e.Code, Retryable: e.Retryable})
+	}
+	res := mcp.NewToolResultStructured(map[string]any{"error": err.Error(), "providers": details},
+		"failed to run prompt through MPT: "+err.Error())
+	res.IsError = true
+	return res
+}
+
+// parseGenerateParams extracts optional provider selection, model overrides, timeout and mix arguments
+func parseGenerateParams(request mcp.CallToolRequest) (generateParams, error) {
+	args := request.GetArguments()
+	params := generateParams{
+		providers: request.GetStringSlice("providers", nil),
+		mix:       request.GetBool("mix", false),
+	}
+
+	if raw, ok := args["model_overrides"]; ok && raw != nil {
+		overrides, ok := raw.(map[string]any)
+		if !ok {
+			return params, fmt.Errorf("invalid model_overrides parameter: expected object")
+		}
+		params.modelOverrides = make(map[string]string, len(overrides))
+		for name, model := range overrides {
+			modelStr, ok := model.(string)
+			if !ok {
+				return params, fmt.Errorf("invalid model_overrides parameter: model for %q is not a string", name)
+			}
+			params.modelOverrides[name] = modelStr
+		}
+	}
+
+	if timeout := request.GetString("timeout", ""); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return params, fmt.Errorf("invalid timeout parameter %q: expected positive duration like 30s", timeout)
+		}
+		params.timeout = d
+	}
+
+	return params, nil
+}
+
+// run executes the prompt with the default runner, or with the selected providers if the call customizes them
+// or some providers are unhealthy
+func (s *Server) run(ctx context.Context, prompt string, params generateParams) (string, error) {
+	customized := len(params.providers) > 0 || len(params.modelOverrides) > 0 || params.mix
+	if !customized && len(s.healthyProviders()) == len(s.opts.Providers) {
+		return s.runner.Run(ctx, prompt)
+	}
+
+	providers, err := s.selectProviders(params)
+	if err != nil {
+		return "", err
+	}
+
+	r := runner.New(providers...)
+	if s.opts.Quota != nil {
+		r.WithQuota(s.opts.Quota)
+	}
+	if s.opts.Limiter != nil {
+		r.WithLimiter(s.opts.Limiter)
+	}
+	res, err := r.Execute(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+
+	if !params.mix || len(providers) < 2 {
+		return res.Text, nil
+	}
+
+	mixResp, err := mix.New(lgr.Default()).Process(ctx, mix.Request{
+		Prompt:       prompt,
+		MixPrompt:    s.opts.MixPrompt,
+		MixProvider:  s.opts.MixProvider,
+		RefinePrompt: s.opts.MixRefinePrompt,
+		MaxTokens:    s.opts.MixMaxTokens,
+		Style:        s.opts.MixStyle,
+		Capabilities: s.opts.Capabilities,
+		Providers:    providers,
+		Results:      res.Results,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to mix results: %w", err)
+	}
+	if mixResp.TextWithHeader == "" {
+		return res.Text, nil // not enough successful results to mix
+	}
+	return mixResp.TextWithHeader, nil
+}
+
+// healthyProviders returns configured providers which are healthy, or all of them if health is not checked
+// or none is healthy, so calls still try providers which may have recovered
+func (s *Server) healthyProviders() []provider.Provider {
+	if s.opts.Health == nil {
+		return s.opts.Providers
+	}
+	res := make([]provider.Provider, 0, len(s.opts.Providers))
+	for _, p := range s.opts.Providers {
+		if s.opts.Health.Healthy(p.Name()) {
+			res = append(res, p)
+		}
+	}
+	if len(res) == 0 {
+		return s.opts.Providers
+	}
+	return res
+}
+
+// selectProviders picks the requested providers (all healthy configured providers if none requested)
+// and applies model overrides
+func (s *Server) selectProviders(params generateParams) ([]provider.Provider, error) {
+	selected := s.healthyProviders()
+	if len(params.providers) > 0 {
+		selected = make([]provider.Provider, 0, len(params.providers))
+		for _, name := range params.providers {
+			p := findProvider(name, s.opts.Providers)
+			if p == nil {
+				return nil, fmt.Errorf("provider %q is not configured", name)
+			}
+			selected = append(selected, p)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no providers configured for provider selection")
+	}
+
+	// check all overrides refer to selected providers
+	for name := range params.modelOverrides {
+		if findProvider(name, selected) == nil {
+			return nil, fmt.Errorf("model override for provider %q which is not selected", name)
+		}
+	}
+
+	res := make([]provider.Provider, 0, len(selected))
+	for _, p := range selected {
+		model := findOverride(p.Name(), params.modelOverrides)
+		if model == "" {
+			res = append(res, p)
+			continue
+		}
+		if s.opts.ProviderFactory == nil {
+			return nil, fmt.Errorf("model overrides are not supported by this server")
+		}
+		overridden, err := s.opts.ProviderFactory(p.Name(), model)
+		if err != nil {
+			return nil, fmt.Errorf("failed to override model for %s: %w", p.Name(), err)
+		}
+		res = append(res, overridden)
+	}
+	return res, nil
+}
+
+// findProvider returns the enabled provider with the given name (case-insensitive), or nil
+func findProvider(name string, providers []provider.Provider) provider.Provider {
+	for _, p := range providers {
+		if p.Enabled() && strings.EqualFold(p.Name(), name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// findOverride returns the model override for the provider name (case-insensitive), or empty string
+func findOverride(name string, overrides map[string]string) string {
+	for n, model := range overrides {
+		if strings.EqualFold(n, name) {
+			return model
+		}
+	}
+	return ""
+}
+
+// Start starts the MCP server using stdio transport (standard input/output), it runs until the context
+// is canceled or SIGTERM is received. Health checks of providers, if set, run in background.
+// Files of resources, if set, are matched before listening.
+// On shutdown new tool calls are rejected, while running ones may complete within the shutdown grace period
+// and are canceled after it, responding with partial results or errors.
+func (s *Server) Start(ctx context.Context) error {
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM)
+	defer cancel()
+	return s.serve(ctx, os.Stdin, os.Stdout)
+}
+
+// serve runs the stdio transport on the given input and output until the context is canceled or the input
+// is closed, see Start
+func (s *Server) serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	if err := s.loadResources(ctx); err != nil {
+		return err
+	}
+	if s.opts.Health != nil {
+		go s.opts.Health.Run(ctx)
+	}
+
+	// listen with a separate context, so responses of running calls are written after shutdown is requested
+	listenCtx, stopListen := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopListen()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.NewStdioServer(s.mcpServer).Listen(listenCtx, in, out)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err // input closed or failed
+	case <-ctx.Done():
+	}
+
+	lgr.Printf("[INFO] shutting down MCP server, waiting for running calls up to %v", s.opts.ShutdownGrace)
+	if !s.requests.Drain(s.opts.ShutdownGrace) {
+		lgr.Printf("[WARN] shutdown grace period expired, running calls canceled")
+	}
+	stopListen()
+	if err := <-errCh; err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
 }
 
 // ServerOptions contains configuration options for the MCP server
 type ServerOptions struct {
-	Name    string
-	Version string
+	Name            string
+	Version         string
+	Providers       []provider.Provider   // configured providers available for per-call selection
+	ProviderFactory ProviderFactory       // creates providers for per-call model overrides, optional
+	MixProvider     string                // provider used to mix results when the call requests mix
+	MixPrompt       string                // prompt used to mix results when the call requests mix
+	MixRefinePrompt string                // prompt of refinement stages if MixProvider is a chain of providers
+	MixMaxTokens    int                   // max tokens of the mixed result, 0 for no limit
+	MixStyle        string                // style of the mixed result, one of mix.Styles, free-form if empty
+	Capabilities    provider.Capabilities // capabilities of providers, to select mix provider by capability
+	Quota           runner.QuotaTracker   // rate limits of providers shared by all calls, optional
+	Limiter         runner.Limiter        // in-flight request limits of providers shared by all calls, optional
+	Health          *Health               // health of providers, unhealthy providers are skipped, optional
+	ShutdownGrace   time.Duration         // how long running calls may complete on shutdown
+	Resources       *files.LoadRequest    // files exposed as resources, matched on start, optional
+	Prompts         []PromptTemplate      // stored prompts exposed with the prompts capability, optional
 }
@@ -1,15 +1,23 @@
 package mcp
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/umputun/mpt/pkg/drain"
 	"github.com/umputun/mpt/pkg/mcp/mocks"
+	"github.com/umputun/mpt/pkg/provider"
+	provmocks "github.com/umputun/mpt/pkg/provider/mocks"
 )
 
 func TestNewServer(t *testing.T) {
@@ -90,6 +98,14 @@ func TestServer_handleGenerateTool(t *testing.T) {
 		},
 	}
 
+	providerErrorRunner := &mocks.RunnerMock{
+		RunFunc: func(ctx context.Context, prompt string) (string, error) {
+			perr := &provider.Error{Provider: "OpenAI", Status: 429, Code: "rate_limit_exceeded",
+				Message: "rate limit", Retryable: true}
+			return "", fmt.Errorf("all providers failed: %s: %w", perr.Provider, perr)
+		},
+	}
+
 	canceledContextRunner := &mocks.RunnerMock{
 		RunFunc: func(ctx context.Context, prompt string) (string, error) {
 			// simulate the context being canceled
@@ -156,6 +172,25 @@ func TestServer_handleGenerateTool(t *testing.T) {
 			expectError:    true,
 			errorText:      "failed to run prompt through MPT",
 		},
+		{
+			name:           "provider error reported as tool error",
+			runner:         providerErrorRunner,
+			arguments:      map[string]any{"prompt": "Test prompt"},
+			expectedPrompt: "Test prompt",
+			checkResult: func(t *testing.T, result *mcp.CallToolResult) {
+				assert.True(t, result.IsError)
+				require.NotEmpty(t, result.Content)
+				textContent, ok := result.Content[0].(mcp.TextContent)
+				require.True(t, ok, "Expected TextContent")
+				assert.Equal(t, "failed to run prompt through MPT: all providers failed: OpenAI: rate limit", textContent.Text)
+
+				structured, ok := result.StructuredContent.(map[string]any)
+				require.True(t, ok, "Expected structured content")
+				assert.Equal(t, "all providers failed: OpenAI: rate limit", structured["error"])
+				assert.Equal(t, []providerError{{Provider: "OpenAI", Message: "rate limit", Status: 429,
+					Code: "rate_limit_exceeded", Retryable: true}}, structured["providers"])
+			},
+		},
 		{
 			name:           "canceled context",
 			runner:         canceledContextRunner,
@@ -208,3 +243,204 @@ func TestServer_handleGenerateTool(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_handleGenerateTool_ProviderSelection(t *testing.T) {
+	newProvider := func(name, text string) *provmocks.ProviderMock {
+		return &provmocks.ProviderMock{
+			NameFunc:    func() string { return name },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				if strings.HasPrefix(prompt, "merge results") {
+					return "mixed by " + name, nil
+				}
+				return text, nil
+			},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		arguments map[string]any
+		factory   ProviderFactory
+		wantText  []string
+		skipText  []string
+		wantErr   string
+		runnerRun bool
+	}{
+		{
+			name:      "no selection uses default runner",
+			arguments: map[string]any{"prompt": "p"},
+			wantText:  []string{"default runner"},
+			runnerRun: true,
+		},
+		{
+			name:      "single provider selected",
+			arguments: map[string]any{"prompt": "p", "providers": []any{"anthropic"}},
+			wantText:  []string{"anthropic answer"},
+			skipText:  []string{"openai answer", "== generated by"},
+		},
+		{
+			name:      "two providers selected",
+			arguments: map[string]any{"prompt": "p", "providers": []any{"OpenAI", "Google"}},
+			wantText:  []string{"== generated by OpenAI ==", "== generated by Google =="},
+			skipText:  []string{"anthropic answer"},
+		},
+		{
+			name:      "mix requested",
+			arguments: map[string]any{"prompt": "p", "providers": []any{"openai", "google"}, "mix": true},
+			wantText:  []string{"== mixed results by OpenAI ==", "mixed by OpenAI"},
+		},
+		{
+			name: "model override",
+			arguments: map[string]any{"prompt": "p", "providers": []any{"openai"},
+				"model_overrides": map[string]any{"openai": "gpt-test"}},
+			factory: func(name, model string) (provider.Provider, error) {
+				return newProvider(name, "answer from "+model), nil
+			},
+			wantText: []string{"answer from gpt-test"},
+		},
+		{
+			name:      "model override without factory",
+			arguments: map[string]any{"prompt": "p", "model_overrides": map[string]any{"openai": "gpt-test"}},
+			wantErr:   "model overrides are not supported",
+		},
+		{
+			name:      "model override for not selected provider",
+			arguments: map[string]any{"prompt": "p", "providers": []any{"google"}, "model_overrides": map[string]any{"openai": "x"}},
+			wantErr:   `model override for provider "openai" which is not selected`,
+		},
+		{
+			name:      "unknown provider",
+			arguments: map[string]any{"prompt": "p", "providers": []any{"unknown"}},
+			wantErr:   `provider "unknown" is not configured`,
+		},
+		{
+			name:      "invalid timeout",
+			arguments: map[string]any{"prompt": "p", "timeout": "soon"},
+			wantErr:   `invalid timeout parameter "soon"`,
+		},
+		{
+			name:      "invalid model overrides",
+			arguments: map[string]any{"prompt": "p", "model_overrides": "openai=gpt"},
+			wantErr:   "invalid model_overrides parameter",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			runner := &mocks.RunnerMock{
+				RunFunc: func(ctx context.Context, prompt string) (string, error) { return "default runner", nil },
+			}
+			srv := NewServer(runner, ServerOptions{
+				Providers: []provider.Provider{newProvider("OpenAI", "openai answer"),
+					newProvider("Anthropic", "anthropic answer"), newProvider("Google", "google answer")},
+				ProviderFactory: tc.factory,
+				MixProvider:     "openai",
+				MixPrompt:       "merge results",
+			})
+
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = tc.arguments
+			result, err := srv.handleGenerateTool(context.Background(), request)
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			textContent, ok := result.Content[0].(mcp.TextContent)
+			require.True(t, ok)
+			for _, text := range tc.wantText {
+				assert.Contains(t, textContent.Text, text)
+			}
+			for _, text := range tc.skipText {
+				assert.NotContains(t, textContent.Text, text)
+			}
+			assert.Equal(t, tc.runnerRun, len(runner.RunCalls()) == 1)
+		})
+	}
+}
+
+func TestServer_handleGenerateTool_Timeout(t *testing.T) {
+	runner := &mocks.RunnerMock{
+		RunFunc: func(ctx context.Context, prompt string) (string, error) {
+			deadline, ok := ctx.Deadline()
+			require.True(t, ok, "context should have deadline")
+			assert.WithinDuration(t, time.Now().Add(30*time.Second), deadline, time.Second)
+			return "ok", nil
+		},
+	}
+	srv := NewServer(runner, ServerOptions{})
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"prompt": "p", "timeout": "30s"}
+	_, err := srv.handleGenerateTool(context.Background(), request)
+	require.NoError(t, err)
+	require.Len(t, runner.RunCalls(), 1)
+}
+
+func TestServer_handleGenerateTool_Shutdown(t *testing.T) {
+	runner := &mocks.RunnerMock{
+		RunFunc: func(ctx context.Context, prompt string) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		},
+	}
+	srv := NewServer(runner, ServerOptions{})
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"prompt": "p"}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := srv.handleGenerateTool(context.Background(), request)
+		errCh <- err
+	}()
+	require.Eventually(t, func() bool { return len(runner.RunCalls()) == 1 }, time.Second, 5*time.Millisecond)
+
+	assert.False(t, srv.requests.Drain(50*time.Millisecond), "running call canceled after grace period")
+	require.ErrorContains(t, <-errCh, "canceled by server shutdown")
+
+	_, err := srv.handleGenerateTool(context.Background(), request)
+	require.ErrorIs(t, err, drain.ErrShutdown, "new calls rejected while draining")
+}
+
+func TestServer_serve(t *testing.T) {
+	started := make(chan struct{})
+	runner := &mocks.RunnerMock{
+		RunFunc: func(ctx context.Context, prompt string) (string, error) {
+			close(started)
+			<-ctx.Done()
+			return "", ctx.Err()
+		},
+	}
+	srv := NewServer(runner, ServerOptions{ShutdownGrace: 50 * time.Millisecond})
+
+	inR, inW := io.Pipe() // input is never closed, as stdin of the MCP client
+	defer inW.Close()
+	outR, outW := io.Pipe()
+	defer outR.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.serve(ctx, inR, outW) }()
+	go func() {
+		_, _ = inW.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call",` +
+			`"params":{"name":"mpt_generate","arguments":{"prompt":"p"}}}` + "\n"))
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tool call not started")
+	}
+
+	cancel()
+	resp, err := bufio.NewReader(outR).ReadString('\n')
+	require.NoError(t, err)
+	assert.Contains(t, resp, "canceled by server shutdown", "running call canceled after grace period")
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not stopped on canceled context")
+	}
+}
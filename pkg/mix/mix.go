@@ -3,6 +3,7 @@ package mix
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/go-pkgz/lgr"
@@ -13,6 +14,21 @@ import (
 
 //go:generate moq -out mocks/provider.go -pkg mocks -skip-ensure -fmt goimports ../provider Provider
 
+// DefaultRefinePrompt is the prompt used by refinement stages of the mix provider chain
+const DefaultRefinePrompt = "review and improve the merged answer below using the original results, " +
+	"fix mistakes and fill gaps, return only the improved answer"
+
+// UpdatePrompt is the prompt updating the answer merged from early results with results of providers answered later
+const UpdatePrompt = "update the merged answer below with the late results of other providers, add what they have new, " +
+	"fix what they show to be wrong, return only the updated answer"
+
+// Styles are instructions added to prompts of the mix provider chain for supported styles of the mixed result
+var Styles = map[string]string{
+	"bullet":    "format the answer as a concise bulleted list, one point per item, without repeating points",
+	"narrative": "write the answer as concise prose paragraphs, without lists and tables",
+	"table":     "format the answer as a markdown table, with a short note below it only if something doesn't fit the table",
+}
+
 // Manager handles mixing results from multiple providers
 type Manager struct {
 	logger lgr.L
@@ -32,7 +48,11 @@ func New(logger lgr.L) *Manager {
 type Request struct {
 	Prompt            string
 	MixPrompt         string
-	MixProvider       string
+	MixProvider       string                // provider merging the results, or comma-separated chain of providers, see Process
+	RefinePrompt      string                // prompt of refinement stages in the chain, DefaultRefinePrompt if empty
+	MaxTokens         int                   // max tokens of the mixed result, limit of the mix provider chain requests, 0 for no limit
+	Style             string                // style of the mixed result, one of Styles, free-form if empty
+	Capabilities      provider.Capabilities // capabilities of providers, for "capability:<cap>" specs in MixProvider
 	ConsensusEnabled  bool
 	ConsensusAttempts int
 	Providers         []provider.Provider
@@ -41,15 +61,26 @@ type Request struct {
 
 // Response holds the result of mixing provider responses including consensus information
 type Response struct {
-	TextWithHeader    string
-	RawText           string
-	MixProvider       string
-	ConsensusAchieved bool
-	ConsensusAttempts int
-	ConsensusError    error // error from consensus checking, if any
+	TextWithHeader       string
+	RawText              string
+	MixProvider          string  // provider of the final text, the last successful stage of the chain
+	Stages               []Stage // merge stage followed by refinement stages, in order of execution
+	ConsensusAchieved    bool
+	ConsensusAttempts    int
+	ConsensusExplanation string // judge's reasoning of the last consensus check
+	ConsensusError       error  // error from consensus checking, if any
+}
+
+// Stage is the result of a single stage of the mix provider chain
+type Stage struct {
+	Provider string
+	Text     string
+	Error    error // error of the stage, the chain stops at the failed stage
 }
 
-// Process handles mixing results from multiple providers with optional consensus
+// Process handles mixing results from multiple providers with optional consensus. MixProvider can be a chain
+// of providers, like "google,openai": the first provider merges the results, and each next one refines
+// the answer of the previous stage. If a refinement stage fails, the answer of the last successful stage is used.
 func (m *Manager) Process(ctx context.Context, req Request) (*Response, error) {
 	// validate input
 	if ctx == nil {
@@ -64,6 +95,9 @@ func (m *Manager) Process(ctx context.Context, req Request) (*Response, error) {
 	if req.MixPrompt == "" {
 		return nil, fmt.Errorf("mix prompt cannot be empty")
 	}
+	if _, ok := Styles[req.Style]; req.Style != "" && !ok {
+		return nil, fmt.Errorf("unknown mix style %q", req.Style)
+	}
 
 	// filter successful results
 	var successfulResults []provider.Result
@@ -79,15 +113,17 @@ func (m *Manager) Process(ctx context.Context, req Request) (*Response, error) {
 	}
 
 	result := &Response{}
+	chain := splitChain(req.MixProvider)
 
 	// if consensus enabled, check and attempt consensus
 	if req.ConsensusEnabled && len(successfulResults) > 1 {
 		cm := consensus.New(m.logger)
 		consensusOpts := consensus.Options{
-			Enabled:     true,
-			Attempts:    req.ConsensusAttempts,
-			Prompt:      req.Prompt,
-			MixProvider: req.MixProvider,
+			Enabled:      true,
+			Attempts:     req.ConsensusAttempts,
+			Prompt:       req.Prompt,
+			MixProvider:  chain[0],
+			Capabilities: req.Capabilities,
 		}
 
 		consensusReq := consensus.AttemptRequest{
@@ -106,17 +142,22 @@ func (m *Manager) Process(ctx context.Context, req Request) (*Response, error) {
 			successfulResults = consensusResp.FinalResults
 			result.ConsensusAttempts = consensusResp.Attempts
 			result.ConsensusAchieved = consensusResp.Achieved
+			result.ConsensusExplanation = consensusResp.Explanation
 		}
 		// log consensus attempts for transparency
 		m.logger.Logf("[INFO] consensus attempts made: %d, achieved: %v", result.ConsensusAttempts, result.ConsensusAchieved)
 	}
 
+	// requests of the mix provider chain are limited by max tokens and asked for the style of the result
+	ctx = provider.WithMaxTokens(ctx, req.MaxTokens)
+
 	// mix the results
 	mixReq := mixRequest{
-		MixPrompt:   req.MixPrompt,
-		MixProvider: req.MixProvider,
-		Providers:   req.Providers,
-		Results:     successfulResults,
+		MixPrompt:    req.shaped(req.MixPrompt),
+		MixProvider:  chain[0],
+		Capabilities: req.Capabilities,
+		Providers:    req.Providers,
+		Results:      successfulResults,
 	}
 
 	textWithHeader, rawText, mixProvider, err := m.mixResults(ctx, mixReq)
@@ -127,29 +168,147 @@ func (m *Manager) Process(ctx context.Context, req Request) (*Response, error) {
 	result.TextWithHeader = textWithHeader
 	result.RawText = rawText
 	result.MixProvider = mixProvider
+	result.Stages = []Stage{{Provider: mixProvider, Text: rawText}}
+
+	// refine the merged answer with the rest of the chain
+	refinePrompt := req.RefinePrompt
+	if refinePrompt == "" {
+		refinePrompt = DefaultRefinePrompt
+	}
+	names := []string{mixProvider}
+	for _, name := range chain[1:] {
+		stage := m.refine(ctx, req.shaped(refinePrompt), name, req, successfulResults, result.Stages[len(result.Stages)-1])
+		result.Stages = append(result.Stages, stage)
+		if stage.Error != nil {
+			m.logger.Logf("[WARN] mix refinement by %s failed, using answer of the previous stage: %v", name, stage.Error)
+			break
+		}
+		result.RawText, result.MixProvider = stage.Text, stage.Provider
+		names = append(names, stage.Provider)
+	}
+	if len(names) > 1 {
+		result.TextWithHeader = fmt.Sprintf("== mixed results by %s, refined by %s ==\n%s",
+			names[0], strings.Join(names[1:], ", "), result.RawText)
+	}
+
+	// show what the providers disagree on if they failed to reach consensus
+	if req.ConsensusEnabled && !result.ConsensusAchieved && result.ConsensusExplanation != "" {
+		result.TextWithHeader += "\n\n== points of disagreement ==\n" + result.ConsensusExplanation
+	}
 
 	return result, nil
 }
 
+// Update updates the mixed result with late results of providers answered after mixing was started, by the provider
+// of the mixed result. The mixed result is returned as is if none of late results is successful, and on error.
+func (m *Manager) Update(ctx context.Context, req Request, mixed *Response, late []provider.Result) (*Response, error) {
+	var successful []provider.Result
+	names := make([]string, 0, len(late))
+	for _, r := range late {
+		if r.Error == nil {
+			successful = append(successful, r)
+			names = append(names, r.Provider)
+		}
+	}
+	if len(successful) == 0 || mixed.RawText == "" {
+		return mixed, nil
+	}
+
+	ctx = provider.WithMaxTokens(ctx, req.MaxTokens)
+	stage := m.refine(ctx, req.shaped(UpdatePrompt), mixed.MixProvider, req, successful,
+		Stage{Provider: mixed.MixProvider, Text: mixed.RawText})
+	if stage.Error != nil {
+		return mixed, fmt.Errorf("failed to update mixed result with late results: %w", stage.Error)
+	}
+
+	res := *mixed
+	res.Stages = append(slices.Clone(mixed.Stages), stage)
+	res.RawText, res.MixProvider = stage.Text, stage.Provider
+	header, _, _ := strings.Cut(mixed.TextWithHeader, "\n")
+	res.TextWithHeader = fmt.Sprintf("%s, updated with late results of %s ==\n%s",
+		strings.TrimSuffix(header, " =="), strings.Join(names, ", "), stage.Text)
+	return &res, nil
+}
+
+// shaped returns the prompt with instructions of the style and the length of the mixed result, if set
+func (r Request) shaped(prompt string) string {
+	if style := Styles[r.Style]; style != "" {
+		prompt += ", " + style
+	}
+	if r.MaxTokens > 0 {
+		prompt += fmt.Sprintf(", keep the answer shorter than %d tokens", r.MaxTokens)
+	}
+	return prompt
+}
+
+// refine makes a refinement stage of the chain, improving the answer of the previous stage
+func (m *Manager) refine(ctx context.Context, refinePrompt, name string, req Request,
+	results []provider.Result, prev Stage) Stage {
+	p := provider.FindProvider(name, req.Providers, req.Capabilities)
+	if p == nil {
+		return Stage{Provider: name, Error: fmt.Errorf("no enabled provider found for refinement")}
+	}
+	if !isCapabilitySpec(name) && !strings.Contains(strings.ToLower(p.Name()), strings.ToLower(name)) {
+		m.logger.Logf("[INFO] specified refinement provider '%s' not enabled, falling back to '%s'", name, p.Name())
+	}
+
+	var sb strings.Builder
+	sb.WriteString(refinePrompt)
+	sb.WriteString("\n\n")
+	sb.WriteString(fmt.Sprintf("=== Merged answer by %s ===\n%s\n\n", prev.Provider, prev.Text))
+	for i, r := range results {
+		sb.WriteString(fmt.Sprintf("=== Result %d from %s ===\n%s\n\n", i+1, r.Provider, r.Text))
+	}
+
+	text, err := p.Generate(ctx, sb.String())
+	if err != nil {
+		return Stage{Provider: p.Name(), Error: fmt.Errorf("failed to refine mixed result using %s: %w", p.Name(), err)}
+	}
+	return Stage{Provider: p.Name(), Text: text}
+}
+
+// isCapabilitySpec checks if the provider spec selects the provider by capability
+func isCapabilitySpec(spec string) bool {
+	return strings.HasPrefix(spec, provider.CapabilityPrefix)
+}
+
+// splitChain splits comma-separated chain of mix providers, the result has at least one, possibly empty, name
+func splitChain(spec string) []string {
+	var res []string
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			res = append(res, name)
+		}
+	}
+	if len(res) == 0 {
+		return []string{""}
+	}
+	return res
+}
+
 // mixRequest holds parameters for mixing results (internal use)
 type mixRequest struct {
-	MixPrompt   string
-	MixProvider string
-	Providers   []provider.Provider
-	Results     []provider.Result
+	MixPrompt    string
+	MixProvider  string
+	Capabilities provider.Capabilities
+	Providers    []provider.Provider
+	Results      []provider.Result
 }
 
 // mixResults takes multiple provider results and uses a selected provider to mix them
 func (m *Manager) mixResults(ctx context.Context, req mixRequest) (textWithHeader, rawText, mixProvider string, err error) {
 	// find the mix provider using shared utility
-	mixProv := provider.FindProviderByName(req.MixProvider, req.Providers)
+	mixProv := provider.FindProvider(req.MixProvider, req.Providers, req.Capabilities)
 
+	if mixProv == nil && isCapabilitySpec(req.MixProvider) {
+		return "", "", "", fmt.Errorf("no enabled provider with %s found for mixing results", req.MixProvider)
+	}
 	if mixProv == nil {
 		return "", "", "", fmt.Errorf("no enabled provider found for mixing results")
 	}
 
 	// log if we're using a fallback provider
-	if !strings.Contains(strings.ToLower(mixProv.Name()), strings.ToLower(req.MixProvider)) {
+	if !isCapabilitySpec(req.MixProvider) && !strings.Contains(strings.ToLower(mixProv.Name()), strings.ToLower(req.MixProvider)) {
 		m.logger.Logf("[INFO] specified mix provider '%s' not enabled, falling back to '%s'",
 			req.MixProvider, mixProv.Name())
 	}
@@ -159,6 +159,48 @@ func TestManager_Process(t *testing.T) {
 		assert.Equal(t, 1, resp.ConsensusAttempts)
 	})
 
+	t.Run("points of disagreement without consensus", func(t *testing.T) {
+		mockOpenAI := &mocks.ProviderMock{
+			NameFunc:    func() string { return "OpenAI" },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				if strings.Contains(prompt, "Do the following AI responses fundamentally agree") {
+					return "NO\n- OpenAI says Paris, Anthropic says Lyon", nil
+				}
+				if strings.Contains(prompt, "merge results from all providers") {
+					return "Merged results", nil
+				}
+				return "Paris", nil
+			},
+		}
+		mockAnthropic := &mocks.ProviderMock{
+			NameFunc:     func() string { return "Anthropic" },
+			EnabledFunc:  func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return "Lyon", nil },
+		}
+
+		req := Request{
+			Prompt:            "What is the capital of France?",
+			MixPrompt:         "merge results from all providers",
+			MixProvider:       "openai",
+			ConsensusEnabled:  true,
+			ConsensusAttempts: 1,
+			Providers:         []provider.Provider{mockOpenAI, mockAnthropic},
+			Results: []provider.Result{
+				{Provider: "OpenAI", Text: "Paris"},
+				{Provider: "Anthropic", Text: "Lyon"},
+			},
+		}
+
+		resp, err := manager.Process(ctx, req)
+		require.NoError(t, err)
+		assert.False(t, resp.ConsensusAchieved)
+		assert.Equal(t, "- OpenAI says Paris, Anthropic says Lyon", resp.ConsensusExplanation)
+		assert.Equal(t, "== mixed results by OpenAI ==\nMerged results\n\n== points of disagreement ==\n"+
+			"- OpenAI says Paris, Anthropic says Lyon", resp.TextWithHeader)
+		assert.Equal(t, "Merged results", resp.RawText)
+	})
+
 	t.Run("insufficient results for mixing", func(t *testing.T) {
 		mockOpenAI := &mocks.ProviderMock{
 			NameFunc:    func() string { return "OpenAI" },
@@ -315,6 +357,159 @@ func TestManager_Process(t *testing.T) {
 	})
 }
 
+func TestManager_ProcessChain(t *testing.T) {
+	newProvider := func(name, answer string, err error, prompts *[]string) *mocks.ProviderMock {
+		return &mocks.ProviderMock{
+			NameFunc:    func() string { return name },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				*prompts = append(*prompts, prompt)
+				return answer, err
+			},
+		}
+	}
+	results := []provider.Result{
+		{Provider: "OpenAI", Text: "Result from OpenAI"},
+		{Provider: "Google", Text: "Result from Google"},
+		{Provider: "Anthropic", Error: errors.New("failed")},
+	}
+
+	t.Run("merge and refine", func(t *testing.T) {
+		var googlePrompts, openaiPrompts, anthropicPrompts []string
+		providers := []provider.Provider{
+			newProvider("OpenAI", "refined by openai", nil, &openaiPrompts),
+			newProvider("Google", "merged by google", nil, &googlePrompts),
+			newProvider("Anthropic", "refined by anthropic", nil, &anthropicPrompts),
+		}
+		resp, err := New(nil).Process(context.Background(), Request{MixPrompt: "merge", MixProvider: "google, openai,anthropic",
+			RefinePrompt: "improve it", Providers: providers, Results: results})
+		require.NoError(t, err)
+
+		assert.Equal(t, "refined by anthropic", resp.RawText)
+		assert.Equal(t, "Anthropic", resp.MixProvider)
+		assert.Equal(t, "== mixed results by Google, refined by OpenAI, Anthropic ==\nrefined by anthropic", resp.TextWithHeader)
+		assert.Equal(t, []Stage{{Provider: "Google", Text: "merged by google"}, {Provider: "OpenAI", Text: "refined by openai"},
+			{Provider: "Anthropic", Text: "refined by anthropic"}}, resp.Stages)
+
+		require.Len(t, googlePrompts, 1)
+		assert.True(t, strings.HasPrefix(googlePrompts[0], "merge\n\n"))
+		require.Len(t, openaiPrompts, 1)
+		assert.True(t, strings.HasPrefix(openaiPrompts[0], "improve it\n\n=== Merged answer by Google ===\nmerged by google\n\n"))
+		assert.Contains(t, openaiPrompts[0], "=== Result 2 from Google ===\nResult from Google")
+		assert.NotContains(t, openaiPrompts[0], "Anthropic", "failed results not included")
+		require.Len(t, anthropicPrompts, 1)
+		assert.Contains(t, anthropicPrompts[0], "=== Merged answer by OpenAI ===\nrefined by openai")
+	})
+
+	t.Run("failed refinement keeps previous stage", func(t *testing.T) {
+		var prompts []string
+		providers := []provider.Provider{
+			newProvider("OpenAI", "", errors.New("rate limit"), &prompts),
+			newProvider("Google", "merged by google", nil, &prompts),
+			newProvider("Anthropic", "refined by anthropic", nil, &prompts),
+		}
+		resp, err := New(nil).Process(context.Background(), Request{MixPrompt: "merge", MixProvider: "google,openai,anthropic",
+			Providers: providers, Results: results})
+		require.NoError(t, err)
+
+		assert.Equal(t, "merged by google", resp.RawText)
+		assert.Equal(t, "Google", resp.MixProvider)
+		assert.Equal(t, "== mixed results by Google ==\nmerged by google", resp.TextWithHeader)
+		require.Len(t, resp.Stages, 2, "chain stopped at failed stage")
+		assert.Equal(t, "OpenAI", resp.Stages[1].Provider)
+		require.EqualError(t, resp.Stages[1].Error, "failed to refine mixed result using OpenAI: rate limit")
+		require.Len(t, prompts, 2)
+		assert.True(t, strings.HasPrefix(prompts[1], DefaultRefinePrompt), "default refine prompt used")
+	})
+}
+
+func TestManager_Update(t *testing.T) {
+	var prompts []string
+	google := &mocks.ProviderMock{
+		NameFunc:    func() string { return "Google" },
+		EnabledFunc: func() bool { return true },
+		GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+			prompts = append(prompts, prompt)
+			return "updated by google", nil
+		},
+	}
+	mixed := &Response{TextWithHeader: "== mixed results by Google ==\nmerged by google", RawText: "merged by google",
+		MixProvider: "Google", Stages: []Stage{{Provider: "Google", Text: "merged by google"}}}
+	req := Request{MixPrompt: "merge", MixProvider: "google", Providers: []provider.Provider{google}}
+
+	t.Run("late results", func(t *testing.T) {
+		resp, err := New(nil).Update(context.Background(), req, mixed, []provider.Result{
+			{Provider: "Anthropic", Error: errors.New("failed")}, {Provider: "OpenAI", Text: "late from openai"}})
+		require.NoError(t, err)
+		assert.Equal(t, "updated by google", resp.RawText)
+		assert.Equal(t, "== mixed results by Google, updated with late results of OpenAI ==\nupdated by google", resp.TextWithHeader)
+		assert.Equal(t, []Stage{{Provider: "Google", Text: "merged by google"}, {Provider: "Google", Text: "updated by google"}},
+			resp.Stages)
+		assert.Len(t, mixed.Stages, 1, "mixed result not changed")
+
+		require.Len(t, prompts, 1)
+		assert.True(t, strings.HasPrefix(prompts[0], UpdatePrompt+"\n\n=== Merged answer by Google ===\nmerged by google\n\n"))
+		assert.Contains(t, prompts[0], "=== Result 1 from OpenAI ===\nlate from openai")
+		assert.NotContains(t, prompts[0], "Anthropic", "failed results not included")
+	})
+
+	t.Run("no successful late results", func(t *testing.T) {
+		resp, err := New(nil).Update(context.Background(), req, mixed, []provider.Result{{Provider: "Anthropic", Error: errors.New("failed")}})
+		require.NoError(t, err)
+		assert.Same(t, mixed, resp)
+	})
+
+	t.Run("failed update", func(t *testing.T) {
+		google.GenerateFunc = func(ctx context.Context, prompt string) (string, error) { return "", errors.New("overloaded") }
+		resp, err := New(nil).Update(context.Background(), req, mixed, []provider.Result{{Provider: "OpenAI", Text: "late"}})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "overloaded")
+		assert.Same(t, mixed, resp)
+	})
+}
+
+func TestManager_ProcessShaped(t *testing.T) {
+	var prompts []string
+	newProvider := func(name, answer string) *mocks.ProviderMock {
+		return &mocks.ProviderMock{
+			NameFunc:    func() string { return name },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				prompts = append(prompts, prompt)
+				return answer, nil
+			},
+		}
+	}
+	providers := []provider.Provider{newProvider("OpenAI", "- refined"), newProvider("Google", "- merged")}
+	results := []provider.Result{{Provider: "OpenAI", Text: "Result from OpenAI"}, {Provider: "Google", Text: "Result from Google"}}
+
+	resp, err := New(nil).Process(context.Background(), Request{MixPrompt: "merge", MixProvider: "google,openai",
+		RefinePrompt: "improve it", MaxTokens: 500, Style: "bullet", Providers: providers, Results: results})
+	require.NoError(t, err)
+	assert.Equal(t, "- refined", resp.RawText)
+	require.Len(t, prompts, 2)
+	assert.True(t, strings.HasPrefix(prompts[0], "merge, "+Styles["bullet"]+", keep the answer shorter than 500 tokens\n\n"),
+		prompts[0])
+	assert.True(t, strings.HasPrefix(prompts[1], "improve it, "+Styles["bullet"]+", keep the answer shorter than 500 tokens\n\n"),
+		prompts[1])
+
+	_, err = New(nil).Process(context.Background(), Request{MixPrompt: "merge", MixProvider: "google", Style: "poem",
+		Providers: providers, Results: results})
+	require.EqualError(t, err, `unknown mix style "poem"`)
+}
+
+func TestRequest_Shaped(t *testing.T) {
+	assert.Equal(t, "merge", Request{}.shaped("merge"))
+	assert.Equal(t, "merge, "+Styles["table"], Request{Style: "table"}.shaped("merge"))
+	assert.Equal(t, "merge, keep the answer shorter than 100 tokens", Request{MaxTokens: 100}.shaped("merge"))
+}
+
+func TestSplitChain(t *testing.T) {
+	assert.Equal(t, []string{"google", "openai"}, splitChain(" google , openai,"))
+	assert.Equal(t, []string{"openai"}, splitChain("openai"))
+	assert.Equal(t, []string{""}, splitChain(""))
+}
+
 func TestManager_mixResults(t *testing.T) {
 	ctx := context.Background()
 	manager := New(nil)
@@ -389,3 +584,53 @@ func TestManager_mixResults(t *testing.T) {
 		assert.NotContains(t, textWithHeader, "Google")
 	})
 }
+
+func TestManager_ProcessCapability(t *testing.T) {
+	newProvider := func(name, answer string) *mocks.ProviderMock {
+		return &mocks.ProviderMock{
+			NameFunc:     func() string { return name },
+			EnabledFunc:  func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return answer, nil },
+		}
+	}
+	providers := []provider.Provider{newProvider("OpenAI", "by openai"), newProvider("Google", "by google")}
+	results := []provider.Result{{Provider: "OpenAI", Text: "one"}, {Provider: "Google", Text: "two"}}
+	caps := provider.Capabilities{}
+	caps.Set("OpenAI", provider.CapabilityJSON)
+	caps.Set("Google", provider.CapabilityJSON, provider.CapabilityCheap)
+
+	t.Run("merge and refine by capability", func(t *testing.T) {
+		resp, err := New(nil).Process(context.Background(), Request{MixPrompt: "merge",
+			MixProvider: "capability:cheap,capability:supports-json", Capabilities: caps, Providers: providers, Results: results})
+		require.NoError(t, err)
+		assert.Equal(t, "== mixed results by Google, refined by OpenAI ==\nby openai", resp.TextWithHeader)
+	})
+
+	t.Run("no provider with capability", func(t *testing.T) {
+		_, err := New(nil).Process(context.Background(), Request{MixPrompt: "merge",
+			MixProvider: "capability:supports-vision", Capabilities: caps, Providers: providers, Results: results})
+		require.EqualError(t, err, "no enabled provider with capability:supports-vision found for mixing results")
+	})
+
+	t.Run("consensus checked by provider with capability", func(t *testing.T) {
+		var checked bool
+		judge := &mocks.ProviderMock{
+			NameFunc:    func() string { return "Google" },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				if strings.Contains(prompt, "Do the following AI responses fundamentally agree") {
+					checked = true
+					return "YES", nil
+				}
+				return "merged", nil
+			},
+		}
+		resp, err := New(nil).Process(context.Background(), Request{MixPrompt: "merge", MixProvider: "capability:cheap",
+			Capabilities: caps, ConsensusEnabled: true, ConsensusAttempts: 1,
+			Providers: []provider.Provider{newProvider("OpenAI", "by openai"), judge}, Results: results})
+		require.NoError(t, err)
+		assert.True(t, checked)
+		assert.True(t, resp.ConsensusAchieved)
+		assert.Equal(t, "Google", resp.MixProvider)
+	})
+}
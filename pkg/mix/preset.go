@@ -0,0 +1,66 @@
+package mix
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/umputun/mpt/pkg/prompt"
+)
+
+// Presets are built-in mix prompts tuned for common ways of merging results, selected by name
+var Presets = map[string]string{
+	"summarize": "summarize the results from all providers into a single answer, keep points most of them agree on " +
+		"and the important details only one of them has, drop repetitions and filler, don't mention the providers",
+	"reconcile": "reconcile the results from all providers: keep what they agree on, resolve disagreements by " +
+		"checking which claim is better supported and correct, note disagreements that can't be resolved " +
+		"with the positions of each side, and return a single consistent answer",
+	"rank": "rank the results from all providers from best to worst by correctness, completeness and relevance " +
+		"to the question, give a short reason for each place, then return the best answer improved " +
+		"with what the others have right and it misses",
+	"table-compare": "compare the results from all providers in a markdown table with a row per key point and " +
+		"a column per provider, mark where they agree and differ, followed by a short conclusion " +
+		"with the answer best supported by the results",
+}
+
+// LoadPreset returns the mix prompt of the named preset. Presets are markdown prompt files in the dir,
+// named <name>.md, falling back to built-in Presets, so a file in the dir overrides the built-in preset
+// of the same name.
+func LoadPreset(name, dir string) (string, error) {
+	if dir != "" {
+		f, err := prompt.LoadFile(filepath.Join(dir, name+".md"))
+		switch {
+		case err == nil && strings.TrimSpace(f.Text) == "":
+			return "", fmt.Errorf("mix preset %q is empty", name)
+		case err == nil:
+			return strings.TrimSpace(f.Text), nil
+		case !errors.Is(err, fs.ErrNotExist):
+			return "", fmt.Errorf("failed to load mix preset %q: %w", name, err)
+		}
+	}
+	if p, ok := Presets[name]; ok {
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown mix preset %q, known presets: %s", name, strings.Join(presetNames(dir), ", "))
+}
+
+// presetNames returns sorted names of built-in presets and presets in the dir
+func presetNames(dir string) []string {
+	res := make([]string, 0, len(Presets))
+	for name := range Presets {
+		res = append(res, name)
+	}
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, e := range entries {
+			if name, ok := strings.CutSuffix(e.Name(), ".md"); ok && !e.IsDir() && !slices.Contains(res, name) {
+				res = append(res, name)
+			}
+		}
+	}
+	slices.Sort(res)
+	return res
+}
@@ -0,0 +1,38 @@
+package mix
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPreset(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rank.md"), []byte("rank them by security\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "review.md"),
+		[]byte("---\ndescription: merge code reviews\n---\nmerge review findings, drop duplicates\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "blank.md"), []byte("\n"), 0o600))
+
+	for name, want := range map[string]string{"summarize": Presets["summarize"], "rank": "rank them by security",
+		"review": "merge review findings, drop duplicates"} {
+		t.Run(name, func(t *testing.T) {
+			p, err := LoadPreset(name, dir)
+			require.NoError(t, err)
+			assert.Equal(t, want, p)
+		})
+	}
+
+	p, err := LoadPreset("table-compare", "")
+	require.NoError(t, err)
+	assert.Equal(t, Presets["table-compare"], p, "built-in preset without the dir")
+
+	_, err = LoadPreset("blank", dir)
+	require.EqualError(t, err, `mix preset "blank" is empty`)
+	_, err = LoadPreset("poem", dir)
+	require.EqualError(t, err, `unknown mix preset "poem", known presets: blank, rank, reconcile, review, summarize, table-compare`)
+	_, err = LoadPreset("poem", filepath.Join(dir, "missing"))
+	require.EqualError(t, err, `unknown mix preset "poem", known presets: rank, reconcile, summarize, table-compare`)
+}
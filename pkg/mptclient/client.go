@@ -0,0 +1,264 @@
+// Package mptclient is the Go API of mpt, for programs embedding multi-provider orchestration without running
+// the CLI. Client sends prompts to providers in parallel, like the CLI does, and optionally mixes their answers
+// into a single one with consensus checking. Providers are made with constructors of the provider package,
+// like provider.NewOpenAI, and types of this package don't change with internals of the runner and mix packages.
+package mptclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+
+	"github.com/umputun/mpt/pkg/provider"
+	"github.com/umputun/mpt/pkg/runner"
+)
+
+// DefaultMixPrompt is the prompt mixing answers of providers if MixRequest doesn't set it
+const DefaultMixPrompt = "merge results from all providers"
+
+// Client sends prompts to providers. It is safe for concurrent use.
+type Client struct {
+	providers []provider.Provider
+	opts      Options
+}
+
+// Options are optional settings of the client
+type Options struct {
+	Order    Order        // order of results, order of providers if empty
+	Required []string     // names of providers which must succeed, failures of the rest only reported in results
+	Quota    QuotaTracker // rate limits of providers, shared by concurrent requests
+	Limiter  Limiter      // in-flight request limits of providers, shared by concurrent requests
+	Logger   lgr.L        // logger of mixing and consensus checking, lgr.Default() if nil
+}
+
+// Order defines the order of results
+type Order string
+
+const (
+	// OrderConfigured keeps results in the order of providers of the client
+	OrderConfigured Order = "configured"
+	// OrderName sorts results by provider name
+	OrderName Order = "name"
+	// OrderLatency sorts results by response latency, fastest first
+	OrderLatency Order = "latency"
+)
+
+// QuotaTracker keeps rate limits reported by providers. It is shared by concurrent requests,
+// so implementations must be safe for concurrent use.
+type QuotaTracker interface {
+	Update(providerName string, q provider.Quota)    // records the quota reported by the provider
+	Wait(providerName string) (time.Duration, error) // time to wait for exhausted quota, error to skip the provider
+}
+
+// Limiter limits in-flight requests of providers. It is shared by concurrent requests, so implementations
+// must be safe for concurrent use.
+type Limiter interface {
+	// Acquire waits for a free request slot of the provider and returns the func releasing it,
+	// or an error if the context is done while waiting
+	Acquire(ctx context.Context, providerName string) (release func(), err error)
+}
+
+// Request is the prompt sent to providers
+type Request struct {
+	Prompt    string
+	Providers []string  // names of providers, case-insensitive, all enabled providers if empty
+	Callbacks Callbacks // streaming callbacks of the request, optional
+}
+
+// Callbacks are called as the request progresses. They are called concurrently from requests of providers,
+// so they must be safe for concurrent use. Any of them can be nil. OnChunk is called only by providers
+// streaming the response text, OpenAI and OpenAI-compatible ones with chat completions endpoint, and makes
+// them stream; empty text starts the response over, e.g. on retry. OnResult has the whole final text.
+type Callbacks struct {
+	OnStart    func(provider string)                 // the prompt is sent to the provider
+	OnProgress func(provider string, received int64) // part of the response arrived, with bytes received so far
+	OnChunk    func(provider, text string)           // piece of the response text, empty when the response starts
+	OnResult   func(Result)                          // the provider request completed, successfully or not
+}
+
+// Result is the answer of a single provider
+type Result struct {
+	Provider     string
+	Text         string
+	Reasoning    string        // reasoning trace, if exposed by the model
+	Truncated    bool          // answer was cut off by the max tokens limit
+	Model        string        // model which served the request, as reported by the provider
+	FinishReason string        // reason the generation stopped, as reported by the provider
+	Latency      time.Duration // time spent to get the answer
+	Err          error         // error of the request, the rest of fields are empty if set
+}
+
+// Response is the outcome of Generate
+type Response struct {
+	Text    string   // answers of all providers, with a header of each provider if there are several of them
+	Results []Result // answers of providers, failed ones included, in the order of Options.Order
+}
+
+// New makes the client of the enabled providers
+func New(providers []provider.Provider, opts Options) (*Client, error) {
+	enabled := make([]provider.Provider, 0, len(providers))
+	for _, p := range providers {
+		if p.Enabled() {
+			enabled = append(enabled, p)
+		}
+	}
+	if len(enabled) == 0 {
+		return nil, errors.New("no enabled providers")
+	}
+	switch opts.Order {
+	case "", OrderConfigured, OrderName, OrderLatency:
+	default:
+		return nil, fmt.Errorf("unknown order %q", opts.Order)
+	}
+	if opts.Logger == nil {
+		opts.Logger = lgr.Default()
+	}
+	return &Client{providers: enabled, opts: opts}, nil
+}
+
+// Generate sends the prompt to providers in parallel and returns their answers. It fails if all providers
+// or any of required ones fail, with the response of the rest of providers.
+func (c *Client) Generate(ctx context.Context, req Request) (*Response, error) {
+	_, run, err := c.generate(ctx, req)
+	if run == nil {
+		return nil, err
+	}
+	return &Response{Text: run.Text, Results: results(run.Results)}, err
+}
+
+// generate runs the request and returns selected providers with results of the run, nil results if the request
+// is invalid
+func (c *Client) generate(ctx context.Context, req Request) ([]provider.Provider, *runner.Results, error) {
+	if strings.TrimSpace(req.Prompt) == "" {
+		return nil, nil, errors.New("empty prompt")
+	}
+	providers, err := c.selectProviders(req.Providers)
+	if err != nil {
+		return nil, nil, err
+	}
+	run, err := c.runner(providers, req.Callbacks).Execute(ctx, req.Prompt)
+	return providers, &run, err
+}
+
+// runner makes the runner of the providers with options of the client
+func (c *Client) runner(providers []provider.Provider, cb Callbacks) *runner.Runner {
+	r := runner.New(providers...).WithOrder(runnerOrder(c.opts.Order))
+	if cb.OnChunk != nil {
+		r.WithHooks(chunkHooks{hooks{cb: cb}}) // streams responses, only if chunks are wanted
+	} else {
+		r.WithHooks(hooks{cb: cb})
+	}
+	if c.opts.Quota != nil {
+		r.WithQuota(quotaTracker{c.opts.Quota})
+	}
+	if c.opts.Limiter != nil {
+		r.WithLimiter(limiter{c.opts.Limiter})
+	}
+	if len(c.opts.Required) > 0 {
+		r.WithRequired(c.opts.Required...)
+	}
+	return r
+}
+
+// runnerOrder converts the order of results to the order of the runner
+func runnerOrder(o Order) runner.Order {
+	switch o {
+	case OrderName:
+		return runner.OrderName
+	case OrderLatency:
+		return runner.OrderLatency
+	case OrderConfigured:
+		return runner.OrderConfigured
+	}
+	return ""
+}
+
+// quotaTracker adapts QuotaTracker of the client to runner.QuotaTracker
+type quotaTracker struct{ q QuotaTracker }
+
+// Update records the quota reported by the provider
+func (t quotaTracker) Update(name string, q provider.Quota) { t.q.Update(name, q) }
+
+// Wait returns the time to wait for exhausted quota of the provider
+func (t quotaTracker) Wait(name string) (time.Duration, error) { return t.q.Wait(name) }
+
+// limiter adapts Limiter of the client to runner.Limiter
+type limiter struct{ l Limiter }
+
+// Acquire waits for a free request slot of the provider
+func (l limiter) Acquire(ctx context.Context, name string) (func(), error) {
+	return l.l.Acquire(ctx, name)
+}
+
+// selectProviders returns providers with the names, case-insensitive, or all of them if names are empty
+func (c *Client) selectProviders(names []string) ([]provider.Provider, error) {
+	if len(names) == 0 {
+		return c.providers, nil
+	}
+	res := make([]provider.Provider, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, p := range c.providers {
+			if !strings.EqualFold(p.Name(), name) {
+				continue
+			}
+			if slices.Contains(res, p) {
+				return nil, fmt.Errorf("provider %q is selected more than once", name)
+			}
+			res, found = append(res, p), true
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("provider %q is not enabled", name)
+		}
+	}
+	return res, nil
+}
+
+// results converts results of providers to results of the client
+func results(rr []provider.Result) []Result {
+	res := make([]Result, 0, len(rr))
+	for _, r := range rr {
+		res = append(res, Result{Provider: r.Provider, Text: r.Text, Reasoning: r.Reasoning, Truncated: r.Truncated,
+			Model: r.Model, FinishReason: r.FinishReason, Latency: r.Latency, Err: r.Error})
+	}
+	return res
+}
+
+// hooks adapt streaming callbacks to runner hooks
+type hooks struct{ cb Callbacks }
+
+// OnStart calls OnStart callback, if set
+func (h hooks) OnStart(name string) {
+	if h.cb.OnStart != nil {
+		h.cb.OnStart(name)
+	}
+}
+
+// OnProgress calls OnProgress callback, if set
+func (h hooks) OnProgress(name string, received int64) {
+	if h.cb.OnProgress != nil {
+		h.cb.OnProgress(name, received)
+	}
+}
+
+// OnProviderDone calls OnResult callback with the result, if set
+func (h hooks) OnProviderDone(r provider.Result) {
+	if h.cb.OnResult != nil {
+		h.cb.OnResult(results([]provider.Result{r})[0])
+	}
+}
+
+// OnAllDone does nothing, the response is returned when all providers are done
+func (h hooks) OnAllDone([]provider.Result, error) {}
+
+// chunkHooks adapt streaming callbacks with OnChunk to runner hooks, implementing runner.ChunkHooks
+type chunkHooks struct{ hooks }
+
+// OnChunk calls OnChunk callback with the piece of the response text
+func (h chunkHooks) OnChunk(name, text string) { h.cb.OnChunk(name, text) }
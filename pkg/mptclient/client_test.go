@@ -0,0 +1,202 @@
+package mptclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider"
+	"github.com/umputun/mpt/pkg/provider/mocks"
+)
+
+func newProvider(name, answer string, err error) *mocks.ProviderMock {
+	return &mocks.ProviderMock{
+		NameFunc:    func() string { return name },
+		EnabledFunc: func() bool { return true },
+		GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+			if strings.HasPrefix(prompt, DefaultMixPrompt) {
+				return "mixed by " + name, nil
+			}
+			return answer, err
+		},
+	}
+}
+
+func TestNew(t *testing.T) {
+	disabled := newProvider("OpenAI", "", nil)
+	disabled.EnabledFunc = func() bool { return false }
+	_, err := New([]provider.Provider{disabled}, Options{})
+	require.EqualError(t, err, "no enabled providers")
+
+	c, err := New([]provider.Provider{disabled, newProvider("Google", "", nil)}, Options{})
+	require.NoError(t, err)
+	require.Len(t, c.providers, 1)
+	assert.Equal(t, "Google", c.providers[0].Name())
+	assert.NotNil(t, c.opts.Logger)
+
+	_, err = New([]provider.Provider{newProvider("Google", "", nil)}, Options{Order: "random"})
+	require.EqualError(t, err, `unknown order "random"`)
+}
+
+func TestClient_Generate(t *testing.T) {
+	providers := []provider.Provider{newProvider("OpenAI", "answer from openai", nil),
+		newProvider("Google", "answer from google", nil), newProvider("Anthropic", "", errors.New("rate limit"))}
+	c, err := New(providers, Options{Order: OrderName})
+	require.NoError(t, err)
+
+	t.Run("all providers with callbacks", func(t *testing.T) {
+		var mu sync.Mutex
+		var started, done []string
+		resp, err := c.Generate(context.Background(), Request{Prompt: "question", Callbacks: Callbacks{
+			OnStart: func(name string) {
+				mu.Lock()
+				defer mu.Unlock()
+				started = append(started, name)
+			},
+			OnResult: func(r Result) {
+				mu.Lock()
+				defer mu.Unlock()
+				done = append(done, r.Provider)
+			},
+		}})
+		require.NoError(t, err)
+		require.Len(t, resp.Results, 3)
+		assert.Equal(t, "Anthropic", resp.Results[0].Provider, "ordered by name")
+		assert.EqualError(t, resp.Results[0].Err, "rate limit")
+		assert.Equal(t, "answer from google", resp.Results[1].Text)
+		assert.Contains(t, resp.Text, "answer from openai")
+		assert.ElementsMatch(t, []string{"OpenAI", "Google", "Anthropic"}, started)
+		assert.ElementsMatch(t, []string{"OpenAI", "Google", "Anthropic"}, done)
+	})
+
+	t.Run("selected provider", func(t *testing.T) {
+		resp, err := c.Generate(context.Background(), Request{Prompt: "question", Providers: []string{"google"}})
+		require.NoError(t, err)
+		assert.Equal(t, "answer from google", resp.Text)
+		require.Len(t, resp.Results, 1)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		resp, err := c.Generate(context.Background(), Request{Prompt: "question", Providers: []string{"anthropic"}})
+		require.Error(t, err)
+		require.NotNil(t, resp, "results returned on failure")
+		require.Len(t, resp.Results, 1)
+		assert.EqualError(t, resp.Results[0].Err, "rate limit")
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		_, err := c.Generate(context.Background(), Request{Prompt: " "})
+		require.EqualError(t, err, "empty prompt")
+		_, err = c.Generate(context.Background(), Request{Prompt: "q", Providers: []string{"deepseek"}})
+		require.EqualError(t, err, `provider "deepseek" is not enabled`)
+		_, err = c.Generate(context.Background(), Request{Prompt: "q", Providers: []string{"openai", "OpenAI"}})
+		require.EqualError(t, err, `provider "OpenAI" is selected more than once`)
+	})
+}
+
+func TestClient_GenerateRequired(t *testing.T) {
+	providers := []provider.Provider{newProvider("OpenAI", "answer from openai", nil),
+		newProvider("Anthropic", "", errors.New("rate limit"))}
+	c, err := New(providers, Options{Required: []string{"anthropic"}})
+	require.NoError(t, err)
+	resp, err := c.Generate(context.Background(), Request{Prompt: "question"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Anthropic")
+	require.Len(t, resp.Results, 2)
+}
+
+// countingLimiter counts acquired request slots of providers
+type countingLimiter struct {
+	mu       sync.Mutex
+	acquired map[string]int
+}
+
+func (l *countingLimiter) Acquire(_ context.Context, name string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.acquired[name]++
+	return func() {}, nil
+}
+
+// skippingQuota skips providers with exhausted quota
+type skippingQuota struct{ exhausted string }
+
+func (q skippingQuota) Update(string, provider.Quota) {}
+
+func (q skippingQuota) Wait(name string) (time.Duration, error) {
+	if strings.EqualFold(name, q.exhausted) {
+		return 0, errors.New("quota exhausted")
+	}
+	return 0, nil
+}
+
+func TestClient_GenerateQuotaAndLimiter(t *testing.T) {
+	providers := []provider.Provider{newProvider("OpenAI", "answer from openai", nil),
+		newProvider("Google", "answer from google", nil)}
+	lim := &countingLimiter{acquired: map[string]int{}}
+	c, err := New(providers, Options{Order: OrderLatency, Limiter: lim, Quota: skippingQuota{exhausted: "google"}})
+	require.NoError(t, err)
+	resp, err := c.Generate(context.Background(), Request{Prompt: "question"})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 2)
+	assert.Equal(t, map[string]int{"OpenAI": 1, "Google": 1}, lim.acquired)
+	for _, r := range resp.Results {
+		if r.Provider == "Google" {
+			assert.ErrorContains(t, r.Err, "quota exhausted")
+			continue
+		}
+		assert.Equal(t, "answer from openai", r.Text)
+	}
+}
+
+func TestClient_GenerateChunks(t *testing.T) {
+	streamed := make(chan bool, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		stream := strings.Contains(string(data), `"stream":true`)
+		streamed <- stream
+		if !stream {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"whole answer"},"finish_reason":"stop"}]}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, text := range []string{"streamed", " answer"} {
+			_, _ = w.Write([]byte(`data: {"choices":[{"delta":{"content":"` + text + `"}}]}` + "\n\n"))
+		}
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer ts.Close()
+	local := provider.NewCustomOpenAI(provider.CustomOptions{Name: "Local", BaseURL: ts.URL + "/v1", Model: "m", Enabled: true})
+	c, err := New([]provider.Provider{local}, Options{})
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var chunks []string
+	resp, err := c.Generate(context.Background(), Request{Prompt: "question", Callbacks: Callbacks{
+		OnChunk: func(name, text string) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, "Local", name)
+			chunks = append(chunks, text)
+		},
+	}})
+	require.NoError(t, err)
+	assert.True(t, <-streamed, "streamed with OnChunk")
+	assert.Equal(t, "streamed answer", resp.Text)
+	assert.Equal(t, []string{"", "streamed", " answer"}, chunks)
+
+	resp, err = c.Generate(context.Background(), Request{Prompt: "question"})
+	require.NoError(t, err)
+	assert.False(t, <-streamed, "not streamed without OnChunk")
+	assert.Equal(t, "whole answer", resp.Text)
+}
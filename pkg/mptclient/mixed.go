@@ -0,0 +1,87 @@
+package mptclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/umputun/mpt/pkg/mix"
+)
+
+// maxConsensusAttempts limits attempts to reach consensus, the same as the CLI does
+const maxConsensusAttempts = 5
+
+// MixRequest is the prompt sent to providers with their answers mixed into a single one
+type MixRequest struct {
+	Request
+	MixProvider       string // provider mixing answers, or comma-separated chain of providers refining the mixed answer, first provider if empty
+	MixPrompt         string // prompt mixing answers, DefaultMixPrompt if empty
+	RefinePrompt      string // prompt of refinement stages of the chain, mix.DefaultRefinePrompt if empty
+	MaxTokens         int    // max tokens of the mixed answer, 0 for no limit
+	Style             string // style of the mixed answer, one of mix.Styles, free-form if empty
+	ConsensusAttempts int    // attempts to reach consensus of providers before mixing, up to 5, not checked if 0
+}
+
+// MixedResponse is the outcome of GenerateMixed
+type MixedResponse struct {
+	Response
+	Mixed       string     // mixed answer without header, empty if less than two providers answered
+	MixProvider string     // provider of the mixed answer, the last successful stage of the chain
+	Consensus   *Consensus // outcome of consensus checking, nil if not requested
+}
+
+// Consensus is the outcome of consensus checking of answers
+type Consensus struct {
+	Achieved    bool
+	Attempts    int
+	Explanation string // judge's reasoning of the last check, points of disagreement if not achieved
+	Err         error  // error of checking, answers are mixed anyway
+}
+
+// GenerateMixed sends the prompt to providers in parallel and mixes their answers into a single one. Answers
+// are mixed if at least two providers answered, otherwise the response has only answers of providers.
+func (c *Client) GenerateMixed(ctx context.Context, req MixRequest) (*MixedResponse, error) {
+	if req.ConsensusAttempts < 0 || req.ConsensusAttempts > maxConsensusAttempts {
+		return nil, fmt.Errorf("consensus attempts must be between 0 and %d, got %d", maxConsensusAttempts,
+			req.ConsensusAttempts)
+	}
+	if _, ok := mix.Styles[req.Style]; req.Style != "" && !ok {
+		return nil, fmt.Errorf("unknown mix style %q", req.Style)
+	}
+	providers, run, err := c.generate(ctx, req.Request)
+	if run == nil {
+		return nil, err
+	}
+	res := &MixedResponse{Response: Response{Text: run.Text, Results: results(run.Results)}}
+	if err != nil {
+		return res, err
+	}
+
+	mixReq := mix.Request{
+		Prompt:            req.Prompt,
+		MixPrompt:         req.MixPrompt,
+		MixProvider:       req.MixProvider,
+		RefinePrompt:      req.RefinePrompt,
+		MaxTokens:         req.MaxTokens,
+		Style:             req.Style,
+		ConsensusEnabled:  req.ConsensusAttempts > 0,
+		ConsensusAttempts: req.ConsensusAttempts,
+		Providers:         providers,
+		Results:           run.Results,
+	}
+	if mixReq.MixPrompt == "" {
+		mixReq.MixPrompt = DefaultMixPrompt
+	}
+	if mixReq.MixProvider == "" {
+		mixReq.MixProvider = providers[0].Name()
+	}
+	mixed, err := mix.New(c.opts.Logger).Process(ctx, mixReq)
+	if err != nil {
+		return res, fmt.Errorf("failed to mix answers: %w", err)
+	}
+	res.Mixed, res.MixProvider = mixed.RawText, mixed.MixProvider
+	if mixReq.ConsensusEnabled {
+		res.Consensus = &Consensus{Achieved: mixed.ConsensusAchieved, Attempts: mixed.ConsensusAttempts,
+			Explanation: mixed.ConsensusExplanation, Err: mixed.ConsensusError}
+	}
+	return res, nil
+}
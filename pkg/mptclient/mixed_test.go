@@ -0,0 +1,70 @@
+package mptclient
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+func TestClient_GenerateMixed(t *testing.T) {
+	google := newProvider("Google", "answer from google", nil)
+	providers := []provider.Provider{newProvider("OpenAI", "answer from openai", nil), google,
+		newProvider("Anthropic", "", errors.New("rate limit"))}
+	c, err := New(providers, Options{})
+	require.NoError(t, err)
+
+	t.Run("mixed", func(t *testing.T) {
+		resp, err := c.GenerateMixed(context.Background(), MixRequest{Request: Request{Prompt: "question"},
+			MixProvider: "google", Style: "bullet"})
+		require.NoError(t, err)
+		assert.Equal(t, "mixed by Google", resp.Mixed)
+		assert.Equal(t, "Google", resp.MixProvider)
+		assert.Nil(t, resp.Consensus)
+		require.Len(t, resp.Results, 3)
+		calls := google.GenerateCalls()
+		assert.True(t, strings.HasPrefix(calls[len(calls)-1].Prompt, DefaultMixPrompt+", "), "style added to the mix prompt")
+	})
+
+	t.Run("first provider mixes by default", func(t *testing.T) {
+		resp, err := c.GenerateMixed(context.Background(), MixRequest{Request: Request{Prompt: "question"}})
+		require.NoError(t, err)
+		assert.Equal(t, "mixed by OpenAI", resp.Mixed)
+	})
+
+	t.Run("with consensus", func(t *testing.T) {
+		resp, err := c.GenerateMixed(context.Background(), MixRequest{Request: Request{Prompt: "question"},
+			MixProvider: "google", ConsensusAttempts: 1})
+		require.NoError(t, err)
+		require.NotNil(t, resp.Consensus)
+		assert.Equal(t, "mixed by Google", resp.Mixed)
+	})
+
+	t.Run("single answer not mixed", func(t *testing.T) {
+		resp, err := c.GenerateMixed(context.Background(), MixRequest{Request: Request{Prompt: "question",
+			Providers: []string{"openai", "anthropic"}}})
+		require.NoError(t, err)
+		assert.Empty(t, resp.Mixed)
+		assert.Equal(t, "answer from openai", resp.Results[0].Text)
+	})
+
+	t.Run("all failed", func(t *testing.T) {
+		resp, err := c.GenerateMixed(context.Background(), MixRequest{Request: Request{Prompt: "question",
+			Providers: []string{"anthropic"}}})
+		require.Error(t, err)
+		require.Len(t, resp.Results, 1)
+		assert.Empty(t, resp.Mixed)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		_, err := c.GenerateMixed(context.Background(), MixRequest{Request: Request{Prompt: "q"}, ConsensusAttempts: 6})
+		require.EqualError(t, err, "consensus attempts must be between 0 and 5, got 6")
+		_, err = c.GenerateMixed(context.Background(), MixRequest{Request: Request{Prompt: "q"}, Style: "poem"})
+		require.EqualError(t, err, `unknown mix style "poem"`)
+	})
+}
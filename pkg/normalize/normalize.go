@@ -0,0 +1,217 @@
+// Package normalize removes boilerplate of provider answers, like "Sure! Here's the review:" preambles and
+// "Let me know if you have questions" sign-offs, and brings markdown headers of answers to the same style,
+// so answers of different providers are mixed and compared by their content.
+package normalize
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultHeaderLevel is the level of top headers of normalized answers
+const DefaultHeaderLevel = 2
+
+// maxPasses limits passes of rules over the answer, trailing boilerplate is often a few paragraphs
+const maxPasses = 3
+
+// Rule replaces matches of the regular expression in the answer
+type Rule struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+	Replace string `yaml:"replace"` // replacement with $1-style references to groups, empty to remove matches
+
+	re *regexp.Regexp
+}
+
+// Config defines rules of normalization, loaded from YAML
+type Config struct {
+	HeaderLevel *int     `yaml:"header_level"` // level of top headers, 0 keeps header levels, DefaultHeaderLevel if not set
+	Disable     []string `yaml:"disable"`      // names of built-in rules to skip
+	Rules       []Rule   `yaml:"rules"`        // rules applied after built-in ones
+}
+
+// DefaultRules are built-in rules removing preambles, sign-offs and disclaimers of answers
+var DefaultRules = []Rule{
+	{Name: "preamble", Pattern: `(?i)\A\s*(?:(?:sure|certainly|of course|absolutely|great question|good question|okay|ok)` +
+		`\b[^\n]*?[.!,][ \t]*)?here(?:'s| is| are)\b[^\n]*:[ \t]*\n+`},
+	{Name: "acknowledgement", Pattern: `(?i)\A\s*(?:sure|certainly|of course|absolutely|great question|good question)[!.]?[ \t]*\n+`},
+	{Name: "sign-off", Pattern: `(?i)\n\n[ \t]*(?:i hope (?:this|that) helps|hope (?:this|that) helps|let me know if|feel free to|` +
+		`if you have any (?:other |further |more )?questions)(?:[^\n]|\n[^\n])*\s*\z`},
+	{Name: "disclaimer", Pattern: `(?i)\n\n[ \t]*[*_]*(?:disclaimer\b|as an ai\b)(?:[^\n]|\n[^\n])*\s*\z`},
+	{Name: "blank-lines", Pattern: `\n{3,}`, Replace: "\n\n"},
+}
+
+// Normalizer applies rules and normalizes headers of answers
+type Normalizer struct {
+	rules       []Rule
+	headerLevel int
+}
+
+// New makes a normalizer of built-in rules, extended by the config
+func New(cfg Config) (*Normalizer, error) {
+	n := &Normalizer{headerLevel: DefaultHeaderLevel}
+	if cfg.HeaderLevel != nil {
+		if *cfg.HeaderLevel < 0 || *cfg.HeaderLevel > 6 {
+			return nil, fmt.Errorf("header level must be between 0 and 6, got %d", *cfg.HeaderLevel)
+		}
+		n.headerLevel = *cfg.HeaderLevel
+	}
+
+	for _, name := range cfg.Disable {
+		if !slices.ContainsFunc(DefaultRules, func(r Rule) bool { return r.Name == name }) {
+			return nil, fmt.Errorf("unknown built-in rule %q", name)
+		}
+	}
+	for _, r := range DefaultRules {
+		if !slices.Contains(cfg.Disable, r.Name) {
+			n.rules = append(n.rules, r)
+		}
+	}
+	n.rules = append(n.rules, cfg.Rules...)
+
+	for i, r := range n.rules {
+		if r.Pattern == "" {
+			return nil, fmt.Errorf("rule %q has no pattern", r.Name)
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of rule %q: %w", r.Name, err)
+		}
+		n.rules[i].re = re
+	}
+	return n, nil
+}
+
+// Load makes a normalizer with the config from the YAML file, or of built-in rules only if the path is empty
+func Load(path string) (*Normalizer, error) {
+	if path == "" {
+		return New(Config{})
+	}
+	data, err := os.ReadFile(path) //nolint:gosec // rules file is set by the user
+	if err != nil {
+		return nil, fmt.Errorf("failed to read normalize rules: %w", err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid normalize rules %s: %w", path, err)
+	}
+	n, err := New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid normalize rules %s: %w", path, err)
+	}
+	return n, nil
+}
+
+// Apply returns the normalized answer. Rules are applied to the whole answer, while headers are
+// normalized outside of code blocks only. The answer is returned as is if nothing is left of it.
+func (n *Normalizer) Apply(answer string) string {
+	text := strings.ReplaceAll(answer, "\r\n", "\n")
+	for range maxPasses {
+		prev := text
+		for _, r := range n.rules {
+			text = r.re.ReplaceAllString(text, r.Replace)
+		}
+		if text == prev {
+			break
+		}
+	}
+	if n.headerLevel > 0 {
+		text = normalizeHeaders(text, n.headerLevel)
+	}
+	if strings.TrimSpace(text) == "" {
+		return answer
+	}
+	return strings.TrimSpace(text)
+}
+
+var (
+	atxHeaderRe    = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+	setextMarkerRe = regexp.MustCompile(`^(=+|-+)[ \t]*$`)
+	fenceRe        = regexp.MustCompile("^[ \t]*(```|~~~)")
+)
+
+// header is a markdown header found in the answer
+type header struct {
+	line   int // index of the header line, setext underline is the next line
+	level  int
+	text   string
+	setext bool
+}
+
+// normalizeHeaders converts setext headers to ATX style without closing hashes, and shifts levels of headers
+// so the top header has the given level, deeper levels are capped at 6
+func normalizeHeaders(text string, top int) string {
+	lines := strings.Split(text, "\n")
+	var headers []header
+	inFence := ""
+	for i := 0; i < len(lines); i++ {
+		if m := fenceRe.FindStringSubmatch(lines[i]); m != nil {
+			switch inFence {
+			case "":
+				inFence = m[1]
+			case m[1]:
+				inFence = ""
+			}
+			continue
+		}
+		if inFence != "" {
+			continue
+		}
+		if m := atxHeaderRe.FindStringSubmatch(lines[i]); m != nil {
+			headers = append(headers, header{line: i, level: len(m[1]), text: m[2]})
+			continue
+		}
+		// setext underline follows a paragraph line, a dashed line after a blank line is a thematic break
+		if i+1 < len(lines) && strings.TrimSpace(lines[i]) != "" && !isBlockStart(lines[i]) {
+			if m := setextMarkerRe.FindStringSubmatch(lines[i+1]); m != nil {
+				level := 1
+				if m[1][0] == '-' {
+					level = 2
+				}
+				headers = append(headers, header{line: i, level: level, text: strings.TrimSpace(lines[i]), setext: true})
+				i++
+			}
+		}
+	}
+	if len(headers) == 0 {
+		return text
+	}
+
+	minLevel := 6
+	for _, h := range headers {
+		minLevel = min(minLevel, h.level)
+	}
+	drop := map[int]bool{}
+	for _, h := range headers {
+		level := min(h.level-minLevel+top, 6)
+		lines[h.line] = strings.Repeat("#", level) + " " + h.text
+		if h.setext {
+			drop[h.line+1] = true
+		}
+	}
+	res := make([]string, 0, len(lines))
+	for i, l := range lines {
+		if !drop[i] {
+			res = append(res, l)
+		}
+	}
+	return strings.Join(res, "\n")
+}
+
+// isBlockStart checks if the line starts a list item, quote or table row, which can't be setext headers
+func isBlockStart(line string) bool {
+	l := strings.TrimSpace(line)
+	switch {
+	case l == "":
+		return false
+	case strings.HasPrefix(l, "- "), strings.HasPrefix(l, "* "), strings.HasPrefix(l, "+ "),
+		strings.HasPrefix(l, ">"), strings.HasPrefix(l, "|"):
+		return true
+	}
+	return false
+}
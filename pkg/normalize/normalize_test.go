@@ -0,0 +1,89 @@
+package normalize
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizer_Apply(t *testing.T) {
+	n, err := New(Config{})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		answer string
+		want   string
+	}{
+		{name: "plain answer", answer: "The bug is in line 10.", want: "The bug is in line 10."},
+		{name: "preamble", answer: "Sure! Here's the review of the code:\n\nThe bug is in line 10.", want: "The bug is in line 10."},
+		{name: "preamble without acknowledgement", answer: "Here is the refactored function:\n```go\nfunc f() {}\n```",
+			want: "```go\nfunc f() {}\n```"},
+		{name: "acknowledgement", answer: "Certainly!\n\nThe bug is in line 10.", want: "The bug is in line 10."},
+		{name: "acknowledgement with content kept", answer: "Sure, the bug is in line 10.", want: "Sure, the bug is in line 10."},
+		{name: "sign-off and disclaimer", answer: "The bug is in line 10.\n\nLet me know if you need more details!\n\n" +
+			"**Disclaimer:** review the changes\nbefore merging.", want: "The bug is in line 10."},
+		{name: "sign-off in the middle kept", answer: "Feel free to ask.\n\nThe bug is in line 10.",
+			want: "Feel free to ask.\n\nThe bug is in line 10."},
+		{name: "blank lines", answer: "first\n\n\n\nsecond", want: "first\n\nsecond"},
+		{name: "headers shifted", answer: "### Summary\n\ntext\n\n#### Details ####\n\nmore",
+			want: "## Summary\n\ntext\n\n### Details\n\nmore"},
+		{name: "setext headers", answer: "Summary\n=======\n\ntext\n\nDetails\n-------\n\nmore\n\n---\n\nend",
+			want: "## Summary\n\ntext\n\n### Details\n\nmore\n\n---\n\nend"},
+		{name: "headers in code kept", answer: "# Title\n\n```sh\n# comment\necho\n```\n\n~~~\n## not header\n~~~",
+			want: "## Title\n\n```sh\n# comment\necho\n```\n\n~~~\n## not header\n~~~"},
+		{name: "list item not setext", answer: "- item\n---\ntext", want: "- item\n---\ntext"},
+		{name: "deep levels capped", answer: "# a\n###### b", want: "## a\n###### b"},
+		{name: "only boilerplate kept", answer: "Here is the answer:\n", want: "Here is the answer:\n"},
+		{name: "crlf", answer: "Sure!\r\n\r\nline one\r\nline two", want: "line one\nline two"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, n.Apply(tt.answer))
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	level := 0
+	n, err := New(Config{HeaderLevel: &level, Disable: []string{"sign-off"},
+		Rules: []Rule{{Name: "ticket", Pattern: `JIRA-(\d+)`, Replace: "#$1"}}})
+	require.NoError(t, err)
+	assert.Equal(t, "### Fix #12\n\nLet me know if it works.", n.Apply("### Fix JIRA-12\n\nLet me know if it works."))
+
+	bad := 7
+	_, err = New(Config{HeaderLevel: &bad})
+	require.EqualError(t, err, "header level must be between 0 and 6, got 7")
+	_, err = New(Config{Disable: []string{"greeting"}})
+	require.EqualError(t, err, `unknown built-in rule "greeting"`)
+	_, err = New(Config{Rules: []Rule{{Name: "empty"}}})
+	require.EqualError(t, err, `rule "empty" has no pattern`)
+	_, err = New(Config{Rules: []Rule{{Name: "broken", Pattern: "("}}})
+	require.ErrorContains(t, err, `invalid pattern of rule "broken"`)
+}
+
+func TestLoad(t *testing.T) {
+	n, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, "## Title", n.Apply("# Title"))
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.yml")
+	require.NoError(t, os.WriteFile(path, []byte("header_level: 1\ndisable: [preamble]\nrules:\n"+
+		"  - name: thanks\n    pattern: '(?i)\\n+thanks!\\s*\\z'\n"), 0o600))
+	n, err = Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Here is the fix:\n\n# Fix", n.Apply("Here is the fix:\n\n## Fix\n\nThanks!"))
+
+	require.NoError(t, os.WriteFile(path, []byte("rules: [{name: broken, pattern: '('}]"), 0o600))
+	_, err = Load(path)
+	require.ErrorContains(t, err, "invalid normalize rules "+path)
+	require.NoError(t, os.WriteFile(path, []byte("rules: {"), 0o600))
+	_, err = Load(path)
+	require.ErrorContains(t, err, "invalid normalize rules "+path)
+	_, err = Load(filepath.Join(dir, "missing.yml"))
+	require.ErrorContains(t, err, "failed to read normalize rules")
+}
@@ -0,0 +1,46 @@
+// Package notify sends native desktop notifications using the notification tool of the platform:
+// osascript on macOS, notify-send on Linux and other unix systems, and PowerShell toast on Windows.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// windowsScript shows a toast notification with title and message passed in environment variables
+const windowsScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+$tpl = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$txt = $tpl.GetElementsByTagName('text')
+$txt.Item(0).AppendChild($tpl.CreateTextNode($env:MPT_NOTIFY_TITLE)) | Out-Null
+$txt.Item(1).AppendChild($tpl.CreateTextNode($env:MPT_NOTIFY_MESSAGE)) | Out-Null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('MPT').Show([Windows.UI.Notifications.ToastNotification]::new($tpl))`
+
+// Send shows a desktop notification with the given title and message
+func Send(ctx context.Context, title, message string) error {
+	cmd := command(ctx, runtime.GOOS, title, message)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to send notification with %s: %w, %s", cmd.Path, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// command makes the notification command for the given OS. Title and message are passed as separate
+// arguments or environment variables, never interpolated into scripts, so they don't need escaping.
+func command(ctx context.Context, goos, title, message string) *exec.Cmd {
+	switch goos {
+	case "darwin":
+		return exec.CommandContext(ctx, "osascript",
+			"-e", "on run argv", "-e", "display notification (item 2 of argv) with title (item 1 of argv)", "-e", "end run",
+			title, message)
+	case "windows":
+		cmd := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", windowsScript)
+		cmd.Env = append(os.Environ(), "MPT_NOTIFY_TITLE="+title, "MPT_NOTIFY_MESSAGE="+message)
+		return cmd
+	default:
+		return exec.CommandContext(ctx, "notify-send", "--app-name=mpt", title, message)
+	}
+}
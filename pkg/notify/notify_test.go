@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommand(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("darwin", func(t *testing.T) {
+		cmd := command(ctx, "darwin", "MPT", `done "quoted"`)
+		assert.Equal(t, "osascript", filepath.Base(cmd.Args[0]))
+		assert.Equal(t, []string{"MPT", `done "quoted"`}, cmd.Args[len(cmd.Args)-2:], "title and message passed as arguments")
+	})
+
+	t.Run("linux", func(t *testing.T) {
+		cmd := command(ctx, "linux", "MPT", "done")
+		assert.Equal(t, []string{"notify-send", "--app-name=mpt", "MPT", "done"}, cmd.Args)
+	})
+
+	t.Run("windows", func(t *testing.T) {
+		cmd := command(ctx, "windows", "MPT", "done; $(rm -rf)")
+		assert.Equal(t, "powershell", cmd.Args[0])
+		assert.Equal(t, windowsScript, cmd.Args[len(cmd.Args)-1])
+		assert.Contains(t, cmd.Env, "MPT_NOTIFY_TITLE=MPT")
+		assert.Contains(t, cmd.Env, "MPT_NOTIFY_MESSAGE=done; $(rm -rf)")
+	})
+}
+
+func TestSend(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("uses fake notify-send")
+	}
+
+	// put fake notify-send recording its arguments first in PATH
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$@\" > " + outFile + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notify-send"), []byte(script), 0o700)) //nolint:gosec // test script
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	require.NoError(t, Send(context.Background(), "MPT", "completed in 5s"))
+	data, err := os.ReadFile(outFile) //nolint:gosec // test file
+	require.NoError(t, err)
+	assert.Equal(t, "--app-name=mpt MPT completed in 5s\n", string(data))
+
+	t.Run("failed", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "notify-send"), []byte("#!/bin/sh\necho no display\nexit 1\n"), 0o700)) //nolint:gosec // test script
+		err := Send(context.Background(), "MPT", "done")
+		require.ErrorContains(t, err, "exit status 1, no display")
+	})
+}
@@ -0,0 +1,196 @@
+// Package pricing implements the table of model prices per million input and output tokens. The table bundled
+// with mpt can be replaced with a fresh one fetched from a published JSON, kept in a file; the bundled table
+// is used if the file is missing, so prices are available offline.
+package pricing
+
+import (
+	"bytes"
+	"context"
+	_ "embed" // bundled pricing table
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultURL is the published JSON of model prices maintained by the LiteLLM project
+const DefaultURL = "https://raw.githubusercontent.com/BerriAI/litellm/main/model_prices_and_context_window.json"
+
+// maxTableSize limits the size of the fetched pricing JSON
+const maxTableSize = 16 << 20
+
+// bundled is the pricing table generated from the published JSON of DefaultURL, like "pricing update" does
+//
+//go:generate go run ../../cmd/mpt pricing update --file=pricing.json
+//go:embed pricing.json
+var bundled []byte
+
+// Price is the price of a model in USD per million tokens
+type Price struct {
+	Provider string  `json:"provider"` // provider type of the model, like openai or anthropic
+	Input    float64 `json:"input"`    // price of million prompt tokens
+	Output   float64 `json:"output"`   // price of million generated tokens
+}
+
+// Table is a pricing table of models
+type Table struct {
+	Updated string           `json:"updated"` // date the prices were collected or fetched, like 2025-10-01
+	Source  string           `json:"source"`  // "bundled" or the URL the table was fetched from
+	Models  map[string]Price `json:"models"`  // prices by model name
+}
+
+// providers are providers of the published JSON by provider types of mpt, other providers are skipped
+var providers = map[string]string{"openai": "openai", "anthropic": "anthropic", "gemini": "google", "deepseek": "deepseek"}
+
+// Bundled returns the pricing table bundled with mpt, with the source reported as "bundled"
+func Bundled() Table {
+	var res Table
+	if err := json.Unmarshal(bundled, &res); err != nil {
+		panic(fmt.Sprintf("invalid bundled pricing table: %v", err)) // checked by tests
+	}
+	res.Source = "bundled"
+	return res
+}
+
+// Load returns the pricing table saved in the file, or the bundled table if the file doesn't exist
+func Load(path string) (Table, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // pricing file set by the user
+	if errors.Is(err, os.ErrNotExist) {
+		return Bundled(), nil
+	}
+	if err != nil {
+		return Table{}, fmt.Errorf("failed to read pricing table: %w", err)
+	}
+	var res Table
+	if err := json.Unmarshal(data, &res); err != nil {
+		return Table{}, fmt.Errorf("failed to parse pricing table %s: %w", path, err)
+	}
+	return res, nil
+}
+
+// Save writes the pricing table to the file, replacing it atomically
+func Save(path string, t Table) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode pricing table: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("failed to create pricing directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write pricing table: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write pricing table: %w", err)
+	}
+	return nil
+}
+
+// Fetch downloads the pricing table from the URL. The JSON is either a table in the format of Save, or the
+// model prices JSON of LiteLLM, with prices per token of chat models of supported providers.
+func Fetch(ctx context.Context, client *http.Client, url string) (Table, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return Table{}, fmt.Errorf("failed to make pricing request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Table{}, fmt.Errorf("failed to fetch pricing table: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Table{}, fmt.Errorf("failed to fetch pricing table from %s: status %d", url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTableSize))
+	if err != nil {
+		return Table{}, fmt.Errorf("failed to fetch pricing table: %w", err)
+	}
+
+	res, err := parse(data)
+	if err != nil {
+		return Table{}, fmt.Errorf("failed to parse pricing table from %s: %w", url, err)
+	}
+	if len(res.Models) == 0 {
+		return Table{}, fmt.Errorf("no prices of supported models in pricing table from %s", url)
+	}
+	res.Source, res.Updated = url, time.Now().Format(time.DateOnly)
+	return res, nil
+}
+
+// parse parses the pricing table in the format of Save or LiteLLM model prices
+func parse(data []byte) (Table, error) {
+	var res Table
+	if err := json.Unmarshal(data, &res); err == nil && len(res.Models) > 0 {
+		return res, nil
+	}
+
+	var models map[string]json.RawMessage
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&models); err != nil {
+		return Table{}, err
+	}
+	res = Table{Models: map[string]Price{}}
+	for name, raw := range models {
+		var m struct {
+			Provider string   `json:"litellm_provider"`
+			Mode     string   `json:"mode"`
+			Input    *float64 `json:"input_cost_per_token"`
+			Output   *float64 `json:"output_cost_per_token"`
+		}
+		if err := json.Unmarshal(raw, &m); err != nil {
+			continue // entries like sample_spec are not models
+		}
+		provider, ok := providers[m.Provider]
+		if !ok || m.Mode != "chat" || m.Input == nil || m.Output == nil {
+			continue
+		}
+		name = strings.TrimPrefix(name, m.Provider+"/")
+		res.Models[name] = Price{Provider: provider, Input: perMillion(*m.Input), Output: perMillion(*m.Output)}
+	}
+	return res, nil
+}
+
+// perMillion converts the price per token to the price per million tokens, rounded to drop float errors
+func perMillion(v float64) float64 {
+	return math.Round(v*1e12) / 1e6
+}
+
+// Price returns the price of the model, matched case-insensitively, with the vendor prefix of OpenAI-compatible
+// gateways, like openai/gpt-5, removed if the model is not found with it
+func (t Table) Price(model string) (Price, bool) {
+	model = strings.ToLower(model)
+	for _, name := range []string{model, model[strings.LastIndex(model, "/")+1:]} {
+		if p, ok := t.Models[name]; ok {
+			return p, true
+		}
+	}
+	return Price{}, false
+}
+
+// Cost returns the cost in USD of the prompt and generated tokens
+func (p Price) Cost(input, output int) float64 {
+	return (float64(input)*p.Input + float64(output)*p.Output) / 1e6
+}
+
+// Names returns names of models of the table sorted by provider and name
+func (t Table) Names() []string {
+	res := make([]string, 0, len(t.Models))
+	for name := range t.Models {
+		res = append(res, name)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		pi, pj := t.Models[res[i]].Provider, t.Models[res[j]].Provider
+		if pi != pj {
+			return pi < pj
+		}
+		return res[i] < res[j]
+	})
+	return res
+}
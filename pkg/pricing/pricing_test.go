@@ -0,0 +1,112 @@
+package pricing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundled(t *testing.T) {
+	table := Bundled()
+	assert.Equal(t, "bundled", table.Source)
+	for _, model := range []string{"gpt-5", "claude-sonnet-4-5", "gemini-2.5-pro-preview-06-05", "deepseek-chat"} {
+		p, ok := table.Price(model)
+		require.True(t, ok, "default model %s priced", model)
+		assert.Positive(t, p.Input, model)
+		assert.Greater(t, p.Output, p.Input, model)
+	}
+}
+
+func TestTable_Price(t *testing.T) {
+	table := Table{Models: map[string]Price{"gpt-5": {Provider: "openai", Input: 1.25, Output: 10}}}
+	for _, model := range []string{"gpt-5", "GPT-5", "openai/gpt-5"} {
+		p, ok := table.Price(model)
+		assert.True(t, ok, model)
+		assert.InDelta(t, 10, p.Output, 1e-9, model)
+	}
+	_, ok := table.Price("gpt-6")
+	assert.False(t, ok)
+}
+
+func TestPrice_Cost(t *testing.T) {
+	p := Price{Provider: "openai", Input: 1.25, Output: 10}
+	assert.InDelta(t, 0.00325, p.Cost(1000, 200), 1e-12)
+	assert.Zero(t, p.Cost(0, 0))
+}
+
+func TestTable_Names(t *testing.T) {
+	table := Table{Models: map[string]Price{"o3": {Provider: "openai"}, "gpt-5": {Provider: "openai"},
+		"claude-opus-4-1": {Provider: "anthropic"}}}
+	assert.Equal(t, []string{"claude-opus-4-1", "gpt-5", "o3"}, table.Names())
+}
+
+func TestLoadSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "pricing.json")
+	table, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, Bundled(), table, "bundled table without the file")
+
+	saved := Table{Updated: "2025-11-01", Source: "https://example.com/prices.json",
+		Models: map[string]Price{"gpt-5": {Provider: "openai", Input: 1, Output: 8}}}
+	require.NoError(t, Save(path, saved))
+	table, err = Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, saved, table)
+	_, err = os.Stat(path + ".tmp")
+	assert.True(t, os.IsNotExist(err), "temporary file renamed")
+
+	require.NoError(t, os.WriteFile(path, []byte("{bad"), 0o600))
+	_, err = Load(path)
+	require.ErrorContains(t, err, "failed to parse pricing table")
+}
+
+func TestFetch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/litellm.json":
+			_, _ = w.Write([]byte(`{
+				"sample_spec": {"max_tokens": "set to max tokens of the model", "mode": "one of chat, embedding"},
+				"gpt-5": {"litellm_provider": "openai", "mode": "chat", "input_cost_per_token": 1.25e-06, "output_cost_per_token": 1e-05},
+				"text-embedding-3-small": {"litellm_provider": "openai", "mode": "embedding", "input_cost_per_token": 2e-08, "output_cost_per_token": 0},
+				"gemini/gemini-2.5-pro": {"litellm_provider": "gemini", "mode": "chat", "input_cost_per_token": 1.25e-06, "output_cost_per_token": 1e-05},
+				"mistral/mistral-large": {"litellm_provider": "mistral", "mode": "chat", "input_cost_per_token": 2e-06, "output_cost_per_token": 6e-06},
+				"claude-haiku-4-5": {"litellm_provider": "anthropic", "mode": "chat", "input_cost_per_token": 1e-06}
+			}`))
+		case "/table.json":
+			_, _ = w.Write([]byte(`{"updated": "2025-11-01", "models": {"gpt-5": {"provider": "openai", "input": 1, "output": 8}}}`))
+		case "/empty.json":
+			_, _ = w.Write([]byte(`{"mistral/mistral-large": {"litellm_provider": "mistral", "mode": "chat"}}`))
+		case "/bad.json":
+			_, _ = w.Write([]byte(`not json`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	table, err := Fetch(context.Background(), ts.Client(), ts.URL+"/litellm.json")
+	require.NoError(t, err)
+	assert.Equal(t, ts.URL+"/litellm.json", table.Source)
+	assert.NotEmpty(t, table.Updated)
+	assert.Equal(t, []string{"gemini-2.5-pro", "gpt-5"}, table.Names(), "chat models of supported providers only")
+	assert.Equal(t, "google", table.Models["gemini-2.5-pro"].Provider)
+	assert.Equal(t, Price{Provider: "openai", Input: 1.25, Output: 10}, table.Models["gpt-5"])
+
+	table, err = Fetch(context.Background(), ts.Client(), ts.URL+"/table.json")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Price{"gpt-5": {Provider: "openai", Input: 1, Output: 8}}, table.Models)
+	assert.Equal(t, ts.URL+"/table.json", table.Source)
+
+	_, err = Fetch(context.Background(), ts.Client(), ts.URL+"/empty.json")
+	require.ErrorContains(t, err, "no prices of supported models")
+	_, err = Fetch(context.Background(), ts.Client(), ts.URL+"/bad.json")
+	require.ErrorContains(t, err, "failed to parse pricing table")
+	_, err = Fetch(context.Background(), ts.Client(), ts.URL+"/missing.json")
+	require.ErrorContains(t, err, "status 404")
+}
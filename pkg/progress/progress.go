@@ -0,0 +1,221 @@
+// Package progress implements a terminal display of provider requests progress. It shows a line per provider
+// with a spinner, elapsed time and state, and redraws all lines in place periodically.
+package progress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+// DefaultInterval is the default redraw interval of the display
+const DefaultInterval = 100 * time.Millisecond
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// state defines the state of a provider request
+type state string
+
+const (
+	stateWaiting   state = "waiting"   // request is sent, provider hasn't responded yet
+	stateStreaming state = "streaming" // provider response is arriving
+	stateDone      state = "done"      // provider responded successfully
+	stateFailed    state = "failed"    // provider request failed
+	stateCanceled  state = "canceled"  // provider request was canceled, e.g. after the first response in first mode
+)
+
+// Display shows progress of provider requests, it implements runner.Hooks to get updates
+type Display struct {
+	out      io.Writer
+	interval time.Duration
+
+	mu     sync.Mutex
+	items  []*item // in order of providers
+	frame  int     // current spinner frame
+	lines  int     // number of lines drawn by the last render, used to redraw in place
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// item is a progress state of a single provider
+type item struct {
+	name     string
+	state    state
+	started  time.Time
+	elapsed  time.Duration // final elapsed time, set once the request is completed
+	received int64         // bytes of the response received so far, in streaming state
+	model    string        // model reported by the provider, set once the request is completed
+}
+
+// New creates a display for the given providers, writing to out
+func New(out io.Writer, providers []string) *Display {
+	res := &Display{out: out, interval: DefaultInterval}
+	for _, name := range providers {
+		res.items = append(res.items, &item{name: name, state: stateWaiting})
+	}
+	return res
+}
+
+// WithInterval sets the redraw interval
+func (d *Display) WithInterval(interval time.Duration) *Display {
+	d.interval = interval
+	return d
+}
+
+// OnStart marks the provider request as started, safe for concurrent use
+func (d *Display) OnStart(providerName string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	it := d.lookup(providerName)
+	it.state, it.started, it.elapsed, it.received, it.model = stateWaiting, time.Now(), 0, 0, ""
+}
+
+// OnProgress marks the provider request as streaming with the number of received bytes, safe for concurrent use
+func (d *Display) OnProgress(providerName string, received int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	it := d.lookup(providerName)
+	if it.state == stateWaiting || it.state == stateStreaming {
+		it.state, it.received = stateStreaming, received
+	}
+}
+
+// OnProviderDone sets the final state of the provider request, safe for concurrent use
+func (d *Display) OnProviderDone(result provider.Result) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	it := d.lookup(result.Provider)
+	it.elapsed, it.model = result.Latency, result.Model
+	switch {
+	case result.Error == nil:
+		it.state = stateDone
+	case errors.Is(result.Error, context.Canceled):
+		it.state = stateCanceled
+	default:
+		it.state = stateFailed
+	}
+}
+
+// OnAllDone does nothing, the display is stopped by the caller with Stop
+func (d *Display) OnAllDone([]provider.Result, error) {}
+
+// Start starts periodic redraw of the display in background
+func (d *Display) Start() {
+	d.stopCh, d.doneCh = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(d.doneCh)
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		d.render()
+		for {
+			select {
+			case <-d.stopCh:
+				return
+			case <-ticker.C:
+				d.render()
+			}
+		}
+	}()
+}
+
+// Stop stops periodic redraw and draws the final state of all providers.
+// Requests still in progress, e.g. abandoned after the first response, are shown as canceled.
+func (d *Display) Stop() {
+	if d.stopCh == nil {
+		return
+	}
+	close(d.stopCh)
+	<-d.doneCh
+	d.stopCh = nil
+
+	d.mu.Lock()
+	for _, it := range d.items {
+		if it.inProgress() {
+			it.state, it.elapsed = stateCanceled, time.Since(it.started)
+		}
+	}
+	d.mu.Unlock()
+	d.render()
+}
+
+// render draws lines of all providers, replacing lines drawn by the previous render
+func (d *Display) render() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	width := 0
+	for _, it := range d.items {
+		width = max(width, len(it.name))
+	}
+
+	var sb strings.Builder
+	if d.lines > 0 {
+		fmt.Fprintf(&sb, "\033[%dA", d.lines) // move cursor up to the first line of the previous render
+	}
+	for _, it := range d.items {
+		elapsed := it.elapsed
+		if it.inProgress() {
+			elapsed = time.Since(it.started)
+		}
+		status := string(it.state)
+		if it.state == stateStreaming {
+			status += " " + formatBytes(it.received)
+		}
+		if it.state == stateDone && it.model != "" {
+			status += " (" + it.model + ")"
+		}
+		fmt.Fprintf(&sb, "\033[2K%s %-*s %6.1fs %s\n", d.symbol(it.state), width, it.name, elapsed.Seconds(), status)
+	}
+	d.frame++
+	d.lines = len(d.items)
+	_, _ = io.WriteString(d.out, sb.String())
+}
+
+// symbol returns the spinner frame for requests in progress and a status mark for completed ones
+func (d *Display) symbol(st state) string {
+	switch st {
+	case stateDone:
+		return "✓"
+	case stateFailed:
+		return "✗"
+	case stateCanceled:
+		return "-"
+	default:
+		return spinnerFrames[d.frame%len(spinnerFrames)]
+	}
+}
+
+// inProgress checks if the request is started and not completed yet
+func (it *item) inProgress() bool {
+	return (it.state == stateWaiting || it.state == stateStreaming) && !it.started.IsZero()
+}
+
+// formatBytes formats the number of bytes with KB or MB units
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.1fKB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
+
+// lookup returns the item of the named provider, adding it if not found
+func (d *Display) lookup(name string) *item {
+	for _, it := range d.items {
+		if it.name == name {
+			return it
+		}
+	}
+	it := &item{name: name, state: stateWaiting}
+	d.items = append(d.items, it)
+	return it
+}
@@ -0,0 +1,139 @@
+package progress
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider"
+	"github.com/umputun/mpt/pkg/runner"
+	"github.com/umputun/mpt/pkg/runner/mocks"
+)
+
+func TestDisplay_Render(t *testing.T) {
+	var buf bytes.Buffer
+	d := New(&buf, []string{"OpenAI", "Anthropic", "Google"})
+
+	d.OnStart("OpenAI")
+	d.OnStart("Anthropic")
+	d.OnProviderDone(provider.Result{Provider: "Anthropic", Latency: 1500 * time.Millisecond})
+	d.OnProviderDone(provider.Result{Provider: "Google", Latency: 300 * time.Millisecond, Error: errors.New("rate limit")})
+	d.render()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "\033[2K⠋ OpenAI       0.0s waiting", lines[0])
+	assert.Equal(t, "\033[2K✓ Anthropic    1.5s done", lines[1])
+	assert.Equal(t, "\033[2K✗ Google       0.3s failed", lines[2])
+
+	buf.Reset()
+	d.render()
+	assert.True(t, strings.HasPrefix(buf.String(), "\033[3A\033[2K⠙ OpenAI"), "redraws in place with the next frame")
+}
+
+func TestDisplay_Streaming(t *testing.T) {
+	var buf bytes.Buffer
+	d := New(&buf, []string{"OpenAI", "Google"})
+	d.OnStart("OpenAI")
+	d.OnStart("Google")
+	d.OnProgress("OpenAI", 0)
+	d.OnProgress("Google", 12600)
+	d.render()
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "\033[2K⠋ OpenAI    0.0s streaming 0B", lines[0])
+	assert.Equal(t, "\033[2K⠋ Google    0.0s streaming 12.3KB", lines[1])
+
+	d.OnProviderDone(provider.Result{Provider: "OpenAI", Latency: time.Second, Model: "gpt-4o-2024-08-06"})
+	d.OnProgress("OpenAI", 100) // late progress doesn't override the final state
+	buf.Reset()
+	d.render()
+	assert.Contains(t, buf.String(), "✓ OpenAI    1.0s done (gpt-4o-2024-08-06)")
+
+	d.Start()
+	d.Stop()
+	assert.Contains(t, buf.String(), "- Google", "streaming request is canceled on stop")
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512B", formatBytes(512))
+	assert.Equal(t, "1.5KB", formatBytes(1536))
+	assert.Equal(t, "2.0MB", formatBytes(2*1024*1024))
+}
+
+func TestDisplay_UnknownProvider(t *testing.T) {
+	var buf bytes.Buffer
+	d := New(&buf, []string{"OpenAI"})
+	d.OnProviderDone(provider.Result{Provider: "Custom", Latency: time.Second})
+	d.render()
+	assert.Contains(t, buf.String(), "✓ Custom    1.0s done")
+}
+
+func TestDisplay_Canceled(t *testing.T) {
+	var buf bytes.Buffer
+	d := New(&buf, []string{"OpenAI"})
+	d.OnStart("OpenAI")
+	d.OnProviderDone(provider.Result{Provider: "OpenAI", Latency: time.Second,
+		Error: fmt.Errorf("request failed: %w", context.Canceled)})
+	d.render()
+	assert.Contains(t, buf.String(), "- OpenAI    1.0s canceled")
+}
+
+func TestDisplay_WithRunner(t *testing.T) {
+	var buf bytes.Buffer
+	p := &mocks.ProviderMock{
+		NameFunc:     func() string { return "OpenAI" },
+		EnabledFunc:  func() bool { return true },
+		GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return "answer", nil },
+	}
+	d := New(&buf, []string{"OpenAI"})
+	_, err := runner.New(p).WithHooks(d).Run(context.Background(), "prompt")
+	require.NoError(t, err)
+	d.render()
+	assert.Contains(t, buf.String(), "✓ OpenAI")
+}
+
+func TestDisplay_StartStop(t *testing.T) {
+	var buf syncBuffer
+	d := New(&buf, []string{"OpenAI", "Google"}).WithInterval(10 * time.Millisecond)
+	d.Start()
+	d.OnStart("OpenAI")
+	d.OnStart("Google")
+	time.Sleep(50 * time.Millisecond)
+	d.OnProviderDone(provider.Result{Provider: "OpenAI", Latency: 40 * time.Millisecond})
+	d.Stop()
+	d.Stop() // second stop is a no-op
+
+	out := buf.String()
+	assert.Greater(t, strings.Count(out, "OpenAI"), 2, "redrawn periodically")
+	last := out[strings.LastIndex(out, "\033[2A"):]
+	assert.Contains(t, last, "✓ OpenAI")
+	assert.Contains(t, last, "- Google", "request in progress shown as canceled")
+	assert.Contains(t, last, "canceled")
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
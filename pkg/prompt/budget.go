@@ -0,0 +1,153 @@
+package prompt
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/umputun/mpt/pkg/files"
+	"github.com/umputun/mpt/pkg/tokens"
+)
+
+// Budget limits estimated tokens of context sources. Sources are trimmed to their budgets only if the whole
+// prompt is larger than the limit, and a zero budget doesn't limit the source.
+type Budget struct {
+	Limit int // max tokens of the prompt
+	Files int // max tokens of file contents
+	Git   int // max tokens of git diff, blame and log
+	Input int // max tokens of piped input
+}
+
+// context sources of the budget
+const (
+	SourceFiles = "files"
+	SourceGit   = "git"
+	SourceInput = "stdin"
+)
+
+// truncatedMark ends the content truncated to fit the budget
+const truncatedMark = "... [truncated to fit the context budget]"
+
+// active checks if the budget limits any source
+func (b Budget) active() bool {
+	return b.Limit > 0 && (b.Files > 0 || b.Git > 0 || b.Input > 0)
+}
+
+// Trim describes a context source trimmed to fit its budget
+type Trim struct {
+	Source    string   // SourceFiles, SourceGit or SourceInput
+	Tokens    int      // estimated tokens of the source before trimming
+	Kept      int      // estimated tokens of the source after trimming
+	Truncated []string // names of files truncated, the last kept ones
+	Dropped   []string // names of files dropped completely
+}
+
+// String returns the trim as "files 80000 -> 60000 tokens (truncated c.go, dropped d.go, e.go)"
+func (t Trim) String() string {
+	var details []string
+	if len(t.Truncated) > 0 {
+		details = append(details, "truncated "+strings.Join(t.Truncated, ", "))
+	}
+	if len(t.Dropped) > 0 {
+		details = append(details, "dropped "+strings.Join(t.Dropped, ", "))
+	}
+	res := fmt.Sprintf("%s %d -> %d tokens", t.Source, t.Tokens, t.Kept)
+	if len(details) > 0 {
+		res += " (" + strings.Join(details, ", ") + ")"
+	}
+	return res
+}
+
+// fit trims sources of the parts to their budgets if the estimated prompt is larger than the limit.
+// Files are kept in order, so the last files are truncated and dropped first, and input is truncated at the end.
+func (p *Parts) fit(budget Budget) []Trim {
+	if !budget.active() {
+		return nil
+	}
+	total := tokens.Estimate(p.Text) + tokens.Estimate(p.Input) + tokens.Estimate(p.Env) + estimateFiles(p.Files) +
+		estimateFiles(p.Git)
+	if total <= budget.Limit {
+		return nil
+	}
+
+	var res []Trim
+	var trim *Trim
+	if p.Files, trim = fitFiles(SourceFiles, p.Files, budget.Files); trim != nil {
+		res = append(res, *trim)
+	}
+	if p.Git, trim = fitFiles(SourceGit, p.Git, budget.Git); trim != nil {
+		res = append(res, *trim)
+	}
+	if n := tokens.Estimate(p.Input); budget.Input > 0 && n > budget.Input {
+		text, kept, _ := truncateTokens(p.Input, budget.Input)
+		p.Input = strings.TrimLeft(text+"\n"+truncatedMark, "\n")
+		res = append(res, Trim{Source: SourceInput, Tokens: n, Kept: kept})
+	}
+	return res
+}
+
+// fitFiles keeps files in order while they fit the budget, truncates the file crossing it and drops the rest.
+// Returns nil trim if the files fit the budget or the budget is zero.
+func fitFiles(source string, list []files.File, budget int) ([]files.File, *Trim) {
+	total := estimateFiles(list)
+	if budget <= 0 || total <= budget {
+		return list, nil
+	}
+
+	trim := &Trim{Source: source, Tokens: total}
+	res := make([]files.File, 0, len(list))
+	for _, f := range list {
+		name := f.Name
+		if source == SourceGit {
+			name = filepath.Base(f.Path) // git context is kept in temporary files
+		}
+		n := tokens.Estimate(f.Content)
+		if trim.Kept+n <= budget {
+			res = append(res, f)
+			trim.Kept += n
+			continue
+		}
+		text, kept, lines := truncateTokens(f.Content, budget-trim.Kept)
+		if lines == 0 {
+			trim.Dropped = append(trim.Dropped, name)
+			continue
+		}
+		if f.StartLine > 0 {
+			f.EndLine = f.StartLine + lines - 1
+		}
+		f.Content = text + "\n" + truncatedMark
+		res = append(res, f)
+		trim.Kept += kept
+		trim.Truncated = append(trim.Truncated, name)
+	}
+	return res, trim
+}
+
+// truncateTokens returns whole leading lines of the text with at most n estimated tokens, their tokens
+// and the number of lines
+func truncateTokens(text string, n int) (res string, kept, lines int) {
+	end := 0
+	for end < len(text) {
+		next := len(text)
+		if i := strings.IndexByte(text[end:], '\n'); i >= 0 {
+			next = end + i + 1
+		}
+		t := tokens.Estimate(text[end:next])
+		if kept+t > n {
+			break
+		}
+		kept += t
+		lines++
+		end = next
+	}
+	return strings.TrimSuffix(text[:end], "\n"), kept, lines
+}
+
+// estimateFiles returns estimated tokens of file contents
+func estimateFiles(list []files.File) int {
+	res := 0
+	for _, f := range list {
+		res += tokens.Estimate(f.Content)
+	}
+	return res
+}
@@ -0,0 +1,116 @@
+package prompt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/files"
+	"github.com/umputun/mpt/pkg/tokens"
+)
+
+func TestTruncateTokens(t *testing.T) {
+	text := "first line\nsecond line\nthird line\n"
+	res, kept, lines := truncateTokens(text, tokens.Estimate("first line\nsecond line\n"))
+	assert.Equal(t, "first line\nsecond line", res)
+	assert.Equal(t, tokens.Estimate("first line\nsecond line\n"), kept)
+	assert.Equal(t, 2, lines)
+
+	res, kept, lines = truncateTokens(text, 1)
+	assert.Empty(t, res)
+	assert.Zero(t, kept)
+	assert.Zero(t, lines)
+
+	res, _, lines = truncateTokens("no newline", 100)
+	assert.Equal(t, "no newline", res)
+	assert.Equal(t, 1, lines)
+}
+
+func TestParts_Fit(t *testing.T) {
+	line := strings.Repeat("word ", 10) + "\n" // 11 tokens
+	content := func(lines int) string { return strings.Repeat(line, lines) }
+	newParts := func() Parts {
+		return Parts{
+			Text:  "review",
+			Input: content(10),
+			Files: []files.File{{Name: "a.go", Content: content(3)}, {Name: "b.go", Content: content(4)},
+				{Name: "c.go", Content: content(3)}},
+			Git: []files.File{{Name: "../tmp/mpt-git-diff.txt", Path: "/tmp/mpt-git-diff.txt", Content: content(5)}},
+		}
+	}
+	lineTokens := tokens.Estimate(line)
+
+	t.Run("prompt within limit", func(t *testing.T) {
+		p := newParts()
+		assert.Nil(t, p.fit(Budget{Limit: 10000, Files: 10, Git: 10, Input: 10}))
+		assert.Equal(t, newParts(), p)
+	})
+
+	t.Run("no budgets", func(t *testing.T) {
+		p := newParts()
+		assert.Nil(t, p.fit(Budget{Limit: 10}))
+		assert.Equal(t, newParts(), p)
+	})
+
+	t.Run("sources trimmed to budgets", func(t *testing.T) {
+		p := newParts()
+		trims := p.fit(Budget{Limit: 100, Files: 5 * lineTokens, Git: 2 * lineTokens, Input: 3 * lineTokens})
+		require.Len(t, trims, 3)
+		assert.Equal(t, Trim{Source: SourceFiles, Tokens: 10 * lineTokens, Kept: 5 * lineTokens, Truncated: []string{"b.go"},
+			Dropped: []string{"c.go"}}, trims[0])
+		assert.Equal(t, Trim{Source: SourceGit, Tokens: 5 * lineTokens, Kept: 2 * lineTokens,
+			Truncated: []string{"mpt-git-diff.txt"}}, trims[1])
+		assert.Equal(t, Trim{Source: SourceInput, Tokens: 10 * lineTokens, Kept: 3 * lineTokens}, trims[2])
+
+		require.Len(t, p.Files, 2)
+		assert.Equal(t, content(3), p.Files[0].Content)
+		assert.Equal(t, content(2)+truncatedMark, p.Files[1].Content)
+		assert.Equal(t, content(2)+truncatedMark, p.Git[0].Content)
+		assert.Equal(t, content(3)+truncatedMark, p.Input)
+		assert.Equal(t, "files 110 -> 55 tokens (truncated b.go, dropped c.go)", trims[0].String())
+		assert.Equal(t, "stdin 110 -> 33 tokens", trims[2].String())
+	})
+
+	t.Run("only budgeted sources trimmed", func(t *testing.T) {
+		p := newParts()
+		trims := p.fit(Budget{Limit: 100, Files: 3 * lineTokens})
+		assert.Equal(t, []Trim{{Source: SourceFiles, Tokens: 10 * lineTokens, Kept: 3 * lineTokens,
+			Dropped: []string{"b.go", "c.go"}}}, trims)
+		assert.Equal(t, newParts().Git, p.Git)
+		assert.Equal(t, newParts().Input, p.Input)
+	})
+
+	t.Run("line ranges of truncated selection", func(t *testing.T) {
+		p := Parts{Files: []files.File{{Name: "a.go", StartLine: 10, EndLine: 14, Content: content(5)}}}
+		p.fit(Budget{Limit: 10, Files: 2 * lineTokens})
+		assert.Equal(t, 11, p.Files[0].EndLine)
+	})
+}
+
+func TestBuilder_WithBudget(t *testing.T) {
+	dir := t.TempDir()
+	line := strings.Repeat("word ", 10) + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte(strings.Repeat(line, 3)), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte(strings.Repeat(line, 3)), 0o600))
+
+	builder := New("summarize", nil).WithDir(dir).WithFiles([]string{filepath.Join(dir, "*.txt")}).
+		WithBudget(Budget{Limit: 50, Files: 4 * tokens.Estimate(line)})
+	res, err := builder.BuildContext(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, res, "summarize\n\n// file: a.txt\n")
+	assert.Contains(t, res, "// file: b.txt\n"+line+truncatedMark)
+	assert.Equal(t, []Trim{{Source: SourceFiles, Tokens: 6 * tokens.Estimate(line), Kept: 4 * tokens.Estimate(line),
+		Truncated: []string{"b.txt"}}}, builder.Trims())
+
+	builder = New("summarize", nil).WithDir(dir).WithFiles([]string{filepath.Join(dir, "*.txt")}).
+		WithBudget(Budget{Limit: 1000, Files: 10})
+	res, err = builder.BuildContext(context.Background())
+	require.NoError(t, err)
+	assert.NotContains(t, res, truncatedMark)
+	assert.Empty(t, builder.Trims())
+}
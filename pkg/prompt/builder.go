@@ -1,20 +1,25 @@
 package prompt
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/go-pkgz/lgr"
 
 	"github.com/umputun/mpt/pkg/files"
+	"github.com/umputun/mpt/pkg/provider"
 )
 
 //go:generate moq -out mocks/git_diff_processor.go -pkg mocks -skip-ensure -fmt goimports . GitDiffProcessor
 
-// GitDiffProcessor handles git diff operations
+// GitDiffProcessor handles git diff, blame and log operations
 type GitDiffProcessor interface {
 	ProcessGitDiff(isDiff bool, branchName string) (tempFilePath, diffDescription string, err error)
 	TryBranchDiff() (tempFile, description string, err error)
+	ProcessGitBlame(file string) (tempFile, description string, err error)
+	ProcessGitLog(count int) (tempFile, description string, err error)
+	ChangedFiles(ref string) ([]string, error)
 	Cleanup()
 }
 
@@ -27,7 +32,55 @@ type Builder struct {
 	excludes    []string
 	maxFileSize int64
 	force       bool
+	symlinks    bool
+	submodules  bool
+	dir         string            // directory of relative file patterns, current directory if empty
+	workers     int               // number of workers reading files concurrently
+	ecosystems  []files.Ecosystem // ecosystems of the project, adding default excludes and file summaries
 	gitDiffer   GitDiffProcessor
+	gitFiles    []string // temporary files of git context, included in files
+	changed     []string // files changed since the git ref matched files are limited to, not limited if nil
+	relevance   *relevanceOpts
+	template    bool              // expand template functions in the base text
+	args        map[string]string // arguments of the template, referenced as {{.name}}
+	input       string            // piped input appended to the base text as is, not expanded as a template
+	wrapper     files.Wrapper     // how file contents are wrapped, plain comment headers if empty
+	position    string            // where file contents are placed, see ValidatePosition
+	budget      Budget            // token budgets of context sources, not limited if zero
+	environment string            // snapshot of the runtime environment, included as context after files
+	trims       []Trim            // context sources trimmed to fit the budget by the last build
+	sizing      bool              // keep sizes of included files, see WithFileSizes
+	sizes       []FileSize        // sizes of files included by the last build, if sizing
+}
+
+// relevanceOpts holds parameters of embeddings-based file relevance filtering
+type relevanceOpts struct {
+	embedder provider.Embedder
+	topK     int
+	minScore float64
+}
+
+// context positions relative to the base text
+const (
+	PositionAfter   = "after"    // file contents follow the base text, default
+	PositionBefore  = "before"   // file contents precede the base text
+	positionReplace = "replace:" // prefix of the position replacing a marker in the base text with file contents
+)
+
+// ValidatePosition checks the position of file contents: "after" (or empty), "before", or "replace:<marker>"
+// replacing the marker in the base text
+func ValidatePosition(position string) error {
+	switch {
+	case position == "", position == PositionAfter, position == PositionBefore:
+		return nil
+	case strings.HasPrefix(position, positionReplace):
+		if strings.TrimPrefix(position, positionReplace) == "" {
+			return fmt.Errorf("no marker in context position %q", position)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid context position %q, expected before, after or replace:<marker>", position)
+	}
 }
 
 // New creates a new prompt builder with the provided base text.
@@ -67,42 +120,276 @@ func (b *Builder) WithForce(force bool) *Builder {
 	return b
 }
 
+// WithFollowSymlinks enables following symlinked directories while walking file patterns.
+func (b *Builder) WithFollowSymlinks(follow bool) *Builder {
+	b.symlinks = follow
+	return b
+}
+
+// WithIncludeSubmodules enables loading files from git submodules, skipped by default.
+func (b *Builder) WithIncludeSubmodules(include bool) *Builder {
+	b.submodules = include
+	return b
+}
+
+// WithDir sets the directory relative file patterns, ignore files and file headers are resolved against.
+// The current directory is used if not set.
+func (b *Builder) WithDir(dir string) *Builder {
+	b.dir = dir
+	return b
+}
+
+// WithFileWorkers sets the number of workers reading files concurrently, files.DefaultWorkers if not set.
+func (b *Builder) WithFileWorkers(workers int) *Builder {
+	b.workers = workers
+	return b
+}
+
+// WithEcosystems sets ecosystems of the project, adding their default excludes and summaries of files like go.sum.
+func (b *Builder) WithEcosystems(ecosystems []files.Ecosystem) *Builder {
+	b.ecosystems = ecosystems
+	return b
+}
+
+// WithRelevance enables relevance filtering of file content. Matched files are split into chunks and
+// only top-K chunks most similar to the prompt (with score of at least minScore) are included.
+func (b *Builder) WithRelevance(embedder provider.Embedder, topK int, minScore float64) *Builder {
+	b.relevance = &relevanceOpts{embedder: embedder, topK: topK, minScore: minScore}
+	return b
+}
+
+// WithTemplate enables expansion of template functions in the base text, like {{file "main.go"}},
+// {{glob "pkg/**/*.go"}} and {{gitdiff}}, placing context at the exact spot of the prompt.
+func (b *Builder) WithTemplate(enabled bool) *Builder {
+	b.template = enabled
+	return b
+}
+
+// WithArgs sets arguments of the template, referenced in the base text as {{.name}}. Referencing an argument
+// which is not set fails the build.
+func (b *Builder) WithArgs(args map[string]string) *Builder {
+	b.args = args
+	return b
+}
+
+// WithInput sets piped input appended to the base text after template expansion, so the input is never
+// expanded as a template and can't pull files or git context into the prompt.
+func (b *Builder) WithInput(input string) *Builder {
+	b.input = input
+	return b
+}
+
+// WithContextWrapper sets how file contents are wrapped, e.g. in <file path="..."> tags.
+func (b *Builder) WithContextWrapper(wrapper files.Wrapper) *Builder {
+	b.wrapper = wrapper
+	return b
+}
+
+// WithContextPosition sets where file contents are placed relative to the base text, see ValidatePosition.
+func (b *Builder) WithContextPosition(position string) *Builder {
+	b.position = position
+	return b
+}
+
+// WithBudget sets token budgets of context sources, trimming them if the prompt is larger than the limit.
+// Sources are trimmed by estimated tokens, see Trims for what was trimmed.
+func (b *Builder) WithBudget(budget Budget) *Builder {
+	b.budget = budget
+	return b
+}
+
+// WithEnvironment includes the snapshot of the runtime environment as context, after files and git context.
+// The snapshot is included as is and should be redacted by the caller.
+func (b *Builder) WithEnvironment(snapshot string) *Builder {
+	b.environment = snapshot
+	return b
+}
+
+// Trims returns context sources trimmed to fit the budget by the last build
+func (b *Builder) Trims() []Trim {
+	return b.trims
+}
+
+// WithFileSizes makes the build keep sizes of included files, git context and the environment snapshot,
+// returned by FileSizes. Matched files are read twice if there is no budget, as the prompt is built
+// from the formatted content of files then.
+func (b *Builder) WithFileSizes(enabled bool) *Builder {
+	b.sizing = enabled
+	return b
+}
+
+// FileSizes returns sizes of files, git context and the environment snapshot included by the last build,
+// largest first, if enabled by WithFileSizes
+func (b *Builder) FileSizes() []FileSize {
+	return b.sizes
+}
+
 // Build constructs the final prompt string by combining the base text with
 // content from the matched files. Returns an error if file loading fails.
 func (b *Builder) Build() (string, error) {
+	return b.BuildContext(context.Background())
+}
+
+// BuildContext is like Build but uses the given context for loading files and requests made while building,
+// e.g. embeddings requests of relevance filtering. Canceling the context stops walking directories and
+// reading files of large patterns.
+func (b *Builder) BuildContext(ctx context.Context) (string, error) {
 	// ensure cleanup happens after build if gitDiffer is not nil
 	if b.gitDiffer != nil {
 		defer b.gitDiffer.Cleanup()
 	}
 
-	finalPrompt := b.baseText
+	// budgets trim sources separately, so the prompt is built from its parts, with files preceding git context
+	if b.budget.active() {
+		parts, err := b.parts(ctx)
+		if err != nil {
+			return "", err
+		}
+		b.trims = parts.fit(b.budget)
+		if b.sizing {
+			b.sizes = fileSizes(parts.Files, parts.Git, parts.Env)
+		}
+		return parts.Format(b.wrapper)
+	}
+
+	finalPrompt, err := b.text(ctx)
+	if err != nil {
+		return "", err
+	}
+	if b.input != "" {
+		finalPrompt = CombineWithInput(finalPrompt, b.input)
+	}
 
 	// only process files if patterns were provided
+	var content string
 	if len(b.files) > 0 {
 		lgr.Printf("[DEBUG] loading files from patterns: %v", b.files)
 		if len(b.excludes) > 0 {
 			lgr.Printf("[DEBUG] excluding patterns: %v", b.excludes)
 		}
 
-		fileContent, err := files.LoadContent(files.LoadRequest{
-			Patterns:        b.files,
-			ExcludePatterns: b.excludes,
-			MaxFileSize:     b.maxFileSize,
-			Force:           b.force,
-		})
+		fileContent, err := b.loadFiles(ctx)
 		if err != nil {
 			return "", fmt.Errorf("failed to load files: %w", err)
 		}
-
 		if fileContent != "" {
 			lgr.Printf("[DEBUG] loaded %d bytes of content from files", len(fileContent))
-			finalPrompt += "\n\n" + fileContent
+		}
+		content = fileContent
+	}
+	content += files.FormatFiles(environmentFiles(b.environment), b.wrapper)
+	if b.sizing && len(b.files) == 0 {
+		b.sizes = fileSizes(nil, nil, b.environment)
+	}
+
+	if content != "" {
+		if finalPrompt, err = placeContext(b.position, finalPrompt, strings.TrimRight(content, "\n")); err != nil {
+			return "", err
 		}
 	}
 
 	return strings.TrimSpace(finalPrompt), nil
 }
 
+// text returns the base text with template functions expanded if enabled
+func (b *Builder) text(ctx context.Context) (string, error) {
+	if !b.template {
+		return b.baseText, nil
+	}
+	return b.expandTemplate(ctx, b.baseText)
+}
+
+// placeContext places file contents relative to the prompt text according to the position
+func placeContext(position, text, content string) (string, error) {
+	switch {
+	case position == PositionBefore:
+		return content + "\n\n" + text, nil
+	case strings.HasPrefix(position, positionReplace):
+		marker := strings.TrimPrefix(position, positionReplace)
+		if !strings.Contains(text, marker) {
+			return "", fmt.Errorf("context marker %q not found in the prompt", marker)
+		}
+		return strings.ReplaceAll(text, marker, content), nil
+	default:
+		return text + "\n\n" + content, nil
+	}
+}
+
+// loadFiles loads content of all matched files, or only of relevant chunks if relevance filtering is enabled.
+// Sizes of loaded files are kept if requested with WithFileSizes.
+func (b *Builder) loadFiles(ctx context.Context) (string, error) {
+	if b.relevance == nil {
+		if b.sizing {
+			loaded, err := files.LoadFiles(ctx, b.loadRequest())
+			if err != nil {
+				return "", err
+			}
+			ff, git := b.splitGit(loaded)
+			b.sizes = fileSizes(ff, git, b.environment)
+		}
+		return files.LoadContent(ctx, b.loadRequest())
+	}
+	chunks, err := b.relevantChunks(ctx)
+	if err != nil || len(chunks) == 0 {
+		return "", err
+	}
+	if b.sizing {
+		loaded, err := files.ChunkFiles(chunks, b.dir)
+		if err != nil {
+			return "", err
+		}
+		ff, git := b.splitGit(loaded)
+		b.sizes = fileSizes(ff, git, b.environment)
+	}
+	return files.FormatChunks(chunks, b.dir, b.wrapper)
+}
+
+// loadRequest returns the request loading files of the builder
+func (b *Builder) loadRequest() files.LoadRequest {
+	var changed []string
+	if b.changed != nil {
+		// temporary files of git context are not changed files, but always included
+		changed = append(append(make([]string, 0, len(b.changed)+len(b.gitFiles)), b.changed...), b.gitFiles...)
+	}
+	return files.LoadRequest{
+		Patterns:          b.files,
+		ExcludePatterns:   b.excludes,
+		MaxFileSize:       b.maxFileSize,
+		Force:             b.force,
+		FollowSymlinks:    b.symlinks,
+		IncludeSubmodules: b.submodules,
+		Dir:               b.dir,
+		Workers:           b.workers,
+		Wrapper:           b.wrapper,
+		Ecosystems:        b.ecosystems,
+		Changed:           changed,
+	}
+}
+
+// relevantChunks returns chunks of matched files relevant to the base text
+func (b *Builder) relevantChunks(ctx context.Context) ([]files.Chunk, error) {
+	matched, err := files.MatchFiles(ctx, b.loadRequest())
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := files.SelectRelevant(ctx, files.RelevanceRequest{
+		Query:       b.baseText,
+		Files:       matched,
+		Embedder:    b.relevance.embedder,
+		TopK:        b.relevance.topK,
+		MinScore:    b.relevance.minScore,
+		MaxFileSize: b.maxFileSize,
+		Workers:     b.workers,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to select relevant files: %w", err)
+	}
+	if len(chunks) == 0 {
+		lgr.Printf("[WARN] no file chunks matched relevance criteria (min score %.2f)", b.relevance.minScore)
+	}
+	return chunks, nil
+}
+
 // WithGitDiff adds uncommitted changes from git diff to the prompt
 // Creates a temporary file with the diff output and adds it to the files to process
 func (b *Builder) WithGitDiff() (*Builder, error) {
@@ -152,10 +439,65 @@ func (b *Builder) WithGitBranchDiff(branch string) (*Builder, error) {
 	return b, nil
 }
 
+// WithGitBlame adds annotated git blame output of the file to the prompt
+func (b *Builder) WithGitBlame(file string) (*Builder, error) {
+	if b.gitDiffer == nil {
+		return b, fmt.Errorf("git blame requested but git differ not initialized")
+	}
+
+	tempFile, description, err := b.gitDiffer.ProcessGitBlame(file)
+	if err != nil {
+		return b, err
+	}
+
+	if tempFile != "" {
+		return b.addGitDiffFile(tempFile, description), nil
+	}
+
+	return b, nil
+}
+
+// WithGitLog adds messages of the last count commits to the prompt
+func (b *Builder) WithGitLog(count int) (*Builder, error) {
+	if b.gitDiffer == nil {
+		return b, fmt.Errorf("git log requested but git differ not initialized")
+	}
+
+	tempFile, description, err := b.gitDiffer.ProcessGitLog(count)
+	if err != nil {
+		return b, err
+	}
+
+	if tempFile != "" {
+		return b.addGitDiffFile(tempFile, description), nil
+	}
+
+	return b, nil
+}
+
+// WithChangedSince limits matched files to files changed since the merge base of the git ref and HEAD,
+// uncommitted and untracked files included. Files are included in full, unlike the git diff.
+func (b *Builder) WithChangedSince(ref string) (*Builder, error) {
+	if b.gitDiffer == nil {
+		return b, fmt.Errorf("changed files requested but git differ not initialized")
+	}
+
+	changed, err := b.gitDiffer.ChangedFiles(ref)
+	if err != nil {
+		return b, err
+	}
+	if changed == nil {
+		changed = []string{} // nothing changed, no files match rather than all of them
+	}
+	b.changed = changed
+	return b, nil
+}
+
 // addGitDiffFile adds the git diff file to the builder
 func (b *Builder) addGitDiffFile(tempFile, description string) *Builder {
 	// add the file to the list of files to include
 	b.files = append(b.files, tempFile)
+	b.gitFiles = append(b.gitFiles, tempFile)
 
 	// prepend a description of the git diff to the prompt
 	if b.baseText != "" {
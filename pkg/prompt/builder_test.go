@@ -1,13 +1,16 @@
 package prompt
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/umputun/mpt/pkg/files"
 	"github.com/umputun/mpt/pkg/prompt/mocks"
 )
 
@@ -255,6 +258,100 @@ func TestBuilder_WithGitBranchDiff(t *testing.T) {
 	})
 }
 
+func TestBuilder_WithGitBlameAndLog(t *testing.T) {
+	blameFile := filepath.Join(t.TempDir(), "blame.txt")
+	require.NoError(t, os.WriteFile(blameFile, []byte("blame content"), 0o600))
+	logFile := filepath.Join(t.TempDir(), "log.txt")
+	require.NoError(t, os.WriteFile(logFile, []byte("log content"), 0o600))
+
+	mockDiffer := &mocks.GitDiffProcessorMock{
+		ProcessGitBlameFunc: func(file string) (string, string, error) {
+			return blameFile, "git blame of " + file, nil
+		},
+		ProcessGitLogFunc: func(count int) (string, string, error) {
+			return logFile, "git log of the last 3 commits", nil
+		},
+		CleanupFunc: func() {},
+	}
+
+	builder := New("why was it changed?", mockDiffer)
+	_, err := builder.WithGitBlame("main.go")
+	require.NoError(t, err)
+	_, err = builder.WithGitLog(3)
+	require.NoError(t, err)
+	result, err := builder.Build()
+	require.NoError(t, err)
+	assert.Contains(t, result, "I'm providing git blame of main.go for context.")
+	assert.Contains(t, result, "I'm providing git log of the last 3 commits for context.")
+	assert.Contains(t, result, "blame content")
+	assert.Contains(t, result, "log content")
+	require.Len(t, mockDiffer.ProcessGitBlameCalls(), 1)
+	assert.Equal(t, "main.go", mockDiffer.ProcessGitBlameCalls()[0].File)
+	require.Len(t, mockDiffer.ProcessGitLogCalls(), 1)
+	assert.Equal(t, 3, mockDiffer.ProcessGitLogCalls()[0].Count)
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := New("prompt", nil).WithGitBlame("main.go")
+		require.ErrorContains(t, err, "git blame requested but git differ not initialized")
+		_, err = New("prompt", nil).WithGitLog(1)
+		require.ErrorContains(t, err, "git log requested but git differ not initialized")
+
+		failing := &mocks.GitDiffProcessorMock{
+			ProcessGitLogFunc: func(int) (string, string, error) { return "", "", assert.AnError },
+		}
+		_, err = New("prompt", failing).WithGitLog(1)
+		require.ErrorIs(t, err, assert.AnError)
+	})
+}
+
+func TestBuilder_WithChangedSince(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "changed.go"), []byte("package changed"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "same.go"), []byte("package same"), 0o600))
+	diffFile := filepath.Join(t.TempDir(), "diff.txt")
+	require.NoError(t, os.WriteFile(diffFile, []byte("diff content"), 0o600))
+
+	mockDiffer := &mocks.GitDiffProcessorMock{
+		ChangedFilesFunc: func(ref string) ([]string, error) {
+			return []string{filepath.Join(dir, "changed.go"), filepath.Join(dir, "deleted.go")}, nil
+		},
+		ProcessGitDiffFunc: func(isBranchDiff bool, branchName string) (string, string, error) {
+			return diffFile, "git diff", nil
+		},
+		CleanupFunc: func() {},
+	}
+
+	builder, err := New("review", mockDiffer).WithFiles([]string{filepath.Join(dir, "*.go")}).WithChangedSince("origin/main")
+	require.NoError(t, err)
+	_, err = builder.WithGitDiff()
+	require.NoError(t, err)
+	result, err := builder.Build()
+	require.NoError(t, err)
+	assert.Contains(t, result, "package changed")
+	assert.NotContains(t, result, "package same")
+	assert.Contains(t, result, "diff content", "git context is not limited to changed files")
+	require.Len(t, mockDiffer.ChangedFilesCalls(), 1)
+	assert.Equal(t, "origin/main", mockDiffer.ChangedFilesCalls()[0].Ref)
+
+	t.Run("nothing changed", func(t *testing.T) {
+		unchanged := &mocks.GitDiffProcessorMock{ChangedFilesFunc: func(string) ([]string, error) { return nil, nil },
+			CleanupFunc: func() {}}
+		builder, err := New("review", unchanged).WithFiles([]string{filepath.Join(dir, "*.go")}).WithChangedSince("main")
+		require.NoError(t, err)
+		_, err = builder.Build()
+		require.ErrorContains(t, err, "none of 2 matched files is among 0 changed files")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := New("prompt", nil).WithChangedSince("main")
+		require.ErrorContains(t, err, "changed files requested but git differ not initialized")
+
+		failing := &mocks.GitDiffProcessorMock{ChangedFilesFunc: func(string) ([]string, error) { return nil, assert.AnError }}
+		_, err = New("prompt", failing).WithChangedSince("main")
+		require.ErrorIs(t, err, assert.AnError)
+	})
+}
+
 func TestBuilder_WithMaxFileSize(t *testing.T) {
 	mockDiffer := &mocks.GitDiffProcessorMock{
 		CleanupFunc: func() {},
@@ -281,6 +378,47 @@ func TestBuilder_WithForce(t *testing.T) {
 	assert.False(t, builder.force)
 }
 
+// wordEmbedder returns one-dimensional vectors, 1 if the text contains the word and -1 otherwise
+type wordEmbedder struct{ word string }
+
+func (e wordEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	res := make([][]float32, len(texts))
+	for i, text := range texts {
+		res[i] = []float32{-1}
+		if strings.Contains(text, e.word) {
+			res[i] = []float32{1}
+		}
+	}
+	return res, nil
+}
+
+func TestBuilder_WithRelevance(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("about the database schema"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "b.txt"), []byte("about the http handlers"), 0o600))
+
+	t.Run("only relevant files included", func(t *testing.T) {
+		builder := New("question about database", nil).
+			WithFiles([]string{filepath.Join(tempDir, "*.txt")}).
+			WithRelevance(wordEmbedder{word: "database"}, 5, 0.5)
+		res, err := builder.BuildContext(context.Background())
+		require.NoError(t, err)
+		assert.Contains(t, res, "question about database")
+		assert.Contains(t, res, "about the database schema")
+		assert.Contains(t, res, "a.txt (lines 1-1)")
+		assert.NotContains(t, res, "http handlers")
+	})
+
+	t.Run("nothing relevant", func(t *testing.T) {
+		builder := New("question about database", nil).
+			WithFiles([]string{filepath.Join(tempDir, "b.txt")}).
+			WithRelevance(wordEmbedder{word: "database"}, 5, 0.5)
+		res, err := builder.Build()
+		require.NoError(t, err)
+		assert.Equal(t, "question about database", res)
+	})
+}
+
 func TestBuilder_WithGitDiff_ErrorCases(t *testing.T) {
 	t.Run("error from ProcessGitDiff", func(t *testing.T) {
 		mockDiffer := &mocks.GitDiffProcessorMock{
@@ -354,6 +492,19 @@ func TestBuilder_Build_ErrorCase(t *testing.T) {
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "no files matched the provided patterns")
 	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a"), 0o600))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := New("test prompt", nil).WithFiles([]string{dir + "/**/*.go"}).BuildContext(ctx)
+		require.ErrorIs(t, err, context.Canceled)
+
+		_, err = New(`{{file "`+dir+`/a.go"}}`, nil).WithTemplate(true).BuildContext(ctx)
+		require.ErrorIs(t, err, context.Canceled)
+	})
 }
 
 func TestBuilder_AddGitDiffFile(t *testing.T) {
@@ -384,3 +535,78 @@ func TestBuilder_AddGitDiffFile(t *testing.T) {
 		assert.Contains(t, builder.files, "/tmp/diff.txt")
 	})
 }
+
+func TestBuilder_WithContext(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o600))
+
+	tests := []struct {
+		name     string
+		text     string
+		position string
+		wrapper  files.Wrapper
+		want     string
+		err      string
+	}{
+		{name: "default", text: "review", want: "review\n\n// file: main.go\npackage main"},
+		{name: "after xml", text: "review", position: PositionAfter, wrapper: files.WrapperXML,
+			want: "review\n\n<file path=\"main.go\">\npackage main\n</file>"},
+		{name: "before markdown", text: "review", position: PositionBefore, wrapper: files.WrapperMarkdown,
+			want: "### main.go\n```go\npackage main\n```\n\nreview"},
+		{name: "replace marker", text: "code:\n@CODE@\nreview it", position: "replace:@CODE@",
+			want: "code:\n// file: main.go\npackage main\nreview it"},
+		{name: "missing marker", text: "review", position: "replace:@CODE@", err: `context marker "@CODE@" not found in the prompt`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := New(tt.text, nil).WithDir(dir).WithFiles([]string{"main.go"}).
+				WithContextPosition(tt.position).WithContextWrapper(tt.wrapper).Build()
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, res)
+		})
+	}
+}
+
+func TestBuilder_WithEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o600))
+
+	t.Run("after files", func(t *testing.T) {
+		res, err := New("why does it fail?", nil).WithDir(dir).WithFiles([]string{"main.go"}).
+			WithEnvironment("os: linux/amd64\ngo: go version go1.25.1").Build()
+		require.NoError(t, err)
+		assert.Equal(t, "why does it fail?\n\n// file: main.go\npackage main\n\n\n// file: environment\nos: linux/amd64\n"+
+			"go: go version go1.25.1", res)
+	})
+
+	t.Run("without files", func(t *testing.T) {
+		res, err := New("why does it fail?", nil).WithEnvironment("os: darwin/arm64").
+			WithContextWrapper(files.WrapperXML).WithContextPosition(PositionBefore).Build()
+		require.NoError(t, err)
+		assert.Equal(t, "<file path=\"environment\">\nos: darwin/arm64\n</file>\n\nwhy does it fail?", res)
+	})
+
+	t.Run("parts", func(t *testing.T) {
+		b := New("why?", nil).WithDir(dir).WithFiles([]string{"main.go"}).WithEnvironment("os: linux/amd64")
+		parts, err := b.BuildParts(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "os: linux/amd64", parts.Env)
+		text, err := parts.Format(files.WrapperPlain)
+		require.NoError(t, err)
+		built, err := New("why?", nil).WithDir(dir).WithFiles([]string{"main.go"}).WithEnvironment("os: linux/amd64").Build()
+		require.NoError(t, err)
+		assert.Equal(t, built, text)
+	})
+}
+
+func TestValidatePosition(t *testing.T) {
+	for _, pos := range []string{"", "after", "before", "replace:{{files}}"} {
+		require.NoError(t, ValidatePosition(pos), pos)
+	}
+	require.EqualError(t, ValidatePosition("replace:"), `no marker in context position "replace:"`)
+	require.EqualError(t, ValidatePosition("middle"), `invalid context position "middle", expected before, after or replace:<marker>`)
+}
@@ -0,0 +1,127 @@
+package prompt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/umputun/mpt/pkg/config"
+)
+
+// frontMatterDelimiter separates the YAML front-matter block from the prompt text
+const frontMatterDelimiter = "---"
+
+// File is a prompt loaded from a file, with options set in the optional YAML front-matter block
+type File struct {
+	Text        string            // prompt text following the front-matter
+	Args        []string          // command line arguments made from the front-matter options, like "--openai.enabled"
+	Description string            // what the prompt does, set with "description" key of the front-matter
+	Arguments   map[string]string // descriptions of template arguments by name, set with "arguments" key
+}
+
+// LoadFile reads the prompt file, see ParseFile for the format
+func LoadFile(path string) (File, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // prompt file is set by the user
+	if err != nil {
+		return File{}, fmt.Errorf("failed to read prompt file: %w", err)
+	}
+	f, err := ParseFile(data)
+	if err != nil {
+		return File{}, fmt.Errorf("invalid prompt file %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// ParseFile parses the prompt file content. The optional front-matter is a YAML map between "---" lines
+// at the top of the file, with options in the format of config.OptionArgs. The "description" and "arguments"
+// keys describe the prompt and its template arguments, they are not options.
+func ParseFile(data []byte) (File, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if !strings.HasPrefix(text, frontMatterDelimiter+"\n") {
+		return File{Text: strings.TrimSpace(text)}, nil
+	}
+
+	rest := text[len(frontMatterDelimiter)+1:]
+	var header, body string
+	switch end := strings.Index(rest, "\n"+frontMatterDelimiter+"\n"); {
+	case strings.HasPrefix(rest, frontMatterDelimiter+"\n"): // empty front-matter
+		body = rest[len(frontMatterDelimiter)+1:]
+	case end >= 0:
+		header, body = rest[:end], rest[end+len(frontMatterDelimiter)+2:]
+	case strings.HasSuffix(rest, "\n"+frontMatterDelimiter):
+		header = strings.TrimSuffix(rest, "\n"+frontMatterDelimiter)
+	default:
+		return File{}, fmt.Errorf("front-matter is not closed with %q line", frontMatterDelimiter)
+	}
+
+	var options map[string]any
+	dec := yaml.NewDecoder(bytes.NewBufferString(header))
+	if err := dec.Decode(&options); err != nil && !errors.Is(err, io.EOF) {
+		return File{}, fmt.Errorf("invalid front-matter: %w", err)
+	}
+	res := File{Text: strings.TrimSpace(body)}
+	if v, ok := options["description"]; ok {
+		if res.Description, ok = v.(string); !ok {
+			return File{}, fmt.Errorf("invalid front-matter: description should be a string")
+		}
+		delete(options, "description")
+	}
+	if v, ok := options["arguments"]; ok {
+		arguments, ok := v.(map[string]any)
+		if !ok {
+			return File{}, fmt.Errorf("invalid front-matter: arguments should be a map of names to descriptions")
+		}
+		res.Arguments = make(map[string]string, len(arguments))
+		for name, desc := range arguments {
+			if desc == nil {
+				desc = ""
+			}
+			res.Arguments[name] = fmt.Sprint(desc)
+		}
+		delete(options, "arguments")
+	}
+
+	args, err := config.OptionArgs(options)
+	if err != nil {
+		return File{}, fmt.Errorf("invalid front-matter: %w", err)
+	}
+	res.Args = args
+	return res, nil
+}
+
+// Template is a prompt file of the library, named after the file without extension
+type Template struct {
+	Name string
+	File
+}
+
+// LoadLibrary loads prompt files with .md extension from the directory, sorted by name. A missing directory
+// is an empty library.
+func LoadLibrary(dir string) ([]Template, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt library: %w", err)
+	}
+	var res []Template
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".md" {
+			continue
+		}
+		f, err := LoadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, Template{Name: strings.TrimSuffix(e.Name(), ".md"), File: f})
+	}
+	return res, nil
+}
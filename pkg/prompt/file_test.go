@@ -0,0 +1,95 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantText string
+		wantArgs []string
+		wantErr  string
+	}{
+		{name: "no front-matter", data: "\n  review the code\n", wantText: "review the code"},
+		{
+			name: "options",
+			data: "---\nopenai:\n  enabled: true\n  temperature: 0.2\nfile: [\"*.go\", \"cmd/**\"]\nmix: true\n" +
+				"mix.provider: anthropic\nauto-continue: false\n---\nreview the code\n",
+			wantText: "review the code",
+			wantArgs: []string{"--file=*.go", "--file=cmd/**", "--mix", "--mix.provider=anthropic",
+				"--openai.enabled", "--openai.temperature=0.2"},
+		},
+		{name: "crlf line endings", data: "---\r\ngit.diff: true\r\n---\r\ncheck it", wantText: "check it", wantArgs: []string{"--git.diff"}},
+		{name: "empty front-matter", data: "---\n---\nprompt\n---\nrest", wantText: "prompt\n---\nrest"},
+		{name: "front-matter only", data: "---\nopenai.enabled: true\n---", wantArgs: []string{"--openai.enabled"}},
+		{name: "not closed", data: "---\nopenai.enabled: true\nprompt", wantErr: "front-matter is not closed"},
+		{name: "invalid yaml", data: "---\n[not a map\n---\nprompt", wantErr: "invalid front-matter"},
+		{name: "no value", data: "---\nmix.provider:\n---\nprompt", wantErr: "option mix.provider has no value"},
+		{name: "description not a string", data: "---\ndescription: [a]\n---\nprompt", wantErr: "description should be a string"},
+		{name: "arguments not a map", data: "---\narguments: [a]\n---\nprompt", wantErr: "arguments should be a map"},
+		{name: "nested list items", data: "---\nfile: [{a: 1}]\n---\nprompt", wantErr: "option file: list items should be values"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFile([]byte(tt.data))
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantText, f.Text)
+			assert.Equal(t, tt.wantArgs, f.Args)
+		})
+	}
+}
+
+func TestParseFile_Description(t *testing.T) {
+	f, err := ParseFile([]byte("---\ndescription: Review changes\narguments:\n  focus: what to focus on\n  lang:\n" +
+		"template: true\n---\nreview {{.focus}}"))
+	require.NoError(t, err)
+	assert.Equal(t, File{Text: "review {{.focus}}", Args: []string{"--template"}, Description: "Review changes",
+		Arguments: map[string]string{"focus": "what to focus on", "lang": ""}}, f)
+}
+
+func TestLoadLibrary(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "review.md"), []byte("---\ndescription: Code review\n---\nreview"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "changelog.md"), []byte("write a changelog"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a prompt"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "drafts.md"), 0o750))
+
+	lib, err := LoadLibrary(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []Template{{Name: "changelog", File: File{Text: "write a changelog"}},
+		{Name: "review", File: File{Text: "review", Description: "Code review"}}}, lib)
+
+	lib, err = LoadLibrary(filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, lib)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.md"), []byte("---\nbroken"), 0o600))
+	_, err = LoadLibrary(dir)
+	require.ErrorContains(t, err, "broken.md")
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "task.md")
+	require.NoError(t, os.WriteFile(path, []byte("---\nopenai.enabled: true\n---\nsummarize"), 0o600))
+	f, err := LoadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, File{Text: "summarize", Args: []string{"--openai.enabled"}}, f)
+
+	_, err = LoadFile(filepath.Join(t.TempDir(), "missing.md"))
+	require.ErrorContains(t, err, "failed to read prompt file")
+
+	require.NoError(t, os.WriteFile(path, []byte("---\nbroken"), 0o600))
+	_, err = LoadFile(path)
+	require.ErrorContains(t, err, "invalid prompt file "+path)
+}
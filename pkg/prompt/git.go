@@ -1,10 +1,13 @@
 package prompt
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
@@ -44,10 +47,16 @@ func (e *defaultGitExecutor) CommandRun(cmd *exec.Cmd) error {
 // default executor instance
 var executor GitExecutor = &defaultGitExecutor{}
 
+// NewGitExecutor returns the executor running git commands of the system
+func NewGitExecutor() GitExecutor {
+	return executor
+}
+
 // gitDiffer handles git diff operations and temporary file management
 type gitDiffer struct {
 	executor GitExecutor
 	tempDir  string
+	dir      string // directory git commands run in, current directory if empty
 }
 
 // newGitDiffer creates a new gitDiffer with the default executor (for internal use)
@@ -74,6 +83,23 @@ func NewGitDiffer() GitDiffProcessor {
 	return newGitDiffer()
 }
 
+// NewGitDifferIn creates a new GitDiffProcessor running git commands in the given directory,
+// the current directory if dir is empty
+func NewGitDifferIn(dir string) GitDiffProcessor {
+	g := newGitDiffer()
+	g.dir = dir
+	return g
+}
+
+// git makes a git command with the given arguments, running in the directory of the differ
+func (g *gitDiffer) git(args ...string) *exec.Cmd {
+	cmd := g.executor.Command("git", args...)
+	if cmd != nil && g.dir != "" {
+		cmd.Dir = g.dir
+	}
+	return cmd
+}
+
 // Cleanup removes the temporary directory and all its contents
 func (g *gitDiffer) Cleanup() {
 	// skip if temp dir was never created
@@ -111,6 +137,11 @@ func (g *gitDiffer) TryBranchDiff() (tempFile, description string, err error) {
 		}
 	}
 
+	// detached HEAD has no branch to compare, this is reported instead of an empty diff
+	if currentBranch == "" && g.isDetachedHead() {
+		return "", "", fmt.Errorf("HEAD is detached, no branch to compare with %s", defaultBranch)
+	}
+
 	// check if we're on a different branch from the default
 	if currentBranch == "" || defaultBranch == "" || currentBranch == defaultBranch {
 		return "", "", nil
@@ -153,7 +184,7 @@ func (g *gitDiffer) ProcessGitDiff(isDiff bool, branchName string) (tempFilePath
 	switch {
 	case isDiff:
 		// get uncommitted changes
-		diffCmd = g.executor.Command("git", "diff")
+		diffCmd = g.git("diff")
 		diffDescription = "git diff (uncommitted changes)"
 
 	case branchName != "":
@@ -165,14 +196,14 @@ func (g *gitDiffer) ProcessGitDiff(isDiff bool, branchName string) (tempFilePath
 			return "", "", fmt.Errorf("invalid branch name: %s", branchName)
 		}
 		// use separate args for diff command with branch comparison
-		diffCmd = g.executor.Command("git", "diff", defaultBranch+"..."+sanitizedBranch) // #nosec G204 - sanitizeBranchName ensures the input is safe
+		diffCmd = g.git("diff", defaultBranch+"..."+sanitizedBranch) // #nosec G204 - sanitizeBranchName ensures the input is safe
 		diffDescription = fmt.Sprintf("git diff between %s and %s branches", defaultBranch, sanitizedBranch)
 	}
 
 	// execute the git command and capture output
 	diffOutput, err := g.executor.CommandOutput(diffCmd)
 	if err != nil {
-		return "", "", fmt.Errorf("git command failed: %w", err)
+		return "", "", fmt.Errorf("git command failed: %w", g.explainError(err))
 	}
 
 	// skip if no differences found
@@ -190,11 +221,138 @@ func (g *gitDiffer) ProcessGitDiff(isDiff bool, branchName string) (tempFilePath
 	return tempFile, diffDescription, nil
 }
 
+// ProcessGitBlame writes annotated git blame output of the file to a temporary file and returns its path.
+// The file is resolved against the directory git commands run in.
+func (g *gitDiffer) ProcessGitBlame(file string) (tempFilePath, description string, err error) {
+	if file == "" {
+		return "", "", fmt.Errorf("file for git blame is not set")
+	}
+	// "--" separates the file from options, so names starting with a dash are not treated as flags
+	cmd := g.git("blame", "--date=short", "--", file)
+	return g.writeGitOutput(cmd, "blame", fmt.Sprintf("git blame of %s", file))
+}
+
+// ProcessGitLog writes messages of the last count commits to a temporary file and returns its path
+func (g *gitDiffer) ProcessGitLog(count int) (tempFilePath, description string, err error) {
+	if count <= 0 {
+		return "", "", fmt.Errorf("invalid number of commits for git log: %d", count)
+	}
+	cmd := g.git("log", "--no-decorate", "--date=short", "-n", strconv.Itoa(count))
+	return g.writeGitOutput(cmd, "log", fmt.Sprintf("git log of the last %d commits", count))
+}
+
+// ChangedFiles returns absolute paths of files changed since the merge base of the ref and HEAD, including
+// uncommitted changes and untracked files not ignored by git. Deleted files are skipped.
+func (g *gitDiffer) ChangedFiles(ref string) ([]string, error) {
+	// ancestry suffixes like HEAD~3 or v1.2^ are allowed in addition to characters of branch names
+	if ref == "" || strings.HasPrefix(ref, "-") || !g.isSafeRef(strings.NewReplacer("~", "", "^", "").Replace(ref)) {
+		return nil, fmt.Errorf("invalid git ref %q", ref)
+	}
+	if _, err := g.executor.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git executable not found: %w", err)
+	}
+
+	base, err := g.executor.CommandOutput(g.git("merge-base", ref, "HEAD")) // #nosec G204 - ref is validated above
+	if err != nil {
+		return nil, fmt.Errorf("failed to find merge base of %s and HEAD: %w", ref, g.explainError(err))
+	}
+	top, err := g.executor.CommandOutput(g.git("rev-parse", "--show-toplevel"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find top level of git repository: %w", g.explainError(err))
+	}
+	changed, err := g.executor.CommandOutput(g.git("diff", "--name-only", "-z", "--diff-filter=d",
+		strings.TrimSpace(string(base)), "--")) // #nosec G204 - merge base is a commit hash returned by git
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files changed since %s: %w", ref, g.explainError(err))
+	}
+	untracked, err := g.executor.CommandOutput(g.git("ls-files", "-z", "--others", "--exclude-standard", "--full-name",
+		"--", ":/"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list untracked files: %w", g.explainError(err))
+	}
+
+	root := strings.TrimSpace(string(top))
+	var res []string
+	for _, name := range strings.Split(string(changed)+string(untracked), "\x00") {
+		if name != "" {
+			res = append(res, filepath.Join(root, filepath.FromSlash(name)))
+		}
+	}
+	lgr.Printf("[DEBUG] %d files changed since %s", len(res), ref)
+	return res, nil
+}
+
+// isSafeRef checks the ref has only characters allowed in branch names, see sanitizeBranchName
+func (g *gitDiffer) isSafeRef(ref string) bool {
+	for _, c := range ref {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '-' && c != '_' && c != '.' && c != '/' {
+			return false
+		}
+	}
+	return ref != ""
+}
+
+// writeGitOutput runs the git command and writes its output to a temporary file named after kind.
+// Empty output is skipped, with empty file path returned.
+func (g *gitDiffer) writeGitOutput(cmd *exec.Cmd, kind, description string) (tempFilePath, desc string, err error) {
+	if g.tempDir == "" {
+		return "", "", fmt.Errorf("temp directory not available")
+	}
+	if _, err := g.executor.LookPath("git"); err != nil {
+		return "", "", fmt.Errorf("git executable not found: %w", err)
+	}
+
+	output, err := g.executor.CommandOutput(cmd)
+	if err != nil {
+		return "", "", fmt.Errorf("git %s failed: %w", kind, g.explainError(err))
+	}
+	if len(output) == 0 {
+		lgr.Printf("[INFO] empty git %s output, skipping git context", kind)
+		return "", "", nil
+	}
+
+	tempFile := filepath.Join(g.tempDir, fmt.Sprintf("mpt-git-%s-%s.txt", kind, time.Now().Format("20060102-150405")))
+	if err := os.WriteFile(tempFile, output, 0o600); err != nil {
+		return "", "", fmt.Errorf("failed to write git %s to temporary file: %w", kind, err)
+	}
+	lgr.Printf("[INFO] wrote git %s to temporary file: %s", kind, tempFile)
+	return tempFile, description, nil
+}
+
+// explainError adds the error output of the failed git command to the error, and tells apart
+// directories which are not git repositories and bare repositories without working tree
+func (g *gitDiffer) explainError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(bytes.TrimSpace(exitErr.Stderr)) > 0 {
+		err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(exitErr.Stderr))
+	}
+
+	repo := g.dir
+	if repo == "" {
+		repo = "current directory"
+	}
+	bare, revErr := g.executor.CommandOutput(g.git("rev-parse", "--is-bare-repository"))
+	switch {
+	case revErr != nil:
+		return fmt.Errorf("%s is not a git repository: %w", repo, err)
+	case strings.TrimSpace(string(bare)) == "true":
+		return fmt.Errorf("%s is a bare git repository without working tree: %w", repo, err)
+	}
+	return err
+}
+
+// isDetachedHead checks if HEAD points to a commit rather than to a branch
+func (g *gitDiffer) isDetachedHead() bool {
+	cmd := g.git("rev-parse", "--abbrev-ref", "HEAD")
+	ref, err := g.getCommandOutputTrimmed(cmd, "failed to check for detached HEAD")
+	return err == nil && ref == "HEAD"
+}
+
 // getDefaultBranch tries to determine the default branch (main or master) for the repository.
 // It first checks git config for init.defaultBranch, then looks for main, and finally falls back to master.
 func (g *gitDiffer) getDefaultBranch() string {
 	// try to get the default branch from git config
-	cmd := g.executor.Command("git", "config", "--get", "init.defaultBranch")
+	cmd := g.git("config", "--get", "init.defaultBranch")
 	defaultBranch, err := g.getCommandOutputTrimmed(cmd, "failed to get default branch from git config")
 	if err == nil && defaultBranch != "" && g.checkBranchExists(defaultBranch) {
 		return defaultBranch
@@ -211,7 +369,7 @@ func (g *gitDiffer) getDefaultBranch() string {
 
 // checkBranchExists checks if a branch exists in the repository
 func (g *gitDiffer) checkBranchExists(branch string) bool {
-	cmd := g.executor.Command("git", "rev-parse", "--verify", branch)
+	cmd := g.git("rev-parse", "--verify", branch)
 	return g.executor.CommandRun(cmd) == nil
 }
 
@@ -221,14 +379,14 @@ func (g *gitDiffer) checkBranchExists(branch string) bool {
 // Returns an empty string if the current branch cannot be determined.
 func (g *gitDiffer) getCurrentBranch() string {
 	// try modern git version first
-	cmd := g.executor.Command("git", "branch", "--show-current")
+	cmd := g.git("branch", "--show-current")
 	output, err := g.getCommandOutputTrimmed(cmd, "failed to get current git branch using --show-current")
 	if err == nil {
 		return output
 	}
 
 	// fallback to older git versions that don't have --show-current
-	cmd = g.executor.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
+	cmd = g.git("rev-parse", "--abbrev-ref", "HEAD")
 	output, err = g.getCommandOutputTrimmed(cmd, "failed to get current git branch using rev-parse fallback")
 	if err != nil {
 		return ""
@@ -265,12 +423,12 @@ func (g *gitDiffer) sanitizeBranchName(branch string) string {
 func (g *gitDiffer) isValidGitRef(ref string) bool {
 	// use array-based command construction to avoid shell injection
 	// this ensures arguments are properly escaped
-	cmdLocal := g.executor.Command("git", "show-ref", "--verify", "--quiet", "refs/heads/"+ref)
+	cmdLocal := g.git("show-ref", "--verify", "--quiet", "refs/heads/"+ref)
 	if g.executor.CommandRun(cmdLocal) == nil {
 		return true
 	}
 
 	// also check if it's a valid remote branch, still using array-based construction
-	cmdRemote := g.executor.Command("git", "show-ref", "--verify", "--quiet", "refs/remotes/"+ref)
+	cmdRemote := g.git("show-ref", "--verify", "--quiet", "refs/remotes/"+ref)
 	return g.executor.CommandRun(cmdRemote) == nil
 }
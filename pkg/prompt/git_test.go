@@ -126,6 +126,22 @@ func TestGitDiffer_GetDefaultBranch(t *testing.T) {
 	})
 }
 
+func TestGitDiffer_Dir(t *testing.T) {
+	origExecutor := executor
+	defer func() { executor = origExecutor }()
+	executor = &mocks.GitExecutorMock{
+		CommandFunc: func(name string, args ...string) *exec.Cmd { return exec.Command(name, args...) },
+	}
+
+	differ := NewGitDifferIn("/src/project").(*gitDiffer)
+	defer differ.Cleanup()
+	assert.Equal(t, "/src/project", differ.git("diff").Dir)
+
+	current := newGitDiffer()
+	defer current.Cleanup()
+	assert.Empty(t, current.git("diff").Dir, "current directory if not set")
+}
+
 func TestGitDiffer_CheckBranchExists(t *testing.T) {
 	origExecutor := executor
 	defer func() { executor = origExecutor }()
@@ -1016,3 +1032,195 @@ func TestGitDiffer_TempDirFailure(t *testing.T) {
 		assert.True(t, os.IsNotExist(err), "temp directory should be removed")
 	})
 }
+
+func TestGitDiffer_ProcessGitBlameAndLog(t *testing.T) {
+	newMock := func(output []byte, err error) *mocks.GitExecutorMock {
+		return &mocks.GitExecutorMock{
+			LookPathFunc: func(file string) (string, error) { return "/usr/bin/git", nil },
+			CommandFunc: func(name string, args ...string) *exec.Cmd {
+				return exec.Command("echo", "test")
+			},
+			CommandOutputFunc: func(cmd *exec.Cmd) ([]byte, error) { return output, err },
+		}
+	}
+
+	t.Run("blame", func(t *testing.T) {
+		mockExec := newMock([]byte("abc123 (user 2024-01-01 1) package main"), nil)
+		differ := &gitDiffer{executor: mockExec, tempDir: t.TempDir()}
+		tempFile, desc, err := differ.ProcessGitBlame("main.go")
+		require.NoError(t, err)
+		assert.Equal(t, "git blame of main.go", desc)
+		data, err := os.ReadFile(tempFile)
+		require.NoError(t, err)
+		assert.Equal(t, "abc123 (user 2024-01-01 1) package main", string(data))
+		require.Len(t, mockExec.CommandCalls(), 1)
+		assert.Equal(t, []string{"blame", "--date=short", "--", "main.go"}, mockExec.CommandCalls()[0].Args)
+	})
+
+	t.Run("log", func(t *testing.T) {
+		mockExec := newMock([]byte("commit abc123\n\n    fix retries"), nil)
+		differ := &gitDiffer{executor: mockExec, tempDir: t.TempDir()}
+		tempFile, desc, err := differ.ProcessGitLog(5)
+		require.NoError(t, err)
+		assert.Equal(t, "git log of the last 5 commits", desc)
+		assert.Contains(t, filepath.Base(tempFile), "mpt-git-log-")
+		require.Len(t, mockExec.CommandCalls(), 1)
+		assert.Equal(t, []string{"log", "--no-decorate", "--date=short", "-n", "5"}, mockExec.CommandCalls()[0].Args)
+	})
+
+	t.Run("empty output", func(t *testing.T) {
+		differ := &gitDiffer{executor: newMock(nil, nil), tempDir: t.TempDir()}
+		tempFile, desc, err := differ.ProcessGitLog(3)
+		require.NoError(t, err)
+		assert.Empty(t, tempFile)
+		assert.Empty(t, desc)
+	})
+
+	t.Run("command failed", func(t *testing.T) {
+		mockExec := newMock(nil, errors.New("no such path"))
+		mockExec.CommandFunc = func(name string, args ...string) *exec.Cmd { return exec.Command(name, args...) }
+		mockExec.CommandOutputFunc = func(cmd *exec.Cmd) ([]byte, error) {
+			if cmd.Args[1] == "rev-parse" {
+				return []byte("false\n"), nil
+			}
+			return nil, errors.New("no such path")
+		}
+		differ := &gitDiffer{executor: mockExec, tempDir: t.TempDir()}
+		_, _, err := differ.ProcessGitBlame("missing.go")
+		require.EqualError(t, err, "git blame failed: no such path")
+
+		differ.executor = newMock(nil, errors.New("no such path"))
+		_, _, err = differ.ProcessGitBlame("missing.go")
+		require.EqualError(t, err, "git blame failed: current directory is not a git repository: no such path")
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		differ := &gitDiffer{executor: newMock(nil, nil), tempDir: t.TempDir()}
+		_, _, err := differ.ProcessGitBlame("")
+		require.ErrorContains(t, err, "file for git blame is not set")
+		_, _, err = differ.ProcessGitLog(0)
+		require.ErrorContains(t, err, "invalid number of commits for git log: 0")
+	})
+
+	t.Run("invalid changed since ref", func(t *testing.T) {
+		differ := &gitDiffer{executor: newMock(nil, nil), tempDir: t.TempDir()}
+		for _, ref := range []string{"", "--output=/tmp/x", "main;rm", "a b"} {
+			_, err := differ.ChangedFiles(ref)
+			require.ErrorContains(t, err, "invalid git ref", ref)
+		}
+	})
+
+	t.Run("no temp dir", func(t *testing.T) {
+		differ := &gitDiffer{executor: newMock(nil, nil)}
+		_, _, err := differ.ProcessGitLog(1)
+		require.ErrorContains(t, err, "temp directory not available")
+	})
+}
+
+func TestGitDiffer_Repositories(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	origExecutor := executor
+	defer func() { executor = origExecutor }()
+	executor = &defaultGitExecutor{}
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	run := func(dir string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+
+	base := t.TempDir()
+	repo := filepath.Join(base, "repo")
+	require.NoError(t, os.Mkdir(repo, 0o750))
+	run(repo, "init", "-q", "-b", "main")
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n"), 0o600))
+	run(repo, "add", ".")
+	run(repo, "commit", "-q", "-m", "initial commit")
+
+	t.Run("worktree", func(t *testing.T) {
+		wt := filepath.Join(base, "wt")
+		run(repo, "worktree", "add", "-q", "-b", "feature", wt)
+		require.NoError(t, os.WriteFile(filepath.Join(wt, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o600))
+
+		differ := NewGitDifferIn(wt).(*gitDiffer)
+		defer differ.Cleanup()
+		tempFile, _, err := differ.ProcessGitDiff(true, "")
+		require.NoError(t, err)
+		data, err := os.ReadFile(tempFile)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "+func main() {}")
+
+		run(wt, "commit", "-q", "-am", "add main")
+		tempFile, desc, err := differ.TryBranchDiff()
+		require.NoError(t, err)
+		assert.Equal(t, "git diff between main and feature branches", desc)
+		assert.FileExists(t, tempFile)
+	})
+
+	t.Run("bare repository", func(t *testing.T) {
+		bare := filepath.Join(base, "bare.git")
+		run(base, "clone", "-q", "--bare", repo, bare)
+
+		differ := NewGitDifferIn(bare).(*gitDiffer)
+		defer differ.Cleanup()
+		_, _, err := differ.ProcessGitDiff(true, "")
+		require.ErrorContains(t, err, bare+" is a bare git repository without working tree")
+
+		tempFile, _, err := differ.ProcessGitLog(1)
+		require.NoError(t, err, "log works without working tree")
+		data, err := os.ReadFile(tempFile)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "initial commit")
+	})
+
+	t.Run("detached head", func(t *testing.T) {
+		detached := filepath.Join(base, "detached")
+		run(repo, "worktree", "add", "-q", "--detach", detached, "main")
+
+		differ := NewGitDifferIn(detached).(*gitDiffer)
+		defer differ.Cleanup()
+		_, _, err := differ.TryBranchDiff()
+		require.ErrorContains(t, err, "HEAD is detached, no branch to compare with main")
+	})
+
+	t.Run("changed files", func(t *testing.T) {
+		wt := filepath.Join(base, "changed")
+		run(repo, "worktree", "add", "-q", "-b", "changed", wt)
+		require.NoError(t, os.MkdirAll(filepath.Join(wt, "pkg"), 0o750))
+		require.NoError(t, os.WriteFile(filepath.Join(wt, "pkg", "committed.go"), []byte("package pkg\n"), 0o600))
+		run(wt, "add", ".")
+		run(wt, "commit", "-q", "-m", "add pkg")
+		require.NoError(t, os.WriteFile(filepath.Join(wt, "main.go"), []byte("package main\n\n// changed\n"), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(wt, "pkg", "untracked.go"), []byte("package pkg\n"), 0o600))
+
+		differ := NewGitDifferIn(filepath.Join(wt, "pkg")).(*gitDiffer)
+		defer differ.Cleanup()
+		changed, err := differ.ChangedFiles("main")
+		require.NoError(t, err)
+		root, err := filepath.EvalSymlinks(wt)
+		require.NoError(t, err)
+		for i, f := range changed {
+			resolved, err := filepath.EvalSymlinks(f)
+			require.NoError(t, err)
+			changed[i] = resolved
+		}
+		assert.ElementsMatch(t, []string{filepath.Join(root, "main.go"), filepath.Join(root, "pkg", "committed.go"),
+			filepath.Join(root, "pkg", "untracked.go")}, changed)
+
+		_, err = differ.ChangedFiles("no-such-ref")
+		require.ErrorContains(t, err, "failed to find merge base of no-such-ref and HEAD")
+	})
+
+	t.Run("not a repository", func(t *testing.T) {
+		differ := NewGitDifferIn(t.TempDir()).(*gitDiffer)
+		defer differ.Cleanup()
+		_, _, err := differ.ProcessGitLog(1)
+		require.ErrorContains(t, err, "is not a git repository")
+	})
+}
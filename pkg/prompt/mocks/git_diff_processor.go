@@ -13,12 +13,21 @@ import (
 //
 //		// make and configure a mocked prompt.GitDiffProcessor
 //		mockedGitDiffProcessor := &GitDiffProcessorMock{
+//			ChangedFilesFunc: func(ref string) ([]string, error) {
+//				panic("mock out the ChangedFiles method")
+//			},
 //			CleanupFunc: func()  {
 //				panic("mock out the Cleanup method")
 //			},
+//			ProcessGitBlameFunc: func(file string) (string, string, error) {
+//				panic("mock out the ProcessGitBlame method")
+//			},
 //			ProcessGitDiffFunc: func(isDiff bool, branchName string) (string, string, error) {
 //				panic("mock out the ProcessGitDiff method")
 //			},
+//			ProcessGitLogFunc: func(count int) (string, string, error) {
+//				panic("mock out the ProcessGitLog method")
+//			},
 //			TryBranchDiffFunc: func() (string, string, error) {
 //				panic("mock out the TryBranchDiff method")
 //			},
@@ -29,20 +38,39 @@ import (
 //
 //	}
 type GitDiffProcessorMock struct {
+	// ChangedFilesFunc mocks the ChangedFiles method.
+	ChangedFilesFunc func(ref string) ([]string, error)
+
 	// CleanupFunc mocks the Cleanup method.
 	CleanupFunc func()
 
+	// ProcessGitBlameFunc mocks the ProcessGitBlame method.
+	ProcessGitBlameFunc func(file string) (string, string, error)
+
 	// ProcessGitDiffFunc mocks the ProcessGitDiff method.
 	ProcessGitDiffFunc func(isDiff bool, branchName string) (string, string, error)
 
+	// ProcessGitLogFunc mocks the ProcessGitLog method.
+	ProcessGitLogFunc func(count int) (string, string, error)
+
 	// TryBranchDiffFunc mocks the TryBranchDiff method.
 	TryBranchDiffFunc func() (string, string, error)
 
 	// calls tracks calls to the methods.
 	calls struct {
+		// ChangedFiles holds details about calls to the ChangedFiles method.
+		ChangedFiles []struct {
+			// Ref is the ref argument value.
+			Ref string
+		}
 		// Cleanup holds details about calls to the Cleanup method.
 		Cleanup []struct {
 		}
+		// ProcessGitBlame holds details about calls to the ProcessGitBlame method.
+		ProcessGitBlame []struct {
+			// File is the file argument value.
+			File string
+		}
 		// ProcessGitDiff holds details about calls to the ProcessGitDiff method.
 		ProcessGitDiff []struct {
 			// IsDiff is the isDiff argument value.
@@ -50,13 +78,53 @@ type GitDiffProcessorMock struct {
 			// BranchName is the branchName argument value.
 			BranchName string
 		}
+		// ProcessGitLog holds details about calls to the ProcessGitLog method.
+		ProcessGitLog []struct {
+			// Count is the count argument value.
+			Count int
+		}
 		// TryBranchDiff holds details about calls to the TryBranchDiff method.
 		TryBranchDiff []struct {
 		}
 	}
-	lockCleanup        sync.RWMutex
-	lockProcessGitDiff sync.RWMutex
-	lockTryBranchDiff  sync.RWMutex
+	lockChangedFiles    sync.RWMutex
+	lockCleanup         sync.RWMutex
+	lockProcessGitBlame sync.RWMutex
+	lockProcessGitDiff  sync.RWMutex
+	lockProcessGitLog   sync.RWMutex
+	lockTryBranchDiff   sync.RWMutex
+}
+
+// ChangedFiles calls ChangedFilesFunc.
+func (mock *GitDiffProcessorMock) ChangedFiles(ref string) ([]string, error) {
+	if mock.ChangedFilesFunc == nil {
+		panic("GitDiffProcessorMock.ChangedFilesFunc: method is nil but GitDiffProcessor.ChangedFiles was just called")
+	}
+	callInfo := struct {
+		Ref string
+	}{
+		Ref: ref,
+	}
+	mock.lockChangedFiles.Lock()
+	mock.calls.ChangedFiles = append(mock.calls.ChangedFiles, callInfo)
+	mock.lockChangedFiles.Unlock()
+	return mock.ChangedFilesFunc(ref)
+}
+
+// ChangedFilesCalls gets all the calls that were made to ChangedFiles.
+// Check the length with:
+//
+//	len(mockedGitDiffProcessor.ChangedFilesCalls())
+func (mock *GitDiffProcessorMock) ChangedFilesCalls() []struct {
+	Ref string
+} {
+	var calls []struct {
+		Ref string
+	}
+	mock.lockChangedFiles.RLock()
+	calls = mock.calls.ChangedFiles
+	mock.lockChangedFiles.RUnlock()
+	return calls
 }
 
 // Cleanup calls CleanupFunc.
@@ -86,6 +154,38 @@ func (mock *GitDiffProcessorMock) CleanupCalls() []struct {
 	return calls
 }
 
+// ProcessGitBlame calls ProcessGitBlameFunc.
+func (mock *GitDiffProcessorMock) ProcessGitBlame(file string) (string, string, error) {
+	if mock.ProcessGitBlameFunc == nil {
+		panic("GitDiffProcessorMock.ProcessGitBlameFunc: method is nil but GitDiffProcessor.ProcessGitBlame was just called")
+	}
+	callInfo := struct {
+		File string
+	}{
+		File: file,
+	}
+	mock.lockProcessGitBlame.Lock()
+	mock.calls.ProcessGitBlame = append(mock.calls.ProcessGitBlame, callInfo)
+	mock.lockProcessGitBlame.Unlock()
+	return mock.ProcessGitBlameFunc(file)
+}
+
+// ProcessGitBlameCalls gets all the calls that were made to ProcessGitBlame.
+// Check the length with:
+//
+//	len(mockedGitDiffProcessor.ProcessGitBlameCalls())
+func (mock *GitDiffProcessorMock) ProcessGitBlameCalls() []struct {
+	File string
+} {
+	var calls []struct {
+		File string
+	}
+	mock.lockProcessGitBlame.RLock()
+	calls = mock.calls.ProcessGitBlame
+	mock.lockProcessGitBlame.RUnlock()
+	return calls
+}
+
 // ProcessGitDiff calls ProcessGitDiffFunc.
 func (mock *GitDiffProcessorMock) ProcessGitDiff(isDiff bool, branchName string) (string, string, error) {
 	if mock.ProcessGitDiffFunc == nil {
@@ -122,6 +222,38 @@ func (mock *GitDiffProcessorMock) ProcessGitDiffCalls() []struct {
 	return calls
 }
 
+// ProcessGitLog calls ProcessGitLogFunc.
+func (mock *GitDiffProcessorMock) ProcessGitLog(count int) (string, string, error) {
+	if mock.ProcessGitLogFunc == nil {
+		panic("GitDiffProcessorMock.ProcessGitLogFunc: method is nil but GitDiffProcessor.ProcessGitLog was just called")
+	}
+	callInfo := struct {
+		Count int
+	}{
+		Count: count,
+	}
+	mock.lockProcessGitLog.Lock()
+	mock.calls.ProcessGitLog = append(mock.calls.ProcessGitLog, callInfo)
+	mock.lockProcessGitLog.Unlock()
+	return mock.ProcessGitLogFunc(count)
+}
+
+// ProcessGitLogCalls gets all the calls that were made to ProcessGitLog.
+// Check the length with:
+//
+//	len(mockedGitDiffProcessor.ProcessGitLogCalls())
+func (mock *GitDiffProcessorMock) ProcessGitLogCalls() []struct {
+	Count int
+} {
+	var calls []struct {
+		Count int
+	}
+	mock.lockProcessGitLog.RLock()
+	calls = mock.calls.ProcessGitLog
+	mock.lockProcessGitLog.RUnlock()
+	return calls
+}
+
 // TryBranchDiff calls TryBranchDiffFunc.
 func (mock *GitDiffProcessorMock) TryBranchDiff() (string, string, error) {
 	if mock.TryBranchDiffFunc == nil {
@@ -0,0 +1,113 @@
+package prompt
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/umputun/mpt/pkg/files"
+)
+
+// Parts are parts of the prompt made by BuildParts, before they are combined into the prompt text.
+// Frontends can render or send the parts separately, or combine them with Format.
+type Parts struct {
+	Text     string       // prompt text with template functions expanded and git context described, without input
+	Input    string       // piped input, appended to the text as is
+	Files    []files.File // contents of matched files, or of their relevant chunks
+	Git      []files.File // git diff, blame and log included as context
+	Env      string       // snapshot of the runtime environment included as context, see Builder.WithEnvironment
+	Position string       // where files and git context are placed relative to the text, see ValidatePosition
+}
+
+// BuildParts builds the prompt like BuildContext, but returns its parts instead of the combined text,
+// e.g. for a dry run showing what is sent to providers. Like BuildContext, it trims context sources to fit
+// the budget and removes temporary files of git context, so the builder can't be built again.
+func (b *Builder) BuildParts(ctx context.Context) (Parts, error) {
+	if b.gitDiffer != nil {
+		defer b.gitDiffer.Cleanup()
+	}
+
+	res, err := b.parts(ctx)
+	if err != nil {
+		return Parts{}, err
+	}
+	b.trims = res.fit(b.budget)
+	if b.sizing {
+		b.sizes = fileSizes(res.Files, res.Git, res.Env)
+	}
+	return res, nil
+}
+
+// parts returns parts of the prompt with matched files split into files and git context
+func (b *Builder) parts(ctx context.Context) (Parts, error) {
+	text, err := b.text(ctx)
+	if err != nil {
+		return Parts{}, err
+	}
+	res := Parts{Text: text, Input: b.input, Env: b.environment, Position: b.position}
+	if len(b.files) == 0 {
+		return res, nil
+	}
+
+	loaded, err := b.loadFileParts(ctx)
+	if err != nil {
+		return Parts{}, fmt.Errorf("failed to load files: %w", err)
+	}
+	res.Files, res.Git = b.splitGit(loaded)
+	return res, nil
+}
+
+// splitGit splits loaded files into matched files and temporary files of git context
+func (b *Builder) splitGit(loaded []files.File) (ff, git []files.File) {
+	for _, f := range loaded {
+		if slices.ContainsFunc(b.gitFiles, func(g string) bool { return filepath.Clean(g) == filepath.Clean(f.Path) }) {
+			git = append(git, f)
+			continue
+		}
+		ff = append(ff, f)
+	}
+	return ff, git
+}
+
+// loadFileParts loads all matched files, or only relevant chunks if relevance filtering is enabled
+func (b *Builder) loadFileParts(ctx context.Context) ([]files.File, error) {
+	if b.relevance == nil {
+		return files.LoadFiles(ctx, b.loadRequest())
+	}
+	chunks, err := b.relevantChunks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return files.ChunkFiles(chunks, b.dir)
+}
+
+// Format combines the parts into the prompt text with files and git context wrapped by the wrapper, the same
+// way as the builder does, except that files always precede git context, followed by the environment
+func (p Parts) Format(wrapper files.Wrapper) (string, error) {
+	text := p.Text
+	if p.Input != "" {
+		text = CombineWithInput(text, p.Input)
+	}
+	content := strings.TrimRight(files.FormatFiles(slices.Concat(p.Files, p.Git, environmentFiles(p.Env)), wrapper), "\n")
+	if content == "" {
+		return strings.TrimSpace(text), nil
+	}
+	res, err := placeContext(p.Position, text, content)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(res), nil
+}
+
+// environmentName is the name of the environment snapshot in the context
+const environmentName = "environment"
+
+// environmentFiles returns the environment snapshot as a context file, none if the snapshot is empty
+func environmentFiles(snapshot string) []files.File {
+	if snapshot == "" {
+		return nil
+	}
+	return []files.File{{Name: environmentName, Content: snapshot}}
+}
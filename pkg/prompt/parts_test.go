@@ -0,0 +1,84 @@
+package prompt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/files"
+	"github.com/umputun/mpt/pkg/prompt/mocks"
+)
+
+func TestBuilder_BuildParts(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "util.go"), []byte("package util\n"), 0o600))
+	diffFile := filepath.Join(t.TempDir(), "diff.txt")
+	require.NoError(t, os.WriteFile(diffFile, []byte("+added line\n"), 0o600))
+
+	cleanups := 0
+	differ := &mocks.GitDiffProcessorMock{
+		ProcessGitDiffFunc: func(bool, string) (string, string, error) { return diffFile, "git diff", nil },
+		CleanupFunc:        func() { cleanups++ },
+	}
+
+	t.Run("all parts", func(t *testing.T) {
+		b, err := New(`review {{file "util.go"}}`, differ).WithDir(dir).WithTemplate(true).WithInput("{{piped}}").
+			WithFiles([]string{"main.go"}).WithContextPosition(PositionBefore).WithGitDiff()
+		require.NoError(t, err)
+		parts, err := b.BuildParts(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, cleanups)
+
+		assert.Equal(t, "I'm providing git diff for context.\n\nreview // file: util.go\npackage util", parts.Text)
+		assert.Equal(t, "{{piped}}", parts.Input)
+		assert.Equal(t, PositionBefore, parts.Position)
+		assert.Equal(t, []files.File{{Path: filepath.Join(dir, "main.go"), Name: "main.go", Content: "package main\n"}},
+			parts.Files)
+		require.Len(t, parts.Git, 1)
+		assert.Equal(t, diffFile, parts.Git[0].Path)
+		assert.Equal(t, "+added line\n", parts.Git[0].Content)
+
+		text, err := parts.Format(files.WrapperXML)
+		require.NoError(t, err)
+		assert.Contains(t, text, "<file path=\"main.go\">\npackage main\n</file>\n\n<file path=")
+		assert.Contains(t, text, "+added line\n</file>\n\nI'm providing git diff for context.")
+		assert.True(t, strings.HasSuffix(text, "package util\n{{piped}}"), "input appended as is")
+	})
+
+	t.Run("format same as build", func(t *testing.T) {
+		newBuilder := func() *Builder {
+			return New("review", nil).WithDir(dir).WithFiles([]string{"*.go"}).WithContextWrapper(files.WrapperMarkdown)
+		}
+		parts, err := newBuilder().BuildParts(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, parts.Git)
+		require.Len(t, parts.Files, 2)
+
+		text, err := parts.Format(files.WrapperMarkdown)
+		require.NoError(t, err)
+		built, err := newBuilder().Build()
+		require.NoError(t, err)
+		assert.Equal(t, built, text)
+	})
+
+	t.Run("text only", func(t *testing.T) {
+		parts, err := New("  just text ", nil).BuildParts(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Parts{Text: "  just text "}, parts)
+		text, err := parts.Format(files.WrapperPlain)
+		require.NoError(t, err)
+		assert.Equal(t, "just text", text)
+	})
+
+	t.Run("missing marker", func(t *testing.T) {
+		parts := Parts{Text: "review", Files: []files.File{{Name: "a.go", Content: "package a"}}, Position: "replace:@CODE@"}
+		_, err := parts.Format(files.WrapperPlain)
+		require.EqualError(t, err, `context marker "@CODE@" not found in the prompt`)
+	})
+}
@@ -0,0 +1,51 @@
+package prompt
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/umputun/mpt/pkg/files"
+	"github.com/umputun/mpt/pkg/tokens"
+)
+
+// FileSize is the size of a file, git context or the environment snapshot included in the prompt
+type FileSize struct {
+	Name   string // name of the file, with selected lines if not included completely, or "git diff" for git context
+	Bytes  int    // size of the included content, after line selection and summaries
+	Tokens int    // estimated tokens of the included content
+}
+
+// gitFileRe matches names of temporary files of git context, like mpt-git-log-20250102-150405.txt
+var gitFileRe = regexp.MustCompile(`^mpt-git-(\w+)-\d{8}-\d{6}\.txt$`)
+
+// fileSizes returns sizes of files, git context and the environment snapshot, largest first
+func fileSizes(ff, git []files.File, env string) []FileSize {
+	res := make([]FileSize, 0, len(ff)+len(git)+1)
+	add := func(name, content string) {
+		res = append(res, FileSize{Name: name, Bytes: len(content), Tokens: tokens.Estimate(content)})
+	}
+	for _, f := range ff {
+		name := f.Name
+		if f.StartLine > 0 {
+			name = fmt.Sprintf("%s:%d-%d", f.Name, f.StartLine, f.EndLine)
+		}
+		add(name, f.Content)
+	}
+	for _, f := range git {
+		name := filepath.Base(f.Name)
+		if m := gitFileRe.FindStringSubmatch(name); m != nil {
+			name = "git " + m[1]
+		}
+		add(name, f.Content)
+	}
+	if env != "" {
+		add(environmentName, env)
+	}
+	slices.SortStableFunc(res, func(a, b FileSize) int {
+		return cmp.Or(cmp.Compare(b.Tokens, a.Tokens), cmp.Compare(b.Bytes, a.Bytes))
+	})
+	return res
+}
@@ -0,0 +1,72 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/files"
+	"github.com/umputun/mpt/pkg/prompt/mocks"
+	"github.com/umputun/mpt/pkg/tokens"
+)
+
+func TestBuilder_FileSizes(t *testing.T) {
+	dir := t.TempDir()
+	small, large := "package main\n", "package store\n\n"+strings.Repeat("func f() { return }\n", 50)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte(small), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "store"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "store", "db.go"), []byte(large), 0o600))
+	want := []FileSize{
+		{Name: filepath.Join("store", "db.go"), Bytes: len(large), Tokens: tokens.Estimate(large)},
+		{Name: "environment", Bytes: 15, Tokens: tokens.Estimate("os: linux/amd64")},
+		{Name: "main.go", Bytes: len(small), Tokens: tokens.Estimate(small)},
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		b := New("review", nil).WithDir(dir).WithFiles([]string{"**/*.go"})
+		_, err := b.Build()
+		require.NoError(t, err)
+		assert.Nil(t, b.FileSizes())
+	})
+
+	t.Run("largest first", func(t *testing.T) {
+		b := New("review", nil).WithDir(dir).WithFiles([]string{"**/*.go"}).WithEnvironment("os: linux/amd64").
+			WithFileSizes(true)
+		_, err := b.Build()
+		require.NoError(t, err)
+		assert.Equal(t, want, b.FileSizes())
+	})
+
+	t.Run("with budget", func(t *testing.T) {
+		b := New("review", nil).WithDir(dir).WithFiles([]string{"**/*.go"}).WithEnvironment("os: linux/amd64").
+			WithBudget(Budget{Limit: 100000, Files: 50000}).WithFileSizes(true)
+		_, err := b.Build()
+		require.NoError(t, err)
+		assert.Equal(t, want, b.FileSizes())
+	})
+
+	t.Run("selected lines and git context", func(t *testing.T) {
+		gitFile := filepath.Join(t.TempDir(), "mpt-git-log-20250102-150405.txt")
+		require.NoError(t, os.WriteFile(gitFile, []byte("commit 1\ncommit 2\n"), 0o600))
+		differ := &mocks.GitDiffProcessorMock{
+			ProcessGitLogFunc: func(count int) (string, string, error) { return gitFile, "git log", nil },
+			CleanupFunc:       func() {},
+		}
+		b, err := New("review", differ).WithDir(dir).WithFiles([]string{"main.go:1-1"}).WithFileSizes(true).WithGitLog(2)
+		require.NoError(t, err)
+		_, err = b.Build()
+		require.NoError(t, err)
+		assert.Equal(t, []FileSize{{Name: "git log", Bytes: 18, Tokens: tokens.Estimate("commit 1\ncommit 2\n")},
+			{Name: "main.go:1-1", Bytes: 12, Tokens: tokens.Estimate("package main")}}, b.FileSizes())
+	})
+}
+
+func TestFileSizes(t *testing.T) {
+	res := fileSizes([]files.File{{Name: "a.go", Content: "abc"}, {Name: "b.go", Content: "abcdef"}},
+		[]files.File{{Name: "../tmp/mpt-git-diff-20250102-150405.txt", Content: "ab"}}, "")
+	assert.Equal(t, []string{"b.go", "a.go", "git diff"}, []string{res[0].Name, res[1].Name, res[2].Name})
+}
@@ -0,0 +1,78 @@
+package prompt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/umputun/mpt/pkg/files"
+)
+
+// expandTemplate executes the prompt text as a template with functions placing context inline:
+// {{file "path"}} and {{glob "pattern"}} insert contents of matched files with the same headers and
+// exclusions as file patterns, {{gitdiff}} inserts uncommitted changes or changes of the current branch,
+// and {{gitdiff "branch"}} changes of the branch against the default one. Arguments of the builder are referenced
+// as {{.name}}. Files are loaded with the context.
+func (b *Builder) expandTemplate(ctx context.Context, text string) (string, error) {
+	loadFiles := func(pattern string) (string, error) { return b.templateFiles(ctx, pattern) }
+	funcs := template.FuncMap{
+		"file":    loadFiles,
+		"glob":    loadFiles,
+		"gitdiff": b.templateGitDiff,
+	}
+	tmpl, err := template.New("prompt").Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid prompt template: %w", err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, b.args); err != nil {
+		return "", fmt.Errorf("failed to expand prompt template: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// templateFiles returns formatted contents of files matching the pattern, for file and glob template functions
+func (b *Builder) templateFiles(ctx context.Context, pattern string) (string, error) {
+	req := b.loadRequest()
+	req.Patterns = []string{pattern}
+	content, err := files.LoadContent(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to load %s: %w", pattern, err)
+	}
+	return strings.TrimRight(content, "\n"), nil
+}
+
+// templateGitDiff returns the git diff for gitdiff template function, uncommitted changes falling back to
+// changes of the current branch if called without arguments, or changes of the branch
+func (b *Builder) templateGitDiff(branch ...string) (string, error) {
+	if b.gitDiffer == nil {
+		return "", fmt.Errorf("git diff requested but git differ not initialized")
+	}
+	if len(branch) > 1 {
+		return "", fmt.Errorf("gitdiff accepts at most one branch, got %d", len(branch))
+	}
+
+	var tempFile string
+	var err error
+	if len(branch) == 1 {
+		tempFile, _, err = b.gitDiffer.ProcessGitDiff(false, branch[0])
+	} else {
+		tempFile, _, err = b.gitDiffer.ProcessGitDiff(true, "")
+		if err == nil && tempFile == "" {
+			tempFile, _, err = b.gitDiffer.TryBranchDiff()
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if tempFile == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(tempFile) //nolint:gosec // temporary file made by git differ
+	if err != nil {
+		return "", fmt.Errorf("failed to read git diff: %w", err)
+	}
+	return strings.TrimRight(string(data), "\n"), nil
+}
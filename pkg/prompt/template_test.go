@@ -0,0 +1,103 @@
+package prompt
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/prompt/mocks"
+)
+
+func TestBuilder_WithTemplate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "pkg", "sub"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pkg", "a.go"), []byte("package pkg"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pkg", "sub", "b.go"), []byte("package sub"), 0o600))
+	diffFile := filepath.Join(dir, "diff.txt")
+	require.NoError(t, os.WriteFile(diffFile, []byte("+added line\n"), 0o600))
+
+	t.Run("file and glob", func(t *testing.T) {
+		text := "Review this:\n{{file \"main.go\"}}\nusing these helpers:\n{{glob \"pkg/**/*.go\"}}\nFocus on errors."
+		res, err := New(text, nil).WithTemplate(true).WithDir(dir).Build()
+		require.NoError(t, err)
+		assert.Equal(t, "Review this:\n// file: main.go\npackage main\nusing these helpers:\n"+
+			"// file: pkg/a.go\npackage pkg\n\n// file: pkg/sub/b.go\npackage sub\nFocus on errors.", res)
+	})
+
+	t.Run("template with appended files", func(t *testing.T) {
+		res, err := New(`see {{file "main.go"}}`, nil).WithTemplate(true).WithDir(dir).WithFiles([]string{"pkg/a.go"}).Build()
+		require.NoError(t, err)
+		assert.Equal(t, "see // file: main.go\npackage main\n\n// file: pkg/a.go\npackage pkg", res)
+	})
+
+	t.Run("arguments", func(t *testing.T) {
+		res, err := New(`review {{file "main.go"}} focusing on {{.focus}}`, nil).WithTemplate(true).WithDir(dir).
+			WithArgs(map[string]string{"focus": "errors"}).Build()
+		require.NoError(t, err)
+		assert.Equal(t, "review // file: main.go\npackage main focusing on errors", res)
+
+		_, err = New(`focusing on {{.focus}}`, nil).WithTemplate(true).WithArgs(map[string]string{"other": "x"}).Build()
+		require.ErrorContains(t, err, `map has no entry for key "focus"`)
+	})
+
+	t.Run("input not expanded", func(t *testing.T) {
+		input := `diff with {{file "main.go"}} and {{ broken`
+		res, err := New(`review {{file "main.go"}}`, nil).WithTemplate(true).WithDir(dir).WithInput(input).Build()
+		require.NoError(t, err)
+		assert.Equal(t, "review // file: main.go\npackage main\n"+input, res)
+	})
+
+	t.Run("disabled template", func(t *testing.T) {
+		res, err := New(`keep {{file "main.go"}} as is`, nil).WithDir(dir).Build()
+		require.NoError(t, err)
+		assert.Equal(t, `keep {{file "main.go"}} as is`, res)
+	})
+
+	t.Run("gitdiff", func(t *testing.T) {
+		differ := &mocks.GitDiffProcessorMock{
+			ProcessGitDiffFunc: func(isDiff bool, branchName string) (string, string, error) {
+				if isDiff {
+					return "", "", nil // no uncommitted changes
+				}
+				assert.Equal(t, "feature", branchName)
+				return diffFile, "git diff between master and feature branches", nil
+			},
+			TryBranchDiffFunc: func() (string, string, error) { return diffFile, "branch diff", nil },
+			CleanupFunc:       func() {},
+		}
+		res, err := New("Changes:\n{{gitdiff}}\nof feature:\n{{gitdiff \"feature\"}}", differ).WithTemplate(true).Build()
+		require.NoError(t, err)
+		assert.Equal(t, "Changes:\n+added line\nof feature:\n+added line", res)
+		assert.Len(t, differ.TryBranchDiffCalls(), 1)
+		assert.Len(t, differ.CleanupCalls(), 1)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		differ := &mocks.GitDiffProcessorMock{
+			ProcessGitDiffFunc: func(bool, string) (string, string, error) { return "", "", errors.New("not a git repository") },
+			CleanupFunc:        func() {},
+		}
+		tests := []struct {
+			text string
+			err  string
+		}{
+			{`{{file "main.go"`, "invalid prompt template"},
+			{`{{unknown}}`, `function "unknown" not defined`},
+			{`{{file "missing.go"}}`, "failed to load missing.go"},
+			{`{{gitdiff}}`, "not a git repository"},
+			{`{{gitdiff "a" "b"}}`, "gitdiff accepts at most one branch, got 2"},
+		}
+		for _, tt := range tests {
+			_, err := New(tt.text, differ).WithTemplate(true).WithDir(dir).Build()
+			require.ErrorContains(t, err, tt.err, tt.text)
+		}
+
+		_, err := New(`{{gitdiff}}`, nil).WithTemplate(true).Build()
+		require.ErrorContains(t, err, "git differ not initialized")
+	})
+}
@@ -0,0 +1,99 @@
+package provenance
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// layout of the minisign secret key: signature algorithm, kdf algorithm, checksum algorithm, kdf salt,
+// kdf ops and mem limits, key id, ed25519 secret key and checksum
+const (
+	secretKeySize  = 2 + 2 + 2 + 32 + 8 + 8 + 8 + ed25519.PrivateKeySize + 32
+	secretKeyIDOff = 2 + 2 + 2 + 32 + 8 + 8
+)
+
+// Key is a minisign secret key signing outputs
+type Key struct {
+	id  [8]byte
+	key ed25519.PrivateKey
+}
+
+// LoadKey reads the minisign secret key from the file
+func LoadKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // path of the key is provided by the user
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sign key: %w", err)
+	}
+	k, err := ParseKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sign key %s: %w", path, err)
+	}
+	return k, nil
+}
+
+// ParseKey parses the minisign secret key, only keys without password (minisign -G -W) are supported
+func ParseKey(data []byte) (*Key, error) {
+	var encoded string
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "untrusted comment:") {
+			encoded = line
+			break
+		}
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key encoding: %w", err)
+	}
+	if len(raw) != secretKeySize {
+		return nil, fmt.Errorf("invalid key size %d, expected %d", len(raw), secretKeySize)
+	}
+	if string(raw[:2]) != "Ed" {
+		return nil, fmt.Errorf("unsupported signature algorithm %q", raw[:2])
+	}
+	if raw[2] != 0 || raw[3] != 0 {
+		return nil, errors.New("encrypted keys are not supported, create the key without password with minisign -G -W")
+	}
+
+	k := &Key{key: ed25519.PrivateKey(bytes.Clone(raw[secretKeyIDOff+8 : secretKeyIDOff+8+ed25519.PrivateKeySize]))}
+	copy(k.id[:], raw[secretKeyIDOff:secretKeyIDOff+8])
+	// secret key holds the seed followed by the public key, a mismatch means the key is corrupted
+	if !ed25519.NewKeyFromSeed(k.key.Seed()).Equal(k.key) {
+		return nil, errors.New("corrupted key, public part doesn't match the secret one")
+	}
+	return k, nil
+}
+
+// ID returns the key id as printed by minisign
+func (k *Key) ID() string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(k.id[:]))
+}
+
+// PublicKey returns the ed25519 public key of the key
+func (k *Key) PublicKey() ed25519.PublicKey {
+	return k.key.Public().(ed25519.PublicKey)
+}
+
+// Sign returns the minisign signature of the data with the trusted comment, verified with minisign -V.
+// The trusted comment is signed along with the signature, so it can't be altered either.
+func (k *Key) Sign(data []byte, trustedComment string) []byte {
+	sig := ed25519.Sign(k.key, data)
+	body := make([]byte, 0, 2+len(k.id)+len(sig))
+	body = append(body, "Ed"...)
+	body = append(body, k.id[:]...)
+	body = append(body, sig...)
+	global := ed25519.Sign(k.key, append(bytes.Clone(sig), trustedComment...))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "untrusted comment: signature from mpt secret key %s\n", k.ID())
+	fmt.Fprintf(&buf, "%s\n", base64.StdEncoding.EncodeToString(body))
+	fmt.Fprintf(&buf, "trusted comment: %s\n", trustedComment)
+	fmt.Fprintf(&buf, "%s\n", base64.StdEncoding.EncodeToString(global))
+	return buf.Bytes()
+}
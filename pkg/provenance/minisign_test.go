@@ -0,0 +1,97 @@
+package provenance
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// secretKeyFile makes the unencrypted minisign secret key file for the seed and key id
+func secretKeyFile(t *testing.T, seed byte, id []byte) []byte {
+	t.Helper()
+	raw := make([]byte, 0, secretKeySize)
+	raw = append(raw, "Ed"...)
+	raw = append(raw, 0, 0)
+	raw = append(raw, "B2"...)
+	raw = append(raw, make([]byte, 32+8+8)...)
+	raw = append(raw, id...)
+	raw = append(raw, ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))...)
+	raw = append(raw, make([]byte, 32)...)
+	return []byte("untrusted comment: minisign secret key\n" + base64.StdEncoding.EncodeToString(raw) + "\n")
+}
+
+func TestKey_Sign(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mpt.key")
+	require.NoError(t, os.WriteFile(path, secretKeyFile(t, 1, []byte{1, 2, 3, 4, 5, 6, 7, 8}), 0o600))
+	k, err := LoadKey(path)
+	require.NoError(t, err)
+	assert.Equal(t, "0807060504030201", k.ID())
+
+	data := []byte(`{"final":"answer"}`)
+	lines := strings.Split(strings.TrimSuffix(string(k.Sign(data, "timestamp:1760600000\tfile:out.json")), "\n"), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, "untrusted comment: signature from mpt secret key 0807060504030201", lines[0])
+	assert.Equal(t, "trusted comment: timestamp:1760600000\tfile:out.json", lines[2])
+
+	body, err := base64.StdEncoding.DecodeString(lines[1])
+	require.NoError(t, err)
+	require.Len(t, body, 2+8+ed25519.SignatureSize)
+	assert.Equal(t, "Ed", string(body[:2]))
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, body[2:10])
+	sig := body[10:]
+	assert.True(t, ed25519.Verify(k.PublicKey(), data, sig))
+	assert.False(t, ed25519.Verify(k.PublicKey(), []byte(`{"final":"altered"}`), sig))
+
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	require.NoError(t, err)
+	assert.True(t, ed25519.Verify(k.PublicKey(), append(sig, "timestamp:1760600000\tfile:out.json"...), global),
+		"trusted comment is signed")
+}
+
+func TestParseKey(t *testing.T) {
+	valid := secretKeyFile(t, 2, make([]byte, 8))
+	raw, err := base64.StdEncoding.DecodeString(strings.Split(string(valid), "\n")[1])
+	require.NoError(t, err)
+	encode := func(mod func(raw []byte)) []byte {
+		r := bytes.Clone(raw)
+		mod(r)
+		return []byte(base64.StdEncoding.EncodeToString(r))
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{name: "valid", data: valid},
+		{name: "without comment", data: encode(func([]byte) {})},
+		{name: "not base64", data: []byte("untrusted comment: key\n!!!\n"), wantErr: "invalid key encoding"},
+		{name: "short", data: []byte(base64.StdEncoding.EncodeToString(raw[:100])), wantErr: "invalid key size 100, expected 158"},
+		{name: "unknown algorithm", data: encode(func(r []byte) { r[0] = 'X' }), wantErr: `unsupported signature algorithm "Xd"`},
+		{name: "encrypted", data: encode(func(r []byte) { copy(r[2:4], "Sc") }),
+			wantErr: "encrypted keys are not supported, create the key without password with minisign -G -W"},
+		{name: "corrupted", data: encode(func(r []byte) { r[len(r)-40] ^= 0xff }),
+			wantErr: "corrupted key, public part doesn't match the secret one"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKey(tt.data)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "0000000000000000", k.ID())
+		})
+	}
+
+	_, err = LoadKey(filepath.Join(t.TempDir(), "missing.key"))
+	require.ErrorContains(t, err, "failed to read sign key")
+}
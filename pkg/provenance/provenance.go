@@ -0,0 +1,39 @@
+// Package provenance records which tool, models and prompt produced the output of a run, and signs the output
+// with a minisign key, so outputs kept as review artifacts can be verified with the standard minisign tool.
+package provenance
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Provenance is the metadata of the run embedded into its output
+type Provenance struct {
+	Tool         string    `json:"tool"`
+	Version      string    `json:"version"`
+	PromptSHA256 string    `json:"prompt_sha256"` // hex sha256 of the prompt sent to providers
+	Models       []Model   `json:"models"`
+	Started      time.Time `json:"started"`
+	Finished     time.Time `json:"finished"`
+	KeyID        string    `json:"key_id,omitempty"` // id of the minisign key signing the output, as printed by minisign
+}
+
+// Model is the provider and model which produced a part of the output
+type Model struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model,omitempty"` // model reported by the provider, empty if not reported
+	Role     string `json:"role"`            // answer for provider answers, mix for the mixed result
+}
+
+// roles of models in the run
+const (
+	RoleAnswer = "answer"
+	RoleMix    = "mix"
+)
+
+// HashPrompt returns hex-encoded sha256 of the prompt
+func HashPrompt(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,94 @@
+// Package alias resolves friendly model names, like "sonnet" or "gpt-latest", to concrete model IDs of a provider.
+// Built-in aliases follow current vendor models and can be extended or overridden with a JSON file, so scripts
+// using aliases keep working when vendors rotate model identifiers.
+package alias
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// builtin defines default aliases per provider, keyed by lowercase provider name
+var builtin = map[string]map[string]string{
+	"openai": {
+		"gpt-latest": "gpt-5",
+		"gpt-mini":   "gpt-5-mini",
+		"gpt-nano":   "gpt-5-nano",
+	},
+	"anthropic": {
+		"claude-latest": "claude-sonnet-4-5",
+		"sonnet":        "claude-sonnet-4-5",
+		"opus":          "claude-opus-4-1",
+		"haiku":         "claude-haiku-4-5",
+	},
+	"google": {
+		"gemini-latest": "gemini-2.5-pro",
+		"gemini-pro":    "gemini-2.5-pro",
+		"gemini-flash":  "gemini-2.5-flash",
+	},
+	"deepseek": {
+		"deepseek-latest": "deepseek-chat",
+	},
+}
+
+// Resolver maps model aliases to concrete model IDs per provider. Nil Resolver returns models as is.
+type Resolver struct {
+	aliases map[string]map[string]string // provider name -> alias -> model ID, all keys lowercase
+}
+
+// New makes a Resolver with built-in aliases
+func New() *Resolver {
+	res := &Resolver{aliases: make(map[string]map[string]string, len(builtin))}
+	for prov, aliases := range builtin {
+		res.add(prov, aliases)
+	}
+	return res
+}
+
+// Load reads aliases from a JSON file and merges them over existing aliases. The file is an object keyed by
+// provider name with an object of alias to model ID for each provider, e.g. {"anthropic": {"sonnet": "claude-sonnet-4-5"}}.
+// Custom providers are keyed by their names too.
+func (r *Resolver) Load(path string) error {
+	data, err := os.ReadFile(path) //nolint:gosec // file path is provided by user
+	if err != nil {
+		return fmt.Errorf("failed to read model aliases file: %w", err)
+	}
+	var aliases map[string]map[string]string
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return fmt.Errorf("failed to parse model aliases file %s: %w", path, err)
+	}
+	for prov, provAliases := range aliases {
+		for name, model := range provAliases {
+			if strings.TrimSpace(model) == "" {
+				return fmt.Errorf("empty model for alias %q of provider %q in %s", name, prov, path)
+			}
+		}
+		r.add(prov, provAliases)
+	}
+	return nil
+}
+
+// Resolve returns the model ID for an alias of the provider, names are matched case-insensitively.
+// Model which is not an alias is returned unchanged.
+func (r *Resolver) Resolve(providerName, model string) string {
+	if r == nil {
+		return model
+	}
+	if id, ok := r.aliases[strings.ToLower(providerName)][strings.ToLower(model)]; ok {
+		return id
+	}
+	return model
+}
+
+// add merges aliases of the provider, replacing existing ones with the same name
+func (r *Resolver) add(providerName string, aliases map[string]string) {
+	prov := strings.ToLower(providerName)
+	if r.aliases[prov] == nil {
+		r.aliases[prov] = make(map[string]string, len(aliases))
+	}
+	for name, model := range aliases {
+		r.aliases[prov][strings.ToLower(name)] = strings.TrimSpace(model)
+	}
+}
@@ -0,0 +1,76 @@
+package alias
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	r := New()
+	tests := []struct {
+		name     string
+		provider string
+		model    string
+		want     string
+	}{
+		{name: "anthropic alias", provider: "Anthropic", model: "sonnet", want: "claude-sonnet-4-5"},
+		{name: "openai latest tag", provider: "OpenAI", model: "gpt-latest", want: "gpt-5"},
+		{name: "google alias", provider: "Google", model: "gemini-flash", want: "gemini-2.5-flash"},
+		{name: "case-insensitive", provider: "anthropic", model: "Sonnet", want: "claude-sonnet-4-5"},
+		{name: "concrete model unchanged", provider: "OpenAI", model: "gpt-4.1", want: "gpt-4.1"},
+		{name: "alias of another provider unchanged", provider: "OpenAI", model: "sonnet", want: "sonnet"},
+		{name: "unknown provider", provider: "Custom", model: "sonnet", want: "sonnet"},
+		{name: "empty model", provider: "OpenAI", model: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, r.Resolve(tt.provider, tt.model))
+		})
+	}
+
+	t.Run("nil resolver", func(t *testing.T) {
+		var nr *Resolver
+		assert.Equal(t, "sonnet", nr.Resolve("Anthropic", "sonnet"))
+	})
+}
+
+func TestResolver_Load(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	t.Run("merged over built-in aliases", func(t *testing.T) {
+		r := New()
+		path := writeFile("aliases.json", `{
+			"Anthropic": {"sonnet": "claude-sonnet-5", "fast": "claude-haiku-4-5"},
+			"openrouter": {"llama": "meta-llama/llama-4-maverick"}
+		}`)
+		require.NoError(t, r.Load(path))
+		assert.Equal(t, "claude-sonnet-5", r.Resolve("Anthropic", "sonnet"), "overridden")
+		assert.Equal(t, "claude-haiku-4-5", r.Resolve("Anthropic", "fast"), "added")
+		assert.Equal(t, "claude-opus-4-1", r.Resolve("Anthropic", "opus"), "built-in kept")
+		assert.Equal(t, "meta-llama/llama-4-maverick", r.Resolve("OpenRouter", "llama"), "custom provider")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		err := New().Load(filepath.Join(dir, "missing.json"))
+		require.ErrorContains(t, err, "failed to read model aliases file")
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		err := New().Load(writeFile("bad.json", `{"openai": ["gpt-5"]}`))
+		require.ErrorContains(t, err, "failed to parse model aliases file")
+	})
+
+	t.Run("empty model", func(t *testing.T) {
+		err := New().Load(writeFile("empty.json", `{"openai": {"gpt-latest": " "}}`))
+		require.EqualError(t, err, `empty model for alias "gpt-latest" of provider "openai" in `+filepath.Join(dir, "empty.json"))
+	})
+}
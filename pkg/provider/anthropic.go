@@ -2,31 +2,50 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
-	"fmt"
 	"strings"
+	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/go-pkgz/lgr"
 )
 
 // Anthropic implements Provider interface for Anthropic
 type Anthropic struct {
-	client    anthropic.Client
-	model     string
-	enabled   bool
-	maxTokens int
+	client            anthropic.Client
+	model             string
+	enabled           bool
+	maxTokens         int
+	stop              []string      // stop sequences
+	includeReasoning  bool          // enable extended thinking and report thinking blocks as reasoning
+	noCountTokens     bool          // token counting API is not served, like by Bedrock
+	generationTimeout time.Duration // max time of a single generation request, 0 for no limit
 }
 
+// minThinkingBudget is the minimal budget of extended thinking tokens accepted by Anthropic API
+const minThinkingBudget = 1024
+
 // NewAnthropic creates a new Anthropic provider
 func NewAnthropic(opts Options) *Anthropic {
 	// quick validation for direct constructor usage (without CreateProvider)
-	if opts.APIKey == "" || !opts.Enabled || opts.Model == "" {
+	cloud := opts.Vertex.Enabled || opts.Bedrock.Enabled
+	if (opts.APIKey == "" && !cloud) || !opts.Enabled || opts.Model == "" {
 		return &Anthropic{enabled: false}
 	}
 
-	// initialize Anthropic client with the API key
-	client := anthropic.NewClient(option.WithAPIKey(opts.APIKey))
+	// initialize Anthropic client with the API key, or with auth of the cloud platform routing requests
+	model := opts.Model
+	clientOpts := []option.RequestOption{option.WithAPIKey(opts.APIKey), option.WithHTTPClient(newHTTPClient(opts.Timeouts.Connect))}
+	if cloud {
+		var err error
+		if model, clientOpts, err = anthropicCloudOptions(context.Background(), opts); err != nil {
+			lgr.Printf("[WARN] anthropic provider can't use %s: %v", opts.cloudName(), err)
+			return &Anthropic{enabled: false}
+		}
+	}
+	client := anthropic.NewClient(clientOpts...)
 
 	// set default max tokens if not specified
 	maxTokens := opts.MaxTokens
@@ -36,13 +55,35 @@ func NewAnthropic(opts Options) *Anthropic {
 	// if maxTokens is 0, we'll use the model's maximum (API will determine the limit)
 
 	return &Anthropic{
-		client:    client,
-		model:     opts.Model,
-		enabled:   true,
-		maxTokens: maxTokens,
+		client:            client,
+		model:             model,
+		enabled:           true,
+		maxTokens:         maxTokens,
+		stop:              opts.Stop,
+		includeReasoning:  opts.IncludeReasoning,
+		noCountTokens:     opts.Bedrock.Enabled,
+		generationTimeout: opts.Timeouts.Generation,
 	}
 }
 
+// CountTokens returns the number of tokens of the prompt, counted by Anthropic token counting API
+func (a *Anthropic) CountTokens(ctx context.Context, prompt string) (int, error) {
+	if !a.enabled {
+		return 0, errors.New("anthropic provider is not enabled")
+	}
+	if a.noCountTokens {
+		return 0, errors.New("token counting is not supported by anthropic on bedrock")
+	}
+	resp, err := a.client.Messages.CountTokens(ctx, anthropic.MessageCountTokensParams{
+		Model:    anthropic.Model(a.model),
+		Messages: []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(prompt))},
+	})
+	if err != nil {
+		return 0, a.apiError(err)
+	}
+	return int(resp.InputTokens), nil
+}
+
 // Name returns the provider name
 func (a *Anthropic) Name() string {
 	return "Anthropic"
@@ -50,42 +91,105 @@ func (a *Anthropic) Name() string {
 
 // Generate sends a prompt to Anthropic and returns the generated text
 func (a *Anthropic) Generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := a.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// GenerateResponse sends a prompt to Anthropic and returns the generated text with response metadata
+func (a *Anthropic) GenerateResponse(ctx context.Context, prompt string) (Response, error) {
 	if !a.enabled {
-		return "", errors.New("anthropic provider is not enabled")
+		return Response{}, errors.New("anthropic provider is not enabled")
 	}
 
+	ctx, cancel := generationContext(ctx, a.generationTimeout)
+	defer cancel()
+
 	// create a message request using the SDK
-	resp, err := a.client.Messages.New(ctx, anthropic.MessageNewParams{
+	maxTokens := maxTokensFor(ctx, a.maxTokens)
+	params := anthropic.MessageNewParams{
 		Model:     anthropic.Model(a.model),
-		MaxTokens: int64(a.maxTokens), // convert to int64 for the API
+		MaxTokens: int64(maxTokens), // convert to int64 for the API
 		Messages: []anthropic.MessageParam{
 			anthropic.NewUserMessage(
 				anthropic.NewTextBlock(prompt),
 			),
 		},
-	})
+		StopSequences: a.stop,
+	}
+
+	// enable extended thinking with half of max tokens as the budget, the budget must be less than max tokens
+	if a.includeReasoning {
+		if budget := maxTokens / 2; budget >= minThinkingBudget {
+			params.Thinking = anthropic.ThinkingConfigParamOfEnabled(int64(budget))
+		} else {
+			lgr.Printf("[WARN] anthropic extended thinking requires max tokens of at least %d, reasoning disabled",
+				2*minThinkingBudget)
+		}
+	}
+
+	resp, err := a.client.Messages.New(ctx, params)
 
 	if err != nil {
-		// sanitize any potential sensitive information in error
-		return "", fmt.Errorf("anthropic api error: %w", err)
+		return Response{}, a.apiError(err)
 	}
 
-	// extract text from response
-	var textParts []string
+	// extract text and thinking from response
+	var textParts, thinkingParts []string
 	for _, content := range resp.Content {
-		if content.Type == "text" {
+		switch content.Type {
+		case "text":
 			textParts = append(textParts, content.Text)
+		case "thinking":
+			thinkingParts = append(thinkingParts, content.Thinking)
 		}
 	}
 
 	if len(textParts) == 0 {
-		return "", errors.New("anthropic returned empty response")
+		return Response{}, emptyResponseError(a.Name(), "anthropic returned empty response")
 	}
 
-	return strings.Join(textParts, ""), nil
+	return Response{
+		Text:         strings.Join(textParts, ""),
+		Reasoning:    strings.Join(thinkingParts, "\n\n"),
+		Truncated:    resp.StopReason == anthropic.StopReasonMaxTokens,
+		Model:        string(resp.Model),
+		FinishReason: string(resp.StopReason),
+		RequestID:    resp.ID,
+		Usage:        Usage{InputTokens: int(resp.Usage.InputTokens), OutputTokens: int(resp.Usage.OutputTokens)},
+	}, nil
 }
 
 // Enabled returns whether this provider is enabled
 func (a *Anthropic) Enabled() bool {
 	return a.enabled
 }
+
+// apiError converts an error of anthropic API call to a provider error, with HTTP status
+// and error type (e.g. "rate_limit_error" or "overloaded_error" of 529 status) taken from the API error
+// response if available, and the retry delay from its retry-after headers
+func (a *Anthropic) apiError(err error) *Error {
+	res := &Error{Provider: a.Name(), Message: "anthropic api error", Err: err, Retryable: isRetryableError(err)}
+	var apiErr *anthropic.Error
+	if !errors.As(err, &apiErr) {
+		return res
+	}
+
+	res.Status = apiErr.StatusCode
+	res.Retryable = isRetryableStatus(apiErr.StatusCode)
+	res.Body = bodyExcerpt([]byte(apiErr.RawJSON()))
+	if apiErr.Response != nil {
+		res.RetryAfter = retryAfter(apiErr.Response.Header, time.Now())
+	}
+	var body struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if json.Unmarshal([]byte(apiErr.RawJSON()), &body) == nil {
+		res.Code = body.Error.Type
+	}
+	return res
+}
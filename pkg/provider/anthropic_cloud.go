@@ -0,0 +1,201 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+// API versions of Anthropic messages API on cloud platforms, sent in the request body
+const (
+	vertexAnthropicVersion  = "vertex-2023-10-16"
+	bedrockAnthropicVersion = "bedrock-2023-05-31"
+)
+
+// anthropicModelVersions are dated versions of Anthropic model aliases, cloud platforms serve dated models only
+var anthropicModelVersions = map[string]string{
+	"claude-sonnet-4-5":        "claude-sonnet-4-5-20250929",
+	"claude-haiku-4-5":         "claude-haiku-4-5-20251001",
+	"claude-opus-4-1":          "claude-opus-4-1-20250805",
+	"claude-opus-4-0":          "claude-opus-4-20250514",
+	"claude-sonnet-4-0":        "claude-sonnet-4-20250514",
+	"claude-3-7-sonnet-latest": "claude-3-7-sonnet-20250219",
+	"claude-3-5-haiku-latest":  "claude-3-5-haiku-20241022",
+}
+
+// datedModelRe matches dated Anthropic model names, like claude-sonnet-4-5-20250929
+var datedModelRe = regexp.MustCompile(`^(claude-[a-z0-9-]+)-(\d{8})$`)
+
+// anthropicCloudOptions returns client options routing requests of Anthropic provider through Vertex AI or Bedrock,
+// with the model name of Anthropic API translated to the model of the platform
+func anthropicCloudOptions(ctx context.Context, opts Options) (model string, res []option.RequestOption, err error) {
+	switch {
+	case opts.Vertex.Enabled:
+		vc, err := newVertexClient(ctx, opts.Vertex, opts.Timeouts.Connect)
+		if err != nil {
+			return "", nil, err
+		}
+		baseURL := opts.BaseURL
+		if baseURL == "" {
+			baseURL = vertexBaseURL(vc.location)
+		}
+		return vertexModel(opts.Model), []option.RequestOption{option.WithHTTPClient(vc.client),
+			option.WithBaseURL(baseURL), option.WithMiddleware(vertexMiddleware(vc.project, vc.location))}, nil
+	case opts.Bedrock.Enabled:
+		region, creds, err := bedrockAuth(opts.Bedrock, os.Getenv)
+		if err != nil {
+			return "", nil, err
+		}
+		baseURL := opts.BaseURL
+		if baseURL == "" {
+			baseURL = "https://bedrock-runtime." + region + ".amazonaws.com/"
+		}
+		return bedrockModel(opts.Model, region), []option.RequestOption{
+			option.WithHTTPClient(newHTTPClient(opts.Timeouts.Connect)), option.WithBaseURL(baseURL),
+			option.WithMiddleware(bedrockMiddleware(creds, region))}, nil
+	}
+	return opts.Model, nil, nil
+}
+
+// vertexBaseURL returns the endpoint of Vertex AI in the location
+func vertexBaseURL(location string) string {
+	if location == "global" {
+		return "https://aiplatform.googleapis.com/"
+	}
+	return "https://" + location + "-aiplatform.googleapis.com/"
+}
+
+// vertexModel returns the Vertex AI model of the Anthropic model, like claude-sonnet-4-5@20250929.
+// Models of Vertex AI and unknown models are returned as is.
+func vertexModel(model string) string {
+	if v, ok := anthropicModelVersions[model]; ok {
+		model = v
+	}
+	if m := datedModelRe.FindStringSubmatch(model); m != nil {
+		return m[1] + "@" + m[2]
+	}
+	return model
+}
+
+// bedrockModel returns the Bedrock inference profile of the Anthropic model in the geography of the region,
+// like us.anthropic.claude-sonnet-4-5-20250929-v1:0. Models of Bedrock and unknown models are returned as is.
+func bedrockModel(model, region string) string {
+	if v, ok := anthropicModelVersions[model]; ok {
+		model = v
+	}
+	if !datedModelRe.MatchString(model) {
+		return model
+	}
+	model = "anthropic." + model + "-v1:0"
+	for prefix, geo := range map[string]string{"us-": "us.", "eu-": "eu.", "ap-": "apac."} {
+		if strings.HasPrefix(region, prefix) {
+			return geo + model
+		}
+	}
+	return model
+}
+
+// vertexMiddleware makes requests of Anthropic messages API in the shape of Vertex AI: the model is moved
+// from the body to the URL, and the API version is set in the body. Authentication is added by the vertex client.
+func vertexMiddleware(project, location string) option.Middleware {
+	return func(r *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		r.Header.Del("X-Api-Key") // the key of Anthropic API set in the environment is not sent to other platforms
+		base := fmt.Sprintf("/v1/projects/%s/locations/%s/publishers/anthropic/models/", project, location)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/v1/messages/count_tokens"):
+			if _, err := cloudBody(r, vertexAnthropicVersion, false); err != nil {
+				return nil, err
+			}
+			setCloudPath(r, "/v1/messages/count_tokens", base+"count-tokens:rawPredict")
+		case strings.HasSuffix(r.URL.Path, "/v1/messages"):
+			model, err := cloudBody(r, vertexAnthropicVersion, true)
+			if err != nil {
+				return nil, err
+			}
+			setCloudPath(r, "/v1/messages", base+url.PathEscape(model)+":rawPredict")
+		}
+		return next(r)
+	}
+}
+
+// bedrockMiddleware makes requests of Anthropic messages API in the shape of Bedrock, with the model moved
+// from the body to the URL and the API version set in the body, and signs them with AWS credentials
+func bedrockMiddleware(creds awsCredentials, region string) option.Middleware {
+	return func(r *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		r.Header.Del("X-Api-Key")
+		r.Header.Del("Authorization")
+		if strings.HasSuffix(r.URL.Path, "/v1/messages") {
+			model, err := cloudBody(r, bedrockAnthropicVersion, true)
+			if err != nil {
+				return nil, err
+			}
+			setCloudPath(r, "/v1/messages", "/model/"+url.QueryEscape(model)+"/invoke")
+		}
+		var payload []byte
+		if r.Body != nil {
+			var err error
+			payload, err = io.ReadAll(r.Body)
+			_ = r.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read request body: %w", err)
+			}
+			r.Body = io.NopCloser(bytes.NewReader(payload))
+		}
+		creds.authorize(r, payload, "bedrock", region, time.Now())
+		return next(r)
+	}
+}
+
+// cloudBody sets the API version in the request body of messages API, and removes the model if moveModel is set,
+// as cloud platforms take the model from the URL. Returns the model of the request.
+func cloudBody(r *http.Request, version string, moveModel bool) (string, error) {
+	if r.Body == nil {
+		return "", errors.New("empty request body")
+	}
+	data, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to read request body: %w", err)
+	}
+	var body map[string]json.RawMessage
+	if err = json.Unmarshal(data, &body); err != nil {
+		return "", fmt.Errorf("failed to parse request body: %w", err)
+	}
+	var model string
+	if moveModel {
+		if err = json.Unmarshal(body["model"], &model); err != nil {
+			return "", fmt.Errorf("failed to parse model of the request: %w", err)
+		}
+		delete(body, "model")
+	}
+	if _, ok := body["anthropic_version"]; !ok {
+		body["anthropic_version"], _ = json.Marshal(version)
+	}
+	if data, err = json.Marshal(body); err != nil {
+		return "", fmt.Errorf("failed to make request body: %w", err)
+	}
+	r.Body, r.ContentLength = io.NopCloser(bytes.NewReader(data)), int64(len(data))
+	r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }
+	return model, nil
+}
+
+// setCloudPath replaces the path of Anthropic API ending the request path, with the prefix of the base URL kept.
+// The path is set escaped, for models with characters escaped by the platform, like ":" of Bedrock models.
+func setCloudPath(r *http.Request, apiPath, path string) {
+	prefix := strings.TrimSuffix(r.URL.EscapedPath(), apiPath)
+	rawPath := prefix + path
+	if p, err := url.PathUnescape(rawPath); err == nil {
+		r.URL.Path, r.URL.RawPath = p, rawPath
+	}
+}
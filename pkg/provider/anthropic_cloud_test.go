@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnthropic_Vertex(t *testing.T) {
+	var req struct {
+		path, auth, apiKey string
+		body               map[string]any
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/token" {
+			_, _ = w.Write([]byte(`{"access_token":"vertex-token","token_type":"Bearer","expires_in":3600}`))
+			return
+		}
+		req.path, req.auth, req.apiKey = r.URL.Path, r.Header.Get("Authorization"), r.Header.Get("X-Api-Key")
+		req.body = map[string]any{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req.body))
+		if strings.HasSuffix(r.URL.Path, "count-tokens:rawPredict") {
+			_, _ = w.Write([]byte(`{"input_tokens":12}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-5-20250929",` +
+			`"content":[{"type":"text","text":"answer from vertex"}],"stop_reason":"end_turn",` +
+			`"usage":{"input_tokens":5,"output_tokens":3}}`))
+	}))
+	defer server.Close()
+	setVertexCredentials(t, server, "creds-project")
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-env")
+
+	p, err := CreateProvider(ProviderTypeAnthropic, Options{Enabled: true, Model: "claude-sonnet-4-5", MaxTokens: 100,
+		BaseURL: server.URL, Vertex: Vertex{Enabled: true, Location: "us-east5"}})
+	require.NoError(t, err)
+
+	resp, err := p.Generate(context.Background(), "question")
+	require.NoError(t, err)
+	assert.Equal(t, "answer from vertex", resp)
+	assert.Equal(t, "/v1/projects/creds-project/locations/us-east5/publishers/anthropic/models/"+
+		"claude-sonnet-4-5@20250929:rawPredict", req.path)
+	assert.Equal(t, "Bearer vertex-token", req.auth)
+	assert.Empty(t, req.apiKey, "key of anthropic API not sent")
+	assert.Equal(t, "vertex-2023-10-16", req.body["anthropic_version"])
+	assert.NotContains(t, req.body, "model")
+	assert.InDelta(t, 100, req.body["max_tokens"], 0)
+
+	count, err := p.(*Anthropic).CountTokens(context.Background(), "question")
+	require.NoError(t, err)
+	assert.Equal(t, 12, count)
+	assert.Equal(t, "/v1/projects/creds-project/locations/us-east5/publishers/anthropic/models/count-tokens:rawPredict",
+		req.path)
+	assert.Equal(t, "claude-sonnet-4-5@20250929", req.body["model"])
+}
+
+func TestAnthropic_Bedrock(t *testing.T) {
+	var path, rawPath, auth, apiKey string
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, rawPath, auth, apiKey = r.URL.Path, r.URL.RawPath, r.Header.Get("Authorization"), r.Header.Get("X-Api-Key")
+		data, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		body = map[string]any{}
+		assert.NoError(t, json.Unmarshal(data, &body))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-haiku-4-5-20251001",` +
+			`"content":[{"type":"text","text":"answer from bedrock"}],"stop_reason":"end_turn",` +
+			`"usage":{"input_tokens":5,"output_tokens":3}}`))
+	}))
+	defer server.Close()
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-env")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_BEARER_TOKEN_BEDROCK", "")
+
+	p, err := CreateProvider(ProviderTypeAnthropic, Options{Enabled: true, Model: "claude-haiku-4-5", BaseURL: server.URL,
+		Bedrock: Bedrock{Enabled: true, Region: "eu-central-1"}})
+	require.NoError(t, err)
+	resp, err := p.Generate(context.Background(), "question")
+	require.NoError(t, err)
+	assert.Equal(t, "answer from bedrock", resp)
+	assert.Equal(t, "/model/eu.anthropic.claude-haiku-4-5-20251001-v1:0/invoke", path)
+	assert.Equal(t, "/model/eu.anthropic.claude-haiku-4-5-20251001-v1%3A0/invoke", rawPath)
+	assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"), auth)
+	assert.Contains(t, auth, "/eu-central-1/bedrock/aws4_request")
+	assert.Empty(t, apiKey)
+	assert.Equal(t, "bedrock-2023-05-31", body["anthropic_version"])
+	assert.NotContains(t, body, "model")
+
+	_, err = p.(*Anthropic).CountTokens(context.Background(), "question")
+	require.ErrorContains(t, err, "token counting is not supported by anthropic on bedrock")
+
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	_, err = CreateProvider(ProviderTypeAnthropic, Options{Enabled: true, Model: "claude-haiku-4-5",
+		Bedrock: Bedrock{Enabled: true, Region: "eu-central-1"}})
+	require.EqualError(t, err, `anthropic provider failed to initialize with model "claude-haiku-4-5" on bedrock - `+
+		"check aws credentials and region")
+}
+
+func TestCloudModels(t *testing.T) {
+	tests := []struct {
+		model, vertex, bedrock string
+	}{
+		{model: "claude-sonnet-4-5", vertex: "claude-sonnet-4-5@20250929",
+			bedrock: "us.anthropic.claude-sonnet-4-5-20250929-v1:0"},
+		{model: "claude-opus-4-0", vertex: "claude-opus-4@20250514", bedrock: "us.anthropic.claude-opus-4-20250514-v1:0"},
+		{model: "claude-3-5-haiku-20241022", vertex: "claude-3-5-haiku@20241022",
+			bedrock: "us.anthropic.claude-3-5-haiku-20241022-v1:0"},
+		{model: "claude-opus-4-1@20250805", vertex: "claude-opus-4-1@20250805", bedrock: "claude-opus-4-1@20250805"},
+		{model: "anthropic.claude-v2:1", vertex: "anthropic.claude-v2:1", bedrock: "anthropic.claude-v2:1"},
+		{model: "claude-next", vertex: "claude-next", bedrock: "claude-next"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			assert.Equal(t, tt.vertex, vertexModel(tt.model))
+			assert.Equal(t, tt.bedrock, bedrockModel(tt.model, "us-east-1"))
+		})
+	}
+	assert.Equal(t, "apac.anthropic.claude-sonnet-4-5-20250929-v1:0", bedrockModel("claude-sonnet-4-5", "ap-northeast-1"))
+	assert.Equal(t, "anthropic.claude-sonnet-4-5-20250929-v1:0", bedrockModel("claude-sonnet-4-5", "ca-central-1"))
+}
+
+func TestOptions_ValidateCloud(t *testing.T) {
+	err := Options{Enabled: true, Model: "m", Bedrock: Bedrock{Enabled: true}}.Validate(ProviderTypeGoogle)
+	require.EqualError(t, err, "bedrock is not supported by google provider")
+	err = Options{Enabled: true, Model: "m", Vertex: Vertex{Enabled: true}, Bedrock: Bedrock{Enabled: true}}.
+		Validate(ProviderTypeAnthropic)
+	require.EqualError(t, err, "vertex AI and bedrock can't be combined")
+	require.NoError(t, Options{Enabled: true, Model: "m", Bedrock: Bedrock{Enabled: true}}.Validate(ProviderTypeAnthropic),
+		"api key not required")
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
@@ -445,6 +446,14 @@ func TestAnthropic_Generate_InvalidModelError(t *testing.T) {
 	assert.Contains(t, err.Error(), "anthropic api error")
 	assert.Contains(t, err.Error(), "400")
 	assert.Contains(t, err.Error(), "does not exist")
+
+	var perr *Error
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, "Anthropic", perr.Provider)
+	assert.Equal(t, http.StatusBadRequest, perr.Status)
+	assert.Equal(t, "invalid_request_error", perr.Code)
+	assert.False(t, perr.Retryable)
+	assert.Contains(t, perr.Body, "does not exist")
 }
 
 func TestAnthropic_Generate_ContextCancellation(t *testing.T) {
@@ -691,3 +700,138 @@ func TestAnthropic_Generate_NetworkError(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "anthropic api error")
 }
+
+func TestAnthropic_GenerateResponse_Truncated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": "msg_123", "type": "message", "role": "assistant",
+			"content": [{"type": "text", "text": "partial"}], "model": "claude-3-sonnet-20240229",
+			"stop_reason": "max_tokens", "usage": {"input_tokens": 5, "output_tokens": 10}}`))
+	}))
+	defer server.Close()
+
+	client := anthropic.NewClient(option.WithAPIKey("test-key"), option.WithBaseURL(server.URL),
+		option.WithHTTPClient(server.Client()))
+	provider := &Anthropic{client: client, model: "claude-3-sonnet-20240229", enabled: true, maxTokens: 10}
+
+	resp, err := provider.GenerateResponse(context.Background(), "test prompt")
+	require.NoError(t, err)
+	assert.Equal(t, "partial", resp.Text)
+	assert.True(t, resp.Truncated)
+}
+
+func TestAnthropic_GenerateResponse_Stop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, []any{"END"}, req["stop_sequences"])
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": "msg_123", "type": "message", "role": "assistant",
+			"content": [{"type": "text", "text": "stopped"}], "model": "claude-sonnet-4-5",
+			"stop_reason": "stop_sequence", "stop_sequence": "END", "usage": {"input_tokens": 5, "output_tokens": 10}}`))
+	}))
+	defer server.Close()
+
+	client := anthropic.NewClient(option.WithAPIKey("test-key"), option.WithBaseURL(server.URL),
+		option.WithHTTPClient(server.Client()))
+	provider := &Anthropic{client: client, model: "claude-sonnet-4-5", enabled: true, maxTokens: 100, stop: []string{"END"}}
+
+	resp, err := provider.GenerateResponse(context.Background(), "test prompt")
+	require.NoError(t, err)
+	assert.Equal(t, Response{Text: "stopped", Model: "claude-sonnet-4-5", FinishReason: "stop_sequence", RequestID: "msg_123",
+		Usage: Usage{InputTokens: 5, OutputTokens: 10}}, resp)
+}
+
+func TestAnthropic_GenerateResponse_Thinking(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxTokens    int
+		wantThinking bool
+	}{
+		{name: "thinking enabled", maxTokens: 4096, wantThinking: true},
+		{name: "max tokens too low for thinking", maxTokens: 1024, wantThinking: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req map[string]any
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				if tt.wantThinking {
+					assert.Equal(t, map[string]any{"type": "enabled", "budget_tokens": float64(tt.maxTokens / 2)}, req["thinking"])
+				} else {
+					assert.NotContains(t, req, "thinking")
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"id": "msg_123", "type": "message", "role": "assistant",
+					"content": [{"type": "thinking", "thinking": "let me think", "signature": "sig"},
+						{"type": "text", "text": "the answer"}],
+					"model": "claude-sonnet-4-5", "stop_reason": "end_turn",
+					"usage": {"input_tokens": 5, "output_tokens": 10}}`))
+			}))
+			defer server.Close()
+
+			client := anthropic.NewClient(option.WithAPIKey("test-key"), option.WithBaseURL(server.URL),
+				option.WithHTTPClient(server.Client()))
+			provider := &Anthropic{client: client, model: "claude-sonnet-4-5", enabled: true,
+				maxTokens: tt.maxTokens, includeReasoning: true}
+
+			resp, err := provider.GenerateResponse(context.Background(), "test prompt")
+			require.NoError(t, err)
+			assert.Equal(t, Response{Text: "the answer", Reasoning: "let me think", Model: "claude-sonnet-4-5",
+				FinishReason: "end_turn", RequestID: "msg_123", Usage: Usage{InputTokens: 5, OutputTokens: 10}}, resp)
+		})
+	}
+}
+
+func TestAnthropic_CountTokens(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages/count_tokens", r.URL.Path)
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Contains(t, string(body), `"model":"claude-3-sonnet-20240229"`)
+		assert.Contains(t, string(body), "test prompt")
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write([]byte(`{"input_tokens": 42}`))
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+
+	client := anthropic.NewClient(option.WithAPIKey("test-key"), option.WithBaseURL(server.URL),
+		option.WithHTTPClient(server.Client()))
+	provider := &Anthropic{client: client, model: "claude-3-sonnet-20240229", enabled: true}
+	n, err := provider.CountTokens(context.Background(), "test prompt")
+	require.NoError(t, err)
+	assert.Equal(t, 42, n)
+
+	_, err = (&Anthropic{}).CountTokens(context.Background(), "test prompt")
+	require.EqualError(t, err, "anthropic provider is not enabled")
+}
+
+func TestAnthropic_Generate_OverloadedError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "12")
+		w.WriteHeader(529)
+		_, _ = w.Write([]byte(`{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`))
+	}))
+	defer server.Close()
+
+	client := anthropic.NewClient(
+		option.WithAPIKey("test-key"),
+		option.WithBaseURL(server.URL),
+		option.WithHTTPClient(server.Client()),
+		option.WithMaxRetries(0),
+	)
+	provider := &Anthropic{client: client, model: "claude-3-sonnet-20240229", enabled: true, maxTokens: 1024}
+
+	_, err := provider.Generate(context.Background(), "test prompt")
+	require.Error(t, err)
+	var perr *Error
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, 529, perr.Status)
+	assert.Equal(t, "overloaded_error", perr.Code)
+	assert.True(t, perr.Retryable)
+	assert.Equal(t, 12*time.Second, perr.RetryAfter)
+}
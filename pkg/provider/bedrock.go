@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Bedrock routes requests through AWS Bedrock instead of the provider API (Anthropic only). Requests are signed
+// with AWS credentials from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, or authenticated with
+// the Bedrock API key from AWS_BEARER_TOKEN_BEDROCK if set, instead of the API key.
+type Bedrock struct {
+	Enabled bool
+	Region  string // AWS region, like "us-east-1", AWS_REGION or AWS_DEFAULT_REGION if empty
+}
+
+// awsCredentials authenticate Bedrock requests, with the bearer token used instead of signing if set
+type awsCredentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	bearerToken  string // Bedrock API key
+}
+
+// bedrockAuth returns the region and credentials of Bedrock requests, resolved from the environment
+func bedrockAuth(b Bedrock, getenv func(string) string) (region string, creds awsCredentials, err error) {
+	region = b.Region
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region == "" {
+			region = getenv(env)
+		}
+	}
+	if region == "" {
+		return "", awsCredentials{}, fmt.Errorf("aws region is not set, set it with AWS_REGION")
+	}
+	creds = awsCredentials{accessKey: getenv("AWS_ACCESS_KEY_ID"), secretKey: getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: getenv("AWS_SESSION_TOKEN"), bearerToken: getenv("AWS_BEARER_TOKEN_BEDROCK")}
+	if creds.bearerToken == "" && (creds.accessKey == "" || creds.secretKey == "") {
+		return "", awsCredentials{}, fmt.Errorf("aws credentials are not set, set AWS_ACCESS_KEY_ID and " +
+			"AWS_SECRET_ACCESS_KEY, or AWS_BEARER_TOKEN_BEDROCK")
+	}
+	return region, creds, nil
+}
+
+// authorize adds credentials to the request, the bearer token if set, or AWS signature version 4 of the payload
+func (c awsCredentials) authorize(r *http.Request, payload []byte, service, region string, now time.Time) {
+	if c.bearerToken != "" {
+		r.Header.Set("Authorization", "Bearer "+c.bearerToken)
+		return
+	}
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + region + "/" + service + "/aws4_request"
+	r.Header.Set("X-Amz-Date", amzDate)
+	if c.sessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for _, name := range []string{"Content-Type", "X-Amz-Date", "X-Amz-Security-Token"} {
+		if v := r.Header.Get(name); v != "" {
+			headers[strings.ToLower(name)] = strings.TrimSpace(v)
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{r.Method, escapeAWSPath(r.URL.EscapedPath()),
+		strings.ReplaceAll(r.URL.Query().Encode(), "+", "%20"), canonicalHeaders.String(), signedHeaders,
+		hex.EncodeToString(payloadHash[:])}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + c.secretKey)
+	for _, part := range []string{amzDate[:8], region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	r.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+// escapeAWSPath escapes the path for the canonical request of the signature, all characters except unreserved
+// ones and slashes are escaped, so the escaped path of the request is escaped twice, as AWS services expect
+func escapeAWSPath(path string) string {
+	var sb strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			sb.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", c)
+	}
+	return sb.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
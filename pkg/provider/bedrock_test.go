@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAWSCredentials_Authorize(t *testing.T) {
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	creds := awsCredentials{accessKey: "AKIDEXAMPLE", secretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+
+	t.Run("signature v4 test suite, get-vanilla", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", http.NoBody)
+		require.NoError(t, err)
+		creds.authorize(req, nil, "service", "us-east-1", now)
+		assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+		assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+			"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+			req.Header.Get("Authorization"))
+	})
+
+	t.Run("session token and content type signed", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "https://bedrock-runtime.us-east-1.amazonaws.com/model/"+
+			"anthropic.claude-v1%3A0/invoke", http.NoBody)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		c := creds
+		c.sessionToken = "session"
+		c.authorize(req, []byte(`{}`), "bedrock", "us-east-1", now)
+		assert.Equal(t, "session", req.Header.Get("X-Amz-Security-Token"))
+		assert.Contains(t, req.Header.Get("Authorization"), "/20150830/us-east-1/bedrock/aws4_request, "+
+			"SignedHeaders=content-type;host;x-amz-date;x-amz-security-token, Signature=")
+	})
+
+	t.Run("bearer token", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "https://bedrock-runtime.us-east-1.amazonaws.com/", http.NoBody)
+		require.NoError(t, err)
+		awsCredentials{bearerToken: "bedrock-key"}.authorize(req, nil, "bedrock", "us-east-1", now)
+		assert.Equal(t, "Bearer bedrock-key", req.Header.Get("Authorization"))
+		assert.Empty(t, req.Header.Get("X-Amz-Date"))
+	})
+}
+
+func TestEscapeAWSPath(t *testing.T) {
+	assert.Equal(t, "/model/us.anthropic.claude-sonnet-4-5-20250929-v1%253A0/invoke",
+		escapeAWSPath("/model/us.anthropic.claude-sonnet-4-5-20250929-v1%3A0/invoke"))
+	assert.Equal(t, "/a%20b/~c_d", escapeAWSPath("/a b/~c_d"))
+}
+
+func TestBedrockAuth(t *testing.T) {
+	env := map[string]string{"AWS_DEFAULT_REGION": "eu-west-1", "AWS_ACCESS_KEY_ID": "id", "AWS_SECRET_ACCESS_KEY": "secret"}
+	getenv := func(k string) string { return env[k] }
+
+	region, creds, err := bedrockAuth(Bedrock{Enabled: true}, getenv)
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", region)
+	assert.Equal(t, awsCredentials{accessKey: "id", secretKey: "secret"}, creds)
+
+	env["AWS_REGION"] = "us-west-2"
+	region, _, err = bedrockAuth(Bedrock{Enabled: true}, getenv)
+	require.NoError(t, err)
+	assert.Equal(t, "us-west-2", region)
+	region, _, err = bedrockAuth(Bedrock{Enabled: true, Region: "us-east-1"}, getenv)
+	require.NoError(t, err)
+	assert.Equal(t, "us-east-1", region, "region of options preferred")
+
+	delete(env, "AWS_SECRET_ACCESS_KEY")
+	_, _, err = bedrockAuth(Bedrock{Enabled: true}, getenv)
+	require.EqualError(t, err, "aws credentials are not set, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, "+
+		"or AWS_BEARER_TOKEN_BEDROCK")
+	env["AWS_BEARER_TOKEN_BEDROCK"] = "key"
+	_, creds, err = bedrockAuth(Bedrock{Enabled: true}, getenv)
+	require.NoError(t, err)
+	assert.Equal(t, "key", creds.bearerToken)
+
+	_, _, err = bedrockAuth(Bedrock{Enabled: true}, func(string) string { return "" })
+	require.EqualError(t, err, "aws region is not set, set it with AWS_REGION")
+}
@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Capability is a feature of a provider model, used to select providers for roles like mixing or consensus checking
+type Capability string
+
+// supported capabilities
+const (
+	CapabilityJSON        Capability = "supports-json"   // native JSON output mode
+	CapabilityVision      Capability = "supports-vision" // image input
+	CapabilityLongContext Capability = "long-context"    // context window of at least 200k tokens
+	CapabilityCheap       Capability = "cheap"           // low price per token, good for auxiliary requests
+)
+
+// CapabilityPrefix starts provider spec selecting the provider by capabilities, like "capability:cheap"
+// or "capability:cheap+long-context" for providers with all the listed capabilities
+const CapabilityPrefix = "capability:"
+
+// capabilities lists all supported capabilities
+var capabilities = []Capability{CapabilityJSON, CapabilityVision, CapabilityLongContext, CapabilityCheap}
+
+// modelCapabilities are built-in capabilities of known models, matched by substring of the model name.
+// The first matching entry is used, so more specific names go first.
+var modelCapabilities = []struct {
+	model string
+	caps  []Capability
+}{
+	{"gpt-4.1-mini", []Capability{CapabilityJSON, CapabilityVision, CapabilityLongContext, CapabilityCheap}},
+	{"gpt-4.1-nano", []Capability{CapabilityJSON, CapabilityVision, CapabilityLongContext, CapabilityCheap}},
+	{"gpt-4.1", []Capability{CapabilityJSON, CapabilityVision, CapabilityLongContext}},
+	{"gpt-4o-mini", []Capability{CapabilityJSON, CapabilityVision, CapabilityCheap}},
+	{"gpt-4o", []Capability{CapabilityJSON, CapabilityVision}},
+	{"gpt-5-mini", []Capability{CapabilityJSON, CapabilityVision, CapabilityLongContext, CapabilityCheap}},
+	{"gpt-5-nano", []Capability{CapabilityJSON, CapabilityVision, CapabilityLongContext, CapabilityCheap}},
+	{"gpt-5", []Capability{CapabilityJSON, CapabilityVision, CapabilityLongContext}},
+	{"o3-mini", []Capability{CapabilityJSON, CapabilityLongContext, CapabilityCheap}},
+	{"o4-mini", []Capability{CapabilityJSON, CapabilityVision, CapabilityLongContext, CapabilityCheap}},
+	{"o3", []Capability{CapabilityJSON, CapabilityVision, CapabilityLongContext}},
+	{"haiku", []Capability{CapabilityVision, CapabilityLongContext, CapabilityCheap}},
+	{"claude", []Capability{CapabilityVision, CapabilityLongContext}},
+	{"gemini-2.0-flash", []Capability{CapabilityJSON, CapabilityVision, CapabilityLongContext, CapabilityCheap}},
+	{"flash", []Capability{CapabilityJSON, CapabilityVision, CapabilityLongContext, CapabilityCheap}},
+	{"gemini", []Capability{CapabilityJSON, CapabilityVision, CapabilityLongContext}},
+	{"deepseek-chat", []Capability{CapabilityJSON, CapabilityCheap}},
+	{"deepseek-reasoner", []Capability{CapabilityCheap}},
+}
+
+// ModelCapabilities returns built-in capabilities of the model, nil for unknown models
+func ModelCapabilities(model string) []Capability {
+	model = strings.ToLower(model)
+	for _, mc := range modelCapabilities {
+		if strings.Contains(model, mc.model) {
+			return slices.Clone(mc.caps)
+		}
+	}
+	return nil
+}
+
+// ParseCapabilities parses comma-separated list of capabilities, like "cheap,long-context"
+func ParseCapabilities(s string) ([]Capability, error) {
+	var res []Capability
+	for _, v := range strings.Split(s, ",") {
+		c := Capability(strings.ToLower(strings.TrimSpace(v)))
+		if c == "" {
+			continue
+		}
+		if !slices.Contains(capabilities, c) {
+			return nil, fmt.Errorf("unknown capability %q, supported: %s", c, capabilityNames())
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+// capabilityNames returns comma-separated names of supported capabilities
+func capabilityNames() string {
+	names := make([]string, len(capabilities))
+	for i, c := range capabilities {
+		names[i] = string(c)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Capabilities is a registry of provider capabilities, keyed by provider name
+type Capabilities map[string][]Capability
+
+// Set sets capabilities of the provider, replacing previous ones
+func (c Capabilities) Set(name string, caps ...Capability) {
+	c[strings.ToLower(name)] = caps
+}
+
+// Has checks if the provider has all the capabilities, provider name is case-insensitive
+func (c Capabilities) Has(name string, caps ...Capability) bool {
+	have := c[strings.ToLower(name)]
+	for _, cp := range caps {
+		if !slices.Contains(have, cp) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateSpec checks capabilities of the provider spec, specs not selecting by capability are valid
+func ValidateSpec(spec string) error {
+	if !strings.HasPrefix(spec, CapabilityPrefix) {
+		return nil
+	}
+	caps, err := ParseCapabilities(strings.ReplaceAll(strings.TrimPrefix(spec, CapabilityPrefix), "+", ","))
+	if err != nil {
+		return err
+	}
+	if len(caps) == 0 {
+		return fmt.Errorf("no capabilities in %q", spec)
+	}
+	return nil
+}
+
+// FindProvider finds enabled provider by the spec, either a name matched as in FindProviderByName, or
+// "capability:<cap>[+<cap>...]" selecting the first enabled provider with all the listed capabilities.
+// Capability specs don't fall back to other providers and return nil if no provider has the capabilities.
+func FindProvider(spec string, providers []Provider, caps Capabilities) Provider {
+	if !strings.HasPrefix(spec, CapabilityPrefix) {
+		return FindProviderByName(spec, providers)
+	}
+	want, err := ParseCapabilities(strings.ReplaceAll(strings.TrimPrefix(spec, CapabilityPrefix), "+", ","))
+	if err != nil || len(want) == 0 {
+		return nil
+	}
+	for _, p := range providers {
+		if p.Enabled() && caps.Has(p.Name(), want...) {
+			return p
+		}
+	}
+	return nil
+}
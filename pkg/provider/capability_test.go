@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// namedProvider is a provider stub with name and enabled state only
+type namedProvider struct {
+	name    string
+	enabled bool
+}
+
+func (p namedProvider) Name() string                                     { return p.name }
+func (p namedProvider) Enabled() bool                                    { return p.enabled }
+func (p namedProvider) Generate(context.Context, string) (string, error) { return "", nil }
+
+func TestModelCapabilities(t *testing.T) {
+	tests := []struct {
+		model string
+		want  []Capability
+	}{
+		{"gpt-4o-mini", []Capability{CapabilityJSON, CapabilityVision, CapabilityCheap}},
+		{"gpt-4o", []Capability{CapabilityJSON, CapabilityVision}},
+		{"GPT-5", []Capability{CapabilityJSON, CapabilityVision, CapabilityLongContext}},
+		{"claude-3-5-haiku-latest", []Capability{CapabilityVision, CapabilityLongContext, CapabilityCheap}},
+		{"claude-sonnet-4-5", []Capability{CapabilityVision, CapabilityLongContext}},
+		{"gemini-2.5-flash", []Capability{CapabilityJSON, CapabilityVision, CapabilityLongContext, CapabilityCheap}},
+		{"gemini-2.5-pro-preview-06-05", []Capability{CapabilityJSON, CapabilityVision, CapabilityLongContext}},
+		{"deepseek-chat", []Capability{CapabilityJSON, CapabilityCheap}},
+		{"llama3", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			assert.Equal(t, tt.want, ModelCapabilities(tt.model))
+		})
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	caps, err := ParseCapabilities(" cheap, Long-Context,,")
+	require.NoError(t, err)
+	assert.Equal(t, []Capability{CapabilityCheap, CapabilityLongContext}, caps)
+
+	caps, err = ParseCapabilities("")
+	require.NoError(t, err)
+	assert.Empty(t, caps)
+
+	_, err = ParseCapabilities("cheap,fast")
+	require.EqualError(t, err, `unknown capability "fast", supported: supports-json, supports-vision, long-context, cheap`)
+}
+
+func TestCapabilities_Has(t *testing.T) {
+	caps := Capabilities{}
+	caps.Set("OpenAI", CapabilityJSON, CapabilityCheap)
+	assert.True(t, caps.Has("openai", CapabilityCheap))
+	assert.True(t, caps.Has("OpenAI", CapabilityJSON, CapabilityCheap))
+	assert.False(t, caps.Has("OpenAI", CapabilityCheap, CapabilityVision))
+	assert.False(t, caps.Has("Google", CapabilityCheap))
+	assert.True(t, caps.Has("Google"), "no capabilities required")
+
+	var empty Capabilities
+	assert.False(t, empty.Has("OpenAI", CapabilityCheap))
+}
+
+func TestValidateSpec(t *testing.T) {
+	require.NoError(t, ValidateSpec("openai"))
+	require.NoError(t, ValidateSpec("capability:cheap"))
+	require.NoError(t, ValidateSpec("capability:cheap+long-context"))
+	require.EqualError(t, ValidateSpec("capability:"), `no capabilities in "capability:"`)
+	require.ErrorContains(t, ValidateSpec("capability:fast"), `unknown capability "fast"`)
+}
+
+func TestFindProvider(t *testing.T) {
+	providers := []Provider{
+		namedProvider{name: "OpenAI", enabled: true},
+		namedProvider{name: "Google", enabled: true},
+		namedProvider{name: "DeepSeek", enabled: false},
+		namedProvider{name: "Anthropic", enabled: true},
+	}
+	caps := Capabilities{}
+	caps.Set("OpenAI", CapabilityJSON)
+	caps.Set("Google", CapabilityJSON, CapabilityCheap, CapabilityLongContext)
+	caps.Set("DeepSeek", CapabilityCheap, CapabilityVision)
+	caps.Set("Anthropic", CapabilityCheap, CapabilityVision)
+
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"capability:cheap", "Google"},
+		{"capability:supports-json", "OpenAI"},
+		{"capability:cheap+supports-vision", "Anthropic"}, // disabled DeepSeek is skipped
+		{"capability:cheap+long-context", "Google"},
+		{"capability:long-context+supports-vision", ""}, // no fallback
+		{"capability:fast", ""},
+		{"anthropic", "Anthropic"},
+		{"unknown", "OpenAI"}, // names fall back to the first enabled provider
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			p := FindProvider(tt.spec, providers, caps)
+			if tt.want == "" {
+				assert.Nil(t, p)
+				return
+			}
+			require.NotNil(t, p)
+			assert.Equal(t, tt.want, p.Name())
+		})
+	}
+}
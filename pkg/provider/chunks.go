@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+)
+
+// ChunkFunc is called with pieces of the response text as they are generated, by providers streaming responses.
+// It is called with empty text once a streamed response starts, so the text of a retried request replaces
+// the text streamed by the failed attempt.
+type ChunkFunc func(text string)
+
+// chunksKey is the context key of ChunkFunc
+type chunksKey struct{}
+
+// WithChunks returns a child context with the chunk callback. Providers supporting streaming, OpenAI and
+// OpenAI-compatible providers with chat completions endpoint, stream responses if it is set, the rest of
+// providers return the whole response as usual.
+func WithChunks(ctx context.Context, fn ChunkFunc) context.Context {
+	return context.WithValue(ctx, chunksKey{}, fn)
+}
+
+// chunksFromContext returns the chunk callback of the context, nil if not set
+func chunksFromContext(ctx context.Context) ChunkFunc {
+	fn, _ := ctx.Value(chunksKey{}).(ChunkFunc)
+	return fn
+}
+
+// maxEventSize limits the size of a single server-sent event of a streamed response
+const maxEventSize = 1 << 20
+
+// readEvents reads data of server-sent events from r and passes it to fn, until r ends or fn returns
+// false or error. Multi-line data of an event is joined with new lines, comments and other fields are skipped.
+func readEvents(r io.Reader, fn func(data []byte) (bool, error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEventSize)
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			if len(data) == 0 {
+				continue
+			}
+			next, err := fn(data)
+			if err != nil || !next {
+				return err
+			}
+			data = data[:0]
+			continue
+		}
+		if value, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, bytes.TrimPrefix(value, []byte(" "))...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		_, err := fn(data)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAI_ChatCompletions_Stream(t *testing.T) {
+	events := []string{
+		`{"id":"chatcmpl-1","model":"gpt-4o-2024","choices":[{"delta":{"role":"assistant","content":""}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt-4o-2024","choices":[{"delta":{"content":"Hello"}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt-4o-2024","choices":[{"delta":{"reasoning_content":"think"}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt-4o-2024","choices":[{"delta":{"content":", world"},"finish_reason":"length"}]}`,
+		`{"id":"chatcmpl-1","model":"gpt-4o-2024","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":4}}`,
+		`[DONE]`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatCompletionRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.True(t, req.Stream)
+		assert.Equal(t, &streamOptions{IncludeUsage: true}, req.StreamOptions, "usage requested")
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+		for _, ev := range events {
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", ev)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	var chunks []string
+	ctx := WithChunks(context.Background(), func(text string) { chunks = append(chunks, text) })
+	p := NewOpenAI(Options{APIKey: "key", Model: "gpt-4o", Enabled: true, BaseURL: server.URL})
+	resp, err := p.GenerateResponse(ctx, "hi")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "Hello", ", world"}, chunks, "empty chunk on start")
+	assert.Equal(t, Response{Text: "Hello, world", Reasoning: "think", Truncated: true, Model: "gpt-4o-2024",
+		FinishReason: "length", RequestID: "chatcmpl-1", Usage: Usage{InputTokens: 3, OutputTokens: 4}}, resp)
+}
+
+func TestOpenAI_ChatCompletions_StreamErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		status      int
+		body        string
+		wantText    string
+		wantErr     string
+	}{
+		{name: "not streamed", contentType: "application/json", status: http.StatusOK,
+			body: `{"choices":[{"message":{"content":"whole"},"finish_reason":"stop"}]}`, wantText: "whole"},
+		{name: "error response", contentType: "application/json", status: http.StatusTooManyRequests,
+			body: `{"error":{"message":"429 rate limit","type":"requests"}}`, wantErr: "rate limit exceeded"},
+		{name: "error event", contentType: "text/event-stream", status: http.StatusOK,
+			body: "data: {\"error\":{\"message\":\"server overloaded\"}}\n\n", wantErr: "openai api error: server overloaded"},
+		{name: "invalid event", contentType: "text/event-stream", status: http.StatusOK,
+			body: "data: {oops\n\n", wantErr: "failed to parse response"},
+		{name: "no choices", contentType: "text/event-stream", status: http.StatusOK,
+			body: "data: [DONE]\n\n", wantErr: "openai returned no choices"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			var chunks strings.Builder
+			ctx := WithChunks(context.Background(), func(text string) { chunks.WriteString(text) })
+			p := NewOpenAI(Options{APIKey: "key", Model: "gpt-4o", Enabled: true, BaseURL: server.URL})
+			resp, err := p.GenerateResponse(ctx, "hi")
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantText, resp.Text)
+			assert.Empty(t, chunks.String(), "no chunks of not streamed response")
+		})
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	input := ": comment\nevent: message\ndata: first\ndata: line\n\n\n\ndata: second\nid: 2\n\ndata: last"
+	var got []string
+	err := readEvents(strings.NewReader(input), func(data []byte) (bool, error) {
+		got = append(got, string(data))
+		return true, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first\nline", "second", "last"}, got)
+
+	got = nil
+	err = readEvents(strings.NewReader("data: a\n\ndata: b\n\n"), func(data []byte) (bool, error) {
+		got = append(got, string(data))
+		return false, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, got, "stopped by callback")
+}
@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// ContinuingProvider wraps a provider and issues continuation requests when a response
+// was cut off by the max tokens limit, stitching all parts into a single response.
+type ContinuingProvider struct {
+	provider         Provider
+	maxContinuations int // max number of continuation requests
+}
+
+// NewContinuingProvider creates a provider wrapper issuing up to maxContinuations continuation requests
+func NewContinuingProvider(p Provider, maxContinuations int) Provider {
+	if maxContinuations <= 0 {
+		return p
+	}
+	return &ContinuingProvider{provider: p, maxContinuations: maxContinuations}
+}
+
+// WrapProvidersWithContinue wraps multiple providers with auto-continue logic
+func WrapProvidersWithContinue(providers []Provider, maxContinuations int) []Provider {
+	if maxContinuations <= 0 {
+		return providers
+	}
+
+	wrapped := make([]Provider, len(providers))
+	for i, p := range providers {
+		wrapped[i] = NewContinuingProvider(p, maxContinuations)
+	}
+	return wrapped
+}
+
+// Name returns the provider name
+func (c *ContinuingProvider) Name() string {
+	return c.provider.Name()
+}
+
+// Enabled returns whether this provider is enabled
+func (c *ContinuingProvider) Enabled() bool {
+	return c.provider.Enabled()
+}
+
+// Generate sends a prompt to the provider and continues truncated responses
+func (c *ContinuingProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := c.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// GenerateResponse sends a prompt to the provider and continues truncated responses.
+// The returned response is marked as truncated if it is still cut off after all continuations.
+func (c *ContinuingProvider) GenerateResponse(ctx context.Context, prompt string) (Response, error) {
+	resp, err := GenerateResponse(ctx, c.provider, prompt)
+	if err != nil {
+		return Response{Attempts: resp.Attempts}, err
+	}
+
+	reasoning := resp.Reasoning // reasoning of continuations is not relevant for the answer
+	attempts := resp.Attempts   // attempts of continuation requests follow attempts of the first one
+	res := resp                 // metadata of the last successful response, with usage of all of them
+	var sb strings.Builder
+	sb.WriteString(resp.Text)
+	for i := 1; res.Truncated && i <= c.maxContinuations; i++ {
+		lgr.Printf("[INFO] %s: response truncated, requesting continuation %d of %d", c.Name(), i, c.maxContinuations)
+		resp, err = GenerateResponse(ctx, c.provider, buildContinuationPrompt(prompt, sb.String()))
+		attempts = append(attempts, resp.Attempts...)
+		if err != nil {
+			// keep what we have so far, the response is still truncated
+			lgr.Printf("[WARN] %s: continuation %d failed: %v", c.Name(), i, err)
+			break
+		}
+		sb.WriteString(resp.Text)
+		usage := res.Usage
+		res = resp
+		res.Usage = Usage{InputTokens: usage.InputTokens + resp.Usage.InputTokens,
+			OutputTokens: usage.OutputTokens + resp.Usage.OutputTokens}
+	}
+
+	if res.Truncated {
+		lgr.Printf("[WARN] %s: response still truncated after %d continuations", c.Name(), c.maxContinuations)
+	}
+	res.Text, res.Reasoning, res.Attempts = sb.String(), reasoning, attempts
+	return res, nil
+}
+
+// buildContinuationPrompt creates a prompt asking the model to continue a truncated answer
+func buildContinuationPrompt(prompt, partial string) string {
+	return fmt.Sprintf("%s\n\nYour previous answer was cut off. Here is what you have written so far:\n\n"+
+		"%s\n\nContinue exactly where the answer ends. Do not repeat any of the text above "+
+		"and do not add any introduction.", prompt, partial)
+}
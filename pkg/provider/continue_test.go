@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider/mocks"
+)
+
+// partsProvider returns predefined responses in order, recording prompts it received
+type partsProvider struct {
+	responses []Response
+	errs      []error
+	prompts   []string
+}
+
+func (p *partsProvider) Name() string  { return "parts" }
+func (p *partsProvider) Enabled() bool { return true }
+
+func (p *partsProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := p.GenerateResponse(ctx, prompt)
+	return resp.Text, err
+}
+
+func (p *partsProvider) GenerateResponse(_ context.Context, prompt string) (Response, error) {
+	idx := len(p.prompts)
+	p.prompts = append(p.prompts, prompt)
+	if idx < len(p.errs) && p.errs[idx] != nil {
+		return Response{}, p.errs[idx]
+	}
+	return p.responses[idx], nil
+}
+
+func TestContinuingProvider_NoWrap(t *testing.T) {
+	mock := &mocks.ProviderMock{NameFunc: func() string { return "test" }}
+	assert.Equal(t, mock, NewContinuingProvider(mock, 0))
+
+	providers := []Provider{mock}
+	assert.Equal(t, providers, WrapProvidersWithContinue(providers, 0))
+}
+
+func TestContinuingProvider_GenerateResponse(t *testing.T) {
+	tests := []struct {
+		name          string
+		responses     []Response
+		errs          []error
+		max           int
+		wantText      string
+		wantReasoning string
+		wantTruncated bool
+		wantCalls     int
+	}{
+		{
+			name:      "not truncated",
+			responses: []Response{{Text: "complete"}},
+			max:       3, wantText: "complete", wantCalls: 1,
+		},
+		{
+			name:      "continued once",
+			responses: []Response{{Text: "part one, ", Reasoning: "thoughts", Truncated: true}, {Text: "part two"}},
+			max:       3, wantText: "part one, part two", wantReasoning: "thoughts", wantCalls: 2,
+		},
+		{
+			name: "still truncated after max continuations",
+			responses: []Response{{Text: "a", Truncated: true}, {Text: "b", Truncated: true},
+				{Text: "c", Truncated: true}},
+			max: 2, wantText: "abc", wantTruncated: true, wantCalls: 3,
+		},
+		{
+			name:      "continuation error keeps partial result",
+			responses: []Response{{Text: "partial", Truncated: true}, {}},
+			errs:      []error{nil, errors.New("api error")},
+			max:       3, wantText: "partial", wantTruncated: true, wantCalls: 2,
+		},
+	}
+
+	t.Run("metadata of the last response", func(t *testing.T) {
+		p := &partsProvider{responses: []Response{{Text: "a", Truncated: true, FinishReason: "length", RequestID: "r1",
+			Usage: Usage{InputTokens: 10, OutputTokens: 100}},
+			{Text: "b", Model: "m", FinishReason: "stop", RequestID: "r2", Usage: Usage{InputTokens: 110, OutputTokens: 5}}}}
+		resp, err := GenerateResponse(context.Background(), NewContinuingProvider(p, 3), "question")
+		require.NoError(t, err)
+		assert.Equal(t, Response{Text: "ab", Model: "m", FinishReason: "stop", RequestID: "r2",
+			Usage: Usage{InputTokens: 120, OutputTokens: 105}}, resp, "usage of all requests")
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &partsProvider{responses: tt.responses, errs: tt.errs}
+			wrapped := NewContinuingProvider(p, tt.max)
+			resp, err := GenerateResponse(context.Background(), wrapped, "question")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantText, resp.Text)
+			assert.Equal(t, tt.wantReasoning, resp.Reasoning)
+			assert.Equal(t, tt.wantTruncated, resp.Truncated)
+			require.Len(t, p.prompts, tt.wantCalls)
+			assert.Equal(t, "question", p.prompts[0])
+			for _, prompt := range p.prompts[1:] {
+				assert.Contains(t, prompt, "question")
+				assert.Contains(t, prompt, "Continue exactly where the answer ends")
+			}
+		})
+	}
+}
+
+func TestContinuingProvider_Generate(t *testing.T) {
+	t.Run("initial error returned", func(t *testing.T) {
+		p := &partsProvider{responses: []Response{{}}, errs: []error{errors.New("failed")}}
+		_, err := NewContinuingProvider(p, 2).Generate(context.Background(), "question")
+		require.EqualError(t, err, "failed")
+	})
+
+	t.Run("provider without metadata", func(t *testing.T) {
+		mock := &mocks.ProviderMock{
+			NameFunc:     func() string { return "test" },
+			EnabledFunc:  func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return "text", nil },
+		}
+		wrapped := NewContinuingProvider(mock, 2)
+		assert.Equal(t, "test", wrapped.Name())
+		assert.True(t, wrapped.Enabled())
+		text, err := wrapped.Generate(context.Background(), "question")
+		require.NoError(t, err)
+		assert.Equal(t, "text", text)
+		assert.Len(t, mock.GenerateCalls(), 1)
+	})
+}
@@ -8,8 +8,12 @@ import (
 // CustomOpenAI implements Provider interface for OpenAI-compatible providers
 // it wraps the OpenAI provider with custom base URL and name
 type CustomOpenAI struct {
-	name     string  // custom provider name
-	provider *OpenAI // underlying OpenAI provider
+	name         string       // custom provider name
+	provider     *OpenAI      // underlying OpenAI provider
+	endpointType EndpointType // endpoint type, embeddings providers can't generate text
+	model        string       // model name, used for embeddings requests
+	dimensions   int          // dimensions of embedding vectors, 0 for model default
+	batchSize    int          // max number of texts in a single embeddings request
 }
 
 // CustomOptions defines options for custom OpenAI-compatible providers
@@ -20,11 +24,19 @@ type CustomOptions struct {
 	Model        string       // model name to use
 	Enabled      bool         // whether provider is enabled
 	MaxTokens    int          // maximum number of tokens to generate
+	Stop         []string     // sequences stopping generation
 	Temperature  float32      // controls randomness (0-1, default: 0.7)
-	EndpointType EndpointType // endpoint type (auto, responses, chat_completions)
+	EndpointType EndpointType // endpoint type (auto, responses, chat_completions, embeddings)
 	HTTPClient   HTTPClient   // optional HTTP client for dependency injection
+	Timeouts     Timeouts     // connect and generation timeouts, zero values mean no limit
+
+	EmbeddingDimensions int // dimensions of embedding vectors, 0 for model default
+	EmbeddingBatchSize  int // max texts per embeddings request, DefaultEmbeddingBatchSize if not set
 }
 
+// DefaultEmbeddingBatchSize defines the default max number of texts sent in a single embeddings request
+const DefaultEmbeddingBatchSize = 32
+
 // NewCustomOpenAI creates a new custom OpenAI-compatible provider
 func NewCustomOpenAI(opts CustomOptions) *CustomOpenAI {
 	if opts.BaseURL == "" || opts.Model == "" || !opts.Enabled {
@@ -49,15 +61,26 @@ func NewCustomOpenAI(opts CustomOptions) *CustomOpenAI {
 		Enabled:           opts.Enabled,
 		Model:             opts.Model,
 		MaxTokens:         opts.MaxTokens,
+		Stop:              opts.Stop,
 		Temperature:       opts.Temperature,
 		HTTPClient:        opts.HTTPClient,
 		BaseURL:           opts.BaseURL,
 		ForceEndpointType: endpointType,
+		Timeouts:          opts.Timeouts,
 	})
 
+	batchSize := opts.EmbeddingBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultEmbeddingBatchSize
+	}
+
 	return &CustomOpenAI{
-		name:     name,
-		provider: provider,
+		name:         name,
+		provider:     provider,
+		endpointType: endpointType,
+		model:        opts.Model,
+		dimensions:   opts.EmbeddingDimensions,
+		batchSize:    batchSize,
 	}
 }
 
@@ -66,16 +89,65 @@ func (c *CustomOpenAI) Name() string {
 	return c.name
 }
 
+// TokenizerModel returns the model, prompts are counted locally with its tiktoken encoding
+func (c *CustomOpenAI) TokenizerModel() string {
+	return c.model
+}
+
 // Generate sends a prompt to the custom provider and returns the generated text
 func (c *CustomOpenAI) Generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := c.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// GenerateResponse sends a prompt to the custom provider and returns the generated text with response metadata
+func (c *CustomOpenAI) GenerateResponse(ctx context.Context, prompt string) (Response, error) {
 	if !c.provider.Enabled() {
-		return "", fmt.Errorf("%s provider is not enabled", c.name)
+		return Response{}, fmt.Errorf("%s provider is not enabled", c.name)
+	}
+	if c.endpointType == EndpointTypeEmbeddings {
+		return Response{}, fmt.Errorf("%s provider serves embeddings only and can't generate text", c.name)
 	}
 
-	return c.provider.Generate(ctx, prompt)
+	resp, err := c.provider.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return Response{}, withProvider(err, c.name)
+	}
+	return resp, nil
 }
 
 // Enabled returns whether this provider is enabled
 func (c *CustomOpenAI) Enabled() bool {
 	return c.provider.Enabled()
 }
+
+// Embed creates embedding vectors for the given texts using v1/embeddings endpoint. Texts are sent in batches
+// of the configured size, and vectors are checked to have the configured dimensions.
+// Only providers with embeddings endpoint type support it.
+func (c *CustomOpenAI) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if !c.provider.Enabled() {
+		return nil, fmt.Errorf("%s provider is not enabled", c.name)
+	}
+	if c.endpointType != EndpointTypeEmbeddings {
+		return nil, fmt.Errorf("%s provider doesn't serve embeddings, endpoint type is %s", c.name, c.endpointType)
+	}
+
+	res := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += c.batchSize {
+		end := min(start+c.batchSize, len(texts))
+		vectors, err := c.provider.embed(ctx, embeddingsRequest{Model: c.model, Input: texts[start:end], Dimensions: c.dimensions})
+		if err != nil {
+			return nil, withProvider(err, c.name)
+		}
+		for _, v := range vectors {
+			if c.dimensions > 0 && len(v) != c.dimensions {
+				return nil, fmt.Errorf("%s returned embedding with %d dimensions, expected %d", c.name, len(v), c.dimensions)
+			}
+		}
+		res = append(res, vectors...)
+	}
+	return res, nil
+}
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -226,6 +227,13 @@ func TestCustomOpenAI_Generate_APIError(t *testing.T) {
 	_, err := provider.Generate(context.Background(), "test prompt")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "authentication failed")
+
+	var perr *Error
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, "LocalLLM", perr.Provider, "error is reported with the custom provider name")
+	assert.Equal(t, http.StatusUnauthorized, perr.Status)
+	assert.Equal(t, "invalid_api_key", perr.Code)
+	assert.False(t, perr.Retryable)
 }
 
 func TestCustomOpenAI_DefaultEndpointType(t *testing.T) {
@@ -409,3 +417,54 @@ func TestCustomOpenAI_Generate_EmptyAPIKey_ResponsesAPI(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "Response from local GPT-5 without auth", result)
 }
+
+func TestCustomOpenAI_Embed(t *testing.T) {
+	t.Run("batched with dimensions", func(t *testing.T) {
+		var batches [][]string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/v1/embeddings", r.URL.Path)
+			var req embeddingsRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, "nomic-embed-text", req.Model)
+			assert.Equal(t, 2, req.Dimensions)
+			batches = append(batches, req.Input)
+
+			data := make([]map[string]any, 0, len(req.Input))
+			for i, text := range req.Input {
+				data = append(data, map[string]any{"index": i, "embedding": []float32{float32(len(text)), 1}})
+			}
+			w.Header().Set("Content-Type", "application/json")
+			require.NoError(t, json.NewEncoder(w).Encode(map[string]any{"data": data}))
+		}))
+		defer server.Close()
+
+		p := NewCustomOpenAI(CustomOptions{Name: "Ollama", BaseURL: server.URL, Model: "nomic-embed-text", Enabled: true,
+			EndpointType: EndpointTypeEmbeddings, EmbeddingDimensions: 2, EmbeddingBatchSize: 2})
+		res, err := p.Embed(context.Background(), []string{"a", "bb", "ccc"})
+		require.NoError(t, err)
+		assert.Equal(t, [][]float32{{1, 1}, {2, 1}, {3, 1}}, res)
+		assert.Equal(t, [][]string{{"a", "bb"}, {"ccc"}}, batches)
+
+		_, err = p.Generate(context.Background(), "prompt")
+		require.EqualError(t, err, "Ollama provider serves embeddings only and can't generate text")
+	})
+
+	t.Run("unexpected dimensions", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"data": [{"index": 0, "embedding": [0.1, 0.2, 0.3]}]}`))
+		}))
+		defer server.Close()
+
+		p := NewCustomOpenAI(CustomOptions{Name: "Local", BaseURL: server.URL, Model: "embed", Enabled: true,
+			EndpointType: EndpointTypeEmbeddings, EmbeddingDimensions: 2})
+		_, err := p.Embed(context.Background(), []string{"a"})
+		require.EqualError(t, err, "Local returned embedding with 3 dimensions, expected 2")
+	})
+
+	t.Run("not embeddings endpoint", func(t *testing.T) {
+		p := NewCustomOpenAI(CustomOptions{Name: "Local", BaseURL: "http://localhost", Model: "llama", Enabled: true})
+		_, err := p.Embed(context.Background(), []string{"a"})
+		require.EqualError(t, err, "Local provider doesn't serve embeddings, endpoint type is chat_completions")
+	})
+}
@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"context"
+	"errors"
+)
+
+// DefaultDeepSeekBaseURL defines the base URL of DeepSeek API
+const DefaultDeepSeekBaseURL = "https://api.deepseek.com"
+
+// DeepSeek implements Provider interface for DeepSeek models.
+// DeepSeek API is compatible with OpenAI chat completions, so it wraps the OpenAI provider.
+// The deepseek-reasoner model returns its reasoning trace in a separate reasoning_content field,
+// reported as Response.Reasoning.
+type DeepSeek struct {
+	provider *OpenAI // underlying OpenAI-compatible provider
+}
+
+// NewDeepSeek creates a new DeepSeek provider
+func NewDeepSeek(opts Options) *DeepSeek {
+	// quick validation for direct constructor usage (without CreateProvider)
+	if opts.APIKey == "" || !opts.Enabled || opts.Model == "" {
+		return &DeepSeek{provider: &OpenAI{enabled: false}}
+	}
+
+	baseURL := opts.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultDeepSeekBaseURL
+	}
+
+	return &DeepSeek{provider: NewOpenAI(Options{
+		APIKey:            opts.APIKey,
+		Enabled:           true,
+		Model:             opts.Model,
+		MaxTokens:         opts.MaxTokens,
+		Stop:              opts.Stop,
+		Temperature:       opts.Temperature,
+		HTTPClient:        opts.HTTPClient,
+		BaseURL:           baseURL,
+		ForceEndpointType: EndpointTypeChatCompletions, // deepseek supports chat completions only
+		Timeouts:          opts.Timeouts,
+	})}
+}
+
+// Name returns the provider name
+func (d *DeepSeek) Name() string {
+	return "DeepSeek"
+}
+
+// Generate sends a prompt to DeepSeek and returns the generated text
+func (d *DeepSeek) Generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := d.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// GenerateResponse sends a prompt to DeepSeek and returns the generated text with response metadata,
+// including the reasoning trace of reasoning models
+func (d *DeepSeek) GenerateResponse(ctx context.Context, prompt string) (Response, error) {
+	if !d.provider.Enabled() {
+		return Response{}, errors.New("deepseek provider is not enabled")
+	}
+	resp, err := d.provider.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return Response{}, withProvider(err, d.Name())
+	}
+	return resp, nil
+}
+
+// Enabled returns whether this provider is enabled
+func (d *DeepSeek) Enabled() bool {
+	return d.provider.Enabled()
+}
@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeepSeek_Enabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		expected bool
+	}{
+		{name: "enabled", opts: Options{APIKey: "key", Model: "deepseek-chat", Enabled: true}, expected: true},
+		{name: "no api key", opts: Options{Model: "deepseek-chat", Enabled: true}, expected: false},
+		{name: "no model", opts: Options{APIKey: "key", Enabled: true}, expected: false},
+		{name: "disabled", opts: Options{APIKey: "key", Model: "deepseek-chat"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewDeepSeek(tt.opts)
+			assert.Equal(t, tt.expected, p.Enabled())
+			assert.Equal(t, "DeepSeek", p.Name())
+		})
+	}
+}
+
+func TestDeepSeek_GenerateResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+
+		var req chatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "deepseek-reasoner", req.Model)
+		require.NotNil(t, req.Temperature)
+		assert.InDelta(t, 1.0, *req.Temperature, 1e-6)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant",
+			"content": "42", "reasoning_content": "thinking about the answer"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	p := NewDeepSeek(Options{APIKey: "test-key", Model: "deepseek-reasoner", Enabled: true, BaseURL: server.URL, Temperature: 1})
+
+	resp, err := p.GenerateResponse(context.Background(), "question")
+	require.NoError(t, err)
+	assert.Equal(t, Response{Text: "42", Reasoning: "thinking about the answer", FinishReason: "stop"}, resp)
+
+	text, err := p.Generate(context.Background(), "question")
+	require.NoError(t, err)
+	assert.Equal(t, "42", text)
+}
+
+func TestDeepSeek_NotEnabled(t *testing.T) {
+	p := NewDeepSeek(Options{})
+	_, err := p.Generate(context.Background(), "question")
+	require.EqualError(t, err, "deepseek provider is not enabled")
+}
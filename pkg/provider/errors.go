@@ -0,0 +1,147 @@
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorBodySize defines the max size of the raw response body excerpt kept in Error
+const maxErrorBodySize = 512
+
+// Error is a structured error of a failed provider request. It carries the HTTP status, vendor error code
+// and retry-ability, so callers can branch on them with errors.As instead of parsing error messages.
+type Error struct {
+	Provider   string        // provider name, e.g. "OpenAI"
+	Status     int           // HTTP status code, 0 if the request failed without a response
+	Code       string        // vendor error code or type, e.g. "rate_limit_exceeded", empty if not reported
+	Message    string        // human-readable error message
+	Retryable  bool          // whether the request may succeed if retried
+	RetryAfter time.Duration // delay before retrying suggested by the provider, 0 if not reported
+	Body       string        // excerpt of the raw response body, empty if not available
+	Err        error         // underlying error, nil if not available
+}
+
+// Error returns the error message, with the message of the underlying error if any
+func (e *Error) Error() string {
+	switch {
+	case e.Err == nil:
+		return e.Message
+	case e.Message == "":
+		return e.Err.Error()
+	default:
+		return e.Message + ": " + e.Err.Error()
+	}
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError wraps err into *Error of the named provider, with retry-ability derived from the error message.
+// If err already is or wraps *Error, it is returned as is, or as a copy with the provider name set if it
+// was missing. Returns nil for nil err.
+func NewError(providerName string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var perr *Error
+	if errors.As(err, &perr) {
+		if perr.Provider == "" {
+			return withProvider(err, providerName)
+		}
+		return err
+	}
+	return &Error{Provider: providerName, Err: err, Retryable: isRetryableError(err)}
+}
+
+// Errors returns all provider errors found in the error tree of err, including joined errors
+func Errors(err error) []*Error {
+	if err == nil {
+		return nil
+	}
+	switch e := err.(type) {
+	case *Error:
+		return []*Error{e}
+	case interface{ Unwrap() []error }:
+		var res []*Error
+		for _, ee := range e.Unwrap() {
+			res = append(res, Errors(ee)...)
+		}
+		return res
+	case interface{ Unwrap() error }:
+		return Errors(e.Unwrap())
+	}
+	return nil
+}
+
+// httpError creates an error of a failed HTTP response, retryable for rate limits, timeouts and server errors
+func httpError(providerName string, status int, code, message string, body []byte) *Error {
+	return &Error{
+		Provider:  providerName,
+		Status:    status,
+		Code:      code,
+		Message:   message,
+		Retryable: isRetryableStatus(status),
+		Body:      bodyExcerpt(body),
+	}
+}
+
+// emptyResponseError creates an error of a response without generated text. It is retryable,
+// as models occasionally return nothing for a prompt they answer on the next request.
+func emptyResponseError(providerName, message string) *Error {
+	return &Error{Provider: providerName, Message: message, Retryable: true}
+}
+
+// withProvider returns err with the provider name of its provider error set, used by providers wrapping
+// other providers. The provider error is copied, as err may be shared, so the original error is not modified.
+func withProvider(err error, providerName string) error {
+	var perr *Error
+	if !errors.As(err, &perr) || perr.Provider == providerName {
+		return err
+	}
+	res := *perr
+	res.Provider = providerName
+	if err != error(perr) {
+		// provider error is wrapped, keep the message of the wrapping error
+		res.Message, res.Err = "", err
+	}
+	return &res
+}
+
+// isRetryableStatus checks if a request failed with the given HTTP status code may succeed if retried
+func isRetryableStatus(status int) bool {
+	return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryAfter returns the retry delay suggested by retry-after-ms or Retry-After response headers, 0 if not set
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	if ms, err := strconv.ParseFloat(h.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	if t, ok := parseRetryAfter(h.Get("Retry-After"), now); ok && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// retryHint returns the retry delay suggested by the provider error in the error tree of err, 0 if not reported
+func retryHint(err error) time.Duration {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return perr.RetryAfter
+	}
+	return 0
+}
+
+// bodyExcerpt returns the trimmed response body cut to maxErrorBodySize
+func bodyExcerpt(body []byte) string {
+	res := strings.TrimSpace(string(body))
+	if len(res) > maxErrorBodySize {
+		res = strings.ToValidUTF8(res[:maxErrorBodySize], "") + "..."
+	}
+	return res
+}
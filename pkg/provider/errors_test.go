@@ -0,0 +1,172 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestError_Error(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *Error
+		want string
+	}{
+		{name: "message only", err: &Error{Message: "http 502: bad gateway"}, want: "http 502: bad gateway"},
+		{name: "underlying only", err: &Error{Err: errors.New("connection refused")}, want: "connection refused"},
+		{name: "message and underlying", err: &Error{Message: "openai api error", Err: errors.New("connection refused")},
+			want: "openai api error: connection refused"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.err.Error())
+		})
+	}
+
+	t.Run("unwrap", func(t *testing.T) {
+		err := &Error{Message: "openai api error", Err: context.DeadlineExceeded}
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestNewError(t *testing.T) {
+	assert.NoError(t, NewError("OpenAI", nil))
+
+	t.Run("plain error", func(t *testing.T) {
+		err := NewError("OpenAI", errors.New("dial tcp: connection refused"))
+		var perr *Error
+		require.ErrorAs(t, err, &perr)
+		assert.Equal(t, "OpenAI", perr.Provider)
+		assert.True(t, perr.Retryable)
+		assert.Equal(t, "dial tcp: connection refused", err.Error())
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		var perr *Error
+		require.ErrorAs(t, NewError("OpenAI", context.Canceled), &perr)
+		assert.False(t, perr.Retryable)
+	})
+
+	t.Run("provider name set on a copy", func(t *testing.T) {
+		orig := &Error{Status: 429, Code: "rate_limit_exceeded", Retryable: true, Message: "rate limit"}
+		err := NewError("Custom", orig)
+		var perr *Error
+		require.ErrorAs(t, err, &perr)
+		assert.Equal(t, &Error{Provider: "Custom", Status: 429, Code: "rate_limit_exceeded", Retryable: true,
+			Message: "rate limit"}, perr)
+		assert.Empty(t, orig.Provider, "original error not modified")
+	})
+
+	t.Run("wrapped provider error", func(t *testing.T) {
+		orig := &Error{Status: 429, Code: "rate_limit_exceeded", Retryable: true, Message: "rate limit"}
+		wrapped := fmt.Errorf("request failed: %w", orig)
+		err := NewError("Custom", wrapped)
+		assert.Equal(t, "request failed: rate limit", err.Error())
+		var perr *Error
+		require.ErrorAs(t, err, &perr)
+		assert.Equal(t, "Custom", perr.Provider)
+		assert.Equal(t, 429, perr.Status)
+		assert.True(t, perr.Retryable)
+		assert.Empty(t, orig.Provider, "original error not modified")
+		assert.ErrorIs(t, err, orig)
+	})
+
+	t.Run("provider name not overwritten", func(t *testing.T) {
+		orig := &Error{Provider: "OpenAI", Message: "failed"}
+		require.Equal(t, orig, NewError("Other", orig))
+		assert.Equal(t, "OpenAI", orig.Provider)
+	})
+}
+
+func TestErrors(t *testing.T) {
+	e1 := &Error{Provider: "OpenAI", Status: 429}
+	e2 := &Error{Provider: "Google", Status: 500}
+
+	assert.Nil(t, Errors(nil))
+	assert.Nil(t, Errors(errors.New("plain")))
+	assert.Equal(t, []*Error{e1}, Errors(fmt.Errorf("wrapped: %w", e1)))
+	assert.Equal(t, []*Error{e1, e2}, Errors(fmt.Errorf("all failed: %w; %w", e1, e2)))
+	assert.Equal(t, []*Error{e1, e2}, Errors(errors.Join(e1, errors.New("plain"), fmt.Errorf("x: %w", e2))))
+}
+
+func TestHTTPError(t *testing.T) {
+	tests := []struct {
+		status    int
+		retryable bool
+	}{
+		{status: 400}, {status: 401}, {status: 404},
+		{status: 408, retryable: true}, {status: 429, retryable: true},
+		{status: 500, retryable: true}, {status: 503, retryable: true}, {status: 529, retryable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d", tt.status), func(t *testing.T) {
+			err := httpError("OpenAI", tt.status, "code", "message", []byte(" body "))
+			assert.Equal(t, tt.retryable, err.Retryable)
+			assert.Equal(t, "body", err.Body)
+			assert.Equal(t, tt.retryable, isRetryableError(err), "retry classifier uses the structured error")
+		})
+	}
+
+	t.Run("long body is cut", func(t *testing.T) {
+		err := httpError("OpenAI", 500, "", "message", []byte(strings.Repeat("x", 2*maxErrorBodySize)))
+		assert.Len(t, err.Body, maxErrorBodySize+3)
+		assert.True(t, strings.HasSuffix(err.Body, "..."))
+	})
+}
+
+func TestWithProvider(t *testing.T) {
+	plain := errors.New("plain")
+	assert.Equal(t, plain, withProvider(plain, "DeepSeek"), "non-provider error kept as is")
+
+	orig := &Error{Provider: "OpenAI", Message: "failed", Status: 500}
+	err := withProvider(orig, "DeepSeek")
+	var perr *Error
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, "DeepSeek", perr.Provider)
+	assert.Equal(t, 500, perr.Status)
+	assert.Equal(t, "OpenAI", orig.Provider, "shared error not modified")
+	assert.Same(t, orig, withProvider(orig, "OpenAI"), "same provider name kept as is")
+}
+
+func TestEmptyResponseError(t *testing.T) {
+	err := emptyResponseError("Anthropic", "anthropic returned empty response")
+	assert.True(t, isRetryableError(err), "empty responses are retried")
+	assert.Equal(t, "anthropic returned empty response", err.Error())
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{name: "no headers", header: http.Header{}, want: 0},
+		{name: "milliseconds", header: http.Header{"Retry-After-Ms": {"1500"}, "Retry-After": {"2"}}, want: 1500 * time.Millisecond},
+		{name: "seconds", header: http.Header{"Retry-After": {"7"}}, want: 7 * time.Second},
+		{name: "http date", header: http.Header{"Retry-After": {now.Add(time.Minute).Format(http.TimeFormat)}}, want: time.Minute},
+		{name: "date in the past", header: http.Header{"Retry-After": {now.Add(-time.Minute).Format(http.TimeFormat)}}, want: 0},
+		{name: "invalid", header: http.Header{"Retry-After": {"soon"}}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, retryAfter(tt.header, now))
+		})
+	}
+}
+
+func TestRetryHint(t *testing.T) {
+	assert.Zero(t, retryHint(errors.New("plain")))
+	err := &Error{Provider: "Google", Status: 429, RetryAfter: 30 * time.Second}
+	assert.Equal(t, 30*time.Second, retryHint(fmt.Errorf("wrapped: %w", err)))
+	assert.Equal(t, 30*time.Second, retryHint(withProvider(err, "Gemini")), "kept by provider name override")
+}
@@ -0,0 +1,192 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FaultKind is a kind of failure injected into provider requests
+type FaultKind string
+
+// supported fault kinds, each fails the request with the error a real outage of the kind causes
+const (
+	FaultTimeout   FaultKind = "timeout"   // request exceeded its deadline after waiting for it, retryable
+	FaultError     FaultKind = "error"     // server error with 500 status, retryable
+	FaultRateLimit FaultKind = "ratelimit" // rate limited with 429 status, retryable
+	FaultEmpty     FaultKind = "empty"     // empty response, retryable
+	FaultAuth      FaultKind = "auth"      // invalid API key with 401 status, not retryable
+)
+
+// Fault is a failure injected into a share of provider requests
+type Fault struct {
+	Kind FaultKind
+	Rate float64 // share of failed requests, from 0 to 1
+}
+
+// ParseFaults parses comma-separated faults like "timeout:30%,ratelimit:10%". The rate is a percentage
+// or a fraction, all requests fail if it's omitted, and rates of all faults may add up to 100% at most.
+func ParseFaults(spec string) ([]Fault, error) {
+	var res []Fault
+	total := 0.0
+	for _, s := range strings.Split(spec, ",") {
+		kind, rate, hasRate := strings.Cut(strings.TrimSpace(s), ":")
+		f := Fault{Kind: FaultKind(strings.ToLower(kind)), Rate: 1}
+		switch f.Kind {
+		case FaultTimeout, FaultError, FaultRateLimit, FaultEmpty, FaultAuth:
+		default:
+			return nil, fmt.Errorf("unknown fault %q, supported: timeout, error, ratelimit, empty, auth", kind)
+		}
+		if hasRate {
+			r, err := parseRate(rate)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rate of fault %s: %w", kind, err)
+			}
+			f.Rate = r
+		}
+		total += f.Rate
+		res = append(res, f)
+	}
+	if total > 1 {
+		return nil, fmt.Errorf("rates of faults %q add up to more than 100%%", spec)
+	}
+	return res, nil
+}
+
+// parseRate parses a percentage like "30%" or a fraction like "0.3"
+func parseRate(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	scale := 1.0
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		s, scale = pct, 100
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	if v /= scale; v < 0 || v > 1 {
+		return 0, fmt.Errorf("rate %s is out of range 0-100%%", s)
+	}
+	return v, nil
+}
+
+// FaultProvider wraps a provider to fail requests with injected faults, so retries and fallbacks of
+// integrations can be tested without real provider outages. Requests not hit by a fault go to the provider.
+type FaultProvider struct {
+	provider Provider
+	faults   []Fault
+	delay    time.Duration // wait of timeout faults, if the request has no earlier deadline
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewFaultProvider makes a provider failing requests with the faults, picked randomly by their rates.
+// Timeout faults wait for the deadline of the request context or the delay, whichever comes first, and
+// wait for the deadline only if the delay is 0. A non-zero seed makes the sequence of faults reproducible,
+// the sequence is mixed with the provider name, so providers with the same faults don't fail in lockstep.
+func NewFaultProvider(p Provider, faults []Fault, seed uint64, delay time.Duration) Provider {
+	if len(faults) == 0 {
+		return p
+	}
+	if seed == 0 {
+		seed = rand.Uint64() //nolint:gosec // fault injection doesn't need crypto random
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strings.ToLower(p.Name())))
+	rnd := rand.New(rand.NewPCG(seed, h.Sum64())) //nolint:gosec // fault injection doesn't need crypto random
+	return &FaultProvider{provider: p, faults: faults, delay: delay, rnd: rnd}
+}
+
+// Name returns the provider name
+func (f *FaultProvider) Name() string {
+	return f.provider.Name()
+}
+
+// Enabled returns whether this provider is enabled
+func (f *FaultProvider) Enabled() bool {
+	return f.provider.Enabled()
+}
+
+// Generate sends the prompt to the provider unless the request is failed with an injected fault
+func (f *FaultProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := f.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// GenerateResponse sends the prompt to the provider unless the request is failed with an injected fault
+func (f *FaultProvider) GenerateResponse(ctx context.Context, prompt string) (Response, error) {
+	if err := f.inject(ctx); err != nil {
+		return Response{}, err
+	}
+	return GenerateResponse(ctx, f.provider, prompt)
+}
+
+// inject returns the error of the fault hitting the request, nil if no fault hits it
+func (f *FaultProvider) inject(ctx context.Context) error {
+	f.mu.Lock()
+	r := f.rnd.Float64()
+	f.mu.Unlock()
+
+	name := f.provider.Name()
+	for _, fault := range f.faults {
+		if r -= fault.Rate; r >= 0 {
+			continue
+		}
+		switch fault.Kind {
+		case FaultTimeout:
+			if err := f.wait(ctx); err != nil {
+				return err
+			}
+			return &Error{Provider: name, Message: "injected timeout", Retryable: true, Err: context.DeadlineExceeded}
+		case FaultError:
+			return httpError(name, http.StatusInternalServerError, "", "injected server error", nil)
+		case FaultRateLimit:
+			return httpError(name, http.StatusTooManyRequests, "rate_limit_exceeded", "injected rate limit", nil)
+		case FaultAuth:
+			return httpError(name, http.StatusUnauthorized, "invalid_api_key", "injected auth failure", nil)
+		default:
+			return emptyResponseError(name, "injected empty response")
+		}
+	}
+	return nil
+}
+
+// wait blocks like a request running into its timeout, until the context is done or the delay passes.
+// Returns the context error if the context was canceled rather than hit its deadline.
+func (f *FaultProvider) wait(ctx context.Context) error {
+	var timeout <-chan time.Time
+	if f.delay > 0 {
+		timer := time.NewTimer(f.delay)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		if err := ctx.Err(); !errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+	case <-timeout:
+	}
+	return nil
+}
+
+// WrapProvidersWithFaults wraps providers with faults set for them, keyed by lowercase provider name.
+// The delay limits the wait of timeout faults, see NewFaultProvider.
+func WrapProvidersWithFaults(providers []Provider, faults map[string][]Fault, seed uint64, delay time.Duration) []Provider {
+	wrapped := make([]Provider, len(providers))
+	for i, p := range providers {
+		wrapped[i] = NewFaultProvider(p, faults[strings.ToLower(p.Name())], seed, delay)
+	}
+	return wrapped
+}
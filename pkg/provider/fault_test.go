@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider/mocks"
+)
+
+func TestParseFaults(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []Fault
+		err  string
+	}{
+		{spec: "timeout:30%", want: []Fault{{Kind: FaultTimeout, Rate: 0.3}}},
+		{spec: "error:0.25, RateLimit:10%", want: []Fault{{Kind: FaultError, Rate: 0.25}, {Kind: FaultRateLimit, Rate: 0.1}}},
+		{spec: "auth", want: []Fault{{Kind: FaultAuth, Rate: 1}}},
+		{spec: "empty:0", want: []Fault{{Kind: FaultEmpty, Rate: 0}}},
+		{spec: "crash:10%", err: `unknown fault "crash", supported: timeout, error, ratelimit, empty, auth`},
+		{spec: "timeout:abc", err: `invalid rate of fault timeout: invalid rate "abc"`},
+		{spec: "timeout:150%", err: "invalid rate of fault timeout: rate 150 is out of range 0-100%"},
+		{spec: "timeout:60%,error:50%", err: `rates of faults "timeout:60%,error:50%" add up to more than 100%`},
+	}
+	for _, tt := range tests {
+		res, err := ParseFaults(tt.spec)
+		if tt.err != "" {
+			require.EqualError(t, err, tt.err, tt.spec)
+			continue
+		}
+		require.NoError(t, err, tt.spec)
+		assert.InDeltaSlice(t, rates(tt.want), rates(res), 1e-9, tt.spec)
+		for i := range tt.want {
+			assert.Equal(t, tt.want[i].Kind, res[i].Kind, tt.spec)
+		}
+	}
+}
+
+func rates(faults []Fault) []float64 {
+	res := make([]float64, 0, len(faults))
+	for _, f := range faults {
+		res = append(res, f.Rate)
+	}
+	return res
+}
+
+func TestFaultProvider(t *testing.T) {
+	mock := &mocks.ProviderMock{
+		NameFunc:     func() string { return "OpenAI" },
+		EnabledFunc:  func() bool { return true },
+		GenerateFunc: func(context.Context, string) (string, error) { return "ok", nil },
+	}
+	assert.Equal(t, Provider(mock), NewFaultProvider(mock, nil, 0, 0), "not wrapped without faults")
+
+	t.Run("faults of all kinds", func(t *testing.T) {
+		tests := []struct {
+			kind      FaultKind
+			status    int
+			retryable bool
+			msg       string
+		}{
+			{FaultTimeout, 0, true, "injected timeout: context deadline exceeded"},
+			{FaultError, 500, true, "injected server error"},
+			{FaultRateLimit, 429, true, "injected rate limit"},
+			{FaultEmpty, 0, true, "injected empty response"},
+			{FaultAuth, 401, false, "injected auth failure"},
+		}
+		for _, tt := range tests {
+			p := NewFaultProvider(mock, []Fault{{Kind: tt.kind, Rate: 1}}, 1, time.Millisecond)
+			assert.Equal(t, "OpenAI", p.Name())
+			assert.True(t, p.Enabled())
+			_, err := p.Generate(context.Background(), "prompt")
+			require.EqualError(t, err, tt.msg)
+			var perr *Error
+			require.ErrorAs(t, err, &perr)
+			assert.Equal(t, "OpenAI", perr.Provider)
+			assert.Equal(t, tt.status, perr.Status, tt.kind)
+			assert.Equal(t, tt.retryable, isRetryableError(err), tt.kind)
+		}
+		_, err := NewFaultProvider(mock, []Fault{{Kind: FaultTimeout, Rate: 1}}, 1, time.Millisecond).Generate(context.Background(), "")
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("rate of faults", func(t *testing.T) {
+		p := NewFaultProvider(mock, []Fault{{Kind: FaultTimeout, Rate: 0.3}, {Kind: FaultRateLimit, Rate: 0.2}}, 42, time.Nanosecond)
+		failed := map[int]int{}
+		for range 1000 {
+			resp, err := GenerateResponse(context.Background(), p, "prompt")
+			var perr *Error
+			switch {
+			case errors.As(err, &perr):
+				failed[perr.Status]++
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, "ok", resp.Text)
+				failed[-1]++
+			}
+		}
+		assert.InDelta(t, 300, failed[0], 50, "timeouts")
+		assert.InDelta(t, 200, failed[429], 50, "rate limits")
+		assert.InDelta(t, 500, failed[-1], 50, "successful requests")
+	})
+
+	t.Run("same seed, same faults", func(t *testing.T) {
+		other := &mocks.ProviderMock{
+			NameFunc:     func() string { return "Anthropic" },
+			GenerateFunc: func(context.Context, string) (string, error) { return "ok", nil },
+		}
+		sequence := func(p Provider) []bool {
+			p = NewFaultProvider(p, []Fault{{Kind: FaultError, Rate: 0.5}}, 7, 0)
+			var res []bool
+			for range 20 {
+				_, err := p.Generate(context.Background(), "prompt")
+				res = append(res, err != nil)
+			}
+			return res
+		}
+		assert.Equal(t, sequence(mock), sequence(mock))
+		assert.NotEqual(t, sequence(mock), sequence(other), "sequence differs per provider")
+	})
+
+	t.Run("timeout waits for deadline", func(t *testing.T) {
+		p := NewFaultProvider(mock, []Fault{{Kind: FaultTimeout, Rate: 1}}, 1, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		st := time.Now()
+		_, err := p.Generate(ctx, "prompt")
+		require.EqualError(t, err, "injected timeout: context deadline exceeded")
+		assert.GreaterOrEqual(t, time.Since(st), 50*time.Millisecond)
+	})
+
+	t.Run("timeout waits for delay", func(t *testing.T) {
+		p := NewFaultProvider(mock, []Fault{{Kind: FaultTimeout, Rate: 1}}, 1, 50*time.Millisecond)
+		st := time.Now()
+		_, err := p.Generate(context.Background(), "prompt")
+		require.EqualError(t, err, "injected timeout: context deadline exceeded")
+		assert.GreaterOrEqual(t, time.Since(st), 50*time.Millisecond)
+	})
+
+	t.Run("timeout canceled", func(t *testing.T) {
+		p := NewFaultProvider(mock, []Fault{{Kind: FaultTimeout, Rate: 1}}, 1, time.Minute)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := p.Generate(ctx, "prompt")
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("wrap providers", func(t *testing.T) {
+		other := &mocks.ProviderMock{NameFunc: func() string { return "Anthropic" }}
+		res := WrapProvidersWithFaults([]Provider{mock, other}, map[string][]Fault{"openai": {{Kind: FaultAuth, Rate: 1}}}, 0, 0)
+		require.Len(t, res, 2)
+		assert.IsType(t, &FaultProvider{}, res[0])
+		assert.Equal(t, Provider(other), res[1])
+	})
+}
@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// Fixture is a recorded provider response, stored as a JSON file in the fixtures directory
+type Fixture struct {
+	Provider  string `json:"provider"`
+	Prompt    string `json:"prompt"`
+	Text      string `json:"text"`
+	Reasoning string `json:"reasoning,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+
+	Model        string `json:"model,omitempty"`
+	FinishReason string `json:"finish_reason,omitempty"`
+	RequestID    string `json:"request_id,omitempty"`
+}
+
+// FixtureProvider wraps a provider to record its responses to a fixtures directory, or to replay
+// previously recorded responses without calling the provider at all. Fixtures are looked up by
+// the provider name and the exact prompt, so replay is deterministic and works offline.
+type FixtureProvider struct {
+	provider Provider
+	dir      string
+	replay   bool // replay recorded responses instead of recording them
+}
+
+// NewRecordingProvider creates a provider wrapper saving successful responses to the dir
+func NewRecordingProvider(p Provider, dir string) Provider {
+	return &FixtureProvider{provider: p, dir: dir}
+}
+
+// NewReplayingProvider creates a provider wrapper returning responses recorded in the dir.
+// The wrapped provider is never called.
+func NewReplayingProvider(p Provider, dir string) Provider {
+	return &FixtureProvider{provider: p, dir: dir, replay: true}
+}
+
+// WrapProvidersWithRecording wraps multiple providers with recording of responses
+func WrapProvidersWithRecording(providers []Provider, dir string) []Provider {
+	wrapped := make([]Provider, len(providers))
+	for i, p := range providers {
+		wrapped[i] = NewRecordingProvider(p, dir)
+	}
+	return wrapped
+}
+
+// WrapProvidersWithReplay wraps multiple providers with replay of recorded responses
+func WrapProvidersWithReplay(providers []Provider, dir string) []Provider {
+	wrapped := make([]Provider, len(providers))
+	for i, p := range providers {
+		wrapped[i] = NewReplayingProvider(p, dir)
+	}
+	return wrapped
+}
+
+// Name returns the provider name
+func (f *FixtureProvider) Name() string {
+	return f.provider.Name()
+}
+
+// Enabled returns whether this provider is enabled
+func (f *FixtureProvider) Enabled() bool {
+	return f.provider.Enabled()
+}
+
+// Generate sends a prompt to the provider and records the response, or replays the recorded one
+func (f *FixtureProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := f.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// GenerateResponse sends a prompt to the provider and records the response, or replays the recorded one.
+// Failed requests are not recorded.
+func (f *FixtureProvider) GenerateResponse(ctx context.Context, prompt string) (Response, error) {
+	file := FixturePath(f.dir, f.Name(), prompt)
+	if f.replay {
+		return f.load(file)
+	}
+
+	resp, err := GenerateResponse(ctx, f.provider, prompt)
+	if err != nil {
+		return resp, err
+	}
+	fx := Fixture{Provider: f.Name(), Prompt: prompt, Text: resp.Text, Reasoning: resp.Reasoning, Truncated: resp.Truncated,
+		Model: resp.Model, FinishReason: resp.FinishReason, RequestID: resp.RequestID}
+	if err := saveFixture(file, fx); err != nil {
+		// the response is fine, failed recording shouldn't fail the request
+		lgr.Printf("[WARN] failed to record %s response: %v", f.Name(), err)
+		return resp, nil
+	}
+	lgr.Printf("[DEBUG] recorded %s response to %s", f.Name(), file)
+	return resp, nil
+}
+
+// load reads the recorded response from the fixture file
+func (f *FixtureProvider) load(file string) (Response, error) {
+	data, err := os.ReadFile(file) //nolint:gosec // fixture path is built from the user-provided dir
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Response{}, &Error{Provider: f.Name(), Message: fmt.Sprintf("no recorded response for this prompt, expected %s", file)}
+		}
+		return Response{}, &Error{Provider: f.Name(), Message: "failed to read fixture", Err: err}
+	}
+	var fx Fixture
+	if err := json.Unmarshal(data, &fx); err != nil {
+		return Response{}, &Error{Provider: f.Name(), Message: fmt.Sprintf("invalid fixture %s", file), Err: err}
+	}
+	lgr.Printf("[DEBUG] replayed %s response from %s", f.Name(), file)
+	return Response{Text: fx.Text, Reasoning: fx.Reasoning, Truncated: fx.Truncated,
+		Model: fx.Model, FinishReason: fx.FinishReason, RequestID: fx.RequestID}, nil
+}
+
+// FixturePath returns the path of the fixture file for the provider and prompt.
+// The name has the provider name and a hash of the prompt, so the same request always maps to the same file.
+func FixturePath(dir, providerName, prompt string) string {
+	h := sha256.Sum256([]byte(providerName + "\n" + prompt))
+	name := strings.ToLower(strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' || r == ':' {
+			return '_'
+		}
+		return r
+	}, providerName))
+	return filepath.Join(dir, name+"-"+hex.EncodeToString(h[:8])+".json")
+}
+
+// saveFixture writes the fixture file, creating the directory if needed
+func saveFixture(file string, fx Fixture) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		return fmt.Errorf("failed to create fixtures directory: %w", err)
+	}
+	data, err := json.MarshalIndent(fx, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal fixture: %w", err)
+	}
+	if err := os.WriteFile(file, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixtureProvider_RecordAndReplay(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "fixtures")
+
+	p := &partsProvider{responses: []Response{{Text: "recorded answer", Reasoning: "thinking", Truncated: true}}}
+	resp, err := NewRecordingProvider(p, dir).(*FixtureProvider).GenerateResponse(context.Background(), "q")
+	require.NoError(t, err)
+	assert.Equal(t, "recorded answer", resp.Text)
+	assert.FileExists(t, FixturePath(dir, "parts", "q"))
+
+	// replay doesn't call the provider
+	replayed := &partsProvider{}
+	resp, err = NewReplayingProvider(replayed, dir).(*FixtureProvider).GenerateResponse(context.Background(), "q")
+	require.NoError(t, err)
+	assert.Equal(t, Response{Text: "recorded answer", Reasoning: "thinking", Truncated: true}, resp)
+	assert.Empty(t, replayed.prompts)
+
+	t.Run("replay of unknown prompt", func(t *testing.T) {
+		_, err := NewReplayingProvider(replayed, dir).Generate(context.Background(), "other")
+		require.ErrorContains(t, err, "no recorded response for this prompt")
+		var perr *Error
+		require.True(t, errors.As(err, &perr))
+		assert.False(t, perr.Retryable)
+		assert.Equal(t, "parts", perr.Provider)
+	})
+
+	t.Run("invalid fixture", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(FixturePath(dir, "parts", "bad"), []byte("{bad"), 0o600))
+		_, err := NewReplayingProvider(replayed, dir).Generate(context.Background(), "bad")
+		require.ErrorContains(t, err, "invalid fixture")
+	})
+
+	t.Run("failed request not recorded", func(t *testing.T) {
+		p := &partsProvider{responses: []Response{{}}, errs: []error{errors.New("api error")}}
+		_, err := NewRecordingProvider(p, dir).Generate(context.Background(), "failed")
+		require.EqualError(t, err, "api error")
+		assert.NoFileExists(t, FixturePath(dir, "parts", "failed"))
+	})
+}
+
+func TestWrapProvidersWithFixtures(t *testing.T) {
+	providers := []Provider{&partsProvider{}}
+	recording := WrapProvidersWithRecording(providers, "dir")
+	require.Len(t, recording, 1)
+	assert.False(t, recording[0].(*FixtureProvider).replay)
+	assert.Equal(t, "parts", recording[0].Name())
+	assert.True(t, recording[0].Enabled())
+
+	replaying := WrapProvidersWithReplay(providers, "dir")
+	require.Len(t, replaying, 1)
+	assert.True(t, replaying[0].(*FixtureProvider).replay)
+}
+
+func TestFixturePath(t *testing.T) {
+	path := FixturePath("fixtures", "My Provider/v1", "prompt")
+	assert.Equal(t, "fixtures", filepath.Dir(path))
+	assert.Regexp(t, `^my_provider_v1-[0-9a-f]{16}\.json$`, filepath.Base(path))
+	assert.Equal(t, path, FixturePath("fixtures", "My Provider/v1", "prompt"), "stable for the same request")
+	assert.NotEqual(t, path, FixturePath("fixtures", "My Provider/v1", "prompt2"))
+	assert.NotEqual(t, path, FixturePath("fixtures", "Other", "prompt"))
+}
@@ -4,30 +4,46 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/go-pkgz/lgr"
 	"google.golang.org/genai"
 )
 
 // Google implements Provider interface for Google's Gemini models
 type Google struct {
-	client    *genai.Client
-	model     string
-	enabled   bool
-	maxTokens int
+	client            *genai.Client
+	model             string
+	enabled           bool
+	maxTokens         int
+	stop              []string      // stop sequences
+	generationTimeout time.Duration // max time of a single generation request, 0 for no limit
 }
 
 // NewGoogle creates a new Google provider
 func NewGoogle(opts Options) *Google {
 	// quick validation for direct constructor usage (without CreateProvider)
-	if opts.APIKey == "" || !opts.Enabled || opts.Model == "" {
+	if (opts.APIKey == "" && !opts.Vertex.Enabled) || !opts.Enabled || opts.Model == "" {
 		return &Google{enabled: false}
 	}
 
 	ctx := context.Background()
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  opts.APIKey,
-		Backend: genai.BackendGeminiAPI,
-	})
+	cfg := &genai.ClientConfig{
+		APIKey:     opts.APIKey,
+		Backend:    genai.BackendGeminiAPI,
+		HTTPClient: newHTTPClient(opts.Timeouts.Connect),
+	}
+	if opts.Vertex.Enabled {
+		vc, err := newVertexClient(ctx, opts.Vertex, opts.Timeouts.Connect)
+		if err != nil {
+			lgr.Printf("[WARN] google provider can't use vertex AI: %v", err)
+			return &Google{enabled: false}
+		}
+		cfg = &genai.ClientConfig{Backend: genai.BackendVertexAI, Project: vc.project, Location: vc.location,
+			HTTPClient: vc.client}
+	}
+	client, err := genai.NewClient(ctx, cfg)
 	if err != nil {
 		return &Google{enabled: false}
 	}
@@ -40,10 +56,12 @@ func NewGoogle(opts Options) *Google {
 	// if maxTokens is 0, we'll use the model's maximum (API will determine the limit)
 
 	return &Google{
-		client:    client,
-		model:     opts.Model,
-		enabled:   true,
-		maxTokens: maxTokens,
+		client:            client,
+		model:             opts.Model,
+		enabled:           true,
+		maxTokens:         maxTokens,
+		stop:              opts.Stop,
+		generationTimeout: opts.Timeouts.Generation,
 	}
 }
 
@@ -54,10 +72,22 @@ func (g *Google) Name() string {
 
 // Generate sends a prompt to Google and returns the generated text
 func (g *Google) Generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := g.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// GenerateResponse sends a prompt to Google and returns the generated text with response metadata
+func (g *Google) GenerateResponse(ctx context.Context, prompt string) (Response, error) {
 	if !g.enabled {
-		return "", errors.New("google provider is not enabled")
+		return Response{}, errors.New("google provider is not enabled")
 	}
 
+	ctx, cancel := generationContext(ctx, g.generationTimeout)
+	defer cancel()
+
 	// prepare content for request
 	content := &genai.Content{
 		Parts: []*genai.Part{
@@ -67,33 +97,121 @@ func (g *Google) Generate(ctx context.Context, prompt string) (string, error) {
 
 	// prepare generation config
 	var config *genai.GenerateContentConfig
-	if g.maxTokens > 0 {
+	limit := maxTokensFor(ctx, g.maxTokens)
+	if limit > 0 || len(g.stop) > 0 {
+		config = &genai.GenerateContentConfig{StopSequences: g.stop}
+	}
+	if limit > 0 {
 		// only set max output tokens if not zero (0 means use model's maximum)
-		maxTokens := int32(g.maxTokens)
-		if g.maxTokens > 2147483647 { // max int32 value
+		maxTokens := int32(limit)
+		if limit > 2147483647 { // max int32 value
 			maxTokens = 2147483647
 		}
-		config = &genai.GenerateContentConfig{
-			MaxOutputTokens: maxTokens,
-		}
+		config.MaxOutputTokens = maxTokens
 	}
 
 	resp, err := g.client.Models.GenerateContent(ctx, g.model, []*genai.Content{content}, config)
 	if err != nil {
-		// sanitize any potential sensitive information in error
-		return "", fmt.Errorf("google api error: %w", err)
+		return Response{}, g.apiError(err)
 	}
 
 	// extract text from response
 	text := resp.Text()
 	if text == "" {
-		return "", errors.New("google returned empty response")
+		return Response{}, emptyResponseError(g.Name(), "google returned empty response")
 	}
 
-	return text, nil
+	res := Response{Text: text, Model: resp.ModelVersion, RequestID: resp.ResponseID}
+	if len(resp.Candidates) > 0 {
+		res.FinishReason = string(resp.Candidates[0].FinishReason)
+		res.Truncated = resp.Candidates[0].FinishReason == genai.FinishReasonMaxTokens
+	}
+	if u := resp.UsageMetadata; u != nil {
+		res.Usage = Usage{InputTokens: int(u.PromptTokenCount), OutputTokens: int(u.CandidatesTokenCount + u.ThoughtsTokenCount)}
+	}
+	return res, nil
+}
+
+// DefaultGoogleEmbeddingModel defines the model used to create embeddings with Google
+const DefaultGoogleEmbeddingModel = "text-embedding-004"
+
+// Embed creates embedding vectors for the given texts
+func (g *Google) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if !g.enabled {
+		return nil, errors.New("google provider is not enabled")
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	contents := make([]*genai.Content, 0, len(texts))
+	for _, text := range texts {
+		contents = append(contents, genai.NewContentFromText(text, genai.RoleUser))
+	}
+
+	resp, err := g.client.Models.EmbedContent(ctx, DefaultGoogleEmbeddingModel, contents, nil)
+	if err != nil {
+		return nil, g.apiError(err)
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("google returned %d embeddings for %d texts", len(resp.Embeddings), len(texts))
+	}
+
+	res := make([][]float32, len(resp.Embeddings))
+	for i, e := range resp.Embeddings {
+		if e != nil {
+			res[i] = e.Values
+		}
+	}
+	return res, nil
+}
+
+// CountTokens returns the number of tokens of the prompt, counted by Gemini countTokens API
+func (g *Google) CountTokens(ctx context.Context, prompt string) (int, error) {
+	if !g.enabled {
+		return 0, errors.New("google provider is not enabled")
+	}
+	contents := []*genai.Content{genai.NewContentFromText(prompt, genai.RoleUser)}
+	resp, err := g.client.Models.CountTokens(ctx, g.model, contents, nil)
+	if err != nil {
+		return 0, g.apiError(err)
+	}
+	return int(resp.TotalTokens), nil
 }
 
 // Enabled returns whether this provider is enabled
 func (g *Google) Enabled() bool {
 	return g.enabled
 }
+
+// apiError converts an error of google API call to a provider error, with HTTP status
+// and status name (e.g. "RESOURCE_EXHAUSTED") taken from the API error if available, and the retry delay
+// from RetryInfo of its details
+func (g *Google) apiError(err error) *Error {
+	res := &Error{Provider: g.Name(), Message: "google api error", Err: err, Retryable: isRetryableError(err)}
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		res.Status = apiErr.Code
+		res.Code = apiErr.Status
+		res.Retryable = isRetryableStatus(apiErr.Code)
+		res.Body = bodyExcerpt([]byte(apiErr.Message))
+		res.RetryAfter = googleRetryDelay(apiErr.Details)
+	}
+	return res
+}
+
+// googleRetryDelay returns the retry delay of google.rpc.RetryInfo in error details, like
+// {"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "37s"}, 0 if not reported
+func googleRetryDelay(details []map[string]any) time.Duration {
+	for _, d := range details {
+		if t, _ := d["@type"].(string); !strings.HasSuffix(t, "google.rpc.RetryInfo") {
+			continue
+		}
+		if v, ok := d["retryDelay"].(string); ok {
+			if delay, err := time.ParseDuration(v); err == nil && delay > 0 {
+				return delay
+			}
+		}
+	}
+	return 0
+}
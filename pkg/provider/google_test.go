@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -132,6 +133,9 @@ func TestGoogle_Generate_Success(t *testing.T) {
 					"index":        0,
 				},
 			},
+			"modelVersion":  "gemini-1.5-pro-002",
+			"responseId":    "resp-123",
+			"usageMetadata": map[string]any{"promptTokenCount": 12, "candidatesTokenCount": 30, "thoughtsTokenCount": 8},
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -145,6 +149,11 @@ func TestGoogle_Generate_Success(t *testing.T) {
 	response, err := provider.Generate(context.Background(), "test prompt")
 	require.NoError(t, err)
 	assert.Equal(t, "This is a test response", response)
+
+	resp, err := provider.GenerateResponse(context.Background(), "test prompt")
+	require.NoError(t, err)
+	assert.Equal(t, Response{Text: "This is a test response", Model: "gemini-1.5-pro-002", FinishReason: "STOP",
+		RequestID: "resp-123", Usage: Usage{InputTokens: 12, OutputTokens: 38}}, resp)
 }
 
 func TestGoogle_Generate_EmptyResponse(t *testing.T) {
@@ -307,12 +316,34 @@ func TestGoogle_Generate_MaxTokensEdgeCases(t *testing.T) {
 	}
 }
 
+func TestGoogle_Generate_Stop(t *testing.T) {
+	server := mockGoogleServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var reqBody map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&reqBody))
+		genConfig, ok := reqBody["generationConfig"].(map[string]any)
+		require.True(t, ok, "generationConfig not found in request")
+		assert.Equal(t, []any{"END"}, genConfig["stopSequences"])
+		assert.NotContains(t, genConfig, "maxOutputTokens")
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"candidates": [{"content": {"parts": [{"text": "stopped"}], "role": "model"}, "finishReason": "STOP"}]}`))
+	})
+	defer server.Close()
+
+	provider := createGoogleProviderWithMockServer(t, server, "gemini-1.5-pro", 0)
+	provider.stop = []string{"END"}
+	response, err := provider.Generate(context.Background(), "test prompt")
+	require.NoError(t, err)
+	assert.Equal(t, "stopped", response)
+}
+
 func TestGoogle_Generate_DifferentFinishReasons(t *testing.T) {
 	tests := []struct {
-		name         string
-		finishReason string
-		expected     string
-		wantError    bool
+		name          string
+		finishReason  string
+		expected      string
+		wantError     bool
+		wantTruncated bool
 	}{
 		{
 			name:         "finish reason stop",
@@ -321,10 +352,11 @@ func TestGoogle_Generate_DifferentFinishReasons(t *testing.T) {
 			wantError:    false,
 		},
 		{
-			name:         "finish reason max tokens",
-			finishReason: "MAX_TOKENS",
-			expected:     "Hit max tokens limit",
-			wantError:    false,
+			name:          "finish reason max tokens",
+			finishReason:  "MAX_TOKENS",
+			expected:      "Hit max tokens limit",
+			wantError:     false,
+			wantTruncated: true,
 		},
 		{
 			name:         "finish reason other",
@@ -359,12 +391,13 @@ func TestGoogle_Generate_DifferentFinishReasons(t *testing.T) {
 
 			provider := createGoogleProviderWithMockServer(t, server, "gemini-1.5-pro", 0)
 
-			response, err := provider.Generate(context.Background(), "test prompt")
+			response, err := provider.GenerateResponse(context.Background(), "test prompt")
 			if tt.wantError {
 				require.Error(t, err)
 			} else {
 				require.NoError(t, err)
-				assert.Equal(t, tt.expected, response)
+				assert.Equal(t, tt.expected, response.Text)
+				assert.Equal(t, tt.wantTruncated, response.Truncated)
 			}
 		})
 	}
@@ -433,6 +466,13 @@ func TestGoogle_Generate_RateLimitError(t *testing.T) {
 	_, err := provider.Generate(context.Background(), "test prompt")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "google api error")
+
+	var perr *Error
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, "Google", perr.Provider)
+	assert.Equal(t, http.StatusTooManyRequests, perr.Status)
+	assert.Equal(t, "RESOURCE_EXHAUSTED", perr.Code)
+	assert.True(t, perr.Retryable)
 }
 
 func TestGoogle_Generate_ModelNotFoundError(t *testing.T) {
@@ -653,3 +693,73 @@ func TestGoogle_Generate_LongResponse(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, longText, response)
 }
+
+func TestGoogle_Embed(t *testing.T) {
+	server := mockGoogleServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.URL.Path, DefaultGoogleEmbeddingModel)
+		response := map[string]any{
+			"embeddings": []map[string]any{
+				{"values": []float32{0.1, 0.2}},
+				{"values": []float32{0.3, 0.4}},
+			},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(response))
+	})
+	defer server.Close()
+
+	provider := createGoogleProviderWithMockServer(t, server, "gemini-1.5-pro", 0)
+	res, err := provider.Embed(context.Background(), []string{"first", "second"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{0.1, 0.2}, {0.3, 0.4}}, res)
+
+	_, err = (&Google{}).Embed(context.Background(), []string{"first"})
+	require.EqualError(t, err, "google provider is not enabled")
+}
+
+func TestGoogle_CountTokens(t *testing.T) {
+	server := mockGoogleServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.URL.Path, "gemini-1.5-pro:countTokens")
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]any{"totalTokens": 42}))
+	})
+	defer server.Close()
+
+	provider := createGoogleProviderWithMockServer(t, server, "gemini-1.5-pro", 0)
+	n, err := provider.CountTokens(context.Background(), "test prompt")
+	require.NoError(t, err)
+	assert.Equal(t, 42, n)
+
+	_, err = (&Google{}).CountTokens(context.Background(), "test prompt")
+	require.EqualError(t, err, "google provider is not enabled")
+}
+
+func TestGoogle_Generate_RetryDelay(t *testing.T) {
+	server := mockGoogleServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error": {"code": 429, "message": "You exceeded your current quota", "status": "RESOURCE_EXHAUSTED",
+			"details": [
+				{"@type": "type.googleapis.com/google.rpc.QuotaFailure", "violations": [{"quotaMetric": "requests"}]},
+				{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "37s"}
+			]}}`))
+	})
+	defer server.Close()
+
+	provider := createGoogleProviderWithMockServer(t, server, "gemini-1.5-pro", 0)
+	_, err := provider.Generate(context.Background(), "test prompt")
+	require.Error(t, err)
+	var perr *Error
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, "RESOURCE_EXHAUSTED", perr.Code)
+	assert.True(t, perr.Retryable)
+	assert.Equal(t, 37*time.Second, perr.RetryAfter)
+}
+
+func TestGoogleRetryDelay(t *testing.T) {
+	assert.Zero(t, googleRetryDelay(nil))
+	assert.Zero(t, googleRetryDelay([]map[string]any{{"@type": "type.googleapis.com/google.rpc.ErrorInfo", "retryDelay": "5s"}}))
+	assert.Zero(t, googleRetryDelay([]map[string]any{{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "bad"}}))
+	assert.Equal(t, 1500*time.Millisecond,
+		googleRetryDelay([]map[string]any{{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "1.5s"}}))
+}
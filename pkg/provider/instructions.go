@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"context"
+	"strings"
+)
+
+// InstructionsProvider wraps a provider to prefix each prompt with standing instructions of the provider,
+// like a style guide or output format constraints, or to append them to each prompt
+type InstructionsProvider struct {
+	provider     Provider
+	instructions string
+	trailing     bool // instructions are put after the prompt
+}
+
+// NewInstructionsProvider makes a provider prefixing prompts with the instructions, the provider is returned
+// as is if instructions are empty
+func NewInstructionsProvider(p Provider, instructions string) Provider {
+	instructions = strings.TrimSpace(instructions)
+	if instructions == "" {
+		return p
+	}
+	return &InstructionsProvider{provider: p, instructions: instructions}
+}
+
+// NewTrailingInstructionsProvider makes a provider appending the instructions to prompts, so they are the last
+// thing the model reads after long contexts. The provider is returned as is if instructions are empty.
+func NewTrailingInstructionsProvider(p Provider, instructions string) Provider {
+	instructions = strings.TrimSpace(instructions)
+	if instructions == "" {
+		return p
+	}
+	return &InstructionsProvider{provider: p, instructions: instructions, trailing: true}
+}
+
+// Name returns the provider name
+func (i *InstructionsProvider) Name() string {
+	return i.provider.Name()
+}
+
+// Enabled returns whether this provider is enabled
+func (i *InstructionsProvider) Enabled() bool {
+	return i.provider.Enabled()
+}
+
+// Generate sends the prompt with the instructions to the provider
+func (i *InstructionsProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	return i.provider.Generate(ctx, i.apply(prompt))
+}
+
+// GenerateResponse sends the prompt with the instructions to the provider
+func (i *InstructionsProvider) GenerateResponse(ctx context.Context, prompt string) (Response, error) {
+	return GenerateResponse(ctx, i.provider, i.apply(prompt))
+}
+
+// apply returns the prompt with the instructions put before it, or after it for trailing instructions
+func (i *InstructionsProvider) apply(prompt string) string {
+	if i.trailing {
+		return prompt + "\n\n" + i.instructions
+	}
+	return i.instructions + "\n\n" + prompt
+}
@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider/mocks"
+)
+
+func TestInstructionsProvider(t *testing.T) {
+	var prompts []string
+	mock := &mocks.ProviderMock{
+		NameFunc:    func() string { return "OpenAI" },
+		EnabledFunc: func() bool { return true },
+		GenerateFunc: func(_ context.Context, prompt string) (string, error) {
+			prompts = append(prompts, prompt)
+			return "ok", nil
+		},
+	}
+	assert.Equal(t, Provider(mock), NewInstructionsProvider(mock, ""), "not wrapped without instructions")
+	assert.Equal(t, Provider(mock), NewInstructionsProvider(mock, " \n"), "not wrapped with blank instructions")
+
+	p := NewInstructionsProvider(mock, "answer in markdown\n")
+	assert.Equal(t, "OpenAI", p.Name())
+	assert.True(t, p.Enabled())
+
+	_, err := p.Generate(context.Background(), "review the code")
+	require.NoError(t, err)
+	resp, err := GenerateResponse(context.Background(), p, "merge results")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp.Text)
+
+	assert.Equal(t, []string{"answer in markdown\n\nreview the code", "answer in markdown\n\nmerge results"}, prompts)
+}
+
+func TestTrailingInstructionsProvider(t *testing.T) {
+	var prompts []string
+	mock := &mocks.ProviderMock{
+		NameFunc:    func() string { return "Anthropic" },
+		EnabledFunc: func() bool { return true },
+		GenerateFunc: func(_ context.Context, prompt string) (string, error) {
+			prompts = append(prompts, prompt)
+			return "ok", nil
+		},
+	}
+	assert.Equal(t, Provider(mock), NewTrailingInstructionsProvider(mock, "\n"), "not wrapped with blank instructions")
+
+	p := NewTrailingInstructionsProvider(NewInstructionsProvider(mock, "be brief"), "keep it under 100 words\n")
+	_, err := p.Generate(context.Background(), "review the code")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"be brief\n\nreview the code\n\nkeep it under 100 words"}, prompts)
+}
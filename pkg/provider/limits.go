@@ -0,0 +1,24 @@
+package provider
+
+import "context"
+
+// maxTokensKey is the context key of the max tokens override
+type maxTokensKey struct{}
+
+// WithMaxTokens returns a child context overriding max tokens of providers for requests made with it, to limit
+// a single request, like the merge of mix mode, without creating another provider. Limits of 0 or less are ignored.
+// The override is applied by OpenAI, OpenAI-compatible, Anthropic and Google providers of this package.
+func WithMaxTokens(ctx context.Context, n int) context.Context {
+	if n <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, maxTokensKey{}, n)
+}
+
+// maxTokensFor returns max tokens of the request, the override of the context if set, maxTokens of the provider otherwise
+func maxTokensFor(ctx context.Context, maxTokens int) int {
+	if n, ok := ctx.Value(maxTokensKey{}).(int); ok {
+		return n
+	}
+	return maxTokens
+}
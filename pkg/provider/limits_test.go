@@ -0,0 +1,30 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithMaxTokens(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, 100, maxTokensFor(ctx, 100), "provider limit without override")
+	assert.Equal(t, 50, maxTokensFor(WithMaxTokens(ctx, 50), 100))
+	assert.Equal(t, 2000, maxTokensFor(WithMaxTokens(ctx, 2000), 100), "override raises the limit as well")
+	assert.Equal(t, 300, maxTokensFor(WithMaxTokens(ctx, 300), 0), "override of model maximum")
+	assert.Equal(t, ctx, WithMaxTokens(ctx, 0), "zero ignored")
+	assert.Equal(t, ctx, WithMaxTokens(ctx, -1), "negative ignored")
+}
+
+func TestWithMaxTokens_OpenAIRequests(t *testing.T) {
+	ctx := WithMaxTokens(context.Background(), 50)
+
+	o := &OpenAI{model: "gpt-4o", maxTokens: 100, temperature: -1}
+	assert.Equal(t, 100, o.buildChatCompletionRequest(context.Background(), "test").MaxTokens)
+	assert.Equal(t, 50, o.buildChatCompletionRequest(ctx, "test").MaxTokens)
+	assert.Equal(t, 50, o.buildResponsesRequest(ctx, "test").MaxOutputTokens)
+
+	o = &OpenAI{model: "o3-mini", maxTokens: 100, temperature: -1}
+	assert.Equal(t, 50, o.buildChatCompletionRequest(ctx, "test").MaxCompletionTokens, "reasoning model")
+}
@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// DefaultModelsTTL is how long discovered model lists are used before they are refreshed
+const DefaultModelsTTL = 24 * time.Hour
+
+// ModelCache discovers models served by OpenAI-compatible APIs with GET /models and caches the lists on disk,
+// so local gateways are not asked on every invocation. Lists older than TTL are still returned, and refreshed
+// in the background for the next invocations.
+type ModelCache struct {
+	dir    string
+	ttl    time.Duration
+	client *http.Client
+	now    func() time.Time
+	wg     sync.WaitGroup
+}
+
+// cachedModels is the cache file of the model list discovered at the URL
+type cachedModels struct {
+	URL     string    `json:"url"`
+	Fetched time.Time `json:"fetched"`
+	Models  []string  `json:"models"`
+}
+
+// NewModelCache makes a model cache in the directory, with the user cache directory used if empty.
+// Non-positive ttl means DefaultModelsTTL.
+func NewModelCache(dir string, ttl time.Duration) *ModelCache {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "mpt-models")
+		if userDir, err := os.UserCacheDir(); err == nil {
+			dir = filepath.Join(userDir, "mpt", "models")
+		}
+	}
+	if ttl <= 0 {
+		ttl = DefaultModelsTTL
+	}
+	return &ModelCache{dir: dir, ttl: ttl, client: &http.Client{Timeout: 10 * time.Second}, now: time.Now}
+}
+
+// Models returns sorted models served at the base URL. The cached list is returned if there is one, with
+// the refresh of a list older than TTL started in the background. Missing lists are discovered right away.
+func (c *ModelCache) Models(ctx context.Context, baseURL, apiKey string) ([]string, error) {
+	if cached, ok := c.load(baseURL); ok {
+		if c.now().Sub(cached.Fetched) >= c.ttl {
+			c.wg.Add(1)
+			go func() {
+				defer c.wg.Done()
+				if _, err := c.refresh(context.WithoutCancel(ctx), baseURL, apiKey); err != nil {
+					lgr.Printf("[DEBUG] failed to refresh models of %s: %v", baseURL, err)
+				}
+			}()
+		}
+		return cached.Models, nil
+	}
+	return c.refresh(ctx, baseURL, apiKey)
+}
+
+// Cached returns the cached model list of the base URL, regardless of its age, without discovering it
+func (c *ModelCache) Cached(baseURL string) []string {
+	cached, _ := c.load(baseURL)
+	return cached.Models
+}
+
+// Wait waits for background refreshes to complete
+func (c *ModelCache) Wait() {
+	c.wg.Wait()
+}
+
+// refresh discovers models of the base URL and writes them to the cache
+func (c *ModelCache) refresh(ctx context.Context, baseURL, apiKey string) ([]string, error) {
+	models, err := DiscoverModels(ctx, c.client, baseURL, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(cachedModels{URL: baseURL, Fetched: c.now(), Models: models})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal models: %w", err)
+	}
+	// caching is best effort, discovered models are still usable if they can't be written
+	if err := os.MkdirAll(c.dir, 0o750); err == nil {
+		path := c.path(baseURL)
+		tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+		if err := os.WriteFile(tmp, data, 0o600); err == nil {
+			_ = os.Rename(tmp, path)
+		}
+	}
+	return models, nil
+}
+
+// load reads the cached model list of the base URL
+func (c *ModelCache) load(baseURL string) (cachedModels, bool) {
+	data, err := os.ReadFile(c.path(baseURL))
+	if err != nil {
+		return cachedModels{}, false
+	}
+	var res cachedModels
+	if err := json.Unmarshal(data, &res); err != nil || res.URL != baseURL {
+		return cachedModels{}, false
+	}
+	return res, true
+}
+
+// path returns the cache file of the base URL, named by the hash of the URL
+func (c *ModelCache) path(baseURL string) string {
+	sum := sha256.Sum256([]byte(baseURL))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// DiscoverModels returns sorted IDs of models listed by GET /models of the OpenAI-compatible API
+func DiscoverModels(ctx context.Context, client *http.Client, baseURL, apiKey string) ([]string, error) {
+	url := strings.TrimSuffix(baseURL, "/") + "/models"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make models request: %w", err)
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover models: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to discover models: %s returned status %d", url, resp.StatusCode)
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode models of %s: %w", url, err)
+	}
+	res := make([]string, 0, len(list.Data))
+	for _, m := range list.Data {
+		if m.ID != "" {
+			res = append(res, m.ID)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverModels(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/models":
+			assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"qwen-3"},{"id":""},{"id":"llama-3"}]}`))
+		case "/bad/models":
+			_, _ = w.Write([]byte(`not json`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	models, err := DiscoverModels(context.Background(), ts.Client(), ts.URL+"/v1/", "key")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"llama-3", "qwen-3"}, models)
+
+	_, err = DiscoverModels(context.Background(), ts.Client(), ts.URL+"/none", "")
+	require.ErrorContains(t, err, "returned status 404")
+
+	_, err = DiscoverModels(context.Background(), ts.Client(), ts.URL+"/bad", "")
+	require.ErrorContains(t, err, "failed to decode models")
+}
+
+func TestModelCache(t *testing.T) {
+	var calls atomic.Int32
+	models := `{"data":[{"id":"m1"}]}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		_, _ = w.Write([]byte(models))
+	}))
+	defer ts.Close()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewModelCache(t.TempDir(), time.Hour)
+	cache.now = func() time.Time { return now }
+	assert.Empty(t, cache.Cached(ts.URL))
+
+	res, err := cache.Models(context.Background(), ts.URL, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m1"}, res)
+	assert.Equal(t, int32(1), calls.Load(), "missing list discovered")
+
+	res, err = cache.Models(context.Background(), ts.URL, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m1"}, res)
+	cache.Wait()
+	assert.Equal(t, int32(1), calls.Load(), "fresh list from cache")
+
+	// stale list returned and refreshed in the background
+	models, now = `{"data":[{"id":"m2"}]}`, now.Add(2*time.Hour)
+	res, err = cache.Models(context.Background(), ts.URL, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m1"}, res)
+	cache.Wait()
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, []string{"m2"}, cache.Cached(ts.URL))
+
+	t.Run("discovery error", func(t *testing.T) {
+		_, err := cache.Models(context.Background(), "http://127.0.0.1:1/v1", "")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"context"
+)
+
+// NormalizingProvider wraps a provider to post-process its answers, like removing boilerplate and
+// normalizing markdown headers, before they are mixed, compared or printed
+type NormalizingProvider struct {
+	provider  Provider
+	normalize func(answer string) string
+}
+
+// NewNormalizingProvider makes a provider passing its answers through normalize
+func NewNormalizingProvider(p Provider, normalize func(answer string) string) Provider {
+	return &NormalizingProvider{provider: p, normalize: normalize}
+}
+
+// WrapProvidersWithNormalizer wraps multiple providers with answer normalization
+func WrapProvidersWithNormalizer(providers []Provider, normalize func(answer string) string) []Provider {
+	wrapped := make([]Provider, len(providers))
+	for i, p := range providers {
+		wrapped[i] = NewNormalizingProvider(p, normalize)
+	}
+	return wrapped
+}
+
+// Name returns the provider name
+func (n *NormalizingProvider) Name() string {
+	return n.provider.Name()
+}
+
+// Enabled returns whether this provider is enabled
+func (n *NormalizingProvider) Enabled() bool {
+	return n.provider.Enabled()
+}
+
+// Generate sends the prompt to the provider and returns the normalized answer
+func (n *NormalizingProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := n.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// GenerateResponse sends the prompt to the provider and returns the response with the normalized answer
+func (n *NormalizingProvider) GenerateResponse(ctx context.Context, prompt string) (Response, error) {
+	resp, err := GenerateResponse(ctx, n.provider, prompt)
+	if err != nil {
+		return resp, err
+	}
+	resp.Text = n.normalize(resp.Text)
+	return resp, nil
+}
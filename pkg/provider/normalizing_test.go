@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider/mocks"
+)
+
+func TestNormalizingProvider(t *testing.T) {
+	mock := &mocks.ProviderMock{
+		NameFunc:    func() string { return "OpenAI" },
+		EnabledFunc: func() bool { return true },
+		GenerateFunc: func(_ context.Context, prompt string) (string, error) {
+			if prompt == "fail" {
+				return "", errors.New("server error")
+			}
+			return "Sure! " + prompt, nil
+		},
+	}
+	providers := WrapProvidersWithNormalizer([]Provider{mock}, func(answer string) string {
+		return strings.TrimPrefix(answer, "Sure! ")
+	})
+	require.Len(t, providers, 1)
+	p := providers[0]
+	assert.Equal(t, "OpenAI", p.Name())
+	assert.True(t, p.Enabled())
+
+	text, err := p.Generate(context.Background(), "answer")
+	require.NoError(t, err)
+	assert.Equal(t, "answer", text)
+	resp, err := GenerateResponse(context.Background(), p, "response")
+	require.NoError(t, err)
+	assert.Equal(t, "response", resp.Text)
+
+	_, err = p.Generate(context.Background(), "fail")
+	require.EqualError(t, err, "server error")
+}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // HTTPClient is an interface for making HTTP requests, allows for dependency injection and testing
@@ -23,15 +24,19 @@ type OpenAI struct {
 	model             string
 	enabled           bool
 	maxTokens         int
+	stop              []string // stop sequences
 	temperature       float32
-	reasoningEffort   string       // reasoning effort level (minimal, low, medium, high)
-	baseURL           string       // base URL for API (defaults to https://api.openai.com)
-	forceEndpointType EndpointType // manual endpoint selection (auto, responses, chat_completions)
+	reasoningEffort   string        // reasoning effort level (minimal, low, medium, high)
+	baseURL           string        // base URL for API (defaults to https://api.openai.com)
+	forceEndpointType EndpointType  // manual endpoint selection (auto, responses, chat_completions)
+	includeReasoning  bool          // request reasoning summaries from responses API
+	generationTimeout time.Duration // max time of a single generation request, 0 for no limit
 }
 
 // Reasoning represents reasoning configuration for responses API
 type Reasoning struct {
-	Effort string `json:"effort"` // minimal, low, medium, high
+	Effort  string `json:"effort"`            // minimal, low, medium, high
+	Summary string `json:"summary,omitempty"` // auto, concise, detailed
 }
 
 // responsesRequest represents request to OpenAI responses API
@@ -45,20 +50,35 @@ type responsesRequest struct {
 
 // responsesResponse represents response from OpenAI responses API
 type responsesResponse struct {
-	ID     string `json:"id"`
-	Status string `json:"status"`
+	ID                string `json:"id"`
+	Model             string `json:"model"`
+	Status            string `json:"status"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details,omitempty"`
 	Output []struct {
 		Type    string `json:"type"`
 		Content []struct {
 			Type string `json:"type"`
 			Text string `json:"text"`
 		} `json:"content,omitempty"`
+		Summary []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"summary,omitempty"` // reasoning summary, set for output of reasoning type
 	} `json:"output"`
-	Error *struct {
-		Message string `json:"message"`
-		Type    string `json:"type"`
-		Code    string `json:"code"`
-	} `json:"error,omitempty"`
+	Usage *struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage,omitempty"`
+	Error *apiError `json:"error,omitempty"`
+}
+
+// apiError represents error details returned by OpenAI API
+type apiError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code"`
 }
 
 // chatCompletionRequest represents request to OpenAI chat completions API
@@ -68,6 +88,20 @@ type chatCompletionRequest struct {
 	MaxTokens           int                     `json:"max_tokens,omitempty"`
 	MaxCompletionTokens int                     `json:"max_completion_tokens,omitempty"`
 	Temperature         *float32                `json:"temperature,omitempty"` // pointer to distinguish between unset and zero
+	Stop                []string                `json:"stop,omitempty"`
+	Stream              bool                    `json:"stream,omitempty"` // stream the response as server-sent events
+	StreamOptions       *streamOptions          `json:"stream_options,omitempty"`
+}
+
+// streamOptions are options of the streamed chat completions response
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"` // send token usage in the last event
+}
+
+// chatCompletionUsage is token usage of chat completions API
+type chatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
 }
 
 // chatCompletionMessage represents a message in chat completions request
@@ -85,18 +119,50 @@ type chatCompletionResponse struct {
 	Choices []struct {
 		Index   int `json:"index"`
 		Message struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
+			Role             string `json:"role"`
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content,omitempty"` // reasoning trace of deepseek-reasoner
 		} `json:"message"`
 		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
-	Error *struct {
-		Message string `json:"message"`
-		Type    string `json:"type"`
-		Code    string `json:"code"`
-	} `json:"error,omitempty"`
+	Usage *chatCompletionUsage `json:"usage,omitempty"`
+	Error *apiError            `json:"error,omitempty"`
 }
 
+// chatCompletionChunk represents an event of the streamed response of chat completions API
+type chatCompletionChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content,omitempty"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *chatCompletionUsage `json:"usage,omitempty"` // set in the last event, if requested with stream options
+	Error *apiError            `json:"error,omitempty"`
+}
+
+// embeddingsRequest represents request body for v1/embeddings endpoint
+type embeddingsRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"` // supported by text-embedding-3 and later models only
+}
+
+// embeddingsResponse represents response from v1/embeddings endpoint
+type embeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Error *apiError `json:"error,omitempty"`
+}
+
+// DefaultOpenAIEmbeddingModel defines the model used to create embeddings with OpenAI
+const DefaultOpenAIEmbeddingModel = "text-embedding-3-small"
+
 // DefaultMaxTokens defines the default value for max tokens if not specified or negative
 const DefaultMaxTokens = 1024
 
@@ -114,11 +180,8 @@ func NewOpenAI(opts Options) *OpenAI {
 		return &OpenAI{enabled: false}
 	}
 
-	// use provided HTTP client or default to standard http.Client
-	httpClient := opts.HTTPClient
-	if httpClient == nil {
-		httpClient = &http.Client{}
-	}
+	// use provided HTTP client or default to standard http.Client, both with connect timeout
+	httpClient := providerHTTPClient(opts.HTTPClient, opts.Timeouts.Connect)
 
 	// set default max tokens if not specified
 	maxTokens := opts.MaxTokens
@@ -157,10 +220,13 @@ func NewOpenAI(opts Options) *OpenAI {
 		model:             opts.Model,
 		enabled:           true,
 		maxTokens:         maxTokens,
+		stop:              opts.Stop,
 		temperature:       temperature,
 		reasoningEffort:   reasoningEffort,
 		baseURL:           baseURL,
 		forceEndpointType: forceEndpointType,
+		includeReasoning:  opts.IncludeReasoning,
+		generationTimeout: opts.Timeouts.Generation,
 	}
 }
 
@@ -169,6 +235,11 @@ func (o *OpenAI) Name() string {
 	return "OpenAI"
 }
 
+// TokenizerModel returns the model, prompts are counted locally with its tiktoken encoding
+func (o *OpenAI) TokenizerModel() string {
+	return o.model
+}
+
 // needsResponsesAPI checks if the model requires v1/responses endpoint instead of v1/chat/completions
 func (o *OpenAI) needsResponsesAPI() bool {
 	// check if endpoint type is manually forced
@@ -185,8 +256,19 @@ func (o *OpenAI) needsResponsesAPI() bool {
 	return strings.Contains(modelLower, "gpt-5")
 }
 
-// doRequest handles the common HTTP request logic for OpenAI API calls
-func (o *OpenAI) doRequest(ctx context.Context, url string, reqBody interface{}) ([]byte, error) {
+// doRequest handles the common HTTP request logic for OpenAI API calls, returns response body and HTTP status
+func (o *OpenAI) doRequest(ctx context.Context, url string, reqBody interface{}) ([]byte, int, error) {
+	resp, err := o.send(ctx, url, reqBody)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := o.readBody(resp)
+	return body, resp.StatusCode, err
+}
+
+// send posts the request body to the API and returns the response, the caller closes its body
+func (o *OpenAI) send(ctx context.Context, url string, reqBody interface{}) (*http.Response, error) {
 	// marshal request
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
@@ -208,20 +290,25 @@ func (o *OpenAI) doRequest(ctx context.Context, url string, reqBody interface{})
 	// send request
 	resp, err := o.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("openai api error: %w", err)
+		return nil, &Error{Provider: o.Name(), Message: "openai api error", Err: err, Retryable: isRetryableError(err)}
 	}
-	defer resp.Body.Close()
+	return resp, nil
+}
 
+// readBody reads the body of the response, checking its size and status
+func (o *OpenAI) readBody(resp *http.Response) ([]byte, error) {
 	// read response with size limit to prevent memory exhaustion
 	// read one extra byte to detect if response exceeds limit
 	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize+1))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, &Error{Provider: o.Name(), Status: resp.StatusCode, Message: "failed to read response",
+			Err: err, Retryable: isRetryableError(err)}
 	}
 
 	// check if response exceeded size limit
 	if len(body) > MaxResponseSize {
-		return nil, fmt.Errorf("response size exceeds maximum allowed size of %d bytes", MaxResponseSize)
+		return nil, httpError(o.Name(), resp.StatusCode, "",
+			fmt.Sprintf("response size exceeds maximum allowed size of %d bytes", MaxResponseSize), nil)
 	}
 
 	// check HTTP status code for non-JSON responses (e.g., proxy errors, cloudflare errors)
@@ -232,7 +319,8 @@ func (o *OpenAI) doRequest(ctx context.Context, url string, reqBody interface{})
 		trimmedBody := strings.TrimSpace(string(body))
 		if !strings.HasPrefix(trimmedBody, "{") && !strings.HasPrefix(trimmedBody, "[") {
 			// non-JSON error response (HTML, plain text, etc.)
-			return nil, fmt.Errorf("http %d: %s", resp.StatusCode, trimmedBody)
+			return nil, httpError(o.Name(), resp.StatusCode, "",
+				fmt.Sprintf("http %d: %s", resp.StatusCode, trimmedBody), body)
 		}
 		// otherwise, return JSON body and let parse functions handle the error
 	}
@@ -241,7 +329,8 @@ func (o *OpenAI) doRequest(ctx context.Context, url string, reqBody interface{})
 }
 
 // buildResponsesRequest creates a request body for the responses API
-func (o *OpenAI) buildResponsesRequest(prompt string) responsesRequest {
+func (o *OpenAI) buildResponsesRequest(ctx context.Context, prompt string) responsesRequest {
+	maxTokens := maxTokensFor(ctx, o.maxTokens)
 	reqBody := responsesRequest{
 		Model: o.model,
 		Input: prompt,
@@ -251,55 +340,81 @@ func (o *OpenAI) buildResponsesRequest(prompt string) responsesRequest {
 	}
 
 	// set max_output_tokens if specified (0 means use model maximum)
-	if o.maxTokens > 0 {
-		reqBody.MaxOutputTokens = o.maxTokens
+	if maxTokens > 0 {
+		reqBody.MaxOutputTokens = maxTokens
+	}
+
+	// request reasoning summary if reasoning traces are requested
+	if o.includeReasoning {
+		reqBody.Reasoning.Summary = "auto"
 	}
 
-	// note: GPT-5 doesn't support temperature parameter, so we don't set it
+	// note: GPT-5 doesn't support temperature parameter, so we don't set it.
+	// responses API doesn't support stop sequences, the text is cut on the client side
 	return reqBody
 }
 
 // parseResponsesResponse parses and validates the responses API response
-func (o *OpenAI) parseResponsesResponse(body []byte) (string, error) {
+func (o *OpenAI) parseResponsesResponse(body []byte, status int) (Response, error) {
 	var result responsesResponse
 	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+		return Response{}, o.parseError(err, status, body)
 	}
 
 	// check for error in response
 	if result.Error != nil {
-		return "", fmt.Errorf("openai api error: %s", result.Error.Message)
+		return Response{}, o.apiError(result.Error, status, "openai api error: "+result.Error.Message, body)
+	}
+
+	// check status, incomplete response due to output limit is returned as truncated
+	truncated := result.Status == "incomplete" && result.IncompleteDetails != nil &&
+		result.IncompleteDetails.Reason == "max_output_tokens"
+	if result.Status != "completed" && !truncated {
+		return Response{}, httpError(o.Name(), status, result.Status, "unexpected response status: "+result.Status, body)
 	}
 
-	// check status
-	if result.Status != "completed" {
-		return "", fmt.Errorf("unexpected response status: %s", result.Status)
+	finishReason := result.Status
+	if result.IncompleteDetails != nil && result.IncompleteDetails.Reason != "" {
+		finishReason = result.IncompleteDetails.Reason
 	}
 
-	// extract text from output array
+	// extract text and reasoning summary from output array
+	var summaries []string
 	for _, output := range result.Output {
-		if output.Type == "message" {
+		switch output.Type {
+		case "reasoning":
+			for _, summary := range output.Summary {
+				if summary.Type == "summary_text" && summary.Text != "" {
+					summaries = append(summaries, summary.Text)
+				}
+			}
+		case "message":
 			for _, content := range output.Content {
 				if content.Type == "output_text" && content.Text != "" {
-					return content.Text, nil
+					res := Response{Text: cutAtStop(content.Text, o.stop), Reasoning: strings.Join(summaries, "\n\n"),
+						Truncated: truncated, Model: result.Model, FinishReason: finishReason, RequestID: result.ID}
+					if result.Usage != nil {
+						res.Usage = Usage{InputTokens: result.Usage.InputTokens, OutputTokens: result.Usage.OutputTokens}
+					}
+					return res, nil
 				}
 			}
 		}
 	}
 
-	return "", fmt.Errorf("no output_text found in response")
+	return Response{}, httpError(o.Name(), status, "", "no output_text found in response", body)
 }
 
 // generateWithResponsesAPI calls the OpenAI v1/responses endpoint
-func (o *OpenAI) generateWithResponsesAPI(ctx context.Context, prompt string) (string, error) {
-	reqBody := o.buildResponsesRequest(prompt)
+func (o *OpenAI) generateWithResponsesAPI(ctx context.Context, prompt string) (Response, error) {
+	reqBody := o.buildResponsesRequest(ctx, prompt)
 	url := o.baseURL + "/v1/responses"
-	body, err := o.doRequest(ctx, url, reqBody)
+	body, status, err := o.doRequest(ctx, url, reqBody)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
-	return o.parseResponsesResponse(body)
+	return o.parseResponsesResponse(body, status)
 }
 
 // isReasoningModel checks if the model is a reasoning model (o1, o3, o4)
@@ -311,7 +426,8 @@ func (o *OpenAI) isReasoningModel() bool {
 }
 
 // buildChatCompletionRequest creates a request body for the chat completions API
-func (o *OpenAI) buildChatCompletionRequest(prompt string) chatCompletionRequest {
+func (o *OpenAI) buildChatCompletionRequest(ctx context.Context, prompt string) chatCompletionRequest {
+	maxTokens := maxTokensFor(ctx, o.maxTokens)
 	reqBody := chatCompletionRequest{
 		Model: o.model,
 		Messages: []chatCompletionMessage{
@@ -322,86 +438,219 @@ func (o *OpenAI) buildChatCompletionRequest(prompt string) chatCompletionRequest
 		},
 	}
 
-	// reasoning models use MaxCompletionTokens and don't support temperature
+	// reasoning models use MaxCompletionTokens and don't support temperature and stop sequences
 	if o.isReasoningModel() {
-		if o.maxTokens > 0 {
-			reqBody.MaxCompletionTokens = o.maxTokens
+		if maxTokens > 0 {
+			reqBody.MaxCompletionTokens = maxTokens
 		}
 	} else {
 		// standard models use max_tokens and support temperature
-		if o.maxTokens > 0 {
-			reqBody.MaxTokens = o.maxTokens
+		if maxTokens > 0 {
+			reqBody.MaxTokens = maxTokens
 		}
 		if o.temperature >= 0 {
 			temp := o.temperature
 			reqBody.Temperature = &temp
 		}
+		reqBody.Stop = o.stop
 	}
 
 	return reqBody
 }
 
 // parseChatCompletionResponse parses and validates the chat completion API response
-func (o *OpenAI) parseChatCompletionResponse(body []byte) (string, error) {
+func (o *OpenAI) parseChatCompletionResponse(body []byte, status int) (Response, error) {
 	var result chatCompletionResponse
 	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+		return Response{}, o.parseError(err, status, body)
 	}
 
 	// check for error in response
 	if result.Error != nil {
-		return "", o.formatChatCompletionError(result.Error)
+		return Response{}, o.formatChatCompletionError(result.Error, status, body)
 	}
 
 	// check if there are choices in response
 	if len(result.Choices) == 0 {
-		return "", errors.New("openai returned no choices - check your model configuration and prompt length")
+		return Response{}, httpError(o.Name(), status, "",
+			"openai returned no choices - check your model configuration and prompt length", body)
 	}
 
-	return result.Choices[0].Message.Content, nil
+	text := result.Choices[0].Message.Content
+	if o.isReasoningModel() {
+		text = cutAtStop(text, o.stop) // stop sequences are not sent for reasoning models
+	}
+	return Response{
+		Text:         text,
+		Reasoning:    result.Choices[0].Message.ReasoningContent,
+		Truncated:    result.Choices[0].FinishReason == "length",
+		Model:        result.Model,
+		FinishReason: result.Choices[0].FinishReason,
+		RequestID:    result.ID,
+		Usage:        result.Usage.usage(),
+	}, nil
+}
+
+// usage returns the token usage of the response, zero if not reported
+func (u *chatCompletionUsage) usage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens}
 }
 
 // formatChatCompletionError formats error messages from chat completion API with additional context
-func (o *OpenAI) formatChatCompletionError(apiError *struct {
-	Message string `json:"message"`
-	Type    string `json:"type"`
-	Code    string `json:"code"`
-}) error {
-	errMsg := apiError.Message
+func (o *OpenAI) formatChatCompletionError(apiErr *apiError, status int, body []byte) error {
+	errMsg := apiErr.Message
 	switch {
-	case strings.Contains(errMsg, "401") || apiError.Type == "invalid_request_error":
-		return fmt.Errorf("openai api error (authentication failed): %s", errMsg)
+	case strings.Contains(errMsg, "401") || apiErr.Type == "invalid_request_error":
+		return o.apiError(apiErr, status, "openai api error (authentication failed): "+errMsg, body)
 	case strings.Contains(errMsg, "429"):
-		return fmt.Errorf("openai api error (rate limit exceeded): %s", errMsg)
-	case strings.Contains(errMsg, "model") || apiError.Code == "model_not_found":
-		return fmt.Errorf("openai api error (model issue - check if model exists): %s", errMsg)
+		return o.apiError(apiErr, status, "openai api error (rate limit exceeded): "+errMsg, body)
+	case strings.Contains(errMsg, "model") || apiErr.Code == "model_not_found":
+		return o.apiError(apiErr, status, "openai api error (model issue - check if model exists): "+errMsg, body)
 	case strings.Contains(errMsg, "timeout") || strings.Contains(errMsg, "deadline"):
-		return fmt.Errorf("openai api error (request timed out): %s", errMsg)
+		return o.apiError(apiErr, status, "openai api error (request timed out): "+errMsg, body)
 	case strings.Contains(errMsg, "context") || strings.Contains(errMsg, "length"):
-		return fmt.Errorf("openai api error (context length/token limit): %s", errMsg)
+		return o.apiError(apiErr, status, "openai api error (context length/token limit): "+errMsg, body)
 	default:
-		return fmt.Errorf("openai api error: %s", errMsg)
+		return o.apiError(apiErr, status, "openai api error: "+errMsg, body)
+	}
+}
+
+// apiError creates a provider error for error details returned by the API. The vendor code falls back
+// to the error type, and retry-ability is derived from the message if the HTTP status doesn't tell
+func (o *OpenAI) apiError(apiErr *apiError, status int, message string, body []byte) *Error {
+	code := apiErr.Code
+	if code == "" {
+		code = apiErr.Type
 	}
+	res := httpError(o.Name(), status, code, message, body)
+	if status < http.StatusBadRequest {
+		res.Retryable = isRetryableError(errors.New(message))
+	}
+	return res
+}
+
+// parseError creates a provider error for a response body which can't be parsed
+func (o *OpenAI) parseError(err error, status int, body []byte) *Error {
+	res := httpError(o.Name(), status, "", "failed to parse response", body)
+	res.Err = err
+	return res
 }
 
-// generateWithChatCompletions calls the OpenAI v1/chat/completions endpoint
-func (o *OpenAI) generateWithChatCompletions(ctx context.Context, prompt string) (string, error) {
-	reqBody := o.buildChatCompletionRequest(prompt)
+// generateWithChatCompletions calls the OpenAI v1/chat/completions endpoint, streaming the response
+// if the context has a chunk callback
+func (o *OpenAI) generateWithChatCompletions(ctx context.Context, prompt string) (Response, error) {
+	reqBody := o.buildChatCompletionRequest(ctx, prompt)
 	url := o.baseURL + "/v1/chat/completions"
-	body, err := o.doRequest(ctx, url, reqBody)
+	if fn := chunksFromContext(ctx); fn != nil {
+		reqBody.Stream, reqBody.StreamOptions = true, &streamOptions{IncludeUsage: true}
+		return o.streamChatCompletions(ctx, url, reqBody, fn)
+	}
+	body, status, err := o.doRequest(ctx, url, reqBody)
 	if err != nil {
-		return "", err
+		return Response{}, err
+	}
+
+	return o.parseChatCompletionResponse(body, status)
+}
+
+// streamChatCompletions sends the streamed chat completions request and passes the text to fn as it arrives.
+// Responses which are not streamed, like errors or responses of servers ignoring the stream flag, are parsed
+// as usual.
+func (o *OpenAI) streamChatCompletions(ctx context.Context, url string, reqBody chatCompletionRequest,
+	fn ChunkFunc) (Response, error) {
+	resp, err := o.send(ctx, url, reqBody)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		body, err := o.readBody(resp)
+		if err != nil {
+			return Response{}, err
+		}
+		return o.parseChatCompletionResponse(body, resp.StatusCode)
+	}
+
+	fn("")
+	var res Response
+	var text, reasoning strings.Builder
+	choices := false
+	err = readEvents(io.LimitReader(resp.Body, MaxResponseSize), func(data []byte) (bool, error) {
+		if string(data) == "[DONE]" {
+			return false, nil
+		}
+		var chunk chatCompletionChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return false, o.parseError(err, resp.StatusCode, data)
+		}
+		if chunk.Error != nil {
+			return false, o.formatChatCompletionError(chunk.Error, resp.StatusCode, data)
+		}
+		if chunk.ID != "" {
+			res.RequestID = chunk.ID
+		}
+		if chunk.Model != "" {
+			res.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			res.Usage = chunk.Usage.usage()
+		}
+		if len(chunk.Choices) == 0 {
+			return true, nil // usage and keep-alive events
+		}
+		choices = true
+		delta := chunk.Choices[0].Delta
+		if delta.Content != "" {
+			text.WriteString(delta.Content)
+			fn(delta.Content)
+		}
+		reasoning.WriteString(delta.ReasoningContent)
+		if reason := chunk.Choices[0].FinishReason; reason != "" {
+			res.FinishReason = reason
+		}
+		return true, nil
+	})
+	if err != nil {
+		var perr *Error
+		if errors.As(err, &perr) {
+			return Response{}, perr
+		}
+		return Response{}, &Error{Provider: o.Name(), Status: resp.StatusCode, Message: "failed to read streamed response",
+			Err: err, Retryable: isRetryableError(err)}
+	}
+	if !choices {
+		return Response{}, httpError(o.Name(), resp.StatusCode, "",
+			"openai returned no choices - check your model configuration and prompt length", nil)
 	}
 
-	return o.parseChatCompletionResponse(body)
+	res.Text, res.Reasoning, res.Truncated = text.String(), reasoning.String(), res.FinishReason == "length"
+	if o.isReasoningModel() {
+		res.Text = cutAtStop(res.Text, o.stop) // stop sequences are not sent for reasoning models
+	}
+	return res, nil
 }
 
 // Generate sends a prompt to OpenAI and returns the generated text
 func (o *OpenAI) Generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := o.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// GenerateResponse sends a prompt to OpenAI and returns the generated text with response metadata
+func (o *OpenAI) GenerateResponse(ctx context.Context, prompt string) (Response, error) {
 	if !o.enabled {
-		return "", errors.New("openai provider is not enabled")
+		return Response{}, errors.New("openai provider is not enabled")
 	}
 
+	ctx, cancel := generationContext(ctx, o.generationTimeout)
+	defer cancel()
+
 	// use responses API for GPT-5 models
 	if o.needsResponsesAPI() {
 		return o.generateWithResponsesAPI(ctx, prompt)
@@ -411,6 +660,48 @@ func (o *OpenAI) Generate(ctx context.Context, prompt string) (string, error) {
 	return o.generateWithChatCompletions(ctx, prompt)
 }
 
+// Embed creates embedding vectors for the given texts using v1/embeddings endpoint
+func (o *OpenAI) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if !o.enabled {
+		return nil, errors.New("openai provider is not enabled")
+	}
+	return o.embed(ctx, embeddingsRequest{Model: DefaultOpenAIEmbeddingModel, Input: texts})
+}
+
+// embed sends a single request to v1/embeddings endpoint and returns vectors in order of input texts
+func (o *OpenAI) embed(ctx context.Context, req embeddingsRequest) ([][]float32, error) {
+	texts := req.Input
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	body, status, err := o.doRequest(ctx, o.baseURL+"/v1/embeddings", req)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp embeddingsResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, o.parseError(err, status, body)
+	}
+	if resp.Error != nil {
+		return nil, o.apiError(resp.Error, status, "openai api error: "+resp.Error.Message, body)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("openai returned %d embeddings for %d texts", len(resp.Data), len(texts))
+	}
+
+	// results are not guaranteed to be in input order, place them by index
+	res := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("openai returned embedding with invalid index %d", d.Index)
+		}
+		res[d.Index] = d.Embedding
+	}
+	return res, nil
+}
+
 // Enabled returns whether this provider is enabled
 func (o *OpenAI) Enabled() bool {
 	return o.enabled
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -379,6 +380,13 @@ func TestOpenAI_ChatCompletions_APIError_429(t *testing.T) {
 	_, err := provider.Generate(context.Background(), "test")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "Rate limit")
+
+	var perr *Error
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, "OpenAI", perr.Provider)
+	assert.Equal(t, http.StatusTooManyRequests, perr.Status)
+	assert.True(t, perr.Retryable)
+	assert.Contains(t, perr.Body, "Rate limit exceeded")
 }
 
 func TestOpenAI_ChatCompletions_APIError_ModelNotFound(t *testing.T) {
@@ -413,6 +421,12 @@ func TestOpenAI_ChatCompletions_APIError_ModelNotFound(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "model issue")
 	assert.Contains(t, err.Error(), "check if model exists")
+
+	var perr *Error
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, http.StatusNotFound, perr.Status)
+	assert.Equal(t, "model_not_found", perr.Code)
+	assert.False(t, perr.Retryable)
 }
 
 // Test Responses API (GPT-5)
@@ -677,7 +691,10 @@ func TestNewOpenAI_CustomHTTPClient(t *testing.T) {
 		HTTPClient: customClient,
 	})
 
-	assert.Equal(t, customClient, provider.httpClient)
+	client, ok := provider.httpClient.(*http.Client)
+	require.True(t, ok)
+	assert.NotSame(t, customClient, client, "injected client is copied")
+	assert.Equal(t, http.DefaultTransport, baseTransport(t, client))
 }
 
 func TestNewOpenAI_DefaultMaxTokens(t *testing.T) {
@@ -857,6 +874,11 @@ func TestOpenAI_HTTPError_NonJSON(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "http 502")
 	assert.Contains(t, err.Error(), "502 Bad Gateway")
+
+	var perr *Error
+	require.ErrorAs(t, err, &perr)
+	assert.Equal(t, http.StatusBadGateway, perr.Status)
+	assert.True(t, perr.Retryable)
 }
 
 func TestOpenAI_ResponsesAPI_ReasoningEffort(t *testing.T) {
@@ -998,3 +1020,225 @@ func TestOpenAI_ResponseSizeLimit(t *testing.T) {
 		assert.Contains(t, err.Error(), "exceeds maximum allowed size")
 	})
 }
+
+func TestOpenAI_GenerateResponse_Truncated(t *testing.T) {
+	tests := []struct {
+		name          string
+		model         string
+		body          string
+		wantText      string
+		wantTruncated bool
+		wantFinish    string
+	}{
+		{
+			name:  "chat completions finish reason length",
+			model: "gpt-4o",
+			body: `{"choices": [{"index": 0, "message": {"role": "assistant", "content": "partial"},
+				"finish_reason": "length"}]}`,
+			wantText: "partial", wantTruncated: true, wantFinish: "length",
+		},
+		{
+			name:     "chat completions finish reason stop",
+			model:    "gpt-4o",
+			body:     `{"choices": [{"index": 0, "message": {"role": "assistant", "content": "full"}, "finish_reason": "stop"}]}`,
+			wantText: "full", wantTruncated: false, wantFinish: "stop",
+		},
+		{
+			name:  "responses api incomplete due to max output tokens",
+			model: "gpt-5",
+			body: `{"status": "incomplete", "incomplete_details": {"reason": "max_output_tokens"},
+				"output": [{"type": "message", "content": [{"type": "output_text", "text": "partial"}]}]}`,
+			wantText: "partial", wantTruncated: true, wantFinish: "max_output_tokens",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			provider := NewOpenAI(Options{APIKey: "key", Model: tt.model, Enabled: true, BaseURL: server.URL})
+			resp, err := provider.GenerateResponse(context.Background(), "test")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantText, resp.Text)
+			assert.Equal(t, tt.wantTruncated, resp.Truncated)
+			assert.Equal(t, tt.wantFinish, resp.FinishReason)
+		})
+	}
+
+	t.Run("chat completions model and id", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id": "chatcmpl-123", "model": "gpt-4o-2024-08-06", "choices": [{"index": 0,
+				"message": {"role": "assistant", "content": "full"}, "finish_reason": "stop"}],
+				"usage": {"prompt_tokens": 9, "completion_tokens": 2, "total_tokens": 11}}`))
+		}))
+		defer server.Close()
+
+		provider := NewOpenAI(Options{APIKey: "key", Model: "gpt-4o", Enabled: true, BaseURL: server.URL})
+		resp, err := provider.GenerateResponse(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, Response{Text: "full", Model: "gpt-4o-2024-08-06", FinishReason: "stop", RequestID: "chatcmpl-123",
+			Usage: Usage{InputTokens: 9, OutputTokens: 2}}, resp)
+	})
+
+	t.Run("responses api usage", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id": "resp-1", "status": "completed", "usage": {"input_tokens": 20, "output_tokens": 150},
+				"output": [{"type": "message", "content": [{"type": "output_text", "text": "full"}]}]}`))
+		}))
+		defer server.Close()
+
+		provider := NewOpenAI(Options{APIKey: "key", Model: "gpt-5", Enabled: true, BaseURL: server.URL})
+		resp, err := provider.GenerateResponse(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, Usage{InputTokens: 20, OutputTokens: 150}, resp.Usage)
+	})
+
+	t.Run("responses api incomplete for other reason", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"status": "incomplete", "incomplete_details": {"reason": "content_filter"}, "output": []}`))
+		}))
+		defer server.Close()
+
+		provider := NewOpenAI(Options{APIKey: "key", Model: "gpt-5", Enabled: true, BaseURL: server.URL})
+		_, err := provider.GenerateResponse(context.Background(), "test")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unexpected response status: incomplete")
+	})
+}
+
+func TestOpenAI_GenerateResponse_Stop(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    string
+		body     string
+		wantStop bool // stop sequences sent to the API
+		wantText string
+	}{
+		{
+			name:     "chat completions",
+			model:    "gpt-4o",
+			body:     `{"choices": [{"message": {"content": "first part"}, "finish_reason": "stop"}]}`,
+			wantStop: true, wantText: "first part",
+		},
+		{
+			name:     "reasoning model cut on client side",
+			model:    "o3-mini",
+			body:     `{"choices": [{"message": {"content": "first part\nEND\nsecond part"}, "finish_reason": "stop"}]}`,
+			wantText: "first part\n",
+		},
+		{
+			name:     "responses api cut on client side",
+			model:    "gpt-5",
+			body:     `{"status": "completed", "output": [{"type": "message", "content": [{"type": "output_text", "text": "first part###second"}]}]}`,
+			wantText: "first part",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req map[string]any
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				if tt.wantStop {
+					assert.Equal(t, []any{"END", "###"}, req["stop"])
+				} else {
+					assert.NotContains(t, req, "stop")
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			provider := NewOpenAI(Options{APIKey: "key", Model: tt.model, Enabled: true, BaseURL: server.URL,
+				Stop: []string{"END", "###"}})
+			resp, err := provider.GenerateResponse(context.Background(), "test")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantText, resp.Text)
+		})
+	}
+}
+
+func TestOpenAI_Embed(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/v1/embeddings", r.URL.Path)
+			assert.Equal(t, "Bearer test-api-key", r.Header.Get("Authorization"))
+
+			var req embeddingsRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, DefaultOpenAIEmbeddingModel, req.Model)
+			assert.Equal(t, []string{"first", "second"}, req.Input)
+
+			// return out of order to verify placement by index
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"data": [{"index": 1, "embedding": [0.3, 0.4]}, {"index": 0, "embedding": [0.1, 0.2]}]}`))
+		}))
+		defer server.Close()
+
+		p := NewOpenAI(Options{APIKey: "test-api-key", Model: "gpt-4o", Enabled: true, BaseURL: server.URL})
+		res, err := p.Embed(context.Background(), []string{"first", "second"})
+		require.NoError(t, err)
+		assert.Equal(t, [][]float32{{0.1, 0.2}, {0.3, 0.4}}, res)
+	})
+
+	t.Run("api error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error": {"message": "invalid input", "type": "invalid_request_error"}}`))
+		}))
+		defer server.Close()
+
+		p := NewOpenAI(Options{APIKey: "test-api-key", Model: "gpt-4o", Enabled: true, BaseURL: server.URL})
+		_, err := p.Embed(context.Background(), []string{"first"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid input")
+	})
+
+	t.Run("not enabled", func(t *testing.T) {
+		_, err := (&OpenAI{}).Embed(context.Background(), []string{"first"})
+		require.EqualError(t, err, "openai provider is not enabled")
+	})
+}
+
+func TestOpenAI_ResponsesAPI_ReasoningSummary(t *testing.T) {
+	tests := []struct {
+		name             string
+		includeReasoning bool
+		wantSummary      string
+	}{
+		{name: "summary requested", includeReasoning: true, wantSummary: "auto"},
+		{name: "summary not requested", includeReasoning: false, wantSummary: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req responsesRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.Equal(t, tt.wantSummary, req.Reasoning.Summary)
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"id": "resp_123", "model": "gpt-5-2025-08-07", "status": "completed", "output": [
+					{"type": "reasoning", "summary": [{"type": "summary_text", "text": "step one"},
+						{"type": "summary_text", "text": "step two"}]},
+					{"type": "message", "content": [{"type": "output_text", "text": "answer"}]}]}`))
+			}))
+			defer server.Close()
+
+			p := NewOpenAI(Options{APIKey: "key", Model: "gpt-5", Enabled: true, BaseURL: server.URL,
+				IncludeReasoning: tt.includeReasoning})
+			resp, err := p.GenerateResponse(context.Background(), "question")
+			require.NoError(t, err)
+			assert.Equal(t, Response{Text: "answer", Reasoning: "step one\n\nstep two", Model: "gpt-5-2025-08-07",
+				FinishReason: "completed", RequestID: "resp_123"}, resp)
+		})
+	}
+}
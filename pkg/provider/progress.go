@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// ProgressFunc is called as response data of a provider request arrives, with the number of bytes received so far.
+// It is called with zero received bytes once the response starts arriving.
+type ProgressFunc func(received int64)
+
+// progressKey is the context key of ProgressFunc
+type progressKey struct{}
+
+// WithProgress returns a child context with the progress callback, called by providers as response data arrives.
+// Progress is reported by providers using HTTP clients created by this package.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// progressFromContext returns the progress callback of the context, nil if not set
+func progressFromContext(ctx context.Context) ProgressFunc {
+	fn, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	return fn
+}
+
+// progressTransport is an http.RoundTripper reporting received response data to the progress callback
+// of the request context
+type progressTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip sends the request with the next transport and wraps the response body to report its progress
+func (t *progressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	fn := progressFromContext(req.Context())
+	if err != nil || fn == nil {
+		return resp, err
+	}
+	fn(0)
+	resp.Body = &progressReader{ReadCloser: resp.Body, fn: fn}
+	return resp, nil
+}
+
+// progressReader reports the number of bytes read from the response body
+type progressReader struct {
+	io.ReadCloser
+	fn       ProgressFunc
+	received int64
+}
+
+// Read reads from the response body and reports the total number of bytes read
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.received += int64(n)
+		r.fn(r.received)
+	}
+	return n, err
+}
@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressTransport(t *testing.T) {
+	body := strings.Repeat("x", 100*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var reports []int64
+	ctx := WithProgress(context.Background(), func(received int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports = append(reports, received)
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, http.NoBody)
+	require.NoError(t, err)
+	resp, err := newHTTPClient(0).Do(req)
+	require.NoError(t, err)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Len(t, data, len(body))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.GreaterOrEqual(t, len(reports), 2)
+	assert.Equal(t, int64(0), reports[0], "reported once response starts arriving")
+	assert.Equal(t, int64(len(body)), reports[len(reports)-1], "total received bytes reported")
+}
+
+func TestProgressTransport_NoCallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	resp, err := newHTTPClient(0).Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	_, wrapped := resp.Body.(*progressReader)
+	assert.False(t, wrapped, "body not wrapped without progress callback")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 )
 
 //go:generate go run github.com/go-pkgz/enum@latest -type=providerType -lower
@@ -31,13 +32,82 @@ const (
 	providerTypeAnthropic
 	providerTypeGoogle
 	providerTypeCustom
+	providerTypeDeepSeek
 )
 
+// ResponseGenerator is an optional interface implemented by providers able to report
+// response metadata in addition to the generated text
+type ResponseGenerator interface {
+	GenerateResponse(ctx context.Context, prompt string) (Response, error)
+}
+
+// Response represents generated text along with metadata reported by the provider
+type Response struct {
+	Text         string
+	Reasoning    string // reasoning trace, if exposed by the model
+	Truncated    bool   // response was cut off by the max tokens limit
+	Model        string // model which served the request, as reported by the provider
+	FinishReason string // reason the generation stopped, as reported by the provider
+	RequestID    string // id of the response assigned by the provider, to look the request up in provider logs
+	Usage        Usage  // tokens of the request, as reported by the provider, zero if not reported
+
+	ValidationAttempts int       // number of requests made to get a valid answer, 0 if answers are not validated
+	Attempts           []Attempt // attempts of retried requests, set on failure as well, empty if requests are not retried
+}
+
+// Usage is the number of tokens of the request, as reported by the provider
+type Usage struct {
+	InputTokens  int // tokens of the prompt
+	OutputTokens int // generated tokens, reasoning tokens included
+}
+
+// GenerateResponse sends a prompt to the provider and returns the response with metadata.
+// Providers not implementing ResponseGenerator return a response with text only.
+func GenerateResponse(ctx context.Context, p Provider, prompt string) (Response, error) {
+	if rg, ok := p.(ResponseGenerator); ok {
+		return rg.GenerateResponse(ctx, prompt)
+	}
+	text, err := p.Generate(ctx, prompt)
+	if err != nil {
+		return Response{}, err
+	}
+	return Response{Text: text}, nil
+}
+
+// cutAtStop cuts the text at the earliest of the stop sequences, for APIs not supporting stop sequences.
+// The stop sequence itself is removed, same as APIs do.
+func cutAtStop(text string, stop []string) string {
+	end := len(text)
+	for _, s := range stop {
+		if i := strings.Index(text, s); s != "" && i >= 0 && i < end {
+			end = i
+		}
+	}
+	return text[:end]
+}
+
+// Embedder is an optional interface implemented by providers supporting embeddings API
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
 // Result represents a generation result from a provider
 type Result struct {
-	Provider string
-	Text     string
-	Error    error
+	Provider  string
+	Text      string
+	Error     error
+	Reasoning string        // reasoning trace, if exposed by the model
+	Truncated bool          // response was cut off by the max tokens limit
+	Latency   time.Duration // time spent to get the response
+
+	Model        string // model which served the request, as reported by the provider
+	FinishReason string // reason the generation stopped, as reported by the provider
+	RequestID    string // id of the response assigned by the provider
+	Usage        Usage  // tokens of the request, as reported by the provider, zero if not reported
+
+	ValidationAttempts int       // number of requests made to get a valid answer, 0 if answers are not validated
+	Attempts           []Attempt // attempts of retried requests, empty if requests are not retried
+	Raw                [][]byte  // raw API responses of all requests, in order, set if requested, see WithRawResponses
 }
 
 // Format formats a result for output with a provider header
@@ -48,6 +118,45 @@ func (r Result) Format() string {
 	return fmt.Sprintf("== generated by %s ==\n%s\n", r.Provider, r.Text)
 }
 
+// FormatIdentical formats the answer shared by several providers with a header listing all of them
+func FormatIdentical(providers []string, text string) string {
+	return fmt.Sprintf("== identical answer from %s ==\n%s\n", strings.Join(providers, ", "), text)
+}
+
+// Duplicates returns the index of the earlier successful result with effectively identical text for each
+// result, or -1 if there is none or the result failed. Texts are compared ignoring leading and trailing
+// blank lines, trailing spaces of lines and line endings only, as case and indentation matter for code.
+func Duplicates(results []Result) []int {
+	res := make([]int, len(results))
+	first := make(map[string]int, len(results))
+	for i, r := range results {
+		res[i] = -1
+		if r.Error != nil {
+			continue
+		}
+		key := normalizeAnswer(r.Text)
+		if key == "" {
+			continue
+		}
+		if j, ok := first[key]; ok {
+			res[i] = j
+			continue
+		}
+		first[key] = i
+	}
+	return res
+}
+
+// normalizeAnswer returns the answer with unix line endings, trailing spaces of lines and surrounding
+// blank lines removed
+func normalizeAnswer(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
 // EndpointType represents the API endpoint type for OpenAI-compatible providers
 type EndpointType string
 
@@ -58,6 +167,8 @@ const (
 	EndpointTypeResponses EndpointType = "responses"
 	// EndpointTypeChatCompletions forces use of v1/chat/completions endpoint
 	EndpointTypeChatCompletions EndpointType = "chat_completions"
+	// EndpointTypeEmbeddings uses v1/embeddings endpoint only, the provider creates embeddings and can't generate text
+	EndpointTypeEmbeddings EndpointType = "embeddings"
 )
 
 // Options defines common options for all providers
@@ -66,11 +177,27 @@ type Options struct {
 	Enabled           bool
 	Model             string
 	MaxTokens         int          // maximum number of tokens to generate
+	Stop              []string     // sequences stopping generation, the text is cut on the client side for APIs without stop sequences
 	Temperature       float32      // controls randomness (0-1, default: 0.7)
 	ReasoningEffort   string       // reasoning effort level: minimal, low, medium (default), high (OpenAI only)
-	HTTPClient        HTTPClient   // optional HTTP client for dependency injection, defaults to &http.Client{} if nil
-	BaseURL           string       // optional base URL for custom endpoints (OpenAI-compatible providers only)
+	HTTPClient        HTTPClient   // optional HTTP client for dependency injection, defaults to &http.Client{} if nil, connect timeout applies to *http.Client only
+	BaseURL           string       // optional base URL for custom endpoints (OpenAI-compatible providers), or of the cloud platform routing requests
 	ForceEndpointType EndpointType // optional manual endpoint selection (auto, responses, chat_completions)
+	IncludeReasoning  bool         // request reasoning traces (Anthropic extended thinking, OpenAI reasoning summaries)
+	Timeouts          Timeouts     // connect and generation timeouts, zero values mean no limit
+	Vertex            Vertex       // route requests through Google Cloud Vertex AI instead of the API key (Google and Anthropic)
+	Bedrock           Bedrock      // route requests through AWS Bedrock instead of the API key (Anthropic only)
+}
+
+// cloudName returns the name of the cloud platform routing requests, empty if requests go to the provider API
+func (o Options) cloudName() string {
+	switch {
+	case o.Vertex.Enabled:
+		return "vertex AI"
+	case o.Bedrock.Enabled:
+		return "bedrock"
+	}
+	return ""
 }
 
 // Validate checks if the provider options are valid
@@ -82,7 +209,19 @@ func (o Options) Validate(providerType ProviderType) error {
 			providerName, providerName)
 	}
 
-	if o.APIKey == "" {
+	if o.Vertex.Enabled && providerType != ProviderTypeGoogle && providerType != ProviderTypeAnthropic {
+		return fmt.Errorf("vertex AI is not supported by %s provider", providerName)
+	}
+
+	if o.Bedrock.Enabled && providerType != ProviderTypeAnthropic {
+		return fmt.Errorf("bedrock is not supported by %s provider", providerName)
+	}
+
+	if o.Vertex.Enabled && o.Bedrock.Enabled {
+		return fmt.Errorf("vertex AI and bedrock can't be combined")
+	}
+
+	if o.APIKey == "" && !o.Vertex.Enabled && !o.Bedrock.Enabled {
 		return fmt.Errorf("api key for %s provider is required (set with --%s.api-key flag or %s_API_KEY env var)",
 			providerName, providerName, strings.ToUpper(providerName))
 	}
@@ -95,7 +234,7 @@ func (o Options) Validate(providerType ProviderType) error {
 	return nil
 }
 
-// CreateProvider creates a standard provider (OpenAI, Anthropic, Google)
+// CreateProvider creates a standard provider (OpenAI, Anthropic, Google, DeepSeek)
 // based on the provider type and options. It validates required fields
 // and returns appropriate errors if validation fails.
 func CreateProvider(providerType ProviderType, opts Options) (Provider, error) {
@@ -114,18 +253,36 @@ func CreateProvider(providerType ProviderType, opts Options) (Provider, error) {
 		return p, nil
 	case ProviderTypeAnthropic:
 		p := NewAnthropic(opts)
+		if !p.Enabled() && opts.Vertex.Enabled {
+			return nil, fmt.Errorf("anthropic provider failed to initialize with model %q on vertex AI - check google "+
+				"cloud credentials, project and location", opts.Model)
+		}
+		if !p.Enabled() && opts.Bedrock.Enabled {
+			return nil, fmt.Errorf("anthropic provider failed to initialize with model %q on bedrock - check aws "+
+				"credentials and region", opts.Model)
+		}
 		if !p.Enabled() {
 			return nil, fmt.Errorf("anthropic provider failed to initialize with model %q - check API key and model name", opts.Model)
 		}
 		return p, nil
 	case ProviderTypeGoogle:
 		p := NewGoogle(opts)
+		if !p.Enabled() && opts.Vertex.Enabled {
+			return nil, fmt.Errorf("google provider failed to initialize with model %q on vertex AI - check google cloud "+
+				"credentials, project and location", opts.Model)
+		}
 		if !p.Enabled() {
 			return nil, fmt.Errorf("google provider failed to initialize with model %q - check API key and model name", opts.Model)
 		}
 		return p, nil
+	case ProviderTypeDeepSeek:
+		p := NewDeepSeek(opts)
+		if !p.Enabled() {
+			return nil, fmt.Errorf("deepseek provider failed to initialize with model %q - check API key and model name", opts.Model)
+		}
+		return p, nil
 	default:
-		return nil, fmt.Errorf("unsupported provider type %q - valid types are 'openai', 'anthropic', or 'google'", providerType)
+		return nil, fmt.Errorf("unsupported provider type %q - valid types are 'openai', 'anthropic', 'google', or 'deepseek'", providerType)
 	}
 }
 
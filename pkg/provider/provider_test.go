@@ -41,6 +41,14 @@ func TestResult_Format(t *testing.T) {
 	}
 }
 
+func TestCutAtStop(t *testing.T) {
+	assert.Equal(t, "abc", cutAtStop("abc", nil))
+	assert.Equal(t, "abc", cutAtStop("abc", []string{""}), "empty stop sequence ignored")
+	assert.Equal(t, "a", cutAtStop("a-b#c", []string{"#", "-"}), "earliest stop sequence wins")
+	assert.Equal(t, "", cutAtStop("END", []string{"END"}))
+	assert.Equal(t, "abc", cutAtStop("abc", []string{"x"}))
+}
+
 func TestOptions_Validate(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -175,6 +183,18 @@ func TestCreateProvider(t *testing.T) {
 			wantErr:   false,
 			checkType: "Google",
 		},
+		{
+			name:         "create deepseek provider",
+			providerType: ProviderTypeDeepSeek,
+			opts: Options{
+				APIKey:    "test-deepseek-key",
+				Enabled:   true,
+				Model:     "deepseek-chat",
+				MaxTokens: 1500,
+			},
+			wantErr:   false,
+			checkType: "DeepSeek",
+		},
 		{
 			name:         "unsupported provider type",
 			providerType: ProviderTypeCustom,
@@ -249,3 +269,24 @@ func TestCreateProvider(t *testing.T) {
 		})
 	}
 }
+
+func TestDuplicates(t *testing.T) {
+	results := []Result{
+		{Provider: "OpenAI", Text: "Paris"},
+		{Provider: "Anthropic", Text: "def f():\n    return 1"},
+		{Provider: "Google", Text: "\nParis  \n"},
+		{Provider: "DeepSeek", Error: assert.AnError},
+		{Provider: "Mistral", Text: "def f():  \r\n    return 1\r\n"},
+		{Provider: "Lower", Text: "paris"},
+		{Provider: "Indent", Text: "def f():\n  return 1"},
+		{Provider: "Period", Text: "Paris."},
+		{Provider: "Empty", Text: " "},
+		{Provider: "Blank", Text: ""},
+	}
+	assert.Equal(t, []int{-1, -1, 0, -1, 1, -1, -1, -1, -1, -1}, Duplicates(results), "case, indentation and text differences kept")
+	assert.Empty(t, Duplicates(nil))
+}
+
+func TestFormatIdentical(t *testing.T) {
+	assert.Equal(t, "== identical answer from OpenAI, Google ==\nParis\n", FormatIdentical([]string{"OpenAI", "Google"}, "Paris"))
+}
@@ -74,6 +74,7 @@ var _providerTypeParseMap = map[string]ProviderType{
 	"anthropic": ProviderTypeAnthropic,
 	"google":    ProviderTypeGoogle,
 	"custom":    ProviderTypeCustom,
+	"deepseek":  ProviderTypeDeepSeek,
 }
 
 // ParseProviderType converts string to providerType enum value
@@ -102,6 +103,7 @@ var (
 	ProviderTypeAnthropic = ProviderType{name: "anthropic", value: 2}
 	ProviderTypeGoogle    = ProviderType{name: "google", value: 3}
 	ProviderTypeCustom    = ProviderType{name: "custom", value: 4}
+	ProviderTypeDeepSeek  = ProviderType{name: "deepseek", value: 5}
 )
 
 // ProviderTypeValues contains all possible enum values
@@ -111,6 +113,7 @@ var ProviderTypeValues = []ProviderType{
 	ProviderTypeAnthropic,
 	ProviderTypeGoogle,
 	ProviderTypeCustom,
+	ProviderTypeDeepSeek,
 }
 
 // ProviderTypeNames contains all possible enum names
@@ -120,6 +123,7 @@ var ProviderTypeNames = []string{
 	"anthropic",
 	"google",
 	"custom",
+	"deepseek",
 }
 
 // ProviderTypeIter returns a function compatible with Go 1.23's range-over-func syntax.
@@ -153,5 +157,7 @@ var _ = func() bool {
 	var _ providerType = providerTypeGoogle
 	// This avoids "defined but not used" linter error for providerTypeCustom
 	var _ providerType = providerTypeCustom
+	// This avoids "defined but not used" linter error for providerTypeDeepSeek
+	var _ providerType = providerTypeDeepSeek
 	return true
 }()
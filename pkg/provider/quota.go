@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Quota is the rate limit state reported in provider response headers
+type Quota struct {
+	RemainingRequests int       `json:"remaining_requests"` // requests left in the current window, -1 if not reported
+	RemainingTokens   int       `json:"remaining_tokens"`   // tokens left in the current window, -1 if not reported
+	ResetRequests     time.Time `json:"reset_requests"`     // time the requests limit resets, zero if not reported
+	ResetTokens       time.Time `json:"reset_tokens"`       // time the tokens limit resets, zero if not reported
+}
+
+// ExhaustedUntil returns the time exhausted limits reset, zero time if no limit is exhausted at the moment
+func (q Quota) ExhaustedUntil(now time.Time) time.Time {
+	var res time.Time
+	if q.RemainingRequests == 0 && q.ResetRequests.After(now) {
+		res = q.ResetRequests
+	}
+	if q.RemainingTokens == 0 && q.ResetTokens.After(now) && q.ResetTokens.After(res) {
+		res = q.ResetTokens
+	}
+	return res
+}
+
+// QuotaFunc is called with the quota reported in response headers of a provider request
+type QuotaFunc func(q Quota)
+
+// quotaKey is the context key of QuotaFunc
+type quotaKey struct{}
+
+// WithQuota returns a child context with the quota callback, called by providers on responses with rate limit headers.
+// Quota is reported by providers using HTTP clients created by this package.
+func WithQuota(ctx context.Context, fn QuotaFunc) context.Context {
+	return context.WithValue(ctx, quotaKey{}, fn)
+}
+
+// quotaFromContext returns the quota callback of the context, nil if not set
+func quotaFromContext(ctx context.Context) QuotaFunc {
+	fn, _ := ctx.Value(quotaKey{}).(QuotaFunc)
+	return fn
+}
+
+// quotaTransport is an http.RoundTripper reporting rate limit headers of responses to the quota callback
+// of the request context
+type quotaTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip sends the request with the next transport and reports the quota of the response
+func (t *quotaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	fn := quotaFromContext(req.Context())
+	if err != nil || fn == nil {
+		return resp, err
+	}
+	if q, ok := parseQuota(resp.Header, resp.StatusCode, time.Now()); ok {
+		fn(q)
+	}
+	return resp, nil
+}
+
+// parseQuota gets the quota from rate limit headers of OpenAI compatible and Anthropic APIs, and from
+// Retry-After header of 429 responses. It returns false if the response has no rate limit headers.
+func parseQuota(h http.Header, status int, now time.Time) (Quota, bool) {
+	q := Quota{RemainingRequests: -1, RemainingTokens: -1}
+	found := false
+	remaining := func(dst *int, keys ...string) {
+		for _, k := range keys {
+			if v, err := strconv.Atoi(h.Get(k)); err == nil {
+				*dst, found = v, true
+				return
+			}
+		}
+	}
+	reset := func(dst *time.Time, keys ...string) {
+		for _, k := range keys {
+			if t, ok := parseReset(h.Get(k), now); ok {
+				*dst, found = t, true
+				return
+			}
+		}
+	}
+
+	remaining(&q.RemainingRequests, "x-ratelimit-remaining-requests", "anthropic-ratelimit-requests-remaining")
+	remaining(&q.RemainingTokens, "x-ratelimit-remaining-tokens", "anthropic-ratelimit-tokens-remaining")
+	reset(&q.ResetRequests, "x-ratelimit-reset-requests", "anthropic-ratelimit-requests-reset")
+	reset(&q.ResetTokens, "x-ratelimit-reset-tokens", "anthropic-ratelimit-tokens-reset")
+
+	// rate limited response without limit details, retry after the given time
+	if status == http.StatusTooManyRequests && (q.RemainingRequests != 0 && q.RemainingTokens != 0) {
+		if t, ok := parseRetryAfter(h.Get("Retry-After"), now); ok {
+			q.RemainingRequests, q.ResetRequests, found = 0, t, true
+		}
+	}
+	return q, found
+}
+
+// parseReset parses reset time as duration from now, like "6m0s" in OpenAI headers, or RFC 3339 time
+// used by Anthropic
+func parseReset(v string, now time.Time) (time.Time, bool) {
+	if v == "" {
+		return time.Time{}, false
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(d), true
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// parseRetryAfter parses Retry-After header value, in seconds or HTTP date
+func parseRetryAfter(v string, now time.Time) (time.Time, bool) {
+	if v == "" {
+		return time.Time{}, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return now.Add(time.Duration(secs) * time.Second), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuota(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+		want    Quota
+		wantOk  bool
+	}{
+		{name: "no headers", status: 200, want: Quota{RemainingRequests: -1, RemainingTokens: -1}},
+		{name: "openai", status: 200, headers: map[string]string{
+			"x-ratelimit-remaining-requests": "59", "x-ratelimit-remaining-tokens": "0",
+			"x-ratelimit-reset-requests": "1s", "x-ratelimit-reset-tokens": "6m0s"},
+			want: Quota{RemainingRequests: 59, RemainingTokens: 0, ResetRequests: now.Add(time.Second),
+				ResetTokens: now.Add(6 * time.Minute)}, wantOk: true},
+		{name: "anthropic", status: 200, headers: map[string]string{
+			"anthropic-ratelimit-requests-remaining": "0", "anthropic-ratelimit-requests-reset": "2025-05-01T12:00:30Z"},
+			want: Quota{RemainingRequests: 0, RemainingTokens: -1, ResetRequests: now.Add(30 * time.Second)}, wantOk: true},
+		{name: "retry after seconds", status: 429, headers: map[string]string{"Retry-After": "20"},
+			want: Quota{RemainingRequests: 0, RemainingTokens: -1, ResetRequests: now.Add(20 * time.Second)}, wantOk: true},
+		{name: "retry after date", status: 429, headers: map[string]string{"Retry-After": "Thu, 01 May 2025 12:01:00 GMT"},
+			want: Quota{RemainingRequests: 0, RemainingTokens: -1, ResetRequests: now.Add(time.Minute)}, wantOk: true},
+		{name: "retry after without rate limit", status: 503, headers: map[string]string{"Retry-After": "20"},
+			want: Quota{RemainingRequests: -1, RemainingTokens: -1}},
+		{name: "invalid values", status: 200, headers: map[string]string{
+			"x-ratelimit-remaining-requests": "many", "x-ratelimit-reset-requests": "soon"},
+			want: Quota{RemainingRequests: -1, RemainingTokens: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+			got, ok := parseQuota(h, tt.status, now)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQuota_ExhaustedUntil(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		quota Quota
+		want  time.Time
+	}{
+		{name: "not reported", quota: Quota{RemainingRequests: -1, RemainingTokens: -1}},
+		{name: "requests left", quota: Quota{RemainingRequests: 5, RemainingTokens: -1, ResetRequests: now.Add(time.Minute)}},
+		{name: "requests exhausted", quota: Quota{RemainingRequests: 0, RemainingTokens: 100, ResetRequests: now.Add(time.Minute)},
+			want: now.Add(time.Minute)},
+		{name: "both exhausted, later reset", quota: Quota{RemainingRequests: 0, RemainingTokens: 0,
+			ResetRequests: now.Add(time.Second), ResetTokens: now.Add(time.Hour)}, want: now.Add(time.Hour)},
+		{name: "already reset", quota: Quota{RemainingRequests: 0, RemainingTokens: -1, ResetRequests: now.Add(-time.Second)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.quota.ExhaustedUntil(now))
+		})
+	}
+}
+
+func TestQuotaTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/limited" {
+			w.Header().Set("x-ratelimit-remaining-requests", "3")
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	var reported []Quota
+	ctx := WithQuota(context.Background(), func(q Quota) { reported = append(reported, q) })
+	client := newHTTPClient(0)
+	for _, path := range []string{"/limited", "/plain"} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+path, http.NoBody)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+	require.Len(t, reported, 1, "reported only for responses with rate limit headers")
+	assert.Equal(t, 3, reported[0].RemainingRequests)
+	assert.Equal(t, -1, reported[0].RemainingTokens)
+
+	// no callback in context
+	resp, err := client.Get(ts.URL + "/limited")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Len(t, reported, 1)
+}
@@ -0,0 +1,77 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+)
+
+// maxRawResponse limits the size of a raw response reported to RawFunc, longer bodies are cut
+const maxRawResponse = 1 << 20
+
+// RawFunc is called with the raw body of each API response of a provider request, including error responses
+type RawFunc func(body []byte)
+
+// rawKey is the context key of RawFunc
+type rawKey struct{}
+
+// WithRawResponses returns a child context with the callback of raw API responses, called by providers using
+// HTTP clients created by this package once the response body is read. Bodies are masked the same way as traced
+// requests, see EnableRequestTrace, and cut to 1 MB.
+func WithRawResponses(ctx context.Context, fn RawFunc) context.Context {
+	return context.WithValue(ctx, rawKey{}, fn)
+}
+
+// rawFromContext returns the raw responses callback of the context, nil if not set
+func rawFromContext(ctx context.Context) RawFunc {
+	fn, _ := ctx.Value(rawKey{}).(RawFunc)
+	return fn
+}
+
+// rawTransport is an http.RoundTripper reporting response bodies to the raw responses callback of the request context
+type rawTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip sends the request with the next transport and wraps the response body to capture it
+func (t *rawTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	fn := rawFromContext(req.Context())
+	if err != nil || fn == nil {
+		return resp, err
+	}
+	resp.Body = &rawReader{ReadCloser: resp.Body, fn: fn}
+	return resp, nil
+}
+
+// rawReader captures the response body as it's read, and reports it to the callback on close
+type rawReader struct {
+	io.ReadCloser
+	fn       RawFunc
+	buf      bytes.Buffer
+	reported bool
+}
+
+// Read reads from the response body and keeps the data read, up to maxRawResponse
+func (r *rawReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if left := maxRawResponse - r.buf.Len(); n > 0 && left > 0 {
+		r.buf.Write(p[:min(n, left)])
+	}
+	return n, err
+}
+
+// Close closes the response body and reports the data read, once
+func (r *rawReader) Close() error {
+	err := r.ReadCloser.Close()
+	if !r.reported {
+		r.reported = true
+		body := r.buf.Bytes()
+		if mask := traceMask.Load(); mask != nil && *mask != nil {
+			body = (*mask)(bytes.Clone(body))
+		}
+		r.fn(body)
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRawResponses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"content": "answer about private-project"}}]}`))
+	}))
+	defer server.Close()
+	p := NewOpenAI(Options{APIKey: "sk-secret", Model: "gpt-4o", Enabled: true, BaseURL: server.URL,
+		Timeouts: Timeouts{Connect: time.Second}})
+
+	t.Run("responses reported", func(t *testing.T) {
+		var raw []string
+		ctx := WithRawResponses(context.Background(), func(body []byte) { raw = append(raw, string(body)) })
+		resp, err := p.Generate(ctx, "question")
+		require.NoError(t, err)
+		assert.Equal(t, "answer about private-project", resp)
+		assert.Equal(t, []string{`{"choices": [{"message": {"content": "answer about private-project"}}]}`}, raw)
+	})
+
+	t.Run("responses masked", func(t *testing.T) {
+		EnableRequestTrace(false, func(data []byte) []byte {
+			return bytes.ReplaceAll(data, []byte("private-project"), []byte("******"))
+		})
+		defer EnableRequestTrace(false, nil)
+		var raw []string
+		ctx := WithRawResponses(context.Background(), func(body []byte) { raw = append(raw, string(body)) })
+		resp, err := p.Generate(ctx, "question")
+		require.NoError(t, err)
+		assert.Equal(t, "answer about private-project", resp, "answer not masked")
+		assert.Equal(t, []string{`{"choices": [{"message": {"content": "answer about ******"}}]}`}, raw)
+	})
+
+	t.Run("not requested", func(t *testing.T) {
+		resp, err := p.Generate(context.Background(), "question")
+		require.NoError(t, err)
+		assert.Equal(t, "answer about private-project", resp)
+	})
+}
+
+func TestRawReader(t *testing.T) {
+	var raw [][]byte
+	body := strings.Repeat("x", maxRawResponse+100)
+	r := &rawReader{ReadCloser: io.NopCloser(strings.NewReader(body)), fn: func(b []byte) { raw = append(raw, b) }}
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Len(t, data, len(body), "body read in full")
+	require.NoError(t, r.Close())
+	require.NoError(t, r.Close())
+	require.Len(t, raw, 1, "reported once")
+	assert.Len(t, raw[0], maxRawResponse, "cut to the limit")
+}
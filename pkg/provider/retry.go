@@ -2,6 +2,10 @@ package provider
 
 import (
 	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net/http"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -15,7 +19,7 @@ import (
 // will be used concurrently. The retry logic itself is thread-safe.
 type RetryableProvider struct {
 	provider Provider
-	repeater *repeater.Repeater
+	opts     RetryOptions
 	name     string
 }
 
@@ -27,37 +31,81 @@ type RetryOptions struct {
 	Factor   float64
 }
 
-// NewRetryableProvider creates a provider wrapper with retry logic
+// Attempt is a single request attempt made by the retrying provider
+type Attempt struct {
+	Number     int           // number of the attempt of the request, from 1
+	ErrorClass string        // class of the error of the failed attempt, one of ErrorClass* constants, empty if it succeeded
+	Error      string        // error of the failed attempt, empty if it succeeded
+	Delay      time.Duration // delay waited before the attempt, 0 for the first one
+	Duration   time.Duration // time spent on the attempt request
+}
+
+// error classes of failed attempts
+const (
+	ErrorClassRateLimit  = "rate_limit"   // 429 and quota errors
+	ErrorClassOverloaded = "overloaded"   // 529 and 503, provider overloaded or unavailable
+	ErrorClassServer     = "server_error" // other 5xx errors
+	ErrorClassTimeout    = "timeout"      // request timed out
+	ErrorClassNetwork    = "network"      // connection errors
+	ErrorClassAuth       = "auth"         // 401 and 403
+	ErrorClassRequest    = "bad_request"  // other 4xx errors
+	ErrorClassCanceled   = "canceled"     // request canceled
+	ErrorClassOther      = "other"
+)
+
+// errorClass returns the class of the request error, by the status of the provider error if reported,
+// otherwise by the error message
+func errorClass(err error) string {
+	var perr *Error
+	if errors.As(err, &perr) && perr.Status > 0 {
+		switch s := perr.Status; {
+		case s == http.StatusTooManyRequests:
+			return ErrorClassRateLimit
+		case s == 529, s == http.StatusServiceUnavailable:
+			return ErrorClassOverloaded
+		case s == http.StatusUnauthorized, s == http.StatusForbidden:
+			return ErrorClassAuth
+		case s == http.StatusRequestTimeout, s == http.StatusGatewayTimeout:
+			return ErrorClassTimeout
+		case s >= 500:
+			return ErrorClassServer
+		case s >= 400:
+			return ErrorClassRequest
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	case errors.Is(err, context.DeadlineExceeded), strings.Contains(msg, "timeout"), strings.Contains(msg, "deadline exceeded"):
+		return ErrorClassTimeout
+	case strings.Contains(msg, "rate limit"), strings.Contains(msg, "resource exhausted"), strings.Contains(msg, "429"):
+		return ErrorClassRateLimit
+	case strings.Contains(msg, "overloaded"), strings.Contains(msg, "503"), strings.Contains(msg, "service unavailable"):
+		return ErrorClassOverloaded
+	case strings.Contains(msg, "500"), strings.Contains(msg, "502"), strings.Contains(msg, "internal server error"),
+		strings.Contains(msg, "bad gateway"):
+		return ErrorClassServer
+	case strings.Contains(msg, "connection refused"), strings.Contains(msg, "connection reset"),
+		strings.Contains(msg, "broken pipe"), strings.Contains(msg, "no such host"):
+		return ErrorClassNetwork
+	default:
+		return ErrorClassOther
+	}
+}
+
+// NewRetryableProvider creates a provider wrapper with retry logic. Retries wait for the delay suggested
+// by the failed request if the provider reports it, like Retry-After of Anthropic 429 and 529 (overloaded)
+// responses or RetryInfo of Google RESOURCE_EXHAUSTED errors, otherwise for the backoff delay.
 func NewRetryableProvider(p Provider, opts RetryOptions) Provider {
 	// if attempts is 1 or less, no retries needed
 	if opts.Attempts <= 1 {
 		return p
 	}
 
-	// create repeater with exponential backoff
-	// the Factor controls the backoff type:
-	// 1.0 = constant delay (fixed)
-	// > 1.0 = exponential backoff
-	var rep *repeater.Repeater
-
-	if opts.Factor <= 1.0 {
-		// fixed delay strategy
-		rep = repeater.NewFixed(opts.Attempts, opts.Delay)
-	} else {
-		// exponential backoff with jitter
-		rep = repeater.NewBackoff(opts.Attempts, opts.Delay,
-			repeater.WithMaxDelay(opts.MaxDelay),
-			repeater.WithBackoffType(repeater.BackoffExponential),
-			repeater.WithJitter(0.1), // 10% jitter to avoid thundering herd
-		)
-	}
-
-	// set error classifier to determine retryable errors
-	rep.SetErrorClassifier(isRetryableError)
-
 	return &RetryableProvider{
 		provider: p,
-		repeater: rep,
+		opts:     opts,
 		name:     p.Name(),
 	}
 }
@@ -69,39 +117,116 @@ func (r *RetryableProvider) Name() string {
 
 // Generate sends a prompt to the provider with retry logic
 func (r *RetryableProvider) Generate(ctx context.Context, prompt string) (string, error) {
-	var result string
+	resp, err := r.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// GenerateResponse sends a prompt to the provider with retry logic and returns the response with metadata.
+// The response has attempts made, it is set on failure as well.
+func (r *RetryableProvider) GenerateResponse(ctx context.Context, prompt string) (Response, error) {
+	var result Response
 	var attempt int32
+	var attempts []Attempt
 
-	err := r.repeater.Do(ctx, func() error {
+	// repeater keeps the state of a run, so each request gets its own
+	delays := &retryDelays{opts: r.opts}
+	rep := repeater.NewWithStrategy(r.opts.Attempts, delays)
+	rep.SetErrorClassifier(func(err error) bool { return isRetryableError(err) && !delays.giveUp })
+
+	err := rep.Do(ctx, func() error {
 		currentAttempt := atomic.AddInt32(&attempt, 1)
-		text, err := r.provider.Generate(ctx, prompt)
+		st := time.Now()
+		resp, err := GenerateResponse(ctx, r.provider, prompt)
+		a := Attempt{Number: int(currentAttempt), Duration: time.Since(st)}
+		if currentAttempt > 1 {
+			a.Delay = delays.last
+		}
+		if err != nil {
+			a.ErrorClass, a.Error = errorClass(err), err.Error()
+		}
+		attempts = append(attempts, a)
 		if err != nil {
 			// log based on error type (classifier will handle retry decision)
 			if !isRetryableError(err) {
 				lgr.Printf("[DEBUG] %s: non-retryable error on attempt %d: %v", r.name, currentAttempt, err)
-			} else {
-				lgr.Printf("[INFO] %s: retryable error on attempt %d: %v", r.name, currentAttempt, err)
+				return err
+			}
+			lgr.Printf("[INFO] %s: retryable error on attempt %d: %v", r.name, currentAttempt, err)
+			delays.hint = retryHint(err)
+			if delays.hint > 0 {
+				delays.giveUp = r.hintTooLong(ctx, delays.hint)
+				lgr.Printf("[DEBUG] %s: provider suggested retry after %v", r.name, delays.hint)
 			}
 			return err
 		}
 
-		result = text
+		result = resp
 		return nil
 	})
 
 	if err != nil {
-		return "", err
+		return Response{Attempts: attempts}, err
 	}
 
-	stats := r.repeater.Stats()
+	stats := rep.Stats()
 	if stats.Attempts > 1 {
 		lgr.Printf("[INFO] %s: succeeded after %d attempts (total duration: %v)",
 			r.name, stats.Attempts, stats.TotalDuration)
 	}
 
+	result.Attempts = attempts
 	return result, nil
 }
 
+// hintTooLong checks if the retry delay suggested by the provider exceeds the max delay or the deadline
+// of the request, retrying earlier would fail again, so the request fails without waiting
+func (r *RetryableProvider) hintTooLong(ctx context.Context, hint time.Duration) bool {
+	if r.opts.MaxDelay > 0 && hint > r.opts.MaxDelay {
+		lgr.Printf("[INFO] %s: suggested retry delay %v exceeds max delay %v, not retrying", r.name, hint, r.opts.MaxDelay)
+		return true
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < hint {
+		lgr.Printf("[INFO] %s: suggested retry delay %v exceeds the deadline, not retrying", r.name, hint)
+		return true
+	}
+	return false
+}
+
+// retryDelays is the retry strategy of a single request. It returns the delay suggested by the last error
+// if reported, otherwise the fixed delay for factor of 1 or less, or the exponential backoff with 10% jitter
+// to avoid thundering herd.
+type retryDelays struct {
+	opts   RetryOptions
+	hint   time.Duration // delay suggested by the last error, 0 if not reported
+	giveUp bool          // suggested delay is too long to wait for
+	last   time.Duration // the last returned delay, waited before the next attempt
+}
+
+// NextDelay returns the delay before the attempt, attempt starts from 1
+func (d *retryDelays) NextDelay(attempt int) time.Duration {
+	d.last = d.delay(attempt)
+	return d.last
+}
+
+// delay calculates the delay before the attempt
+func (d *retryDelays) delay(attempt int) time.Duration {
+	if d.hint > 0 {
+		return d.hint
+	}
+	if d.opts.Factor <= 1.0 {
+		return d.opts.Delay
+	}
+	delay := float64(d.opts.Delay) * math.Pow(d.opts.Factor, float64(attempt-1))
+	if d.opts.MaxDelay > 0 && delay > float64(d.opts.MaxDelay) {
+		delay = float64(d.opts.MaxDelay)
+	}
+	jitter := delay * 0.1
+	return time.Duration(delay + rand.Float64()*jitter - jitter/2) //nolint:gosec // no need for secure random here
+}
+
 // Enabled returns whether this provider is enabled
 func (r *RetryableProvider) Enabled() bool {
 	return r.provider.Enabled()
@@ -113,6 +238,12 @@ func isRetryableError(err error) bool {
 		return false
 	}
 
+	// structured provider errors know their retry-ability
+	var perr *Error
+	if errors.As(err, &perr) {
+		return perr.Retryable
+	}
+
 	errStr := err.Error()
 
 	// definitely retryable errors
@@ -415,3 +415,175 @@ func TestRetryableProvider_FormattedError(t *testing.T) {
 	assert.Contains(t, err.Error(), "500 error on attempt 2") // should return last error
 	assert.Equal(t, 2, callCount)
 }
+
+func TestRetryableProvider_EmptyResponse(t *testing.T) {
+	callCount := 0
+	mock := &mocks.ProviderMock{
+		NameFunc:    func() string { return "Anthropic" },
+		EnabledFunc: func() bool { return true },
+		GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+			callCount++
+			if callCount == 1 {
+				return "", emptyResponseError("Anthropic", "anthropic returned empty response")
+			}
+			return "success", nil
+		},
+	}
+
+	wrapped := NewRetryableProvider(mock, RetryOptions{Attempts: 3, Delay: time.Millisecond, MaxDelay: 10 * time.Millisecond, Factor: 2})
+	result, err := wrapped.Generate(context.Background(), "test prompt")
+	require.NoError(t, err)
+	assert.Equal(t, "success", result)
+	assert.Equal(t, 2, callCount, "empty response retried")
+}
+
+func TestRetryableProvider_SuggestedDelay(t *testing.T) {
+	overloaded := func(retryAfter time.Duration) error {
+		return &Error{Provider: "test", Status: 529, Code: "overloaded_error", Message: "overloaded", Retryable: true,
+			RetryAfter: retryAfter}
+	}
+
+	t.Run("suggested delay used instead of backoff", func(t *testing.T) {
+		callCount := 0
+		mock := &mocks.ProviderMock{
+			NameFunc:    func() string { return "test" },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				callCount++
+				if callCount < 3 {
+					return "", overloaded(20 * time.Millisecond)
+				}
+				return "success", nil
+			},
+		}
+		wrapped := NewRetryableProvider(mock, RetryOptions{Attempts: 3, Delay: 10 * time.Second, MaxDelay: time.Minute, Factor: 2})
+
+		start := time.Now()
+		result, err := wrapped.Generate(context.Background(), "test prompt")
+		require.NoError(t, err)
+		assert.Equal(t, "success", result)
+		assert.Equal(t, 3, callCount)
+		assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+		assert.Less(t, time.Since(start), 5*time.Second, "backoff delay not used")
+	})
+
+	t.Run("suggested delay over max delay", func(t *testing.T) {
+		callCount := 0
+		mock := &mocks.ProviderMock{
+			NameFunc:    func() string { return "test" },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				callCount++
+				return "", overloaded(time.Hour)
+			},
+		}
+		wrapped := NewRetryableProvider(mock, RetryOptions{Attempts: 3, Delay: 10 * time.Millisecond, MaxDelay: 30 * time.Second, Factor: 2})
+
+		_, err := wrapped.Generate(context.Background(), "test prompt")
+		require.Error(t, err)
+		assert.Equal(t, 1, callCount, "not retried")
+	})
+
+	t.Run("suggested delay over deadline", func(t *testing.T) {
+		callCount := 0
+		mock := &mocks.ProviderMock{
+			NameFunc:    func() string { return "test" },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				callCount++
+				return "", overloaded(10 * time.Second)
+			},
+		}
+		wrapped := NewRetryableProvider(mock, RetryOptions{Attempts: 3, Delay: 10 * time.Millisecond, MaxDelay: time.Minute, Factor: 2})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		start := time.Now()
+		_, err := wrapped.Generate(ctx, "test prompt")
+		require.Error(t, err)
+		assert.Equal(t, 1, callCount, "not retried")
+		assert.Less(t, time.Since(start), 500*time.Millisecond, "failed without waiting")
+	})
+}
+
+func TestRetryDelays(t *testing.T) {
+	d := &retryDelays{opts: RetryOptions{Delay: time.Second, MaxDelay: 5 * time.Second, Factor: 2}}
+	assert.InDelta(t, time.Second, d.NextDelay(1), float64(100*time.Millisecond))
+	assert.InDelta(t, 4*time.Second, d.NextDelay(3), float64(400*time.Millisecond))
+	assert.InDelta(t, 5*time.Second, d.NextDelay(10), float64(500*time.Millisecond), "limited by max delay")
+
+	d.hint = 7 * time.Second
+	assert.Equal(t, 7*time.Second, d.NextDelay(1), "suggested delay used as is")
+
+	d = &retryDelays{opts: RetryOptions{Delay: time.Second, Factor: 1}}
+	assert.Equal(t, time.Second, d.NextDelay(5), "fixed delay")
+}
+
+func TestRetryableProvider_Attempts(t *testing.T) {
+	t.Run("retried and succeeded", func(t *testing.T) {
+		callCount := 0
+		mock := &mocks.ProviderMock{
+			NameFunc:    func() string { return "test" },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				callCount++
+				if callCount == 1 {
+					return "", &Error{Provider: "test", Status: 429, Message: "rate limit", Retryable: true}
+				}
+				return "success", nil
+			},
+		}
+		wrapped := NewRetryableProvider(mock, RetryOptions{Attempts: 3, Delay: 10 * time.Millisecond, Factor: 1})
+
+		resp, err := wrapped.(ResponseGenerator).GenerateResponse(context.Background(), "test prompt")
+		require.NoError(t, err)
+		assert.Equal(t, "success", resp.Text)
+		require.Len(t, resp.Attempts, 2)
+		assert.Equal(t, 1, resp.Attempts[0].Number)
+		assert.Equal(t, ErrorClassRateLimit, resp.Attempts[0].ErrorClass)
+		assert.Contains(t, resp.Attempts[0].Error, "rate limit")
+		assert.Zero(t, resp.Attempts[0].Delay, "no delay before the first attempt")
+		assert.Equal(t, Attempt{Number: 2, Delay: 10 * time.Millisecond, Duration: resp.Attempts[1].Duration}, resp.Attempts[1])
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		mock := &mocks.ProviderMock{
+			NameFunc:    func() string { return "test" },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				return "", errors.New("503 service unavailable")
+			},
+		}
+		wrapped := NewRetryableProvider(mock, RetryOptions{Attempts: 2, Delay: time.Millisecond, Factor: 1})
+
+		resp, err := wrapped.(ResponseGenerator).GenerateResponse(context.Background(), "test prompt")
+		require.Error(t, err)
+		require.Len(t, resp.Attempts, 2)
+		for i, a := range resp.Attempts {
+			assert.Equal(t, i+1, a.Number)
+			assert.Equal(t, ErrorClassOverloaded, a.ErrorClass)
+		}
+	})
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: &Error{Status: 429, Message: "slow down"}, want: ErrorClassRateLimit},
+		{err: &Error{Status: 529, Message: "overloaded"}, want: ErrorClassOverloaded},
+		{err: &Error{Status: 502, Message: "bad gateway"}, want: ErrorClassServer},
+		{err: &Error{Status: 401, Message: "invalid key"}, want: ErrorClassAuth},
+		{err: &Error{Status: 400, Message: "invalid request"}, want: ErrorClassRequest},
+		{err: errors.New("rate limit exceeded"), want: ErrorClassRateLimit},
+		{err: errors.New("request timeout"), want: ErrorClassTimeout},
+		{err: errors.New("500 internal server error"), want: ErrorClassServer},
+		{err: errors.New("connection refused"), want: ErrorClassNetwork},
+		{err: context.Canceled, want: ErrorClassCanceled},
+		{err: errors.New("something odd"), want: ErrorClassOther},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, errorClass(tt.err), "%v", tt.err)
+	}
+}
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// Timeouts defines deadlines of provider requests. Connect bounds only establishing the connection,
+// so slow generations are not killed by it, while Generation bounds the whole generation request.
+type Timeouts struct {
+	Connect    time.Duration // max time to connect to the API, including TLS handshake, 0 for no limit
+	Generation time.Duration // max time of a single generation request, 0 for no limit
+}
+
+// WithDefaults returns timeouts with unset (zero) values replaced by values from defaults
+func (t Timeouts) WithDefaults(defaults Timeouts) Timeouts {
+	if t.Connect <= 0 {
+		t.Connect = defaults.Connect
+	}
+	if t.Generation <= 0 {
+		t.Generation = defaults.Generation
+	}
+	return t
+}
+
+// newHTTPClient creates an HTTP client with the connect timeout applied to dialing and TLS handshake.
+// The client has no overall timeout, generation requests are bounded by context deadline instead.
+// With request trace enabled, the client logs full requests and responses. Received response data is reported
+// to the progress callback of the request context, see WithProgress, response bodies to the raw responses one,
+// see WithRawResponses, and rate limits to the quota one, see WithQuota.
+func newHTTPClient(connectTimeout time.Duration) *http.Client {
+	return configureHTTPClient(&http.Client{}, connectTimeout)
+}
+
+// providerHTTPClient returns the injected client with the connect timeout applied, or a new client if not injected.
+// The connect timeout is applied to a copy of *http.Client using the default or *http.Transport transport,
+// other client implementations are used as is.
+func providerHTTPClient(injected HTTPClient, connectTimeout time.Duration) HTTPClient {
+	switch c := injected.(type) {
+	case nil:
+		return newHTTPClient(connectTimeout)
+	case *http.Client:
+		res := *c
+		return configureHTTPClient(&res, connectTimeout)
+	default:
+		return injected
+	}
+}
+
+// configureHTTPClient applies the connect timeout, request trace, progress, raw responses and quota reporting
+// to the client transport
+func configureHTTPClient(client *http.Client, connectTimeout time.Duration) *http.Client {
+	if connectTimeout > 0 {
+		var transport *http.Transport
+		switch t := client.Transport.(type) {
+		case nil:
+			transport = http.DefaultTransport.(*http.Transport).Clone()
+		case *http.Transport:
+			transport = t.Clone()
+		default:
+			lgr.Printf("[DEBUG] connect timeout not applied to custom transport %T", client.Transport)
+		}
+		if transport != nil {
+			transport.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+			transport.TLSHandshakeTimeout = connectTimeout
+			client.Transport = transport
+		}
+	}
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if traceRequests.Load() {
+		next = newTraceTransport(next)
+	}
+	client.Transport = &progressTransport{next: &rawTransport{next: &quotaTransport{next: next}}}
+	return client
+}
+
+// generationContext returns a child context with the generation timeout applied, if set
+func generationContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
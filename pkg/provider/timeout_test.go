@@ -0,0 +1,142 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeouts_WithDefaults(t *testing.T) {
+	defaults := Timeouts{Connect: 10 * time.Second, Generation: time.Minute}
+
+	tests := []struct {
+		name     string
+		timeouts Timeouts
+		want     Timeouts
+	}{
+		{name: "unset", want: defaults},
+		{name: "connect set", timeouts: Timeouts{Connect: time.Second},
+			want: Timeouts{Connect: time.Second, Generation: time.Minute}},
+		{name: "generation set", timeouts: Timeouts{Generation: 10 * time.Minute},
+			want: Timeouts{Connect: 10 * time.Second, Generation: 10 * time.Minute}},
+		{name: "both set", timeouts: Timeouts{Connect: time.Second, Generation: time.Hour},
+			want: Timeouts{Connect: time.Second, Generation: time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.timeouts.WithDefaults(defaults))
+		})
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	t.Run("no connect timeout", func(t *testing.T) {
+		client := newHTTPClient(0)
+		assert.Equal(t, http.DefaultTransport, baseTransport(t, client))
+		assert.Zero(t, client.Timeout)
+	})
+
+	t.Run("connect timeout", func(t *testing.T) {
+		client := newHTTPClient(5 * time.Second)
+		transport, ok := baseTransport(t, client).(*http.Transport)
+		require.True(t, ok)
+		assert.Equal(t, 5*time.Second, transport.TLSHandshakeTimeout)
+		assert.NotNil(t, transport.DialContext)
+		assert.Zero(t, client.Timeout, "generation is not bounded by the client")
+	})
+}
+
+func TestProviderHTTPClient(t *testing.T) {
+	t.Run("not injected", func(t *testing.T) {
+		client, ok := providerHTTPClient(nil, 5*time.Second).(*http.Client)
+		require.True(t, ok)
+		transport, ok := baseTransport(t, client).(*http.Transport)
+		require.True(t, ok)
+		assert.Equal(t, 5*time.Second, transport.TLSHandshakeTimeout)
+	})
+
+	t.Run("injected http client", func(t *testing.T) {
+		injected := &http.Client{Transport: &http.Transport{MaxIdleConns: 7}, Timeout: time.Minute}
+		client, ok := providerHTTPClient(injected, 5*time.Second).(*http.Client)
+		require.True(t, ok)
+		require.NotSame(t, injected, client, "injected client not modified")
+		transport, ok := baseTransport(t, client).(*http.Transport)
+		require.True(t, ok)
+		assert.Equal(t, 5*time.Second, transport.TLSHandshakeTimeout)
+		assert.Equal(t, 7, transport.MaxIdleConns, "injected transport settings kept")
+		assert.Equal(t, time.Minute, client.Timeout)
+		assert.Zero(t, injected.Transport.(*http.Transport).TLSHandshakeTimeout)
+	})
+
+	t.Run("injected http client without connect timeout", func(t *testing.T) {
+		injected := &http.Client{}
+		client, ok := providerHTTPClient(injected, 0).(*http.Client)
+		require.True(t, ok)
+		assert.Equal(t, http.DefaultTransport, baseTransport(t, client))
+		assert.Nil(t, injected.Transport, "injected client not modified")
+	})
+
+	t.Run("custom client implementation", func(t *testing.T) {
+		injected := &mockHTTPClient{}
+		assert.Same(t, injected, providerHTTPClient(injected, 5*time.Second))
+	})
+}
+
+func TestGenerationTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(500 * time.Millisecond):
+		}
+	}))
+	defer server.Close()
+
+	t.Run("slow generation canceled", func(t *testing.T) {
+		p := NewOpenAI(Options{APIKey: "key", Model: "gpt-4o", Enabled: true, BaseURL: server.URL,
+			Timeouts: Timeouts{Connect: time.Second, Generation: 50 * time.Millisecond}})
+		st := time.Now()
+		_, err := p.Generate(context.Background(), "test")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(st), 500*time.Millisecond)
+	})
+
+	t.Run("connect timeout does not limit generation", func(t *testing.T) {
+		p := NewOpenAI(Options{APIKey: "key", Model: "gpt-4o", Enabled: true, BaseURL: server.URL,
+			Timeouts: Timeouts{Connect: 50 * time.Millisecond, Generation: 100 * time.Millisecond}})
+		_, err := p.Generate(context.Background(), "test")
+		require.ErrorIs(t, err, context.DeadlineExceeded, "failed by generation timeout, not connect timeout")
+	})
+
+	t.Run("no generation timeout", func(t *testing.T) {
+		ctx, cancel := generationContext(context.Background(), 0)
+		defer cancel()
+		_, ok := ctx.Deadline()
+		assert.False(t, ok)
+	})
+}
+
+// baseTransport returns the transport of the client wrapped by progress and quota reporting transports
+func baseTransport(t *testing.T, client *http.Client) http.RoundTripper {
+	t.Helper()
+	pt, ok := client.Transport.(*progressTransport)
+	require.True(t, ok, "progress reported by all clients")
+	rt, ok := pt.next.(*rawTransport)
+	require.True(t, ok, "raw responses reported by all clients")
+	qt, ok := rt.next.(*quotaTransport)
+	require.True(t, ok, "quota reported by all clients")
+	return qt.next
+}
+
+// mockHTTPClient is an HTTPClient implementation other than *http.Client
+type mockHTTPClient struct{}
+
+func (m *mockHTTPClient) Do(*http.Request) (*http.Response, error) {
+	return nil, errors.New("not implemented")
+}
@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// traceRequests enables logging of full HTTP requests and responses, set with EnableRequestTrace
+var traceRequests atomic.Bool
+
+// traceMask masks secrets in traced requests and responses, set with EnableRequestTrace
+var traceMask atomic.Pointer[MaskFunc]
+
+// MaskFunc returns data with secrets masked
+type MaskFunc func(data []byte) []byte
+
+// sensitiveHeaders defines headers with credentials, redacted in traced requests
+var sensitiveHeaders = map[string]bool{
+	"authorization":  true,
+	"x-api-key":      true,
+	"x-goog-api-key": true,
+	"api-key":        true,
+}
+
+// EnableRequestTrace sets logging of full HTTP requests and responses of providers at TRACE level,
+// with credential headers redacted and the rest of the dump, including URL and body, masked by mask.
+// Mask can be nil if there are no secrets to mask. It affects providers created after the call.
+func EnableRequestTrace(enabled bool, mask MaskFunc) {
+	traceRequests.Store(enabled)
+	traceMask.Store(&mask)
+}
+
+// traceTransport is an http.RoundTripper logging full requests and responses
+type traceTransport struct {
+	next http.RoundTripper
+	mask MaskFunc // masks secrets in dumps, optional
+}
+
+// newTraceTransport makes a trace transport with the mask set by EnableRequestTrace
+func newTraceTransport(next http.RoundTripper) *traceTransport {
+	res := &traceTransport{next: next}
+	if mask := traceMask.Load(); mask != nil {
+		res.mask = *mask
+	}
+	return res
+}
+
+// RoundTrip logs the request, sends it with the next transport and logs the response
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	url := t.masked([]byte(req.URL.Redacted()))
+	if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+		lgr.Printf("[TRACE] request %s %s\n%s", req.Method, url, t.masked([]byte(redactHeaders(dump))))
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		lgr.Printf("[TRACE] request %s %s failed: %s", req.Method, url, t.masked([]byte(err.Error())))
+		return nil, err
+	}
+	if dump, err := httputil.DumpResponse(resp, true); err == nil {
+		lgr.Printf("[TRACE] response %s %s\n%s", req.Method, url, t.masked([]byte(redactHeaders(dump))))
+	}
+	return resp, nil
+}
+
+// masked returns data with secrets masked, as is if there is no mask
+func (t *traceTransport) masked(data []byte) string {
+	if t.mask == nil {
+		return string(data)
+	}
+	return string(t.mask(data))
+}
+
+// redactHeaders replaces values of credential headers in the dumped request or response
+func redactHeaders(dump []byte) string {
+	var sb strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(dump))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(dump)+1)
+	inHeaders := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inHeaders {
+			if strings.TrimSpace(line) == "" {
+				inHeaders = false
+			} else if name, _, ok := strings.Cut(line, ":"); ok && sensitiveHeaders[strings.ToLower(strings.TrimSpace(name))] {
+				line = name + ": [REDACTED]"
+			}
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
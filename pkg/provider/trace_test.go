@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestTrace(t *testing.T) {
+	var logs bytes.Buffer
+	lgr.Setup(lgr.Trace, lgr.Out(&logs))
+	defer lgr.Setup() // restore default logger
+
+	EnableRequestTrace(true, func(data []byte) []byte {
+		return bytes.ReplaceAll(data, []byte("private-project"), []byte("******"))
+	})
+	defer EnableRequestTrace(false, nil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"content": "traced answer"}}]}`))
+	}))
+	defer server.Close()
+
+	p := NewOpenAI(Options{APIKey: "sk-secret", Model: "gpt-4o", Enabled: true, BaseURL: server.URL,
+		Timeouts: Timeouts{Connect: time.Second}})
+	resp, err := p.Generate(context.Background(), "traced prompt about private-project")
+	require.NoError(t, err)
+	assert.Equal(t, "traced answer", resp)
+
+	out := logs.String()
+	assert.Contains(t, out, "TRACE request POST "+server.URL+"/v1/chat/completions")
+	assert.Contains(t, out, "Authorization: [REDACTED]")
+	assert.NotContains(t, out, "sk-secret")
+	assert.Contains(t, out, "traced prompt about ******", "request body logged with secrets masked")
+	assert.NotContains(t, out, "private-project")
+	assert.Contains(t, out, "TRACE response POST")
+	assert.Contains(t, out, "traced answer", "response body logged")
+}
+
+func TestNewHTTPClient_Trace(t *testing.T) {
+	assert.Equal(t, http.DefaultTransport, baseTransport(t, newHTTPClient(0)), "no trace transport by default")
+
+	EnableRequestTrace(true, nil)
+	defer EnableRequestTrace(false, nil)
+	transport, ok := baseTransport(t, newHTTPClient(0)).(*traceTransport)
+	require.True(t, ok)
+	assert.Equal(t, http.DefaultTransport, transport.next)
+}
+
+func TestRedactHeaders(t *testing.T) {
+	dump := "POST /v1/messages HTTP/1.1\r\nX-Api-Key: sk-ant\r\nContent-Type: application/json\r\n\r\n{\"authorization: keep body\"}"
+	assert.Equal(t, "POST /v1/messages HTTP/1.1\nX-Api-Key: [REDACTED]\nContent-Type: application/json\n\n{\"authorization: keep body\"}",
+		redactHeaders([]byte(dump)), "credential headers redacted, body kept")
+}
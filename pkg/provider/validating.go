@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-pkgz/lgr"
+)
+
+// ValidatingProvider wraps a provider and checks its answers, re-asking the provider with a corrective
+// instruction when the answer fails the check. Unlike retries of transport errors, each attempt is
+// a new request with the failed answer and the validation error appended to the prompt.
+type ValidatingProvider struct {
+	provider    Provider
+	check       func(answer string) error // returns error describing why the answer is not valid
+	maxAttempts int                       // max number of requests, including the first one
+}
+
+// NewValidatingProvider creates a provider wrapper checking answers with check and making up to maxAttempts
+// requests in total until the answer is valid
+func NewValidatingProvider(p Provider, check func(answer string) error, maxAttempts int) Provider {
+	return &ValidatingProvider{provider: p, check: check, maxAttempts: max(maxAttempts, 1)}
+}
+
+// WrapProvidersWithValidation wraps multiple providers with answer validation
+func WrapProvidersWithValidation(providers []Provider, check func(answer string) error, maxAttempts int) []Provider {
+	wrapped := make([]Provider, len(providers))
+	for i, p := range providers {
+		wrapped[i] = NewValidatingProvider(p, check, maxAttempts)
+	}
+	return wrapped
+}
+
+// Name returns the provider name
+func (v *ValidatingProvider) Name() string {
+	return v.provider.Name()
+}
+
+// Enabled returns whether this provider is enabled
+func (v *ValidatingProvider) Enabled() bool {
+	return v.provider.Enabled()
+}
+
+// Generate sends a prompt to the provider and re-asks it until the answer is valid
+func (v *ValidatingProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	resp, err := v.GenerateResponse(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+// GenerateResponse sends a prompt to the provider and re-asks it until the answer is valid.
+// The response has the number of attempts made, it is set on failure as well.
+func (v *ValidatingProvider) GenerateResponse(ctx context.Context, prompt string) (Response, error) {
+	var checkErr error
+	var attempts []Attempt // attempts of retried requests of all validation attempts
+	req := prompt
+	for attempt := 1; attempt <= v.maxAttempts; attempt++ {
+		resp, err := GenerateResponse(ctx, v.provider, req)
+		attempts = append(attempts, resp.Attempts...)
+		if err != nil {
+			return Response{ValidationAttempts: attempt, Attempts: attempts}, err
+		}
+		if checkErr = v.check(resp.Text); checkErr == nil {
+			resp.ValidationAttempts, resp.Attempts = attempt, attempts
+			return resp, nil
+		}
+		lgr.Printf("[INFO] %s: answer failed validation on attempt %d of %d: %v", v.Name(), attempt, v.maxAttempts, checkErr)
+		req = buildCorrectivePrompt(prompt, resp.Text, checkErr)
+	}
+	return Response{ValidationAttempts: v.maxAttempts, Attempts: attempts},
+		fmt.Errorf("answer failed validation after %d attempts: %w", v.maxAttempts, checkErr)
+}
+
+// buildCorrectivePrompt creates a prompt asking the model to fix the answer which failed validation
+func buildCorrectivePrompt(prompt, answer string, checkErr error) string {
+	return fmt.Sprintf("%s\n\nYour previous answer was:\n\n%s\n\nIt failed validation: %v\n\n"+
+		"Answer again, fixing the problem. Reply only with the corrected answer.", prompt, answer, checkErr)
+}
@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatingProvider_GenerateResponse(t *testing.T) {
+	checkNumber := func(answer string) error {
+		if strings.Trim(answer, "0123456789") != "" {
+			return errors.New("not a number")
+		}
+		return nil
+	}
+
+	t.Run("valid first answer", func(t *testing.T) {
+		p := &partsProvider{responses: []Response{{Text: "42", Reasoning: "thinking"}}}
+		resp, err := NewValidatingProvider(p, checkNumber, 3).(*ValidatingProvider).GenerateResponse(context.Background(), "q")
+		require.NoError(t, err)
+		assert.Equal(t, Response{Text: "42", Reasoning: "thinking", ValidationAttempts: 1}, resp)
+		assert.Equal(t, []string{"q"}, p.prompts)
+	})
+
+	t.Run("re-asked with corrective instruction", func(t *testing.T) {
+		p := &partsProvider{responses: []Response{{Text: "forty two"}, {Text: "42"}}}
+		resp, err := NewValidatingProvider(p, checkNumber, 3).(*ValidatingProvider).GenerateResponse(context.Background(), "q")
+		require.NoError(t, err)
+		assert.Equal(t, "42", resp.Text)
+		assert.Equal(t, 2, resp.ValidationAttempts)
+		require.Len(t, p.prompts, 2)
+		assert.True(t, strings.HasPrefix(p.prompts[1], "q\n\nYour previous answer was:\n\nforty two\n\nIt failed validation: not a number"))
+	})
+
+	t.Run("all attempts failed", func(t *testing.T) {
+		p := &partsProvider{responses: []Response{{Text: "a"}, {Text: "b"}}}
+		resp, err := NewValidatingProvider(p, checkNumber, 2).(*ValidatingProvider).GenerateResponse(context.Background(), "q")
+		require.EqualError(t, err, "answer failed validation after 2 attempts: not a number")
+		assert.Equal(t, Response{ValidationAttempts: 2}, resp)
+	})
+
+	t.Run("retry attempts accumulated", func(t *testing.T) {
+		p := &partsProvider{responses: []Response{{Text: "a", Attempts: []Attempt{{Number: 1, ErrorClass: ErrorClassTimeout},
+			{Number: 2}}}, {Text: "42", Attempts: []Attempt{{Number: 1}}}}}
+		resp, err := NewValidatingProvider(p, checkNumber, 3).(*ValidatingProvider).GenerateResponse(context.Background(), "q")
+		require.NoError(t, err)
+		assert.Equal(t, []Attempt{{Number: 1, ErrorClass: ErrorClassTimeout}, {Number: 2}, {Number: 1}}, resp.Attempts)
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		p := &partsProvider{responses: []Response{{Text: "a"}, {}}, errs: []error{nil, errors.New("api error")}}
+		resp, err := NewValidatingProvider(p, checkNumber, 3).(*ValidatingProvider).GenerateResponse(context.Background(), "q")
+		require.EqualError(t, err, "api error")
+		assert.Equal(t, 2, resp.ValidationAttempts)
+	})
+}
+
+func TestWrapProvidersWithValidation(t *testing.T) {
+	p := &partsProvider{responses: []Response{{Text: "ok"}}}
+	wrapped := WrapProvidersWithValidation([]Provider{p}, func(string) error { return nil }, 0)
+	require.Len(t, wrapped, 1)
+	assert.Equal(t, "parts", wrapped[0].Name())
+	assert.True(t, wrapped[0].Enabled())
+	text, err := wrapped[0].Generate(context.Background(), "q")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", text)
+	assert.Equal(t, 1, wrapped[0].(*ValidatingProvider).maxAttempts, "at least one attempt")
+}
@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"context"
+	"strings"
+)
+
+// VariantProvider wraps a provider to send it a variant of the base prompt, like the prompt with file contents
+// wrapped in the format the provider handles better. Prompts containing the base prompt, e.g. extended with
+// instructions, get the variant in its place, and other prompts are sent as is.
+type VariantProvider struct {
+	provider Provider
+	base     string
+	variant  string
+}
+
+// NewVariantProvider makes a provider sending the variant in place of the base prompt
+func NewVariantProvider(p Provider, base, variant string) Provider {
+	if base == "" || base == variant {
+		return p
+	}
+	return &VariantProvider{provider: p, base: base, variant: variant}
+}
+
+// Name returns the provider name
+func (v *VariantProvider) Name() string {
+	return v.provider.Name()
+}
+
+// Enabled returns whether this provider is enabled
+func (v *VariantProvider) Enabled() bool {
+	return v.provider.Enabled()
+}
+
+// Generate sends the prompt, with the base prompt replaced by the variant, to the provider
+func (v *VariantProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	return v.provider.Generate(ctx, v.replace(prompt))
+}
+
+// GenerateResponse sends the prompt, with the base prompt replaced by the variant, to the provider
+func (v *VariantProvider) GenerateResponse(ctx context.Context, prompt string) (Response, error) {
+	return GenerateResponse(ctx, v.provider, v.replace(prompt))
+}
+
+// replace returns the prompt with the base prompt replaced by the variant
+func (v *VariantProvider) replace(prompt string) string {
+	return strings.Replace(prompt, v.base, v.variant, 1)
+}
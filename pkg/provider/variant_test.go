@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider/mocks"
+)
+
+func TestVariantProvider(t *testing.T) {
+	var prompts []string
+	mock := &mocks.ProviderMock{
+		NameFunc:    func() string { return "Anthropic" },
+		EnabledFunc: func() bool { return true },
+		GenerateFunc: func(_ context.Context, prompt string) (string, error) {
+			prompts = append(prompts, prompt)
+			return "ok", nil
+		},
+	}
+	assert.Equal(t, Provider(mock), NewVariantProvider(mock, "same", "same"), "not wrapped without variant")
+	assert.Equal(t, Provider(mock), NewVariantProvider(mock, "", "variant"), "not wrapped without base")
+
+	p := NewVariantProvider(mock, "review\n// file: a.go\nx", "review\n<file path=\"a.go\">\nx\n</file>")
+	assert.Equal(t, "Anthropic", p.Name())
+	assert.True(t, p.Enabled())
+
+	_, err := p.Generate(context.Background(), "review\n// file: a.go\nx")
+	require.NoError(t, err)
+	resp, err := GenerateResponse(context.Background(), p, "review\n// file: a.go\nx\n\nreturn findings as JSON")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp.Text)
+	_, err = p.Generate(context.Background(), "merge results")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"review\n<file path=\"a.go\">\nx\n</file>",
+		"review\n<file path=\"a.go\">\nx\n</file>\n\nreturn findings as JSON",
+		"merge results",
+	}, prompts)
+}
@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/auth"
+	"cloud.google.com/go/auth/credentials"
+)
+
+// vertexScope is the OAuth scope of Vertex AI requests
+const vertexScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// Vertex routes requests through Google Cloud Vertex AI instead of the provider API. Requests are authenticated
+// with application default credentials instead of the API key: the service account key file set with
+// GOOGLE_APPLICATION_CREDENTIALS, credentials of "gcloud auth application-default login", or the service account
+// of the Google Cloud environment mpt runs in.
+type Vertex struct {
+	Enabled  bool
+	Project  string // Google Cloud project, the project of the credentials if empty
+	Location string // region of the endpoint, like "us-central1", "global" if empty
+}
+
+// vertexClient is the HTTP client authenticating Vertex AI requests, with the project resolved from credentials
+type vertexClient struct {
+	client   *http.Client
+	project  string
+	location string
+}
+
+// newVertexClient finds application default credentials and makes the HTTP client adding their token to requests,
+// with the connect timeout, trace, progress and quota reporting of newHTTPClient
+func newVertexClient(ctx context.Context, v Vertex, connectTimeout time.Duration) (vertexClient, error) {
+	httpClient := newHTTPClient(connectTimeout)
+	creds, err := credentials.DetectDefault(&credentials.DetectOptions{Scopes: []string{vertexScope}, Client: httpClient})
+	if err != nil {
+		return vertexClient{}, fmt.Errorf("failed to find google cloud credentials: %w", err)
+	}
+	res := vertexClient{project: v.Project, location: v.Location}
+	if res.project == "" {
+		if res.project, err = creds.ProjectID(ctx); err != nil {
+			return vertexClient{}, fmt.Errorf("failed to get project of google cloud credentials: %w", err)
+		}
+	}
+	if res.project == "" {
+		return vertexClient{}, fmt.Errorf("google cloud project is not set and credentials have no project")
+	}
+	if res.location == "" {
+		res.location = "global"
+	}
+	quotaProject, err := creds.QuotaProjectID(ctx)
+	if err != nil {
+		return vertexClient{}, fmt.Errorf("failed to get quota project of google cloud credentials: %w", err)
+	}
+	res.client = &http.Client{Transport: &vertexTransport{creds: creds, quotaProject: quotaProject,
+		next: httpClient.Transport}}
+	return res, nil
+}
+
+// vertexTransport adds the token of credentials, and the quota project if set, to requests
+type vertexTransport struct {
+	creds        *auth.Credentials
+	quotaProject string
+	next         http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *vertexTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// token requests are not reported as raw responses of the provider, they have the token in the body
+	token, err := t.creds.Token(WithRawResponses(req.Context(), nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get google cloud token: %w", err)
+	}
+	typ := token.Type
+	if typ == "" {
+		typ = "Bearer"
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", typ+" "+token.Value)
+	if t.quotaProject != "" {
+		req.Header.Set("X-Goog-User-Project", t.quotaProject)
+	}
+	return t.next.RoundTrip(req)
+}
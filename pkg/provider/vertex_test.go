@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setVertexCredentials sets application default credentials to a service account key file getting tokens from
+// the server, and points Vertex AI requests to the server as well
+func setVertexCredentials(t *testing.T, server *httptest.Server, project string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	data, err := json.Marshal(map[string]string{"type": "service_account", "project_id": project,
+		"private_key_id": "key-1", "private_key": string(pemKey), "client_email": "mpt@test.iam.gserviceaccount.com",
+		"token_uri": server.URL + "/token"})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+	t.Setenv("GOOGLE_VERTEX_BASE_URL", server.URL)
+}
+
+func TestGoogle_Vertex(t *testing.T) {
+	var paths, auths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/token" {
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.Form.Get("grant_type"))
+			_, _ = w.Write([]byte(`{"access_token":"vertex-token","token_type":"Bearer","expires_in":3600}`))
+			return
+		}
+		paths, auths = append(paths, r.URL.Path), append(auths, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"answer from vertex"}],"role":"model"},` +
+			`"finishReason":"STOP"}],"modelVersion":"gemini-2.5-pro"}`))
+	}))
+	defer server.Close()
+	setVertexCredentials(t, server, "creds-project")
+
+	t.Run("project and location set", func(t *testing.T) {
+		p, err := CreateProvider(ProviderTypeGoogle, Options{Enabled: true, Model: "gemini-2.5-pro",
+			Vertex: Vertex{Enabled: true, Project: "my-project", Location: "europe-west4"}})
+		require.NoError(t, err)
+		resp, err := p.Generate(context.Background(), "question")
+		require.NoError(t, err)
+		assert.Equal(t, "answer from vertex", resp)
+		assert.Equal(t, "/v1beta1/projects/my-project/locations/europe-west4/publishers/google/models/"+
+			"gemini-2.5-pro:generateContent", paths[len(paths)-1])
+		assert.Equal(t, "Bearer vertex-token", auths[len(auths)-1])
+	})
+
+	t.Run("project of credentials", func(t *testing.T) {
+		p, err := CreateProvider(ProviderTypeGoogle, Options{Enabled: true, Model: "gemini-2.5-pro",
+			Vertex: Vertex{Enabled: true}})
+		require.NoError(t, err)
+		_, err = p.Generate(context.Background(), "question")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(paths[len(paths)-1], "/v1beta1/projects/creds-project/locations/global/"),
+			paths[len(paths)-1])
+	})
+
+	t.Run("no credentials", func(t *testing.T) {
+		t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", filepath.Join(t.TempDir(), "missing.json"))
+		_, err := CreateProvider(ProviderTypeGoogle, Options{Enabled: true, Model: "gemini-2.5-pro",
+			Vertex: Vertex{Enabled: true, Project: "my-project"}})
+		require.EqualError(t, err, `google provider failed to initialize with model "gemini-2.5-pro" on vertex AI - `+
+			"check google cloud credentials, project and location")
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		_, err := CreateProvider(ProviderTypeOpenAI, Options{Enabled: true, Model: "gpt-5", Vertex: Vertex{Enabled: true}})
+		require.EqualError(t, err, "provider validation failed: vertex AI is not supported by openai provider")
+	})
+}
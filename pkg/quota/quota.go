@@ -0,0 +1,114 @@
+// Package quota tracks rate limits reported by providers, shared by all runs of the process and optionally
+// persisted to a file, so exhausted providers are delayed or skipped instead of failing.
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+// Tracker keeps the latest quota of each provider. It is safe for concurrent use.
+type Tracker struct {
+	maxWait time.Duration // max time to wait for exhausted quota to reset, longer waits skip the provider
+	path    string        // state file, empty for in-memory state only
+	now     func() time.Time
+
+	mu     sync.Mutex
+	quotas map[string]provider.Quota
+}
+
+// New makes a tracker with state loaded from the file, if set. Missing file is not an error.
+func New(maxWait time.Duration, path string) (*Tracker, error) {
+	t := &Tracker{maxWait: maxWait, path: path, now: time.Now, quotas: map[string]provider.Quota{}}
+	if path == "" {
+		return t, nil
+	}
+	data, err := os.ReadFile(path) //nolint:gosec // state file is set by the user
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return t, nil
+		}
+		return nil, fmt.Errorf("failed to read quota state: %w", err)
+	}
+	if err := json.Unmarshal(data, &t.quotas); err != nil {
+		return nil, fmt.Errorf("invalid quota state %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Update records the quota reported by the provider and saves the state file, if set
+func (t *Tracker) Update(name string, q provider.Quota) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.quotas[name] = q
+	if until := q.ExhaustedUntil(t.now()); !until.IsZero() {
+		lgr.Printf("[DEBUG] quota of %s exhausted until %s", name, until.Format(time.RFC3339))
+	}
+	if t.path == "" {
+		return
+	}
+	if err := t.save(); err != nil {
+		lgr.Printf("[WARN] failed to save quota state: %v", err)
+	}
+}
+
+// Wait returns how long to wait before sending a request to the provider, zero if the quota is not exhausted.
+// It returns an error if the quota resets later than the max wait allows, and the provider should be skipped.
+func (t *Tracker) Wait(name string) (time.Duration, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	until := t.quotas[name].ExhaustedUntil(now)
+	if until.IsZero() {
+		return 0, nil
+	}
+	wait := until.Sub(now)
+	if wait > t.maxWait {
+		return 0, fmt.Errorf("quota exhausted until %s, longer than max wait %v", until.Format(time.RFC3339), t.maxWait)
+	}
+	return wait, nil
+}
+
+// Get returns the latest quota of the provider
+func (t *Tracker) Get(name string) (provider.Quota, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	q, ok := t.quotas[name]
+	return q, ok
+}
+
+// save writes the state file atomically, replacing it with a temporary file
+func (t *Tracker) save() error {
+	data, err := json.MarshalIndent(t.quotas, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode quota state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0o700); err != nil {
+		return fmt.Errorf("failed to make quota state directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(t.path), filepath.Base(t.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create quota state file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // removed only if not renamed
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write quota state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close quota state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), t.path); err != nil {
+		return fmt.Errorf("failed to replace quota state file: %w", err)
+	}
+	return nil
+}
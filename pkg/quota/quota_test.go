@@ -0,0 +1,73 @@
+package quota
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+func TestTracker_Wait(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	tr, err := New(time.Minute, "")
+	require.NoError(t, err)
+	tr.now = func() time.Time { return now }
+
+	wait, err := tr.Wait("OpenAI")
+	require.NoError(t, err)
+	assert.Zero(t, wait, "unknown provider is not delayed")
+
+	tr.Update("OpenAI", provider.Quota{RemainingRequests: 10, RemainingTokens: -1, ResetRequests: now.Add(time.Hour)})
+	wait, err = tr.Wait("OpenAI")
+	require.NoError(t, err)
+	assert.Zero(t, wait, "quota not exhausted")
+
+	tr.Update("OpenAI", provider.Quota{RemainingRequests: 0, RemainingTokens: -1, ResetRequests: now.Add(20 * time.Second)})
+	wait, err = tr.Wait("OpenAI")
+	require.NoError(t, err)
+	assert.Equal(t, 20*time.Second, wait)
+
+	tr.Update("Anthropic", provider.Quota{RemainingRequests: -1, RemainingTokens: 0, ResetTokens: now.Add(time.Hour)})
+	_, err = tr.Wait("Anthropic")
+	require.EqualError(t, err, "quota exhausted until 2025-05-01T13:00:00Z, longer than max wait 1m0s")
+
+	q, ok := tr.Get("Anthropic")
+	require.True(t, ok)
+	assert.Equal(t, 0, q.RemainingTokens)
+}
+
+func TestTracker_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "quota.json")
+	reset := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	tr, err := New(time.Minute, path)
+	require.NoError(t, err)
+	tr.Update("OpenAI", provider.Quota{RemainingRequests: 0, RemainingTokens: 500, ResetRequests: reset})
+
+	loaded, err := New(time.Minute, path)
+	require.NoError(t, err)
+	q, ok := loaded.Get("OpenAI")
+	require.True(t, ok)
+	assert.Equal(t, 500, q.RemainingTokens)
+	assert.True(t, reset.Equal(q.ResetRequests))
+	_, err = loaded.Wait("OpenAI")
+	require.ErrorContains(t, err, "quota exhausted until")
+
+	files, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "no temporary files left")
+
+	require.NoError(t, os.WriteFile(path, []byte("{bad"), 0o600))
+	_, err = New(time.Minute, path)
+	require.ErrorContains(t, err, "invalid quota state "+path)
+
+	tr, err = New(time.Minute, filepath.Join(t.TempDir(), "missing.json"))
+	require.NoError(t, err)
+	_, ok = tr.Get("OpenAI")
+	assert.False(t, ok)
+}
@@ -0,0 +1,207 @@
+package render
+
+import (
+	"strings"
+)
+
+// language describes tokens of a programming language for highlighting
+type language struct {
+	keywords     []string
+	lineComments []string  // markers of comments to the end of the line
+	blockComment [2]string // opening and closing markers of block comments, empty if not supported
+	quotes       string    // characters quoting strings
+	multiline    string    // quotes of strings which can span lines, like raw strings of Go
+}
+
+var (
+	cKeywords = []string{"break", "case", "char", "const", "continue", "default", "do", "double", "else", "enum",
+		"float", "for", "if", "int", "long", "return", "sizeof", "static", "struct", "switch", "typedef", "union",
+		"unsigned", "void", "while", "NULL"}
+	jsKeywords = []string{"async", "await", "break", "case", "catch", "class", "const", "continue", "default",
+		"delete", "do", "else", "export", "extends", "false", "finally", "for", "from", "function", "if", "import",
+		"in", "instanceof", "let", "new", "null", "of", "return", "static", "super", "switch", "this", "throw",
+		"true", "try", "typeof", "undefined", "var", "void", "while", "yield"}
+	sqlKeywords = []string{"select", "from", "where", "and", "or", "not", "insert", "into", "values", "update", "set",
+		"delete", "create", "table", "index", "drop", "alter", "join", "left", "right", "inner", "outer", "on",
+		"group", "by", "order", "having", "limit", "as", "null", "is", "in", "distinct", "union", "primary", "key"}
+)
+
+// languages are languages of code blocks highlighted by name
+var languages = map[string]language{
+	"go": {keywords: []string{"break", "case", "chan", "const", "continue", "default", "defer", "else",
+		"fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map", "package", "range", "return",
+		"select", "struct", "switch", "type", "var", "nil", "true", "false", "iota"},
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'`", multiline: "`"},
+	"python": {keywords: []string{"and", "as", "assert", "async", "await", "break", "class", "continue", "def",
+		"del", "elif", "else", "except", "finally", "for", "from", "global", "if", "import", "in", "is", "lambda",
+		"nonlocal", "not", "or", "pass", "raise", "return", "try", "while", "with", "yield", "None", "True", "False",
+		"self"},
+		lineComments: []string{"#"}, quotes: "\"'"},
+	"javascript": {keywords: jsKeywords,
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'`", multiline: "`"},
+	"typescript": {keywords: append(append([]string{}, jsKeywords...), "interface", "type", "enum", "implements",
+		"private", "public", "protected", "readonly", "as", "keyof", "any", "string", "number", "boolean"),
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'`", multiline: "`"},
+	"rust": {keywords: []string{"as", "async", "await", "break", "const", "continue", "crate", "else", "enum",
+		"extern", "false", "fn", "for", "if", "impl", "in", "let", "loop", "match", "mod", "move", "mut", "pub", "ref",
+		"return", "self", "Self", "static", "struct", "super", "trait", "true", "type", "unsafe", "use", "where",
+		"while"},
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\""},
+	"java": {keywords: []string{"abstract", "boolean", "break", "case", "catch", "class", "continue", "default",
+		"do", "else", "enum", "extends", "false", "final", "finally", "for", "if", "implements", "import",
+		"instanceof", "int", "interface", "long", "new", "null", "package", "private", "protected", "public",
+		"return", "static", "super", "switch", "this", "throw", "throws", "true", "try", "var", "void", "while"},
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'"},
+	"c": {keywords: cKeywords,
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'"},
+	"cpp": {keywords: append(append([]string{}, cKeywords...), "auto", "class", "delete", "namespace", "new",
+		"nullptr", "private", "protected", "public", "template", "this", "using", "virtual", "true", "false"),
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'"},
+	"bash": {keywords: []string{"if", "then", "else", "elif", "fi", "for", "while", "until", "do", "done", "case",
+		"esac", "in", "function", "return", "local", "export", "set", "echo"},
+		lineComments: []string{"#"}, quotes: "\"'"},
+	"sql": {keywords: append(append([]string{}, sqlKeywords...), upper(sqlKeywords)...),
+		lineComments: []string{"--"}, blockComment: [2]string{"/*", "*/"}, quotes: "'\""},
+	"yaml": {keywords: []string{"true", "false", "null", "yes", "no"}, lineComments: []string{"#"}, quotes: "\"'"},
+	"json": {keywords: []string{"true", "false", "null"}, quotes: "\""},
+}
+
+// languageAliases are names of code block languages other than names of languages
+var languageAliases = map[string]string{
+	"golang": "go", "py": "python", "python3": "python", "js": "javascript", "jsx": "javascript", "mjs": "javascript",
+	"ts": "typescript", "tsx": "typescript", "rs": "rust", "h": "c", "c++": "cpp", "cc": "cpp", "hpp": "cpp",
+	"sh": "bash", "shell": "bash", "zsh": "bash", "console": "bash", "yml": "yaml", "jsonc": "json",
+}
+
+// highlighter highlights lines of a code block, keeping the state of comments and strings spanning lines
+type highlighter struct {
+	lang     *language
+	theme    Theme
+	keywords map[string]bool
+	open     string // closing marker of the block comment or string open at the end of the previous line
+	style    string // style of the open block comment or string
+}
+
+// newHighlighter makes a highlighter of the language with token styles of the theme, lines of unknown
+// languages are kept as is
+func newHighlighter(name string, theme Theme) *highlighter {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name, _, _ = strings.Cut(name, " ")
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+	lang, ok := languages[name]
+	if !ok {
+		return &highlighter{}
+	}
+	h := &highlighter{lang: &lang, theme: theme, keywords: make(map[string]bool, len(lang.keywords))}
+	for _, k := range lang.keywords {
+		h.keywords[k] = true
+	}
+	return h
+}
+
+// line returns the line of code with tokens highlighted
+func (h *highlighter) line(s string) string {
+	if h.lang == nil {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		if h.open != "" {
+			end := strings.Index(s[i:], h.open)
+			if end < 0 {
+				sb.WriteString(paint(h.style, s[i:]))
+				return sb.String()
+			}
+			end += i + len(h.open)
+			sb.WriteString(paint(h.style, s[i:end]))
+			h.open, i = "", end
+			continue
+		}
+
+		rest := s[i:]
+		switch {
+		case h.lineComment(s, i):
+			sb.WriteString(paint(h.theme.Comment, rest))
+			return sb.String()
+		case h.lang.blockComment[0] != "" && strings.HasPrefix(rest, h.lang.blockComment[0]):
+			sb.WriteString(paint(h.theme.Comment, h.lang.blockComment[0]))
+			h.open, h.style = h.lang.blockComment[1], h.theme.Comment
+			i += len(h.lang.blockComment[0])
+		case strings.IndexByte(h.lang.quotes, rest[0]) >= 0:
+			end := stringEnd(rest)
+			if end < 0 && strings.IndexByte(h.lang.multiline, rest[0]) >= 0 {
+				sb.WriteString(paint(h.theme.String, rest))
+				h.open, h.style = rest[:1], h.theme.String
+				return sb.String()
+			}
+			if end < 0 {
+				end = len(rest)
+			}
+			sb.WriteString(paint(h.theme.String, rest[:end]))
+			i += end
+		case isDigit(rest[0]) && (i == 0 || !isIdent(s[i-1])):
+			n := 1
+			for n < len(rest) && (isIdent(rest[n]) || rest[n] == '.') {
+				n++
+			}
+			sb.WriteString(paint(h.theme.Number, rest[:n]))
+			i += n
+		case isIdent(rest[0]):
+			n := 1
+			for n < len(rest) && isIdent(rest[n]) {
+				n++
+			}
+			if h.keywords[rest[:n]] {
+				sb.WriteString(paint(h.theme.Keyword, rest[:n]))
+			} else {
+				sb.WriteString(rest[:n])
+			}
+			i += n
+		default:
+			sb.WriteByte(rest[0])
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// lineComment checks if a line comment starts at the position, "#" comments start at the start of a word only,
+// like in shell commands with "#" inside arguments
+func (h *highlighter) lineComment(s string, i int) bool {
+	for _, c := range h.lang.lineComments {
+		if strings.HasPrefix(s[i:], c) && (c != "#" || i == 0 || s[i-1] == ' ' || s[i-1] == '\t') {
+			return true
+		}
+	}
+	return false
+}
+
+// stringEnd returns the length of the string quoted with the first character of the text, -1 if it is not closed
+func stringEnd(text string) int {
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if text[0] != '`' {
+				i++
+			}
+		case text[0]:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// upper returns words in upper case
+func upper(words []string) []string {
+	res := make([]string, len(words))
+	for i, w := range words {
+		res[i] = strings.ToUpper(w)
+	}
+	return res
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c) || c >= 0x80
+}
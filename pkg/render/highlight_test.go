@@ -0,0 +1,45 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlighter_Line(t *testing.T) {
+	theme := Themes["dark"]
+	kw := func(s string) string { return theme.Keyword + s + reset }
+	str := func(s string) string { return theme.String + s + reset }
+	num := func(s string) string { return theme.Number + s + reset }
+	comment := func(s string) string { return theme.Comment + s + reset }
+
+	tests := []struct {
+		name, lang string
+		lines      []string
+		want       []string
+	}{
+		{name: "go", lang: "go", lines: []string{`func f() string { return "a\"b" + x1 } // done`},
+			want: []string{kw("func") + " f() string { " + kw("return") + " " + str(`"a\"b"`) + " + x1 } " + comment("// done")}},
+		{name: "alias", lang: "golang", lines: []string{"var n = 0x1F"}, want: []string{kw("var") + " n = " + num("0x1F")}},
+		{name: "block comment", lang: "c", lines: []string{"int x; /* start", "end */ return 1;"},
+			want: []string{kw("int") + " x; " + comment("/*") + comment(" start"), comment("end */") + " " + kw("return") + " " + num("1") + ";"}},
+		{name: "raw string", lang: "go", lines: []string{"s := `first", "second` + s"},
+			want: []string{"s := " + str("`first"), str("second`") + " + s"}},
+		{name: "shell comment", lang: "sh", lines: []string{"echo a#b # note"},
+			want: []string{kw("echo") + " a#b " + comment("# note")}},
+		{name: "unclosed string", lang: "python", lines: []string{`print("oops`, "x = None"},
+			want: []string{"print(" + str(`"oops`), "x = " + kw("None")}},
+		{name: "unknown", lang: "brainfuck", lines: []string{`if "x" 1`}, want: []string{`if "x" 1`}},
+		{name: "no language", lang: "", lines: []string{`return 1`}, want: []string{`return 1`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHighlighter(tt.lang, theme)
+			got := make([]string, 0, len(tt.lines))
+			for _, l := range tt.lines {
+				got = append(got, h.line(l))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
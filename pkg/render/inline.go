@@ -0,0 +1,162 @@
+package render
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// span is a part of text rendered in the style
+type span struct {
+	text  string
+	style string
+}
+
+// parseInline splits the text of a paragraph into spans of inline markdown: code, strong and emphasized text,
+// strikethrough and links. Markers without a closing pair are kept as text.
+func (r *Renderer) parseInline(text string) []span {
+	var res []span
+	var plain strings.Builder
+	add := func(s span) {
+		if plain.Len() > 0 {
+			res = append(res, span{text: plain.String()})
+			plain.Reset()
+		}
+		res = append(res, s)
+	}
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && strings.IndexByte("\\`*_~[]()#|", rest[1]) >= 0:
+			plain.WriteByte(rest[1])
+			i += 2
+			continue
+		case rest[0] == '`':
+			n := len(rest) - len(strings.TrimLeft(rest, "`"))
+			if end := strings.Index(rest[n:], rest[:n]); end >= 0 {
+				add(span{text: strings.TrimSpace(rest[n : n+end]), style: r.theme.Code})
+				i += n + end + n
+				continue
+			}
+		case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__"):
+			if end := closing(rest[2:], rest[:2]); end > 0 {
+				add(span{text: rest[2 : 2+end], style: bold})
+				i += 2 + end + 2
+				continue
+			}
+		case strings.HasPrefix(rest, "~~"):
+			if end := closing(rest[2:], "~~"); end > 0 {
+				add(span{text: rest[2 : 2+end], style: strike})
+				i += 2 + end + 2
+				continue
+			}
+		case rest[0] == '*' || rest[0] == '_' && !endsWithWord(text[:i]):
+			if end := closing(rest[1:], rest[:1]); end > 0 && (rest[0] == '*' || !startsWithWord(rest[1+end+1:])) {
+				add(span{text: rest[1 : 1+end], style: italic})
+				i += 1 + end + 1
+				continue
+			}
+		case rest[0] == '[':
+			if label, url, n, ok := link(rest); ok {
+				add(span{text: label, style: r.theme.Link})
+				if url != label {
+					add(span{text: " (" + url + ")", style: faint})
+				}
+				i += n
+				continue
+			}
+		}
+		plain.WriteByte(rest[0])
+		i++
+	}
+	if plain.Len() > 0 {
+		res = append(res, span{text: plain.String()})
+	}
+	return res
+}
+
+// closing returns the position of the marker closing emphasis in the text, -1 if not found. Emphasized text
+// can't start or end with a space.
+func closing(text, marker string) int {
+	if text == "" || text[0] == ' ' {
+		return -1
+	}
+	for from := 1; from < len(text); {
+		end := strings.Index(text[from:], marker)
+		if end < 0 {
+			return -1
+		}
+		end += from
+		if text[end-1] != ' ' {
+			return end
+		}
+		from = end + 1
+	}
+	return -1
+}
+
+// link parses the markdown link [label](url) at the start of the text, returns the length of the link
+func link(text string) (label, url string, n int, ok bool) {
+	end := strings.Index(text, "](")
+	if end < 0 || strings.ContainsRune(text[1:end], '[') {
+		return "", "", 0, false
+	}
+	urlEnd := strings.IndexByte(text[end+2:], ')')
+	if urlEnd < 0 {
+		return "", "", 0, false
+	}
+	return text[1:end], text[end+2 : end+2+urlEnd], end + 2 + urlEnd + 1, true
+}
+
+// endsWithWord checks if the text ends with a letter or a digit, underscores inside snake_case words are not emphasis
+func endsWithWord(text string) bool {
+	r, _ := utf8.DecodeLastRuneInString(text)
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// startsWithWord checks if the text starts with a letter or a digit
+func startsWithWord(text string) bool {
+	r, _ := utf8.DecodeRuneInString(text)
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// words splits spans into words separated by spaces, each word made of spans it's part of
+func words(spans []span) [][]span {
+	var res [][]span
+	var word []span
+	for _, s := range spans {
+		fields := strings.Split(s.text, " ")
+		for j, f := range fields {
+			if j > 0 && len(word) > 0 {
+				res = append(res, word)
+				word = nil
+			}
+			if f != "" {
+				word = append(word, span{text: f, style: s.style})
+			}
+		}
+	}
+	if len(word) > 0 {
+		res = append(res, word)
+	}
+	return res
+}
+
+// spansWidth returns the number of characters of spans on screen
+func spansWidth(spans []span) int {
+	var res int
+	for _, s := range spans {
+		res += utf8.RuneCountInString(s.text)
+	}
+	return res
+}
+
+// renderSpans joins spans with their styles added to the base style, spans without a style are in the base style
+func renderSpans(spans []span, base string) string {
+	var sb strings.Builder
+	for _, s := range spans {
+		sb.WriteString(paint(base+s.style, s.text))
+	}
+	return sb.String()
+}
@@ -0,0 +1,367 @@
+// Package render renders markdown answers for terminals: headings and emphasis with colors, code blocks with
+// syntax highlighting, tables with aligned columns, and paragraphs and list items wrapped to the width.
+// Section headers of mpt output, like "== generated by OpenAI ==", get a color distinct per provider, with
+// a separator line of the same color before them. Colors are set by the theme.
+package render
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ANSI escape sequences of styles
+const (
+	reset     = "\x1b[0m"
+	bold      = "\x1b[1m"
+	faint     = "\x1b[2m"
+	italic    = "\x1b[3m"
+	underline = "\x1b[4m"
+	reverse   = "\x1b[7m"
+	strike    = "\x1b[9m"
+)
+
+// defaultWidth is the width of rendered text if not set
+const defaultWidth = 80
+
+var (
+	sectionRe   = regexp.MustCompile(`^={2,4} (.+?) ={2,4}$`)
+	headingRe   = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+	setextRe    = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	fenceRe     = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^`]*)$")
+	ruleRe      = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	listRe      = regexp.MustCompile(`^([ \t]*)([-*+]|\d{1,9}[.)])[ \t]+(.*)$`)
+	quoteRe     = regexp.MustCompile(`^ {0,3}>[ \t]?(.*)$`)
+	delimiterRe = regexp.MustCompile(`^[ \t]*\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+)
+
+// Renderer renders markdown text for terminals
+type Renderer struct {
+	width int
+	theme Theme
+}
+
+// New makes a renderer wrapping text to the width, 80 if not positive, with the dark theme
+func New(width int) *Renderer {
+	if width <= 0 {
+		width = defaultWidth
+	}
+	return &Renderer{width: width, theme: Themes["dark"]}
+}
+
+// WithTheme sets the theme of rendered text
+func (r *Renderer) WithTheme(theme Theme) *Renderer {
+	r.theme = theme
+	return r
+}
+
+// Render returns the markdown text rendered with ANSI styles. Text of code blocks is kept as is, highlighted
+// for known languages, and long table rows are not wrapped.
+func (r *Renderer) Render(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	return strings.Join(r.render(lines, map[string]string{}), "\n")
+}
+
+// Headers returns the text with section headers styled and separated, and the rest of the text kept as is.
+// Lines of code blocks are not taken for headers.
+func (r *Renderer) Headers(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	res := make([]string, 0, len(lines))
+	sections := map[string]string{}
+	for i := 0; i < len(lines); i++ {
+		if m := fenceRe.FindStringSubmatch(lines[i]); m != nil {
+			end := min(closingFence(lines, i+1, m[2]), len(lines)-1)
+			res = append(res, lines[i:end+1]...)
+			i = end
+			continue
+		}
+		if m := sectionRe.FindStringSubmatch(lines[i]); m != nil {
+			res = append(res, r.section(m[1], sections, len(res) > 0)...)
+			continue
+		}
+		res = append(res, lines[i])
+	}
+	return strings.Join(res, "\n")
+}
+
+// section renders the section header with the title in the style of its provider, after a separator line
+// unless the section starts the text
+func (r *Renderer) section(title string, sections map[string]string, separated bool) []string {
+	style := r.theme.section(sectionKey(title), sections)
+	header := paint(style, "== "+title+" ==")
+	if !separated {
+		return []string{header}
+	}
+	return []string{paint(style, strings.Repeat("─", r.width)), header}
+}
+
+// render renders lines of markdown, with styles of section headers assigned to providers in sections
+func (r *Renderer) render(lines []string, sections map[string]string) []string {
+	var res, para []string // rendered lines and lines of the current paragraph
+	flush := func() {
+		if len(para) > 0 {
+			res = append(res, r.wrap(r.parseInline(strings.Join(para, " ")), "", "", "")...)
+			para = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		next := ""
+		if i+1 < len(lines) {
+			next = lines[i+1]
+		}
+		if len(para) > 0 && setextRe.MatchString(line) {
+			style := r.theme.Heading2
+			if strings.Contains(line, "=") {
+				style = r.theme.Heading1
+			}
+			res = append(res, r.wrap(r.parseInline(strings.Join(para, " ")), style, "", "")...)
+			para = nil
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			res = append(res, "")
+			continue
+		}
+		if !blockStart(line, next) {
+			para = append(para, strings.TrimSpace(line))
+			continue
+		}
+
+		flush()
+		switch {
+		case sectionRe.MatchString(line):
+			res = append(res, r.section(sectionRe.FindStringSubmatch(line)[1], sections, len(res) > 0)...)
+		case fenceRe.MatchString(line):
+			m := fenceRe.FindStringSubmatch(line)
+			end := closingFence(lines, i+1, m[2])
+			res = append(res, r.code(strings.TrimSpace(m[3]), lines[i+1:end], len(m[1]))...)
+			i = end
+		case headingRe.MatchString(line):
+			m := headingRe.FindStringSubmatch(line)
+			style := r.theme.Heading
+			switch len(m[1]) {
+			case 1:
+				style = r.theme.Heading1
+			case 2:
+				style = r.theme.Heading2
+			}
+			res = append(res, r.wrap(r.parseInline(m[2]), style, "", "")...)
+		case ruleRe.MatchString(line):
+			res = append(res, paint(r.theme.Rule, strings.Repeat("─", r.width)))
+		case quoteRe.MatchString(line):
+			var quote []string
+			for ; i < len(lines) && quoteRe.MatchString(lines[i]); i++ {
+				quote = append(quote, quoteRe.FindStringSubmatch(lines[i])[1])
+			}
+			i--
+			res = append(res, r.quote(quote, sections)...)
+		case listRe.MatchString(line):
+			item := []string{line}
+			for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" && !blockStart(lines[i+1], "") {
+				i++
+				item = append(item, strings.TrimSpace(lines[i]))
+			}
+			res = append(res, r.listItem(item)...)
+		default: // table
+			var rows []string
+			for ; i < len(lines) && strings.Contains(lines[i], "|"); i++ {
+				rows = append(rows, lines[i])
+			}
+			i--
+			res = append(res, r.table(rows)...)
+		}
+	}
+	flush()
+	return res
+}
+
+// blockStart checks if the line starts a block other than a paragraph, next is the line after it
+func blockStart(line, next string) bool {
+	return sectionRe.MatchString(line) || fenceRe.MatchString(line) || headingRe.MatchString(line) ||
+		ruleRe.MatchString(line) || quoteRe.MatchString(line) || listRe.MatchString(line) ||
+		strings.Contains(line, "|") && delimiterRe.MatchString(next)
+}
+
+// sectionKey returns the provider of the section header, like "OpenAI" for "generated by OpenAI" and
+// "mixed results by OpenAI, refined by Google", or the whole title for sections of other kinds
+func sectionKey(title string) string {
+	for _, sep := range []string{" by ", " from "} {
+		if _, after, ok := strings.Cut(title, sep); ok {
+			name, _, _ := strings.Cut(after, ",")
+			return strings.TrimSpace(name)
+		}
+	}
+	return title
+}
+
+// closingFence returns the index of the line closing the code block opened with the fence, starting from
+// the line from, or the number of lines if the block is not closed
+func closingFence(lines []string, from int, fence string) int {
+	for i := from; i < len(lines); i++ {
+		m := fenceRe.FindStringSubmatch(lines[i])
+		if m != nil && m[2][0] == fence[0] && len(m[2]) >= len(fence) && strings.TrimSpace(m[3]) == "" {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// quote renders lines of the quote, without quote markers, with a bar before them
+func (r *Renderer) quote(lines []string, sections map[string]string) []string {
+	inner := &Renderer{width: max(r.width-2, 20), theme: r.theme}
+	res := inner.render(lines, sections)
+	for i, l := range res {
+		res[i] = paint(r.theme.Quote, "│") + " " + l
+	}
+	return res
+}
+
+// listItem renders the list item, its first line with the marker followed by continuation lines, with the
+// text wrapped under the text of the first line. Bullets are replaced with dots, numbers are kept.
+func (r *Renderer) listItem(lines []string) []string {
+	m := listRe.FindStringSubmatch(lines[0])
+	lines[0] = m[3]
+	indent := strings.Repeat(" ", utf8.RuneCountInString(strings.ReplaceAll(m[1], "\t", "    ")))
+	marker := m[2]
+	if !isDigit(marker[0]) {
+		marker = "•"
+	}
+	return r.wrap(r.parseInline(strings.Join(lines, " ")), "", indent+marker+" ",
+		indent+strings.Repeat(" ", utf8.RuneCountInString(marker)+1))
+}
+
+// code renders lines of the code block, indented and highlighted for the language, with the language above.
+// Up to indent spaces of the opening fence are removed from the lines.
+func (r *Renderer) code(lang string, lines []string, indent int) []string {
+	res := make([]string, 0, len(lines)+1)
+	if lang != "" {
+		res = append(res, paint(faint, lang))
+	}
+	h := newHighlighter(lang, r.theme)
+	for _, line := range lines {
+		for n := 0; n < indent && strings.HasPrefix(line, " "); n++ {
+			line = line[1:]
+		}
+		res = append(res, "  "+h.line(line))
+	}
+	return res
+}
+
+// table renders rows of the table with aligned columns, the header row in bold and a line in place
+// of the delimiter row
+func (r *Renderer) table(rows []string) []string {
+	var cells [][][]span
+	var aligns []string
+	for i, row := range rows {
+		if i == 1 {
+			for _, c := range splitRow(row) {
+				aligns = append(aligns, strings.TrimSpace(c))
+			}
+			continue
+		}
+		var parsed [][]span
+		for _, c := range splitRow(row) {
+			parsed = append(parsed, r.parseInline(strings.TrimSpace(c)))
+		}
+		cells = append(cells, parsed)
+	}
+
+	var widths []int
+	for _, row := range cells {
+		for j, c := range row {
+			if j >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[j] = max(widths[j], spansWidth(c))
+		}
+	}
+
+	res := make([]string, 0, len(rows))
+	for i, row := range cells {
+		style := ""
+		if i == 0 {
+			style = bold
+		}
+		parts := make([]string, len(widths))
+		for j := range widths {
+			var c []span
+			if j < len(row) {
+				c = row[j]
+			}
+			pad := widths[j] - spansWidth(c)
+			left := 0
+			if j < len(aligns) {
+				switch a := aligns[j]; {
+				case strings.HasPrefix(a, ":") && strings.HasSuffix(a, ":"):
+					left = pad / 2
+				case strings.HasSuffix(a, ":"):
+					left = pad
+				}
+			}
+			parts[j] = strings.Repeat(" ", left) + renderSpans(c, style) + strings.Repeat(" ", pad-left)
+		}
+		res = append(res, strings.TrimRight(strings.Join(parts, " │ "), " "))
+		if i == 0 {
+			lines := make([]string, len(widths))
+			for j, w := range widths {
+				lines[j] = strings.Repeat("─", w)
+			}
+			res = append(res, paint(r.theme.Rule, strings.Join(lines, "─┼─")))
+		}
+	}
+	return res
+}
+
+// splitRow splits the table row into cells, by pipes not escaped and not in code spans
+func splitRow(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	if strings.HasSuffix(row, "|") && !strings.HasSuffix(row, `\|`) {
+		row = row[:len(row)-1]
+	}
+	var res []string
+	var cell strings.Builder
+	inCode := false
+	for i := 0; i < len(row); i++ {
+		switch c := row[i]; {
+		case c == '\\' && i+1 < len(row) && row[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case c == '`':
+			inCode = !inCode
+			cell.WriteByte(c)
+		case c == '|' && !inCode:
+			res = append(res, cell.String())
+			cell.Reset()
+		default:
+			cell.WriteByte(c)
+		}
+	}
+	return append(res, cell.String())
+}
+
+// wrap renders spans in the style and wraps them to the width, with the first line prefixed with first and
+// others with rest. Words longer than the width are kept on their own lines.
+func (r *Renderer) wrap(spans []span, style, first, rest string) []string {
+	var res []string
+	var line []string
+	prefix, lineWidth := first, 0
+	avail := func() int { return max(r.width-utf8.RuneCountInString(prefix), 20) }
+	for _, w := range words(spans) {
+		ww := spansWidth(w)
+		if lineWidth > 0 && lineWidth+1+ww > avail() {
+			res = append(res, prefix+strings.Join(line, " "))
+			line, lineWidth, prefix = nil, 0, rest
+		}
+		if lineWidth > 0 {
+			lineWidth++
+		}
+		line, lineWidth = append(line, renderSpans(w, style)), lineWidth+ww
+	}
+	return append(res, prefix+strings.Join(line, " "))
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
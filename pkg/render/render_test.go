@@ -0,0 +1,103 @@
+package render
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderer_Render(t *testing.T) {
+	dark := Themes["dark"]
+	tests := []struct {
+		name, text, want string
+	}{
+		{name: "plain", text: "just text", want: "just text"},
+		{name: "paragraph joined", text: "first line\nsecond line\n\nnext", want: "first line second line\n\nnext"},
+		{name: "inline", text: "use **bold**, *italic*, ~~old~~ and `go test`",
+			want: "use " + bold + "bold" + reset + ", " + italic + "italic" + reset + ", " + strike + "old" + reset + " and " +
+				dark.Code + "go" + reset + " " + dark.Code + "test" + reset},
+		{name: "snake case", text: "call my_func_name or 2 * 3 * 4", want: "call my_func_name or 2 * 3 * 4"},
+		{name: "escaped", text: `not \*emphasis\*`, want: "not *emphasis*"},
+		{name: "link", text: "see [docs](https://example.com)",
+			want: "see " + dark.Link + "docs" + reset + " " + faint + "(https://example.com)" + reset},
+		{name: "headings", text: "# Title\n## Part\n### Step",
+			want: dark.Heading1 + "Title" + reset + "\n" + dark.Heading2 + "Part" + reset + "\n" + bold + "Step" + reset},
+		{name: "setext heading", text: "Title\n=====", want: dark.Heading1 + "Title" + reset},
+		{name: "list", text: "- one\n* two\n  1. three", want: "• one\n• two\n  1. three"},
+		{name: "list item continued", text: "- one\n  more", want: "• one more"},
+		{name: "quote", text: "> quoted", want: dark.Quote + "│" + reset + " quoted"},
+		{name: "code", text: "```go\nx := 1\n```\nafter",
+			want: faint + "go" + reset + "\n  x := " + dark.Number + "1" + reset + "\nafter"},
+		{name: "unclosed code", text: "```\n**not bold**", want: "  **not bold**"},
+		{name: "table", text: "| a | long |\n|---|:-:|\n| 123 | x |",
+			want: bold + "a" + reset + "   │ " + bold + "long" + reset + "\n" + dark.Rule + "────┼─────" + reset + "\n123 │  x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, New(0).Render(tt.text))
+		})
+	}
+}
+
+func TestRenderer_RenderSections(t *testing.T) {
+	dark := Themes["dark"]
+	text := "== generated by OpenAI ==\nfirst\n\n== generated by Google ==\nsecond\n\n" +
+		"== mixed results by OpenAI, refined by Google ==\nmixed"
+	res := New(10).Render(text)
+	assert.Equal(t, "== generated by OpenAI ==\nfirst\n\n"+strings.Repeat("─", 10)+"\n== generated by Google ==\nsecond\n\n"+
+		strings.Repeat("─", 10)+"\n== mixed results by OpenAI, refined by Google ==\nmixed", stripANSI(res))
+	lines := strings.Split(res, "\n")
+	assert.Equal(t, bold+dark.Sections[0]+"== generated by OpenAI =="+reset, lines[0])
+	assert.Equal(t, bold+dark.Sections[1]+strings.Repeat("─", 10)+reset, lines[3], "separator in the color of the section")
+	assert.Equal(t, bold+dark.Sections[1]+"== generated by Google =="+reset, lines[4])
+	assert.True(t, strings.HasPrefix(lines[8], bold+dark.Sections[0]), "mixed result in the color of the mix provider")
+}
+
+func TestRenderer_Headers(t *testing.T) {
+	text := "== generated by OpenAI ==\n**first**\n```\n== not a header ==\n```\n\n== generated by Google ==\nsecond"
+	res := New(5).Headers(text)
+	assert.Equal(t, "== generated by OpenAI ==\n**first**\n```\n== not a header ==\n```\n\n─────\n"+
+		"== generated by Google ==\nsecond", stripANSI(res), "only headers styled")
+	assert.Contains(t, res, bold+Themes["dark"].Sections[1]+"== generated by Google =="+reset)
+
+	assert.Equal(t, "== generated by OpenAI ==\n```\n== open block ==", stripANSI(New(5).Headers("== generated by OpenAI ==\n```\n== open block ==")))
+}
+
+func TestRenderer_WithTheme(t *testing.T) {
+	text := "== generated by OpenAI ==\nuse `go test`\n\n== generated by Google ==\n```go\nreturn nil\n```"
+	res := New(5).WithTheme(Themes["mono"]).Render(text)
+	assert.Equal(t, bold+"== generated by OpenAI =="+reset+"\nuse go test\n\n"+bold+underline+"─────"+reset+"\n"+
+		bold+underline+"== generated by Google =="+reset+"\n"+faint+"go"+reset+"\n  "+bold+"return"+reset+" "+bold+"nil"+reset, res)
+
+	res = New(5).WithTheme(Theme{}).Render("== generated by OpenAI ==\n# Title\n> quote")
+	assert.Equal(t, bold+"== generated by OpenAI =="+reset+"\nTitle\n│ quote", res, "empty theme has bold headers only")
+}
+
+func TestRenderer_Wrap(t *testing.T) {
+	text := "The quick brown fox jumps over the lazy dog, then **runs away** quickly.\n\n" +
+		"- a list item long enough to be wrapped to the next line\n\n> quoted text wrapped to the width as well"
+	res := New(30).Render(text)
+	assert.Equal(t, "The quick brown fox jumps over\nthe lazy dog, then runs away\nquickly.\n\n"+
+		"• a list item long enough to\n  be wrapped to the next line\n\n│ quoted text wrapped to the\n│ width as well", stripANSI(res))
+
+	res = New(10).Render("abcde fghij klmno pq averyveryverylongword")
+	assert.Equal(t, "abcde fghij klmno pq\naveryveryverylongword", res, "lines are at least 20 characters wide")
+}
+
+func TestSectionKey(t *testing.T) {
+	tests := []struct{ title, want string }{
+		{"generated by OpenAI", "OpenAI"},
+		{"identical answer from OpenAI, Google", "OpenAI"},
+		{"mixed results by Anthropic, refined by OpenAI", "Anthropic"},
+		{"points of disagreement", "points of disagreement"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, sectionKey(tt.title), tt.title)
+	}
+}
+
+var ansiRe = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func stripANSI(s string) string { return ansiRe.ReplaceAllString(s, "") }
@@ -0,0 +1,62 @@
+package render
+
+// Theme is a set of styles of rendered text, as ANSI escape sequences. Empty styles are rendered as plain text.
+type Theme struct {
+	Sections []string // styles of section headers and separators, assigned to providers in the order of their sections
+
+	Heading1 string // level 1 headings
+	Heading2 string // level 2 headings
+	Heading  string // headings of other levels
+	Code     string // inline code
+	Link     string // link labels
+	Quote    string // quote bars
+	Rule     string // horizontal rules and table lines
+
+	Keyword string // keywords in code blocks
+	String  string // strings in code blocks
+	Number  string // numbers in code blocks
+	Comment string // comments in code blocks
+}
+
+// Themes are built-in themes by name: dark for terminals with dark background, light for light background,
+// and mono without colors, with bold, underlined and reversed text only
+var Themes = map[string]Theme{
+	"dark": {
+		Sections: []string{"\x1b[96m", "\x1b[95m", "\x1b[92m", "\x1b[93m", "\x1b[94m", "\x1b[91m"},
+		Heading1: bold + underline + "\x1b[95m", Heading2: bold + "\x1b[96m", Heading: bold,
+		Code: "\x1b[33m", Link: underline + "\x1b[94m", Quote: faint + italic, Rule: faint,
+		Keyword: "\x1b[95m", String: "\x1b[32m", Number: "\x1b[36m", Comment: "\x1b[90m",
+	},
+	"light": {
+		Sections: []string{"\x1b[34m", "\x1b[35m", "\x1b[32m", "\x1b[31m", "\x1b[36m", "\x1b[33m"},
+		Heading1: bold + underline + "\x1b[35m", Heading2: bold + "\x1b[34m", Heading: bold,
+		Code: "\x1b[31m", Link: underline + "\x1b[34m", Quote: faint + italic, Rule: faint,
+		Keyword: "\x1b[35m", String: "\x1b[32m", Number: "\x1b[34m", Comment: "\x1b[90m",
+	},
+	"mono": {
+		Sections: []string{"", underline, italic, reverse},
+		Heading1: bold + underline, Heading2: bold, Heading: bold,
+		Link: underline, Quote: faint, Rule: faint,
+		Keyword: bold, Comment: faint,
+	},
+}
+
+// section returns the style of the section header of the provider, assigning the next style of the theme to
+// providers seen first
+func (t Theme) section(key string, assigned map[string]string) string {
+	if len(t.Sections) == 0 {
+		return bold
+	}
+	if _, ok := assigned[key]; !ok {
+		assigned[key] = t.Sections[len(assigned)%len(t.Sections)]
+	}
+	return bold + assigned[key]
+}
+
+// paint returns the text in the style, the text as is if the style is empty
+func paint(style, text string) string {
+	if style == "" {
+		return text
+	}
+	return style + text + reset
+}
@@ -0,0 +1,204 @@
+// Package repair fixes broken markdown of provider answers, like code blocks left open by answers cut off
+// by the max tokens limit and tables without the delimiter row, so renderers of PR comments and reports
+// don't garble the rest of the answer.
+package repair
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	fenceRe     = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^`]*)$")
+	delimiterRe = regexp.MustCompile(`^[ \t]*\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+)
+
+// Markdown returns the answer with broken markdown repaired:
+//   - code blocks left open are closed, at the end of the answer or before the next block opened with
+//     a language, like ```go, which is an opening fence missing its closing one
+//   - tables get the delimiter row if it's missing, lose blank lines between rows, and rows with missing
+//     or extra cells are padded to the same number of cells, with pipes around them
+//
+// Content of code blocks is kept as is.
+func Markdown(answer string) string {
+	lines := strings.Split(strings.ReplaceAll(answer, "\r\n", "\n"), "\n")
+	res := make([]string, 0, len(lines)+2)
+	var table []string // rows of the current table
+	fence := ""        // opening fence of the current code block with its indent, empty outside of code blocks
+	flush := func() {
+		res = append(res, fixTable(table)...)
+		table = nil
+	}
+
+	for i, line := range lines {
+		m := fenceRe.FindStringSubmatch(line)
+		if fence != "" {
+			switch {
+			case m != nil && closes(m[2], fence) && m[3] == "":
+				fence = ""
+			case m != nil && m[2] == strings.TrimLeft(fence, " ") && m[3] != "":
+				// opening fence with a language inside the block, the previous block was not closed
+				res = append(res, fence)
+				fence = m[1] + m[2]
+			}
+			res = append(res, line)
+			continue
+		}
+		if m != nil {
+			flush()
+			fence = m[1] + m[2]
+			res = append(res, line)
+			continue
+		}
+
+		next := ""
+		if i+1 < len(lines) {
+			next = lines[i+1]
+		}
+		switch {
+		case isRow(line, table, next):
+			table = append(table, line)
+		case strings.TrimSpace(line) == "" && len(table) > 1 && isRow(next, table, "") && !startsTable(lines, i+1):
+			// blank line between rows of the table, skipped to keep the table whole
+		default:
+			flush()
+			res = append(res, line)
+		}
+	}
+	flush()
+
+	if fence != "" {
+		if n := len(res); res[n-1] == "" {
+			res = append(res[:n-1], fence, "")
+		} else {
+			res = append(res, fence)
+		}
+	}
+	return strings.Join(res, "\n")
+}
+
+// closes checks if the marker closes the code block opened by the fence: the same character, at least as long
+func closes(marker, fence string) bool {
+	fence = strings.TrimLeft(fence, " ")
+	return marker[0] == fence[0] && len(marker) >= len(fence)
+}
+
+// isRow checks if the line is a row of the table: a line starting with a pipe, a line with pipes inside
+// a table, or a header without outer pipes followed by the delimiter row
+func isRow(line string, table []string, next string) bool {
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case trimmed == "":
+		return false
+	case strings.HasPrefix(trimmed, "|"):
+		return true
+	case !strings.Contains(trimmed, "|"):
+		return false
+	case len(table) > 0:
+		return true
+	}
+	return delimiterRe.MatchString(next) && strings.Contains(next, "|")
+}
+
+// startsTable checks if the line at i is the header of a new table, followed by its delimiter row
+func startsTable(lines []string, i int) bool {
+	return i+1 < len(lines) && delimiterRe.MatchString(lines[i+1])
+}
+
+// fixTable returns rows of the table with the delimiter row added if missing and cells padded to the same
+// number in each row. Rows which are fine are kept as is. A single row is not a table and is kept as well.
+func fixTable(rows []string) []string {
+	if len(rows) < 2 {
+		return rows
+	}
+
+	// find the delimiter row, it should follow the header
+	delim := -1
+	for i, r := range rows {
+		if delimiterRe.MatchString(r) {
+			delim = i
+			break
+		}
+	}
+	var aligns []string
+	delimRow := ""
+	if delim >= 0 {
+		delimRow, aligns = rows[delim], cells(rows[delim])
+		rows = append(rows[:delim:delim], rows[delim+1:]...)
+	}
+
+	cols := 0
+	parsed := make([][]string, len(rows))
+	for i, r := range rows {
+		parsed[i] = cells(r)
+		cols = max(cols, len(parsed[i]))
+	}
+	delimFine := delim == 1 && len(aligns) == cols && hasPipes(delimRow)
+	for len(aligns) < cols {
+		aligns = append(aligns, "---")
+	}
+
+	res := make([]string, 0, len(rows)+1)
+	for i, r := range rows {
+		if len(parsed[i]) == cols && hasPipes(r) {
+			res = append(res, r)
+		} else {
+			res = append(res, formatRow(parsed[i], cols))
+		}
+		if i == 0 && delimFine {
+			res = append(res, delimRow)
+		} else if i == 0 {
+			res = append(res, formatRow(aligns, cols))
+		}
+	}
+	return res
+}
+
+// hasPipes checks if the row starts and ends with a pipe
+func hasPipes(row string) bool {
+	trimmed := strings.TrimSpace(row)
+	return len(trimmed) > 1 && strings.HasPrefix(trimmed, "|") && strings.HasSuffix(trimmed, "|") &&
+		!strings.HasSuffix(trimmed, `\|`)
+}
+
+// formatRow returns cells as a row with pipes around them, padded with empty cells to cols
+func formatRow(cc []string, cols int) string {
+	var sb strings.Builder
+	sb.WriteString("|")
+	for i := range cols {
+		if i < len(cc) && cc[i] != "" {
+			sb.WriteString(" " + cc[i])
+		}
+		sb.WriteString(" |")
+	}
+	return sb.String()
+}
+
+// cells splits the row into trimmed cells, pipes escaped or inside code spans don't split cells
+func cells(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	if strings.HasSuffix(row, "|") && !strings.HasSuffix(row, `\|`) {
+		row = strings.TrimSuffix(row, "|")
+	}
+	var res []string
+	var cell strings.Builder
+	inCode := false
+	for i := 0; i < len(row); i++ {
+		switch c := row[i]; {
+		case c == '\\' && i+1 < len(row):
+			cell.WriteByte(c)
+			cell.WriteByte(row[i+1])
+			i++
+		case c == '`':
+			inCode = !inCode
+			cell.WriteByte(c)
+		case c == '|' && !inCode:
+			res = append(res, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(c)
+		}
+	}
+	return append(res, strings.TrimSpace(cell.String()))
+}
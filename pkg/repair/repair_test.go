@@ -0,0 +1,41 @@
+package repair
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name, answer, want string
+	}{
+		{name: "fine", answer: "## Summary\n\n```go\nfunc f() {}\n```\n\n| a | b |\n|---|:-:|\n| 1 | 2 |\n",
+			want: "## Summary\n\n```go\nfunc f() {}\n```\n\n| a | b |\n|---|:-:|\n| 1 | 2 |\n"},
+		{name: "unclosed fence", answer: "Fix:\n\n```go\nfunc f() {\n\treturn\n",
+			want: "Fix:\n\n```go\nfunc f() {\n\treturn\n```\n"},
+		{name: "unclosed fence without newline", answer: "~~~~\ncode", want: "~~~~\ncode\n~~~~"},
+		{name: "fence not closed by shorter one", answer: "````md\n```go\nx\n```\n", want: "````md\n```go\nx\n```\n````\n"},
+		{name: "next block opened", answer: "```go\na := 1\n\nThen run:\n\n```bash\ngo test\n```",
+			want: "```go\na := 1\n\nThen run:\n\n```\n```bash\ngo test\n```"},
+		{name: "table in code block kept", answer: "```\n| a | b |\n| 1 |\n```", want: "```\n| a | b |\n| 1 |\n```"},
+		{name: "missing delimiter", answer: "| name | size |\n| a.go | 10 |\n| b.go | 20 |",
+			want: "| name | size |\n| --- | --- |\n| a.go | 10 |\n| b.go | 20 |"},
+		{name: "blank lines between rows", answer: "| a | b |\n|---|---|\n| 1 | 2 |\n\n| 3 | 4 |\n\nText",
+			want: "| a | b |\n|---|---|\n| 1 | 2 |\n| 3 | 4 |\n\nText"},
+		{name: "two tables", answer: "| a | b |\n|---|---|\n| 1 | 2 |\n\n| c |\n|---|\n| 3 |",
+			want: "| a | b |\n|---|---|\n| 1 | 2 |\n\n| c |\n|---|\n| 3 |"},
+		{name: "cells padded", answer: "| file | line | issue |\n|---|---|---|\n| a.go | 10 |\n| b.go | 20 | nil map | extra |",
+			want: "| file | line | issue | |\n| --- | --- | --- | --- |\n| a.go | 10 | | |\n| b.go | 20 | nil map | extra |"},
+		{name: "outer pipes", answer: "a | b\n:--|--:\n1 | 2", want: "| a | b |\n| :-- | --: |\n| 1 | 2 |"},
+		{name: "escaped and code pipes", answer: "| op | meaning |\n| `a|b` | a or b \\| c |",
+			want: "| op | meaning |\n| --- | --- |\n| `a|b` | a or b \\| c |"},
+		{name: "single row kept", answer: "Use | to pipe\n| just a line", want: "Use | to pipe\n| just a line"},
+		{name: "crlf", answer: "```\r\ncode\r\n", want: "```\ncode\n```\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Markdown(tt.answer))
+		})
+	}
+}
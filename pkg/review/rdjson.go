@@ -0,0 +1,81 @@
+package review
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// rdjsonResult is the root object of reviewdog diagnostic format (rdjson)
+type rdjsonResult struct {
+	Source      rdjsonSource       `json:"source"`
+	Diagnostics []rdjsonDiagnostic `json:"diagnostics"`
+}
+
+type rdjsonSource struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type rdjsonDiagnostic struct {
+	Message  string         `json:"message"`
+	Location rdjsonLocation `json:"location"`
+	Severity string         `json:"severity"`
+	Source   rdjsonSource   `json:"source"`
+}
+
+type rdjsonLocation struct {
+	Path  string      `json:"path"`
+	Range rdjsonRange `json:"range"`
+}
+
+type rdjsonRange struct {
+	Start rdjsonPosition `json:"start"`
+	End   rdjsonPosition `json:"end"`
+}
+
+type rdjsonPosition struct {
+	Line int `json:"line"`
+}
+
+// WriteRDJSON writes the report in reviewdog diagnostic format (rdjson).
+// Each diagnostic's source name lists the providers reported the finding.
+func (r Report) WriteRDJSON(w io.Writer) error {
+	diagnostics := make([]rdjsonDiagnostic, 0, len(r.Findings))
+	for _, f := range r.Findings {
+		diagnostics = append(diagnostics, rdjsonDiagnostic{
+			Message: f.Message,
+			Location: rdjsonLocation{
+				Path:  f.File,
+				Range: rdjsonRange{Start: rdjsonPosition{Line: f.StartLine}, End: rdjsonPosition{Line: f.EndLine}},
+			},
+			Severity: rdjsonSeverity(f.Severity),
+			Source:   rdjsonSource{Name: "mpt: " + strings.Join(f.Providers, ", ")},
+		})
+	}
+
+	res := rdjsonResult{
+		Source:      rdjsonSource{Name: "mpt", URL: "https://github.com/umputun/mpt"},
+		Diagnostics: diagnostics,
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(res); err != nil {
+		return fmt.Errorf("failed to encode rdjson: %w", err)
+	}
+	return nil
+}
+
+// rdjsonSeverity maps finding severity to reviewdog severity
+func rdjsonSeverity(severity string) string {
+	switch severity {
+	case SeverityError:
+		return "ERROR"
+	case SeverityWarning:
+		return "WARNING"
+	default:
+		return "INFO"
+	}
+}
@@ -0,0 +1,37 @@
+package review
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport_WriteRDJSON(t *testing.T) {
+	report := Report{Findings: []Finding{
+		{File: "a.go", StartLine: 10, EndLine: 11, Severity: SeverityError, Message: "bug", Providers: []string{"OpenAI", "Google"}},
+		{File: "b.go", StartLine: 3, EndLine: 3, Severity: SeverityWarning, Message: "smell", Providers: []string{"OpenAI"}},
+		{File: "c.go", StartLine: 1, EndLine: 1, Severity: SeverityNote, Message: "nit", Providers: []string{"Google"}},
+	}}
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteRDJSON(&buf))
+
+	var res rdjsonResult
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &res))
+	assert.Equal(t, "mpt", res.Source.Name)
+	require.Len(t, res.Diagnostics, 3)
+
+	assert.Equal(t, rdjsonDiagnostic{
+		Message: "bug",
+		Location: rdjsonLocation{Path: "a.go",
+			Range: rdjsonRange{Start: rdjsonPosition{Line: 10}, End: rdjsonPosition{Line: 11}}},
+		Severity: "ERROR",
+		Source:   rdjsonSource{Name: "mpt: OpenAI, Google"},
+	}, res.Diagnostics[0])
+	assert.Equal(t, "WARNING", res.Diagnostics[1].Severity)
+	assert.Equal(t, "INFO", res.Diagnostics[2].Severity)
+	assert.Equal(t, "mpt: Google", res.Diagnostics[2].Source.Name)
+}
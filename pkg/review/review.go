@@ -0,0 +1,218 @@
+// Package review provides parsing and aggregation of code review findings returned by providers.
+package review
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+// Severity levels of findings, matching SARIF result levels
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityNote    = "note"
+)
+
+// Instructions is appended to the prompt in review mode to make providers return parsable findings
+const Instructions = `Return your review as a list of findings. Each finding must reference a file and a line range.
+Respond ONLY with a JSON array inside a single ` + "```json" + ` code block, using this format:
+[{"file": "path/to/file.go", "start_line": 10, "end_line": 12, "severity": "error|warning|note", "message": "description of the issue and suggested fix"}]
+Use "error" for bugs and security issues, "warning" for likely problems and "note" for minor suggestions.
+Return an empty array if there are no findings.`
+
+// Finding represents a single review finding for a file and line range
+type Finding struct {
+	File      string   `json:"file"`
+	StartLine int      `json:"start_line"`
+	EndLine   int      `json:"end_line"`
+	Severity  string   `json:"severity"`
+	Message   string   `json:"message"`
+	Providers []string `json:"providers,omitempty"` // providers reported this finding
+}
+
+// FileFindings holds all findings for a single file
+type FileFindings struct {
+	File     string
+	Findings []Finding
+}
+
+// Report holds aggregated findings from all providers
+type Report struct {
+	Findings []Finding        // deduplicated findings, sorted by file and line
+	Errors   map[string]error // parse errors per provider
+
+	Name string            // name of the run, reported in run properties of SARIF log
+	Tags map[string]string // tags of the run, reported in run properties of SARIF log
+}
+
+// Parse extracts findings from a provider response. The response is expected to contain
+// a JSON array, either in a fenced code block or as a bare array.
+func Parse(text string) ([]Finding, error) {
+	raw := extractJSON(text)
+	if raw == "" {
+		return nil, fmt.Errorf("no findings array in response")
+	}
+
+	var findings []Finding
+	if err := json.Unmarshal([]byte(raw), &findings); err != nil {
+		return nil, fmt.Errorf("failed to parse findings: %w", err)
+	}
+
+	res := make([]Finding, 0, len(findings))
+	for _, f := range findings {
+		if f.File == "" || strings.TrimSpace(f.Message) == "" {
+			continue // finding without file or message is not actionable
+		}
+		res = append(res, normalize(f))
+	}
+	return res, nil
+}
+
+// Aggregate parses findings from all successful provider results, attributes each finding
+// to its providers and merges findings reported for the same file and line range.
+func Aggregate(results []provider.Result) Report {
+	report := Report{Errors: make(map[string]error)}
+	index := make(map[string]int) // dedupe key -> position in report.Findings
+
+	for _, r := range results {
+		if r.Error != nil {
+			continue
+		}
+		findings, err := Parse(r.Text)
+		if err != nil {
+			report.Errors[r.Provider] = err
+			continue
+		}
+		for _, f := range findings {
+			key := fmt.Sprintf("%s:%d-%d", f.File, f.StartLine, f.EndLine)
+			if pos, ok := index[key]; ok {
+				existing := &report.Findings[pos]
+				existing.Providers = appendUnique(existing.Providers, r.Provider)
+				if severityRank(f.Severity) > severityRank(existing.Severity) {
+					existing.Severity = f.Severity
+				}
+				continue
+			}
+			f.Providers = []string{r.Provider}
+			index[key] = len(report.Findings)
+			report.Findings = append(report.Findings, f)
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.StartLine != b.StartLine {
+			return a.StartLine < b.StartLine
+		}
+		return a.EndLine < b.EndLine
+	})
+	return report
+}
+
+// ByFile returns findings grouped by file, in file order
+func (r Report) ByFile() []FileFindings {
+	var res []FileFindings
+	for _, f := range r.Findings {
+		if len(res) == 0 || res[len(res)-1].File != f.File {
+			res = append(res, FileFindings{File: f.File})
+		}
+		res[len(res)-1].Findings = append(res[len(res)-1].Findings, f)
+	}
+	return res
+}
+
+// Format formats the report as human-readable text grouped by file
+func (r Report) Format() string {
+	if len(r.Findings) == 0 {
+		return "no findings"
+	}
+
+	var sb strings.Builder
+	for i, ff := range r.ByFile() {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(fmt.Sprintf("== %s ==\n", ff.File))
+		for _, f := range ff.Findings {
+			lines := fmt.Sprintf("%d", f.StartLine)
+			if f.EndLine > f.StartLine {
+				lines = fmt.Sprintf("%d-%d", f.StartLine, f.EndLine)
+			}
+			sb.WriteString(fmt.Sprintf("[%s] line %s: %s (%s)\n", f.Severity, lines, f.Message,
+				strings.Join(f.Providers, ", ")))
+		}
+	}
+	return sb.String()
+}
+
+// extractJSON returns the JSON array from a fenced code block or the outermost brackets
+func extractJSON(text string) string {
+	if start := strings.Index(text, "```json"); start >= 0 {
+		body := text[start+len("```json"):]
+		if end := strings.Index(body, "```"); end >= 0 {
+			return strings.TrimSpace(body[:end])
+		}
+	}
+
+	start, end := strings.Index(text, "["), strings.LastIndex(text, "]")
+	if start < 0 || end <= start {
+		return ""
+	}
+	return text[start : end+1]
+}
+
+// normalize cleans up file path, line range and severity of a finding
+func normalize(f Finding) Finding {
+	f.File = filepath.ToSlash(filepath.Clean(strings.TrimSpace(f.File)))
+	f.Message = strings.TrimSpace(f.Message)
+	if f.StartLine < 1 {
+		f.StartLine = 1
+	}
+	if f.EndLine < f.StartLine {
+		f.EndLine = f.StartLine
+	}
+	f.Severity = normalizeSeverity(f.Severity)
+	return f
+}
+
+// normalizeSeverity maps severity names used by models to error, warning or note
+func normalizeSeverity(severity string) string {
+	switch strings.ToLower(strings.TrimSpace(severity)) {
+	case "error", "critical", "high", "blocker", "major":
+		return SeverityError
+	case "note", "info", "low", "minor", "suggestion", "nit":
+		return SeverityNote
+	default:
+		return SeverityWarning
+	}
+}
+
+// severityRank returns the rank of severity for comparison, higher is more severe
+func severityRank(severity string) int {
+	switch severity {
+	case SeverityError:
+		return 2
+	case SeverityWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// appendUnique appends value to the slice if it's not already present
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
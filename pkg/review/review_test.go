@@ -0,0 +1,89 @@
+package review
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []Finding
+		wantErr string
+	}{
+		{
+			name: "fenced json block",
+			text: "Here is the review:\n```json\n" +
+				`[{"file": "./main.go", "start_line": 10, "end_line": 12, "severity": "high", "message": " nil deref "}]` +
+				"\n```\nthanks",
+			want: []Finding{{File: "main.go", StartLine: 10, EndLine: 12, Severity: SeverityError, Message: "nil deref"}},
+		},
+		{
+			name: "bare array with missing end line",
+			text: `[{"file": "pkg/a.go", "start_line": 5, "severity": "nit", "message": "rename"}]`,
+			want: []Finding{{File: "pkg/a.go", StartLine: 5, EndLine: 5, Severity: SeverityNote, Message: "rename"}},
+		},
+		{
+			name: "skip findings without file or message",
+			text: `[{"file": "", "start_line": 1, "message": "x"}, {"file": "a.go", "start_line": 1, "message": ""},
+				{"file": "b.go", "start_line": 0, "message": "unknown severity"}]`,
+			want: []Finding{{File: "b.go", StartLine: 1, EndLine: 1, Severity: SeverityWarning, Message: "unknown severity"}},
+		},
+		{name: "empty array", text: "```json\n[]\n```", want: []Finding{}},
+		{name: "no array", text: "looks good to me", wantErr: "no findings array in response"},
+		{name: "invalid json", text: "[not json]", wantErr: "failed to parse findings"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.text)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	results := []provider.Result{
+		{Provider: "OpenAI", Text: `[{"file": "b.go", "start_line": 3, "severity": "warning", "message": "unused var"},
+			{"file": "a.go", "start_line": 10, "end_line": 11, "severity": "note", "message": "simplify"}]`},
+		{Provider: "Anthropic", Text: `[{"file": "a.go", "start_line": 10, "end_line": 11, "severity": "error", "message": "bug"},
+			{"file": "a.go", "start_line": 2, "severity": "warning", "message": "shadowing"}]`},
+		{Provider: "Google", Text: "no structured output"},
+		{Provider: "Failed", Error: errors.New("api error")},
+	}
+
+	report := Aggregate(results)
+	require.Len(t, report.Findings, 3)
+	assert.Equal(t, Finding{File: "a.go", StartLine: 2, EndLine: 2, Severity: SeverityWarning, Message: "shadowing",
+		Providers: []string{"Anthropic"}}, report.Findings[0])
+	assert.Equal(t, Finding{File: "a.go", StartLine: 10, EndLine: 11, Severity: SeverityError, Message: "simplify",
+		Providers: []string{"OpenAI", "Anthropic"}}, report.Findings[1])
+	assert.Equal(t, "b.go", report.Findings[2].File)
+
+	require.Len(t, report.Errors, 1)
+	assert.Contains(t, report.Errors, "Google")
+
+	byFile := report.ByFile()
+	require.Len(t, byFile, 2)
+	assert.Equal(t, "a.go", byFile[0].File)
+	assert.Len(t, byFile[0].Findings, 2)
+	assert.Equal(t, "b.go", byFile[1].File)
+	assert.Len(t, byFile[1].Findings, 1)
+
+	expected := "== a.go ==\n[warning] line 2: shadowing (Anthropic)\n[error] line 10-11: simplify (OpenAI, Anthropic)\n" +
+		"\n== b.go ==\n[warning] line 3: unused var (OpenAI)\n"
+	assert.Equal(t, expected, report.Format())
+	assert.Equal(t, "no findings", Report{}.Format())
+}
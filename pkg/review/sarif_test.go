@@ -0,0 +1,52 @@
+package review
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport_WriteSARIF(t *testing.T) {
+	report := Report{Findings: []Finding{
+		{File: "a.go", StartLine: 10, EndLine: 11, Severity: SeverityError, Message: "bug", Providers: []string{"OpenAI", "Google"}},
+	}}
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteSARIF(&buf, "v1.2.3"))
+
+	var log map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+	assert.Equal(t, "2.1.0", log["version"])
+
+	runs := log["runs"].([]any)
+	require.Len(t, runs, 1)
+	run := runs[0].(map[string]any)
+	driver := run["tool"].(map[string]any)["driver"].(map[string]any)
+	assert.Equal(t, "mpt", driver["name"])
+	assert.Equal(t, "v1.2.3", driver["version"])
+
+	results := run["results"].([]any)
+	require.Len(t, results, 1)
+	res := results[0].(map[string]any)
+	assert.Equal(t, "error", res["level"])
+	assert.Equal(t, "bug", res["message"].(map[string]any)["text"])
+	loc := res["locations"].([]any)[0].(map[string]any)["physicalLocation"].(map[string]any)
+	assert.Equal(t, "a.go", loc["artifactLocation"].(map[string]any)["uri"])
+	assert.InDelta(t, 10, loc["region"].(map[string]any)["startLine"], 0)
+	assert.InDelta(t, 11, loc["region"].(map[string]any)["endLine"], 0)
+	assert.Equal(t, []any{"OpenAI", "Google"}, res["properties"].(map[string]any)["providers"])
+	assert.NotContains(t, run, "properties", "no run properties without name and tags")
+
+	t.Run("run name and tags", func(t *testing.T) {
+		report := Report{Name: "pr-1234", Tags: map[string]string{"ticket": "SEC-42"}}
+		var buf bytes.Buffer
+		require.NoError(t, report.WriteSARIF(&buf, "v1.2.3"))
+		var log map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+		run := log["runs"].([]any)[0].(map[string]any)
+		assert.Equal(t, map[string]any{"name": "pr-1234", "tags": map[string]any{"ticket": "SEC-42"}}, run["properties"])
+	})
+}
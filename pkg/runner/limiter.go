@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"context"
+	"strings"
+)
+
+// ProviderLimiter limits in-flight requests of each provider with a fixed number of slots,
+// providers without a limit are not limited
+type ProviderLimiter struct {
+	slots map[string]chan struct{} // request slots of limited providers, keyed by lowercase name
+}
+
+// NewProviderLimiter makes a limiter with max in-flight requests keyed by provider names, matched
+// case-insensitively. Non-positive limits are ignored.
+func NewProviderLimiter(limits map[string]int) *ProviderLimiter {
+	l := &ProviderLimiter{slots: map[string]chan struct{}{}}
+	for name, n := range limits {
+		if n > 0 {
+			l.slots[strings.ToLower(name)] = make(chan struct{}, n)
+		}
+	}
+	return l
+}
+
+// Acquire waits for a free request slot of the provider and returns the func releasing it,
+// or an error if the context is done while waiting
+func (l *ProviderLimiter) Acquire(ctx context.Context, providerName string) (release func(), err error) {
+	slots, ok := l.slots[strings.ToLower(providerName)]
+	if !ok {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
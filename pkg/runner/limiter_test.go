@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/runner/mocks"
+)
+
+func TestProviderLimiter_Acquire(t *testing.T) {
+	l := NewProviderLimiter(map[string]int{"Local": 1, "Cloud": 0})
+
+	release, err := l.Acquire(context.Background(), "local")
+	require.NoError(t, err)
+
+	// the only slot is taken, the next request waits until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.Acquire(ctx, "LOCAL")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// providers without a positive limit are not limited
+	for range 3 {
+		_, err = l.Acquire(ctx, "Cloud")
+		require.NoError(t, err)
+	}
+
+	release()
+	release, err = l.Acquire(context.Background(), "Local")
+	require.NoError(t, err)
+	release()
+}
+
+func TestRunner_LimiterWaitCanceled(t *testing.T) {
+	l := NewProviderLimiter(map[string]int{"Local": 1})
+	release, err := l.Acquire(context.Background(), "Local")
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	p := &mocks.ProviderMock{
+		NameFunc:     func() string { return "Local" },
+		EnabledFunc:  func() bool { return true },
+		GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return "text", nil },
+	}
+	r := New(p).WithLimiter(l)
+	_, err = r.Run(ctx, "test prompt")
+	require.Error(t, err)
+	assert.Empty(t, p.GenerateCalls(), "provider not called")
+	results := r.GetResults()
+	require.Len(t, results, 1)
+	assert.ErrorIs(t, results[0].Error, context.DeadlineExceeded)
+}
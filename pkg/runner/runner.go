@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-pkgz/lgr"
 
@@ -14,10 +17,67 @@ import (
 
 //go:generate moq -out mocks/provider.go -pkg mocks -skip-ensure -fmt goimports . Provider
 
-// Runner executes prompts across multiple providers in parallel
+// Order defines the order of provider results
+type Order string
+
+const (
+	// OrderConfigured keeps results in the order providers were configured
+	OrderConfigured Order = "configured"
+	// OrderName sorts results by provider name
+	OrderName Order = "name"
+	// OrderLatency sorts results by response latency, fastest first
+	OrderLatency Order = "latency"
+)
+
+// Hooks defines callbacks on runner lifecycle events. Provider callbacks are called concurrently
+// from provider goroutines, so implementations must be safe for concurrent use.
+type Hooks interface {
+	OnStart(providerName string)                    // called when the prompt is sent to the provider, after waits for limits
+	OnProgress(providerName string, received int64) // called as the provider response arrives, with bytes received so far
+	OnProviderDone(result provider.Result)          // called when the provider request completes, successfully or not
+	OnAllDone(results []provider.Result, err error) // called once the run is completed, with results in the final order
+}
+
+// ChunkHooks is implemented by hooks receiving the response text as it is generated. Providers supporting
+// streaming stream responses only if any of hooks implements it, see provider.WithChunks.
+type ChunkHooks interface {
+	OnChunk(providerName, text string) // called with pieces of the response text, empty text when a streamed response starts
+}
+
+// QuotaTracker keeps rate limits reported by providers. It is shared by concurrent provider requests,
+// so implementations must be safe for concurrent use.
+type QuotaTracker interface {
+	Update(providerName string, q provider.Quota)    // records the quota reported by the provider
+	Wait(providerName string) (time.Duration, error) // time to wait for exhausted quota, error to skip the provider
+}
+
+// Limiter limits in-flight requests of providers. It is shared by concurrent runs, so implementations
+// must be safe for concurrent use.
+type Limiter interface {
+	// Acquire waits for a free request slot of the provider and returns the func releasing it,
+	// or an error if the context is done while waiting
+	Acquire(ctx context.Context, providerName string) (release func(), err error)
+}
+
+// Runner executes prompts across multiple providers in parallel. Once configured, it is safe for concurrent
+// use, as Execute and ExecuteFirst return results of each call instead of keeping them in the runner.
 type Runner struct {
 	providers []Provider
-	results   []provider.Result // stores the latest results
+	order     Order        // order of results, configured order if empty
+	hooks     []Hooks      // lifecycle callbacks, optional
+	quota     QuotaTracker // rate limits of providers, optional
+	limiter   Limiter      // in-flight request limits of providers, optional
+	required  []string     // names of providers which must succeed, optional
+	raw       bool         // keep raw API responses of providers in results
+
+	mu      sync.Mutex
+	results []provider.Result // results of the latest Run or RunFirst, for GetResults
+}
+
+// Results are results of a single run
+type Results struct {
+	Text    string            // text of the run, as returned by Run or RunFirst
+	Results []provider.Result // raw results of providers, in the requested order
 }
 
 // Provider defines the interface for LLM providers
@@ -38,10 +98,74 @@ func New(providers ...Provider) *Runner {
 	}
 }
 
-// Run sends a prompt to all enabled providers and returns combined results
+// WithOrder sets the order of results. Like other With* methods, it must be called before the runner is used.
+func (r *Runner) WithOrder(order Order) *Runner {
+	r.order = order
+	return r
+}
+
+// WithHooks adds lifecycle callbacks, hooks are called in the order they were added
+func (r *Runner) WithHooks(hooks ...Hooks) *Runner {
+	r.hooks = append(r.hooks, hooks...)
+	return r
+}
+
+// WithQuota sets the tracker of provider rate limits. Requests to providers with exhausted quota wait
+// for the quota to reset, or are skipped with an error result if the wait is too long.
+func (r *Runner) WithQuota(t QuotaTracker) *Runner {
+	r.quota = t
+	return r
+}
+
+// WithLimiter sets limits of in-flight provider requests. Requests over the limit of the provider wait
+// for a free slot, so runners sharing the limiter don't overload slow providers.
+func (r *Runner) WithLimiter(l Limiter) *Runner {
+	r.limiter = l
+	return r
+}
+
+// WithRequired sets names of providers which must succeed, matched case-insensitively. Execute fails if any
+// of them is not enabled or fails, while failures of the rest of providers are only logged as long as one
+// provider succeeds. ExecuteFirst doesn't check required providers, it uses a single response.
+func (r *Runner) WithRequired(names ...string) *Runner {
+	r.required = names
+	return r
+}
+
+// WithRawResponses sets keeping raw API responses of providers in results, for debugging of response fields
+// not reported otherwise
+func (r *Runner) WithRawResponses(enabled bool) *Runner {
+	r.raw = enabled
+	return r
+}
+
+// Execute sends a prompt to all enabled providers and returns combined text with results of all providers.
+// Results are returned on failure as well, with errors of failed providers.
+func (r *Runner) Execute(ctx context.Context, prompt string) (Results, error) {
+	res, err := r.runAll(ctx, prompt)
+	r.allDone(res.Results, err)
+	return res, err
+}
+
+// Run sends a prompt to all enabled providers and returns combined results.
+//
+// Deprecated: use Execute, Run keeps results in the runner for GetResults, so they are overwritten by
+// concurrent calls.
 func (r *Runner) Run(ctx context.Context, prompt string) (string, error) {
+	res, err := r.Execute(ctx, prompt)
+	r.setResults(res.Results)
+	return res.Text, err
+}
+
+// runAll sends a prompt to all enabled providers and waits for all of them
+func (r *Runner) runAll(ctx context.Context, prompt string) (Results, error) {
 	if len(r.providers) == 0 {
-		return "", fmt.Errorf("no enabled providers")
+		return Results{}, fmt.Errorf("no enabled providers")
+	}
+	for _, name := range r.required {
+		if !slices.ContainsFunc(r.providers, func(p Provider) bool { return strings.EqualFold(p.Name(), name) }) {
+			return Results{}, fmt.Errorf("required provider %s is not enabled", name)
+		}
 	}
 
 	var wg sync.WaitGroup
@@ -51,13 +175,7 @@ func (r *Runner) Run(ctx context.Context, prompt string) (string, error) {
 		wg.Add(1)
 		go func(p Provider) {
 			defer wg.Done()
-
-			text, err := p.Generate(ctx, prompt)
-			resultCh <- provider.Result{
-				Provider: p.Name(),
-				Text:     text,
-				Error:    err,
-			}
+			resultCh <- r.generate(ctx, p, prompt)
 		}(p)
 	}
 
@@ -78,66 +196,307 @@ func (r *Runner) Run(ctx context.Context, prompt string) (string, error) {
 	}
 
 	// rebuild results slice maintaining the original provider order from r.providers
-	r.results = make([]provider.Result, 0, len(r.providers))
+	results := make([]provider.Result, 0, len(r.providers))
 	for _, p := range r.providers {
 		if result, ok := resultMap[p.Name()]; ok {
-			r.results = append(r.results, result)
+			results = append(results, result)
 		}
 	}
+	r.sortResults(results)
+	res := Results{Results: results}
 
-	// check if all providers failed and collect all errors
+	// check if all providers failed
 	allFailed := true
-	var errorMessages []string
-	for _, result := range r.results {
+	for _, result := range results {
 		if result.Error == nil {
 			allFailed = false
-		} else {
-			errorMessages = append(errorMessages, fmt.Sprintf("%s: %v", result.Provider, result.Error))
+			break
 		}
 	}
 
 	// if all providers failed, return a detailed error message with all provider errors
 	if allFailed {
-		// with context already canceled or deadline exceeded, return a more user-friendly error
+		// with context already canceled or deadline exceeded, return a more user-friendly error, keeping errors
+		// of providers on timeout for callers reporting them
 		if ctx.Err() != nil {
 			switch {
 			case errors.Is(ctx.Err(), context.Canceled):
-				return "", fmt.Errorf("operation canceled by user")
+				return res, fmt.Errorf("operation canceled by user")
 			case errors.Is(ctx.Err(), context.DeadlineExceeded):
-				return "", fmt.Errorf("operation timed out, try increasing the timeout")
+				return res, fmt.Errorf("operation timed out: %w", allFailedError(results))
 			}
 		}
-		return "", fmt.Errorf("all providers failed: %s", strings.Join(errorMessages, "; "))
+		return res, allFailedError(results)
+	}
+	if err := r.requiredError(results); err != nil {
+		return res, err
 	}
 
 	// for single provider skip the header
-	if len(r.providers) == 1 && len(r.results) == 1 {
-		if r.results[0].Error != nil {
-			return "", fmt.Errorf("provider %s failed: %w", r.results[0].Provider, r.results[0].Error)
+	if len(r.providers) == 1 && len(results) == 1 {
+		if results[0].Error != nil {
+			return res, fmt.Errorf("provider %s failed: %w", results[0].Provider, results[0].Error)
 		}
-		return r.results[0].Text, nil
+		res.Text = results[0].Text
+		return res, nil
 	}
 
-	// for multiple providers include headers, but skip failed ones
-	resultParts := make([]string, 0, len(r.results))
-	for _, result := range r.results {
+	// for multiple providers include headers, but skip failed ones. Identical answers are shown once,
+	// with a header listing all providers returning it.
+	resultParts := make([]string, 0, len(results))
+	dups := provider.Duplicates(results)
+	for i, result := range results {
 		if result.Error != nil {
 			// log the error but don't include it in the output
 			lgr.Printf("[WARN] provider %s failed: %v", result.Provider, result.Error)
 			continue
 		}
+		if dups[i] >= 0 {
+			continue
+		}
+		names := []string{result.Provider}
+		for j := i + 1; j < len(results); j++ {
+			if dups[j] == i {
+				names = append(names, results[j].Provider)
+			}
+		}
+		if len(names) > 1 {
+			resultParts = append(resultParts, provider.FormatIdentical(names, result.Text))
+			continue
+		}
 		resultParts = append(resultParts, result.Format())
 	}
 
 	if len(resultParts) == 0 {
 		// if all providers were filtered out due to errors, return the error from the first one
-		return "", fmt.Errorf("all providers failed, see logs for details")
+		return res, fmt.Errorf("all providers failed, see logs for details")
 	}
 
-	return strings.Join(resultParts, "\n"), nil
+	res.Text = strings.Join(resultParts, "\n")
+	return res, nil
+}
+
+// ExecuteFirst sends a prompt to all enabled providers concurrently and returns the text of the first
+// successful response, canceling requests to the rest of providers. Results contain only the winning result.
+// If all providers fail, results are empty and the error contains errors of all providers.
+func (r *Runner) ExecuteFirst(ctx context.Context, prompt string) (Results, error) {
+	res, err := r.runFirst(ctx, prompt)
+	r.allDone(res.Results, err)
+	return res, err
+}
+
+// RunFirst sends a prompt to all enabled providers concurrently and returns the text of the first
+// successful response, see ExecuteFirst.
+//
+// Deprecated: use ExecuteFirst, RunFirst keeps results in the runner for GetResults, so they are overwritten
+// by concurrent calls.
+func (r *Runner) RunFirst(ctx context.Context, prompt string) (string, error) {
+	res, err := r.ExecuteFirst(ctx, prompt)
+	r.setResults(res.Results)
+	return res.Text, err
+}
+
+// runFirst sends a prompt to all enabled providers and waits for the first successful response
+func (r *Runner) runFirst(ctx context.Context, prompt string) (Results, error) {
+	if len(r.providers) == 0 {
+		return Results{}, fmt.Errorf("no enabled providers")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // cancel requests still in flight once the first response is received
+
+	resultCh := make(chan provider.Result, len(r.providers))
+	for _, p := range r.providers {
+		go func(p Provider) {
+			resultCh <- r.generate(ctx, p, prompt)
+		}(p)
+	}
+
+	failed := make([]provider.Result, 0, len(r.providers))
+	for range r.providers {
+		result := <-resultCh
+		if result.Error == nil {
+			lgr.Printf("[INFO] first successful response from %s", result.Provider)
+			return Results{Text: result.Text, Results: []provider.Result{result}}, nil
+		}
+		lgr.Printf("[WARN] provider %s failed: %v", result.Provider, result.Error)
+		failed = append(failed, result)
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		return Results{}, fmt.Errorf("operation canceled by user")
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return Results{}, fmt.Errorf("operation timed out: %w", allFailedError(failed))
+	}
+	return Results{}, allFailedError(failed)
+}
+
+// generate sends a prompt to a single provider and reports start and completion of the request to hooks
+func (r *Runner) generate(ctx context.Context, p Provider, prompt string) provider.Result {
+	if len(r.hooks) > 0 {
+		ctx = provider.WithProgress(ctx, func(received int64) {
+			for _, h := range r.hooks {
+				h.OnProgress(p.Name(), received)
+			}
+		})
+	}
+	var chunks []ChunkHooks
+	for _, h := range r.hooks {
+		if ch, ok := h.(ChunkHooks); ok {
+			chunks = append(chunks, ch)
+		}
+	}
+	if len(chunks) > 0 {
+		ctx = provider.WithChunks(ctx, func(text string) {
+			for _, h := range chunks {
+				h.OnChunk(p.Name(), text)
+			}
+		})
+	}
+	var rawMu sync.Mutex
+	var raw [][]byte
+	if r.raw {
+		ctx = provider.WithRawResponses(ctx, func(body []byte) {
+			rawMu.Lock()
+			defer rawMu.Unlock()
+			raw = append(raw, body)
+		})
+	}
+	var resp provider.Response
+	release, err := r.acquire(ctx, p.Name())
+	if err == nil {
+		defer release()
+		err = r.waitQuota(ctx, p.Name())
+	}
+	// the request starts once it's not queued by the limiter or quota, so the latency excludes waits
+	st := time.Now()
+	if err == nil {
+		for _, h := range r.hooks {
+			h.OnStart(p.Name())
+		}
+		if r.quota != nil {
+			ctx = provider.WithQuota(ctx, func(q provider.Quota) { r.quota.Update(p.Name(), q) })
+		}
+		resp, err = provider.GenerateResponse(ctx, p, prompt)
+	}
+	result := provider.Result{
+		Provider:  p.Name(),
+		Text:      resp.Text,
+		Error:     provider.NewError(p.Name(), err),
+		Reasoning: resp.Reasoning,
+		Truncated: resp.Truncated,
+		Latency:   time.Since(st),
+
+		Model:        resp.Model,
+		FinishReason: resp.FinishReason,
+		RequestID:    resp.RequestID,
+		Usage:        resp.Usage,
+
+		ValidationAttempts: resp.ValidationAttempts,
+		Attempts:           resp.Attempts,
+	}
+	rawMu.Lock()
+	result.Raw = raw
+	rawMu.Unlock()
+	for _, h := range r.hooks {
+		h.OnProviderDone(result)
+	}
+	return result
+}
+
+// acquire waits for a free request slot of the provider if the limiter is set
+func (r *Runner) acquire(ctx context.Context, name string) (release func(), err error) {
+	if r.limiter == nil {
+		return func() {}, nil
+	}
+	return r.limiter.Acquire(ctx, name)
+}
+
+// waitQuota waits for exhausted quota of the provider to reset. It returns an error if the provider
+// should be skipped, or if the context is done while waiting.
+func (r *Runner) waitQuota(ctx context.Context, name string) error {
+	if r.quota == nil {
+		return nil
+	}
+	wait, err := r.quota.Wait(name)
+	if err != nil {
+		lgr.Printf("[WARN] skipping %s: %v", name, err)
+		return &provider.Error{Provider: name, Code: "quota_exhausted", Message: "skipped", Retryable: true, Err: err}
+	}
+	if wait <= 0 {
+		return nil
+	}
+	lgr.Printf("[INFO] quota of %s exhausted, waiting %v", name, wait.Round(time.Millisecond))
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// allDone reports completion of the run to hooks
+func (r *Runner) allDone(results []provider.Result, err error) {
+	for _, h := range r.hooks {
+		h.OnAllDone(results, err)
+	}
+}
+
+// allFailedError creates an error listing errors of all failed results. Each provider error is wrapped,
+// so callers can get structured errors with provider.Errors or errors.As
+func allFailedError(results []provider.Result) error {
+	formats := make([]string, 0, len(results))
+	args := make([]any, 0, 2*len(results))
+	for _, result := range results {
+		if result.Error == nil {
+			continue
+		}
+		formats = append(formats, "%s: %w")
+		args = append(args, result.Provider, result.Error)
+	}
+	return fmt.Errorf("all providers failed: "+strings.Join(formats, "; "), args...)
+}
+
+// requiredError returns an error with errors of failed required providers, nil if all of them succeeded
+func (r *Runner) requiredError(results []provider.Result) error {
+	var errs []error
+	for _, result := range results {
+		if result.Error == nil {
+			continue
+		}
+		if slices.ContainsFunc(r.required, func(name string) bool { return strings.EqualFold(name, result.Provider) }) {
+			errs = append(errs, fmt.Errorf("required provider %s failed: %w", result.Provider, result.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sortResults sorts results according to the requested order, results are in configured order initially
+func (r *Runner) sortResults(results []provider.Result) {
+	switch r.order {
+	case OrderName:
+		sort.SliceStable(results, func(i, j int) bool {
+			return strings.ToLower(results[i].Provider) < strings.ToLower(results[j].Provider)
+		})
+	case OrderLatency:
+		sort.SliceStable(results, func(i, j int) bool { return results[i].Latency < results[j].Latency })
+	}
+}
+
+// setResults keeps results of the latest Run or RunFirst for GetResults
+func (r *Runner) setResults(results []provider.Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = results
 }
 
 // GetResults returns the raw results from the last Run
+//
+// Deprecated: use results returned by Execute or ExecuteFirst, GetResults returns results of whichever
+// call completed last.
 func (r *Runner) GetResults() []provider.Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	return r.results
 }
@@ -3,12 +3,19 @@ package runner
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/umputun/mpt/pkg/provider"
 	"github.com/umputun/mpt/pkg/runner/mocks"
 )
 
@@ -53,6 +60,56 @@ func TestRunner_Run(t *testing.T) {
 			"Error should contain one of the provider errors")
 		assert.Empty(t, result)
 	})
+	t.Run("all providers fail with structured errors", func(t *testing.T) {
+		rateLimited := &mocks.ProviderMock{
+			NameFunc:    func() string { return "OpenAI" },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				return "", &provider.Error{Status: 429, Code: "rate_limit_exceeded", Message: "rate limit", Retryable: true}
+			},
+		}
+		plain := &mocks.ProviderMock{
+			NameFunc:     func() string { return "Google" },
+			EnabledFunc:  func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return "", errors.New("invalid api key") },
+		}
+
+		runner := New(rateLimited, plain)
+		_, err := runner.Run(context.Background(), "test prompt")
+		require.EqualError(t, err, "all providers failed: OpenAI: rate limit; Google: invalid api key")
+
+		perrs := provider.Errors(err)
+		require.Len(t, perrs, 2)
+		assert.Equal(t, "OpenAI", perrs[0].Provider)
+		assert.Equal(t, 429, perrs[0].Status)
+		assert.True(t, perrs[0].Retryable)
+		assert.Equal(t, "Google", perrs[1].Provider)
+		assert.Equal(t, "invalid api key", perrs[1].Error())
+
+		for _, r := range runner.GetResults() {
+			var perr *provider.Error
+			require.ErrorAs(t, r.Error, &perr)
+			assert.Equal(t, r.Provider, perr.Provider)
+		}
+	})
+
+	t.Run("identical answers shown once", func(t *testing.T) {
+		answers := map[string]string{"OpenAI": "Paris.", "Anthropic": "Lyon", "Google": "Paris.  \n"}
+		var providers []Provider
+		for _, name := range []string{"OpenAI", "Anthropic", "Google"} {
+			providers = append(providers, &mocks.ProviderMock{
+				NameFunc:     func() string { return name },
+				GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return answers[name], nil },
+				EnabledFunc:  func() bool { return true },
+			})
+		}
+
+		res, err := New(providers...).Execute(context.Background(), "test prompt")
+		require.NoError(t, err)
+		assert.Equal(t, "== identical answer from OpenAI, Google ==\nParis.\n\n== generated by Anthropic ==\nLyon\n", res.Text)
+		assert.Len(t, res.Results, 3, "all results kept")
+	})
+
 	t.Run("all providers successful", func(t *testing.T) {
 		provider1 := &mocks.ProviderMock{
 			NameFunc: func() string {
@@ -310,4 +367,634 @@ func TestRunner_Run(t *testing.T) {
 		assert.Less(t, provider1Pos, provider2Pos, "Provider1 should appear before Provider2")
 		assert.Less(t, provider2Pos, provider3Pos, "Provider2 should appear before Provider3")
 	})
+	t.Run("response metadata reported in results", func(t *testing.T) {
+		truncated := &metaProvider{name: "Truncated",
+			resp: provider.Response{Text: "partial", Reasoning: "thoughts", Truncated: true, Model: "gpt-4o-2024-08-06",
+				FinishReason: "length", RequestID: "chatcmpl-123"}}
+		complete := &mocks.ProviderMock{
+			NameFunc:     func() string { return "Complete" },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return "full", nil },
+			EnabledFunc:  func() bool { return true },
+		}
+
+		runner := New(truncated, complete)
+		_, err := runner.Run(context.Background(), "test prompt")
+		require.NoError(t, err)
+
+		results := runner.GetResults()
+		require.Len(t, results, 2)
+		assert.Equal(t, "partial", results[0].Text)
+		assert.True(t, results[0].Truncated)
+		assert.Equal(t, "thoughts", results[0].Reasoning)
+		assert.Equal(t, "gpt-4o-2024-08-06", results[0].Model)
+		assert.Equal(t, "length", results[0].FinishReason)
+		assert.Equal(t, "chatcmpl-123", results[0].RequestID)
+		assert.Positive(t, results[0].Latency)
+		assert.Equal(t, "full", results[1].Text)
+		assert.False(t, results[1].Truncated)
+		assert.Empty(t, results[1].Reasoning)
+	})
+}
+
+// metaProvider returns a predefined response with metadata
+type metaProvider struct {
+	name string
+	resp provider.Response
+}
+
+func (p *metaProvider) Name() string  { return p.name }
+func (p *metaProvider) Enabled() bool { return true }
+func (p *metaProvider) Generate(context.Context, string) (string, error) {
+	return p.resp.Text, nil
+}
+
+func (p *metaProvider) GenerateResponse(context.Context, string) (provider.Response, error) {
+	return p.resp, nil
+}
+
+func TestRunner_Execute(t *testing.T) {
+	echo := func(name string) *mocks.ProviderMock {
+		return &mocks.ProviderMock{
+			NameFunc:    func() string { return name },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				if prompt == "fail" {
+					return "", errors.New("failed " + name)
+				}
+				time.Sleep(time.Millisecond)
+				return name + ": " + prompt, nil
+			},
+		}
+	}
+
+	t.Run("results of the call", func(t *testing.T) {
+		r := New(echo("p1"), echo("p2"))
+		res, err := r.Execute(context.Background(), "hi")
+		require.NoError(t, err)
+		require.Len(t, res.Results, 2)
+		assert.Equal(t, "p1: hi", res.Results[0].Text)
+		assert.Equal(t, "p2: hi", res.Results[1].Text)
+		assert.Contains(t, res.Text, "== generated by p1 ==\np1: hi")
+		assert.Empty(t, r.GetResults(), "results are not kept in the runner")
+	})
+
+	t.Run("results on failure", func(t *testing.T) {
+		res, err := New(echo("p1"), echo("p2")).Execute(context.Background(), "fail")
+		require.ErrorContains(t, err, "all providers failed")
+		require.Len(t, res.Results, 2)
+		assert.EqualError(t, res.Results[0].Error, "failed p1")
+		assert.Empty(t, res.Text)
+	})
+
+	t.Run("concurrent calls", func(t *testing.T) {
+		r := New(echo("p1"), echo("p2")).WithOrder(OrderName)
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				prompt := fmt.Sprintf("prompt %d", i)
+				res, err := r.Execute(context.Background(), prompt)
+				assert.NoError(t, err)
+				if assert.Len(t, res.Results, 2) {
+					assert.Equal(t, "p1: "+prompt, res.Results[0].Text)
+					assert.Equal(t, "p2: "+prompt, res.Results[1].Text)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("first", func(t *testing.T) {
+		res, err := New(echo("p1")).ExecuteFirst(context.Background(), "hi")
+		require.NoError(t, err)
+		assert.Equal(t, "p1: hi", res.Text)
+		require.Len(t, res.Results, 1)
+
+		res, err = New(echo("p1")).ExecuteFirst(context.Background(), "fail")
+		require.EqualError(t, err, "all providers failed: p1: failed p1")
+		assert.Empty(t, res.Results)
+	})
+}
+
+func TestRunner_RunFirst(t *testing.T) {
+	t.Run("first successful response returned and others canceled", func(t *testing.T) {
+		slowCanceled := make(chan struct{})
+		fast := &mocks.ProviderMock{
+			NameFunc:     func() string { return "Fast" },
+			EnabledFunc:  func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return "fast answer", nil },
+		}
+		slow := &mocks.ProviderMock{
+			NameFunc:    func() string { return "Slow" },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				<-ctx.Done()
+				close(slowCanceled)
+				return "", ctx.Err()
+			},
+		}
+
+		runner := New(slow, fast)
+		result, err := runner.RunFirst(context.Background(), "test prompt")
+		require.NoError(t, err)
+		assert.Equal(t, "fast answer", result)
+		require.Len(t, runner.GetResults(), 1)
+		assert.Equal(t, "Fast", runner.GetResults()[0].Provider)
+		<-slowCanceled // blocks forever (test timeout) if the slow provider is not canceled
+	})
+
+	t.Run("failed providers skipped", func(t *testing.T) {
+		failing := &mocks.ProviderMock{
+			NameFunc:     func() string { return "Failing" },
+			EnabledFunc:  func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return "", errors.New("api error") },
+		}
+		working := &mocks.ProviderMock{
+			NameFunc:    func() string { return "Working" },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				time.Sleep(10 * time.Millisecond) // let the failing provider finish first
+				return "answer", nil
+			},
+		}
+
+		result, err := New(failing, working).RunFirst(context.Background(), "test prompt")
+		require.NoError(t, err)
+		assert.Equal(t, "answer", result)
+	})
+
+	t.Run("all providers fail", func(t *testing.T) {
+		failing := &mocks.ProviderMock{
+			NameFunc:     func() string { return "Failing" },
+			EnabledFunc:  func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return "", errors.New("api error") },
+		}
+
+		runner := New(failing)
+		_, err := runner.RunFirst(context.Background(), "test prompt")
+		require.EqualError(t, err, "all providers failed: Failing: api error")
+		assert.Empty(t, runner.GetResults())
+	})
+
+	t.Run("timed out with provider errors", func(t *testing.T) {
+		slow := &mocks.ProviderMock{
+			NameFunc:    func() string { return "Slow" },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				<-ctx.Done()
+				return "", ctx.Err()
+			},
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := New(slow).RunFirst(ctx, "test prompt")
+		require.ErrorContains(t, err, "operation timed out: all providers failed")
+		errs := provider.Errors(err)
+		require.Len(t, errs, 1)
+		assert.Equal(t, "Slow", errs[0].Provider)
+	})
+
+	t.Run("no enabled providers", func(t *testing.T) {
+		_, err := New().RunFirst(context.Background(), "test prompt")
+		require.EqualError(t, err, "no enabled providers")
+	})
+}
+
+func TestRunner_WithHooks(t *testing.T) {
+	newProvider := func(name string, err error) *mocks.ProviderMock {
+		return &mocks.ProviderMock{
+			NameFunc:    func() string { return name },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				if err != nil {
+					return "", err
+				}
+				time.Sleep(10 * time.Millisecond)
+				return "response from " + name, nil
+			},
+		}
+	}
+
+	t.Run("run", func(t *testing.T) {
+		hooks := &recordingHooks{}
+		_, err := New(newProvider("OpenAI", nil), newProvider("Google", errors.New("rate limit"))).
+			WithHooks(hooks).Run(context.Background(), "test prompt")
+		require.NoError(t, err)
+
+		assert.ElementsMatch(t, []string{"OpenAI", "Google"}, hooks.started)
+		require.Len(t, hooks.done, 2)
+		byName := map[string]provider.Result{hooks.done[0].Provider: hooks.done[0], hooks.done[1].Provider: hooks.done[1]}
+		require.NoError(t, byName["OpenAI"].Error)
+		assert.GreaterOrEqual(t, byName["OpenAI"].Latency, 10*time.Millisecond)
+		require.EqualError(t, byName["Google"].Error, "rate limit")
+
+		assert.Equal(t, 1, hooks.allDoneCalls)
+		require.NoError(t, hooks.allDoneErr)
+		require.Len(t, hooks.allDone, 2)
+		assert.Equal(t, "OpenAI", hooks.allDone[0].Provider, "results passed in the final order")
+	})
+
+	t.Run("run first with all failed", func(t *testing.T) {
+		hooks := &recordingHooks{}
+		_, err := New(newProvider("OpenAI", errors.New("api error"))).WithHooks(hooks).
+			RunFirst(context.Background(), "test prompt")
+		require.Error(t, err)
+		assert.Equal(t, []string{"OpenAI"}, hooks.started)
+		assert.Equal(t, 1, hooks.allDoneCalls)
+		assert.Empty(t, hooks.allDone)
+		require.EqualError(t, hooks.allDoneErr, err.Error())
+	})
+
+	t.Run("progress of provider response", func(t *testing.T) {
+		body := `{"id":"1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant",` +
+			`"content":"streamed response"},"finish_reason":"stop"}]}`
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(body))
+		}))
+		defer ts.Close()
+
+		p := provider.NewCustomOpenAI(provider.CustomOptions{Name: "Local", BaseURL: ts.URL + "/v1", APIKey: "key",
+			Model: "local-model", Enabled: true})
+		hooks := &recordingHooks{}
+		res, err := New(p).WithHooks(hooks).Run(context.Background(), "test prompt")
+		require.NoError(t, err)
+		assert.Equal(t, "streamed response", res)
+		assert.Equal(t, map[string]int64{"Local": int64(len(body))}, hooks.progress)
+	})
+
+	t.Run("chunks of streamed response", func(t *testing.T) {
+		streamed := make(chan bool, 2)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := io.ReadAll(r.Body)
+			stream := strings.Contains(string(data), `"stream":true`)
+			streamed <- stream
+			if !stream {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"whole response"},"finish_reason":"stop"}]}`))
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, text := range []string{"streamed", " response"} {
+				_, _ = fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", text)
+			}
+			_, _ = w.Write([]byte("data: [DONE]\n\n"))
+		}))
+		defer ts.Close()
+		p := provider.NewCustomOpenAI(provider.CustomOptions{Name: "Local", BaseURL: ts.URL + "/v1", Model: "m", Enabled: true})
+
+		hooks := &chunkHooks{}
+		res, err := New(p).WithHooks(hooks).Run(context.Background(), "test prompt")
+		require.NoError(t, err)
+		assert.True(t, <-streamed, "streamed with chunk hooks")
+		assert.Equal(t, "streamed response", res)
+		assert.Equal(t, []string{"", "streamed", " response"}, hooks.chunks["Local"])
+
+		res, err = New(p).WithHooks(&recordingHooks{}).Run(context.Background(), "test prompt")
+		require.NoError(t, err)
+		assert.False(t, <-streamed, "not streamed without chunk hooks")
+		assert.Equal(t, "whole response", res)
+	})
+
+	t.Run("multiple hooks", func(t *testing.T) {
+		h1, h2 := &recordingHooks{}, &recordingHooks{}
+		_, err := New(newProvider("OpenAI", nil)).WithHooks(h1).WithHooks(h2).Run(context.Background(), "test prompt")
+		require.NoError(t, err)
+		assert.Equal(t, 1, h1.allDoneCalls)
+		assert.Equal(t, 1, h2.allDoneCalls)
+	})
+}
+
+func TestRunner_WithQuota(t *testing.T) {
+	newProvider := func(name string, calls *int) *mocks.ProviderMock {
+		return &mocks.ProviderMock{
+			NameFunc:    func() string { return name },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				*calls++
+				return "text from " + name, nil
+			},
+		}
+	}
+
+	t.Run("exhausted providers delayed or skipped", func(t *testing.T) {
+		var delayedCalls, skippedCalls int
+		tracker := &fakeQuota{waits: map[string]time.Duration{"Delayed": 30 * time.Millisecond},
+			errs: map[string]error{"Skipped": errors.New("quota exhausted until 13:00")}}
+		r := New(newProvider("Delayed", &delayedCalls), newProvider("Skipped", &skippedCalls)).WithQuota(tracker)
+
+		st := time.Now()
+		res, err := r.Run(context.Background(), "test prompt")
+		require.NoError(t, err)
+		assert.Equal(t, "== generated by Delayed ==\ntext from Delayed\n", res)
+		assert.GreaterOrEqual(t, time.Since(st), 30*time.Millisecond)
+		assert.Equal(t, 1, delayedCalls)
+		assert.Equal(t, 0, skippedCalls, "skipped provider not called")
+
+		results := r.GetResults()
+		require.Len(t, results, 2)
+		var perr *provider.Error
+		require.ErrorAs(t, results[1].Error, &perr)
+		assert.Equal(t, "quota_exhausted", perr.Code)
+		assert.Equal(t, "Skipped", perr.Provider)
+		assert.EqualError(t, results[1].Error, "skipped: quota exhausted until 13:00")
+	})
+
+	t.Run("wait canceled", func(t *testing.T) {
+		var calls int
+		tracker := &fakeQuota{waits: map[string]time.Duration{"OpenAI": time.Hour}}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := New(newProvider("OpenAI", &calls)).WithQuota(tracker).Run(ctx, "test prompt")
+		require.Error(t, err)
+		assert.Equal(t, 0, calls)
+	})
+
+	t.Run("quota reported by provider", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("x-ratelimit-remaining-requests", "7")
+			_, _ = w.Write([]byte(`{"id":"1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant",` +
+				`"content":"answer"},"finish_reason":"stop"}]}`))
+		}))
+		defer ts.Close()
+
+		p := provider.NewCustomOpenAI(provider.CustomOptions{Name: "Local", BaseURL: ts.URL + "/v1", APIKey: "key",
+			Model: "local-model", Enabled: true})
+		tracker := &fakeQuota{}
+		_, err := New(p).WithQuota(tracker).Run(context.Background(), "test prompt")
+		require.NoError(t, err)
+		require.Contains(t, tracker.updates, "Local")
+		assert.Equal(t, 7, tracker.updates["Local"].RemainingRequests)
+	})
+}
+
+func TestRunner_WithLimiter(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := map[string]int{}, map[string]int{}
+	newProvider := func(name string) *mocks.ProviderMock {
+		return &mocks.ProviderMock{
+			NameFunc:    func() string { return name },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				mu.Lock()
+				inFlight[name]++
+				maxInFlight[name] = max(maxInFlight[name], inFlight[name])
+				mu.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				mu.Lock()
+				inFlight[name]--
+				mu.Unlock()
+				return "text from " + name, nil
+			},
+		}
+	}
+
+	limiter := NewProviderLimiter(map[string]int{"local": 2})
+	local, cloud := newProvider("Local"), newProvider("Cloud")
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := New(local, cloud).WithLimiter(limiter).Run(context.Background(), "test prompt")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, local.GenerateCalls(), 6)
+	assert.Len(t, cloud.GenerateCalls(), 6)
+	assert.Equal(t, 2, maxInFlight["Local"], "limited provider runs up to 2 requests at once")
+	assert.Greater(t, maxInFlight["Cloud"], 2, "unlimited provider runs all requests at once")
+}
+
+func TestRunner_WithLimiter_StartAfterWait(t *testing.T) {
+	limiter := NewProviderLimiter(map[string]int{"local": 1})
+	release, err := limiter.Acquire(context.Background(), "Local")
+	require.NoError(t, err)
+
+	local := &mocks.ProviderMock{
+		NameFunc:     func() string { return "Local" },
+		EnabledFunc:  func() bool { return true },
+		GenerateFunc: func(ctx context.Context, prompt string) (string, error) { return "text", nil },
+	}
+	hooks := &recordingHooks{}
+	done := make(chan Results)
+	go func() {
+		res, err := New(local).WithLimiter(limiter).WithHooks(hooks).Execute(context.Background(), "test prompt")
+		assert.NoError(t, err)
+		done <- res
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	hooks.mu.Lock()
+	assert.Empty(t, hooks.started, "not started while queued by the limiter")
+	hooks.mu.Unlock()
+	release()
+
+	res := <-done
+	assert.Equal(t, []string{"Local"}, hooks.started)
+	require.Len(t, res.Results, 1)
+	assert.Less(t, res.Results[0].Latency, 50*time.Millisecond, "latency excludes the wait")
+
+	t.Run("skipped by quota not started", func(t *testing.T) {
+		hooks := &recordingHooks{}
+		quota := &fakeQuota{errs: map[string]error{"Local": errors.New("quota exhausted")}}
+		_, err := New(local).WithQuota(quota).WithHooks(hooks).Execute(context.Background(), "test prompt")
+		require.Error(t, err)
+		assert.Empty(t, hooks.started)
+		require.Len(t, hooks.done, 1, "done reported")
+	})
+}
+
+// fakeQuota is a QuotaTracker with preset waits and errors, recording updates
+type fakeQuota struct {
+	mu      sync.Mutex
+	waits   map[string]time.Duration
+	errs    map[string]error
+	updates map[string]provider.Quota
+}
+
+func (f *fakeQuota) Update(name string, q provider.Quota) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.updates == nil {
+		f.updates = map[string]provider.Quota{}
+	}
+	f.updates[name] = q
+}
+
+func (f *fakeQuota) Wait(name string) (time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.waits[name], f.errs[name]
+}
+
+// recordingHooks records calls of runner hooks
+type recordingHooks struct {
+	mu           sync.Mutex
+	started      []string
+	done         []provider.Result
+	allDone      []provider.Result
+	allDoneErr   error
+	allDoneCalls int
+	progress     map[string]int64
+}
+
+func (h *recordingHooks) OnStart(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.started = append(h.started, name)
+}
+
+func (h *recordingHooks) OnProgress(name string, received int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.progress == nil {
+		h.progress = map[string]int64{}
+	}
+	h.progress[name] = received
+}
+
+func (h *recordingHooks) OnProviderDone(result provider.Result) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.done = append(h.done, result)
+}
+
+func (h *recordingHooks) OnAllDone(results []provider.Result, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.allDone, h.allDoneErr = results, err
+	h.allDoneCalls++
+}
+
+// chunkHooks records chunks of streamed responses in addition to calls of runner hooks
+type chunkHooks struct {
+	recordingHooks
+	chunks map[string][]string
+}
+
+func (h *chunkHooks) OnChunk(name, text string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.chunks == nil {
+		h.chunks = map[string][]string{}
+	}
+	h.chunks[name] = append(h.chunks[name], text)
+}
+
+func TestRunner_WithRequired(t *testing.T) {
+	newProvider := func(name string, fail bool) *mocks.ProviderMock {
+		return &mocks.ProviderMock{
+			NameFunc:    func() string { return name },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				if fail {
+					return "", provider.NewError(name, errors.New("server error"))
+				}
+				return "text from " + name, nil
+			},
+		}
+	}
+
+	t.Run("optional provider failed", func(t *testing.T) {
+		res, err := New(newProvider("OpenAI", false), newProvider("Google", true)).WithRequired("openai").
+			Execute(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, "text from OpenAI", res.Results[0].Text)
+		require.Error(t, res.Results[1].Error)
+	})
+
+	t.Run("required providers failed", func(t *testing.T) {
+		res, err := New(newProvider("OpenAI", true), newProvider("Google", false), newProvider("Custom", true)).
+			WithRequired("openai", "custom").Execute(context.Background(), "test")
+		require.EqualError(t, err, "required provider OpenAI failed: server error\nrequired provider Custom failed: server error")
+		require.Len(t, res.Results, 3, "results are returned with the error")
+		errs := provider.Errors(err)
+		require.Len(t, errs, 2)
+		assert.Equal(t, "OpenAI", errs[0].Provider)
+		assert.Equal(t, "Custom", errs[1].Provider)
+	})
+
+	t.Run("required provider not enabled", func(t *testing.T) {
+		p := newProvider("Google", false)
+		_, err := New(p).WithRequired("OpenAI").Execute(context.Background(), "test")
+		require.EqualError(t, err, "required provider OpenAI is not enabled")
+		assert.Empty(t, p.GenerateCalls(), "no requests sent")
+	})
+
+	t.Run("first mode ignores required", func(t *testing.T) {
+		res, err := New(newProvider("OpenAI", true), newProvider("Google", false)).WithRequired("OpenAI").
+			ExecuteFirst(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, "text from Google", res.Text)
+	})
+}
+
+func TestRunner_WithRawResponses(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant",` +
+			`"content":"answer"},"finish_reason":"stop"}]}`))
+	}))
+	defer ts.Close()
+	p := provider.NewCustomOpenAI(provider.CustomOptions{Name: "Local", BaseURL: ts.URL + "/v1", APIKey: "key",
+		Model: "local-model", Enabled: true})
+
+	r := New(p).WithRawResponses(true)
+	_, err := r.Run(context.Background(), "test prompt")
+	require.NoError(t, err)
+	results := r.GetResults()
+	require.Len(t, results, 1)
+	require.Len(t, results[0].Raw, 1)
+	assert.Contains(t, string(results[0].Raw[0]), `"content":"answer"`)
+
+	r = New(p)
+	_, err = r.Run(context.Background(), "test prompt")
+	require.NoError(t, err)
+	assert.Nil(t, r.GetResults()[0].Raw, "raw responses not kept by default")
+}
+
+func TestRunner_WithOrder(t *testing.T) {
+	newProvider := func(name string, delay time.Duration) *mocks.ProviderMock {
+		return &mocks.ProviderMock{
+			NameFunc:    func() string { return name },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				time.Sleep(delay)
+				return "text from " + name, nil
+			},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		order Order
+		want  []string
+	}{
+		{name: "default order", order: "", want: []string{"Charlie", "alpha", "Bravo"}},
+		{name: "configured order", order: OrderConfigured, want: []string{"Charlie", "alpha", "Bravo"}},
+		{name: "by name", order: OrderName, want: []string{"alpha", "Bravo", "Charlie"}},
+		{name: "by latency", order: OrderLatency, want: []string{"Bravo", "Charlie", "alpha"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := New(newProvider("Charlie", 20*time.Millisecond), newProvider("alpha", 60*time.Millisecond),
+				newProvider("Bravo", 0)).WithOrder(tt.order)
+			result, err := runner.Run(context.Background(), "test prompt")
+			require.NoError(t, err)
+
+			names := make([]string, 0, len(runner.GetResults()))
+			for _, r := range runner.GetResults() {
+				names = append(names, r.Provider)
+				assert.Positive(t, r.Latency)
+			}
+			assert.Equal(t, tt.want, names)
+			assert.Less(t, strings.Index(result, "== generated by "+tt.want[0]), strings.Index(result, "== generated by "+tt.want[1]))
+		})
+	}
 }
@@ -0,0 +1,21 @@
+package secrets
+
+import (
+	"errors"
+	"strings"
+)
+
+// awsSecret reads the string value of the secret from AWS Secrets Manager with aws CLI, so the usual
+// credential chain applies, including environment, profiles, SSO and instance roles.
+func (r *Resolver) awsSecret(name string) (string, error) {
+	out, err := r.run("aws", "secretsmanager", "get-secret-value", "--secret-id", name,
+		"--query", "SecretString", "--output", "text")
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimRight(out, "\r\n")
+	if secret == "" || secret == "None" { // binary secrets have no string value
+		return "", errors.New("secret has no string value")
+	}
+	return secret, nil
+}
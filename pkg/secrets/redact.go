@@ -0,0 +1,44 @@
+package secrets
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Mask replaces redacted secrets, the same as lgr uses for masked secrets in logs
+const Mask = "******"
+
+// secretPatterns match well-known credentials: API keys of LLM and cloud vendors, tokens of GitHub and Slack,
+// JWTs and private keys in PEM format
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{16,}`),                                         // OpenAI, Anthropic, DeepSeek and compatible
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),                                       // Google
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),                                   // AWS access key ID
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),                                  // GitHub
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`),                                // GitHub fine-grained
+	regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`),                                 // Slack
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`), // JWT
+	regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`),
+}
+
+// assignmentPattern matches values assigned to keys named like credentials, e.g. "password: x" or
+// "API_KEY=x", and bearer tokens of authorization headers. The value is the last group.
+var assignmentPattern = regexp.MustCompile(`(?i)((?:api[_-]?key|secret|token|passw(?:or)?d|credentials?)["']?\s*[:=]\s*["']?` +
+	`|authorization:\s*(?:bearer|basic)\s+|\bbearer\s+)([^\s"',;]{8,})`)
+
+// Redact returns the text with known secrets and values looking like credentials replaced with Mask.
+// Known secrets are exact values, like API keys in use, masked wherever they appear.
+func Redact(text string, known ...string) string {
+	for _, secret := range known {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, Mask)
+		}
+	}
+	for _, re := range secretPatterns {
+		text = re.ReplaceAllString(text, Mask)
+	}
+	return assignmentPattern.ReplaceAllStringFunc(text, func(match string) string {
+		groups := assignmentPattern.FindStringSubmatch(match)
+		return groups[1] + Mask
+	})
+}
@@ -0,0 +1,176 @@
+// Package secrets resolves references to API keys kept in secret stores: "keyring:<name>" for the OS keyring,
+// "vault:<path>#<field>" for HashiCorp Vault and "aws-sm:<name>#<field>" for AWS Secrets Manager.
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/umputun/mpt/pkg/keyring"
+)
+
+// supported reference schemes
+const (
+	schemeKeyring = keyring.Prefix
+	schemeVault   = "vault:"
+	schemeAWS     = "aws-sm:"
+)
+
+// CacheTTL is how long fetched secrets are reused, so fields of the same secret are fetched once
+const CacheTTL = time.Minute
+
+// requestTimeout bounds a single request to the secret store
+const requestTimeout = 30 * time.Second
+
+// IsReference checks if the value references a secret store
+func IsReference(value string) bool {
+	for _, scheme := range []string{schemeKeyring, schemeVault, schemeAWS} {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolver resolves secret references, caching fetched secrets for CacheTTL
+type Resolver struct {
+	client  *http.Client
+	getenv  func(string) string
+	keyring func(name string) (string, error)
+	run     func(name string, args ...string) (string, error)
+	now     func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cached // fetched secrets by scheme and path
+}
+
+type cached struct {
+	value   string
+	fetched time.Time
+}
+
+// NewResolver makes a resolver with Vault settings from VAULT_* environment variables
+func NewResolver() *Resolver {
+	return &Resolver{
+		client:  &http.Client{Timeout: requestTimeout},
+		getenv:  os.Getenv,
+		keyring: keyring.Get,
+		run:     runCommand,
+		now:     time.Now,
+		cache:   map[string]cached{},
+	}
+}
+
+// Resolve returns the secret for the reference. Values which are not references are returned as is.
+func (r *Resolver) Resolve(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, schemeKeyring):
+		return r.keyring(strings.TrimPrefix(value, schemeKeyring))
+	case strings.HasPrefix(value, schemeVault):
+		path, field := splitField(strings.TrimPrefix(value, schemeVault))
+		fields, err := r.fetch(schemeVault+path, func() (string, error) { return r.vaultSecret(path) })
+		if err != nil {
+			return "", fmt.Errorf("failed to get vault secret %s: %w", path, err)
+		}
+		res, err := pickField(fields, field)
+		if err != nil {
+			return "", fmt.Errorf("vault secret %s: %w", path, err)
+		}
+		return res, nil
+	case strings.HasPrefix(value, schemeAWS):
+		name, field := splitField(strings.TrimPrefix(value, schemeAWS))
+		secret, err := r.fetch(schemeAWS+name, func() (string, error) { return r.awsSecret(name) })
+		if err != nil {
+			return "", fmt.Errorf("failed to get aws secret %s: %w", name, err)
+		}
+		if field == "" {
+			return secret, nil
+		}
+		res, err := pickField(secret, field)
+		if err != nil {
+			return "", fmt.Errorf("aws secret %s: %w", name, err)
+		}
+		return res, nil
+	}
+	return value, nil
+}
+
+// fetch returns the cached secret for the key or gets it with fn
+func (r *Resolver) fetch(key string, fn func() (string, error)) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.cache[key]; ok && r.now().Sub(c.fetched) < CacheTTL {
+		return c.value, nil
+	}
+	value, err := fn()
+	if err != nil {
+		return "", err
+	}
+	r.cache[key] = cached{value: value, fetched: r.now()}
+	return value, nil
+}
+
+// splitField splits "path#field" reference
+func splitField(ref string) (path, field string) {
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// pickField returns the field of the secret with JSON object value. Without the field, the only field
+// of the object is returned.
+func pickField(secret, field string) (string, error) {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, can't get field %s", field)
+	}
+	if field == "" {
+		if len(fields) != 1 {
+			names := make([]string, 0, len(fields))
+			for k := range fields {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+			return "", fmt.Errorf("field is required, secret has fields: %s", strings.Join(names, ", "))
+		}
+		for k := range fields {
+			field = k
+		}
+	}
+	v, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("field %s not found", field)
+	}
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return "", fmt.Errorf("field %s is not a string or empty", field)
+	}
+	return s, nil
+}
+
+// runCommand runs the command and returns its output, stderr is added to the error
+func runCommand(name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...) //nolint:gosec // fixed secret store tools
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", fmt.Errorf("%s not found, it is required to access the secret store: %w", name, err)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,155 @@
+package secrets
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsReference(t *testing.T) {
+	assert.True(t, IsReference("keyring:openai"))
+	assert.True(t, IsReference("vault:secret/data/mpt#openai"))
+	assert.True(t, IsReference("aws-sm:prod/mpt"))
+	assert.False(t, IsReference("sk-123"))
+	assert.False(t, IsReference(""))
+}
+
+func TestResolver_Vault(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("X-Vault-Token") != "tkn" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		assert.Equal(t, "team", r.Header.Get("X-Vault-Namespace"))
+		switch r.URL.Path {
+		case "/v1/secret/data/mpt": // kv v2
+			_, _ = w.Write([]byte(`{"data":{"data":{"openai":"sk-o","anthropic":"sk-a"},"metadata":{"version":3}}}`))
+		case "/v1/kv/single": // kv v1
+			_, _ = w.Write([]byte(`{"data":{"key":"sk-single"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer ts.Close()
+
+	env := map[string]string{"VAULT_ADDR": ts.URL + "/", "VAULT_TOKEN": "tkn", "VAULT_NAMESPACE": "team"}
+	r := NewResolver()
+	r.getenv = func(k string) string { return env[k] }
+
+	got, err := r.Resolve("vault:secret/data/mpt#openai")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-o", got)
+	got, err = r.Resolve("vault:secret/data/mpt#anthropic")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-a", got)
+	assert.Equal(t, 1, requests, "secret fetched once")
+
+	got, err = r.Resolve("vault:kv/single")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-single", got, "the only field used without field name")
+
+	_, err = r.Resolve("vault:secret/data/mpt")
+	require.EqualError(t, err, "vault secret secret/data/mpt: field is required, secret has fields: anthropic, openai")
+	_, err = r.Resolve("vault:secret/data/mpt#google")
+	require.EqualError(t, err, "vault secret secret/data/mpt: field google not found")
+	_, err = r.Resolve("vault:secret/data/missing#key")
+	require.EqualError(t, err, "failed to get vault secret secret/data/missing: vault returned 404 Not Found")
+
+	env["VAULT_TOKEN"] = "bad"
+	_, err = r.Resolve("vault:kv/other#key")
+	require.EqualError(t, err, "failed to get vault secret kv/other: vault returned 403 Forbidden: permission denied")
+
+	env["VAULT_ADDR"] = ""
+	_, err = r.Resolve("vault:kv/other#key")
+	require.EqualError(t, err, "failed to get vault secret kv/other: VAULT_ADDR is not set")
+}
+
+func TestResolver_AWS(t *testing.T) {
+	var calls []string
+	outputs := map[string]string{"prod/mpt": `{"openai":"sk-o","n":1}` + "\n", "plain": "sk-plain\n", "binary": "None\n"}
+	r := NewResolver()
+	r.run = func(name string, args ...string) (string, error) {
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		out, ok := outputs[args[3]]
+		if !ok {
+			return "", errors.New("aws: exit status 254: ResourceNotFoundException")
+		}
+		return out, nil
+	}
+
+	got, err := r.Resolve("aws-sm:plain")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-plain", got)
+	assert.Equal(t, []string{"aws secretsmanager get-secret-value --secret-id plain --query SecretString --output text"}, calls)
+
+	got, err = r.Resolve("aws-sm:prod/mpt#openai")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-o", got)
+
+	_, err = r.Resolve("aws-sm:prod/mpt#n")
+	require.EqualError(t, err, "aws secret prod/mpt: field n is not a string or empty")
+	_, err = r.Resolve("aws-sm:plain#key")
+	require.EqualError(t, err, "aws secret plain: secret is not a JSON object, can't get field key")
+	_, err = r.Resolve("aws-sm:binary")
+	require.EqualError(t, err, "failed to get aws secret binary: secret has no string value")
+	_, err = r.Resolve("aws-sm:missing")
+	require.EqualError(t, err, "failed to get aws secret missing: aws: exit status 254: ResourceNotFoundException")
+	assert.Len(t, calls, 4, "prod/mpt fetched once")
+}
+
+func TestResolver_Cache(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	calls := 0
+	r := NewResolver()
+	r.now = func() time.Time { return now }
+	r.run = func(string, ...string) (string, error) {
+		calls++
+		return "sk-1", nil
+	}
+
+	for range 3 {
+		_, err := r.Resolve("aws-sm:key")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, calls)
+
+	now = now.Add(CacheTTL)
+	_, err := r.Resolve("aws-sm:key")
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls, "fetched again after ttl")
+}
+
+func TestResolver_KeyringAndPlain(t *testing.T) {
+	r := NewResolver()
+	r.keyring = func(name string) (string, error) { return "kr-" + name, nil }
+
+	got, err := r.Resolve("keyring:openai")
+	require.NoError(t, err)
+	assert.Equal(t, "kr-openai", got)
+
+	got, err = r.Resolve("sk-plain")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-plain", got)
+}
+
+func TestRunCommand(t *testing.T) {
+	out, err := runCommand("echo", "hello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", out)
+
+	_, err = runCommand("sh", "-c", "echo denied >&2; exit 2")
+	require.EqualError(t, err, "sh: exit status 2: denied")
+
+	_, err = runCommand("mpt-no-such-tool")
+	require.ErrorContains(t, err, "mpt-no-such-tool not found, it is required to access the secret store")
+}
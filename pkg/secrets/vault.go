@@ -0,0 +1,84 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxVaultResponse limits the size of Vault response
+const maxVaultResponse = 1 << 20
+
+// vaultSecret reads the secret from Vault at the API path, like "secret/data/mpt" for KV v2 engine, and returns
+// its fields as JSON object. The address, token and namespace are set with VAULT_ADDR, VAULT_TOKEN and
+// VAULT_NAMESPACE, same as for vault CLI. The token is read from ~/.vault-token if not set.
+func (r *Resolver) vaultSecret(path string) (string, error) {
+	addr := strings.TrimSuffix(r.getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+	token := r.getenv("VAULT_TOKEN")
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil { //nolint:gosec // vault token file
+				token = strings.TrimSpace(string(data))
+			}
+		}
+	}
+	if token == "" {
+		return "", errors.New("VAULT_TOKEN is not set")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, addr+"/v1/"+strings.TrimPrefix(path, "/"), http.NoBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to make request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := r.getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxVaultResponse))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var res struct {
+		Data   map[string]any `json:"data"`
+		Errors []string       `json:"errors"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		if json.Unmarshal(body, &res) == nil && len(res.Errors) > 0 {
+			return "", fmt.Errorf("vault returned %s: %s", resp.Status, strings.Join(res.Errors, "; "))
+		}
+		return "", fmt.Errorf("vault returned %s", resp.Status)
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// KV v2 engine wraps secret fields with metadata
+	fields := res.Data
+	if inner, ok := res.Data["data"].(map[string]any); ok {
+		if _, hasMeta := res.Data["metadata"]; hasMeta {
+			fields = inner
+		}
+	}
+	if len(fields) == 0 {
+		return "", errors.New("secret has no fields")
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode secret fields: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/auth"
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+// call makes the request with the API key and returns the response code and headers, decoding the body into res if set
+func call(t *testing.T, ts *httptest.Server, method, path, key, body string, res any) (int, http.Header) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if res == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, resp.Header
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(res))
+	return resp.StatusCode, resp.Header
+}
+
+func TestServer_Auth(t *testing.T) {
+	authenticator, err := auth.New([]auth.Client{
+		{Name: "backend", Key: "key-backend", Providers: []string{"openai"}, RateLimit: 2},
+		{Name: "docs", Key: "key-docs"},
+	})
+	require.NoError(t, err)
+	providers := []provider.Provider{
+		newProvider("OpenAI", "answer from openai", nil),
+		newProvider("Google", "answer from google", nil),
+	}
+	srv := New(Options{Providers: providers, JobRetention: time.Hour, Auth: authenticator})
+	ts := httptest.NewServer(srv.routes(context.Background()))
+	defer ts.Close()
+
+	t.Run("unauthorized", func(t *testing.T) {
+		for _, key := range []string{"", "wrong"} {
+			var res map[string]string
+			code, hdr := call(t, ts, http.MethodPost, "/v1/jobs", key, `{"prompt":"q"}`, &res)
+			assert.Equal(t, http.StatusUnauthorized, code)
+			assert.Equal(t, "Bearer", hdr.Get("WWW-Authenticate"))
+			assert.Equal(t, "invalid or missing API key", res["error"])
+		}
+
+		resp, err := http.Get(ts.URL + "/ping")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "ping is not authenticated")
+	})
+
+	t.Run("api key header", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/providers", http.NoBody)
+		require.NoError(t, err)
+		req.Header.Set("X-API-Key", "key-docs")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var res ProvidersResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.Equal(t, []string{"OpenAI", "Google"}, res.Providers)
+	})
+
+	t.Run("provider allowlist", func(t *testing.T) {
+		var providersRes ProvidersResponse
+		code, _ := call(t, ts, http.MethodGet, "/v1/providers", "key-backend", "", &providersRes)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"OpenAI"}, providersRes.Providers)
+
+		var res map[string]string
+		code, _ = call(t, ts, http.MethodPost, "/v1/jobs", "key-backend", `{"prompt":"q","providers":["google"]}`, &res)
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Equal(t, `provider "google" is not allowed for client "backend"`, res["error"])
+
+		var job Job
+		code, _ = call(t, ts, http.MethodPost, "/v1/jobs", "key-backend", `{"prompt":"q"}`, &job)
+		require.Equal(t, http.StatusAccepted, code)
+		require.Eventually(t, func() bool {
+			call(t, ts, http.MethodGet, "/v1/jobs/"+job.ID, "key-backend", "", &job)
+			return job.Status != StatusRunning
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, StatusDone, job.Status)
+		assert.Equal(t, "answer from openai", job.Text, "only allowed provider runs")
+
+		code, _ = call(t, ts, http.MethodGet, "/v1/jobs/"+job.ID, "key-docs", "", &res)
+		assert.Equal(t, http.StatusNotFound, code, "job of another client is not visible")
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		var res map[string]string
+		code, hdr := call(t, ts, http.MethodPost, "/v1/stream", "key-backend", `{"prompt":"q"}`, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "text/event-stream", hdr.Get("Content-Type"))
+
+		code, hdr = call(t, ts, http.MethodPost, "/v1/jobs", "key-backend", `{"prompt":"q"}`, &res)
+		assert.Equal(t, http.StatusTooManyRequests, code)
+		assert.Equal(t, "60", hdr.Get("Retry-After"))
+		assert.Contains(t, res["error"], "rate limit of 2 requests per minute exceeded")
+
+		code, _ = call(t, ts, http.MethodPost, "/v1/jobs", "key-docs", `{"prompt":"q"}`, &Job{})
+		assert.Equal(t, http.StatusAccepted, code, "other clients are not limited")
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		var res UsageResponse
+		code, _ := call(t, ts, http.MethodGet, "/v1/usage", "key-backend", "", &res)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "backend", res.Client)
+		assert.Equal(t, int64(2), res.Usage.Requests)
+		assert.Equal(t, int64(1), res.Usage.RateLimited)
+		assert.Equal(t, int64(2), res.Usage.PromptBytes)
+		assert.Equal(t, map[string]auth.ProviderUsage{"OpenAI": {Requests: 2, ResponseBytes: 36}}, res.Usage.Providers)
+	})
+}
+
+func TestServer_UsageWithoutAuth(t *testing.T) {
+	ts := httptest.NewServer(New(Options{}).routes(context.Background()))
+	defer ts.Close()
+	var res map[string]string
+	code, _ := call(t, ts, http.MethodGet, "/v1/usage", "", "", &res)
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, "usage is accounted with auth only", res["error"])
+}
@@ -0,0 +1,296 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-pkgz/lgr"
+
+	"github.com/umputun/mpt/pkg/auth"
+)
+
+// MixModel is the model of OpenAI-compatible API sending the prompt to all providers and mixing their answers,
+// other models select a single provider by its name
+const MixModel = "mpt-mix"
+
+// ChatRequest is the body of OpenAI chat completion request. Sampling parameters of the request are ignored,
+// providers use their configured ones.
+type ChatRequest struct {
+	Model    string        `json:"model"`
+	Messages []ChatMessage `json:"messages"`
+	Stream   bool          `json:"stream,omitempty"`
+}
+
+// ChatMessage is a message of OpenAI chat completion request, content is a string or an array of text parts
+type ChatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// ChatCompletion is the response of OpenAI chat completion, or a chunk of the streamed response
+type ChatCompletion struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []ChatChoice `json:"choices"`
+}
+
+// ChatChoice is the answer of chat completion, with the message in response or the delta in streamed chunk
+type ChatChoice struct {
+	Index        int              `json:"index"`
+	Message      *ChatResponseMsg `json:"message,omitempty"`
+	Delta        *ChatResponseMsg `json:"delta,omitempty"`
+	FinishReason *string          `json:"finish_reason"`
+}
+
+// ChatResponseMsg is the assistant message of chat completion
+type ChatResponseMsg struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// ModelList is the response of OpenAI models endpoint
+type ModelList struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
+
+// Model is a model of OpenAI models endpoint
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// openAIError is the error response of OpenAI API
+type openAIError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    string `json:"code,omitempty"`
+	} `json:"error"`
+}
+
+// openAIRoutes returns the handler of OpenAI-compatible API endpoints
+func (s *Server) openAIRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", s.openAIAuthenticated(s.handleChatCompletions))
+	mux.HandleFunc("GET /v1/models", s.openAIAuthenticated(s.handleModels))
+	mux.HandleFunc("GET /ping", s.handlePing)
+	return mux
+}
+
+// openAIAuthenticated is authenticated with errors written in OpenAI format
+func (s *Server) openAIAuthenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, err := s.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeOpenAIError(w, http.StatusUnauthorized, "authentication_error", "invalid_api_key", err)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleModels lists the mix model and names of providers available to the client as models
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	client := requestClient(r)
+	res := ModelList{Object: "list", Data: []Model{{ID: MixModel, Object: "model", OwnedBy: "mpt"}}}
+	for _, p := range s.opts.Providers {
+		if p.Enabled() && (client == nil || client.AllowsProvider(p.Name())) {
+			res.Data = append(res.Data, Model{ID: p.Name(), Object: "model", OwnedBy: "mpt"})
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleChatCompletions runs the chat prompt with the provider selected by the model, or with all providers
+// mixing their answers for the mix model, and responds when the run is completed. Streamed response has the whole
+// answer in a single chunk, as answers are mixed before they are sent. The run is canceled if the client
+// disconnects or the shutdown grace period expires.
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	// acquire before parsing, so requests rejected while draining don't count against rate limits of the client
+	ctx, release, err := s.requests.Acquire(r.Context())
+	if err != nil {
+		writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", "", err)
+		return
+	}
+	defer release()
+
+	var chat ChatRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&chat); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "", fmt.Errorf("invalid chat request: %w", err))
+		return
+	}
+	req := JobRequest{Mix: strings.EqualFold(chat.Model, MixModel)}
+	if req.Prompt, err = chatPrompt(chat.Messages); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "", err)
+		return
+	}
+	if !req.Mix {
+		if !s.hasProvider(chat.Model) {
+			writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "model_not_found",
+				fmt.Errorf("model %q is not served, use %s or a provider name", chat.Model, MixModel))
+			return
+		}
+		req.Providers = []string{chat.Model}
+	}
+	providers, timeout, err := s.admit(r, &req)
+	if err != nil {
+		writeOpenAIRequestError(w, err)
+		return
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	lgr.Printf("[INFO] chat completion started, model: %s, providers: %d", chat.Model, len(providers))
+	res := s.execute(ctx, req, providers, nil, nil)
+	if res.err != nil {
+		lgr.Printf("[WARN] chat completion failed: %v", res.err)
+		writeOpenAIError(w, http.StatusBadGateway, "api_error", "", res.err)
+		return
+	}
+
+	id, err := newID()
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+	stopReason := "stop"
+	completion := ChatCompletion{ID: "chatcmpl-" + id, Object: "chat.completion", Created: s.now().Unix(), Model: chat.Model}
+	if !chat.Stream {
+		completion.Choices = []ChatChoice{{Message: &ChatResponseMsg{Role: "assistant", Content: res.answer},
+			FinishReason: &stopReason}}
+		writeJSON(w, http.StatusOK, completion)
+		return
+	}
+
+	completion.Object = "chat.completion.chunk"
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	completion.Choices = []ChatChoice{{Delta: &ChatResponseMsg{Role: "assistant", Content: res.answer}}}
+	writeChunk(w, completion)
+	completion.Choices = []ChatChoice{{Delta: &ChatResponseMsg{}, FinishReason: &stopReason}}
+	writeChunk(w, completion)
+	if _, err := fmt.Fprint(w, "data: [DONE]\n\n"); err != nil {
+		lgr.Printf("[DEBUG] failed to write chat completion end: %v", err)
+	}
+}
+
+// hasProvider checks if an enabled provider has the name, case-insensitive
+func (s *Server) hasProvider(name string) bool {
+	for _, p := range s.opts.Providers {
+		if p.Enabled() && strings.EqualFold(p.Name(), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// chatPrompt makes the prompt of chat messages. System and developer messages are put before a single user
+// message, while a conversation is kept as a transcript with the role of each message.
+func chatPrompt(messages []ChatMessage) (string, error) {
+	type message struct{ role, text string }
+	var system []string
+	var conversation []message
+	for i, m := range messages {
+		text, err := messageText(m.Content)
+		if err != nil {
+			return "", fmt.Errorf("invalid content of message %d: %w", i, err)
+		}
+		switch m.Role {
+		case "system", "developer":
+			system = append(system, text)
+		case "user", "assistant", "tool":
+			conversation = append(conversation, message{role: m.Role, text: text})
+		default:
+			return "", fmt.Errorf("unsupported role %q of message %d", m.Role, i)
+		}
+	}
+	if len(conversation) == 0 || conversation[len(conversation)-1].role != "user" {
+		return "", errors.New("messages must end with a user message")
+	}
+
+	parts := system
+	if len(conversation) == 1 {
+		parts = append(parts, conversation[0].text)
+	} else {
+		for _, m := range conversation {
+			parts = append(parts, strings.ToUpper(m.role[:1])+m.role[1:]+": "+m.text)
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// messageText returns the text of message content, a string or an array of text parts
+func messageText(content json.RawMessage) (string, error) {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return "", errors.New("expected a string or an array of text parts")
+	}
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.Type != "text" {
+			return "", fmt.Errorf("unsupported content part %q, only text is supported", p.Type)
+		}
+		texts = append(texts, p.Text)
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// writeChunk writes the streamed chunk of chat completion as server-sent event
+func writeChunk(w http.ResponseWriter, chunk ChatCompletion) {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		lgr.Printf("[WARN] failed to encode chat completion chunk: %v", err)
+		return
+	}
+	if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+		lgr.Printf("[DEBUG] failed to write chat completion chunk: %v", err)
+		return
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writeOpenAIRequestError writes the error of the chat request with the status matching the error
+func writeOpenAIRequestError(w http.ResponseWriter, err error) {
+	var rlErr *auth.RateLimitError
+	switch {
+	case errors.As(err, &rlErr):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rlErr.RetryAfter.Seconds()))))
+		writeOpenAIError(w, http.StatusTooManyRequests, "rate_limit_error", "rate_limit_exceeded", err)
+	case errors.Is(err, errNotAllowed):
+		writeOpenAIError(w, http.StatusForbidden, "permission_error", "", err)
+	default:
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "", err)
+	}
+}
+
+// writeOpenAIError writes the error response in OpenAI format with the status
+func writeOpenAIError(w http.ResponseWriter, status int, typ, code string, err error) {
+	var res openAIError
+	res.Error.Message, res.Error.Type, res.Error.Code = err.Error(), typ, code
+	writeJSON(w, status, res)
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/auth"
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+func TestServer_ChatCompletions(t *testing.T) {
+	openai := newProvider("OpenAI", "answer from openai", nil)
+	providers := []provider.Provider{openai, newProvider("Google", "answer from google", nil),
+		newProvider("Anthropic", "", errors.New("rate limit"))}
+	srv := New(Options{Providers: providers, MixProvider: "google", MixPrompt: "merge", JobRetention: time.Hour})
+	srv.now = func() time.Time { return time.Unix(1700000000, 0) }
+	ts := httptest.NewServer(srv.openAIRoutes())
+	defer ts.Close()
+
+	t.Run("single provider", func(t *testing.T) {
+		var res ChatCompletion
+		code, _ := call(t, ts, http.MethodPost, "/v1/chat/completions", "", `{"model":"openai","messages":[`+
+			`{"role":"system","content":"be brief"},{"role":"user","content":[{"type":"text","text":"question"}]}]}`, &res)
+		require.Equal(t, http.StatusOK, code)
+		assert.True(t, strings.HasPrefix(res.ID, "chatcmpl-"))
+		assert.Equal(t, "chat.completion", res.Object)
+		assert.Equal(t, int64(1700000000), res.Created)
+		assert.Equal(t, "openai", res.Model)
+		require.Len(t, res.Choices, 1)
+		assert.Equal(t, &ChatResponseMsg{Role: "assistant", Content: "answer from openai"}, res.Choices[0].Message)
+		require.NotNil(t, res.Choices[0].FinishReason)
+		assert.Equal(t, "stop", *res.Choices[0].FinishReason)
+		calls := openai.GenerateCalls()
+		assert.Equal(t, "be brief\n\nquestion", calls[len(calls)-1].Prompt)
+	})
+
+	t.Run("mix model", func(t *testing.T) {
+		var res ChatCompletion
+		code, _ := call(t, ts, http.MethodPost, "/v1/chat/completions", "", `{"model":"mpt-mix","messages":[`+
+			`{"role":"user","content":"question"}]}`, &res)
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, res.Choices, 1)
+		assert.Equal(t, "merged by Google", res.Choices[0].Message.Content, "mixed answer without header")
+	})
+
+	t.Run("conversation", func(t *testing.T) {
+		code, _ := call(t, ts, http.MethodPost, "/v1/chat/completions", "", `{"model":"OpenAI","messages":[`+
+			`{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"question"}]}`, nil)
+		require.Equal(t, http.StatusOK, code)
+		calls := openai.GenerateCalls()
+		assert.Equal(t, "User: hi\n\nAssistant: hello\n\nUser: question", calls[len(calls)-1].Prompt)
+	})
+
+	t.Run("streamed", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/v1/chat/completions", "application/json", strings.NewReader(
+			`{"model":"openai","stream":true,"messages":[{"role":"user","content":"question"}]}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		var data []string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if d, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				data = append(data, d)
+			}
+		}
+		require.Len(t, data, 3)
+		assert.Equal(t, "[DONE]", data[2])
+		var chunk ChatCompletion
+		require.NoError(t, json.Unmarshal([]byte(data[0]), &chunk))
+		assert.Equal(t, "chat.completion.chunk", chunk.Object)
+		assert.Equal(t, &ChatResponseMsg{Role: "assistant", Content: "answer from openai"}, chunk.Choices[0].Delta)
+		assert.Nil(t, chunk.Choices[0].FinishReason)
+		require.NoError(t, json.Unmarshal([]byte(data[1]), &chunk))
+		require.NotNil(t, chunk.Choices[0].FinishReason)
+		assert.Equal(t, "stop", *chunk.Choices[0].FinishReason)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			name, body, msg string
+			code            int
+		}{
+			{name: "unknown model", body: `{"model":"gpt-4o","messages":[{"role":"user","content":"q"}]}`,
+				code: http.StatusNotFound, msg: `model "gpt-4o" is not served, use mpt-mix or a provider name`},
+			{name: "no user message", body: `{"model":"openai","messages":[{"role":"system","content":"q"}]}`,
+				code: http.StatusBadRequest, msg: "messages must end with a user message"},
+			{name: "image content", body: `{"model":"openai","messages":[{"role":"user","content":[{"type":"image_url"}]}]}`,
+				code: http.StatusBadRequest, msg: `invalid content of message 0: unsupported content part "image_url", only text is supported`},
+			{name: "unknown role", body: `{"model":"openai","messages":[{"role":"robot","content":"q"}]}`,
+				code: http.StatusBadRequest, msg: `unsupported role "robot" of message 0`},
+			{name: "provider failed", body: `{"model":"anthropic","messages":[{"role":"user","content":"q"}]}`,
+				code: http.StatusBadGateway, msg: "all providers failed: Anthropic: rate limit"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var res openAIError
+				code, _ := call(t, ts, http.MethodPost, "/v1/chat/completions", "", tt.body, &res)
+				assert.Equal(t, tt.code, code)
+				assert.Equal(t, tt.msg, res.Error.Message)
+				assert.NotEmpty(t, res.Error.Type)
+			})
+		}
+	})
+}
+
+func TestServer_ChatCompletionsAuth(t *testing.T) {
+	authenticator, err := auth.New([]auth.Client{{Name: "editor", Key: "key-editor", Providers: []string{"openai"}}})
+	require.NoError(t, err)
+	providers := []provider.Provider{newProvider("OpenAI", "answer from openai", nil),
+		newProvider("Google", "answer from google", nil)}
+	srv := New(Options{Providers: providers, JobRetention: time.Hour, Auth: authenticator})
+	ts := httptest.NewServer(srv.openAIRoutes())
+	defer ts.Close()
+
+	var errRes openAIError
+	code, hdr := call(t, ts, http.MethodGet, "/v1/models", "wrong", "", &errRes)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "Bearer", hdr.Get("WWW-Authenticate"))
+	assert.Equal(t, "authentication_error", errRes.Error.Type)
+
+	var models ModelList
+	code, _ = call(t, ts, http.MethodGet, "/v1/models", "key-editor", "", &models)
+	require.Equal(t, http.StatusOK, code)
+	ids := make([]string, 0, len(models.Data))
+	for _, m := range models.Data {
+		ids = append(ids, m.ID)
+	}
+	assert.Equal(t, []string{"mpt-mix", "OpenAI"}, ids, "only allowed providers listed")
+
+	code, _ = call(t, ts, http.MethodPost, "/v1/chat/completions", "key-editor",
+		`{"model":"google","messages":[{"role":"user","content":"q"}]}`, &errRes)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "permission_error", errRes.Error.Type)
+
+	var res ChatCompletion
+	code, _ = call(t, ts, http.MethodPost, "/v1/chat/completions", "key-editor",
+		`{"model":"openai","messages":[{"role":"user","content":"q"}]}`, &res)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "answer from openai", res.Choices[0].Message.Content)
+	assert.Equal(t, int64(1), srv.opts.Auth.Usage("editor").Requests)
+}
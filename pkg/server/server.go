@@ -0,0 +1,615 @@
+// Package server implements HTTP server mode. Prompts are submitted as asynchronous jobs and their status and
+// results are polled by clients, so long multi-provider runs don't hold client connections open, or run with
+// lifecycle events streamed to the client as server-sent events. The server also serves a simple embedded
+// web UI for users not comfortable with the command line. Clients are authenticated by API keys if auth is set.
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+
+	"github.com/umputun/mpt/pkg/auth"
+	"github.com/umputun/mpt/pkg/drain"
+	"github.com/umputun/mpt/pkg/files"
+	"github.com/umputun/mpt/pkg/mix"
+	"github.com/umputun/mpt/pkg/provider"
+	"github.com/umputun/mpt/pkg/runner"
+)
+
+//go:embed web/index.html
+var webFS embed.FS
+
+// maxRequestSize limits the size of request body, prompts may include file contents
+const maxRequestSize = 16 << 20
+
+// shutdownTimeout bounds waiting for in-flight HTTP requests on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// Options contains configuration of the HTTP server
+type Options struct {
+	Address         string                // address of jobs API to listen on, like ":8080", not served if empty
+	OpenAIAddress   string                // address of OpenAI-compatible API to listen on, like ":8081", not served if empty
+	Version         string                // version reported by the server
+	Providers       []provider.Provider   // configured providers, all of them run unless a job selects some
+	MixProvider     string                // provider used to mix results when the job requests mix
+	MixPrompt       string                // prompt used to mix results when the job requests mix
+	MixRefinePrompt string                // prompt of refinement stages if MixProvider is a chain of providers
+	MixMaxTokens    int                   // max tokens of the mixed result, 0 for no limit
+	MixStyle        string                // style of the mixed result, one of mix.Styles, free-form if empty
+	MixQuorum       int                   // answers starting the mix of streamed runs before the rest, at least 2, 0 to wait for all
+	Capabilities    provider.Capabilities // capabilities of providers, to select mix provider by capability
+	Quota           runner.QuotaTracker   // rate limits of providers shared by all jobs, optional
+	Limiter         runner.Limiter        // in-flight request limits of providers shared by all jobs, optional
+	JobRetention    time.Duration         // how long finished jobs are kept for polling
+	JobTimeout      time.Duration         // max run time of a job, 0 for no limit
+	Auth            *auth.Authenticator   // API keys of clients, no authentication if nil
+	ShutdownGrace   time.Duration         // how long running jobs and streams may complete on shutdown
+}
+
+// Server runs prompts submitted over HTTP as jobs
+type Server struct {
+	opts Options
+	now  func() time.Time
+
+	mu       sync.Mutex
+	jobs     map[string]*Job
+	requests *drain.Tracker // running jobs and streams
+}
+
+// job statuses
+const (
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Job is a prompt run submitted to the server
+type Job struct {
+	ID          string           `json:"id"`
+	Status      string           `json:"status"`
+	CreatedAt   time.Time        `json:"created_at"`
+	FinishedAt  *time.Time       `json:"finished_at,omitempty"`
+	Text        string           `json:"text,omitempty"`         // final text, mixed result if mix was requested
+	MixProvider string           `json:"mix_provider,omitempty"` // provider of the mixed result
+	Responses   []ResponseResult `json:"responses,omitempty"`    // individual provider responses
+	Error       string           `json:"error,omitempty"`
+
+	client string // name of the client submitted the job, empty without auth
+}
+
+// ResponseResult is the response of a single provider in the job
+type ResponseResult struct {
+	Provider  string `json:"provider"`
+	Text      string `json:"text,omitempty"`
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// JobRequest is the body of job submission
+type JobRequest struct {
+	Prompt    string   `json:"prompt"`
+	Files     []File   `json:"files,omitempty"`     // files included in the prompt
+	Providers []string `json:"providers,omitempty"` // names of providers to run, all configured providers if empty
+	Mix       bool     `json:"mix,omitempty"`       // mix results of all providers into a single answer
+	Timeout   string   `json:"timeout,omitempty"`   // max run time of the job as a duration, like 2m
+
+	client *auth.Client // authenticated client of the request, nil without auth
+}
+
+// File is a file uploaded or pasted with the prompt
+type File struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// ProvidersResponse lists providers available to jobs
+type ProvidersResponse struct {
+	Providers   []string `json:"providers"`
+	MixProvider string   `json:"mix_provider,omitempty"`
+}
+
+// UsageResponse is the accounted usage of the client
+type UsageResponse struct {
+	Client string     `json:"client"`
+	Usage  auth.Usage `json:"usage"`
+}
+
+// errNotAllowed is returned for providers the client is not allowed to use
+var errNotAllowed = errors.New("not allowed")
+
+// clientCtxKey is the context key of the authenticated client
+type clientCtxKey struct{}
+
+// New makes HTTP server with the options
+func New(opts Options) *Server {
+	return &Server{opts: opts, now: time.Now, jobs: map[string]*Job{}, requests: drain.New()}
+}
+
+// Start runs the HTTP server until the context is canceled or SIGTERM is received. Jobs API and OpenAI-compatible
+// API are served on their own addresses, if set. On shutdown new jobs and streams are rejected, while running ones
+// may complete within the shutdown grace period and are canceled after it, with partial results recorded.
+// Finished jobs can be polled until the server stops.
+func (s *Server) Start(ctx context.Context) error {
+	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGTERM)
+	defer cancel()
+
+	base := context.WithoutCancel(ctx)
+	var servers []*http.Server
+	if s.opts.Address != "" {
+		servers = append(servers, &http.Server{Addr: s.opts.Address, Handler: s.routes(base), ReadHeaderTimeout: 10 * time.Second})
+		lgr.Printf("[INFO] HTTP server listening on %s", s.opts.Address)
+	}
+	if s.opts.OpenAIAddress != "" {
+		servers = append(servers, &http.Server{Addr: s.opts.OpenAIAddress, Handler: s.openAIRoutes(),
+			ReadHeaderTimeout: 10 * time.Second})
+		lgr.Printf("[INFO] OpenAI-compatible API listening on %s", s.opts.OpenAIAddress)
+	}
+	if len(servers) == 0 {
+		return errors.New("no address to listen on")
+	}
+
+	errCh := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func() { errCh <- srv.ListenAndServe() }()
+	}
+
+	var failure error
+	select {
+	case err := <-errCh:
+		failure = fmt.Errorf("http server failed: %w", err)
+	case <-ctx.Done():
+		lgr.Printf("[INFO] shutting down HTTP server, waiting for running requests up to %v", s.opts.ShutdownGrace)
+		if !s.requests.Drain(s.opts.ShutdownGrace) {
+			lgr.Printf("[WARN] shutdown grace period expired, running requests canceled")
+		}
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil && failure == nil {
+			failure = fmt.Errorf("failed to shut down http server: %w", err)
+		}
+	}
+	if failure != nil {
+		return failure
+	}
+	for range servers {
+		if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("http server failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// routes returns the handler of server endpoints, jobs run with the base context
+func (s *Server) routes(base context.Context) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/jobs", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		s.handleSubmit(base, w, r)
+	}))
+	mux.HandleFunc("GET /v1/jobs/{id}", s.authenticated(s.handleStatus))
+	mux.HandleFunc("POST /v1/stream", s.authenticated(s.handleStream))
+	mux.HandleFunc("GET /v1/providers", s.authenticated(s.handleProviders))
+	mux.HandleFunc("GET /v1/usage", s.authenticated(s.handleUsage))
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFileFS(w, r, webFS, "web/index.html")
+	})
+	mux.HandleFunc("GET /ping", s.handlePing)
+	return mux
+}
+
+// handlePing reports the server status, failing while the server is draining
+func (s *Server) handlePing(w http.ResponseWriter, _ *http.Request) {
+	if s.requests.Draining() {
+		// fail readiness checks, so load balancers stop routing requests to the server
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "draining", "version": s.opts.Version})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "version": s.opts.Version})
+}
+
+// authenticated wraps the handler to require API key of a client, passed as bearer token of Authorization
+// header or in X-API-Key header. The client is put into the request context. Does nothing without auth.
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, err := s.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// authenticate returns the request with the client of its API key put into the context, or an error if the key
+// is not valid. The request is returned as is without auth.
+func (s *Server) authenticate(r *http.Request) (*http.Request, error) {
+	if s.opts.Auth == nil {
+		return r, nil
+	}
+	key := r.Header.Get("X-API-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		key = strings.TrimSpace(bearer)
+	}
+	client, err := s.opts.Auth.Authenticate(key)
+	if err != nil {
+		lgr.Printf("[WARN] unauthorized request %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		return r, err
+	}
+	return r.WithContext(context.WithValue(r.Context(), clientCtxKey{}, &client)), nil
+}
+
+// requestClient returns the authenticated client of the request, nil without auth
+func requestClient(r *http.Request) *auth.Client {
+	c, _ := r.Context().Value(clientCtxKey{}).(*auth.Client)
+	return c
+}
+
+// writeRequestError writes the error of the job request with the status matching the error
+func writeRequestError(w http.ResponseWriter, err error) {
+	var rlErr *auth.RateLimitError
+	switch {
+	case errors.As(err, &rlErr):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rlErr.RetryAfter.Seconds()))))
+		writeError(w, http.StatusTooManyRequests, err)
+	case errors.Is(err, errNotAllowed):
+		writeError(w, http.StatusForbidden, err)
+	default:
+		writeError(w, http.StatusBadRequest, err)
+	}
+}
+
+// parseRequest decodes and validates the job request, returning providers selected by the request and
+// the run timeout, see admit.
+func (s *Server) parseRequest(w http.ResponseWriter, r *http.Request) (req JobRequest, providers []provider.Provider,
+	timeout time.Duration, err error) {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+		return req, nil, 0, fmt.Errorf("invalid job request: %w", err)
+	}
+	if strings.TrimSpace(req.Prompt) == "" {
+		return req, nil, 0, errors.New("prompt is required")
+	}
+	if len(req.Files) > 0 {
+		var sb strings.Builder
+		for _, f := range req.Files {
+			if strings.TrimSpace(f.Name) == "" {
+				return req, nil, 0, errors.New("file name is required")
+			}
+			sb.WriteString(files.FormatFile(f.Name, f.Content))
+		}
+		req.Prompt += "\n\n" + strings.TrimSuffix(sb.String(), "\n\n")
+	}
+	providers, timeout, err = s.admit(r, &req)
+	return req, providers, timeout, err
+}
+
+// admit checks the decoded request, returning providers selected by the request and the run timeout. The request
+// of authenticated client is limited to its providers and counted against its rate limit.
+func (s *Server) admit(r *http.Request, req *JobRequest) (providers []provider.Provider, timeout time.Duration, err error) {
+	timeout = s.opts.JobTimeout
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d <= 0 {
+			return nil, 0, fmt.Errorf("invalid timeout %q: expected positive duration like 2m", req.Timeout)
+		}
+		if s.opts.JobTimeout > 0 {
+			d = min(d, s.opts.JobTimeout) // clients can't run jobs longer than the server allows
+		}
+		timeout = d
+	}
+	req.client = requestClient(r)
+	providers, err = s.selectProviders(req.Providers, req.client)
+	if err != nil {
+		return nil, 0, err
+	}
+	if req.client != nil {
+		if err := s.opts.Auth.Allow(*req.client); err != nil {
+			lgr.Printf("[WARN] request of client %s rejected: %v", req.client.Name, err)
+			return nil, 0, err
+		}
+	}
+	return providers, timeout, nil
+}
+
+// handleSubmit starts a job for the submitted prompt and returns its id without waiting for the result
+func (s *Server) handleSubmit(base context.Context, w http.ResponseWriter, r *http.Request) {
+	// acquire before parsing, so requests rejected while draining don't count against rate limits of the client
+	ctx, release, err := s.requests.Acquire(base)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	req, providers, timeout, err := s.parseRequest(w, r)
+	if err != nil {
+		release()
+		writeRequestError(w, err)
+		return
+	}
+
+	id, err := newID()
+	if err != nil {
+		release()
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	job := &Job{ID: id, Status: StatusRunning, CreatedAt: s.now()}
+	if req.client != nil {
+		job.client = req.client.Name
+	}
+
+	s.mu.Lock()
+	s.cleanup()
+	s.jobs[id] = job
+	res := *job
+	s.mu.Unlock()
+
+	go func() {
+		defer release()
+		jobCtx := ctx
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			jobCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		s.runJob(jobCtx, job, req, providers)
+	}()
+
+	lgr.Printf("[INFO] job %s submitted, providers: %d, mix: %v", id, len(providers), req.Mix)
+	w.Header().Set("Location", "/v1/jobs/"+id)
+	writeJSON(w, http.StatusAccepted, res)
+}
+
+// handleProviders returns names of enabled providers available to the client and the mix provider
+func (s *Server) handleProviders(w http.ResponseWriter, r *http.Request) {
+	client := requestClient(r)
+	res := ProvidersResponse{Providers: []string{}, MixProvider: s.opts.MixProvider}
+	for _, p := range s.opts.Providers {
+		if p.Enabled() && (client == nil || client.AllowsProvider(p.Name())) {
+			res.Providers = append(res.Providers, p.Name())
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleUsage returns the accounted usage of the client, available with auth only
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	client := requestClient(r)
+	if client == nil {
+		writeError(w, http.StatusNotFound, errors.New("usage is accounted with auth only"))
+		return
+	}
+	writeJSON(w, http.StatusOK, UsageResponse{Client: client.Name, Usage: s.opts.Auth.Usage(client.Name)})
+}
+
+// handleStatus returns the job with its result if finished
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	var clientName string
+	if client := requestClient(r); client != nil {
+		clientName = client.Name
+	}
+
+	s.mu.Lock()
+	s.cleanup()
+	job, ok := s.jobs[r.PathValue("id")]
+	if ok && job.client != clientName {
+		ok = false // jobs of other clients are not visible
+	}
+	var res Job
+	if ok {
+		res = *job
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("job not found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// execution is the outcome of running a prompt
+type execution struct {
+	text        string // final text, with headers of providers if there are several answers
+	answer      string // final text without headers, mixed result if mixed
+	mixProvider string
+	responses   []ResponseResult
+	err         error
+}
+
+// execute runs the prompt with the providers and mixes the results if requested. Hooks are called on
+// runner lifecycle events, and onMix before mixing, both are optional.
+func (s *Server) execute(ctx context.Context, req JobRequest, providers []provider.Provider, hooks runner.Hooks,
+	onMix func()) execution {
+	var rh []runner.Hooks
+	if hooks != nil {
+		rh = append(rh, hooks)
+	}
+	run, err := s.newRunner(providers, rh...).Execute(ctx, req.Prompt)
+	res := s.outcome(ctx, req, run, err)
+
+	if res.err == nil && req.Mix && len(providers) > 1 {
+		if onMix != nil {
+			onMix()
+		}
+		res.mixed(mix.New(lgr.Default()).Process(ctx, s.mixRequest(req, providers, run.Results)))
+	}
+	return res
+}
+
+// newRunner makes the runner of providers with quota, limiter and hooks of the server
+func (s *Server) newRunner(providers []provider.Provider, hooks ...runner.Hooks) *runner.Runner {
+	r := runner.New(providers...)
+	if s.opts.Quota != nil {
+		r.WithQuota(s.opts.Quota)
+	}
+	if s.opts.Limiter != nil {
+		r.WithLimiter(s.opts.Limiter)
+	}
+	if len(hooks) > 0 {
+		r.WithHooks(hooks...)
+	}
+	return r
+}
+
+// outcome makes the execution of completed run and records the usage of the client
+func (s *Server) outcome(ctx context.Context, req JobRequest, run runner.Results, err error) execution {
+	res := execution{text: run.Text, answer: run.Text, err: err}
+	if res.err != nil && drain.Canceled(ctx) {
+		res.err = fmt.Errorf("canceled by server shutdown: %w", res.err)
+	}
+	if req.client != nil {
+		s.opts.Auth.Record(*req.client, req.Prompt, run.Results)
+	}
+	res.responses = make([]ResponseResult, 0, len(run.Results))
+	for _, pr := range run.Results {
+		res.responses = append(res.responses, responseResult(pr))
+	}
+	return res
+}
+
+// mixRequest makes the request mixing the results with mix options of the server
+func (s *Server) mixRequest(req JobRequest, providers []provider.Provider, results []provider.Result) mix.Request {
+	return mix.Request{
+		Prompt:       req.Prompt,
+		MixPrompt:    s.opts.MixPrompt,
+		MixProvider:  s.opts.MixProvider,
+		RefinePrompt: s.opts.MixRefinePrompt,
+		MaxTokens:    s.opts.MixMaxTokens,
+		Style:        s.opts.MixStyle,
+		Capabilities: s.opts.Capabilities,
+		Providers:    providers,
+		Results:      results,
+	}
+}
+
+// mixed sets the final text to the mixed result, if results were mixed
+func (e *execution) mixed(resp *mix.Response, err error) {
+	switch {
+	case err != nil:
+		e.err = fmt.Errorf("failed to mix results: %w", err)
+	case resp.TextWithHeader != "":
+		e.text, e.answer, e.mixProvider = resp.TextWithHeader, resp.RawText, resp.MixProvider
+	}
+}
+
+// responseResult converts provider result to the response of the job
+func responseResult(r provider.Result) ResponseResult {
+	res := ResponseResult{Provider: r.Provider, Text: r.Text, LatencyMS: r.Latency.Milliseconds()}
+	if r.Error != nil {
+		res.Error = r.Error.Error()
+	}
+	return res
+}
+
+// runJob runs the prompt of the job and records the result
+func (s *Server) runJob(ctx context.Context, job *Job, req JobRequest, providers []provider.Provider) {
+	res := s.execute(ctx, req, providers, nil, nil)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	finished := s.now()
+	job.FinishedAt = &finished
+	job.Responses = res.responses
+	if res.err != nil {
+		job.Status, job.Error = StatusFailed, res.err.Error()
+		lgr.Printf("[WARN] job %s failed: %v", job.ID, res.err)
+		return
+	}
+	job.Status, job.Text, job.MixProvider = StatusDone, res.text, res.mixProvider
+	lgr.Printf("[INFO] job %s done in %v", job.ID, finished.Sub(job.CreatedAt))
+}
+
+// cleanup removes finished jobs older than the retention, must be called with the lock held
+func (s *Server) cleanup() {
+	now := s.now()
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > s.opts.JobRetention {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// selectProviders returns enabled providers with the names (case-insensitive), all providers if names are empty.
+// Providers are limited to the ones allowed for the client, if set. Duplicate names are rejected.
+func (s *Server) selectProviders(names []string, client *auth.Client) ([]provider.Provider, error) {
+	if len(names) == 0 {
+		if client == nil {
+			if len(s.opts.Providers) == 0 {
+				return nil, errors.New("no providers configured")
+			}
+			return s.opts.Providers, nil
+		}
+		res := make([]provider.Provider, 0, len(s.opts.Providers))
+		for _, p := range s.opts.Providers {
+			if client.AllowsProvider(p.Name()) {
+				res = append(res, p)
+			}
+		}
+		if len(res) == 0 {
+			return nil, fmt.Errorf("no configured providers are allowed for client %q: %w", client.Name, errNotAllowed)
+		}
+		return res, nil
+	}
+	res := make([]provider.Provider, 0, len(names))
+	for _, name := range names {
+		var found provider.Provider
+		for _, p := range s.opts.Providers {
+			if p.Enabled() && strings.EqualFold(p.Name(), name) {
+				found = p
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("provider %q is not configured", name)
+		}
+		if client != nil && !client.AllowsProvider(found.Name()) {
+			return nil, fmt.Errorf("provider %q is %w for client %q", name, errNotAllowed, client.Name)
+		}
+		if slices.Contains(res, found) {
+			return nil, fmt.Errorf("provider %q is selected more than once", name)
+		}
+		res = append(res, found)
+	}
+	return res, nil
+}
+
+// newID makes random job id
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to make job id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// writeJSON writes the value as JSON response with the status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		lgr.Printf("[WARN] failed to write response: %v", err)
+	}
+}
+
+// writeError writes JSON error response with the status
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
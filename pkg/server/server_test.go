@@ -0,0 +1,312 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider"
+	"github.com/umputun/mpt/pkg/provider/mocks"
+)
+
+func newProvider(name, answer string, err error) *mocks.ProviderMock {
+	return &mocks.ProviderMock{
+		NameFunc:    func() string { return name },
+		EnabledFunc: func() bool { return true },
+		GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+			if strings.HasPrefix(prompt, "merge") {
+				return "merged by " + name, nil
+			}
+			return answer, err
+		},
+	}
+}
+
+// submit posts the job request and returns the response code and decoded body
+func submit(t *testing.T, ts *httptest.Server, body string) (int, Job) {
+	t.Helper()
+	resp, err := http.Post(ts.URL+"/v1/jobs", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var job Job
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&job))
+	if resp.StatusCode == http.StatusAccepted {
+		assert.Equal(t, "/v1/jobs/"+job.ID, resp.Header.Get("Location"))
+	}
+	return resp.StatusCode, job
+}
+
+// poll gets the job until it's finished
+func poll(t *testing.T, ts *httptest.Server, id string) Job {
+	t.Helper()
+	var job Job
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(ts.URL + "/v1/jobs/" + id)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&job))
+		return job.Status != StatusRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	return job
+}
+
+func TestServer_Jobs(t *testing.T) {
+	providers := []provider.Provider{
+		newProvider("OpenAI", "answer from openai", nil),
+		newProvider("Google", "answer from google", nil),
+		newProvider("Anthropic", "", errors.New("rate limit")),
+	}
+	srv := New(Options{Providers: providers, MixProvider: "google", MixPrompt: "merge", JobRetention: time.Hour})
+	ts := httptest.NewServer(srv.routes(context.Background()))
+	defer ts.Close()
+
+	t.Run("all providers", func(t *testing.T) {
+		code, job := submit(t, ts, `{"prompt":"question"}`)
+		require.Equal(t, http.StatusAccepted, code)
+		assert.Len(t, job.ID, 32)
+		assert.Equal(t, StatusRunning, job.Status)
+
+		job = poll(t, ts, job.ID)
+		assert.Equal(t, StatusDone, job.Status)
+		assert.Contains(t, job.Text, "== generated by OpenAI ==\nanswer from openai")
+		assert.Contains(t, job.Text, "== generated by Google ==\nanswer from google")
+		require.Len(t, job.Responses, 3)
+		assert.Equal(t, ResponseResult{Provider: "Anthropic", Error: "rate limit"}, job.Responses[2])
+		require.NotNil(t, job.FinishedAt)
+	})
+
+	t.Run("selected providers with mix", func(t *testing.T) {
+		code, job := submit(t, ts, `{"prompt":"question","providers":["openai","GOOGLE"],"mix":true}`)
+		require.Equal(t, http.StatusAccepted, code)
+
+		job = poll(t, ts, job.ID)
+		assert.Equal(t, StatusDone, job.Status)
+		assert.Equal(t, "== mixed results by Google ==\nmerged by Google", job.Text)
+		assert.Equal(t, "Google", job.MixProvider)
+		assert.Len(t, job.Responses, 2)
+	})
+
+	t.Run("failed job", func(t *testing.T) {
+		code, job := submit(t, ts, `{"prompt":"question","providers":["anthropic"]}`)
+		require.Equal(t, http.StatusAccepted, code)
+
+		job = poll(t, ts, job.ID)
+		assert.Equal(t, StatusFailed, job.Status)
+		assert.Contains(t, job.Error, "rate limit")
+		assert.Empty(t, job.Text)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for body, errMsg := range map[string]string{
+			`{"prompt":" "}`: "prompt is required",
+			`not json`:       "invalid job request",
+			`{"prompt":"q","providers":["deepseek"]}`:        `provider "deepseek" is not configured`,
+			`{"prompt":"q","timeout":"soon"}`:                `invalid timeout "soon"`,
+			`{"prompt":"q","timeout":"-1s"}`:                 `invalid timeout "-1s"`,
+			`{"prompt":"q","providers":["openai","OpenAI"]}`: `provider "OpenAI" is selected more than once`,
+		} {
+			resp, err := http.Post(ts.URL+"/v1/jobs", "application/json", strings.NewReader(body))
+			require.NoError(t, err)
+			var res map[string]string
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+			assert.Contains(t, res["error"], errMsg, body)
+		}
+	})
+
+	t.Run("unknown job", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/v1/jobs/unknown")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestServer_JobFiles(t *testing.T) {
+	var prompt string
+	p := &mocks.ProviderMock{
+		NameFunc:    func() string { return "OpenAI" },
+		EnabledFunc: func() bool { return true },
+		GenerateFunc: func(ctx context.Context, p string) (string, error) {
+			prompt = p
+			return "answer", nil
+		},
+	}
+	srv := New(Options{Providers: []provider.Provider{p}, JobRetention: time.Hour})
+	ts := httptest.NewServer(srv.routes(context.Background()))
+	defer ts.Close()
+
+	_, job := submit(t, ts, `{"prompt":"review","files":[{"name":"main.go","content":"package main"},`+
+		`{"name":"conf.yml","content":"key: value"}]}`)
+	assert.Equal(t, StatusDone, poll(t, ts, job.ID).Status)
+	assert.Equal(t, "review\n\n// file: main.go\npackage main\n\n# file: conf.yml\nkey: value", prompt)
+
+	code, job := submit(t, ts, `{"prompt":"review","files":[{"name":" ","content":"text"}]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "file name is required", job.Error)
+}
+
+func TestServer_Providers(t *testing.T) {
+	disabled := newProvider("DeepSeek", "", nil)
+	disabled.EnabledFunc = func() bool { return false }
+	providers := []provider.Provider{newProvider("OpenAI", "", nil), disabled, newProvider("Google", "", nil)}
+	srv := New(Options{Providers: providers, MixProvider: "openai"})
+	ts := httptest.NewServer(srv.routes(context.Background()))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/v1/providers")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var res ProvidersResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.Equal(t, ProvidersResponse{Providers: []string{"OpenAI", "Google"}, MixProvider: "openai"}, res)
+}
+
+func TestServer_WebUI(t *testing.T) {
+	ts := httptest.NewServer(New(Options{}).routes(context.Background()))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `fetch("v1/stream"`)
+
+	resp2, err := http.Get(ts.URL + "/unknown")
+	require.NoError(t, err)
+	defer resp2.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp2.StatusCode)
+}
+
+func TestServer_JobTimeout(t *testing.T) {
+	slow := &mocks.ProviderMock{
+		NameFunc:    func() string { return "Slow" },
+		EnabledFunc: func() bool { return true },
+		GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		},
+	}
+	srv := New(Options{Providers: []provider.Provider{slow}, JobRetention: time.Hour, JobTimeout: time.Hour})
+	ts := httptest.NewServer(srv.routes(context.Background()))
+	defer ts.Close()
+
+	_, job := submit(t, ts, `{"prompt":"question","timeout":"50ms"}`)
+	job = poll(t, ts, job.ID)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Contains(t, job.Error, "timed out")
+
+	t.Run("request timeout limited by job timeout", func(t *testing.T) {
+		srv := New(Options{Providers: []provider.Provider{slow}, JobRetention: time.Hour, JobTimeout: 50 * time.Millisecond})
+		ts := httptest.NewServer(srv.routes(context.Background()))
+		defer ts.Close()
+		_, job := submit(t, ts, `{"prompt":"question","timeout":"1h"}`)
+		job = poll(t, ts, job.ID)
+		assert.Equal(t, StatusFailed, job.Status)
+		assert.Contains(t, job.Error, "timed out")
+	})
+}
+
+func TestServer_JobRetention(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	srv := New(Options{Providers: []provider.Provider{newProvider("OpenAI", "answer", nil)}, JobRetention: time.Minute})
+	srv.now = func() time.Time { mu.Lock(); defer mu.Unlock(); return now }
+	ts := httptest.NewServer(srv.routes(context.Background()))
+	defer ts.Close()
+
+	_, job := submit(t, ts, `{"prompt":"question"}`)
+	assert.Equal(t, StatusDone, poll(t, ts, job.ID).Status)
+
+	mu.Lock()
+	now = now.Add(30 * time.Second)
+	mu.Unlock()
+	assert.Equal(t, StatusDone, poll(t, ts, job.ID).Status, "job kept within retention")
+
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+	resp, err := http.Get(ts.URL + "/v1/jobs/" + job.ID)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "job removed after retention")
+}
+
+func TestServer_Start(t *testing.T) {
+	srv := New(Options{Address: "127.0.0.1:0", OpenAIAddress: "127.0.0.1:0", JobRetention: time.Minute})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Start(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not stopped")
+	}
+
+	err := New(Options{Address: "bad address"}).Start(context.Background())
+	require.ErrorContains(t, err, "http server failed")
+	err = New(Options{Address: "127.0.0.1:0", OpenAIAddress: "bad address"}).Start(context.Background())
+	require.ErrorContains(t, err, "http server failed", "failure of one listener stops the server")
+	err = New(Options{}).Start(context.Background())
+	require.EqualError(t, err, "no address to listen on")
+}
+
+func TestServer_Drain(t *testing.T) {
+	blocking := func(name string) *mocks.ProviderMock {
+		return &mocks.ProviderMock{
+			NameFunc:    func() string { return name },
+			EnabledFunc: func() bool { return true },
+			GenerateFunc: func(ctx context.Context, prompt string) (string, error) {
+				<-ctx.Done()
+				return "", ctx.Err()
+			},
+		}
+	}
+	providers := []provider.Provider{newProvider("OpenAI", "answer from openai", nil), blocking("Slow"), blocking("Stuck")}
+	srv := New(Options{Providers: providers, JobRetention: time.Hour})
+	ts := httptest.NewServer(srv.routes(context.Background()))
+	defer ts.Close()
+
+	_, partial := submit(t, ts, `{"prompt":"question","providers":["openai","slow"]}`)
+	_, failed := submit(t, ts, `{"prompt":"question","providers":["stuck"]}`)
+
+	drained := make(chan bool, 1)
+	go func() { drained <- srv.requests.Drain(100 * time.Millisecond) }()
+	require.Eventually(t, srv.requests.Draining, time.Second, 5*time.Millisecond)
+
+	code, _ := submit(t, ts, `{"prompt":"question"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, code, "new jobs rejected while draining")
+	resp, err := http.Get(ts.URL + "/ping")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	assert.False(t, <-drained, "running jobs canceled after grace period")
+	job := poll(t, ts, partial.ID)
+	assert.Equal(t, StatusDone, job.Status, "partial results are kept")
+	assert.Contains(t, job.Text, "answer from openai")
+	require.Len(t, job.Responses, 2)
+
+	job = poll(t, ts, failed.ID)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Contains(t, job.Error, "canceled by server shutdown")
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/go-pkgz/lgr"
+
+	"github.com/umputun/mpt/pkg/mix"
+	"github.com/umputun/mpt/pkg/provider"
+	"github.com/umputun/mpt/pkg/runner"
+)
+
+// stream event types
+const (
+	EventProviderStarted = "provider_started" // prompt is sent to the provider
+	EventProgress        = "progress"         // part of the provider response arrived
+	EventChunk           = "chunk"            // piece of the response text of a streaming provider, empty text restarts it
+	EventResult          = "result"           // whole final text of the provider response, replaces streamed chunks
+	EventProviderDone    = "provider_done"    // provider request completed, successfully or not
+	EventMixStarted      = "mix_started"      // mixing of provider results started
+	EventMixResult       = "mix_result"       // mixed result of the quorum of answers, updated with late answers by done event
+	EventDone            = "done"             // run completed, with the final text or error
+)
+
+// Event is the data of a server-sent event emitted by the stream endpoint
+type Event struct {
+	Provider    string           `json:"provider,omitempty"`
+	Received    int64            `json:"received,omitempty"`     // bytes of the response received so far, progress event
+	Text        string           `json:"text,omitempty"`         // text of chunk or result event, final text of done event
+	Error       string           `json:"error,omitempty"`        // error of provider_done or done event
+	LatencyMS   int64            `json:"latency_ms,omitempty"`   // provider latency, provider_done event
+	MixProvider string           `json:"mix_provider,omitempty"` // spec of the mix provider of mix_started event, provider of mixed result of done event
+	Responses   []ResponseResult `json:"responses,omitempty"`    // individual provider responses, done event
+}
+
+// eventWriter writes server-sent events, safe for concurrent use by runner hooks
+type eventWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// send writes the event and flushes it to the client
+func (e *eventWriter) send(typ string, ev Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		lgr.Printf("[WARN] failed to encode %s event: %v", typ, err)
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", typ, data); err != nil {
+		lgr.Printf("[DEBUG] failed to write %s event: %v", typ, err)
+		return
+	}
+	e.flusher.Flush()
+}
+
+// OnStart emits provider_started event
+func (e *eventWriter) OnStart(name string) { e.send(EventProviderStarted, Event{Provider: name}) }
+
+// OnProgress emits progress event with bytes received so far
+func (e *eventWriter) OnProgress(name string, received int64) {
+	e.send(EventProgress, Event{Provider: name, Received: received})
+}
+
+// OnChunk emits chunk event with the piece of streamed response text, empty on start of the response
+func (e *eventWriter) OnChunk(name, text string) {
+	e.send(EventChunk, Event{Provider: name, Text: text})
+}
+
+// OnProviderDone emits result event with the whole response text, if any, and provider_done event
+func (e *eventWriter) OnProviderDone(r provider.Result) {
+	if r.Error == nil && r.Text != "" {
+		e.send(EventResult, Event{Provider: r.Provider, Text: r.Text})
+	}
+	ev := Event{Provider: r.Provider, LatencyMS: r.Latency.Milliseconds()}
+	if r.Error != nil {
+		ev.Error = r.Error.Error()
+	}
+	e.send(EventProviderDone, ev)
+}
+
+// OnAllDone does nothing, done event is emitted after mixing
+func (e *eventWriter) OnAllDone([]provider.Result, error) {}
+
+// handleStream runs the prompt and streams lifecycle events of the run as server-sent events. The run is
+// canceled if the client disconnects or the shutdown grace period expires.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	// acquire before parsing, so requests rejected while draining don't count against rate limits of the client
+	ctx, release, err := s.requests.Acquire(r.Context())
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	defer release()
+	req, providers, timeout, err := s.parseRequest(w, r)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	events := &eventWriter{w: w, flusher: flusher}
+	lgr.Printf("[INFO] stream started, providers: %d, mix: %v", len(providers), req.Mix)
+	var res execution
+	if req.Mix && s.opts.MixQuorum > 0 && len(providers) > s.opts.MixQuorum {
+		res = s.executeQuorum(ctx, req, providers, events)
+	} else {
+		res = s.execute(ctx, req, providers, events, func() {
+			events.send(EventMixStarted, Event{MixProvider: s.opts.MixProvider})
+		})
+	}
+
+	done := Event{Text: res.text, MixProvider: res.mixProvider, Responses: res.responses}
+	if res.err != nil {
+		done = Event{Error: res.err.Error(), Responses: res.responses}
+		lgr.Printf("[WARN] stream failed: %v", res.err)
+	}
+	events.send(EventDone, done)
+}
+
+// quorum collects successful results of providers and signals when the quorum of them is reached
+type quorum struct {
+	size    int
+	reached chan struct{} // closed when the quorum of successful results is collected
+
+	mu      sync.Mutex
+	results []provider.Result
+}
+
+// newQuorum makes the quorum of successful results of the size
+func newQuorum(size int) *quorum {
+	return &quorum{size: size, reached: make(chan struct{})}
+}
+
+// OnStart does nothing
+func (q *quorum) OnStart(string) {}
+
+// OnProgress does nothing
+func (q *quorum) OnProgress(string, int64) {}
+
+// OnProviderDone collects the successful result and closes reached channel on the quorum
+func (q *quorum) OnProviderDone(r provider.Result) {
+	if r.Error != nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.results = append(q.results, r)
+	if len(q.results) == q.size {
+		close(q.reached)
+	}
+}
+
+// OnAllDone does nothing
+func (q *quorum) OnAllDone([]provider.Result, error) {}
+
+// answered returns successful results collected so far
+func (q *quorum) answered() []provider.Result {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return slices.Clone(q.results)
+}
+
+// executeQuorum runs the prompt with the providers and starts mixing as soon as the quorum of providers answered,
+// without waiting for the rest. The mixed result is sent as mix_result event and updated with late answers after
+// all providers are done. If the run completes without the quorum of answers, results are mixed as usual.
+func (s *Server) executeQuorum(ctx context.Context, req JobRequest, providers []provider.Provider,
+	events *eventWriter) execution {
+	type completion struct {
+		run runner.Results
+		err error
+	}
+	q := newQuorum(s.opts.MixQuorum)
+	done := make(chan completion, 1)
+	go func() {
+		run, err := s.newRunner(providers, events, q).Execute(ctx, req.Prompt)
+		done <- completion{run: run, err: err}
+	}()
+
+	mixer := mix.New(lgr.Default())
+	select {
+	case c := <-done:
+		res := s.outcome(ctx, req, c.run, c.err)
+		if res.err == nil {
+			events.send(EventMixStarted, Event{MixProvider: s.opts.MixProvider})
+			res.mixed(mixer.Process(ctx, s.mixRequest(req, providers, c.run.Results)))
+		}
+		return res
+	case <-q.reached:
+	}
+
+	early := q.answered()
+	lgr.Printf("[INFO] %d providers answered, mixing without waiting for the rest", len(early))
+	events.send(EventMixStarted, Event{MixProvider: s.opts.MixProvider})
+	mixResp, mixErr := mixer.Process(ctx, s.mixRequest(req, providers, early))
+	if mixErr == nil && mixResp.TextWithHeader != "" {
+		events.send(EventMixResult, Event{Text: mixResp.TextWithHeader, MixProvider: mixResp.MixProvider})
+	}
+
+	c := <-done
+	res := s.outcome(ctx, req, c.run, c.err)
+	if res.err != nil {
+		return res
+	}
+	if mixErr != nil {
+		res.mixed(nil, mixErr)
+		return res
+	}
+	late := make([]provider.Result, 0, len(c.run.Results))
+	for _, r := range c.run.Results {
+		if !slices.ContainsFunc(early, func(e provider.Result) bool { return e.Provider == r.Provider }) {
+			late = append(late, r)
+		}
+	}
+	updated, err := mixer.Update(ctx, s.mixRequest(req, providers, c.run.Results), mixResp, late)
+	if err != nil {
+		lgr.Printf("[WARN] %v, using mixed result of the quorum", err)
+	}
+	res.mixed(updated, nil)
+	return res
+}
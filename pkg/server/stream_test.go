@@ -0,0 +1,222 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+type streamEvent struct {
+	typ string
+	ev  Event
+}
+
+// readEvents reads server-sent events of the response until the stream ends
+func readEvents(t *testing.T, resp *http.Response) []streamEvent {
+	t.Helper()
+	var res []streamEvent
+	var typ string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			typ = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			var ev Event
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev))
+			res = append(res, streamEvent{typ: typ, ev: ev})
+		}
+	}
+	require.NoError(t, scanner.Err())
+	return res
+}
+
+func TestServer_Stream(t *testing.T) {
+	providers := []provider.Provider{
+		newProvider("OpenAI", "answer from openai", nil),
+		newProvider("Anthropic", "", errors.New("rate limit")),
+		newProvider("Google", "answer from google", nil),
+	}
+	srv := New(Options{Providers: providers, MixProvider: "google", MixPrompt: "merge", JobRetention: time.Hour})
+	ts := httptest.NewServer(srv.routes(context.Background()))
+	defer ts.Close()
+
+	t.Run("events of mixed run", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/v1/stream", "application/json", strings.NewReader(`{"prompt":"q","mix":true}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		events := readEvents(t, resp)
+		byProvider := map[string][]string{}
+		var types []string
+		for _, e := range events {
+			if e.ev.Provider != "" {
+				byProvider[e.ev.Provider] = append(byProvider[e.ev.Provider], e.typ)
+			}
+			if e.typ == EventResult {
+				assert.Equal(t, "answer from "+strings.ToLower(e.ev.Provider), e.ev.Text)
+			}
+			types = append(types, e.typ)
+		}
+		assert.Equal(t, []string{EventProviderStarted, EventResult, EventProviderDone}, byProvider["OpenAI"])
+		assert.Equal(t, []string{EventProviderStarted, EventProviderDone}, byProvider["Anthropic"])
+		assert.Equal(t, []string{EventProviderStarted, EventResult, EventProviderDone}, byProvider["Google"])
+
+		require.Len(t, types, 10)
+		assert.Equal(t, []string{EventMixStarted, EventDone}, types[8:], "mix and done after all providers")
+		assert.Equal(t, "google", events[8].ev.MixProvider)
+		done := events[9].ev
+		assert.Equal(t, "== mixed results by Google ==\nmerged by Google", done.Text)
+		assert.Equal(t, "Google", done.MixProvider)
+		require.Len(t, done.Responses, 3)
+		assert.Equal(t, "rate limit", done.Responses[1].Error)
+	})
+
+	t.Run("failed run", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/v1/stream", "application/json", strings.NewReader(`{"prompt":"q","providers":["anthropic"]}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		events := readEvents(t, resp)
+		require.Len(t, events, 3)
+		assert.Equal(t, EventProviderDone, events[1].typ)
+		assert.Equal(t, "rate limit", events[1].ev.Error)
+		assert.Equal(t, EventDone, events[2].typ)
+		assert.Contains(t, events[2].ev.Error, "rate limit")
+		assert.Empty(t, events[2].ev.Text)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/v1/stream", "application/json", strings.NewReader(`{"prompt":""}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestServer_StreamQuorum(t *testing.T) {
+	release := make(chan struct{})
+	var once sync.Once
+	google := newProvider("Google", "answer from google", nil)
+	google.GenerateFunc = func(ctx context.Context, prompt string) (string, error) {
+		switch {
+		case strings.HasPrefix(prompt, "merge"):
+			once.Do(func() { close(release) }) // the slow provider answers after mixing of the quorum started
+			return "merged by Google", nil
+		case strings.HasPrefix(prompt, "update the merged answer"):
+			assert.Contains(t, prompt, "=== Merged answer by Google ===\nmerged by Google")
+			assert.Contains(t, prompt, "=== Result 1 from Slow ===\nlate answer")
+			return "updated by Google", nil
+		}
+		return "answer from google", nil
+	}
+	slow := newProvider("Slow", "", nil)
+	slow.GenerateFunc = func(ctx context.Context, prompt string) (string, error) {
+		select {
+		case <-release:
+			return "late answer", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	providers := []provider.Provider{newProvider("OpenAI", "answer from openai", nil), google, slow}
+	srv := New(Options{Providers: providers, MixProvider: "google", MixPrompt: "merge", MixQuorum: 2,
+		JobRetention: time.Hour})
+	ts := httptest.NewServer(srv.routes(context.Background()))
+	defer ts.Close()
+
+	t.Run("mixed before late answer", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/v1/stream", "application/json", strings.NewReader(`{"prompt":"q","mix":true}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		events := readEvents(t, resp)
+		var types []string
+		for _, e := range events {
+			if e.ev.Provider != "Slow" {
+				types = append(types, e.typ)
+			}
+		}
+		require.NotEmpty(t, types)
+		assert.Equal(t, []string{EventMixStarted, EventMixResult, EventDone}, types[len(types)-3:])
+
+		mixIdx := slices.IndexFunc(events, func(e streamEvent) bool { return e.typ == EventMixResult })
+		lateIdx := slices.IndexFunc(events, func(e streamEvent) bool { return e.typ == EventResult && e.ev.Provider == "Slow" })
+		assert.Less(t, mixIdx, lateIdx, "quorum mixed before the late answer")
+		assert.Equal(t, "== mixed results by Google ==\nmerged by Google", events[mixIdx].ev.Text)
+
+		done := events[len(events)-1].ev
+		assert.Equal(t, "== mixed results by Google, updated with late results of Slow ==\nupdated by Google", done.Text)
+		assert.Equal(t, "Google", done.MixProvider)
+		require.Len(t, done.Responses, 3)
+	})
+
+	t.Run("without quorum", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/v1/stream", "application/json",
+			strings.NewReader(`{"prompt":"q","mix":true,"providers":["openai","google"]}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		events := readEvents(t, resp)
+		require.Len(t, events, 8)
+		assert.Equal(t, EventMixStarted, events[6].typ)
+		assert.Equal(t, "== mixed results by Google ==\nmerged by Google", events[7].ev.Text)
+	})
+}
+
+func TestServer_StreamChunks(t *testing.T) {
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, text := range []string{"streamed", " answer"} {
+			_, _ = w.Write([]byte(`data: {"choices":[{"delta":{"content":"` + text + `"}}]}` + "\n\n"))
+		}
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer llm.Close()
+	providers := []provider.Provider{
+		provider.NewCustomOpenAI(provider.CustomOptions{Name: "Local", BaseURL: llm.URL + "/v1", Model: "m", Enabled: true}),
+		newProvider("Google", "answer from google", nil),
+	}
+	srv := New(Options{Providers: providers, JobRetention: time.Hour})
+	ts := httptest.NewServer(srv.routes(context.Background()))
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1/stream", "application/json", strings.NewReader(`{"prompt":"q"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var chunks []string
+	byProvider := map[string][]string{}
+	for _, e := range readEvents(t, resp) {
+		if e.ev.Provider == "" || e.typ == EventProgress {
+			continue
+		}
+		byProvider[e.ev.Provider] = append(byProvider[e.ev.Provider], e.typ)
+		if e.typ == EventChunk {
+			chunks = append(chunks, e.ev.Text)
+		}
+		if e.typ == EventResult && e.ev.Provider == "Local" {
+			assert.Equal(t, "streamed answer", e.ev.Text)
+		}
+	}
+	assert.Equal(t, []string{EventProviderStarted, EventChunk, EventChunk, EventChunk, EventResult, EventProviderDone},
+		byProvider["Local"])
+	assert.Equal(t, []string{"", "streamed", " answer"}, chunks, "empty chunk on start of the response")
+	assert.Equal(t, []string{EventProviderStarted, EventResult, EventProviderDone}, byProvider["Google"], "no chunks of not streaming provider")
+}
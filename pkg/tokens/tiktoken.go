@@ -0,0 +1,200 @@
+package tokens
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// ModelTokenizer is implemented by OpenAI-compatible providers, their prompts are counted locally with
+// tiktoken encoding of the model
+type ModelTokenizer interface {
+	TokenizerModel() string
+}
+
+// encodings loaded by tiktoken, loading failures are kept as well, so a missing encoding is not re-downloaded
+// for each provider
+var (
+	encodingsOnce sync.Once
+	encodingsMu   sync.Mutex
+	encodings     = map[string]loadedEncoding{}
+)
+
+type loadedEncoding struct {
+	enc *tiktoken.Tiktoken
+	err error
+}
+
+// CountTiktoken returns the number of tokens of the text for the model, counted by tiktoken. Models unknown
+// to tiktoken are counted with o200k_base encoding of current OpenAI models, and the count is not exact.
+// Encoding files are downloaded once and cached in $TIKTOKEN_CACHE_DIR or the user cache directory.
+func CountTiktoken(model, text string) (n int, exact bool, err error) {
+	name, exact := encodingFor(model)
+	enc, err := encoding(name)
+	if err != nil {
+		return 0, false, err
+	}
+	return len(enc.EncodeOrdinary(text)), exact, nil
+}
+
+// encodingFor returns the name of tiktoken encoding of the model, and false if the model is unknown.
+// Model names prefixed by a vendor, like openai/gpt-4o of OpenAI-compatible gateways, are matched without it.
+func encodingFor(model string) (string, bool) {
+	model = strings.ToLower(model[strings.LastIndex(model, "/")+1:])
+	if name, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return name, true
+	}
+	for prefix, name := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(model, prefix) {
+			return name, true
+		}
+	}
+	// models released after the tiktoken tables, all of them use o200k_base
+	for _, prefix := range []string{"gpt-5", "gpt-4.1", "gpt-4o", "o1", "o3", "o4", "chatgpt-", "gpt-oss"} {
+		if strings.HasPrefix(model, prefix) {
+			return tiktoken.MODEL_O200K_BASE, true
+		}
+	}
+	return tiktoken.MODEL_O200K_BASE, false
+}
+
+// encodingHashes are SHA-256 hashes of tiktoken encoding files by file name, the same as openai/tiktoken
+// pins them. Files are verified after download and when read from the cache, as a truncated or tampered
+// file would silently break counts used by size guards and budgets.
+var encodingHashes = map[string]string{
+	"r50k_base.tiktoken":   "306cd27f03c1a714eca7108e03d66b7dc042abe8c258b44c199a7ed9838dd930",
+	"p50k_base.tiktoken":   "94b5ca7dff4d00767bc256fdd1b27e5b17361d7b8a5f968547f9f23eb70d2069",
+	"cl100k_base.tiktoken": "223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7",
+	"o200k_base.tiktoken":  "446a9538cb6c348e3516120d7c08b09f57c36495e2acfffe59a5bf8b0cfb1a2d",
+}
+
+// encoding returns tiktoken encoding by name, loaded once
+func encoding(name string) (*tiktoken.Tiktoken, error) {
+	encodingsOnce.Do(func() {
+		tiktoken.SetBpeLoader(&bpeLoader{client: &http.Client{Timeout: 30 * time.Second}, hashes: encodingHashes})
+	})
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	if res, ok := encodings[name]; ok {
+		return res.enc, res.err
+	}
+	enc, err := tiktoken.GetEncoding(name)
+	if err != nil {
+		err = fmt.Errorf("failed to load %s encoding: %w", name, err)
+	}
+	encodings[name] = loadedEncoding{enc: enc, err: err}
+	return enc, err
+}
+
+// bpeLoader loads BPE ranks of tiktoken encodings from the cache directory, downloading missing files.
+// Unlike the default loader of tiktoken-go, it limits the download time, doesn't cache failed responses
+// and verifies files with their pinned hashes.
+type bpeLoader struct {
+	client *http.Client
+	hashes map[string]string // SHA-256 of encoding files by file name, files without hash are rejected
+}
+
+// LoadTiktokenBpe returns BPE ranks of the encoding file at the URL
+func (l *bpeLoader) LoadTiktokenBpe(url string) (map[string]int, error) {
+	data, err := l.read(url)
+	if err != nil {
+		return nil, err
+	}
+	ranks := make(map[string]int)
+	for line := range strings.SplitSeq(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid line %q in %s", line, url)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token %q in %s: %w", token, url, err)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank %q in %s: %w", rank, url, err)
+		}
+		ranks[string(decoded)] = n
+	}
+	return ranks, nil
+}
+
+// read returns the content of the encoding file from the cache, downloading and caching it if missing.
+// A cached file not matching its hash is downloaded again.
+func (l *bpeLoader) read(url string) ([]byte, error) {
+	name := path.Base(url)
+	hash, ok := l.hashes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding file %s, no hash to verify it", name)
+	}
+	dir := cacheDir()
+	cached := filepath.Join(dir, name)
+	if data, err := os.ReadFile(cached); err == nil { //nolint:gosec // file in the cache directory
+		if verifyHash(data, hash) == nil {
+			return data, nil
+		}
+		lgr.Printf("[WARN] cached encoding file %s doesn't match its hash, downloading it again", cached)
+		_ = os.Remove(cached)
+	}
+
+	resp, err := l.client.Get(url) //nolint:noctx // bounded by the client timeout
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: status %d", url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if err := verifyHash(data, hash); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", url, err)
+	}
+
+	// caching is best effort, the encoding is still usable if it can't be written
+	if err := os.MkdirAll(dir, 0o750); err == nil {
+		tmp := cached + ".tmp"
+		if err := os.WriteFile(tmp, data, 0o600); err == nil {
+			_ = os.Rename(tmp, cached)
+		}
+	}
+	return data, nil
+}
+
+// verifyHash checks SHA-256 of the data is the expected hex hash
+func verifyHash(data []byte, expected string) error {
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != expected {
+		return fmt.Errorf("sha256 mismatch, got %s", got)
+	}
+	return nil
+}
+
+// cacheDir returns the directory of cached encoding files, $TIKTOKEN_CACHE_DIR if set
+func cacheDir() string {
+	if dir := os.Getenv("TIKTOKEN_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "mpt", "tiktoken")
+	}
+	return filepath.Join(os.TempDir(), "mpt-tiktoken")
+}
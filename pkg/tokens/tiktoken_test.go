@@ -0,0 +1,152 @@
+package tokens
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/mpt/pkg/provider/mocks"
+)
+
+// fakeBPE returns BPE ranks file with all single bytes and merges of "he", "ll" and "hell"
+func fakeBPE() string {
+	var sb strings.Builder
+	for i := range 256 {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, tok := range []string{"he", "ll", "hell"} {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(tok)), 256+i)
+	}
+	return sb.String()
+}
+
+// tokenizer is an OpenAI-compatible provider counted with tiktoken
+type tokenizer struct {
+	*mocks.ProviderMock
+	model string
+}
+
+func (t tokenizer) TokenizerModel() string { return t.model }
+
+// sha returns hex SHA-256 of the text
+func sha(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCountTiktoken(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TIKTOKEN_CACHE_DIR", dir)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "o200k_base.tiktoken"), []byte(fakeBPE()), 0o600))
+	pinned := encodingHashes["o200k_base.tiktoken"]
+	encodingHashes["o200k_base.tiktoken"] = sha(fakeBPE())
+	defer func() { encodingHashes["o200k_base.tiktoken"] = pinned }()
+
+	n, exact, err := CountTiktoken("gpt-4o", "hello")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n, "hell + o")
+	assert.True(t, exact)
+
+	n, exact, err = CountTiktoken("openai/gpt-5-mini", "hello hello")
+	require.NoError(t, err)
+	assert.Equal(t, 5, n, "hell + o, space + hell + o")
+	assert.True(t, exact)
+
+	_, exact, err = CountTiktoken("llama-3.1-70b", "hello")
+	require.NoError(t, err)
+	assert.False(t, exact, "unknown model counted with o200k_base")
+
+	name := func(n string) *mocks.ProviderMock { return &mocks.ProviderMock{NameFunc: func() string { return n }} }
+	res := CountFor(context.Background(), tokenizer{ProviderMock: name("OpenAI"), model: "gpt-4o"}, "hello")
+	assert.Equal(t, Count{Provider: "OpenAI", Tokens: 2}, res)
+}
+
+func TestEncodingFor(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+		exact bool
+	}{
+		{"gpt-4o", "o200k_base", true},
+		{"gpt-4o-mini", "o200k_base", true},
+		{"gpt-4", "cl100k_base", true},
+		{"gpt-3.5-turbo-0125", "cl100k_base", true},
+		{"gpt-5", "o200k_base", true},
+		{"o3-mini", "o200k_base", true},
+		{"openai/GPT-4.1", "o200k_base", true},
+		{"mistral-large", "o200k_base", false},
+	}
+	for _, tt := range tests {
+		name, exact := encodingFor(tt.model)
+		assert.Equal(t, tt.want, name, tt.model)
+		assert.Equal(t, tt.exact, exact, tt.model)
+	}
+}
+
+func TestBpeLoader(t *testing.T) {
+	const bpe = "aGU= 256\nbGw= 257\n"
+	requests := 0
+	body := bpe
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/missing.tiktoken" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer ts.Close()
+	dir := t.TempDir()
+	t.Setenv("TIKTOKEN_CACHE_DIR", dir)
+	l := &bpeLoader{client: ts.Client(), hashes: map[string]string{"enc.tiktoken": sha(bpe), "missing.tiktoken": sha("")}}
+
+	ranks, err := l.LoadTiktokenBpe(ts.URL + "/enc.tiktoken")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"he": 256, "ll": 257}, ranks)
+	assert.FileExists(t, filepath.Join(dir, "enc.tiktoken"), "downloaded file cached")
+
+	_, err = l.LoadTiktokenBpe(ts.URL + "/enc.tiktoken")
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests, "cached file not downloaded again")
+
+	_, err = l.LoadTiktokenBpe(ts.URL + "/missing.tiktoken")
+	require.ErrorContains(t, err, "status 404")
+	assert.NoFileExists(t, filepath.Join(dir, "missing.tiktoken"), "failed response not cached")
+
+	t.Run("tampered cache downloaded again", func(t *testing.T) {
+		requests = 0
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "enc.tiktoken"), []byte("aGU= 1\n"), 0o600))
+		ranks, err := l.LoadTiktokenBpe(ts.URL + "/enc.tiktoken")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"he": 256, "ll": 257}, ranks)
+		assert.Equal(t, 1, requests)
+		data, err := os.ReadFile(filepath.Join(dir, "enc.tiktoken"))
+		require.NoError(t, err)
+		assert.Equal(t, bpe, string(data), "cache replaced")
+	})
+
+	t.Run("truncated download rejected", func(t *testing.T) {
+		require.NoError(t, os.Remove(filepath.Join(dir, "enc.tiktoken")))
+		body = bpe[:6]
+		defer func() { body = bpe }()
+		_, err := l.LoadTiktokenBpe(ts.URL + "/enc.tiktoken")
+		require.ErrorContains(t, err, "sha256 mismatch")
+		assert.NoFileExists(t, filepath.Join(dir, "enc.tiktoken"), "invalid file not cached")
+	})
+
+	t.Run("unknown file", func(t *testing.T) {
+		_, err := l.LoadTiktokenBpe(ts.URL + "/other.tiktoken")
+		require.EqualError(t, err, "unknown encoding file other.tiktoken, no hash to verify it")
+	})
+}
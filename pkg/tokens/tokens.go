@@ -0,0 +1,154 @@
+// Package tokens counts tokens of prompts per provider. Providers with a token counting API (Anthropic,
+// Google) count with their own tokenizers, OpenAI-compatible providers are counted locally with tiktoken,
+// and others get an estimate close to BPE tokenizers of GPT models.
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/go-pkgz/lgr"
+
+	"github.com/umputun/mpt/pkg/provider"
+)
+
+// Counter is implemented by providers able to count tokens of the prompt with their own tokenizer
+type Counter interface {
+	CountTokens(ctx context.Context, prompt string) (int, error)
+}
+
+// Count is the number of prompt tokens for a provider
+type Count struct {
+	Provider  string
+	Tokens    int
+	Estimated bool // not exact, estimated or counted with encoding of another model
+}
+
+// String returns the count with the provider name, estimated counts are prefixed with "~"
+func (c Count) String() string {
+	if c.Estimated {
+		return fmt.Sprintf("%s ~%d", c.Provider, c.Tokens)
+	}
+	return fmt.Sprintf("%s %d", c.Provider, c.Tokens)
+}
+
+// CountFor returns the number of tokens of the prompt for the provider, counted by the provider if it
+// implements Counter, with tiktoken if it implements ModelTokenizer, and estimated otherwise.
+// Failed counting falls back to the estimate.
+func CountFor(ctx context.Context, p provider.Provider, prompt string) Count {
+	if c, ok := p.(Counter); ok {
+		n, err := c.CountTokens(ctx, prompt)
+		if err == nil {
+			return Count{Provider: p.Name(), Tokens: n}
+		}
+		lgr.Printf("[WARN] failed to count tokens with %s, estimating: %v", p.Name(), err)
+	}
+	if t, ok := p.(ModelTokenizer); ok {
+		n, exact, err := CountTiktoken(t.TokenizerModel(), prompt)
+		if err == nil {
+			return Count{Provider: p.Name(), Tokens: n, Estimated: !exact}
+		}
+		lgr.Printf("[WARN] failed to count tokens of %s with tiktoken, estimating: %v", p.Name(), err)
+	}
+	return Count{Provider: p.Name(), Tokens: Estimate(prompt), Estimated: true}
+}
+
+// CountAll counts tokens of prompts for providers in parallel, as prompts are sent to them, so latencies
+// of counting APIs don't add up. The prompt of each provider is returned by prompt, counts are in the order
+// of providers.
+func CountAll(ctx context.Context, providers []provider.Provider, prompt func(p provider.Provider) string) []Count {
+	res := make([]Count, len(providers))
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res[i] = CountFor(ctx, p, prompt(p))
+		}()
+	}
+	wg.Wait()
+	return res
+}
+
+// Max returns the count with the most tokens, zero count for no counts
+func Max(counts []Count) Count {
+	res := Count{}
+	for _, c := range counts {
+		if c.Tokens > res.Tokens {
+			res = c
+		}
+	}
+	return res
+}
+
+// Format returns counts as a comma-separated list sorted by provider name
+func Format(counts []Count) string {
+	sorted := make([]string, 0, len(counts))
+	for _, c := range counts {
+		sorted = append(sorted, c.String())
+	}
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
+
+// Estimate returns the approximate number of tokens of the text. It splits the text the way BPE
+// tokenizers pre-tokenize it and counts tokens of each piece: words of latin letters take a token
+// per 6 letters, numbers a token per 3 digits, punctuation a token per 2 characters, other letters
+// (e.g. CJK) a token each, and whitespace a token per run. Usually it is within 15% of tiktoken counts.
+func Estimate(text string) int {
+	res := 0
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		class := runeClass(runes[i])
+		j := i + 1
+		for j < len(runes) && runeClass(runes[j]) == class && class != classOther {
+			j++
+		}
+		n := j - i
+		switch class {
+		case classWord:
+			res += (n + 5) / 6
+		case classDigit:
+			res += (n + 2) / 3
+		case classPunct:
+			res += (n + 1) / 2
+		case classSpace:
+			// a single space is merged into the following word by tokenizers
+			if n > 1 || runes[i] != ' ' || j == len(runes) {
+				res++
+			}
+		default:
+			res++
+		}
+		i = j
+	}
+	return res
+}
+
+// classes of runes for Estimate
+const (
+	classWord = iota
+	classDigit
+	classPunct
+	classSpace
+	classOther
+)
+
+func runeClass(r rune) int {
+	switch {
+	case unicode.Is(unicode.Latin, r):
+		return classWord
+	case unicode.IsDigit(r):
+		return classDigit
+	case unicode.IsSpace(r):
+		return classSpace
+	case unicode.IsPunct(r) || unicode.IsSymbol(r):
+		return classPunct
+	default:
+		return classOther
+	}
+}
@@ -0,0 +1,90 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/umputun/mpt/pkg/provider"
+	"github.com/umputun/mpt/pkg/provider/mocks"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"Hello, world! This is a test.", 9},
+		{"internationalization", 4},
+		{"year 2024 and 1234567", 7},
+		{"if (a != b) {\n\treturn err\n}", 12},
+		{"你好世界", 4},
+		{"trailing space ", 4},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Estimate(tt.text), tt.text)
+	}
+}
+
+// counter is a provider counting tokens with its own tokenizer
+type counter struct {
+	*mocks.ProviderMock
+	tokens int
+	err    error
+}
+
+func (c counter) CountTokens(context.Context, string) (int, error) { return c.tokens, c.err }
+
+func TestCountFor(t *testing.T) {
+	name := func(n string) *mocks.ProviderMock { return &mocks.ProviderMock{NameFunc: func() string { return n }} }
+
+	res := CountFor(context.Background(), counter{ProviderMock: name("Anthropic"), tokens: 42}, "some prompt")
+	assert.Equal(t, Count{Provider: "Anthropic", Tokens: 42}, res)
+
+	res = CountFor(context.Background(), counter{ProviderMock: name("Google"), err: errors.New("failed")}, "some prompt")
+	assert.Equal(t, Count{Provider: "Google", Tokens: 2, Estimated: true}, res, "failed counting is estimated")
+
+	res = CountFor(context.Background(), name("OpenAI"), "some prompt")
+	assert.Equal(t, Count{Provider: "OpenAI", Tokens: 2, Estimated: true}, res)
+}
+
+// slowCounter is a provider counting tokens with a slow API
+type slowCounter struct {
+	counter
+	delay time.Duration
+}
+
+func (c slowCounter) CountTokens(ctx context.Context, prompt string) (int, error) {
+	time.Sleep(c.delay)
+	return c.counter.CountTokens(ctx, prompt)
+}
+
+func TestCountAll(t *testing.T) {
+	name := func(n string) *mocks.ProviderMock { return &mocks.ProviderMock{NameFunc: func() string { return n }} }
+	providers := []provider.Provider{
+		slowCounter{counter: counter{ProviderMock: name("Anthropic"), tokens: 42}, delay: 100 * time.Millisecond},
+		slowCounter{counter: counter{ProviderMock: name("Google"), tokens: 7}, delay: 100 * time.Millisecond},
+		name("OpenAI"),
+	}
+	st := time.Now()
+	res := CountAll(context.Background(), providers, func(p provider.Provider) string {
+		if p.Name() == "OpenAI" {
+			return "some longer prompt"
+		}
+		return "some prompt"
+	})
+	assert.Less(t, time.Since(st), 190*time.Millisecond, "counted in parallel")
+	assert.Equal(t, []Count{{Provider: "Anthropic", Tokens: 42}, {Provider: "Google", Tokens: 7},
+		{Provider: "OpenAI", Tokens: 3, Estimated: true}}, res, "in the order of providers")
+}
+
+func TestFormatAndMax(t *testing.T) {
+	counts := []Count{{Provider: "OpenAI", Tokens: 120, Estimated: true}, {Provider: "Anthropic", Tokens: 130}}
+	assert.Equal(t, "Anthropic 130, OpenAI ~120", Format(counts))
+	assert.Equal(t, counts[1], Max(counts))
+	assert.Equal(t, Count{}, Max(nil))
+}
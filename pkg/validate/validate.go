@@ -0,0 +1,272 @@
+// Package validate implements checks of provider answers, used to re-ask providers for a corrected answer.
+// An answer can be checked with a regular expression or with a JSON schema. Only a subset of JSON schema
+// is supported: type, enum, const, properties, required, additionalProperties (boolean), items, minItems,
+// maxItems, minLength, maxLength, pattern, minimum and maximum.
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Validator checks answers with a regular expression or a JSON schema
+type Validator struct {
+	re     *regexp.Regexp // regular expression the answer should match, nil for schema validation
+	schema map[string]any // JSON schema the answer should conform to, nil for regex validation
+	spec   string         // original specification, used in messages
+}
+
+// New makes a Validator from the spec. The spec is an inline JSON schema if it starts with "{",
+// a path to a JSON schema file if it has .json extension and the file exists, and a regular expression otherwise.
+func New(spec string) (*Validator, error) {
+	trimmed := strings.TrimSpace(spec)
+	if trimmed == "" {
+		return nil, errors.New("empty validation spec")
+	}
+
+	var data []byte
+	switch {
+	case strings.HasPrefix(trimmed, "{"):
+		data = []byte(trimmed)
+	case strings.HasSuffix(strings.ToLower(trimmed), ".json") && fileExists(trimmed):
+		var err error
+		if data, err = os.ReadFile(trimmed); err != nil { //nolint:gosec // schema file is set by the user
+			return nil, fmt.Errorf("failed to read schema file: %w", err)
+		}
+	default:
+		re, err := regexp.Compile(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid validation regex %q: %w", spec, err)
+		}
+		return &Validator{re: re, spec: spec}, nil
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	return &Validator{schema: schema, spec: spec}, nil
+}
+
+// Check validates the answer, returns an error describing the problem if the answer is not valid.
+// For schema validation the answer can be wrapped in a markdown code block.
+func (v *Validator) Check(answer string) error {
+	if v.re != nil {
+		if !v.re.MatchString(answer) {
+			return fmt.Errorf("answer doesn't match regular expression %s", v.spec)
+		}
+		return nil
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(stripCodeFence(answer)), &value); err != nil {
+		return fmt.Errorf("answer is not valid JSON: %w", err)
+	}
+	return checkSchema(v.schema, value, "$")
+}
+
+// String returns the original specification of the validator
+func (v *Validator) String() string {
+	return v.spec
+}
+
+// checkSchema checks the value against the schema, path is the location of the value used in errors
+func checkSchema(schema map[string]any, value any, path string) error {
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		return fmt.Errorf("%s: expected type %v, got %s", path, t, typeName(value))
+	}
+	if c, ok := schema["const"]; ok && !equalValues(c, value) {
+		return fmt.Errorf("%s: expected %v", path, c)
+	}
+	if enum, ok := schema["enum"].([]any); ok && !containsValue(enum, value) {
+		return fmt.Errorf("%s: value %v is not one of %v", path, value, enum)
+	}
+
+	switch val := value.(type) {
+	case map[string]any:
+		return checkObject(schema, val, path)
+	case []any:
+		return checkArray(schema, val, path)
+	case string:
+		return checkString(schema, val, path)
+	case float64:
+		return checkNumber(schema, val, path)
+	}
+	return nil
+}
+
+// checkObject checks required, properties and additionalProperties keywords
+func checkObject(schema, obj map[string]any, path string) error {
+	if required, ok := schema["required"].([]any); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, found := obj[name]; !found {
+					return fmt.Errorf("%s: missing required property %q", path, name)
+				}
+			}
+		}
+	}
+
+	props, _ := schema["properties"].(map[string]any)
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names) // deterministic error for multiple invalid properties
+	for _, name := range names {
+		propSchema, ok := props[name].(map[string]any)
+		if !ok {
+			if additional, isBool := schema["additionalProperties"].(bool); isBool && !additional {
+				return fmt.Errorf("%s: unexpected property %q", path, name)
+			}
+			continue
+		}
+		if err := checkSchema(propSchema, obj[name], path+"."+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkArray checks minItems, maxItems and items keywords
+func checkArray(schema map[string]any, arr []any, path string) error {
+	if n, ok := number(schema, "minItems"); ok && float64(len(arr)) < n {
+		return fmt.Errorf("%s: expected at least %v items, got %d", path, n, len(arr))
+	}
+	if n, ok := number(schema, "maxItems"); ok && float64(len(arr)) > n {
+		return fmt.Errorf("%s: expected at most %v items, got %d", path, n, len(arr))
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		for i, item := range arr {
+			if err := checkSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkString checks minLength, maxLength and pattern keywords
+func checkString(schema map[string]any, s, path string) error {
+	length := float64(len([]rune(s)))
+	if n, ok := number(schema, "minLength"); ok && length < n {
+		return fmt.Errorf("%s: expected at least %v characters, got %v", path, n, length)
+	}
+	if n, ok := number(schema, "maxLength"); ok && length > n {
+		return fmt.Errorf("%s: expected at most %v characters, got %v", path, n, length)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern %q in schema: %w", path, pattern, err)
+		}
+		if !re.MatchString(s) {
+			return fmt.Errorf("%s: value %q doesn't match pattern %s", path, s, pattern)
+		}
+	}
+	return nil
+}
+
+// checkNumber checks minimum and maximum keywords
+func checkNumber(schema map[string]any, n float64, path string) error {
+	if limit, ok := number(schema, "minimum"); ok && n < limit {
+		return fmt.Errorf("%s: value %v is less than minimum %v", path, n, limit)
+	}
+	if limit, ok := number(schema, "maximum"); ok && n > limit {
+		return fmt.Errorf("%s: value %v is greater than maximum %v", path, n, limit)
+	}
+	return nil
+}
+
+// matchesType checks the value against a type name or a list of type names
+func matchesType(t, value any) bool {
+	switch tt := t.(type) {
+	case string:
+		return typeMatches(tt, value)
+	case []any:
+		for _, name := range tt {
+			if s, ok := name.(string); ok && typeMatches(s, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeMatches checks the value against a single JSON schema type name
+func typeMatches(name string, value any) bool {
+	actual := typeName(value)
+	if name == "integer" {
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	}
+	return name == actual
+}
+
+// typeName returns JSON schema type name of the decoded JSON value
+func typeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// number returns numeric keyword of the schema
+func number(schema map[string]any, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+// containsValue checks if the list has a value equal to the given one
+func containsValue(list []any, value any) bool {
+	for _, v := range list {
+		if equalValues(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalValues compares decoded JSON values
+func equalValues(a, b any) bool {
+	aj, aerr := json.Marshal(a)
+	bj, berr := json.Marshal(b)
+	return aerr == nil && berr == nil && string(aj) == string(bj)
+}
+
+// stripCodeFence removes markdown code block around the answer, models often wrap JSON in ```json blocks
+func stripCodeFence(answer string) string {
+	s := strings.TrimSpace(answer)
+	if !strings.HasPrefix(s, "```") || !strings.HasSuffix(s, "```") || len(s) < 6 {
+		return s
+	}
+	s = strings.TrimSuffix(s, "```")
+	if i := strings.Index(s, "\n"); i >= 0 {
+		return strings.TrimSpace(s[i+1:])
+	}
+	return strings.TrimSpace(strings.TrimPrefix(s, "```"))
+}
+
+// fileExists checks if the path is an existing regular file
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
@@ -0,0 +1,96 @@
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	schemaFile := filepath.Join(t.TempDir(), "schema.json")
+	require.NoError(t, os.WriteFile(schemaFile, []byte(`{"type": "object"}`), 0o600))
+
+	v, err := New(`^\d+$`)
+	require.NoError(t, err)
+	assert.NotNil(t, v.re)
+	assert.Equal(t, `^\d+$`, v.String())
+
+	v, err = New(`{"type": "array"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "array", v.schema["type"])
+
+	v, err = New(schemaFile)
+	require.NoError(t, err)
+	assert.Equal(t, "object", v.schema["type"])
+
+	v, err = New("missing.json")
+	require.NoError(t, err)
+	assert.NotNil(t, v.re, "missing file is treated as regex")
+
+	_, err = New("")
+	require.EqualError(t, err, "empty validation spec")
+	_, err = New("(unclosed")
+	require.ErrorContains(t, err, "invalid validation regex")
+	_, err = New("{bad json")
+	require.ErrorContains(t, err, "invalid JSON schema")
+}
+
+func TestValidator_CheckRegex(t *testing.T) {
+	v, err := New(`(?i)^(yes|no)\b`)
+	require.NoError(t, err)
+	require.NoError(t, v.Check("Yes, it is"))
+	require.EqualError(t, v.Check("maybe"), `answer doesn't match regular expression (?i)^(yes|no)\b`)
+}
+
+func TestValidator_CheckSchema(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"required": ["verdict", "issues"],
+		"additionalProperties": false,
+		"properties": {
+			"verdict": {"enum": ["approve", "reject"]},
+			"score": {"type": "integer", "minimum": 0, "maximum": 10},
+			"issues": {"type": "array", "maxItems": 2, "items": {"type": "string", "minLength": 3, "pattern": "^[a-z]"}}
+		}
+	}`
+	v, err := New(schema)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		answer  string
+		wantErr string
+	}{
+		{name: "valid", answer: `{"verdict": "approve", "score": 7, "issues": ["minor nit"]}`},
+		{name: "valid in code fence", answer: "```json\n{\"verdict\": \"reject\", \"issues\": []}\n```"},
+		{name: "not json", answer: "looks good", wantErr: "answer is not valid JSON"},
+		{name: "wrong type", answer: `["approve"]`, wantErr: "$: expected type object, got array"},
+		{name: "missing required", answer: `{"verdict": "approve"}`, wantErr: `$: missing required property "issues"`},
+		{name: "not in enum", answer: `{"verdict": "maybe", "issues": []}`, wantErr: "$.verdict: value maybe is not one of [approve reject]"},
+		{name: "additional property", answer: `{"verdict": "approve", "issues": [], "extra": 1}`, wantErr: `$: unexpected property "extra"`},
+		{name: "not integer", answer: `{"verdict": "approve", "issues": [], "score": 1.5}`, wantErr: "$.score: expected type integer, got number"},
+		{name: "above maximum", answer: `{"verdict": "approve", "issues": [], "score": 11}`, wantErr: "$.score: value 11 is greater than maximum 10"},
+		{name: "too many items", answer: `{"verdict": "approve", "issues": ["aaa", "bbb", "ccc"]}`, wantErr: "$.issues: expected at most 2 items, got 3"},
+		{name: "short item", answer: `{"verdict": "approve", "issues": ["ab"]}`, wantErr: "$.issues[0]: expected at least 3 characters, got 2"},
+		{name: "pattern mismatch", answer: `{"verdict": "approve", "issues": ["Abc"]}`, wantErr: `$.issues[0]: value "Abc" doesn't match pattern ^[a-z]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Check(tt.answer)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestStripCodeFence(t *testing.T) {
+	assert.Equal(t, `{"a": 1}`, stripCodeFence("```json\n{\"a\": 1}\n```"))
+	assert.Equal(t, `{"a": 1}`, stripCodeFence("  {\"a\": 1}  "))
+	assert.Equal(t, "```", stripCodeFence("```"))
+}